@@ -0,0 +1,128 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func newAddCmd() *cobra.Command {
+	var tags []string
+
+	addCmd := &cobra.Command{
+		Use:   "add [<joke>...]",
+		Short: "Add your own jokes",
+		Long: `Add your own jokes to the database. They are told before any fetched joke
+that hasn't been told yet, and repeated at random like all stored jokes.
+
+Without arguments, or with -, jokes are read from standard input, separated
+by blank lines, so a setup and its punchline can be on lines of their own.`,
+		Example: `  godad add "I used to hate facial hair… but then it grew on me."
+  godad add --lang de --tag tiere "Was ist orange und läuft durch den Wald? Eine Wanderine."
+  godad add < my-jokes.txt`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			lang, err := addLanguage(viper.GetString("lang"))
+			if err != nil {
+				return err
+			}
+
+			texts := args
+			if len(args) == 0 || (len(args) == 1 && args[0] == "-") {
+				if texts, err = readJokes(cmd.InOrStdin()); err != nil {
+					return err
+				}
+			}
+			if len(texts) == 0 {
+				return errors.New("no jokes to add")
+			}
+
+			store, err := openStore()
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			out := cmd.OutOrStdout()
+			added := 0
+			for _, text := range texts {
+				j := joke.Joke{Text: strings.TrimSpace(text), Source: joke.UserSourceName, Language: lang, Tags: tags}
+				if j.Text == "" {
+					continue
+				}
+				if stored, err := store.Find(cmd.Context(), j); err == nil {
+					fmt.Fprintf(out, "Joke is stored already as %d\n", stored.ID)
+					continue
+				} else if !errors.Is(err, joke.ErrNotFound) {
+					return err
+				}
+				if err := store.Save(cmd.Context(), &j); err != nil {
+					return fmt.Errorf("error adding joke: %w", err)
+				}
+				fmt.Fprintf(out, "Added joke %d\n", j.ID)
+				added++
+			}
+			if len(texts) > 1 {
+				fmt.Fprintf(out, "Added %d of %d jokes\n", added, len(texts))
+			}
+			return nil
+		},
+	}
+
+	addCmd.Flags().String("lang", autoLanguage, "Language of the jokes, auto for the language of the locale")
+	addCmd.Flags().StringSliceVar(&tags, "tag", nil, "Tag the jokes, e.g. --tag puns,animals")
+	return addCmd
+}
+
+// addLanguage returns the language to add jokes in: lang, or for "auto"
+// the language of the locale. Any language can be added, not only those
+// godad fetches jokes in.
+func addLanguage(lang string) (string, error) {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	switch {
+	case lang == autoLanguage:
+		if detected := detectLanguage(); detected != "" {
+			return detected, nil
+		}
+		return joke.DefaultLanguage, nil
+	case lang == "" || lang == allLanguages || strings.Contains(lang, ","):
+		return "", fmt.Errorf("jokes are added in a single language, not %q, pick one with --lang", lang)
+	}
+	return lang, nil
+}
+
+// readJokes reads jokes separated by blank lines
+func readJokes(r io.Reader) ([]string, error) {
+	var (
+		jokes []string
+		lines []string
+	)
+	flush := func() {
+		if len(lines) > 0 {
+			jokes = append(jokes, strings.Join(lines, "\n"))
+			lines = nil
+		}
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			flush()
+			continue
+		}
+		lines = append(lines, line)
+	}
+	flush()
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading jokes: %w", err)
+	}
+	return jokes, nil
+}
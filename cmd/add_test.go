@@ -0,0 +1,63 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/viper"
+)
+
+func TestReadJokes(t *testing.T) {
+	jokes, err := readJokes(strings.NewReader("\nFirst joke\n\nWhat's the setup?  \nThe punchline.\n\n\nLast joke"))
+	if err != nil {
+		t.Fatalf("readJokes() returned an error: %v", err)
+	}
+	want := []string{"First joke", "What's the setup?\nThe punchline.", "Last joke"}
+	if !reflect.DeepEqual(jokes, want) {
+		t.Errorf("readJokes() = %q, want %q", jokes, want)
+	}
+}
+
+func TestAddCmd(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("dbdir", t.TempDir())
+	viper.Set("lang", "de")
+
+	var out strings.Builder
+	cmd := newAddCmd()
+	cmd.SetArgs([]string{"--tag", "Eigene", "-"})
+	cmd.SetIn(strings.NewReader("Mein Witz\n\nNoch ein Witz\n\nMein Witz\n"))
+	cmd.SetOut(&out)
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("add returned an error: %v", err)
+	}
+	if want := "Added joke 1\nAdded joke 2\nJoke is stored already as 1\nAdded 2 of 3 jokes\n"; out.String() != want {
+		t.Errorf("add printed %q, want %q", out.String(), want)
+	}
+
+	store, err := openStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	j, err := store.NextUntold(context.Background(), "de")
+	if err != nil {
+		t.Fatalf("NextUntold() returned an error: %v", err)
+	}
+	j, _ = store.Get(context.Background(), j.ID)
+	if j.Text != "Mein Witz" || j.Source != joke.UserSourceName || strings.Join(j.Tags, ",") != "eigene" {
+		t.Errorf("added joke is %+v, want it untold from the user with the tag", j)
+	}
+
+	viper.Set("lang", "en,de")
+	if _, err := addLanguage(viper.GetString("lang")); err == nil {
+		t.Error("addLanguage() accepted several languages")
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/lhaig/godad/internal/browse"
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func newBrowseCmd() *cobra.Command {
+	var (
+		filter joke.ExportFilter
+		tag    string
+	)
+
+	browseCmd := &cobra.Command{
+		Use:   "browse",
+		Short: "Browse the stored jokes in a terminal UI",
+		Long: `Browse the stored jokes, told or not, in a terminal UI, to manage a large
+collection without remembering the flags of every command:
+
+  ↑/↓, j/k     move through the jokes, with PgUp/PgDn, g and G to jump
+  /            search the jokes as you type; Enter keeps the search, Esc
+               clears it
+  t            show only the jokes with a tag, e.g. starred
+  1-5          rate the selected joke
+  s            star the selected joke, or unstar it, by tagging it
+               ` + browse.StarTag + `
+  Enter        tell the selected joke: quit, mark it as told and print it
+  q, Esc       quit
+
+--lang and --source narrow down the jokes loaded, --tag starts out showing
+only the jokes with a tag.`,
+		Example: `  godad browse
+  godad browse --lang de --tag ` + browse.StarTag,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			store, err := openStoreAs[joke.ExportStore]("browse jokes")
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			jokes, err := store.Export(cmd.Context(), filter)
+			if err != nil {
+				return err
+			}
+			if len(jokes) == 0 {
+				return errors.New(`no jokes stored yet, tell or prefetch some first, e.g. with "godad prefetch"`)
+			}
+			st, err := newStyle(viper.GetString("theme"), false)
+			if err != nil {
+				return err
+			}
+
+			model := browse.New(cmd.Context(), store, jokes)
+			model.SetTag(tag)
+			final, err := tea.NewProgram(model,
+				tea.WithContext(cmd.Context()),
+				tea.WithInput(cmd.InOrStdin()),
+				tea.WithOutput(cmd.OutOrStdout()),
+				tea.WithAltScreen(),
+			).Run()
+			if err != nil {
+				return fmt.Errorf("error running the browser: %w", err)
+			}
+			if j, ok := final.(browse.Model).Told(); ok {
+				fmt.Fprint(cmd.OutOrStdout(), st.joke(j.Text))
+			}
+			return nil
+		},
+	}
+
+	browseCmd.Flags().StringVar(&filter.Language, "lang", "", "Only browse jokes in this language")
+	browseCmd.Flags().StringVar(&filter.Source, "source", "", "Only browse jokes from this source")
+	browseCmd.Flags().StringVar(&tag, "tag", "", "Start out showing only the jokes with this tag")
+	return browseCmd
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestSetConfigValue(t *testing.T) {
+	home := t.TempDir()
+	path := filepath.Join(home, "config")
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeStarterConfig(f, home, "env"); err != nil {
+		t.Fatalf("writeStarterConfig() returned an error: %v", err)
+	}
+	f.Close()
+
+	settings := map[string]string{
+		"lang":           "de",
+		"format":         `"{{.Joke}}" — via {{.Source}} #dadjoke`,
+		"max_duplicates": "3",
+	}
+	for key, val := range settings {
+		if err := setConfigValue(path, key, val); err != nil {
+			t.Fatalf("setConfigValue() returned an error: %v", err)
+		}
+	}
+	// Setting a value again replaces it
+	if err := setConfigValue(path, "max_duplicates", "4"); err != nil {
+		t.Fatalf("setConfigValue() returned an error: %v", err)
+	}
+	settings["max_duplicates"] = "4"
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "MAX_DUPLICATES="); n != 1 {
+		t.Errorf("Config file has %d MAX_DUPLICATES lines, want 1:\n%s", n, data)
+	}
+	if !strings.Contains(string(data), "# Language of the jokes") {
+		t.Errorf("Config file lost its comments:\n%s", data)
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("env")
+	if err := v.ReadInConfig(); err != nil {
+		t.Fatalf("Error reading config file: %v", err)
+	}
+	for key, want := range settings {
+		if got := v.GetString(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	if v.IsSet("timeout") {
+		t.Errorf("Commented out setting timeout is set")
+	}
+}
+
+func TestStructuredConfigFormats(t *testing.T) {
+	for _, format := range []string{"yaml", "toml", "json"} {
+		t.Run(format, func(t *testing.T) {
+			home := t.TempDir()
+			path := filepath.Join(home, configFormats[format])
+
+			f, err := os.Create(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := writeStarterConfig(f, home, format); err != nil {
+				t.Fatalf("writeStarterConfig() returned an error: %v", err)
+			}
+			f.Close()
+
+			if err := setConfigValue(path, "lang", "de"); err != nil {
+				t.Fatalf("setConfigValue() returned an error: %v", err)
+			}
+
+			v := viper.New()
+			v.SetConfigFile(path)
+			if err := v.ReadInConfig(); err != nil {
+				t.Fatalf("Error reading config file: %v", err)
+			}
+			if got := v.GetString("lang"); got != "de" {
+				t.Errorf("lang = %q, want %q", got, "de")
+			}
+			if format == "json" {
+				if got := v.GetDuration("timeout"); got != 10*time.Second {
+					t.Errorf("timeout = %v, want 10s", got)
+				}
+			}
+		})
+	}
+}
+
+func TestFindConfigFile(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+	for _, path := range []string{
+		filepath.Join(first, "config"),
+		filepath.Join(first, "config.toml"),
+		filepath.Join(second, "config.yaml"),
+	} {
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, want := findConfigFile(first, second), filepath.Join(first, "config.toml"); got != want {
+		t.Errorf("findConfigFile() = %q, want %q", got, want)
+	}
+	if got := findConfigFile(t.TempDir()); got != "" {
+		t.Errorf("findConfigFile() in an empty directory = %q, want none", got)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"errors"
+
+	"github.com/lhaig/godad/internal/daemon"
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func newDaemonCmd() *cobra.Command {
+	daemonCmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "Deliver jokes on a schedule",
+		Long: `Run until interrupted and deliver a fresh joke whenever the cron-style
+schedule fires. Run it in the background with a service manager like
+systemd or launchd, or with nohup. Changes to the config file apply
+without a restart.
+
+The schedule is a standard five field cron expression (minute, hour, day of
+month, month, day of week), or a descriptor like @hourly or "@every 30m".
+
+Sinks:
+  stdout          Print the joke
+  file:<path>     Append the joke to a file
+  motd:<path>     Replace the file with the joke, see "godad motd"
+  webhook:<url>   POST the joke as JSON to a URL
+  notify          Raise a desktop notification`,
+		Example: `  godad daemon --schedule "0 9 * * MON-FRI"
+  godad daemon --schedule @hourly --sinks notify,file:/var/log/dadjokes.log
+  godad daemon --sinks webhook:https://hooks.slack.com/services/...`,
+		Args: cobra.NoArgs,
+		RunE: runDaemon,
+		// Log every delivery
+		Annotations: map[string]string{logLevelAnnotation: "info"},
+	}
+	addEngineFlags(daemonCmd)
+	daemonCmd.Flags().String("schedule", daemon.DefaultSchedule, "Cron-style schedule to deliver jokes on")
+	daemonCmd.Flags().StringSlice("sinks", []string{"stdout"}, "Where to deliver jokes (stdout, file:<path>, motd:<path>, webhook:<url>, notify)")
+	return daemonCmd
+}
+
+func runDaemon(cmd *cobra.Command, _ []string) error {
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	d := &daemon.Daemon{}
+	engine, err := configureDaemon(d, store)
+	if err != nil {
+		return err
+	}
+	ctx := cmd.Context()
+	stopRefill := startRefill(ctx, engine)
+	// Changes to the schedule, sinks, sources and filters apply to the
+	// next delivery
+	watchConfig(cmd, func() error {
+		engine, err := configureDaemon(d, store)
+		if err != nil {
+			return err
+		}
+		stopRefill()
+		stopRefill = startRefill(ctx, engine)
+		log.Info().Str("schedule", viper.GetString("schedule")).Strs("sinks", configList("sinks")).Msg("Daemon settings reloaded")
+		return nil
+	})
+
+	log.Info().Str("schedule", viper.GetString("schedule")).Strs("sinks", configList("sinks")).Msg("Daemon started")
+	return d.Run(ctx)
+}
+
+// configureDaemon sets up the schedule, sinks and engine of d from the
+// settings, leaving d as it was if they are invalid. It returns the engine.
+func configureDaemon(d *daemon.Daemon, store joke.Store) (*joke.Engine, error) {
+	schedule, err := daemon.ParseSchedule(viper.GetString("schedule"))
+	if err != nil {
+		return nil, err
+	}
+	var sinks []daemon.Sink
+	for _, spec := range configList("sinks") {
+		sink, err := daemon.ParseSink(spec)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if len(sinks) == 0 {
+		return nil, errors.New("no sinks to deliver jokes to")
+	}
+
+	engine, err := newEngine(store, viper.GetString("lang"))
+	if err != nil {
+		return nil, err
+	}
+	d.Update(schedule, engine.Tell, sinks, viper.GetDuration("sink_timeout"))
+	return engine, nil
+}
@@ -0,0 +1,539 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func newDBCmd() *cobra.Command {
+	dbCmd := &cobra.Command{
+		Use:   "db",
+		Short: "Manage the joke database",
+	}
+
+	dbCmd.AddCommand(
+		&cobra.Command{
+			Use:   "path",
+			Short: "Print the location of the database file",
+			Args:  cobra.NoArgs,
+			Run: func(cmd *cobra.Command, _ []string) {
+				fmt.Fprintln(cmd.OutOrStdout(), dbPath())
+			},
+		},
+		&cobra.Command{
+			Use:   "version",
+			Short: "Print the schema version of the database",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, _ []string) error {
+				store, err := openSQLite()
+				if err != nil {
+					return err
+				}
+				defer store.Close()
+
+				version, err := store.SchemaVersion()
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%d (latest %d)\n", version, joke.LatestSchemaVersion())
+				return nil
+			},
+		},
+		newDBMigrateCmd(),
+		newDBEmbedCmd(),
+		newDBBackupCmd(),
+		newDBRestoreCmd(),
+		newDBVacuumCmd(),
+		newDBCheckCmd(),
+		newDBStatsCmd(),
+		newDBRekeyCmd("encrypt"),
+		newDBRekeyCmd("decrypt"),
+	)
+
+	return dbCmd
+}
+
+func newDBMigrateCmd() *cobra.Command {
+	var to int
+
+	migrateCmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Migrate the database schema to a given version",
+		Long: `Migrate the database schema. The database is always migrated to the latest
+version when it is opened, so this is mostly useful with --to to revert
+to the schema of an older release.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			store, err := openSQLite()
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			if err := store.MigrateTo(to); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Database schema is at version %d\n", to)
+			return nil
+		},
+	}
+	migrateCmd.Flags().IntVar(&to, "to", joke.LatestSchemaVersion(), "Schema version to migrate to")
+	return migrateCmd
+}
+
+func newDBEmbedCmd() *cobra.Command {
+	var batch int
+
+	embedCmd := &cobra.Command{
+		Use:   "embed",
+		Short: "Make the missing embeddings of the stored jokes",
+		Long: `Make an embedding of every stored joke that has none yet with the model in
+embeddings_model, so new jokes are compared to all of them. Jokes told
+with embeddings_model set are embedded as they are stored.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			embedder := newEmbedder()
+			if embedder == nil {
+				return errors.New("set embeddings_model to make embeddings")
+			}
+			store, err := openSQLite()
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			n, err := joke.EmbedStored(cmd.Context(), store, embedder, batch)
+			fmt.Fprintf(cmd.OutOrStdout(), "Made %d embeddings\n", n)
+			return err
+		},
+	}
+	embedCmd.Flags().IntVar(&batch, "batch", 100, "Jokes to embed per request")
+	return embedCmd
+}
+
+func newDBBackupCmd() *cobra.Command {
+	var compress bool
+
+	backupCmd := &cobra.Command{
+		Use:   "backup [<path>]",
+		Short: "Back up the database",
+		Long: `Copy the database to a backup file, which is safe to do while godad is
+telling jokes. Without a path, or with a directory, the backup is named
+after the current time, like godad-2024-05-01-090000.db.
+
+With --gzip, or a path ending in .gz, the backup is compressed.
+"godad db restore" restores either kind.`,
+		Example: `  godad db backup
+  godad db backup --gzip ~/Backups
+  godad db backup /media/usb/jokes.db.gz`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := "."
+			if len(args) > 0 {
+				path = args[0]
+			}
+			if info, err := os.Stat(path); err == nil && info.IsDir() {
+				path = filepath.Join(path, backupName(time.Now(), compress))
+			} else if err == nil {
+				return fmt.Errorf("%s exists already", path)
+			}
+			compress = compress || strings.HasSuffix(path, ".gz")
+
+			store, err := openSQLite()
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			if !compress {
+				if err := store.Backup(cmd.Context(), path); err != nil {
+					os.Remove(path)
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Backed up the database to %s\n", path)
+				return nil
+			}
+
+			// The backup API writes databases, so compress a copy
+			tmp := path + ".tmp"
+			defer os.Remove(tmp)
+			if err := store.Backup(cmd.Context(), tmp); err != nil {
+				return err
+			}
+			if err := gzipFile(tmp, path); err != nil {
+				os.Remove(path)
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Backed up the database to %s\n", path)
+			return nil
+		},
+	}
+	backupCmd.Flags().BoolVar(&compress, "gzip", false, "Compress the backup with gzip")
+	return backupCmd
+}
+
+func newDBRestoreCmd() *cobra.Command {
+	var yes bool
+
+	restoreCmd := &cobra.Command{
+		Use:   "restore <path>",
+		Short: "Restore the database from a backup",
+		Long: `Replace the database with a backup made by "godad db backup", compressed
+or not. The backup is checked and migrated to the current schema before
+it replaces the database, which has to be confirmed unless --yes is given.
+
+Stop any godad daemon or server before restoring, as they keep the
+database open.`,
+		Example: `  godad db restore ~/Backups/godad-2024-05-01-090000.db.gz`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := os.MkdirAll(viper.GetString("dbdir"), 0o755); err != nil {
+				return fmt.Errorf("error creating database directory: %w", err)
+			}
+			target := dbPath()
+			tmp := target + ".restore"
+			defer os.Remove(tmp)
+			if err := copyBackup(args[0], tmp); err != nil {
+				return err
+			}
+
+			key, err := dbKey()
+			if err != nil {
+				return err
+			}
+			// Opening the backup checks and migrates it
+			restored, err := joke.OpenEncryptedSQLite(tmp, key)
+			if err != nil {
+				return fmt.Errorf("%s is not a godad database: %w", args[0], err)
+			}
+			if err := restored.Close(); err != nil {
+				return fmt.Errorf("error closing backup: %w", err)
+			}
+
+			out := cmd.OutOrStdout()
+			if !yes {
+				fmt.Fprintf(out, "Replace the database at %s with %s? [y/N] ", target, args[0])
+				if !confirmed(bufio.NewReader(cmd.InOrStdin())) {
+					fmt.Fprintln(out, "Not restored")
+					return nil
+				}
+			}
+			if err := replaceDB(tmp, target); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "Restored the database from %s\n", args[0])
+			return nil
+		},
+	}
+	restoreCmd.Flags().BoolVarP(&yes, "yes", "y", false, "Restore without asking for confirmation")
+	return restoreCmd
+}
+
+// newDBRekeyCmd returns "godad db encrypt", which encrypts the database
+// with the configured key, or "godad db decrypt", which decrypts it
+func newDBRekeyCmd(use string) *cobra.Command {
+	encrypt := use == "encrypt"
+	short := "Encrypt the database"
+	long := `Encrypt the unencrypted database with the key in db_key, or printed by
+db_key_command. godad has to be built with the sqlcipher tag.`
+	done := "Encrypted the database"
+	if !encrypt {
+		short = "Decrypt the database"
+		long = `Decrypt the database encrypted with the key in db_key, or printed by
+db_key_command, e.g. before building godad without the sqlcipher tag.
+Unset the key afterwards.`
+		done = "Decrypted the database"
+	}
+
+	return &cobra.Command{
+		Use:   use,
+		Short: short,
+		Long:  long,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			key, err := dbKey()
+			if err != nil {
+				return err
+			}
+			if key == "" {
+				return errors.New("set the key with db_key, GODAD_DB_KEY or db_key_command")
+			}
+			from, to := "", key
+			if !encrypt {
+				from, to = key, ""
+			}
+
+			path := dbPath()
+			store, err := joke.OpenEncryptedSQLite(path, from)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+			tmp := path + ".rekey"
+			defer os.Remove(tmp)
+			if err := store.Rekey(cmd.Context(), tmp, to); err != nil {
+				return err
+			}
+			if err := store.Close(); err != nil {
+				return fmt.Errorf("error closing database: %w", err)
+			}
+			if err := replaceDB(tmp, path); err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), done)
+			return nil
+		},
+	}
+}
+
+// replaceDB replaces the database at path with the one at src
+func replaceDB(src, path string) error {
+	// Journals of the replaced database must not be applied to the new one
+	for _, suffix := range []string{"-journal", "-wal", "-shm"} {
+		if err := os.Remove(path + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error removing %s: %w", path+suffix, err)
+		}
+	}
+	if err := os.Rename(src, path); err != nil {
+		return fmt.Errorf("error replacing database: %w", err)
+	}
+	return nil
+}
+
+// backupName returns the file name of a backup made at t
+func backupName(t time.Time, compress bool) string {
+	name := "godad-" + t.Format("2006-01-02-150405") + ".db"
+	if compress {
+		name += ".gz"
+	}
+	return name
+}
+
+// gzipFile writes the contents of src compressed to dst
+func gzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("error opening %s: %w", src, err)
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", dst, err)
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if err := errors.Join(err, zw.Close(), out.Close()); err != nil {
+		return fmt.Errorf("error compressing backup: %w", err)
+	}
+	return nil
+}
+
+// copyBackup copies the backup at src to dst, decompressing it if it is
+// gzipped
+func copyBackup(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("error opening backup: %w", err)
+	}
+	defer in.Close()
+
+	r := bufio.NewReader(in)
+	var data io.Reader = r
+	// Tell gzipped backups by their magic number rather than their name
+	if magic, err := r.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("error decompressing backup: %w", err)
+		}
+		defer zr.Close()
+		data = zr
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", dst, err)
+	}
+	_, err = io.Copy(out, data)
+	if err := errors.Join(err, out.Close()); err != nil {
+		return fmt.Errorf("error copying backup: %w", err)
+	}
+	return nil
+}
+
+func newDBVacuumCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "vacuum",
+		Short: "Compact the database",
+		Long: `Rebuild the database to give back the space of deleted jokes, and gather
+the statistics SQLite uses to pick indexes. Jokes can't be told while the
+database is rebuilt.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			store, err := openSQLite()
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			before, err := store.Stats(cmd.Context())
+			if err != nil {
+				return err
+			}
+			if err := store.Vacuum(cmd.Context()); err != nil {
+				return err
+			}
+			after, err := store.Stats(cmd.Context())
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Vacuumed the database from %s to %s\n", formatBytes(before.Size()), formatBytes(after.Size()))
+			return nil
+		},
+	}
+}
+
+func newDBCheckCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "check",
+		Short: "Check the integrity of the database",
+		Long: `Check the database for corruption and for rows that refer to missing
+ones. If problems are found, the command explains how to recover and
+exits with an error.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			store, err := openSQLite()
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			problems, err := store.Check(cmd.Context())
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			if len(problems) == 0 {
+				fmt.Fprintln(out, "The database is healthy")
+				return nil
+			}
+			for _, problem := range problems {
+				fmt.Fprintln(out, problem)
+			}
+			path := dbPath()
+			fmt.Fprintf(out, `
+To recover, restore a backup with
+
+  godad db restore <backup>
+
+or, without one, save what is left with the sqlite3 shell and restore that:
+
+  sqlite3 %s .recover | sqlite3 recovered.db
+  godad db restore recovered.db
+`, path)
+			return fmt.Errorf("found %d problems in the database", len(problems))
+		},
+	}
+}
+
+func newDBStatsCmd() *cobra.Command {
+	var output string
+
+	statsCmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Show the size and contents of the database",
+		Long: `Show the size of the database on disk, the rows of each table and the
+indexes. Indexes that aren't analyzed and free space are fixed by
+"godad db vacuum".`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if output != "table" && output != "json" {
+				return fmt.Errorf("unknown output format %q, use table or json", output)
+			}
+			store, err := openSQLite()
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			stats, err := store.Stats(cmd.Context())
+			if err != nil {
+				return err
+			}
+			if output == "json" {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(stats)
+			}
+			return writeDBStats(cmd.OutOrStdout(), stats, dbPath())
+		},
+	}
+	statsCmd.Flags().StringVarP(&output, "output", "o", "table", "Output format (table, json)")
+	return statsCmd
+}
+
+// writeDBStats writes the statistics of the database at path as tables
+func writeDBStats(out io.Writer, stats joke.DBStats, path string) error {
+	// The write-ahead log holds changes not yet written to the database
+	size := stats.Size()
+	if info, err := os.Stat(path + "-wal"); err == nil {
+		size += info.Size()
+	}
+	fmt.Fprintf(out, "Database: %s\nSize:     %s, %s free\n\n", path, formatBytes(size), formatBytes(stats.FreePages*stats.PageSize))
+
+	rows := map[string]int64{}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TABLE\tROWS")
+	for _, t := range stats.Tables {
+		rows[t.Name] = t.Rows
+		fmt.Fprintf(w, "%s\t%d\n", t.Name, t.Rows)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out)
+	w = tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "INDEX\tTABLE\tROWS PER KEY")
+	for _, idx := range stats.Indexes {
+		health := "-"
+		switch {
+		case idx.Analyzed:
+			health = strconv.FormatInt(idx.RowsPerKey, 10)
+		case rows[idx.Table] > 0:
+			health = "not analyzed"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", idx.Name, idx.Table, health)
+	}
+	return w.Flush()
+}
+
+// formatBytes formats a size in bytes for people, like 1.5 MiB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
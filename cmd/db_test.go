@@ -0,0 +1,210 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func TestBackupName(t *testing.T) {
+	at := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	if got, want := backupName(at, false), "godad-2024-05-01-090000.db"; got != want {
+		t.Errorf("backupName() = %q, want %q", got, want)
+	}
+	if got, want := backupName(at, true), "godad-2024-05-01-090000.db.gz"; got != want {
+		t.Errorf("backupName() compressed = %q, want %q", got, want)
+	}
+}
+
+func TestDBBackupRestore(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("dbdir", t.TempDir())
+
+	store, err := openSQLite()
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := joke.Joke{Text: "A joke worth keeping", Source: "user", Language: "en"}
+	if err := store.Save(context.Background(), &j); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	backups := t.TempDir()
+	cmd := newDBBackupCmd()
+	cmd.SetArgs([]string{"--gzip", backups})
+	cmd.SetOut(&strings.Builder{})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("db backup returned an error: %v", err)
+	}
+	matches, _ := filepath.Glob(filepath.Join(backups, "godad-*.db.gz"))
+	if len(matches) != 1 {
+		t.Fatalf("db backup wrote %q, want one compressed backup", matches)
+	}
+	cmd = newDBBackupCmd()
+	cmd.SetArgs([]string{matches[0]})
+	cmd.SetOut(&strings.Builder{})
+	cmd.SetErr(&strings.Builder{})
+	if err := cmd.Execute(); err == nil {
+		t.Error("db backup over an existing file returned no error")
+	}
+
+	// Restore into an empty database directory, as on a new laptop
+	viper.Set("dbdir", t.TempDir())
+	var out strings.Builder
+	cmd = newDBRestoreCmd()
+	cmd.SetArgs([]string{matches[0]})
+	cmd.SetIn(strings.NewReader("n\n"))
+	cmd.SetOut(&out)
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("db restore returned an error: %v", err)
+	}
+	if _, err := os.Stat(dbPath()); err == nil {
+		t.Error("db restore replaced the database without confirmation")
+	}
+
+	cmd = newDBRestoreCmd()
+	cmd.SetArgs([]string{"--yes", matches[0]})
+	cmd.SetOut(&out)
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("db restore returned an error: %v", err)
+	}
+	store, err = openSQLite()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if got, err := store.Get(context.Background(), j.ID); err != nil || got.Text != j.Text {
+		t.Errorf("restored joke = %+v, %v, want %q", got, err, j.Text)
+	}
+
+	notDB := filepath.Join(t.TempDir(), "jokes.txt")
+	if err := os.WriteFile(notDB, []byte("not a database, just a joke"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cmd = newDBRestoreCmd()
+	cmd.SetArgs([]string{"--yes", notDB})
+	cmd.SetOut(&strings.Builder{})
+	cmd.SetErr(&strings.Builder{})
+	if err := cmd.Execute(); err == nil {
+		t.Error("db restore of a file that is no database returned no error")
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, want := range map[int64]string{
+		0:               "0 B",
+		1023:            "1023 B",
+		1536:            "1.5 KiB",
+		5 * 1024 * 1024: "5.0 MiB",
+	} {
+		if got := formatBytes(n); got != want {
+			t.Errorf("formatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestDBMaintenance(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("dbdir", t.TempDir())
+
+	for _, tt := range []struct {
+		name string
+		cmd  func() *cobra.Command
+		want string
+	}{
+		{"check", newDBCheckCmd, "The database is healthy\n"},
+		{"vacuum", newDBVacuumCmd, "Vacuumed the database from "},
+		{"stats", newDBStatsCmd, "Database: " + dbPath()},
+	} {
+		var out strings.Builder
+		cmd := tt.cmd()
+		cmd.SetArgs(nil)
+		cmd.SetOut(&out)
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("db %s returned an error: %v", tt.name, err)
+		}
+		if !strings.HasPrefix(out.String(), tt.want) {
+			t.Errorf("db %s printed %q, want it to start with %q", tt.name, out.String(), tt.want)
+		}
+	}
+}
+
+func TestDBKey(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	if key, err := dbKey(); err != nil || key != "" {
+		t.Errorf("dbKey() without a key = %q, %v, want none", key, err)
+	}
+	viper.Set("db_key", "secret")
+	if key, err := dbKey(); err != nil || key != "secret" {
+		t.Errorf("dbKey() with db_key = %q, %v, want secret", key, err)
+	}
+	if runtime.GOOS == "windows" {
+		return
+	}
+
+	viper.Set("db_key", "")
+	viper.Set("db_key_command", "echo from the keychain")
+	if key, err := dbKey(); err != nil || key != "from the keychain" {
+		t.Errorf("dbKey() with db_key_command = %q, %v, want its output", key, err)
+	}
+	viper.Set("db_key_command", "false")
+	if _, err := dbKey(); err == nil {
+		t.Error("dbKey() with a failing db_key_command returned no error")
+	}
+}
+
+func TestDBEncryptDecrypt(t *testing.T) {
+	if !joke.EncryptionSupported {
+		t.Skip("encryption needs the sqlcipher build tag")
+	}
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("dbdir", t.TempDir())
+
+	store, err := openSQLite()
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := joke.Joke{Text: "A confidential joke", Source: "user", Language: "en"}
+	if err := store.Save(context.Background(), &j); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	viper.Set("db_key", "secret")
+	for _, use := range []string{"encrypt", "decrypt"} {
+		cmd := newDBRekeyCmd(use)
+		cmd.SetArgs(nil)
+		cmd.SetOut(&strings.Builder{})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("db %s returned an error: %v", use, err)
+		}
+		if use == "decrypt" {
+			viper.Set("db_key", "")
+		}
+		store, err := openSQLite()
+		if err != nil {
+			t.Fatalf("opening the database after db %s returned an error: %v", use, err)
+		}
+		if got, err := store.Get(context.Background(), j.ID); err != nil || got.Text != j.Text {
+			t.Errorf("joke after db %s = %+v, %v, want %q", use, got, err, j.Text)
+		}
+		store.Close()
+	}
+}
@@ -0,0 +1,12 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build !unix
+
+package cmd
+
+import "os/exec"
+
+// detach does nothing on systems where child processes outlive their
+// parent anyway
+func detach(*exec.Cmd) {}
@@ -0,0 +1,91 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/rs/zerolog/log"
+)
+
+// appName is the name of godad's directories
+const appName = "godad"
+
+// dataDir returns the directory the database is stored in by default:
+// $XDG_DATA_HOME/godad, or the platform's equivalent
+func dataDir(home string) string {
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, appName)
+	}
+	switch runtime.GOOS {
+	case "windows":
+		if dir := os.Getenv("APPDATA"); dir != "" {
+			return filepath.Join(dir, appName)
+		}
+	case "darwin":
+		return filepath.Join(home, "Library", "Application Support", appName)
+	}
+	return filepath.Join(home, ".local", "share", appName)
+}
+
+// configDir returns the directory the config file is read from:
+// $XDG_CONFIG_HOME/godad, or the platform's equivalent
+func configDir(home string) string {
+	if dir, err := os.UserConfigDir(); err == nil {
+		return filepath.Join(dir, appName)
+	}
+	return filepath.Join(home, ".config", appName)
+}
+
+// cacheDir returns the directory downloads are cached in:
+// $XDG_CACHE_HOME/godad, or the platform's equivalent
+func cacheDir(home string) string {
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, appName)
+	}
+	return filepath.Join(home, ".cache", appName)
+}
+
+// legacyDir returns where godad kept the database and config file before
+// it followed the XDG base directory spec
+func legacyDir(home string) string {
+	return filepath.Join(home, ".godad")
+}
+
+// moveLegacyFiles moves the files matching pattern from the legacy
+// directory to dir, unless dir already has a file of the same name. The
+// legacy directory is removed once it is empty.
+func moveLegacyFiles(home, pattern, dir string) error {
+	legacy := legacyDir(home)
+	if legacy == dir {
+		return nil
+	}
+	matches, err := filepath.Glob(filepath.Join(legacy, pattern))
+	if err != nil || len(matches) == 0 {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("error creating %s: %w", dir, err)
+	}
+	for _, src := range matches {
+		dst := filepath.Join(dir, filepath.Base(src))
+		if _, err := os.Stat(dst); !errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err := os.Rename(src, dst); err != nil {
+			return fmt.Errorf("error moving %s to %s: %w", src, dir, err)
+		}
+		log.Info().Str("from", src).Str("to", dst).Msg("Moved file to new location")
+	}
+
+	// Fails unless the directory is empty, which is fine
+	_ = os.Remove(legacy)
+	return nil
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestInitConfigMovesLegacyFiles(t *testing.T) {
+	testCases := []struct {
+		name    string
+		movesDB bool
+	}{
+		{name: "Default", movesDB: true},
+		{name: "CustomDBDir", movesDB: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			home := t.TempDir()
+			t.Setenv("HOME", home)
+			t.Setenv("XDG_DATA_HOME", filepath.Join(home, "data"))
+			t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "config"))
+			t.Setenv("GODAD_DB_DIR", "")
+			if tc.movesDB {
+				os.Unsetenv("GODAD_DB_DIR")
+			} else {
+				t.Setenv("GODAD_DB_DIR", legacyDir(home))
+			}
+
+			legacy := legacyDir(home)
+			if err := os.MkdirAll(legacy, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(legacy, "jokes.db"), []byte("db"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(legacy, "config"), []byte("max_duplicates=7\n"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			viper.Reset()
+			rootCmd := newRootCmd()
+			if err := rootCmd.ParseFlags(nil); err != nil {
+				t.Fatalf("ParseFlags() returned an error: %v", err)
+			}
+			if err := initConfig(rootCmd); err != nil {
+				t.Fatalf("initConfig() returned an error: %v", err)
+			}
+
+			if _, err := os.Stat(filepath.Join(home, "config", "godad", "config")); err != nil {
+				t.Errorf("Config file was not moved: %v", err)
+			}
+			if got := viper.GetInt("max_duplicates"); got != 7 {
+				t.Errorf("max_duplicates = %d, want 7 from the moved config file", got)
+			}
+
+			wantDir := filepath.Join(home, "data", "godad")
+			if !tc.movesDB {
+				wantDir = legacy
+			}
+			if got := viper.GetString("dbdir"); got != wantDir {
+				t.Errorf("dbdir = %s, want %s", got, wantDir)
+			}
+			if _, err := os.Stat(filepath.Join(wantDir, "jokes.db")); err != nil {
+				t.Errorf("Database is not in %s: %v", wantDir, err)
+			}
+			if _, err := os.Stat(legacy); tc.movesDB && !os.IsNotExist(err) {
+				t.Errorf("Legacy directory still exists after moving every file")
+			}
+		})
+	}
+}
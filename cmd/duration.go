@@ -0,0 +1,64 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lhaig/godad/pkg/joke"
+)
+
+// parseDuration parses a Go duration such as "36h", also accepting days
+// ("90d") and weeks ("2w") which Go durations don't support
+func parseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			v, err := strconv.ParseFloat(n, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			return time.Duration(v * float64(unit)), nil
+		}
+	}
+	return time.ParseDuration(s)
+}
+
+// parseSince parses a point in time given either as a date ("2024-05-01"),
+// an RFC 3339 timestamp or a duration before now ("7d")
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if t, err := time.ParseInLocation(time.DateOnly, s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := parseDuration(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, use a date like 2024-05-01 or a duration like 7d", s)
+	}
+	return now.Add(-d), nil
+}
+
+// parseRateLimit parses a rate limit like "60/m" or "10/30s": a number of
+// requests per duration, where a duration without a number is one unit
+func parseRateLimit(s string) (joke.RateLimit, error) {
+	n, per, ok := strings.Cut(strings.TrimSpace(s), "/")
+	requests, err := strconv.Atoi(strings.TrimSpace(n))
+	if !ok || err != nil || requests < 0 {
+		return joke.RateLimit{}, fmt.Errorf("invalid rate limit %q, use e.g. 60/m", s)
+	}
+	per = strings.TrimSpace(per)
+	if per != "" && strings.IndexFunc(per, func(r rune) bool { return r >= '0' && r <= '9' }) != 0 {
+		per = "1" + per
+	}
+	d, err := parseDuration(per)
+	if err != nil || d <= 0 {
+		return joke.RateLimit{}, fmt.Errorf("invalid rate limit %q, use e.g. 60/m", s)
+	}
+	return joke.RateLimit{Requests: requests, Per: d}, nil
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lhaig/godad/pkg/joke"
+)
+
+func TestParseDuration(t *testing.T) {
+	testCases := map[string]time.Duration{
+		"90m":  90 * time.Minute,
+		"36h":  36 * time.Hour,
+		"7d":   7 * 24 * time.Hour,
+		"1.5d": 36 * time.Hour,
+		"2w":   14 * 24 * time.Hour,
+	}
+	for in, want := range testCases {
+		got, err := parseDuration(in)
+		if err != nil {
+			t.Errorf("parseDuration(%q) returned an error: %v", in, err)
+		}
+		if got != want {
+			t.Errorf("parseDuration(%q) = %v, want %v", in, got, want)
+		}
+	}
+
+	for _, in := range []string{"", "xd", "soon"} {
+		if _, err := parseDuration(in); err == nil {
+			t.Errorf("parseDuration(%q) did not return an error", in)
+		}
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+
+	got, err := parseSince("7d", now)
+	if err != nil || !got.Equal(now.Add(-7*24*time.Hour)) {
+		t.Errorf("parseSince(\"7d\") = %v, %v", got, err)
+	}
+
+	got, err = parseSince("2024-05-01", now)
+	if err != nil || got.Year() != 2024 || got.Month() != 5 || got.Day() != 1 {
+		t.Errorf("parseSince(\"2024-05-01\") = %v, %v", got, err)
+	}
+
+	if _, err := parseSince("yesterday", now); err == nil {
+		t.Errorf("parseSince(\"yesterday\") did not return an error")
+	}
+}
+
+func TestParseRateLimit(t *testing.T) {
+	testCases := map[string]joke.RateLimit{
+		"60/m":   {Requests: 60, Per: time.Minute},
+		"10/30s": {Requests: 10, Per: 30 * time.Second},
+		"500/d":  {Requests: 500, Per: 24 * time.Hour},
+		"0/s":    {Requests: 0, Per: time.Second},
+	}
+	for in, want := range testCases {
+		got, err := parseRateLimit(in)
+		if err != nil {
+			t.Errorf("parseRateLimit(%q) returned an error: %v", in, err)
+		}
+		if got != want {
+			t.Errorf("parseRateLimit(%q) = %+v, want %+v", in, got, want)
+		}
+	}
+
+	for _, in := range []string{"", "60", "x/m", "60/", "60/0s", "-1/m"} {
+		if _, err := parseRateLimit(in); err == nil {
+			t.Errorf("parseRateLimit(%q) did not return an error", in)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/cobra"
+)
+
+func newEditCmd() *cobra.Command {
+	var text string
+
+	editCmd := &cobra.Command{
+		Use:   "edit <id>",
+		Short: "Change the text of a stored joke",
+		Long: `Change the text of a stored joke, e.g. to fix a typo. The joke is opened
+in $VISUAL or $EDITOR, unless the new text is given with --text.`,
+		Example: `  godad edit 42
+  godad edit 42 --text "Why did the scarecrow win an award? Because he was outstanding in his field."`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid joke ID %q", args[0])
+			}
+
+			store, err := openStoreAs[joke.EditStore]("edit jokes")
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			j, err := store.Get(cmd.Context(), id)
+			if err != nil {
+				return err
+			}
+			if !cmd.Flags().Changed("text") {
+				if text, err = editText(cmd, j.Text); err != nil {
+					return err
+				}
+			}
+			text = strings.TrimSpace(text)
+			switch {
+			case text == "":
+				return errors.New("the joke is empty, leaving it unchanged")
+			case text == j.Text:
+				fmt.Fprintf(cmd.OutOrStdout(), "Joke %d is unchanged\n", id)
+				return nil
+			}
+
+			err = store.Update(cmd.Context(), id, text)
+			if errors.Is(err, joke.ErrDuplicate) {
+				return errors.New("another stored joke has this text already")
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Changed joke %d\n", id)
+			return nil
+		},
+	}
+
+	editCmd.Flags().StringVar(&text, "text", "", "New text of the joke, instead of opening an editor")
+	return editCmd
+}
+
+func newDeleteCmd() *cobra.Command {
+	var yes bool
+
+	deleteCmd := &cobra.Command{
+		Use:   "delete <id>...",
+		Short: "Delete stored jokes",
+		Long: `Delete jokes from the database, along with their tags and ratings. Each
+joke is shown and has to be confirmed, unless --yes is given.
+
+A deleted joke is forgotten entirely, so a source may tell it again.`,
+		Example: `  godad delete 42
+  godad delete 42 43 --yes`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ids := make([]int64, len(args))
+			for i, arg := range args {
+				id, err := strconv.ParseInt(arg, 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid joke ID %q", arg)
+				}
+				ids[i] = id
+			}
+
+			store, err := openStoreAs[joke.EditStore]("delete jokes")
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			out := cmd.OutOrStdout()
+			in := bufio.NewReader(cmd.InOrStdin())
+			for _, id := range ids {
+				j, err := store.Get(cmd.Context(), id)
+				if err != nil {
+					return err
+				}
+				if !yes {
+					fmt.Fprintf(out, "%s\n\nDelete joke %d? [y/N] ", j.Text, id)
+					if !confirmed(in) {
+						fmt.Fprintf(out, "Kept joke %d\n", id)
+						continue
+					}
+				}
+				if err := store.Delete(cmd.Context(), id); err != nil {
+					return err
+				}
+				fmt.Fprintf(out, "Deleted joke %d\n", id)
+			}
+			return nil
+		},
+	}
+
+	deleteCmd.Flags().BoolVarP(&yes, "yes", "y", false, "Delete without asking for confirmation")
+	return deleteCmd
+}
+
+// confirmed reads an answer from in and reports whether it is yes
+func confirmed(in *bufio.Reader) bool {
+	answer, err := in.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// editText opens text in the user's editor and returns the edited text
+func editText(cmd *cobra.Command, text string) (string, error) {
+	editor := editorCommand()
+	if len(editor) == 0 {
+		return "", errors.New("no editor found, set $EDITOR or use --text")
+	}
+
+	f, err := os.CreateTemp("", "godad-*.txt")
+	if err != nil {
+		return "", fmt.Errorf("error creating temporary file: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(text + "\n"); err != nil {
+		f.Close()
+		return "", fmt.Errorf("error writing temporary file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("error writing temporary file: %w", err)
+	}
+
+	// #nosec G204 -- running the user's own editor is the point
+	edit := exec.CommandContext(cmd.Context(), editor[0], append(editor[1:], f.Name())...)
+	edit.Stdin = os.Stdin
+	edit.Stdout = os.Stdout
+	edit.Stderr = os.Stderr
+	if err := edit.Run(); err != nil {
+		return "", fmt.Errorf("error running %s: %w", editor[0], err)
+	}
+
+	edited, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", fmt.Errorf("error reading temporary file: %w", err)
+	}
+	return string(edited), nil
+}
+
+// editorCommand returns the editor to run with its arguments, from $VISUAL
+// or $EDITOR, or a default for the platform
+func editorCommand() []string {
+	for _, key := range []string{"VISUAL", "EDITOR"} {
+		if editor := strings.Fields(os.Getenv(key)); len(editor) > 0 {
+			return editor
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return []string{"notepad"}
+	}
+	for _, editor := range []string{"nano", "vi"} {
+		if _, err := exec.LookPath(editor); err == nil {
+			return []string{editor}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/viper"
+)
+
+func TestEditDelete(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("dbdir", t.TempDir())
+
+	store, err := openStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	for _, text := range []string{"A jkoe", "Another joke"} {
+		if err := store.Save(context.Background(), &joke.Joke{Text: text, Source: "user", Language: "en"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dbdir := viper.GetString("dbdir")
+
+	if runtime.GOOS != "windows" {
+		editor := filepath.Join(t.TempDir(), "editor")
+		if err := os.WriteFile(editor, []byte("#!/bin/sh\necho 'A joke' > \"$1\"\n"), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("VISUAL", editor)
+		if _, err := runGodad(dbdir, "", "edit", "1"); err != nil {
+			t.Fatalf("edit returned an error: %v", err)
+		}
+		if j, _ := store.Get(context.Background(), 1); j.Text != "A joke" {
+			t.Errorf("edit in the editor changed the joke to %q, want A joke", j.Text)
+		}
+	}
+	if _, err := runGodad(dbdir, "", "edit", "1", "--text", "Another joke!"); err == nil {
+		t.Error("edit accepted the text of another joke")
+	}
+
+	out, err := runGodad(dbdir, "n\ny\n", "delete", "1", "2")
+	if err != nil {
+		t.Fatalf("delete returned an error: %v", err)
+	}
+	if !strings.Contains(out, "Kept joke 1") || !strings.Contains(out, "Deleted joke 2") {
+		t.Errorf("delete printed %q, want joke 1 kept and joke 2 deleted", out)
+	}
+	if _, err := store.Get(context.Background(), 2); !errors.Is(err, joke.ErrNotFound) {
+		t.Errorf("Get() of the deleted joke returned %v, want ErrNotFound", err)
+	}
+}
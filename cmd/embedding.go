@@ -0,0 +1,24 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"cmp"
+	"os"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/viper"
+)
+
+// newEmbedder returns the embedder picked in the settings, or nil if jokes
+// are only compared by their text
+func newEmbedder() joke.Embedder {
+	model := viper.GetString("embeddings_model")
+	if model == "" {
+		return nil
+	}
+	embedder := joke.NewOpenAIEmbedder(cmp.Or(viper.GetString("embeddings_url"), joke.OpenAIURL), model)
+	embedder.Key = os.ExpandEnv(viper.GetString("embeddings_key"))
+	return embedder
+}
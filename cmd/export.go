@@ -0,0 +1,144 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/cobra"
+)
+
+func newExportCmd() *cobra.Command {
+	var (
+		filter joke.ExportFilter
+		format string
+		since  string
+		until  string
+		deck   string
+	)
+
+	exportCmd := &cobra.Command{
+		Use:   "export [<file>]",
+		Short: "Export stored jokes",
+		Long: `Export the stored jokes, told or not, to share a collection or feed it
+into other programs. The format is one of ` + strings.Join(joke.ExportFormats, ", ") + `, and is
+told by the file extension unless given with --format:
+
+  json      a list of jokes with their tags, which "godad import" reads back
+  csv       a row per joke, which "godad import" reads back
+  markdown  a list of jokes, e.g. for a wiki page
+  fortune   jokes separated by lines holding just %, for fortune(6). When
+            writing to a file, its strfile index is written next to it
+            with .dat appended, so fortune can read it right away.
+  anki      flashcards with the setup on the front and the punchline on
+            the back, to import into Anki with File > Import. Jokes
+            without a punchline are left out.
+
+Without a file, or with -, the jokes are written to standard output.`,
+		Example: `  godad export jokes.json
+  godad export --format markdown --tag puns > puns.md
+  godad export --lang de --since 2024-01-01 --format fortune ~/fortunes/witze
+  fortune ~/fortunes/witze
+  godad export --format anki --lang de --deck Flachwitze flachwitze.txt`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := "-"
+			if len(args) > 0 {
+				path = args[0]
+			}
+			if format == "" {
+				format = exportFormat(path)
+			}
+			if !slices.Contains(joke.ExportFormats, format) {
+				return fmt.Errorf("unknown format %q, use %s", format, strings.Join(joke.ExportFormats, ", "))
+			}
+			var err error
+			if since != "" {
+				if filter.Since, err = parseSince(since, time.Now()); err != nil {
+					return err
+				}
+			}
+			if until != "" {
+				if filter.Until, err = parseSince(until, time.Now()); err != nil {
+					return err
+				}
+			}
+			filter.Language = strings.ToLower(filter.Language)
+
+			store, err := openStoreAs[joke.ExportStore]("export jokes")
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			jokes, err := store.Export(cmd.Context(), filter)
+			if err != nil {
+				return err
+			}
+
+			write := func(w io.Writer) error {
+				if format == "anki" {
+					return joke.WriteAnki(w, jokes, deck)
+				}
+				return joke.WriteJokes(w, jokes, format)
+			}
+			if path == "-" {
+				return write(cmd.OutOrStdout())
+			}
+			if err := writeFile(path, write); err != nil {
+				return err
+			}
+			if format == "fortune" {
+				index := func(w io.Writer) error { return joke.WriteStrfile(w, jokes) }
+				if err := writeFile(path+".dat", index); err != nil {
+					return err
+				}
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "Exported %d jokes to %s\n", len(jokes), path)
+			return nil
+		},
+	}
+
+	exportCmd.Flags().StringVar(&format, "format", "", "Format of the export ("+strings.Join(joke.ExportFormats, ", ")+"), instead of telling it by the extension")
+	exportCmd.Flags().StringVar(&filter.Language, "lang", "", "Only export jokes in this language")
+	exportCmd.Flags().StringVar(&filter.Source, "source", "", "Only export jokes from this source")
+	exportCmd.Flags().StringVar(&filter.Tag, "tag", "", "Only export jokes with this tag")
+	exportCmd.Flags().StringVar(&since, "since", "", "Only export jokes stored since a date (2024-05-01) or duration ago (7d)")
+	exportCmd.Flags().StringVar(&until, "until", "", "Only export jokes stored before a date (2024-05-01) or duration ago (7d)")
+	exportCmd.Flags().StringVar(&deck, "deck", joke.DefaultAnkiDeck, "Anki deck to put the cards in, for --format anki")
+	return exportCmd
+}
+
+// exportFormat tells the format to export to by the extension of path,
+// with JSON for anything else
+func exportFormat(path string) string {
+	switch strings.ToLower(strings.TrimPrefix(filepath.Ext(path), ".")) {
+	case "csv":
+		return "csv"
+	case "md", "markdown":
+		return "markdown"
+	default:
+		return "json"
+	}
+}
+
+// writeFile creates the file at path and fills it with write
+func writeFile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", path, err)
+	}
+	if err := errors.Join(write(f), f.Close()); err != nil {
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	return nil
+}
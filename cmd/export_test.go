@@ -0,0 +1,74 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/viper"
+)
+
+func TestExportFormat(t *testing.T) {
+	for path, want := range map[string]string{
+		"jokes.json": "json",
+		"jokes.CSV":  "csv",
+		"README.md":  "markdown",
+		"witze":      "json",
+		"-":          "json",
+	} {
+		if got := exportFormat(path); got != want {
+			t.Errorf("exportFormat(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestExportCmd(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("dbdir", t.TempDir())
+
+	store, err := openStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, j := range []joke.Joke{
+		{Text: "First joke", Source: "user", Language: "en"},
+		{Text: "Erster Witz", Source: "user", Language: "de"},
+	} {
+		if err := store.Save(context.Background(), &j); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.Close()
+
+	var out strings.Builder
+	cmd := newExportCmd()
+	cmd.SetArgs([]string{"--format", "fortune", "--lang", "DE"})
+	cmd.SetOut(&out)
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("export returned an error: %v", err)
+	}
+	if want := "Erster Witz\n%\n"; out.String() != want {
+		t.Errorf("export printed %q, want %q", out.String(), want)
+	}
+
+	path := filepath.Join(t.TempDir(), "jokes")
+	cmd = newExportCmd()
+	cmd.SetArgs([]string{"--format", "fortune", path})
+	cmd.SetErr(&strings.Builder{})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("export to a file returned an error: %v", err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "First joke\n%\nErster Witz\n%\n" {
+		t.Errorf("export wrote %q, %v", data, err)
+	}
+	if _, err := os.Stat(path + ".dat"); err != nil {
+		t.Errorf("export wrote no strfile index: %v", err)
+	}
+}
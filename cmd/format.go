@@ -0,0 +1,89 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/lhaig/godad/pkg/joke"
+)
+
+// jokeView is the data passed to output templates
+type jokeView struct {
+	ID         int64
+	Joke       string
+	UpstreamID string
+	Source     string
+	Language   string
+	FetchedAt  time.Time
+	ToldAt     *time.Time
+	TimesTold  int
+	Rating     int
+	Tags       []string
+}
+
+// templateFuncs are the functions available in output templates
+var templateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"wrap":  wrap,
+}
+
+// parseFormat parses an output template
+func parseFormat(format string) (*template.Template, error) {
+	tmpl, err := template.New("format").Funcs(templateFuncs).Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing format: %w", err)
+	}
+	return tmpl, nil
+}
+
+// writeFormatted writes a joke using tmpl, followed by a newline
+func writeFormatted(out io.Writer, tmpl *template.Template, j joke.Joke) error {
+	var b strings.Builder
+	err := tmpl.Execute(&b, jokeView{
+		ID:         j.ID,
+		Joke:       j.Text,
+		UpstreamID: j.UpstreamID,
+		Source:     j.Source,
+		Language:   j.Language,
+		FetchedAt:  j.CreatedAt,
+		ToldAt:     j.ToldAt,
+		TimesTold:  j.TimesTold,
+		Rating:     j.Rating,
+		Tags:       j.Tags,
+	})
+	if err != nil {
+		return fmt.Errorf("error formatting joke: %w", err)
+	}
+	_, err = fmt.Fprintln(out, strings.TrimRight(b.String(), "\n"))
+	return err
+}
+
+// wrap breaks text into lines of at most width characters where possible
+func wrap(width int, text string) string {
+	var (
+		b    strings.Builder
+		line int
+	)
+	for i, word := range strings.Fields(text) {
+		n := len([]rune(word))
+		if i > 0 {
+			if line+1+n > width {
+				b.WriteByte('\n')
+				line = 0
+			} else {
+				b.WriteByte(' ')
+				line++
+			}
+		}
+		b.WriteString(word)
+		line += n
+	}
+	return b.String()
+}
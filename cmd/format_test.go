@@ -0,0 +1,43 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lhaig/godad/pkg/joke"
+)
+
+func TestWriteFormatted(t *testing.T) {
+	j := joke.Joke{ID: 7, Text: "I'm afraid for the calendar. Its days are numbered.", Source: "icanhazdadjoke", Tags: []string{"puns"}}
+
+	testCases := []struct {
+		format string
+		want   string
+	}{
+		{format: "{{.Joke}} — via {{.Source}}", want: "I'm afraid for the calendar. Its days are numbered. — via icanhazdadjoke\n"},
+		{format: "#{{.ID}} {{upper .Source}} {{range .Tags}}[{{.}}]{{end}}", want: "#7 ICANHAZDADJOKE [puns]\n"},
+		{format: "{{wrap 30 .Joke}}\n", want: "I'm afraid for the calendar.\nIts days are numbered.\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.format, func(t *testing.T) {
+			tmpl, err := parseFormat(tc.format)
+			if err != nil {
+				t.Fatalf("parseFormat() returned an error: %v", err)
+			}
+			var b strings.Builder
+			if err := writeFormatted(&b, tmpl, j); err != nil {
+				t.Fatalf("writeFormatted() returned an error: %v", err)
+			}
+			if b.String() != tc.want {
+				t.Errorf("writeFormatted() wrote %q, want %q", b.String(), tc.want)
+			}
+		})
+	}
+
+	if _, err := parseFormat("{{.Joke"); err == nil {
+		t.Errorf("parseFormat() accepted an invalid template")
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/cobra"
+)
+
+func newHistoryCmd() *cobra.Command {
+	var (
+		filter joke.HistoryFilter
+		since  string
+		output string
+	)
+
+	historyCmd := &cobra.Command{
+		Use:   "history",
+		Short: "List previously told jokes",
+		Example: `  godad history --limit 10
+  godad history --since 7d --lang de
+  godad history --source icanhazdadjoke --output json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if since != "" {
+				t, err := parseSince(since, time.Now())
+				if err != nil {
+					return err
+				}
+				filter.Since = t
+			}
+			if output != "table" && output != "json" {
+				return fmt.Errorf("unknown output format %q, use table or json", output)
+			}
+
+			store, err := openStore()
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			jokes, err := store.History(cmd.Context(), filter)
+			if err != nil {
+				return err
+			}
+
+			if output == "json" {
+				return writeJokesJSON(cmd.OutOrStdout(), jokes)
+			}
+			return writeJokesTable(cmd.OutOrStdout(), jokes)
+		},
+	}
+
+	historyCmd.Flags().IntVar(&filter.Limit, "limit", 0, "Maximum number of jokes to list (0 for all)")
+	historyCmd.Flags().IntVar(&filter.Offset, "offset", 0, "Number of jokes to skip, for paging")
+	historyCmd.Flags().StringVar(&since, "since", "", "Only list jokes told since a date (2024-05-01) or duration ago (7d)")
+	historyCmd.Flags().StringVar(&filter.Language, "lang", "", "Only list jokes in this language")
+	historyCmd.Flags().StringVar(&filter.Source, "source", "", "Only list jokes from this source")
+	historyCmd.Flags().StringVar(&filter.Tag, "tag", "", "Only list jokes with this tag")
+	historyCmd.Flags().StringVarP(&output, "output", "o", "table", "Output format (table, json)")
+	return historyCmd
+}
+
+// writeJokesTable writes jokes as an aligned table
+func writeJokesTable(out io.Writer, jokes []joke.Joke) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTOLD\tLANG\tSOURCE\tJOKE")
+	for _, j := range jokes {
+		told := ""
+		if j.ToldAt != nil {
+			told = j.ToldAt.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", j.ID, told, j.Language, j.Source, j.Text)
+	}
+	return w.Flush()
+}
+
+// writeJokesJSON writes jokes as an indented JSON array
+func writeJokesJSON(out io.Writer, jokes []joke.Joke) error {
+	if jokes == nil {
+		jokes = []joke.Joke{}
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(jokes)
+}
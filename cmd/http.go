@@ -0,0 +1,52 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// configureHTTP sets up the client godad connects to sources and other
+// services with from the user agent, proxy and TLS settings
+func configureHTTP() error {
+	joke.UserAgent = cmp.Or(viper.GetString("user_agent"), joke.DefaultUserAgent)
+
+	var opts joke.HTTPOptions
+	if proxy := viper.GetString("proxy"); proxy != "" {
+		u, err := url.Parse(proxy)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("invalid proxy %q, use a URL like http://proxy.example.com:3128", proxy)
+		}
+		opts.Proxy = u
+	}
+	insecure := viper.GetBool("insecure_skip_verify")
+	tlsConfig, err := joke.NewTLSConfig(joke.TLSOptions{
+		CAFile:             viper.GetString("ca_file"),
+		CertFile:           viper.GetString("client_cert"),
+		KeyFile:            viper.GetString("client_key"),
+		InsecureSkipVerify: insecure,
+	})
+	if err != nil {
+		return err
+	}
+	opts.TLS = tlsConfig
+	if opts == (joke.HTTPOptions{}) {
+		return nil
+	}
+	if insecure {
+		log.Warn().Msg("TLS certificates are not verified, so anyone in between can read and change what godad sends and receives")
+	}
+
+	joke.DefaultHTTPClient = joke.NewHTTPClient(opts)
+	registryClient = &http.Client{Transport: joke.DefaultHTTPClient.Transport, Timeout: 30 * time.Second}
+	return nil
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/viper"
+)
+
+func TestConfigureHTTP(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	defer func(client, registry *http.Client) {
+		joke.DefaultHTTPClient, registryClient = client, registry
+	}(joke.DefaultHTTPClient, registryClient)
+
+	// Without settings the default client is kept
+	client := joke.DefaultHTTPClient
+	if err := configureHTTP(); err != nil || joke.DefaultHTTPClient != client {
+		t.Fatalf("configureHTTP() without settings = %v, want the default client kept", err)
+	}
+
+	viper.Set("user_agent", "godad-test")
+	if err := configureHTTP(); err != nil || joke.UserAgent != "godad-test" {
+		t.Errorf("configureHTTP() set the User-Agent to %q, %v, want godad-test", joke.UserAgent, err)
+	}
+	joke.UserAgent = joke.DefaultUserAgent
+
+	viper.Set("proxy", "proxy.example.com")
+	if err := configureHTTP(); err == nil {
+		t.Error("configureHTTP() with a proxy that isn't a URL returned no error")
+	}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"joke": "A joke"}`))
+	}))
+	defer server.Close()
+	viper.Set("proxy", "")
+	viper.Set("insecure_skip_verify", true)
+	if err := configureHTTP(); err != nil {
+		t.Fatalf("configureHTTP() returned an error: %v", err)
+	}
+	if _, err := joke.NewHTTPSource("test", "en", server.URL).Fetch(context.Background()); err != nil {
+		t.Errorf("Fetch() from a server with an unknown certificate returned %v, want it trusted", err)
+	}
+	if registryClient.Transport != joke.DefaultHTTPClient.Transport {
+		t.Error("configureHTTP() didn't configure the registry client")
+	}
+}
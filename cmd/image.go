@@ -0,0 +1,127 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"os"
+
+	"github.com/lhaig/godad/internal/card"
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/cobra"
+)
+
+func newImageCmd() *cobra.Command {
+	var (
+		id       int64
+		out      string
+		width    int
+		height   int
+		size     float64
+		upstream bool
+	)
+
+	imageCmd := &cobra.Command{
+		Use:   "image",
+		Short: "Draw the last told joke onto a PNG image",
+		Long: `Draw the last told joke, or the joke given with --id, onto a PNG image,
+for posting to channels that only take images. The joke is centered, with
+the punchline below the setup, and shrunk until it fits.
+
+Draw it onto a plain background or onto a template image, in the Go font
+or another TrueType or OpenType font. Set image_background,
+image_foreground, image_template and image_font in the config file to
+keep the look the same. With --upstream, jokes from icanhazdadjoke.com
+are downloaded as drawn there instead.`,
+		Example: `  godad image --out joke.png
+  godad image --out joke.png --background '#1e1e2e' --foreground '#cdd6f4'
+  godad image --out joke.png --template card.png --font ~/fonts/Comic.ttf
+  godad image --out - --upstream | wl-copy`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			opts := card.Options{Width: width, Height: height, Size: size}
+			var err error
+			if v := flagOrSetting(cmd, "background", "image_background"); v != "" {
+				if opts.Background, err = card.ParseColor(v); err != nil {
+					return err
+				}
+			}
+			if v := flagOrSetting(cmd, "foreground", "image_foreground"); v != "" {
+				if opts.Foreground, err = card.ParseColor(v); err != nil {
+					return err
+				}
+			}
+			if v := flagOrSetting(cmd, "template", "image_template"); v != "" {
+				if opts.Template, err = card.LoadImage(expandHome(v)); err != nil {
+					return err
+				}
+			}
+			if v := flagOrSetting(cmd, "font", "image_font"); v != "" {
+				if opts.Font, err = card.LoadFont(expandHome(v)); err != nil {
+					return err
+				}
+			}
+
+			store, err := openStore()
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			id, err := jokeIDOrLast(cmd.Context(), store, id)
+			if err != nil {
+				return err
+			}
+			j, err := store.Get(cmd.Context(), id)
+			if err != nil {
+				return err
+			}
+
+			var data []byte
+			if upstream {
+				if j.Source != "icanhazdadjoke" || j.UpstreamID == "" {
+					return fmt.Errorf("joke %d is not from icanhazdadjoke.com, leave out --upstream to draw it", id)
+				}
+				if data, err = joke.NewICanHazDadJoke().Image(cmd.Context(), j.UpstreamID); err != nil {
+					return err
+				}
+			} else {
+				img, err := card.Render(j, opts)
+				if err != nil {
+					return err
+				}
+				var buf bytes.Buffer
+				if err := png.Encode(&buf, img); err != nil {
+					return fmt.Errorf("error encoding image: %w", err)
+				}
+				data = buf.Bytes()
+			}
+
+			if out == "-" {
+				_, err := cmd.OutOrStdout().Write(data)
+				return err
+			}
+			// #nosec G306 -- images are for sharing
+			if err := os.WriteFile(out, data, 0o644); err != nil {
+				return fmt.Errorf("error writing image: %w", err)
+			}
+			return nil
+		},
+	}
+
+	imageCmd.Flags().Int64Var(&id, "id", 0, "Local ID of the joke to draw, instead of the last told one")
+	imageCmd.Flags().StringVar(&out, "out", "", "File to write the PNG image to, or - for standard output")
+	imageCmd.Flags().IntVar(&width, "width", card.DefaultWidth, "Width of the image in pixels, unless drawn onto a template")
+	imageCmd.Flags().IntVar(&height, "height", card.DefaultHeight, "Height of the image in pixels, unless drawn onto a template")
+	imageCmd.Flags().Float64Var(&size, "font-size", card.DefaultSize, "Largest font size in pixels, smaller for long jokes")
+	imageCmd.Flags().String("background", "", "Background color, like #1e1e2e, instead of image_background (default white)")
+	imageCmd.Flags().String("foreground", "", "Text color, like #cdd6f4, instead of image_foreground (default black)")
+	imageCmd.Flags().String("template", "", "PNG or JPEG image to draw the joke onto, instead of image_template")
+	imageCmd.Flags().String("font", "", "TrueType or OpenType font file, instead of image_font (default Go Regular)")
+	imageCmd.Flags().BoolVar(&upstream, "upstream", false, "Download the image icanhazdadjoke.com draws of its jokes instead")
+	_ = imageCmd.MarkFlagRequired("out")
+	return imageCmd
+}
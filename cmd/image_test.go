@@ -0,0 +1,60 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestImage(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	dir := t.TempDir()
+	dbdir := dir
+
+	if _, err := runGodad(dbdir, "", "add", "--lang", "en", "Why did the scarecrow win an award? He was outstanding in his field."); err != nil {
+		t.Fatalf("add returned an error: %v", err)
+	}
+	if _, err := runGodad(dbdir, "", "tell", "--lang", "en", "--offline"); err != nil {
+		t.Fatalf("tell returned an error: %v", err)
+	}
+
+	path := filepath.Join(dir, "joke.png")
+	if _, err := runGodad(dbdir, "", "image", "--out", path, "--width", "300", "--height", "200", "--background", "#1e1e2e"); err != nil {
+		t.Fatalf("image returned an error: %v", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("image wrote no file: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("image wrote no PNG image: %v", err)
+	}
+	if img.Bounds().Dx() != 300 || img.Bounds().Dy() != 200 {
+		t.Errorf("image drew %v, want 300x200", img.Bounds())
+	}
+	if c := color.RGBAModel.Convert(img.At(0, 0)); c != (color.RGBA{R: 0x1e, G: 0x1e, B: 0x2e, A: 0xff}) {
+		t.Errorf("image drew the corner in %v, want the background", img.At(0, 0))
+	}
+
+	out, err := runGodad(dbdir, "", "image", "--out", "-")
+	if err != nil || !strings.HasPrefix(out, "\x89PNG") {
+		t.Errorf("image --out - printed %.20q, %v, want a PNG image", out, err)
+	}
+	if _, err := runGodad(dbdir, "", "image", "--out", path, "--upstream"); err == nil || !strings.Contains(err.Error(), "not from icanhazdadjoke.com") {
+		t.Errorf("image --upstream of a joke of your own returned %v, want an error", err)
+	}
+	if _, err := runGodad(dbdir, "", "image", "--out", path, "--background", "blue"); err == nil {
+		t.Error("image --background blue returned no error")
+	}
+}
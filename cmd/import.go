@@ -0,0 +1,164 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// importSourceName is the source of imported jokes that don't name one
+const importSourceName = "import"
+
+func newImportCmd() *cobra.Command {
+	var (
+		format string
+		source string
+		tags   []string
+		dryRun bool
+		batch  int
+	)
+
+	importCmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Import a joke collection",
+		Long: `Import jokes from a file into the database, skipping those stored
+already. The format is one of ` + strings.Join(joke.ImportFormats, ", ") + `, and is
+told by the file extension unless given with --format:
+
+  json     a list of jokes as texts or objects, like joke files and
+           "godad export" writes
+  csv      a header naming the columns: joke or text, or setup and punchline,
+           and optionally lang, tags, source, upstream_id and rating
+  txt      one joke per line
+  fortune  jokes separated by lines holding just %, like fortune(6) files
+
+Imported jokes are told before fetched ones, like jokes added with
+"godad add". Use - as the file to read standard input.`,
+		Example: `  godad import jokes.json
+  godad import --format fortune --lang en /usr/share/games/fortunes/riddles
+  godad import --dry-run witze.csv`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if format == "" {
+				format = importFormat(args[0])
+			}
+			if !slices.Contains(joke.ImportFormats, format) {
+				return fmt.Errorf("unknown format %q, use %s", format, strings.Join(joke.ImportFormats, ", "))
+			}
+			lang, err := addLanguage(viper.GetString("lang"))
+			if err != nil {
+				return err
+			}
+
+			in := cmd.InOrStdin()
+			if args[0] != "-" {
+				f, err := os.Open(args[0])
+				if err != nil {
+					return fmt.Errorf("error opening %s: %w", args[0], err)
+				}
+				defer f.Close()
+				in = f
+			}
+			jokes, err := joke.ReadJokes(in, format)
+			if err != nil {
+				return fmt.Errorf("error reading %s: %w", args[0], err)
+			}
+			for i := range jokes {
+				if jokes[i].Language == "" {
+					jokes[i].Language = lang
+				}
+				jokes[i].Language = strings.ToLower(jokes[i].Language)
+				if jokes[i].Source == "" {
+					jokes[i].Source = source
+				}
+				jokes[i].Tags = append(jokes[i].Tags, tags...)
+			}
+
+			store, err := openStoreAs[joke.ImportStore]("import jokes")
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			progress := newProgress(cmd.ErrOrStderr(), "Importing jokes", len(jokes))
+			res, err := store.Import(cmd.Context(), jokes, batch, dryRun, progress.update)
+			progress.done()
+			if err != nil {
+				return err
+			}
+
+			verb := "Imported"
+			if dryRun {
+				verb = "Would import"
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s %d jokes, skipped %d duplicates\n", verb, res.Imported, res.Duplicates)
+			return nil
+		},
+	}
+
+	importCmd.Flags().StringVar(&format, "format", "", "Format of the file ("+strings.Join(joke.ImportFormats, ", ")+"), instead of telling it by the extension")
+	importCmd.Flags().String("lang", autoLanguage, "Language of jokes that don't name one, auto for the language of the locale")
+	importCmd.Flags().StringVar(&source, "source", importSourceName, "Source of jokes that don't name one")
+	importCmd.Flags().StringSliceVar(&tags, "tag", nil, "Tag the imported jokes, e.g. --tag fortunes")
+	importCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only count the jokes that would be imported")
+	importCmd.Flags().IntVar(&batch, "batch", joke.DefaultImportBatch, "Jokes stored per transaction")
+	return importCmd
+}
+
+// importFormat tells the format of a joke file by its extension, with
+// files that are neither JSON nor CSV taken for text
+func importFormat(path string) string {
+	switch ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), ".")); ext {
+	case "json", "csv":
+		return ext
+	default:
+		return "txt"
+	}
+}
+
+// progress reports how far a long running command got on a terminal
+type progress struct {
+	out   io.Writer
+	label string
+	total int
+	shown bool
+}
+
+// newProgress returns a progress bar for total steps written to out, which
+// stays silent unless out is a terminal
+func newProgress(out io.Writer, label string, total int) *progress {
+	if f, ok := out.(*os.File); !ok || !isTerminal(f) {
+		out = nil
+	}
+	return &progress{out: out, label: label, total: total}
+}
+
+// progressWidth is the width of the bar in characters
+const progressWidth = 30
+
+// update redraws the bar for done steps
+func (p *progress) update(done int) {
+	if p.out == nil || p.total == 0 {
+		return
+	}
+	filled := progressWidth * done / p.total
+	fmt.Fprintf(p.out, "\r%s [%s%s] %d/%d", p.label, strings.Repeat("=", filled), strings.Repeat(" ", progressWidth-filled), done, p.total)
+	p.shown = true
+}
+
+// done ends the line of the bar, if it was drawn
+func (p *progress) done() {
+	if p.shown {
+		fmt.Fprintln(p.out)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestImportFormat(t *testing.T) {
+	for path, want := range map[string]string{
+		"jokes.json":  "json",
+		"Witze.CSV":   "csv",
+		"jokes.txt":   "txt",
+		"riddles":     "txt",
+		"-":           "txt",
+		"jokes.jsonl": "txt",
+	} {
+		if got := importFormat(path); got != want {
+			t.Errorf("importFormat(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestImportCmd(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("dbdir", t.TempDir())
+	viper.Set("lang", "en")
+
+	path := filepath.Join(t.TempDir(), "riddles")
+	if err := os.WriteFile(path, []byte("First riddle\n%\nSecond riddle\n%\nfirst riddle!\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--format", "fortune", "--dry-run", path}, "Would import 2 jokes, skipped 1 duplicates\n"},
+		{[]string{"--format", "fortune", "--tag", "riddles", path}, "Imported 2 jokes, skipped 1 duplicates\n"},
+		{[]string{"--format", "fortune", path}, "Imported 0 jokes, skipped 3 duplicates\n"},
+	} {
+		var out strings.Builder
+		cmd := newImportCmd()
+		cmd.SetArgs(tt.args)
+		cmd.SetOut(&out)
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("import %q returned an error: %v", tt.args, err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("import %q printed %q, want %q", tt.args, out.String(), tt.want)
+		}
+	}
+
+	store, err := openStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	j, err := store.NextUntold(context.Background(), "en")
+	if err != nil {
+		t.Fatalf("NextUntold() returned an error: %v", err)
+	}
+	j, _ = store.Get(context.Background(), j.ID)
+	if j.Source != importSourceName || strings.Join(j.Tags, ",") != "riddles" {
+		t.Errorf("imported joke is %+v, want it from %s with the tag", j, importSourceName)
+	}
+
+	cmd := newImportCmd()
+	cmd.SetArgs([]string{"--format", "yaml", path})
+	cmd.SetOut(&strings.Builder{})
+	cmd.SetErr(&strings.Builder{})
+	if err := cmd.Execute(); err == nil {
+		t.Error("import in an unknown format returned no error")
+	}
+}
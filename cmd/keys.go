@@ -0,0 +1,141 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/cobra"
+)
+
+func newKeysCmd() *cobra.Command {
+	keysCmd := &cobra.Command{
+		Use:   "keys",
+		Short: "Manage the API keys of the server",
+		Long: `Manage the keys clients of "godad serve" authenticate with when
+require_api_key is set. Only a hash of each key is stored, so a key is
+shown once, when it is added.`,
+	}
+	keysCmd.AddCommand(newKeysAddCmd(), newKeysRevokeCmd(), newKeysListCmd())
+	return keysCmd
+}
+
+func newKeysAddCmd() *cobra.Command {
+	var rateLimit int
+
+	addCmd := &cobra.Command{
+		Use:     "add <name>",
+		Short:   "Add an API key and print it",
+		Example: "  godad serve keys add office-tv\n  godad serve keys add chat-bot --rate-limit 600",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if rateLimit < 0 {
+				return fmt.Errorf("rate limit must not be negative, got %d", rateLimit)
+			}
+			store, err := openStoreAs[joke.KeyStore]("keep API keys")
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			key, hash, err := joke.NewAPIKey()
+			if err != nil {
+				return err
+			}
+			err = store.AddKey(cmd.Context(), &joke.APIKey{Name: args[0], Hash: hash, RateLimit: rateLimit})
+			if errors.Is(err, joke.ErrKeyExists) {
+				return fmt.Errorf("there is a key named %s already", args[0])
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), key)
+			return nil
+		},
+	}
+
+	addCmd.Flags().IntVar(&rateLimit, "rate-limit", 0, "Requests per minute the key may make, or 0 for the rate_limit of the server")
+	return addCmd
+}
+
+func newKeysRevokeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "revoke <name>",
+		Short: "Revoke an API key",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := openStoreAs[joke.KeyStore]("keep API keys")
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			err = store.RevokeKey(cmd.Context(), args[0])
+			if errors.Is(err, joke.ErrKeyNotFound) {
+				return fmt.Errorf("there is no valid key named %s", args[0])
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Revoked key %s\n", args[0])
+			return nil
+		},
+	}
+}
+
+func newKeysListCmd() *cobra.Command {
+	var output string
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the API keys",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if output != "table" && output != "json" {
+				return fmt.Errorf("unknown output format %q, use table or json", output)
+			}
+
+			store, err := openStoreAs[joke.KeyStore]("keep API keys")
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			keys, err := store.Keys(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			if output == "json" {
+				if keys == nil {
+					keys = []joke.APIKey{}
+				}
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(keys)
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tRATE LIMIT\tCREATED\tREVOKED")
+			for _, k := range keys {
+				limit, revoked := "default", "-"
+				if k.RateLimit > 0 {
+					limit = fmt.Sprintf("%d/min", k.RateLimit)
+				}
+				if k.RevokedAt != nil {
+					revoked = k.RevokedAt.Local().Format(time.DateTime)
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", k.Name, limit, k.CreatedAt.Local().Format(time.DateTime), revoked)
+			}
+			return w.Flush()
+		},
+	}
+
+	listCmd.Flags().StringVarP(&output, "output", "o", "table", "Output format (table, json)")
+	return listCmd
+}
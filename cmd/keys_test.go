@@ -0,0 +1,51 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestKeys(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	dbdir := t.TempDir()
+
+	key, err := runGodad(dbdir, "", "serve", "keys", "add", "office-tv")
+	if err != nil {
+		t.Fatalf("serve keys add returned an error: %v", err)
+	}
+	if !strings.HasPrefix(key, "godad_") {
+		t.Errorf("serve keys add printed %q, want the key", key)
+	}
+	if _, err := runGodad(dbdir, "", "serve", "keys", "add", "chat-bot", "--rate-limit", "600"); err != nil {
+		t.Fatalf("serve keys add --rate-limit returned an error: %v", err)
+	}
+	if _, err := runGodad(dbdir, "", "serve", "keys", "add", "office-tv"); err == nil {
+		t.Error("serve keys add of a taken name returned no error")
+	}
+
+	if out, err := runGodad(dbdir, "", "serve", "keys", "revoke", "office-tv"); err != nil || out != "Revoked key office-tv\n" {
+		t.Errorf("serve keys revoke = %q, %v, want the key revoked", out, err)
+	}
+	if _, err := runGodad(dbdir, "", "serve", "keys", "revoke", "office-tv"); err == nil {
+		t.Error("serve keys revoke of a revoked key returned no error")
+	}
+
+	out, err := runGodad(dbdir, "", "serve", "keys", "list")
+	if err != nil {
+		t.Fatalf("serve keys list returned an error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[1], "chat-bot") || !strings.Contains(lines[1], "600/min") ||
+		!strings.Contains(lines[2], "office-tv") || strings.HasSuffix(lines[2], "-") {
+		t.Errorf("serve keys list printed %q, want the chat-bot key with its limit and the revoked office-tv key", out)
+	}
+	if strings.Contains(out, strings.TrimSpace(key)) {
+		t.Errorf("serve keys list printed %q, want the keys themselves left out", out)
+	}
+}
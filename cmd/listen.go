@@ -0,0 +1,92 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// listenFdsStart is the first file descriptor systemd passes to an
+// activated service
+const listenFdsStart = 3
+
+// listen returns a listener for addr, which is a TCP address like :8080,
+// a Unix socket like unix:/run/godad.sock, or systemd for a socket passed
+// by systemd socket activation. systemd:<name> picks the socket named
+// with FileDescriptorName= when the service has several.
+func listen(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		return listenUnix(path)
+	}
+	if addr == "systemd" || strings.HasPrefix(addr, "systemd:") {
+		_, name, _ := strings.Cut(addr, ":")
+		return systemdListener(name)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// listenUnix listens on the Unix socket at path. A socket left behind by
+// a server that is gone is removed first, one still answering is not.
+func listenUnix(path string) (net.Listener, error) {
+	if path == "" {
+		return nil, errors.New("unix: needs the path of a socket")
+	}
+	if info, err := os.Lstat(path); err == nil && info.Mode().Type() == fs.ModeSocket {
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("another server is listening on %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("error removing stale socket: %w", err)
+		}
+	}
+	// The socket is removed again when the listener is closed
+	return net.Listen("unix", path)
+}
+
+// systemdListener returns the socket systemd passed to godad, the one
+// named name if name isn't empty. See sd_listen_fds(3).
+func systemdListener(name string) (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, errors.New("no sockets passed by systemd, start godad from a socket unit")
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, errors.New("no sockets passed by systemd, start godad from a socket unit")
+	}
+
+	i := 0
+	if name != "" {
+		names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+		i = -1
+		for j, v := range names {
+			if v == name && j < n {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			return nil, fmt.Errorf("systemd passed no socket named %q", name)
+		}
+	}
+
+	fd := listenFdsStart + i
+	// The listener has a copy of the socket, so the original is closed
+	// instead of leaking into the processes godad starts
+	f := os.NewFile(uintptr(fd), "systemd:"+name)
+	defer f.Close()
+	lis, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("error using the socket passed by systemd: %w", err)
+	}
+	return lis, nil
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/rs/zerolog/log"
+)
+
+// autoLanguage is the lang setting that picks the language of the user's
+// locale
+const autoLanguage = "auto"
+
+// allLanguages is the lang setting that mixes the jokes of every language
+const allLanguages = "all"
+
+// localeVars are the environment variables holding the locale, in the
+// order they take precedence
+var localeVars = []string{"LC_ALL", "LC_MESSAGES", "LANG"}
+
+// resolveLanguage returns lang, or for "auto" the language of the user's
+// locale if it is one of langs, and the default language otherwise
+func resolveLanguage(lang string, langs []string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if lang != autoLanguage {
+		return lang
+	}
+	detected := detectLanguage()
+	if slices.Contains(langs, detected) {
+		log.Debug().Str("lang", detected).Msg("Using the language of the locale")
+		return detected
+	}
+	log.Debug().Str("locale", detected).Msg("No jokes in the language of the locale, using the default language")
+	return joke.DefaultLanguage
+}
+
+// detectLanguage returns the language of the user's locale, read from the
+// environment or, where it is not set, from the system, or "" if unknown
+func detectLanguage() string {
+	for _, key := range localeVars {
+		if lang := localeLanguage(os.Getenv(key)); lang != "" {
+			return lang
+		}
+	}
+	return localeLanguage(systemLocale())
+}
+
+// localeLanguage returns the language of a locale name like "de_DE.UTF-8"
+// or "pt-BR", or "" for the C and POSIX locales
+func localeLanguage(locale string) string {
+	lang, _, _ := strings.Cut(locale, ".")
+	lang, _, _ = strings.Cut(lang, "@")
+	lang, _, _ = strings.Cut(lang, "_")
+	lang, _, _ = strings.Cut(lang, "-")
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if lang == "c" || lang == "posix" {
+		return ""
+	}
+	return lang
+}
@@ -0,0 +1,12 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build !windows
+
+package cmd
+
+// systemLocale returns "", the locale is only read from the environment
+// outside Windows
+func systemLocale() string {
+	return ""
+}
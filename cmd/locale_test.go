@@ -0,0 +1,51 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import "testing"
+
+func TestLocaleLanguage(t *testing.T) {
+	for locale, want := range map[string]string{
+		"de_DE.UTF-8":   "de",
+		"fr_FR@euro":    "fr",
+		"pt-BR":         "pt",
+		"nl":            "nl",
+		"C.UTF-8":       "",
+		"POSIX":         "",
+		"":              "",
+		"EN_gb.ISO8859": "en",
+	} {
+		if got := localeLanguage(locale); got != want {
+			t.Errorf("localeLanguage(%q) = %q, want %q", locale, got, want)
+		}
+	}
+}
+
+func TestResolveLanguage(t *testing.T) {
+	langs := []string{"de", "en", "fr"}
+	testCases := []struct {
+		name   string
+		lang   string
+		lcAll  string
+		locale string
+		want   string
+	}{
+		{name: "Explicit", lang: "DE", locale: "fr_FR.UTF-8", want: "de"},
+		{name: "Auto", lang: "auto", locale: "fr_FR.UTF-8", want: "fr"},
+		{name: "LCAllFirst", lang: "auto", lcAll: "de_AT.UTF-8", locale: "fr_FR.UTF-8", want: "de"},
+		{name: "Unsupported", lang: "auto", locale: "ja_JP.UTF-8", want: "en"},
+		{name: "CLocale", lang: "auto", locale: "C", want: "en"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("LC_ALL", tc.lcAll)
+			t.Setenv("LC_MESSAGES", "")
+			t.Setenv("LANG", tc.locale)
+			if got := resolveLanguage(tc.lang, langs); got != tc.want {
+				t.Errorf("resolveLanguage(%q) = %q, want %q", tc.lang, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build windows
+
+package cmd
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// localeNameMaxLength is LOCALE_NAME_MAX_LENGTH, the longest locale name
+// including the terminating null
+const localeNameMaxLength = 85
+
+// systemLocale returns the locale of the user, like "de-DE", as set in the
+// Windows regional settings
+func systemLocale() string {
+	proc := syscall.NewLazyDLL("kernel32.dll").NewProc("GetUserDefaultLocaleName")
+	if proc.Find() != nil {
+		return ""
+	}
+	buf := make([]uint16, localeNameMaxLength)
+	n, _, _ := proc.Call(uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+	if n == 0 {
+		return ""
+	}
+	return syscall.UTF16ToString(buf)
+}
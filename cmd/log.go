@@ -0,0 +1,88 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	// logLevelAnnotation is a command annotation overriding the default
+	// log level, for long-running commands whose logs are their output
+	logLevelAnnotation = "log_level"
+	// defaultLogMaxSize is the size in megabytes at which log files are
+	// rotated
+	defaultLogMaxSize = 10
+	// defaultLogMaxBackups is the number of rotated log files kept
+	defaultLogMaxBackups = 3
+)
+
+// setupLogging configures the logger from the settings. Only warnings and
+// errors are logged to the console by default, and only errors when stdout
+// is not a terminal, so piping godad only ever passes on the joke. With a
+// log file, JSON logs are written to the file instead and rotated by size.
+// --quiet and --verbose override any other level.
+func setupLogging(cmd *cobra.Command) error {
+	level, err := logLevel(cmd)
+	if err != nil {
+		return err
+	}
+	zerolog.SetGlobalLevel(level)
+
+	file := viper.GetString("log_file")
+	if file != "" {
+		log.Logger = zerolog.New(&lumberjack.Logger{
+			Filename:   file,
+			MaxSize:    viper.GetInt("log_max_size"),
+			MaxBackups: viper.GetInt("log_max_backups"),
+		}).With().Timestamp().Logger()
+		return nil
+	}
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, NoColor: !isTerminal(os.Stderr)})
+	return nil
+}
+
+// logLevel returns the log level of cmd according to the settings, see
+// setupLogging
+func logLevel(cmd *cobra.Command) (zerolog.Level, error) {
+	level := zerolog.WarnLevel
+	if !isTerminal(os.Stdout) {
+		level = zerolog.ErrorLevel
+	}
+	if l, err := zerolog.ParseLevel(cmd.Annotations[logLevelAnnotation]); err == nil && l != zerolog.NoLevel {
+		level = l
+	}
+
+	if viper.GetString("log_file") != "" {
+		level = zerolog.InfoLevel
+	}
+	if s := viper.GetString("log_level"); s != "" {
+		l, err := zerolog.ParseLevel(s)
+		if err != nil || l == zerolog.NoLevel {
+			return zerolog.NoLevel, fmt.Errorf("unknown log level %q, use trace, debug, info, warn, error or disabled", s)
+		}
+		level = l
+	}
+
+	switch {
+	case viper.GetBool("verbose"):
+		level = zerolog.DebugLevel
+	case viper.GetBool("quiet"):
+		level = zerolog.ErrorLevel
+	}
+	return level, nil
+}
+
+// isTerminal reports whether f is connected to a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+func TestSetupLogging(t *testing.T) {
+	defer zerolog.SetGlobalLevel(zerolog.GlobalLevel())
+	defer func(l zerolog.Logger) { log.Logger = l }(log.Logger)
+	logFile := filepath.Join(t.TempDir(), "godad.log")
+
+	// Test output is not a terminal, so only errors are logged by default
+	testCases := []struct {
+		name string
+		args []string
+		want zerolog.Level
+	}{
+		{name: "Default", args: []string{"tell"}, want: zerolog.ErrorLevel},
+		{name: "Verbose", args: []string{"tell", "--verbose"}, want: zerolog.DebugLevel},
+		{name: "Quiet", args: []string{"tell", "-q"}, want: zerolog.ErrorLevel},
+		{name: "Serve", args: []string{"serve"}, want: zerolog.InfoLevel},
+		{name: "QuietServe", args: []string{"serve", "--quiet"}, want: zerolog.ErrorLevel},
+		{name: "LogLevel", args: []string{"tell", "--log-level", "warn"}, want: zerolog.WarnLevel},
+		{name: "LogFile", args: []string{"tell", "--log-file", logFile}, want: zerolog.InfoLevel},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			viper.Reset()
+			cmd, args, err := newRootCmd().Find(tc.args)
+			if err != nil {
+				t.Fatalf("Find() returned an error: %v", err)
+			}
+			if err := cmd.ParseFlags(args); err != nil {
+				t.Fatalf("ParseFlags() returned an error: %v", err)
+			}
+			if err := initConfig(cmd); err != nil {
+				t.Fatalf("initConfig() returned an error: %v", err)
+			}
+
+			if err := setupLogging(cmd); err != nil {
+				t.Fatalf("setupLogging() returned an error: %v", err)
+			}
+			if got := zerolog.GlobalLevel(); got != tc.want {
+				t.Errorf("Log level = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	// The last case logs to the file
+	log.Info().Msg("Hello")
+	data, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("Error reading log file: %v", err)
+	}
+	if !strings.Contains(string(data), `"message":"Hello"`) {
+		t.Errorf("Log file contains %q, want a JSON log entry", data)
+	}
+
+	viper.Reset()
+	viper.Set("log_level", "loud")
+	if err := setupLogging(newRootCmd()); err == nil {
+		t.Errorf("setupLogging() accepted an unknown log level")
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/doc"
+)
+
+func newManCmd() *cobra.Command {
+	manCmd := &cobra.Command{
+		Use:   "man [<dir>]",
+		Short: "Generate man pages for godad and its commands",
+		Long: `Generate a man page for godad and one for each of its commands, like
+godad-tell.1, from the help of the commands, in a directory that is created
+if missing, "man" by default. Packagers can install them in
+/usr/share/man/man1.
+
+The pages are dated at SOURCE_DATE_EPOCH if it is set, so builds are
+reproducible.`,
+		Example: `  godad man
+  SOURCE_DATE_EPOCH=$(git log -1 --format=%ct) godad man build/man`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "man"
+			if len(args) > 0 {
+				dir = args[0]
+			}
+			if err := os.MkdirAll(dir, 0o755); err != nil { // #nosec G301 -- man pages are world-readable
+				return fmt.Errorf("error creating man page directory: %w", err)
+			}
+
+			root := cmd.Root()
+			disableAutoGenTag(root)
+			header := &doc.GenManHeader{
+				Title:   "GODAD",
+				Section: "1",
+				Source:  "godad " + currentVersion().Version,
+				Manual:  "Godad Manual",
+			}
+			if err := doc.GenManTree(root, header, dir); err != nil {
+				return fmt.Errorf("error generating man pages: %w", err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Man pages written to %s\n", dir)
+			return nil
+		},
+	}
+	return manCmd
+}
+
+// disableAutoGenTag leaves the generation date out of the pages of cmd and
+// its subcommands, which would change with every build
+func disableAutoGenTag(cmd *cobra.Command) {
+	cmd.DisableAutoGenTag = true
+	for _, c := range cmd.Commands() {
+		disableAutoGenTag(c)
+	}
+}
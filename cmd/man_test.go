@@ -0,0 +1,42 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestMan(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	t.Setenv("SOURCE_DATE_EPOCH", "1714554000")
+	dir := filepath.Join(t.TempDir(), "man")
+
+	root := newRootCmd()
+	root.SetArgs([]string{"man", dir, "--dbdir", t.TempDir()})
+	root.SetOut(io.Discard)
+	if err := root.Execute(); err != nil {
+		t.Fatalf("man returned an error: %v", err)
+	}
+
+	for _, page := range []string{"godad.1", "godad-tell.1", "godad-db-backup.1"} {
+		b, err := os.ReadFile(filepath.Join(dir, page))
+		if err != nil {
+			t.Errorf("man didn't write %s: %v", page, err)
+			continue
+		}
+		if !strings.Contains(string(b), `"May 2024"`) {
+			t.Errorf("%s isn't dated at SOURCE_DATE_EPOCH:\n%s", page, b)
+		}
+		if strings.Contains(string(b), "Auto generated") {
+			t.Errorf("%s has the generation date in it", page)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"github.com/lhaig/godad/internal/daemon"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func newMotdCmd() *cobra.Command {
+	var (
+		path   string
+		script bool
+	)
+
+	motdCmd := &cobra.Command{
+		Use:   "motd",
+		Short: "Write a fresh joke to a file for the message of the day",
+		Long: `Write a fresh joke to a file, replacing its contents atomically. Show the
+file in the message of the day or a shell greeting, and refresh it from
+cron or with "godad daemon --sinks motd:<path>", so logging in never waits
+for the network.
+
+Files in an update-motd.d directory are written as executable shell scripts
+printing the joke; use --script to choose explicitly.`,
+		Example: `  godad motd --path /etc/update-motd.d/99-dadjoke
+  godad motd --path ~/.cache/dadjoke && echo 'cat ~/.cache/dadjoke' >> ~/.bashrc`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			sink := daemon.NewMotdSink(path)
+			if cmd.Flags().Changed("script") {
+				sink.Script = script
+			}
+
+			store, err := openStore()
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			unlock, err := lockStore(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer unlock()
+
+			engine, err := newEngine(store, viper.GetString("lang"))
+			if err != nil {
+				return err
+			}
+			d := &daemon.Daemon{Tell: engine.Tell, Sinks: []daemon.Sink{sink}}
+			return d.Deliver(cmd.Context())
+		},
+	}
+
+	addEngineFlags(motdCmd)
+	motdCmd.Flags().StringVar(&path, "path", "", "File to write the joke to")
+	motdCmd.Flags().BoolVar(&script, "script", false, "Write a shell script printing the joke instead of plain text")
+	_ = motdCmd.MarkFlagRequired("path")
+	return motdCmd
+}
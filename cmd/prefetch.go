@@ -0,0 +1,55 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func newPrefetchCmd() *cobra.Command {
+	prefetchCmd := &cobra.Command{
+		Use:   "prefetch",
+		Short: "Download jokes in bulk for offline use",
+		Long: `Download jokes that have not been told yet and store them in the local
+database. Prefetched jokes are told before any new jokes are fetched, so
+godad keeps working without a network connection, e.g. with --offline.
+
+Several jokes are downloaded at the same time, within the rate limit of
+each source, and a progress bar is shown on a terminal.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			store, err := openStore()
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			unlock, err := lockStore(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer unlock()
+
+			engine, err := newEngine(store, viper.GetString("lang"))
+			if err != nil {
+				return err
+			}
+
+			count := viper.GetInt("count")
+			progress := newProgress(cmd.ErrOrStderr(), "Prefetching jokes", count)
+			n, err := engine.Prefetch(cmd.Context(), count, progress.update)
+			progress.done()
+			fmt.Fprintf(cmd.OutOrStdout(), "Prefetched %d of %d jokes\n", n, count)
+			return err
+		},
+	}
+	prefetchCmd.Flags().Int("count", 100, "Number of jokes to download")
+	prefetchCmd.Flags().Int("workers", joke.DefaultWorkers, "Number of jokes or batches to download at the same time")
+	prefetchCmd.Flags().String("lang", autoLanguage, "Language of the jokes, or auto for the language of the locale")
+	return prefetchCmd
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/lhaig/godad/pkg/joke"
+)
+
+// writePunchline writes the setup of a joke, then waits for Enter on in
+// when interactive is set, or for delay otherwise, before writing the
+// punchline
+func writePunchline(ctx context.Context, out io.Writer, in io.Reader, st style, text string, delay time.Duration, interactive bool) error {
+	setup, punchline := joke.SplitJoke(text)
+	if punchline == "" {
+		_, err := fmt.Fprint(out, st.joke(text))
+		return err
+	}
+	if _, err := fmt.Fprint(out, st.setup(setup)); err != nil {
+		return err
+	}
+
+	if interactive {
+		done := make(chan error, 1)
+		go func() {
+			_, err := bufio.NewReader(in).ReadString('\n')
+			done <- err
+		}()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-done:
+			// Tell the punchline at the end of the input too
+			if err != nil && err != io.EOF {
+				return err
+			}
+		}
+	} else {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	_, err := fmt.Fprint(out, st.punchline(punchline))
+	return err
+}
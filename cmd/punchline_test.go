@@ -0,0 +1,45 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWritePunchline(t *testing.T) {
+	const text = "What do you call a fake noodle? An impasta."
+	want := "What do you call a fake noodle?\nAn impasta.\n"
+
+	st, _ := newStyle("plain", false)
+	var out bytes.Buffer
+	start := time.Now()
+	if err := writePunchline(context.Background(), &out, nil, st, text, 20*time.Millisecond, false); err != nil {
+		t.Fatalf("writePunchline() returned an error: %v", err)
+	}
+	if time.Since(start) < 20*time.Millisecond {
+		t.Error("writePunchline() did not wait before the punchline")
+	}
+	if out.String() != want {
+		t.Errorf("writePunchline() wrote %q, want %q", out.String(), want)
+	}
+
+	out.Reset()
+	if err := writePunchline(context.Background(), &out, strings.NewReader("\n"), st, text, time.Hour, true); err != nil {
+		t.Fatalf("writePunchline() returned an error: %v", err)
+	}
+	if out.String() != want {
+		t.Errorf("Interactive writePunchline() wrote %q, want %q", out.String(), want)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	out.Reset()
+	if err := writePunchline(ctx, &out, nil, st, text, time.Hour, false); err == nil {
+		t.Error("writePunchline() kept waiting after being canceled")
+	}
+}
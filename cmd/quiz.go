@@ -0,0 +1,138 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// maxQuizSkips is how many jokes without a punchline a round of the quiz
+// skips before giving up
+const maxQuizSkips = 10
+
+func newQuizCmd() *cobra.Command {
+	var rounds int
+
+	quizCmd := &cobra.Command{
+		Use:   "quiz",
+		Short: "Guess the punchlines of fresh jokes",
+		Long: `Play a round of guess the punchline, e.g. as an icebreaker: godad shows the
+setup of a fresh joke, waits for a guess and then reveals the punchline.
+A guess counts when it has at least half of the longer words of the
+punchline, in any order.
+
+The score and the streak of correct guesses are kept in the database
+across games. Jokes without a separate punchline are skipped.`,
+		Example: `  godad quiz
+  godad quiz --rounds 10 --lang de`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if rounds < 1 {
+				return fmt.Errorf("rounds must be at least 1, got %d", rounds)
+			}
+			st, err := newStyle(viper.GetString("theme"), viper.GetBool("banner"))
+			if err != nil {
+				return err
+			}
+
+			store, err := openStoreAs[joke.QuizStore]("keep quiz scores")
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+			engine, err := newEngine(store, viper.GetString("lang"))
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			in := bufio.NewReader(cmd.InOrStdin())
+			right, played := 0, 0
+			for round := 1; round <= rounds; round++ {
+				j, err := tellQuizJoke(cmd.Context(), engine)
+				if err != nil {
+					return err
+				}
+				setup, punchline := joke.SplitJoke(j.Text)
+				fmt.Fprintf(out, "Round %d of %d\n", round, rounds)
+				fmt.Fprint(out, st.setup(setup))
+				fmt.Fprint(out, "Your guess: ")
+				guess, err := in.ReadString('\n')
+				if err != nil && !errors.Is(err, io.EOF) {
+					return fmt.Errorf("error reading guess: %w", err)
+				}
+				if err != nil && guess == "" {
+					// Out of guesses, reveal the punchline and stop
+					fmt.Fprintln(out)
+					fmt.Fprint(out, st.punchline(punchline))
+					break
+				}
+
+				answer := joke.QuizAnswer{
+					JokeID:     j.ID,
+					Guess:      strings.TrimSpace(guess),
+					Correct:    joke.GuessMatches(guess, punchline),
+					AnsweredAt: time.Now(),
+				}
+				if err := store.RecordAnswer(cmd.Context(), answer); err != nil {
+					return err
+				}
+				played++
+				fmt.Fprint(out, st.punchline(punchline))
+				if answer.Correct {
+					right++
+					fmt.Fprint(out, "Spot on!\n\n")
+				} else {
+					fmt.Fprint(out, "Not quite.\n\n")
+				}
+			}
+
+			score, err := store.QuizScore(cmd.Context())
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "You got %d of %d right. Streak: %d, best: %d, all time: %d of %d right\n",
+				right, played, score.Streak, score.BestStreak, score.Correct, score.Answered)
+			return nil
+		},
+	}
+
+	quizCmd.Flags().IntVar(&rounds, "rounds", 5, "Number of jokes to guess")
+	quizCmd.Flags().String("lang", autoLanguage, "Language of the jokes, or auto for the language of the locale")
+	quizCmd.Flags().Bool("offline", false, "Only play with jokes from the local database, without any network calls")
+	return quizCmd
+}
+
+// tellQuizJoke tells the next joke with a punchline to guess, holding the
+// store lock only while telling it, not while waiting for a guess
+func tellQuizJoke(ctx context.Context, engine *joke.Engine) (joke.Joke, error) {
+	unlock, err := lockStore(ctx)
+	if err != nil {
+		return joke.Joke{}, err
+	}
+	defer unlock()
+
+	for range maxQuizSkips {
+		j, err := engine.Tell(ctx)
+		if err != nil {
+			return joke.Joke{}, err
+		}
+		if _, punchline := joke.SplitJoke(j.Text); punchline != "" {
+			return j, nil
+		}
+		log.Debug().Int64("id", j.ID).Msg("Joke has no punchline to guess, skipping it")
+	}
+	return joke.Joke{}, fmt.Errorf("no joke with a punchline to guess in %d tries", maxQuizSkips)
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestQuiz(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	dbdir := t.TempDir()
+
+	jokes := "Why did the scarecrow win an award? He was outstanding in his field.\n\n" +
+		"A joke without a punchline\n\n" +
+		"What do you call a fake noodle? An impasta."
+	if _, err := runGodad(dbdir, jokes, "--lang", "en", "add"); err != nil {
+		t.Fatalf("add returned an error: %v", err)
+	}
+
+	out, err := runGodad(dbdir, "outstanding field\nspaghetti\n", "--lang", "en", "quiz", "--rounds", "2", "--offline")
+	if err != nil {
+		t.Fatalf("quiz returned an error: %v", err)
+	}
+	for _, want := range []string{
+		"Why did the scarecrow win an award?",
+		"He was outstanding in his field.\nSpot on!",
+		"An impasta.\nNot quite.",
+		"You got 1 of 2 right. Streak: 0, best: 1, all time: 1 of 2 right",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("quiz printed %q, want it to contain %q", out, want)
+		}
+	}
+	if strings.Contains(out, "without a punchline") {
+		t.Errorf("quiz printed %q, want the joke without a punchline skipped", out)
+	}
+
+	if _, err := runGodad(dbdir, "", "--lang", "en", "quiz", "--rounds", "0", "--offline"); err == nil {
+		t.Error("quiz --rounds 0 returned no error")
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/cobra"
+)
+
+func newRateCmd() *cobra.Command {
+	var id int64
+
+	rateCmd := &cobra.Command{
+		Use:   "rate <rating>",
+		Short: "Rate the last told joke",
+		Long: fmt.Sprintf(`Rate the last told joke, or the joke given with --id, from %d to %d.
+Higher rated jokes are more likely to be told again when godad repeats
+jokes from the database.`, joke.MinRating, joke.MaxRating),
+		Example: `  godad rate 4
+  godad rate 1 --id 42`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			rating, err := strconv.Atoi(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid rating %q: %w", args[0], joke.ErrInvalidRating)
+			}
+
+			store, err := openStore()
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			id, err := jokeIDOrLast(cmd.Context(), store, id)
+			if err != nil {
+				return err
+			}
+			if err := store.Rate(cmd.Context(), id, rating); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Rated joke %d with %d/%d\n", id, rating, joke.MaxRating)
+			return nil
+		},
+	}
+
+	rateCmd.Flags().Int64Var(&id, "id", 0, "Local ID of the joke to rate, instead of the last told one")
+	return rateCmd
+}
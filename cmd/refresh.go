@@ -0,0 +1,74 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/viper"
+)
+
+const (
+	// refreshCount is how many jokes a background refresh prefetches
+	refreshCount = 20
+	// refreshInterval is how long to wait before starting another
+	// background refresh, so many shells starting at once don't all start
+	// one
+	refreshInterval = 5 * time.Minute
+)
+
+// refreshInBackground starts "godad prefetch" for lang in a process of its
+// own that keeps running after godad exits. It does nothing when another
+// refresh was started less than refreshInterval ago.
+func refreshInBackground(lang string) error {
+	lock := filepath.Join(viper.GetString("dbdir"), "refresh.lock")
+	if info, err := os.Stat(lock); err == nil && time.Since(info.ModTime()) < refreshInterval {
+		return nil
+	} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.WriteFile(lock, nil, 0o644); err != nil {
+		return err
+	}
+	// WriteFile doesn't touch an existing file that stays empty
+	now := time.Now()
+	if err := os.Chtimes(lock, now, now); err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, "prefetch", "--quiet",
+		"--count", strconv.Itoa(refreshCount),
+		"--lang", lang,
+		"--dbdir", viper.GetString("dbdir"))
+	detach(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
+
+// startRefill keeps refill_min jokes of engine untold in the background
+// until ctx is done or the returned function is called, for the commands
+// that run for a long time
+func startRefill(ctx context.Context, engine *joke.Engine) (stop func()) {
+	minimum := viper.GetInt("refill_min")
+	if minimum <= 0 || engine.Offline {
+		return func() {}
+	}
+	ctx, stop = context.WithCancel(ctx)
+	go engine.Refill(ctx, minimum, viper.GetDuration("refill_interval"))
+	return stop
+}
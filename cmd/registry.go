@@ -0,0 +1,230 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// registryMaxAge is how long a downloaded source registry is used before
+// it is downloaded again
+const registryMaxAge = 24 * time.Hour
+
+// registryMaxSize is the largest source registry or signature read
+const registryMaxSize = 1 << 20
+
+// registryClient downloads remote source registries, sharing the
+// connections of the sources
+var registryClient = &http.Client{Transport: joke.DefaultHTTPClient.Transport, Timeout: 30 * time.Second}
+
+// registryFile is a source registry, a file listing sources anyone can
+// add to by editing it
+type registryFile struct {
+	Sources []sourceConfig `yaml:"sources"`
+}
+
+// registrySources returns the sources listed in the source registry. A
+// remote registry must be verified with a checksum or a signature, and
+// may only list http and markdown sources. It is cached in the database directory, and
+// when it can't be downloaded the cached copy is used, or none at all.
+func registrySources() ([]sourceConfig, error) {
+	location := viper.GetString("source_registry")
+	if location == "" {
+		return nil, nil
+	}
+	checksum := viper.GetString("source_registry_sha256")
+	key := viper.GetString("source_registry_key")
+
+	var data, sig []byte
+	var err error
+	remote := strings.Contains(location, "://")
+	if remote {
+		if !strings.HasPrefix(location, "https://") {
+			return nil, fmt.Errorf("source registry %s must be an https URL or a file", location)
+		}
+		if checksum == "" && key == "" {
+			return nil, errors.New("a remote source registry needs source_registry_sha256 or source_registry_key to be verified")
+		}
+		data, sig, err = cachedRegistry(location, key != "")
+		if err != nil {
+			log.Warn().Err(err).Str("registry", location).Msg("Skipping source registry")
+			return nil, nil
+		}
+	} else {
+		path := expandHome(location)
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("error reading source registry: %w", err)
+		}
+		if key != "" {
+			if sig, err = os.ReadFile(path + ".sig"); err != nil {
+				return nil, fmt.Errorf("error reading source registry signature: %w", err)
+			}
+		}
+	}
+
+	if err := verifyRegistry(data, sig, checksum, key); err != nil {
+		return nil, fmt.Errorf("error verifying source registry %s: %w", location, err)
+	}
+	var file registryFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error parsing source registry %s: %w", location, err)
+	}
+	if remote {
+		for _, c := range file.Sources {
+			// Files and commands on this machine are not for others to pick
+			if c.Type != "http" && c.Type != "markdown" {
+				return nil, fmt.Errorf("source registry %s: source %q has type %q, remote registries may only list http and markdown sources", location, c.Name, c.Type)
+			}
+		}
+	}
+	return file.Sources, nil
+}
+
+// verifyRegistry checks data against the sha256 checksum and the ed25519
+// signature sig made with key, where set
+func verifyRegistry(data, sig []byte, checksum, key string) error {
+	if checksum != "" {
+		sum := sha256.Sum256(data)
+		if subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(strings.ToLower(checksum))) != 1 {
+			return errors.New("checksum mismatch")
+		}
+	}
+	if key != "" {
+		pub, err := parsePublicKey(key)
+		if err != nil {
+			return err
+		}
+		raw, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig)))
+		if err != nil {
+			return fmt.Errorf("error decoding signature: %w", err)
+		}
+		if !ed25519.Verify(pub, data, raw) {
+			return errors.New("invalid signature")
+		}
+	}
+	return nil
+}
+
+// parsePublicKey parses a base64 ed25519 public key, either the raw key or
+// a DER encoded one as written by "openssl pkey -pubout -outform DER"
+func parsePublicKey(key string) (ed25519.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding source_registry_key: %w", err)
+	}
+	if len(der) == ed25519.PublicKeySize {
+		return ed25519.PublicKey(der), nil
+	}
+	parsed, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing source_registry_key: %w", err)
+	}
+	pub, ok := parsed.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("source_registry_key is a %T, not an ed25519 key", parsed)
+	}
+	return pub, nil
+}
+
+// cachedRegistry returns the registry at url and, if withSig is set, its
+// signature at url.sig. They are downloaded again once the cached copy is
+// older than registryMaxAge.
+func cachedRegistry(url string, withSig bool) (data, sig []byte, err error) {
+	sum := sha256.Sum256([]byte(url))
+	path := filepath.Join(viper.GetString("dbdir"), "registry-"+hex.EncodeToString(sum[:8])+".yaml")
+
+	info, statErr := os.Stat(path)
+	if statErr != nil || time.Since(info.ModTime()) > registryMaxAge {
+		data, sig, err = downloadRegistry(url, withSig)
+		if err == nil {
+			if err := writeCache(path, data, sig); err != nil {
+				log.Warn().Err(err).Msg("Could not cache the source registry")
+			}
+			return data, sig, nil
+		}
+		if statErr != nil {
+			return nil, nil, err
+		}
+		log.Warn().Err(err).Str("registry", url).Msg("Using the cached source registry")
+	}
+
+	if data, err = os.ReadFile(path); err != nil {
+		return nil, nil, fmt.Errorf("error reading cached source registry: %w", err)
+	}
+	if withSig {
+		if sig, err = os.ReadFile(path + ".sig"); err != nil {
+			return nil, nil, fmt.Errorf("error reading cached source registry signature: %w", err)
+		}
+	}
+	return data, sig, nil
+}
+
+// downloadRegistry downloads the registry at url and, if withSig is set,
+// its signature at url.sig
+func downloadRegistry(url string, withSig bool) (data, sig []byte, err error) {
+	if data, err = download(url); err != nil {
+		return nil, nil, err
+	}
+	if withSig {
+		if sig, err = download(url + ".sig"); err != nil {
+			return nil, nil, err
+		}
+	}
+	return data, sig, nil
+}
+
+// download returns the body of url
+func download(url string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("User-Agent", joke.UserAgent)
+
+	resp, err := registryClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error downloading %s: %s", url, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, registryMaxSize))
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+	return body, nil
+}
+
+// writeCache writes the registry and its signature, if any, to path
+func writeCache(path string, data, sig []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if sig != nil {
+		if err := os.WriteFile(path+".sig", sig, 0o644); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, data, 0o644)
+}
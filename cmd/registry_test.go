@@ -0,0 +1,131 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/viper"
+)
+
+const testRegistry = `sources:
+  - name: witzapi
+    type: http
+    lang: de
+    url: https://witze.example/api/random
+    setup: frage
+    punchline: antwort
+`
+
+func TestLocalRegistry(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	path := filepath.Join(t.TempDir(), "sources.yaml")
+	if err := os.WriteFile(path, []byte(testRegistry), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	viper.Set("source_registry", path)
+
+	sources, err := customSources()
+	if err != nil {
+		t.Fatalf("customSources() returned an error: %v", err)
+	}
+	if len(sources) != 1 {
+		t.Fatalf("customSources() returned %d sources, want 1", len(sources))
+	}
+	src, ok := sources[0].(*joke.HTTPSource)
+	if !ok || src.Name() != "witzapi" || src.Language() != "de" || src.SetupField != "frage" || src.JokeField != "" {
+		t.Errorf("customSources()[0] = %+v, want the German two part http source", sources[0])
+	}
+
+	sum := sha256.Sum256([]byte(testRegistry))
+	viper.Set("source_registry_sha256", hex.EncodeToString(sum[:]))
+	if _, err := registrySources(); err != nil {
+		t.Errorf("registrySources() with the right checksum returned an error: %v", err)
+	}
+	viper.Set("source_registry_sha256", "00")
+	if _, err := registrySources(); err == nil {
+		t.Errorf("registrySources() with the wrong checksum returned no error")
+	}
+}
+
+func TestRemoteRegistry(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("dbdir", t.TempDir())
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sources.yaml":
+			_, _ = w.Write([]byte(testRegistry))
+		case "/sources.yaml.sig":
+			_, _ = w.Write([]byte(base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(testRegistry)))))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	defer func(c *http.Client) { registryClient = c }(registryClient)
+	registryClient = server.Client()
+
+	viper.Set("source_registry", server.URL+"/sources.yaml")
+	if _, err := registrySources(); err == nil {
+		t.Errorf("registrySources() accepted an unverified remote registry")
+	}
+
+	viper.Set("source_registry_key", base64.StdEncoding.EncodeToString(pub))
+	configs, err := registrySources()
+	if err != nil {
+		t.Fatalf("registrySources() returned an error: %v", err)
+	}
+	if len(configs) != 1 || configs[0].Name != "witzapi" {
+		t.Errorf("registrySources() = %+v, want witzapi", configs)
+	}
+
+	// The cached copy is used while the server is down
+	server.Close()
+	if configs, err := registrySources(); err != nil || len(configs) != 1 {
+		t.Errorf("registrySources() = %+v, %v, want the cached registry", configs, err)
+	}
+}
+
+func TestRemoteRegistryRejects(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("dbdir", t.TempDir())
+
+	registry := "sources:\n  - name: rm\n    type: exec\n    command: rm\n"
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(registry))
+	}))
+	defer server.Close()
+	defer func(c *http.Client) { registryClient = c }(registryClient)
+	registryClient = server.Client()
+
+	sum := sha256.Sum256([]byte(registry))
+	viper.Set("source_registry", server.URL+"/sources.yaml")
+	viper.Set("source_registry_sha256", hex.EncodeToString(sum[:]))
+	if _, err := registrySources(); err == nil {
+		t.Errorf("registrySources() accepted an exec source from a remote registry")
+	}
+
+	viper.Set("source_registry", "http://witze.example/sources.yaml")
+	if _, err := registrySources(); err == nil {
+		t.Errorf("registrySources() accepted a registry over plain http")
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// watchConfig reads the config file again whenever it changes, for the
+// commands that run for a long time. The log level is applied at once;
+// reload applies the settings of the command. Invalid settings are logged
+// and the command carries on as it was. Where logs go and how godad
+// connects to the network only change with a restart. Without a config
+// file nothing is watched.
+func watchConfig(cmd *cobra.Command, reload func() error) {
+	if viper.ConfigFileUsed() == "" {
+		return
+	}
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		log.Info().Str("path", e.Name).Msg("Config file changed, reloading settings")
+		if level, err := logLevel(cmd); err != nil {
+			log.Error().Err(err).Msg("Could not apply the log level")
+		} else {
+			zerolog.SetGlobalLevel(level)
+		}
+		if err := reload(); err != nil {
+			log.Error().Err(err).Msg("Could not apply the changed settings, keeping the previous ones")
+		}
+	})
+	viper.WatchConfig()
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func TestWatchConfig(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	defer zerolog.SetGlobalLevel(zerolog.GlobalLevel())
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("schedule: \"@daily\"\nlog_level: warn\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	viper.SetConfigFile(path)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	schedules := make(chan string, 10)
+	watchConfig(&cobra.Command{}, func() error {
+		schedules <- viper.GetString("schedule")
+		return nil
+	})
+	if err := os.WriteFile(path, []byte("schedule: \"@hourly\"\nlog_level: debug\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Writing the file may show up as several changes
+	for timeout := time.After(5 * time.Second); ; {
+		select {
+		case schedule := <-schedules:
+			if schedule != "@hourly" {
+				continue
+			}
+		case <-timeout:
+			t.Fatal("watchConfig() didn't reload the changed config file")
+		}
+		break
+	}
+	if level := zerolog.GlobalLevel(); level != zerolog.DebugLevel {
+		t.Errorf("log level after the change = %v, want debug", level)
+	}
+}
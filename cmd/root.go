@@ -0,0 +1,409 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/lhaig/godad/pkg/plugin"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// Execute runs the root command and exits with a non-zero status on failure
+func Execute() {
+	// Log to the console until the settings are read
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+
+	// Cancel running commands cleanly on Ctrl-C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := newRootCmd().ExecuteContext(ctx)
+	plugin.CleanupClients()
+	if err != nil {
+		stop()
+		os.Exit(1)
+	}
+}
+
+// newRootCmd builds the full command tree. A fresh tree is built on every
+// call so tests can execute commands without sharing flag state.
+func newRootCmd() *cobra.Command {
+	rootCmd := &cobra.Command{
+		Use:   "godad",
+		Short: "Fetch and display dad jokes",
+		Long: `Godad fetches dad jokes from the icanhazdadjoke.com API and stores them
+in a SQLite database so that you always get a fresh joke.
+
+Running godad without a subcommand is the same as running "godad tell".`,
+		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
+			if err := initConfig(cmd); err != nil {
+				return err
+			}
+			if err := setupLogging(cmd); err != nil {
+				return err
+			}
+			if err := configureHTTP(); err != nil {
+				return err
+			}
+			if file := viper.ConfigFileUsed(); file != "" {
+				log.Debug().Str("path", file).Msg("Using config file")
+			}
+			return nil
+		},
+		RunE:    runTell,
+		Version: currentVersion().String(),
+	}
+	rootCmd.SetVersionTemplate("godad {{.Version}}\n")
+
+	rootCmd.PersistentFlags().String("dbdir", "", "Directory to store the SQLite database")
+	rootCmd.PersistentFlags().Duration("timeout", joke.DefaultTimeout, "Maximum time to wait for a joke from a source")
+	rootCmd.PersistentFlags().BoolP("quiet", "q", false, "Only log errors")
+	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "Log diagnostics, including debug messages")
+	rootCmd.MarkFlagsMutuallyExclusive("quiet", "verbose")
+	rootCmd.PersistentFlags().String("log-level", "", "Log level (trace, debug, info, warn, error, disabled)")
+	rootCmd.PersistentFlags().String("log-file", "", "Write JSON logs to this file, rotated by size, instead of the console")
+	addTellFlags(rootCmd)
+
+	rootCmd.AddCommand(
+		newTellCmd(),
+		newAddCmd(),
+		newEditCmd(),
+		newDeleteCmd(),
+		newSubmitCmd(),
+		newImportCmd(),
+		newExportCmd(),
+		newHistoryCmd(),
+		newSearchCmd(),
+		newShowCmd(),
+		newBrowseCmd(),
+		newRateCmd(),
+		newShareCmd(),
+		newImageCmd(),
+		newTagCmd(),
+		newConfigCmd(),
+		newDBCmd(),
+		newServeCmd(),
+		newDaemonCmd(),
+		newMotdCmd(),
+		newTodayCmd(),
+		newQuizCmd(),
+		newStatsCmd(),
+		newPrefetchCmd(),
+		newSourcesCmd(),
+		newVersionCmd(),
+		newManCmd(),
+	)
+
+	return rootCmd
+}
+
+// envPrefix is prepended to configuration keys to get the environment
+// variable they are read from, e.g. GODAD_TIMEOUT for timeout. LANG is the
+// system locale, so without a prefix the joke language would clash with it.
+const envPrefix = "GODAD"
+
+// envAliases maps configuration keys to environment variables that don't
+// follow the GODAD_<KEY> pattern
+var envAliases = map[string]string{
+	"dbdir": "GODAD_DB_DIR",
+}
+
+// legacyEnv maps configuration keys to the unprefixed environment variables
+// older versions read them from. They still work for now, but are
+// deprecated and will be removed in the next release.
+var legacyEnv = map[string]string{
+	"dbdir": "DBDIR",
+}
+
+// envName returns the environment variable a configuration key is read from
+func envName(key string) string {
+	if env, ok := envAliases[key]; ok {
+		return env
+	}
+	return envPrefix + "_" + strings.ToUpper(key)
+}
+
+func initConfig(cmd *cobra.Command) error {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		log.Err(err)
+	}
+	// Set default values
+	for _, opt := range configOptions {
+		if def := opt.def(home); def != nil {
+			viper.SetDefault(opt.key, def)
+		}
+	}
+
+	// Files used to live in ~/.godad
+	if err := moveLegacyFiles(home, "config*", configDir(home)); err != nil {
+		log.Warn().Err(err).Msg("Could not move the config file to its new location")
+	}
+
+	// Read from the config file
+	if file := findConfigFile(".", configDir(home), legacyDir(home)); file != "" {
+		viper.SetConfigFile(file)
+		if filepath.Ext(file) == "" {
+			viper.SetConfigType("env")
+		}
+		if err := viper.ReadInConfig(); err != nil {
+			return fmt.Errorf("error reading config file: %w", err)
+		}
+	}
+	// Read from environment variables
+	viper.SetEnvPrefix(envPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	viper.AutomaticEnv()
+	for key := range envAliases {
+		if err := viper.BindEnv(key, envName(key)); err != nil {
+			return fmt.Errorf("error binding environment: %w", err)
+		}
+	}
+	for key, env := range legacyEnv {
+		if os.Getenv(env) == "" {
+			continue
+		}
+		log.Warn().Msgf("%s is deprecated and will be removed in the next release, use %s instead", env, envName(key))
+		// The new name takes precedence when both are set
+		if err := viper.BindEnv(key, envName(key), env); err != nil {
+			return fmt.Errorf("error binding environment: %w", err)
+		}
+	}
+
+	// Bind flags to viper. Config keys use underscores where flags use
+	// dashes.
+	var bindErr error
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if f.Name == "help" || f.Name == "version" {
+			return
+		}
+		if err := viper.BindPFlag(configKey(f.Name), f); err != nil {
+			bindErr = fmt.Errorf("error binding flags: %w", err)
+		}
+	})
+	if bindErr != nil {
+		return bindErr
+	}
+
+	// Only move the database when it would be looked for in the new place
+	if viper.GetString("dbdir") == dataDir(home) {
+		if err := moveLegacyFiles(home, "jokes.db*", dataDir(home)); err != nil {
+			log.Warn().Err(err).Msg("Could not move the database to its new location")
+			viper.SetDefault("dbdir", legacyDir(home))
+		}
+	}
+
+	return nil
+}
+
+// configNames are the config file names godad looks for, in order of
+// precedence. A config file without extension is in env format.
+var configNames = []string{"config.yaml", "config.yml", "config.toml", "config.json", "config.env", "config"}
+
+// findConfigFile returns the first config file found in dirs, or "" if
+// there is none. Earlier directories take precedence over later ones.
+func findConfigFile(dirs ...string) string {
+	for _, dir := range dirs {
+		for _, name := range configNames {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path
+			}
+		}
+	}
+	return ""
+}
+
+// storages lists the values of the storage setting
+var storages = []string{"sqlite", "json", "postgres", "mysql"}
+
+// dbPath returns the location of the SQLite database file
+func dbPath() string {
+	return filepath.Join(viper.GetString("dbdir"), "jokes.db")
+}
+
+// jsonPath returns the location of the JSON store
+func jsonPath() string {
+	return filepath.Join(viper.GetString("dbdir"), "jokes.json")
+}
+
+// openStore opens the joke store set by storage, creating the database
+// directory if needed
+func openStore() (joke.Store, error) {
+	switch storage := viper.GetString("storage"); storage {
+	case "", "sqlite":
+		return openSQLite()
+	case "json":
+		if err := os.MkdirAll(viper.GetString("dbdir"), 0o755); err != nil {
+			return nil, fmt.Errorf("error creating database directory: %w", err)
+		}
+		path := jsonPath()
+		store, err := joke.OpenJSONStore(path)
+		if err != nil {
+			return nil, err
+		}
+		log.Debug().Str("path", path).Msg("JSON store opened")
+		return store, nil
+	case "postgres", "mysql":
+		dsn := viper.GetString("dsn")
+		if dsn == "" {
+			return nil, fmt.Errorf("the %s storage needs the address of the database in dsn", storage)
+		}
+		open := joke.OpenPostgres
+		if storage == "mysql" {
+			open = joke.OpenMySQL
+		}
+		store, err := open(dsn)
+		if err != nil {
+			return nil, err
+		}
+		log.Debug().Str("storage", storage).Msg("Database connected")
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown storage %q, use %s", storage, strings.Join(storages, ", "))
+	}
+}
+
+// lockStore waits until no other godad process telling jokes holds the
+// lock in the database directory, if the lock setting asks for it, and
+// returns a function releasing the lock
+func lockStore(ctx context.Context) (unlock func() error, err error) {
+	if !viper.GetBool("lock") {
+		return func() error { return nil }, nil
+	}
+	if err := os.MkdirAll(viper.GetString("dbdir"), 0o755); err != nil {
+		return nil, fmt.Errorf("error creating database directory: %w", err)
+	}
+	return joke.LockFile(ctx, filepath.Join(viper.GetString("dbdir"), "godad.lock"))
+}
+
+// openStoreAs opens the joke store like openStore, for commands needing a
+// store that can do more than any Store, like editing jokes. what says
+// what the command does, for the error when the store can't.
+func openStoreAs[T joke.Store](what string) (T, error) {
+	var none T
+	store, err := openStore()
+	if err != nil {
+		return none, err
+	}
+	s, ok := store.(T)
+	if !ok {
+		store.Close()
+		return none, fmt.Errorf("the %s storage can't %s", viper.GetString("storage"), what)
+	}
+	return s, nil
+}
+
+// flagOrSetting returns the value of the flag name if it was given, or
+// else the setting key, for flags too generic to be settings of their own
+func flagOrSetting(cmd *cobra.Command, name, key string) string {
+	if cmd.Flags().Changed(name) {
+		v, _ := cmd.Flags().GetString(name)
+		return v
+	}
+	return viper.GetString(key)
+}
+
+// createDBDir creates the database directory if it is missing and
+// reports whether it did
+func createDBDir() (bool, error) {
+	dir := viper.GetString("dbdir")
+	if _, err := os.Stat(dir); !errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return false, fmt.Errorf("error creating database directory: %w", err)
+	}
+	return true, nil
+}
+
+// openSQLite opens the SQLite database, creating its directory if needed,
+// for commands that work on the database itself
+func openSQLite() (*joke.SQLiteStore, error) {
+	if storage := viper.GetString("storage"); storage != "" && storage != "sqlite" {
+		return nil, fmt.Errorf("this command needs the sqlite storage, not %s", storage)
+	}
+	key, err := dbKey()
+	if err != nil {
+		return nil, err
+	}
+	path := dbPath()
+	store, err := joke.OpenEncryptedSQLite(path, key)
+	if err != nil {
+		// The directory is only created when opening fails, so it isn't
+		// checked on every run
+		created, mkdirErr := createDBDir()
+		if mkdirErr != nil {
+			return nil, mkdirErr
+		}
+		if !created {
+			return nil, err
+		}
+		if store, err = joke.OpenEncryptedSQLite(path, key); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Debug().Str("path", path).Msg("Database initialized")
+
+	return store, nil
+}
+
+// dbKey returns the key the database is encrypted with: db_key, or what
+// db_key_command prints, e.g. when looking the key up in a keychain. An
+// empty key means the database isn't encrypted.
+func dbKey() (string, error) {
+	if key := viper.GetString("db_key"); key != "" {
+		return key, nil
+	}
+	command := strings.Fields(viper.GetString("db_key_command"))
+	if len(command) == 0 {
+		return "", nil
+	}
+	// #nosec G204 -- running the configured command is the point
+	out, err := exec.Command(command[0], command[1:]...).Output()
+	if err != nil {
+		return "", fmt.Errorf("error getting the database key from %s: %w", command[0], err)
+	}
+	key := strings.TrimRight(string(out), "\r\n")
+	if key == "" {
+		return "", fmt.Errorf("%s printed no database key", command[0])
+	}
+	return key, nil
+}
+
+// configKey returns the config key for a flag or user supplied key name
+func configKey(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "-", "_"))
+}
+
+// configList returns a list setting. Lists can be written as lists in the
+// config file or as comma separated strings in env files.
+func configList(key string) []string {
+	var list []string
+	for _, item := range viper.GetStringSlice(key) {
+		for _, v := range strings.Split(item, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				list = append(list, v)
+			}
+		}
+	}
+	return list
+}
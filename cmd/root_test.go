@@ -0,0 +1,248 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/viper"
+)
+
+// runGodad runs godad with args and the database in dbdir, reading in
+// from standard input, and returns what it printed. The settings are reset
+// first, so every run reads them from its flags like a new process.
+func runGodad(dbdir, in string, args ...string) (string, error) {
+	viper.Reset()
+	root := newRootCmd()
+	var out strings.Builder
+	root.SetArgs(append(args, "--dbdir="+dbdir, "--quiet"))
+	root.SetIn(strings.NewReader(in))
+	root.SetOut(&out)
+	err := root.Execute()
+	return out.String(), err
+}
+
+func TestInitConfig(t *testing.T) {
+	// Save current environment and defer its restoration
+	oldEnv := os.Environ()
+	defer func() {
+		os.Clearenv()
+		for _, pair := range oldEnv {
+			parts := strings.SplitN(pair, "=", 2)
+			os.Setenv(parts[0], parts[1])
+		}
+	}()
+
+	// Set a mock home directory for testing
+	mockHomeDir := "/mock/home"
+	os.Setenv("HOME", mockHomeDir)
+
+	defaultDBDir := dataDir(mockHomeDir)
+
+	// Test cases
+	testCases := []struct {
+		name        string
+		envVars     map[string]string
+		args        []string
+		expectedDir string
+	}{
+		{
+			name:        "Default",
+			envVars:     map[string]string{},
+			args:        []string{},
+			expectedDir: defaultDBDir,
+		},
+		{
+			name:        "EnvVar",
+			envVars:     map[string]string{"DBDIR": "/env/path"},
+			args:        []string{},
+			expectedDir: "/env/path",
+		},
+		{
+			name:        "PrefixedEnvVar",
+			envVars:     map[string]string{"GODAD_DB_DIR": "/env/path"},
+			args:        []string{},
+			expectedDir: "/env/path",
+		},
+		{
+			name:        "PrefixedEnvVarOverridesLegacy",
+			envVars:     map[string]string{"GODAD_DB_DIR": "/env/path", "DBDIR": "/legacy/path"},
+			args:        []string{},
+			expectedDir: "/env/path",
+		},
+		{
+			name:        "Flag",
+			envVars:     map[string]string{},
+			args:        []string{"--dbdir", "/flag/path"},
+			expectedDir: "/flag/path",
+		},
+		{
+			name:        "FlagOverridesEnvVar",
+			envVars:     map[string]string{"GODAD_DB_DIR": "/env/path"},
+			args:        []string{"--dbdir", "/flag/path"},
+			expectedDir: "/flag/path",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Reset viper and build a fresh command tree
+			viper.Reset()
+			rootCmd := newRootCmd()
+
+			// Set environment variables
+			os.Clearenv()
+			os.Setenv("HOME", mockHomeDir) // Ensure HOME is always set
+			for k, v := range tc.envVars {
+				os.Setenv(k, v)
+			}
+
+			// Parse command line args
+			if err := rootCmd.ParseFlags(tc.args); err != nil {
+				t.Fatalf("ParseFlags() returned an error: %v", err)
+			}
+
+			// Run initConfig
+			err := initConfig(rootCmd)
+			if err != nil {
+				t.Fatalf("initConfig() returned an error: %v", err)
+			}
+
+			// Check result
+			if dir := viper.GetString("dbdir"); dir != tc.expectedDir {
+				t.Errorf("Expected dbdir to be %s, got %s", tc.expectedDir, dir)
+			}
+		})
+	}
+}
+
+func TestInitConfigLang(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("LANG", "fr_FR.UTF-8")
+
+	testCases := []struct {
+		name     string
+		envLang  string
+		args     []string
+		expected string
+	}{
+		{name: "Default", expected: "auto"},
+		{name: "EnvVar", envLang: "de", expected: "de"},
+		{name: "FlagOverridesEnvVar", envLang: "de", args: []string{"--lang", "en"}, expected: "en"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			viper.Reset()
+			rootCmd := newRootCmd()
+			t.Setenv("GODAD_LANG", tc.envLang)
+			if tc.envLang == "" {
+				os.Unsetenv("GODAD_LANG")
+			}
+
+			if err := rootCmd.ParseFlags(tc.args); err != nil {
+				t.Fatalf("ParseFlags() returned an error: %v", err)
+			}
+			if err := initConfig(rootCmd); err != nil {
+				t.Fatalf("initConfig() returned an error: %v", err)
+			}
+
+			if lang := viper.GetString("lang"); lang != tc.expected {
+				t.Errorf("Expected lang to be %s, got %s", tc.expected, lang)
+			}
+		})
+	}
+}
+
+func TestConfigList(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	viper.Set("env_style", "icanhazdadjoke, flachwitze")
+	viper.Set("list_style", []string{"icanhazdadjoke", "flachwitze"})
+
+	for _, key := range []string{"env_style", "list_style"} {
+		got := configList(key)
+		if len(got) != 2 || got[0] != "icanhazdadjoke" || got[1] != "flachwitze" {
+			t.Errorf("configList(%q) = %v, want [icanhazdadjoke flachwitze]", key, got)
+		}
+	}
+	if got := configList("missing"); len(got) != 0 {
+		t.Errorf("configList(\"missing\") = %v, want an empty list", got)
+	}
+}
+
+func TestOpenStore(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("dbdir", t.TempDir())
+
+	viper.Set("storage", "json")
+	store, err := openStore()
+	if err != nil {
+		t.Fatalf("openStore() returned an error: %v", err)
+	}
+	store.Close()
+	if _, ok := store.(*joke.JSONStore); !ok {
+		t.Errorf("openStore() with json storage returned a %T", store)
+	}
+	if _, err := openSQLite(); err == nil {
+		t.Error("openSQLite() with json storage returned no error")
+	}
+	if _, err := openStoreAs[joke.HealthStore]("keep track of sources"); err == nil || !strings.Contains(err.Error(), "json storage can't") {
+		t.Errorf("openStoreAs() a store the json storage isn't returned %v", err)
+	}
+
+	// The database directory is created when missing
+	viper.Set("storage", "sqlite")
+	viper.Set("dbdir", filepath.Join(t.TempDir(), "new", "godad"))
+	if store, err = openStore(); err != nil {
+		t.Fatalf("openStore() in a missing directory returned an error: %v", err)
+	}
+	store.Close()
+
+	viper.Set("storage", "postgres")
+	if _, err := openStore(); err == nil || !strings.Contains(err.Error(), "dsn") {
+		t.Errorf("openStore() with postgres storage without dsn returned %v", err)
+	}
+
+	viper.Set("storage", "redis")
+	if _, err := openStore(); err == nil {
+		t.Error("openStore() with an unknown storage returned no error")
+	}
+}
+
+func TestLockStore(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("dbdir", filepath.Join(t.TempDir(), "godad"))
+
+	// Without the lock setting, godad runs alongside others
+	for range 2 {
+		unlock, err := lockStore(context.Background())
+		if err != nil {
+			t.Fatalf("lockStore() returned an error: %v", err)
+		}
+		defer unlock()
+	}
+
+	viper.Set("lock", true)
+	unlock, err := lockStore(context.Background())
+	if err != nil {
+		t.Fatalf("lockStore() returned an error: %v", err)
+	}
+	defer unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := lockStore(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("lockStore() while another godad holds the lock returned %v, want it to wait", err)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/cobra"
+)
+
+// searchStore is a Store that can search the jokes it holds
+type searchStore interface {
+	joke.Store
+	joke.Searcher
+}
+
+func newSearchCmd() *cobra.Command {
+	var (
+		limit  int
+		output string
+	)
+
+	searchCmd := &cobra.Command{
+		Use:   "search <keyword>...",
+		Short: "Search previously told jokes",
+		Long: `Search previously told jokes for all of the given keywords. Keywords
+also match the beginning of longer words, and the best matches are listed
+first with the matching words highlighted.`,
+		Example: `  godad search scarecrow
+  godad search "book gravity" --output json`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "table" && output != "json" {
+				return fmt.Errorf("unknown output format %q, use table or json", output)
+			}
+
+			store, err := openStoreAs[searchStore]("search jokes")
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			results, err := store.Search(cmd.Context(), strings.Join(args, " "), limit)
+			if err != nil {
+				return err
+			}
+
+			if output == "json" {
+				return writeSearchJSON(cmd.OutOrStdout(), results)
+			}
+			return writeSearchTable(cmd.OutOrStdout(), results)
+		},
+	}
+
+	searchCmd.Flags().IntVar(&limit, "limit", joke.DefaultSearchLimit, "Maximum number of jokes to list")
+	searchCmd.Flags().StringVarP(&output, "output", "o", "table", "Output format (table, json)")
+	return searchCmd
+}
+
+// writeSearchTable writes search results as an aligned table
+func writeSearchTable(out io.Writer, results []joke.SearchResult) error {
+	if len(results) == 0 {
+		_, err := fmt.Fprintln(out, "No matching jokes found")
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tLANG\tSOURCE\tJOKE")
+	for _, r := range results {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", r.ID, r.Language, r.Source, r.Snippet)
+	}
+	return w.Flush()
+}
+
+// writeSearchJSON writes search results as an indented JSON array
+func writeSearchJSON(out io.Writer, results []joke.SearchResult) error {
+	if results == nil {
+		results = []joke.SearchResult{}
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
@@ -0,0 +1,255 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"time"
+
+	"github.com/lhaig/godad/internal/server"
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+)
+
+func newServeCmd() *cobra.Command {
+	serveCmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Run a REST server that tells jokes",
+		Long: `Run a long-running HTTP server backed by the joke database.
+
+Endpoints:
+  GET /joke?lang=en           Tell a fresh joke
+  GET /jokes?lang=en&count=3  Tell several fresh jokes
+  GET /history                List previously told jokes
+  GET /stream?interval=5m     Tell a joke every interval as Server-Sent Events
+  GET /ws                     Tell jokes on request over a WebSocket connection
+  POST /graphql               Query jokes, favorites, tags and stats with GraphQL
+  GET /j/<id>                 Show a stored joke, as linked to by "godad share"
+  GET /openapi.json           The OpenAPI specification of the API
+  GET /docs                   Browse the API with Swagger UI
+  GET /metrics                Prometheus metrics, unless metrics is off
+  GET /healthz                Liveness probe, answers while the server runs
+  GET /readyz                 Readiness probe, checks the database and sources
+
+With require_api_key set, clients have to send a key added with
+"godad serve keys add" as a bearer token or in the X-API-Key header. The
+joke pages and the API documentation stay public.
+
+Each client may make rate_limit requests per minute, counted by API key
+or else by address, and is answered with 429 Too Many Requests beyond
+that. With Redis the counts are shared by every server using it. Behind
+a reverse proxy, list it in trusted_proxies so its X-Forwarded-For header
+tells the clients apart.
+
+The addresses may be TCP addresses like :8080, Unix sockets like
+unix:/run/godad/godad.sock for local clients, or systemd for the socket
+passed by systemd socket activation, systemd:<name> for the one named
+<name> with FileDescriptorName=.
+
+Streams tell a joke every stream_interval, or less often if the client
+asks for a longer interval.
+
+With grpc_addr set, the same jokes are served over gRPC as well, with the
+Jokes service of pkg/api/proto/jokes.proto, the same API keys and rate
+limits.
+
+Web pages from the origins in cors_origins may call the API from the
+browser, and those in frame_ancestors may show the joke pages in a frame.
+
+Changes to the config file apply without a restart, except for the
+address, the storage, Redis, API keys, rate limits, the origins,
+metrics, the stream interval and the gRPC address.`,
+		Args: cobra.NoArgs,
+		RunE: runServe,
+		// Log every request
+		Annotations: map[string]string{logLevelAnnotation: "info"},
+	}
+	serveCmd.Flags().String("addr", ":8080", "Address to listen on, like :8080, unix:/run/godad/godad.sock or systemd")
+	serveCmd.Flags().String("grpc-addr", "", "Address to serve the gRPC API on, like :9090")
+	serveCmd.Flags().Bool("require-api-key", false, "Only answer clients with an API key added with \"godad serve keys add\"")
+	serveCmd.AddCommand(newKeysCmd())
+	return serveCmd
+}
+
+func runServe(cmd *cobra.Command, _ []string) error {
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	// Keys are looked up in the store itself, so revoking a key takes
+	// effect at once even with Redis
+	keys, ok := store.(joke.KeyStore)
+	if viper.GetBool("require_api_key") && !ok {
+		return fmt.Errorf("the %s storage can't keep API keys", viper.GetString("storage"))
+	}
+	proxies, err := trustedProxies()
+	if err != nil {
+		return err
+	}
+	// The store is observed below the cache, so its timings are those of
+	// the database
+	var metrics *server.Metrics
+	if viper.GetBool("metrics") {
+		metrics = server.NewMetrics()
+		store = joke.NewObservedStore(store, metrics)
+	}
+	var limiter server.Limiter = &server.MemoryLimiter{}
+	if url := viper.GetString("redis_url"); url != "" {
+		client, err := newRedisClient(url)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		cache := joke.NewRedisCache(store, client, viper.GetDuration("redis_ttl"))
+		if metrics != nil {
+			cache.Observer = metrics
+		}
+		store = cache
+		limiter = server.NewRedisLimiter(client)
+	}
+
+	engine, err := newEngine(store, viper.GetString("lang"))
+	if err != nil {
+		return err
+	}
+	ctx := cmd.Context()
+	stopRefill := startRefill(ctx, engine)
+	// Requests build their engines from the settings, so only the refill
+	// has to pick up changes
+	watchConfig(cmd, func() error {
+		engine, err := newEngine(store, viper.GetString("lang"))
+		if err != nil {
+			return err
+		}
+		stopRefill()
+		stopRefill = startRefill(ctx, engine)
+		return nil
+	})
+
+	handler := server.New(store, serverEngines(store))
+	if viper.GetBool("require_api_key") {
+		handler.RequireKeys(keys)
+	}
+	handler.LimitRate(limiter, viper.GetInt("rate_limit"))
+	handler.TrustProxies(proxies)
+	handler.AllowOrigins(configList("cors_origins"))
+	handler.AllowFraming(configList("frame_ancestors"))
+	if metrics != nil {
+		handler.ExportMetrics(metrics)
+	}
+	handler.StreamEvery(viper.GetDuration("stream_interval"))
+	lis, err := listen(viper.GetString("addr"))
+	if err != nil {
+		return fmt.Errorf("error listening: %w", err)
+	}
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	srv.RegisterOnShutdown(handler.StopStreams)
+
+	// The gRPC API is served on an address of its own
+	var grpcSrv *grpc.Server
+	var grpcLis net.Listener
+	if addr := viper.GetString("grpc_addr"); addr != "" {
+		if grpcLis, err = listen(addr); err != nil {
+			lis.Close()
+			return fmt.Errorf("error listening for gRPC: %w", err)
+		}
+		grpcSrv = handler.GRPC()
+	}
+
+	errCh := make(chan error, 2)
+	go func() {
+		log.Info().Str("addr", lis.Addr().String()).Msg("Server listening")
+		errCh <- srv.Serve(lis)
+	}()
+	if grpcSrv != nil {
+		go func() {
+			log.Info().Str("addr", grpcLis.Addr().String()).Msg("gRPC server listening")
+			if err := grpcSrv.Serve(grpcLis); err != nil {
+				errCh <- fmt.Errorf("error serving gRPC: %w", err)
+			}
+		}()
+	}
+
+	select {
+	case err := <-errCh:
+		if grpcSrv != nil {
+			grpcSrv.Stop()
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Info().Msg("Shutting down server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if grpcSrv != nil {
+		handler.StopStreams()
+		grpcSrv.GracefulStop()
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// newRedisClient returns a client of the Redis server at url, giving up
+// quickly on requests unless url says otherwise, so a server that is down
+// doesn't slow down every request
+func newRedisClient(url string) (*redis.Client, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing redis_url: %w", err)
+	}
+	for _, timeout := range []*time.Duration{&opts.DialTimeout, &opts.ReadTimeout, &opts.WriteTimeout} {
+		if *timeout == 0 {
+			*timeout = 250 * time.Millisecond
+		}
+	}
+	return redis.NewClient(opts), nil
+}
+
+// trustedProxies returns the addresses of the reverse proxies in
+// trusted_proxies, with single addresses turned into prefixes
+func trustedProxies() ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, v := range configList("trusted_proxies") {
+		if addr, err := netip.ParseAddr(v); err == nil {
+			proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing trusted_proxies: %q is neither an address nor a CIDR range", v)
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+// serverEngines returns the engines for requests, using the configured
+// language when a request does not ask for one
+func serverEngines(store joke.Store) server.EngineFunc {
+	return func(lang string) (*joke.Engine, error) {
+		if lang == "" {
+			lang = viper.GetString("lang")
+		}
+		return newEngine(store, lang)
+	}
+}
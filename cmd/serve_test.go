@@ -0,0 +1,78 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestTrustedProxies(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	viper.Set("trusted_proxies", "10.1.2.3/8, 192.0.2.1,::1")
+	proxies, err := trustedProxies()
+	if err != nil {
+		t.Fatalf("trustedProxies() returned an error: %v", err)
+	}
+	if got := fmt.Sprint(proxies); got != "[10.0.0.0/8 192.0.2.1/32 ::1/128]" {
+		t.Errorf("trustedProxies() = %s, want the ranges and the single addresses", got)
+	}
+
+	viper.Set("trusted_proxies", "proxy.example.com")
+	if _, err := trustedProxies(); err == nil {
+		t.Error("trustedProxies() of a host name returned no error")
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "godad.sock")
+	lis, err := listen("unix:" + path)
+	if err != nil {
+		t.Fatalf("listen() of a Unix socket returned an error: %v", err)
+	}
+	go func(lis net.Listener) {
+		if conn, err := lis.Accept(); err == nil {
+			conn.Close()
+		}
+	}(lis)
+	if _, err := listen("unix:" + path); err == nil {
+		t.Error("listen() of a socket in use returned no error")
+	}
+
+	// A socket left behind by a server that is gone is replaced
+	lis.(*net.UnixListener).SetUnlinkOnClose(false)
+	lis.Close()
+	again, err := listen("unix:" + path)
+	if err != nil {
+		t.Fatalf("listen() of a stale socket returned an error: %v", err)
+	}
+	again.Close()
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("The socket is still there after closing the listener: %v", err)
+	}
+}
+
+func TestListenSystemd(t *testing.T) {
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_PID", "1")
+	if _, err := listen("systemd"); err == nil {
+		t.Error("listen() of sockets passed to another process returned no error")
+	}
+
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDNAMES", "http")
+	if _, err := listen("systemd:grpc"); err == nil {
+		t.Error("listen() of a socket systemd didn't pass returned no error")
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func newShareCmd() *cobra.Command {
+	var (
+		id    int64
+		short bool
+	)
+
+	shareCmd := &cobra.Command{
+		Use:   "share",
+		Short: "Print a link to the last told joke",
+		Long: `Print a link to the last told joke, or the joke given with --id, to share
+it in chats. Jokes from icanhazdadjoke.com link to their page there. Other
+jokes link to their page on the godad server at share_url, which has to
+use the same database, like a server run by the team.
+
+With --short the link is shortened with the link shortener at
+shortener_url.`,
+		Example: `  godad share
+  godad share --id 42 --share-url https://jokes.example.com
+  godad share --short --shortener-url 'https://is.gd/create.php?format=simple&url={url}'`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			shortener := viper.GetString("shortener_url")
+			if short && shortener == "" {
+				return errors.New("set shortener_url to shorten links")
+			}
+
+			store, err := openStore()
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			id, err := jokeIDOrLast(cmd.Context(), store, id)
+			if err != nil {
+				return err
+			}
+			j, err := store.Get(cmd.Context(), id)
+			if err != nil {
+				return err
+			}
+			link, err := joke.ShareURL(j, viper.GetString("share_url"))
+			if errors.Is(err, joke.ErrNoShareURL) {
+				return fmt.Errorf("joke %d is not from icanhazdadjoke.com, set share_url to the address of a godad server to link to it", id)
+			}
+			if err != nil {
+				return err
+			}
+			if short {
+				if link, err = joke.Shorten(cmd.Context(), joke.DefaultHTTPClient, shortener, link); err != nil {
+					return err
+				}
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), link)
+			return nil
+		},
+	}
+
+	shareCmd.Flags().Int64Var(&id, "id", 0, "Local ID of the joke to share, instead of the last told one")
+	shareCmd.Flags().BoolVar(&short, "short", false, "Shorten the link with the link shortener at shortener_url")
+	shareCmd.Flags().String("share-url", "", "Address of the godad server to link to jokes on, like https://jokes.example.com")
+	shareCmd.Flags().String("shortener-url", "", "Link shortener with {url} in place of the link, like https://is.gd/create.php?format=simple&url={url}")
+	return shareCmd
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestShare(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	dbdir := t.TempDir()
+
+	if _, err := runGodad(dbdir, "", "share"); err == nil {
+		t.Error("share without any told joke returned no error")
+	}
+	if _, err := runGodad(dbdir, "", "add", "--lang", "en", "My own joke"); err != nil {
+		t.Fatalf("add returned an error: %v", err)
+	}
+	if _, err := runGodad(dbdir, "", "tell", "--lang", "en", "--offline"); err != nil {
+		t.Fatalf("tell returned an error: %v", err)
+	}
+	if _, err := runGodad(dbdir, "", "share"); err == nil || !strings.Contains(err.Error(), "share_url") {
+		t.Errorf("share of a joke of your own without share_url returned %v, want an error about share_url", err)
+	}
+	out, err := runGodad(dbdir, "", "share", "--share-url", "https://jokes.example.com/")
+	if err != nil || out != "https://jokes.example.com/j/1\n" {
+		t.Errorf("share = %q, %v, want a link to the server", out, err)
+	}
+
+	shortener := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "https://short.example/%d", len(r.URL.Query().Get("url")))
+	}))
+	defer shortener.Close()
+	out, err = runGodad(dbdir, "", "share", "--id", "1", "--short", "--share-url", "https://jokes.example.com", "--shortener-url", shortener.URL+"/?url={url}")
+	if err != nil || out != "https://short.example/29\n" {
+		t.Errorf("share --short = %q, %v, want the short link", out, err)
+	}
+	if _, err := runGodad(dbdir, "", "share", "--short", "--share-url", "https://jokes.example.com"); err == nil {
+		t.Error("share --short without shortener_url returned no error")
+	}
+}
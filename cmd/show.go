@@ -0,0 +1,110 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/cobra"
+)
+
+func newShowCmd() *cobra.Command {
+	var output string
+
+	showCmd := &cobra.Command{
+		Use:   "show <id>",
+		Short: "Show a stored joke",
+		Long: `Show a joke from the database by its local ID, as listed by
+"godad history" and "godad search".`,
+		Example: `  godad show 42
+  godad show 42 --output json`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid joke ID %q", args[0])
+			}
+			if output != "text" && output != "json" {
+				return fmt.Errorf("unknown output format %q, use text or json", output)
+			}
+
+			store, err := openStore()
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			j, err := store.Get(cmd.Context(), id)
+			if err != nil {
+				return err
+			}
+
+			if output == "json" {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(j)
+			}
+			return writeJokeDetails(cmd.OutOrStdout(), j)
+		},
+	}
+
+	showCmd.Flags().StringVarP(&output, "output", "o", "text", "Output format (text, json)")
+	return showCmd
+}
+
+// writeJokeDetails writes a joke followed by its bookkeeping data
+func writeJokeDetails(out io.Writer, j joke.Joke) error {
+	fmt.Fprintf(out, "%s\n\n", j.Text)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "ID:\t%d\n", j.ID)
+	source := j.Source
+	if j.UpstreamID != "" {
+		source += " (" + j.UpstreamID + ")"
+	}
+	fmt.Fprintf(w, "Source:\t%s\n", source)
+	fmt.Fprintf(w, "Language:\t%s\n", j.Language)
+	fmt.Fprintf(w, "Stored:\t%s\n", j.CreatedAt.Local().Format(time.DateTime))
+	told := "not yet"
+	if j.ToldAt != nil {
+		told = fmt.Sprintf("%d times, last on %s", j.TimesTold, j.ToldAt.Local().Format(time.DateTime))
+		if j.TimesTold == 1 {
+			told = "once, on " + j.ToldAt.Local().Format(time.DateTime)
+		}
+	}
+	fmt.Fprintf(w, "Told:\t%s\n", told)
+	rating := "not rated"
+	if j.Rating != 0 {
+		rating = fmt.Sprintf("%d/%d", j.Rating, joke.MaxRating)
+	}
+	fmt.Fprintf(w, "Rating:\t%s\n", rating)
+	if len(j.Tags) > 0 {
+		fmt.Fprintf(w, "Tags:\t%s\n", strings.Join(j.Tags, ", "))
+	}
+	return w.Flush()
+}
+
+// jokeIDOrLast returns id, or the ID of the last told joke if id is zero
+func jokeIDOrLast(ctx context.Context, store joke.Store, id int64) (int64, error) {
+	if id != 0 {
+		return id, nil
+	}
+	last, err := store.History(ctx, joke.HistoryFilter{Limit: 1})
+	if err != nil {
+		return 0, err
+	}
+	if len(last) == 0 {
+		return 0, errors.New("no joke has been told yet")
+	}
+	return last[0].ID, nil
+}
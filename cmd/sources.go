@@ -0,0 +1,582 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/lhaig/godad/pkg/plugin"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func newSourcesCmd() *cobra.Command {
+	sourcesCmd := &cobra.Command{
+		Use:   "sources",
+		Short: "List, test and turn joke sources on and off",
+		Long: `List the joke sources, test them with a live fetch to find out which
+upstream is failing, and enable or disable them in the config file.`,
+	}
+	sourcesCmd.AddCommand(
+		newSourcesListCmd(),
+		newSourcesTestCmd(),
+		newSourcesEnableCmd("enable", true),
+		newSourcesEnableCmd("disable", false),
+	)
+	return sourcesCmd
+}
+
+// sourceInfo describes a source for "godad sources list"
+type sourceInfo struct {
+	Name     string   `json:"name"`
+	Language string   `json:"language"`
+	Enabled  bool     `json:"enabled"`
+	Features []string `json:"features"`
+	// Status sums up Health: "ok", "failing" or "skipped" while the
+	// circuit is open, or "unknown" for sources never fetched from
+	Status string            `json:"status"`
+	Health joke.SourceHealth `json:"health"`
+}
+
+// healthStatus sums up the health of a source for "godad sources list"
+func healthStatus(h joke.SourceHealth, b joke.Breaker, now time.Time) string {
+	switch {
+	case !h.OpenUntil(b, now).IsZero():
+		return "skipped"
+	case h.Failures > 0:
+		return "failing"
+	case h.LastSuccess != nil:
+		return "ok"
+	default:
+		return "unknown"
+	}
+}
+
+// sourceFeatures returns what src can do besides fetching a random joke
+func sourceFeatures(src joke.Source) []string {
+	features := []string{}
+	if _, ok := src.(joke.SearchSource); ok {
+		features = append(features, "search")
+	}
+	if _, ok := src.(joke.IDSource); ok {
+		features = append(features, "id")
+	}
+	if _, ok := src.(joke.BatchSource); ok {
+		features = append(features, "batch")
+	}
+	if _, ok := src.(joke.ListSource); ok {
+		features = append(features, "list")
+	}
+	return features
+}
+
+func newSourcesListCmd() *cobra.Command {
+	var output string
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the joke sources",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if output != "table" && output != "json" {
+				return fmt.Errorf("unknown output format %q, use table or json", output)
+			}
+			registry, err := sourceRegistry()
+			if err != nil {
+				return err
+			}
+			disabled := disabledSources(registry)
+
+			store, err := openStore()
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+			breaker := joke.Breaker{
+				Threshold: viper.GetInt("circuit_breaker_threshold"),
+				Cooldown:  viper.GetDuration("circuit_breaker_cooldown"),
+			}
+
+			var infos []sourceInfo
+			for _, src := range registry.Sources() {
+				// Stores that don't keep track of health have every
+				// source healthy
+				h := joke.SourceHealth{Source: src.Name()}
+				if health, ok := store.(joke.HealthStore); ok {
+					if h, err = health.SourceHealth(cmd.Context(), src.Name()); err != nil {
+						return err
+					}
+				}
+				infos = append(infos, sourceInfo{
+					Name:     src.Name(),
+					Language: src.Language(),
+					Enabled:  !slices.Contains(disabled, src.Name()),
+					Features: sourceFeatures(src),
+					Status:   healthStatus(h, breaker, time.Now()),
+					Health:   h,
+				})
+			}
+
+			if output == "json" {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(infos)
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tLANG\tENABLED\tSTATUS\tFAILURES\tLATENCY\tFEATURES")
+			for _, info := range infos {
+				fmt.Fprintf(w, "%s\t%s\t%t\t%s\t%d\t%s\t%s\n", info.Name, info.Language, info.Enabled, info.Status, info.Health.Failures, info.Health.Latency, strings.Join(info.Features, ","))
+			}
+			return w.Flush()
+		},
+	}
+
+	listCmd.Flags().StringVarP(&output, "output", "o", "table", "Output format (table, json)")
+	return listCmd
+}
+
+// sourceTest is the result of fetching a joke from a source with
+// "godad sources test"
+type sourceTest struct {
+	Name    string        `json:"name"`
+	OK      bool          `json:"ok"`
+	Latency time.Duration `json:"-"`
+	// LatencyMS is Latency in milliseconds, for JSON output
+	LatencyMS int64  `json:"latency_ms"`
+	Joke      string `json:"joke,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// testSource fetches a joke from src within timeout
+func testSource(ctx context.Context, src joke.Source, timeout time.Duration) sourceTest {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	start := time.Now()
+	j, err := src.Fetch(ctx)
+	latency := time.Since(start)
+	result := sourceTest{Name: src.Name(), OK: err == nil, Latency: latency, LatencyMS: latency.Milliseconds(), Joke: j.Text}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func newSourcesTestCmd() *cobra.Command {
+	var output string
+
+	testCmd := &cobra.Command{
+		Use:   "test [name]...",
+		Short: "Fetch a joke from sources and report how they did",
+		Long: `Fetch a joke from each named source, or from every enabled source, and
+report whether it worked and how long it took. The jokes are not stored, but
+the results count towards the health of the sources, so a source skipped
+after failing repeatedly is used again once a test succeeds.`,
+		Example: "  godad sources test\n  godad sources test icanhazdadjoke flachwitze",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != "table" && output != "json" {
+				return fmt.Errorf("unknown output format %q, use table or json", output)
+			}
+			registry, err := sourceRegistry()
+			if err != nil {
+				return err
+			}
+
+			var sources []joke.Source
+			if len(args) == 0 {
+				disabled := disabledSources(registry)
+				for _, src := range registry.Sources() {
+					if !slices.Contains(disabled, src.Name()) {
+						sources = append(sources, src)
+					}
+				}
+			}
+			for _, name := range args {
+				src, ok := registry.Get(name)
+				if !ok {
+					return fmt.Errorf("%w %q", joke.ErrUnknownSource, name)
+				}
+				sources = append(sources, src)
+			}
+
+			store, err := openStore()
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			timeout, timeouts := viper.GetDuration("timeout"), sourceTimeouts(sources)
+			results := make([]sourceTest, len(sources))
+			var wg sync.WaitGroup
+			for i, src := range sources {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					results[i] = testSource(cmd.Context(), src, cmp.Or(timeouts[src.Name()], timeout))
+				}()
+			}
+			wg.Wait()
+
+			// Record the results, so a source that works again is no
+			// longer skipped
+			if health, ok := store.(joke.HealthStore); ok {
+				for i, r := range results {
+					var fetchErr error
+					if !r.OK {
+						fetchErr = errors.New(r.Error)
+					}
+					if err := health.RecordFetch(cmd.Context(), sources[i].Name(), r.Latency, fetchErr); err != nil {
+						return err
+					}
+				}
+			}
+
+			failed := 0
+			for _, r := range results {
+				if !r.OK {
+					failed++
+				}
+			}
+			if output == "json" {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				if err := enc.Encode(results); err != nil {
+					return err
+				}
+			} else {
+				w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+				fmt.Fprintln(w, "NAME\tSTATUS\tLATENCY\tDETAILS")
+				for _, r := range results {
+					status, details := "ok", strings.ReplaceAll(r.Joke, "\n", " ")
+					if !r.OK {
+						status, details = "FAIL", r.Error
+					}
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Name, status, r.Latency.Round(time.Millisecond), details)
+				}
+				if err := w.Flush(); err != nil {
+					return err
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d sources failed", failed, len(results))
+			}
+			return nil
+		},
+	}
+
+	testCmd.Flags().StringVarP(&output, "output", "o", "table", "Output format (table, json)")
+	return testCmd
+}
+
+// newSourcesEnableCmd returns the command enabling or disabling sources
+// by changing disabled_sources in the config file
+func newSourcesEnableCmd(name string, enabled bool) *cobra.Command {
+	return &cobra.Command{
+		Use:     name + " <name>...",
+		Short:   fmt.Sprintf("%s sources in the config file", strings.ToUpper(name[:1])+name[1:]),
+		Example: fmt.Sprintf("  godad sources %s jokeapi-en", name),
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			registry, err := sourceRegistry()
+			if err != nil {
+				return err
+			}
+			names := chainNames(registry)
+			for _, src := range args {
+				if !slices.Contains(names, src) {
+					return fmt.Errorf("%w %q", joke.ErrUnknownSource, src)
+				}
+			}
+
+			file := configFile()
+			disabled := configList("disabled_sources")
+			for _, src := range args {
+				disabled = slices.DeleteFunc(disabled, func(s string) bool { return s == src })
+				if !enabled {
+					disabled = append(disabled, src)
+					continue
+				}
+				// source_<name>_enabled would keep the source disabled
+				if key := "source_" + src + "_enabled"; viper.IsSet(key) && !viper.GetBool(key) {
+					if err := setConfigValue(file, key, "true"); err != nil {
+						return err
+					}
+				}
+			}
+			if err := setConfigValue(file, "disabled_sources", strings.Join(disabled, ",")); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%sd %s in %s\n", strings.ToUpper(name[:1])+name[1:], strings.Join(args, ", "), file)
+			return nil
+		},
+	}
+}
+
+// sourceConfig is an entry of the sources setting, which adds the user's
+// own sources, or of a source registry
+type sourceConfig struct {
+	// Type is the kind of source, "file", "dir", "exec", "http",
+	// "markdown", "llm" or "ollama"
+	Type string `mapstructure:"type" yaml:"type"`
+	// Name identifies the source in fallback chains and other settings.
+	// It defaults to the file, directory or command name without its
+	// extension, and to the type for llm and ollama sources.
+	Name string `mapstructure:"name" yaml:"name"`
+	// Path is the file to read jokes from, or the directory or glob of
+	// files for a dir source
+	Path string `mapstructure:"path" yaml:"path"`
+	// Command is the program an exec source runs, with Args
+	Command string   `mapstructure:"command" yaml:"command"`
+	Args    []string `mapstructure:"args" yaml:"args"`
+	// URL is the JSON API an http source fetches a joke from, with
+	// Headers, the list of a markdown source or the API of an llm or ollama source
+	URL     string            `mapstructure:"url" yaml:"url"`
+	Headers map[string]string `mapstructure:"headers" yaml:"headers"`
+	// Joke, Setup, Punchline and ID are the paths of the fields of the
+	// response holding the joke, see joke.HTTPSource
+	Joke      string `mapstructure:"joke" yaml:"joke"`
+	Setup     string `mapstructure:"setup" yaml:"setup"`
+	Punchline string `mapstructure:"punchline" yaml:"punchline"`
+	ID        string `mapstructure:"id" yaml:"id"`
+	// Key is the API key of an llm source. Environment variables like
+	// ${OPENAI_API_KEY} are expanded.
+	Key string `mapstructure:"key" yaml:"key"`
+	// Model, Prompt and Temperature are what an llm or ollama source asks
+	// for a joke with, see joke.LLMSource
+	Model       string   `mapstructure:"model" yaml:"model"`
+	Prompt      string   `mapstructure:"prompt" yaml:"prompt"`
+	Temperature *float64 `mapstructure:"temperature" yaml:"temperature"`
+	// Lang is the language of the jokes
+	Lang string `mapstructure:"lang" yaml:"lang"`
+}
+
+// customSources returns the sources configured with the sources setting
+// and those of the source registry
+func customSources() ([]joke.Source, error) {
+	var configs []sourceConfig
+	if viper.IsSet("sources") {
+		if err := viper.UnmarshalKey("sources", &configs); err != nil {
+			return nil, fmt.Errorf("error parsing sources: %w", err)
+		}
+	}
+
+	sources := make([]joke.Source, 0, len(configs))
+	for i, c := range configs {
+		src, err := newSource(c)
+		if err != nil {
+			return nil, fmt.Errorf("source %d: %w", i+1, err)
+		}
+		sources = append(sources, src)
+	}
+
+	registered, err := registrySources()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range registered {
+		src, err := newSource(c)
+		if err != nil {
+			return nil, fmt.Errorf("source registry: source %q: %w", c.Name, err)
+		}
+		sources = append(sources, src)
+	}
+	return sources, nil
+}
+
+// newSource returns the source c configures
+func newSource(c sourceConfig) (joke.Source, error) {
+	switch c.Type {
+	case "file":
+		if c.Path == "" {
+			return nil, errors.New("a file source needs a path")
+		}
+		path := expandHome(c.Path)
+		return joke.NewFileSource(sourceName(c.Name, path), path, c.Lang), nil
+	case "dir":
+		if c.Path == "" {
+			return nil, errors.New("a dir source needs a path")
+		}
+		path := expandHome(c.Path)
+		name := c.Name
+		if name == "" {
+			// Name a glob after its directory
+			if strings.ContainsAny(filepath.Base(path), "*?[") {
+				name = sourceName("", filepath.Dir(path))
+			} else {
+				name = sourceName("", path)
+			}
+		}
+		return dirSource(name, path, c.Lang), nil
+	case "exec":
+		if c.Command == "" {
+			return nil, errors.New("an exec source needs a command")
+		}
+		command := expandHome(c.Command)
+		return joke.NewExecSource(sourceName(c.Name, command), c.Lang, command, c.Args...), nil
+	case "http":
+		if c.Name == "" || c.URL == "" {
+			return nil, errors.New("an http source needs a name and a url")
+		}
+		if u, err := url.Parse(c.URL); err != nil || u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("invalid url %q", c.URL)
+		}
+		src := joke.NewHTTPSource(c.Name, c.Lang, c.URL)
+		src.Headers = c.Headers
+		src.IDField = c.ID
+		if c.Joke != "" || c.Setup == "" {
+			src.JokeField = cmp.Or(c.Joke, src.JokeField)
+		} else {
+			if c.Punchline == "" {
+				return nil, errors.New("an http source with a setup needs a punchline")
+			}
+			src.JokeField, src.SetupField, src.PunchlineField = "", c.Setup, c.Punchline
+		}
+		return src, nil
+	case "markdown":
+		if c.Name == "" || c.URL == "" {
+			return nil, errors.New("a markdown source needs a name and a url")
+		}
+		if u, err := url.Parse(c.URL); err != nil || u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("invalid url %q", c.URL)
+		}
+		return joke.NewMarkdownList(c.Name, c.Lang, c.URL), nil
+	case "llm":
+		if c.Model == "" {
+			return nil, errors.New("an llm source needs a model")
+		}
+		src := joke.NewLLMSource(cmp.Or(c.Name, "llm"), c.Lang, cmp.Or(c.URL, joke.OpenAIURL), c.Model)
+		src.Key = os.ExpandEnv(c.Key)
+		src.Prompt = c.Prompt
+		if c.Temperature != nil {
+			src.Temperature = *c.Temperature
+		}
+		return src, nil
+	case "ollama":
+		src := joke.NewOllama(cmp.Or(c.Name, "ollama"), c.Lang, cmp.Or(c.URL, ollamaURL()), c.Model)
+		src.Prompt = c.Prompt
+		if c.Temperature != nil {
+			src.Temperature = *c.Temperature
+		}
+		return src, nil
+	default:
+		return nil, fmt.Errorf("unknown type %q, use file, dir, exec, http, markdown, llm or ollama", c.Type)
+	}
+}
+
+// ollamaURL returns the API of the Ollama server OLLAMA_HOST points at, as
+// host:port or a URL, or "" for the local one
+func ollamaURL() string {
+	host := os.Getenv("OLLAMA_HOST")
+	if host == "" {
+		return ""
+	}
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	return strings.TrimSuffix(host, "/") + "/v1"
+}
+
+// dirSources holds the directory sources in use. They are shared by every
+// engine, like those of the server, so each directory is only parsed and
+// watched once.
+var dirSources = struct {
+	sync.Mutex
+	sources map[[3]string]*joke.DirSource
+}{sources: map[[3]string]*joke.DirSource{}}
+
+// dirSource returns the directory source for the given settings
+func dirSource(name, path, lang string) *joke.DirSource {
+	dirSources.Lock()
+	defer dirSources.Unlock()
+
+	key := [3]string{name, path, lang}
+	src, ok := dirSources.sources[key]
+	if !ok {
+		src = joke.NewDirSource(name, path, lang)
+		dirSources.sources[key] = src
+	}
+	return src
+}
+
+// pluginSources holds the plugins started so far by path, so each plugin
+// is only started once however many engines use it
+var pluginSources = struct {
+	sync.Mutex
+	sources map[string]*plugin.Source
+}{sources: map[string]*plugin.Source{}}
+
+// loadPlugins starts the source plugins in the plugins directory. Plugins
+// that fail to start are logged and left out.
+func loadPlugins() []joke.Source {
+	dir := viper.GetString("plugins_dir")
+	if dir == "" {
+		home, _ := os.UserHomeDir()
+		dir = filepath.Join(configDir(home), "plugins")
+	}
+	paths, err := plugin.Discover(expandHome(dir))
+	if err != nil {
+		log.Warn().Err(err).Str("dir", dir).Msg("Failed to look for plugins")
+		return nil
+	}
+
+	pluginSources.Lock()
+	defer pluginSources.Unlock()
+
+	var sources []joke.Source
+	for _, path := range paths {
+		src, ok := pluginSources.sources[path]
+		if !ok {
+			if src, err = plugin.Load(path); err != nil {
+				log.Warn().Err(err).Msg("Skipping plugin")
+				continue
+			}
+			log.Debug().Str("plugin", path).Str("source", src.Name()).Msg("Loaded plugin")
+			pluginSources.sources[path] = src
+		}
+		sources = append(sources, src)
+	}
+	return sources
+}
+
+// unsafeNameChars matches what may not appear in a source name
+var unsafeNameChars = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// sourceName returns name, or a name made from the file name of path
+func sourceName(name, path string) string {
+	if name != "" {
+		return name
+	}
+	name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return strings.Trim(unsafeNameChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// expandHome replaces a leading ~ in path with the home directory
+func expandHome(path string) string {
+	rest, ok := strings.CutPrefix(path, "~")
+	if !ok || rest != "" && rest[0] != '/' && rest[0] != filepath.Separator {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, rest)
+}
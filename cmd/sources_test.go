@@ -0,0 +1,116 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/viper"
+)
+
+// slowSource is a source that takes delay to fail or tell its joke
+type slowSource struct {
+	delay time.Duration
+	err   error
+}
+
+func (s slowSource) Name() string     { return "slow" }
+func (s slowSource) Language() string { return "en" }
+
+func (s slowSource) Fetch(ctx context.Context) (joke.Joke, error) {
+	select {
+	case <-time.After(s.delay):
+		return joke.Joke{Text: "Setup\nPunchline"}, s.err
+	case <-ctx.Done():
+		return joke.Joke{}, ctx.Err()
+	}
+}
+
+func TestTestSource(t *testing.T) {
+	r := testSource(context.Background(), slowSource{}, time.Second)
+	if !r.OK || r.Joke != "Setup\nPunchline" || r.Error != "" {
+		t.Errorf("testSource() = %+v, want the joke", r)
+	}
+
+	r = testSource(context.Background(), slowSource{err: errors.New("boom")}, time.Second)
+	if r.OK || r.Error != "boom" {
+		t.Errorf("testSource() = %+v, want the error", r)
+	}
+
+	r = testSource(context.Background(), slowSource{delay: time.Second}, 10*time.Millisecond)
+	if r.OK || !strings.Contains(r.Error, "deadline") || r.Latency >= time.Second {
+		t.Errorf("testSource() = %+v, want a timeout", r)
+	}
+}
+
+func TestSourcesEnable(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	viper.SetConfigFile(path)
+
+	run := func(args ...string) error {
+		cmd := newSourcesCmd()
+		cmd.SetArgs(args)
+		cmd.SetOut(io.Discard)
+		return cmd.Execute()
+	}
+	if err := run("disable", "geek-jokes", "jokeapi-cs"); err != nil {
+		t.Fatalf("sources disable returned an error: %v", err)
+	}
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if got := configList("disabled_sources"); strings.Join(got, ",") != "geek-jokes,jokeapi-cs" {
+		t.Errorf("disabled_sources = %v, want geek-jokes and jokeapi-cs", got)
+	}
+
+	viper.Set("source_jokeapi-cs_enabled", false)
+	if err := run("enable", "jokeapi-cs"); err != nil {
+		t.Fatalf("sources enable returned an error: %v", err)
+	}
+	viper.Reset()
+	viper.SetConfigFile(path)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if got := configList("disabled_sources"); strings.Join(got, ",") != "geek-jokes" {
+		t.Errorf("disabled_sources = %v, want geek-jokes", got)
+	}
+	if !viper.GetBool("source_jokeapi-cs_enabled") {
+		t.Errorf("source_jokeapi-cs_enabled is still false")
+	}
+
+	if err := run("disable", "nope"); !errors.Is(err, joke.ErrUnknownSource) {
+		t.Errorf("sources disable nope returned %v, want ErrUnknownSource", err)
+	}
+}
+
+func TestHealthStatus(t *testing.T) {
+	now := time.Now()
+	failed := now.Add(-time.Minute)
+	breaker := joke.Breaker{Threshold: 3, Cooldown: time.Hour}
+
+	tests := []struct {
+		health joke.SourceHealth
+		want   string
+	}{
+		{joke.SourceHealth{}, "unknown"},
+		{joke.SourceHealth{LastSuccess: &now}, "ok"},
+		{joke.SourceHealth{Failures: 2, LastFailure: &failed}, "failing"},
+		{joke.SourceHealth{Failures: 3, LastFailure: &failed}, "skipped"},
+	}
+	for _, tt := range tests {
+		if got := healthStatus(tt.health, breaker, now); got != tt.want {
+			t.Errorf("healthStatus(%+v) = %q, want %q", tt.health, got, tt.want)
+		}
+	}
+}
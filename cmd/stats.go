@@ -0,0 +1,214 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/cobra"
+)
+
+// sparks are the bars of a sparkline, from lowest to highest
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+func newStatsCmd() *cobra.Command {
+	var (
+		output string
+		days   int
+		weeks  int
+		top    int
+	)
+
+	statsCmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Show how many jokes you told and your daily streak",
+		Long: `Show how many jokes were told, on each of the last days and in each of the
+last weeks, the current and best daily streak, the sources and languages
+the jokes came from and how long they were on average.
+
+Every time a joke is told is counted. Jokes told before godad kept count
+are counted once, when they were last told. For the size and the tables
+of the database, see "godad db stats".`,
+		Example: `  godad stats
+  godad stats --output sparkline --days 30
+  godad stats --output json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if output != "table" && output != "sparkline" && output != "json" {
+				return fmt.Errorf("unknown output format %q, use table, sparkline or json", output)
+			}
+			if days < 0 || weeks < 0 || top < 0 {
+				return errors.New("days, weeks and top can't be negative")
+			}
+			store, err := openStoreAs[joke.StatsStore]("keep statistics")
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			tellings, err := store.Tellings(cmd.Context())
+			if err != nil {
+				return err
+			}
+			stats := joke.NewStats(tellings, time.Now(), days, weeks)
+			out := cmd.OutOrStdout()
+			switch output {
+			case "json":
+				enc := json.NewEncoder(out)
+				enc.SetIndent("", "  ")
+				return enc.Encode(stats)
+			case "sparkline":
+				writeStatsSparklines(out, stats, top)
+				return nil
+			}
+			return writeStatsTables(out, stats, top)
+		},
+	}
+
+	statsCmd.Flags().StringVarP(&output, "output", "o", "table", "Output format (table, sparkline, json)")
+	statsCmd.Flags().IntVar(&days, "days", 14, "Number of days to count the jokes of")
+	statsCmd.Flags().IntVar(&weeks, "weeks", 8, "Number of weeks to count the jokes of")
+	statsCmd.Flags().IntVar(&top, "top", 5, "Number of sources to list")
+	return statsCmd
+}
+
+// writeStatsSummary writes the totals of stats
+func writeStatsSummary(out io.Writer, stats joke.Stats) {
+	fmt.Fprintf(out, "Jokes told:     %d, %d different\n", stats.Told, stats.Jokes)
+	fmt.Fprintf(out, "Daily streak:   %s, best %s\n", plural(stats.Streak, "day"), plural(stats.BestStreak, "day"))
+	fmt.Fprintf(out, "Average length: %.0f characters\n", stats.AverageLength)
+}
+
+// writeStatsTables writes stats as tables, listing the top sources
+func writeStatsTables(out io.Writer, stats joke.Stats, top int) error {
+	writeStatsSummary(out, stats)
+	for _, table := range []struct {
+		header string
+		counts []joke.DayCount
+	}{
+		{"DAY\tTOLD", stats.Days},
+		{"WEEK OF\tTOLD", stats.Weeks},
+	} {
+		if len(table.counts) == 0 {
+			continue
+		}
+		fmt.Fprintln(out)
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, table.header)
+		for _, c := range table.counts {
+			fmt.Fprintf(w, "%s\t%d\n", c.Date, c.Count)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	for _, table := range []struct {
+		header string
+		counts []joke.NameCount
+	}{
+		{"SOURCE\tTOLD\tSHARE", topCounts(stats.Sources, top)},
+		{"LANGUAGE\tTOLD\tSHARE", stats.Languages},
+	} {
+		if len(table.counts) == 0 {
+			continue
+		}
+		fmt.Fprintln(out)
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, table.header)
+		for _, c := range table.counts {
+			fmt.Fprintf(w, "%s\t%d\t%.0f%%\n", c.Name, c.Count, share(c.Count, stats.Told))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeStatsSparklines writes stats in a few lines, with the jokes told
+// per day and week as sparklines
+func writeStatsSparklines(out io.Writer, stats joke.Stats, top int) {
+	writeStatsSummary(out, stats)
+	for _, line := range []struct {
+		label  string
+		counts []joke.DayCount
+	}{
+		{"Last " + plural(len(stats.Days), "day") + ":", stats.Days},
+		{"Last " + plural(len(stats.Weeks), "week") + ":", stats.Weeks},
+	} {
+		if len(line.counts) == 0 {
+			continue
+		}
+		counts := make([]int, len(line.counts))
+		most := 0
+		for i, c := range line.counts {
+			counts[i] = c.Count
+			most = max(most, c.Count)
+		}
+		fmt.Fprintf(out, "%-15s %s  (up to %d, from %s)\n", line.label, sparkline(counts), most, line.counts[0].Date)
+	}
+	for _, line := range []struct {
+		label  string
+		counts []joke.NameCount
+	}{
+		{"Sources:", topCounts(stats.Sources, top)},
+		{"Languages:", stats.Languages},
+	} {
+		if len(line.counts) == 0 {
+			continue
+		}
+		shares := make([]string, len(line.counts))
+		for i, c := range line.counts {
+			shares[i] = fmt.Sprintf("%s %.0f%%", c.Name, share(c.Count, stats.Told))
+		}
+		fmt.Fprintf(out, "%-15s %s\n", line.label, strings.Join(shares, ", "))
+	}
+}
+
+// sparkline draws counts as bars scaled to the highest count. Only zero
+// counts get the lowest bar.
+func sparkline(counts []int) string {
+	most := 0
+	for _, c := range counts {
+		most = max(most, c)
+	}
+	var b strings.Builder
+	for _, c := range counts {
+		level := 0
+		if c > 0 {
+			// Rounded up, so every count but zero gets a higher bar
+			level = (c*(len(sparks)-1) + most - 1) / most
+		}
+		b.WriteRune(sparks[level])
+	}
+	return b.String()
+}
+
+// topCounts returns the first n counts
+func topCounts(counts []joke.NameCount, n int) []joke.NameCount {
+	return counts[:min(n, len(counts))]
+}
+
+// share returns n as a percentage of total
+func share(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(total)
+}
+
+// plural returns n with word, adding an s unless n is 1
+func plural(n int, word string) string {
+	if n == 1 {
+		return "1 " + word
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/viper"
+)
+
+func TestSparkline(t *testing.T) {
+	for _, tc := range []struct {
+		counts []int
+		want   string
+	}{
+		{counts: []int{0, 1, 2, 7}, want: "▁▂▃█"},
+		{counts: []int{0, 0}, want: "▁▁"},
+		{counts: []int{1, 100}, want: "▂█"},
+		{counts: nil, want: ""},
+	} {
+		if got := sparkline(tc.counts); got != tc.want {
+			t.Errorf("sparkline(%v) = %q, want %q", tc.counts, got, tc.want)
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	dbdir := t.TempDir()
+
+	if _, err := runGodad(dbdir, "Joke one\n\nJoke two", "add", "--lang", "en"); err != nil {
+		t.Fatalf("add returned an error: %v", err)
+	}
+	for range 3 {
+		if _, err := runGodad(dbdir, "", "tell", "--lang", "en", "--offline"); err != nil {
+			t.Fatalf("tell returned an error: %v", err)
+		}
+	}
+
+	out, err := runGodad(dbdir, "", "stats", "--output", "json", "--days", "2")
+	if err != nil {
+		t.Fatalf("stats returned an error: %v", err)
+	}
+	var stats joke.Stats
+	if err := json.Unmarshal([]byte(out), &stats); err != nil {
+		t.Fatalf("stats printed %q, want JSON: %v", out, err)
+	}
+	if stats.Told != 3 || stats.Jokes != 2 || stats.Streak != 1 || len(stats.Days) != 2 || stats.Days[1].Count != 3 {
+		t.Errorf("stats = %+v, want 3 tellings of 2 jokes today", stats)
+	}
+
+	out, err = runGodad(dbdir, "", "stats")
+	if err != nil {
+		t.Fatalf("stats returned an error: %v", err)
+	}
+	for _, want := range []string{"Jokes told:     3, 2 different", "Daily streak:   1 day, best 1 day", "WEEK OF", "user    3     100%"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("stats printed %q, want it to contain %q", out, want)
+		}
+	}
+	out, err = runGodad(dbdir, "", "stats", "--output", "sparkline", "--weeks", "0")
+	if err != nil {
+		t.Fatalf("stats returned an error: %v", err)
+	}
+	if !strings.Contains(out, "Last 14 days:   ▁▁▁▁▁▁▁▁▁▁▁▁▁█  (up to 3") || strings.Contains(out, "week") {
+		t.Errorf("stats --output sparkline printed %q, want a sparkline of days only", out)
+	}
+	if _, err := runGodad(dbdir, "", "stats", "--output", "chart"); err == nil {
+		t.Error("stats --output chart returned no error")
+	}
+}
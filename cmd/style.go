@@ -0,0 +1,181 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	figure "github.com/common-nighthawk/go-figure"
+	"github.com/fatih/color"
+	"github.com/lhaig/godad/pkg/joke"
+)
+
+// bannerWidth is the widest a line of banner lettering may get
+const bannerWidth = 80
+
+// themes color text for the terminal. Colors are left out when NO_COLOR
+// is set or stdout is not a terminal.
+var themes = map[string]func(string) string{
+	"plain":   func(text string) string { return text },
+	"rainbow": rainbow,
+	"pastel":  pastel,
+}
+
+// themeNames returns the names of the themes, sorted
+func themeNames() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// style decides how jokes look in text output
+type style struct {
+	theme  func(string) string
+	banner bool
+}
+
+// newStyle returns the style with the named theme, rendering punchlines in
+// banner lettering when banner is set
+func newStyle(theme string, banner bool) (style, error) {
+	if theme == "" {
+		theme = "plain"
+	}
+	fn, ok := themes[theme]
+	if !ok {
+		return style{}, fmt.Errorf("unknown theme %q, use %s", theme, strings.Join(themeNames(), ", "))
+	}
+	return style{theme: fn, banner: banner}, nil
+}
+
+// joke returns a whole joke, ready to print
+func (s style) joke(text string) string {
+	if !s.banner {
+		return s.setup(text)
+	}
+	setup, punchline := joke.SplitJoke(text)
+	if punchline == "" {
+		return s.punchline(text)
+	}
+	return s.setup(setup) + s.punchline(punchline)
+}
+
+// setup returns the setup of a joke, or any other line of text, ready to
+// print
+func (s style) setup(text string) string {
+	return s.theme(text) + "\n"
+}
+
+// punchline returns the punchline of a joke ready to print, in banner
+// lettering if enabled
+func (s style) punchline(text string) string {
+	if s.banner {
+		text = strings.TrimRight(renderBanner(text), "\n")
+	}
+	return s.setup(text)
+}
+
+// bannerReplacer spells out letters the banner font doesn't have
+var bannerReplacer = strings.NewReplacer(
+	"ä", "ae", "ö", "oe", "ü", "ue", "Ä", "Ae", "Ö", "Oe", "Ü", "Ue", "ß", "ss",
+	"’", "'", "‘", "'", "“", `"`, "”", `"`, "…", "...", "–", "-", "—", "-",
+)
+
+// renderBanner renders text in large ASCII lettering, breaking it between
+// words so lines don't get wider than bannerWidth
+func renderBanner(text string) string {
+	var (
+		out  strings.Builder
+		line []string
+	)
+	flush := func() {
+		if len(line) > 0 {
+			out.WriteString(figure.NewFigure(strings.Join(line, " "), "", false).String())
+			line = nil
+		}
+	}
+	for _, word := range strings.Fields(bannerReplacer.Replace(text)) {
+		if len(line) > 0 && bannerLineWidth(append(slices.Clone(line), word)) > bannerWidth {
+			flush()
+		}
+		line = append(line, word)
+	}
+	flush()
+	return out.String()
+}
+
+// bannerLineWidth returns how wide words are in banner lettering
+func bannerLineWidth(words []string) int {
+	width := 0
+	for _, row := range figure.NewFigure(strings.Join(words, " "), "", false).Slicify() {
+		width = max(width, len(row))
+	}
+	return width
+}
+
+// rainbow colors every character, with the colors running diagonally
+// across the text
+func rainbow(text string) string {
+	return colorRunes(text, func(row, col int) *color.Color {
+		return hsv(float64(row*8+col*4), 0.9, 1)
+	})
+}
+
+// pastel colors every line in a soft color, going round the color wheel
+func pastel(text string) string {
+	return colorRunes(text, func(row, _ int) *color.Color {
+		return hsv(float64(row*40+200), 0.35, 1)
+	})
+}
+
+// colorRunes colors every character of text with the color returned for
+// its row and column
+func colorRunes(text string, colorAt func(row, col int) *color.Color) string {
+	var b strings.Builder
+	for row, line := range strings.Split(text, "\n") {
+		if row > 0 {
+			b.WriteByte('\n')
+		}
+		col := 0
+		for _, r := range line {
+			if r == ' ' {
+				b.WriteRune(r)
+			} else {
+				b.WriteString(colorAt(row, col).Sprint(string(r)))
+			}
+			col++
+		}
+	}
+	return b.String()
+}
+
+// hsv returns the true color with the given hue in degrees, saturation and
+// value
+func hsv(h, s, v float64) *color.Color {
+	h = math.Mod(h, 360) / 60
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(h, 2)-1))
+	var r, g, b float64
+	switch int(h) {
+	case 0:
+		r, g = c, x
+	case 1:
+		r, g = x, c
+	case 2:
+		g, b = c, x
+	case 3:
+		g, b = x, c
+	case 4:
+		r, b = x, c
+	default:
+		r, b = c, x
+	}
+	m := v - c
+	return color.RGB(int((r+m)*255), int((g+m)*255), int((b+m)*255))
+}
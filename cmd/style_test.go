@@ -0,0 +1,49 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+)
+
+func TestRenderBanner(t *testing.T) {
+	banner := renderBanner("Weil die Bären keine Schuhe tragen, gehen sie barfuß.")
+	for _, line := range strings.Split(banner, "\n") {
+		if len(line) > bannerWidth {
+			t.Errorf("Banner line is %d characters wide, want at most %d:\n%s", len(line), bannerWidth, banner)
+			break
+		}
+	}
+	if strings.Contains(banner, "?") {
+		t.Errorf("Banner has letters the font doesn't know:\n%s", banner)
+	}
+}
+
+func TestThemes(t *testing.T) {
+	if _, err := newStyle("neon", false); err == nil {
+		t.Error("newStyle() accepted an unknown theme")
+	}
+
+	noColor := color.NoColor
+	defer func() { color.NoColor = noColor }()
+
+	for _, name := range themeNames() {
+		st, err := newStyle(name, false)
+		if err != nil {
+			t.Fatalf("newStyle(%q) returned an error: %v", name, err)
+		}
+
+		color.NoColor = true
+		if got := st.joke("A joke\nin two lines"); got != "A joke\nin two lines\n" {
+			t.Errorf("Theme %s without colors printed %q", name, got)
+		}
+		color.NoColor = false
+		if got := st.joke("A joke"); (name == "plain") == strings.Contains(got, "\x1b[") {
+			t.Errorf("Theme %s printed %q", name, got)
+		}
+	}
+}
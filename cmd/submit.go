@@ -0,0 +1,172 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/cobra"
+)
+
+func newSubmitCmd() *cobra.Command {
+	var (
+		yes   bool
+		force bool
+		list  bool
+	)
+
+	submitCmd := &cobra.Command{
+		Use:   "submit <id|joke>",
+		Short: "Submit a joke to icanhazdadjoke.com",
+		Long: `Submit one of your jokes to icanhazdadjoke.com, so everyone gets to hear
+it. Name a stored joke by its local ID, or give the text of a new joke,
+which is added to the database as well. Submitted jokes are reviewed
+before they are published.
+
+icanhazdadjoke.com doesn't confirm submissions, so godad only knows
+whether a joke was sent, not whether it was accepted: look for it on the
+site once it has been reviewed.
+
+godad remembers which jokes were sent, so each is only submitted once.
+List them with --list.`,
+		Example: `  godad submit 42
+  godad submit "I'm reading a book about anti-gravity. It's impossible to put down."
+  godad submit --list`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if list {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.ExactArgs(1)(cmd, args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := openStoreAs[joke.SubmissionStore]("remember submissions")
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			if list {
+				return writeSubmissions(cmd, store)
+			}
+
+			j, err := submissionJoke(cmd, store, args[0])
+			if err != nil {
+				return err
+			}
+			return submit(cmd, store, joke.NewICanHazDadJoke(), j, yes, force)
+		},
+	}
+
+	submitCmd.Flags().BoolVarP(&yes, "yes", "y", false, "Submit without asking for confirmation")
+	submitCmd.Flags().BoolVar(&force, "force", false, "Submit the joke again, even if it was submitted before")
+	submitCmd.Flags().BoolVar(&list, "list", false, "List the submitted jokes")
+	return submitCmd
+}
+
+// submissionJoke returns the stored joke with the local ID arg, or the
+// joke with the text arg, which is added as a user joke unless stored
+func submissionJoke(cmd *cobra.Command, store joke.SubmissionStore, arg string) (joke.Joke, error) {
+	if id, err := strconv.ParseInt(arg, 10, 64); err == nil {
+		return store.Get(cmd.Context(), id)
+	}
+
+	j := joke.Joke{Text: strings.TrimSpace(arg), Source: joke.UserSourceName, Language: "en"}
+	if j.Text == "" {
+		return joke.Joke{}, errors.New("the joke is empty")
+	}
+	stored, err := store.Find(cmd.Context(), j)
+	if err == nil {
+		return stored, nil
+	}
+	if !errors.Is(err, joke.ErrNotFound) {
+		return joke.Joke{}, err
+	}
+	if err := store.Save(cmd.Context(), &j); err != nil {
+		return joke.Joke{}, fmt.Errorf("error adding joke: %w", err)
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Added joke %d\n", j.ID)
+	return j, nil
+}
+
+// submit submits j to target after asking for confirmation, and records
+// the outcome in store
+func submit(cmd *cobra.Command, store joke.SubmissionStore, target joke.Submitter, j joke.Joke, yes, force bool) error {
+	if j.Source == target.Name() {
+		return fmt.Errorf("joke %d came from %s", j.ID, target.Name())
+	}
+	if !force {
+		subs, err := store.Submissions(cmd.Context())
+		if err != nil {
+			return err
+		}
+		for _, sub := range subs {
+			if sub.JokeID == j.ID && sub.Target == target.Name() && sub.Error == "" {
+				return fmt.Errorf("joke %d was sent to %s on %s already, use --force to submit it again", j.ID, target.Name(), sub.SubmittedAt.Local().Format(time.DateOnly))
+			}
+		}
+	}
+
+	out := cmd.OutOrStdout()
+	if !yes {
+		fmt.Fprintf(out, "%s\n\nSubmit joke %d to %s? [y/N] ", j.Text, j.ID, target.Name())
+		if !confirmed(bufio.NewReader(cmd.InOrStdin())) {
+			fmt.Fprintln(out, "Not submitted")
+			return nil
+		}
+	}
+
+	submitErr := target.Submit(cmd.Context(), j)
+	sub := joke.Submission{JokeID: j.ID, Target: target.Name(), SubmittedAt: time.Now()}
+	if submitErr != nil {
+		sub.Error = submitErr.Error()
+	}
+	if err := store.RecordSubmission(cmd.Context(), sub); err != nil {
+		return errors.Join(submitErr, err)
+	}
+	if submitErr != nil {
+		return fmt.Errorf("error submitting joke %d: %w", j.ID, submitErr)
+	}
+	fmt.Fprintf(out, "Sent joke %d to %s, which doesn't confirm whether it was accepted\n", j.ID, target.Name())
+	return nil
+}
+
+// writeSubmissions lists the submitted jokes and whether they were sent.
+// Whether they were accepted isn't known.
+func writeSubmissions(cmd *cobra.Command, store joke.SubmissionStore) error {
+	subs, err := store.Submissions(cmd.Context())
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTARGET\tSUBMITTED\tSTATUS\tJOKE")
+	for _, sub := range subs {
+		status := "sent, unconfirmed"
+		if sub.Error != "" {
+			status = "failed: " + sub.Error
+		}
+		text := ""
+		if j, err := store.Get(cmd.Context(), sub.JokeID); err == nil {
+			text = truncate(strings.ReplaceAll(j.Text, "\n", " "), 50)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", sub.JokeID, sub.Target, sub.SubmittedAt.Local().Format(time.DateTime), status, text)
+	}
+	return w.Flush()
+}
+
+// truncate shortens s to at most n characters, marking the cut with an
+// ellipsis
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// fakeSubmitter records the jokes submitted to it
+type fakeSubmitter struct {
+	submitted []string
+	err       error
+}
+
+func (s *fakeSubmitter) Name() string { return "fake" }
+
+func (s *fakeSubmitter) Submit(_ context.Context, j joke.Joke) error {
+	s.submitted = append(s.submitted, j.Text)
+	return s.err
+}
+
+func TestSubmit(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("dbdir", t.TempDir())
+	store, err := openSQLite()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	cmd := &cobra.Command{}
+	cmd.SetContext(context.Background())
+	var out strings.Builder
+	cmd.SetOut(&out)
+	cmd.SetIn(strings.NewReader("n\n"))
+
+	j, err := submissionJoke(cmd, store, "My very own joke")
+	if err != nil || j.ID == 0 || j.Source != joke.UserSourceName {
+		t.Fatalf("submissionJoke() = %+v, %v, want the joke added", j, err)
+	}
+	target := &fakeSubmitter{err: errors.New("boom")}
+	if err := submit(cmd, store, target, j, false, false); err != nil || len(target.submitted) != 0 {
+		t.Errorf("submit() without confirmation = %v and submitted %v, want nothing submitted", err, target.submitted)
+	}
+	if err := submit(cmd, store, target, j, true, false); err == nil {
+		t.Error("submit() returned no error for a failed submission")
+	}
+	target.err = nil
+	if err := submit(cmd, store, target, j, true, false); err != nil {
+		t.Fatalf("submit() returned an error: %v", err)
+	}
+	if err := submit(cmd, store, target, j, true, false); err == nil {
+		t.Error("submit() submitted a joke twice")
+	}
+	if err := submit(cmd, store, target, j, true, true); err != nil {
+		t.Errorf("submit() with force returned an error: %v", err)
+	}
+	if len(target.submitted) != 3 {
+		t.Errorf("submitted %v, want the joke three times", target.submitted)
+	}
+
+	// Nothing confirms that the joke was accepted
+	out.Reset()
+	if err := writeSubmissions(cmd, store); err != nil || !strings.Contains(out.String(), "sent, unconfirmed") || strings.Contains(out.String(), "failed") {
+		t.Errorf("writeSubmissions() = %v and printed %q, want the joke sent, unconfirmed", err, out.String())
+	}
+
+	if again, err := submissionJoke(cmd, store, "1"); err != nil || again.ID != j.ID {
+		t.Errorf("submissionJoke() by ID = %+v, %v, want the added joke", again, err)
+	}
+	if err := submit(cmd, store, target, joke.Joke{ID: 9, Text: "x", Source: "fake"}, true, false); err == nil {
+		t.Error("submit() submitted a joke back to where it came from")
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/cobra"
+)
+
+func newTagCmd() *cobra.Command {
+	tagCmd := &cobra.Command{
+		Use:   "tag",
+		Short: "Tag jokes",
+		Long: `Tag jokes to find them again with "godad tell --tag" and
+"godad history --tag". Jokes told with "godad tell --term" are tagged with
+the search term automatically.`,
+	}
+	tagCmd.AddCommand(
+		newTagChangeCmd("add", "Tag the last told joke", func(cmd *cobra.Command, store joke.Store, id int64, tags []string) error {
+			return store.AddTags(cmd.Context(), id, tags...)
+		}),
+		newTagChangeCmd("remove", "Remove tags from the last told joke", func(cmd *cobra.Command, store joke.Store, id int64, tags []string) error {
+			return store.RemoveTags(cmd.Context(), id, tags...)
+		}),
+		newTagListCmd(),
+	)
+	return tagCmd
+}
+
+// newTagChangeCmd returns a command changing the tags of a single joke
+func newTagChangeCmd(name, short string, change func(cmd *cobra.Command, store joke.Store, id int64, tags []string) error) *cobra.Command {
+	var id int64
+
+	changeCmd := &cobra.Command{
+		Use:     name + " <tag>...",
+		Short:   short,
+		Example: fmt.Sprintf("  godad tag %s puns\n  godad tag %s animals --id 42", name, name),
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := openStore()
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			id, err := jokeIDOrLast(cmd.Context(), store, id)
+			if err != nil {
+				return err
+			}
+			if err := change(cmd, store, id, args); err != nil {
+				return err
+			}
+
+			j, err := store.Get(cmd.Context(), id)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Joke %d tags: %s\n", id, strings.Join(j.Tags, ", "))
+			return nil
+		},
+	}
+
+	changeCmd.Flags().Int64Var(&id, "id", 0, "Local ID of the joke, instead of the last told one")
+	return changeCmd
+}
+
+func newTagListCmd() *cobra.Command {
+	var output string
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List tags and how many jokes have them",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if output != "table" && output != "json" {
+				return fmt.Errorf("unknown output format %q, use table or json", output)
+			}
+
+			store, err := openStore()
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			tags, err := store.Tags(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			if output == "json" {
+				if tags == nil {
+					tags = []joke.TagCount{}
+				}
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(tags)
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "TAG\tJOKES")
+			for _, t := range tags {
+				fmt.Fprintf(w, "%s\t%d\n", t.Name, t.Jokes)
+			}
+			return w.Flush()
+		},
+	}
+
+	listCmd.Flags().StringVarP(&output, "output", "o", "table", "Output format (table, json)")
+	return listCmd
+}
@@ -0,0 +1,612 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/lhaig/godad/internal/notify"
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func newTellCmd() *cobra.Command {
+	tellCmd := &cobra.Command{
+		Use:   "tell",
+		Short: "Tell a fresh dad joke",
+		Example: `  godad tell
+  godad tell --lang de
+  godad tell --term pizza
+  godad tell --id R7UfaahVfFd
+  godad tell --tag puns
+  godad tell --notify
+  godad tell --punchline-delay 3s
+  godad tell --banner --theme rainbow
+  godad tell --count 5
+  godad tell --no-store
+  godad tell --kid-safe --max-length 120
+  godad tell --cached-max-age 1h
+  godad tell --output json
+  godad tell --format '{{.Joke}} — via {{.Source}}'`,
+		Args: cobra.NoArgs,
+		RunE: runTell,
+	}
+	addTellFlags(tellCmd)
+	return tellCmd
+}
+
+// addTellFlags registers the flags of the tell command. The root command
+// tells a joke too, so it shares the same flags.
+func addTellFlags(cmd *cobra.Command) {
+	addEngineFlags(cmd)
+	cmd.Flags().String("term", "", "Tell a joke about this topic, searched for upstream")
+	cmd.Flags().String("id", "", "Tell the joke with this upstream ID")
+	cmd.Flags().String("tag", "", "Tell a stored joke with this tag")
+	cmd.Flags().Duration("cached-max-age", 0, "Tell a stored joke instantly, keeping it for this long and refreshing in the background, e.g. 1h")
+	cmd.MarkFlagsMutuallyExclusive("term", "id", "tag", "cached-max-age")
+	cmd.Flags().Int("count", 1, "Number of fresh jokes to tell")
+	cmd.Flags().String("separator", "---", "Line printed between jokes with --count")
+	for _, other := range []string{"term", "id", "cached-max-age"} {
+		cmd.MarkFlagsMutuallyExclusive("count", other)
+	}
+	cmd.Flags().Bool("no-store", false, "Don't remember the joke in the database, e.g. for demos")
+	cmd.Flags().Bool("store-only", false, "Store fresh jokes for later without printing them, like prefetch")
+	for _, other := range []string{"no-store", "term", "id", "tag", "cached-max-age"} {
+		cmd.MarkFlagsMutuallyExclusive("store-only", other)
+	}
+	addPrintFlags(cmd)
+	cmd.Flags().Duration("punchline-delay", 0, "Print the setup, then wait this long before the punchline, e.g. 3s")
+	cmd.Flags().Bool("interactive", false, "Print the setup, then wait for Enter before the punchline")
+	cmd.Flags().String("notify", "false", "Also raise a desktop notification with the joke, or only that with --notify=only")
+	cmd.Flags().Lookup("notify").NoOptDefVal = "true"
+}
+
+// addPrintFlags registers the flags for how printJoke prints the joke
+func addPrintFlags(cmd *cobra.Command) {
+	cmd.Flags().StringP("output", "o", "text", "Output format (text, json)")
+	cmd.Flags().String("format", "", "Go template for text output, e.g. '{{.Joke}} — via {{.Source}}'")
+	cmd.Flags().Bool("banner", false, "Print the punchline in large ASCII lettering")
+	cmd.Flags().String("theme", "plain", "Color theme ("+strings.Join(themeNames(), ", ")+")")
+}
+
+// addEngineFlags registers the flags read by newEngine, for commands that
+// tell jokes
+func addEngineFlags(cmd *cobra.Command) {
+	langs := strings.Join(languages(joke.DefaultRegistry()), ", ")
+	cmd.Flags().String("lang", autoLanguage, "Language of the joke ("+langs+"), auto for the language of the locale, or several like en,de or all to mix them")
+	cmd.Flags().Bool("offline", false, "Only tell jokes from the local database, without any network calls")
+	cmd.Flags().String("repeat-after", "", "Tell jokes again once they were last told this long ago, e.g. 90d")
+	cmd.Flags().Bool("kid-safe", false, "Only tell jokes fit for children and shared screens")
+	cmd.Flags().Int("min-length", 0, "Only tell jokes with at least this many characters")
+	cmd.Flags().Int("max-length", 0, "Only tell jokes with at most this many characters, e.g. 120 for a shell prompt")
+	cmd.Flags().String("exclude", "", "Comma separated list of words the joke must not contain")
+}
+
+// runTell prints a joke that has not been told before, falling back to a
+// random joke from the database when the API is unavailable
+func runTell(cmd *cobra.Command, _ []string) error {
+	output, _ := cmd.Flags().GetString("output")
+	if output != "text" && output != "json" {
+		return fmt.Errorf("unknown output format %q, use text or json", output)
+	}
+	notifyMode := viper.GetString("notify")
+	if notifyMode != "true" && notifyMode != "false" && notifyMode != "only" && notifyMode != "" {
+		return fmt.Errorf("unknown notify setting %q, use true, false or only", notifyMode)
+	}
+	var tmpl *template.Template
+	if format := viper.GetString("format"); format != "" && output == "text" {
+		var err error
+		if tmpl, err = parseFormat(format); err != nil {
+			return err
+		}
+	}
+
+	st, err := newStyle(viper.GetString("theme"), viper.GetBool("banner"))
+	if err != nil {
+		return err
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	unlock, err := lockStore(cmd.Context())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	term, _ := cmd.Flags().GetString("term")
+	id, _ := cmd.Flags().GetString("id")
+	tag, _ := cmd.Flags().GetString("tag")
+	storeOnly, _ := cmd.Flags().GetBool("store-only")
+
+	count, _ := cmd.Flags().GetInt("count")
+	if count < 1 {
+		return fmt.Errorf("count must be at least 1, got %d", count)
+	}
+	maxAge := viper.GetDuration("cached_max_age")
+	cached := maxAge > 0 && term == "" && id == "" && tag == "" && count == 1 && !storeOnly
+
+	var engineStore joke.Store = store
+	if noStore, _ := cmd.Flags().GetBool("no-store"); noStore {
+		engineStore = joke.NewReadOnlyStore(store)
+	}
+	newTellEngine := newEngine
+	if cached {
+		newTellEngine = newCachedEngine
+	}
+	engine, err := newTellEngine(engineStore, viper.GetString("lang"))
+	if err != nil {
+		return err
+	}
+	engine.Tag = tag
+
+	if storeOnly {
+		n, err := engine.Prefetch(cmd.Context(), count, nil)
+		log.Info().Int("count", n).Msg("Stored jokes for later")
+		return err
+	}
+
+	var jokes []joke.Joke
+	switch {
+	case term != "":
+		j, err := engine.TellAbout(cmd.Context(), term)
+		if err != nil {
+			return err
+		}
+		jokes = append(jokes, j)
+	case id != "":
+		j, err := engine.TellByID(cmd.Context(), id)
+		if err != nil {
+			return err
+		}
+		jokes = append(jokes, j)
+	case cached:
+		j, low, err := engine.TellCached(cmd.Context(), maxAge)
+		if err != nil {
+			return err
+		}
+		if low && !engine.Offline {
+			if err := refreshInBackground(engine.Language); err != nil {
+				log.Warn().Err(err).Msg("Could not refresh the joke cache")
+			}
+		}
+		jokes = append(jokes, j)
+	default:
+		jokes, err = engine.TellMany(cmd.Context(), count)
+		if len(jokes) == 0 {
+			return err
+		}
+		if err != nil {
+			log.Warn().Err(err).Msgf("Could only tell %d of %d jokes", len(jokes), count)
+		}
+	}
+
+	out := cmd.OutOrStdout()
+	separator, _ := cmd.Flags().GetString("separator")
+	for i, j := range jokes {
+		if i > 0 && output == "text" {
+			fmt.Fprintln(out, separator)
+		}
+
+		if notifyMode == "true" || notifyMode == "only" {
+			if err := notify.Send(cmd.Context(), notify.DefaultTitle, j.Text); err != nil {
+				// Print the joke instead, so it isn't lost
+				log.Warn().Err(err).Msg("Could not raise a desktop notification")
+			} else if notifyMode == "only" {
+				continue
+			}
+		}
+
+		if err := printJoke(cmd, j, output, tmpl, st); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printJoke prints a joke in the output format
+func printJoke(cmd *cobra.Command, j joke.Joke, output string, tmpl *template.Template, st style) error {
+	out := cmd.OutOrStdout()
+	if output == "json" {
+		return json.NewEncoder(out).Encode(j)
+	}
+	if tmpl != nil {
+		var buf strings.Builder
+		if err := writeFormatted(&buf, tmpl, j); err != nil {
+			return err
+		}
+		_, err := fmt.Fprint(out, st.theme(buf.String()))
+		return err
+	}
+	if delay, interactive := viper.GetDuration("punchline_delay"), viper.GetBool("interactive"); delay > 0 || interactive {
+		return writePunchline(cmd.Context(), out, cmd.InOrStdin(), st, j.Text, delay, interactive)
+	}
+	_, err := fmt.Fprint(out, st.joke(j.Text))
+	return err
+}
+
+// newEngine returns an engine for lang configured from the settings. lang
+// may list several languages, comma separated, or be "all", for an engine
+// mixing their jokes according to lang_<lang>_weight.
+func newEngine(store joke.Store, lang string) (*joke.Engine, error) {
+	return newEngineWith(store, lang, newLanguageEngine)
+}
+
+// newCachedEngine returns an engine like newEngine that only tells stored
+// jokes, which is all TellCached needs. Building the fallback chain, which
+// starts the source plugins, is skipped to keep shell prompts fast.
+func newCachedEngine(store joke.Store, lang string) (*joke.Engine, error) {
+	return newEngineWith(store, lang, newStoredEngine)
+}
+
+// newEngineWith returns an engine for lang like newEngine, with the
+// engines of single languages returned by newLanguage
+func newEngineWith(store joke.Store, lang string, newLanguage func(joke.Store, string) (*joke.Engine, error)) (*joke.Engine, error) {
+	supported := append(languages(joke.DefaultRegistry()), translatedLanguages()...)
+	var langs []string
+	for _, l := range strings.Split(lang, ",") {
+		add := []string{resolveLanguage(l, supported)}
+		if add[0] == allLanguages {
+			add = supported
+		}
+		for _, l := range add {
+			if l != "" && !slices.Contains(langs, l) {
+				langs = append(langs, l)
+			}
+		}
+	}
+	switch len(langs) {
+	case 0:
+		return newLanguage(store, joke.DefaultLanguage)
+	case 1:
+		return newLanguage(store, langs[0])
+	}
+
+	mix := make([]joke.MixedEngine, 0, len(langs))
+	total := 0.0
+	for _, l := range langs {
+		engine, err := newLanguage(store, l)
+		if err != nil {
+			return nil, err
+		}
+		weight := 1.0
+		if key := "lang_" + l + "_weight"; viper.IsSet(key) {
+			if weight = viper.GetFloat64(key); weight < 0 {
+				return nil, fmt.Errorf("%s must not be negative", key)
+			}
+		}
+		total += weight
+		mix = append(mix, joke.MixedEngine{Engine: engine, Weight: weight})
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("every language of %s has a weight of 0", lang)
+	}
+
+	engine := joke.NewMix(store, mix...)
+	engine.Offline = viper.GetBool("offline")
+	engine.Workers = viper.GetInt("workers")
+	// Tagged jokes are picked by the mix itself
+	engine.Filter = mix[0].Engine.Filter
+	return engine, nil
+}
+
+// newLanguageEngine returns an engine for the single language lang
+// configured from the settings
+func newLanguageEngine(store joke.Store, lang string) (*joke.Engine, error) {
+	sources, err := buildChain(store, lang)
+	if err != nil {
+		return nil, err
+	}
+	if cache, ok := store.(joke.TranslationStore); ok {
+		for _, src := range sources {
+			if translated, ok := src.(*joke.TranslatedSource); ok {
+				translated.Cache = cache
+			}
+		}
+	}
+
+	engine := joke.NewEngine(store, sources...)
+	engine.Language = lang
+	engine.Offline = viper.GetBool("offline")
+	engine.Timeout = viper.GetDuration("timeout")
+	engine.SourceTimeouts = sourceTimeouts(sources)
+	engine.Headers = sourceHeaders(sources)
+	engine.Weights = sourceWeights(sources)
+	if engine.RateLimits, err = sourceRateLimits(sources); err != nil {
+		return nil, err
+	}
+	engine.MaxDuplicates = viper.GetInt("max_duplicates")
+	engine.Retry.Attempts = viper.GetInt("retry_attempts")
+	engine.Retry.Backoff = viper.GetDuration("retry_backoff")
+	engine.Retry.MaxBackoff = viper.GetDuration("retry_max_backoff")
+	engine.Retry.Jitter = viper.GetFloat64("retry_jitter")
+	engine.Workers = viper.GetInt("workers")
+	engine.Breaker.Threshold = viper.GetInt("circuit_breaker_threshold")
+	engine.Breaker.Cooldown = viper.GetDuration("circuit_breaker_cooldown")
+	engine.Embedder = newEmbedder()
+	engine.Similarity = viper.GetFloat64("similarity_threshold")
+	if engine.Filter, err = contentFilter(); err != nil {
+		return nil, err
+	}
+	if after := viper.GetString("repeat_after"); after != "" {
+		if engine.RepeatAfter, err = parseDuration(after); err != nil {
+			return nil, fmt.Errorf("error parsing repeat_after: %w", err)
+		}
+	}
+	return engine, nil
+}
+
+// newStoredEngine returns an engine for the single language lang without
+// any sources, for telling stored jokes
+func newStoredEngine(store joke.Store, lang string) (*joke.Engine, error) {
+	engine := joke.NewEngine(store)
+	engine.Language = lang
+	engine.Offline = viper.GetBool("offline")
+	var err error
+	if engine.Filter, err = contentFilter(); err != nil {
+		return nil, err
+	}
+	return engine, nil
+}
+
+// languages returns the sorted languages jokes can be told in, those of
+// the sources in registry and of the embedded jokes
+func languages(registry *joke.Registry) []string {
+	langs := append(registry.Languages(), joke.EmbeddedLanguages()...)
+	slices.Sort(langs)
+	return slices.Compact(langs)
+}
+
+// buildChain returns the sources to try for lang, in order. A fallback
+// chain from the settings is used as is; without one the sources for the
+// language are tried first and the database ends the chain.
+func buildChain(store joke.Store, lang string) ([]joke.Source, error) {
+	registry, err := sourceRegistry()
+	if err != nil {
+		return nil, err
+	}
+	online := len(registry.ForLanguage(lang)) > 0
+	if !online && !slices.Contains(joke.EmbeddedLanguages(), lang) {
+		return nil, fmt.Errorf("%w %q (supported: %s)", joke.ErrUnsupportedLanguage, lang, strings.Join(languages(registry), ", "))
+	}
+	disabled := disabledSources(registry)
+
+	names := configList("fallback_chain_" + lang)
+	if len(names) == 0 {
+		names = configList("fallback_chain")
+	}
+	if len(names) == 0 {
+		var sources []joke.Source
+		// Languages only the embedded jokes are in have no online sources
+		if online {
+			if sources, err = registry.Select(lang, configList("sources_"+lang), disabled); err != nil {
+				return nil, err
+			}
+		}
+		for _, name := range []string{joke.StoreSourceName, joke.EmbeddedSourceName} {
+			if !slices.Contains(disabled, name) {
+				sources = append(sources, localSource(store, name, lang))
+			}
+		}
+		return sources, nil
+	}
+
+	chain := make([]joke.Source, 0, len(names))
+	for _, name := range names {
+		if slices.Contains(disabled, name) {
+			continue
+		}
+		if src := localSource(store, name, lang); src != nil {
+			chain = append(chain, src)
+			continue
+		}
+		src, ok := registry.Get(name)
+		if !ok {
+			return nil, fmt.Errorf("%w %q in fallback chain", joke.ErrUnknownSource, name)
+		}
+		chain = append(chain, src)
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("every source in the fallback chain is disabled")
+	}
+	return chain, nil
+}
+
+// sourceRegistry returns the built-in sources, with the implementations
+// and content flags picked in the settings, the user's own sources and
+// the source plugins
+func sourceRegistry() (*joke.Registry, error) {
+	registry := joke.DefaultRegistry()
+	switch api := viper.GetString("icanhazdadjoke_api"); api {
+	case "", "rest":
+	case "graphql":
+		registry.Replace(joke.NewICanHazDadJokeGraphQL())
+	default:
+		return nil, fmt.Errorf("unknown icanhazdadjoke_api %q, use rest or graphql", api)
+	}
+
+	custom, err := customSources()
+	if err != nil {
+		return nil, err
+	}
+	for _, src := range append(custom, loadPlugins()...) {
+		if err := registry.Register(src); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := addTranslatedSources(registry); err != nil {
+		return nil, err
+	}
+
+	home, _ := os.UserHomeDir()
+	for _, src := range registry.Sources() {
+		if list, ok := src.(*joke.MarkdownList); ok {
+			list.CacheDir = cacheDir(home)
+		}
+	}
+
+	if viper.GetBool("kid_safe") {
+		for _, src := range registry.Sources() {
+			if jokeAPI, ok := src.(*joke.JokeAPI); ok {
+				jokeAPI.Blacklist = slices.Clone(joke.JokeAPIFlags)
+				jokeAPI.SafeMode = true
+			}
+		}
+	} else if viper.IsSet("jokeapi_blacklist") {
+		flags := configList("jokeapi_blacklist")
+		for _, flag := range flags {
+			if !slices.Contains(joke.JokeAPIFlags, flag) {
+				return nil, fmt.Errorf("unknown jokeapi_blacklist flag %q, use %s", flag, strings.Join(joke.JokeAPIFlags, ", "))
+			}
+		}
+		for _, src := range registry.Sources() {
+			if jokeAPI, ok := src.(*joke.JokeAPI); ok {
+				jokeAPI.Blacklist = flags
+			}
+		}
+	}
+	return registry, nil
+}
+
+// contentFilter returns the filter for the jokes told, rejecting those
+// with words from blocklist, exclude and, in kid-safe mode,
+// joke.KidSafeBlocklist, and those outside of min_length and max_length
+func contentFilter() (joke.Filter, error) {
+	f := joke.Filter{
+		MinLength: viper.GetInt("min_length"),
+		MaxLength: viper.GetInt("max_length"),
+	}
+	if f.MinLength < 0 || f.MaxLength < 0 {
+		return joke.Filter{}, errors.New("min_length and max_length must not be negative")
+	}
+	if f.MaxLength > 0 && f.MinLength > f.MaxLength {
+		return joke.Filter{}, fmt.Errorf("min_length %d is greater than max_length %d", f.MinLength, f.MaxLength)
+	}
+	if viper.GetBool("kid_safe") {
+		f.Blocklist = slices.Clone(joke.KidSafeBlocklist)
+	}
+	f.Blocklist = append(f.Blocklist, configList("blocklist")...)
+	f.Blocklist = append(f.Blocklist, configList("exclude")...)
+	return f, nil
+}
+
+// localSource returns the database or embedded source called name, or nil
+// if name is neither
+func localSource(store joke.Store, name, lang string) joke.Source {
+	switch name {
+	case joke.StoreSourceName:
+		return joke.NewStoreSource(store, lang)
+	case joke.EmbeddedSourceName:
+		return joke.NewEmbeddedSource(lang)
+	default:
+		return nil
+	}
+}
+
+// chainNames returns the names that can appear in a fallback chain
+func chainNames(registry *joke.Registry) []string {
+	names := []string{joke.StoreSourceName, joke.EmbeddedSourceName}
+	for _, src := range registry.Sources() {
+		names = append(names, src.Name())
+	}
+	return names
+}
+
+// disabledSources returns the sources turned off with disabled_sources or
+// source_<name>_enabled
+func disabledSources(registry *joke.Registry) []string {
+	disabled := configList("disabled_sources")
+	for _, name := range chainNames(registry) {
+		key := "source_" + name + "_enabled"
+		if viper.IsSet(key) && !viper.GetBool(key) {
+			disabled = append(disabled, name)
+		}
+	}
+	return disabled
+}
+
+// sourceWeights returns the weights of sources set with
+// source_<name>_weight, or nil to try the sources in order
+func sourceWeights(sources []joke.Source) map[string]float64 {
+	var weights map[string]float64
+	for _, src := range sources {
+		name := src.Name()
+		key := "source_" + name + "_weight"
+		if viper.IsSet(key) {
+			if weights == nil {
+				weights = map[string]float64{}
+			}
+			weights[name] = viper.GetFloat64(key)
+		}
+	}
+	return weights
+}
+
+// sourceRateLimits returns the default rate limits, overridden for sources
+// with source_<name>_rate_limit. A rate limit of 0 requests lifts it.
+func sourceRateLimits(sources []joke.Source) (map[string]joke.RateLimit, error) {
+	limits := maps.Clone(joke.DefaultRateLimits)
+	for _, src := range sources {
+		name := src.Name()
+		key := "source_" + name + "_rate_limit"
+		if !viper.IsSet(key) {
+			continue
+		}
+		limit, err := parseRateLimit(viper.GetString(key))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s: %w", key, err)
+		}
+		limits[name] = limit
+	}
+	return limits, nil
+}
+
+// sourceHeaders returns the extra headers of sources set with
+// source_<name>_headers. Environment variables in them like ${API_KEY} are
+// expanded, so secrets can stay out of the config file.
+func sourceHeaders(sources []joke.Source) map[string]map[string]string {
+	headers := map[string]map[string]string{}
+	for _, src := range sources {
+		name := src.Name()
+		set := viper.GetStringMapString("source_" + name + "_headers")
+		if len(set) == 0 {
+			continue
+		}
+		headers[name] = make(map[string]string, len(set))
+		for k, v := range set {
+			headers[name][http.CanonicalHeaderKey(k)] = os.ExpandEnv(v)
+		}
+	}
+	return headers
+}
+
+// sourceTimeouts returns the timeouts of sources set with
+// source_<name>_timeout
+func sourceTimeouts(sources []joke.Source) map[string]time.Duration {
+	timeouts := map[string]time.Duration{}
+	for _, src := range sources {
+		name := src.Name()
+		key := "source_" + name + "_timeout"
+		if viper.IsSet(key) {
+			timeouts[name] = viper.GetDuration(key)
+		}
+	}
+	return timeouts
+}
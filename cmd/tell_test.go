@@ -0,0 +1,403 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/viper"
+)
+
+func TestBuildChain(t *testing.T) {
+	store, err := joke.OpenSQLite(filepath.Join(t.TempDir(), "jokes.db"))
+	if err != nil {
+		t.Fatalf("Failed to open the database: %v", err)
+	}
+	defer store.Close()
+
+	testCases := []struct {
+		name     string
+		lang     string
+		settings map[string]any
+		want     []string
+	}{
+		{name: "Default", lang: "en", want: []string{"icanhazdadjoke", "official-joke-api", "jokeapi-en", "geek-jokes", "db", "embedded"}},
+		{name: "German", lang: "de", want: []string{"flachwitze", "witzapi", "jokeapi-de", "db", "embedded"}},
+		{name: "French", lang: "fr", want: []string{"jokeapi-fr", "db", "embedded"}},
+		{name: "EmbeddedOnly", lang: "nl", want: []string{"db", "embedded"}},
+		{
+			name:     "Chain",
+			lang:     "en",
+			settings: map[string]any{"fallback_chain": "icanhazdadjoke,flachwitze,db,embedded"},
+			want:     []string{"icanhazdadjoke", "flachwitze", "db", "embedded"},
+		},
+		{
+			name: "ChainPerLanguage",
+			lang: "de",
+			settings: map[string]any{
+				"fallback_chain":    "icanhazdadjoke,db",
+				"fallback_chain_de": "flachwitze,icanhazdadjoke",
+			},
+			want: []string{"flachwitze", "icanhazdadjoke"},
+		},
+		{
+			name: "EnableFlag",
+			lang: "en",
+			settings: map[string]any{
+				"fallback_chain":            []string{"icanhazdadjoke", "flachwitze", "db"},
+				"source_flachwitze_enabled": false,
+			},
+			want: []string{"icanhazdadjoke", "db"},
+		},
+		{
+			name:     "DatabaseDisabled",
+			lang:     "en",
+			settings: map[string]any{"disabled_sources": "db,embedded"},
+			want:     []string{"icanhazdadjoke", "official-joke-api", "jokeapi-en", "geek-jokes"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			viper.Reset()
+			defer viper.Reset()
+			for k, v := range tc.settings {
+				viper.Set(k, v)
+			}
+
+			chain, err := buildChain(store, tc.lang)
+			if err != nil {
+				t.Fatalf("buildChain() returned an error: %v", err)
+			}
+			var got []string
+			for _, src := range chain {
+				got = append(got, src.Name())
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("buildChain() = %v, want %v", got, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Fatalf("buildChain() = %v, want %v", got, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSourceRegistry(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	viper.Set("icanhazdadjoke_api", "graphql")
+	viper.Set("jokeapi_blacklist", "nsfw,explicit")
+	registry, err := sourceRegistry()
+	if err != nil {
+		t.Fatalf("sourceRegistry() returned an error: %v", err)
+	}
+	if src, _ := registry.Get("icanhazdadjoke"); src == nil {
+		t.Errorf("icanhazdadjoke is not registered")
+	} else if _, ok := src.(*joke.ICanHazDadJokeGraphQL); !ok {
+		t.Errorf("icanhazdadjoke is a %T, want the GraphQL source", src)
+	}
+	src, _ := registry.Get("jokeapi-de")
+	if jokeAPI, ok := src.(*joke.JokeAPI); !ok || strings.Join(jokeAPI.Blacklist, ",") != "nsfw,explicit" {
+		t.Errorf("jokeapi-de is %+v, want the configured blacklist", src)
+	}
+
+	viper.Set("kid_safe", true)
+	if registry, err = sourceRegistry(); err != nil {
+		t.Fatalf("sourceRegistry() in kid-safe mode returned an error: %v", err)
+	}
+	src, _ = registry.Get("jokeapi-de")
+	if jokeAPI, ok := src.(*joke.JokeAPI); !ok || !jokeAPI.SafeMode || len(jokeAPI.Blacklist) != len(joke.JokeAPIFlags) {
+		t.Errorf("jokeapi-de is %+v in kid-safe mode, want safe mode and every flag blacklisted", src)
+	}
+	viper.Set("kid_safe", false)
+
+	viper.Set("jokeapi_blacklist", "nsfw,spicy")
+	if _, err := sourceRegistry(); err == nil {
+		t.Errorf("sourceRegistry() accepted an unknown blacklist flag")
+	}
+}
+
+func TestContentFilter(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	if f, err := contentFilter(); err != nil || !f.IsZero() {
+		t.Errorf("contentFilter() = %+v, %v by default, want the zero filter", f, err)
+	}
+	viper.Set("blocklist", "mondays,taxes")
+	viper.Set("exclude", "cats")
+	viper.Set("kid_safe", true)
+	viper.Set("max_length", 20)
+	f, err := contentFilter()
+	if err != nil {
+		t.Fatalf("contentFilter() returned an error: %v", err)
+	}
+	for _, text := range []string{"I hate Mondays.", "Holy shit", "Cats are liquid", "I love Fridays, all of them."} {
+		if f.Allows(joke.Joke{Text: text}) {
+			t.Errorf("contentFilter() allows %q, want the kid-safe blocklist, the configured words and lengths", text)
+		}
+	}
+	if !f.Allows(joke.Joke{Text: "I love Fridays."}) {
+		t.Errorf("contentFilter() rejects a short and clean joke")
+	}
+
+	viper.Set("min_length", 30)
+	if _, err := contentFilter(); err == nil {
+		t.Error("contentFilter() accepted a min_length greater than max_length")
+	}
+}
+
+func TestCustomSources(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	t.Setenv("HOME", "/home/dad")
+
+	viper.Set("sources", []map[string]any{
+		{"type": "file", "path": "~/Family Jokes.yaml", "lang": "de"},
+		{"type": "file", "path": "/srv/jokes.txt", "name": "office"},
+	})
+	sources, err := customSources()
+	if err != nil {
+		t.Fatalf("customSources() returned an error: %v", err)
+	}
+	if len(sources) != 2 {
+		t.Fatalf("customSources() returned %d sources, want 2", len(sources))
+	}
+	family, ok := sources[0].(*joke.FileSource)
+	if !ok || family.Name() != "family-jokes" || family.Language() != "de" || family.Path != "/home/dad/Family Jokes.yaml" {
+		t.Errorf("customSources()[0] = %+v, want family-jokes in German from the home directory", sources[0])
+	}
+	if sources[1].Name() != "office" || sources[1].Language() != "en" {
+		t.Errorf("customSources()[1] = %+v, want office in English", sources[1])
+	}
+
+	chain, err := buildChain(nil, "de")
+	if err != nil {
+		t.Fatalf("buildChain() returned an error: %v", err)
+	}
+	if !slices.ContainsFunc(chain, func(src joke.Source) bool { return src.Name() == "family-jokes" }) {
+		t.Errorf("buildChain() left out the German file source")
+	}
+
+	viper.Set("sources", []map[string]any{{"type": "dir", "path": "~/Jokes/*.txt"}})
+	sources, err = customSources()
+	if err != nil {
+		t.Fatalf("customSources() returned an error: %v", err)
+	}
+	if dir, ok := sources[0].(*joke.DirSource); !ok || dir.Name() != "jokes" || dir.Pattern != "/home/dad/Jokes/*.txt" {
+		t.Errorf("customSources()[0] = %+v, want a dir source named after the directory", sources[0])
+	}
+	if again, _ := customSources(); again[0] != sources[0] {
+		t.Errorf("customSources() returned a new dir source, want the same one")
+	}
+
+	viper.Set("sources", []map[string]any{{"type": "markdown", "name": "blagues", "url": "https://example.com/README.md", "lang": "fr"}})
+	sources, err = customSources()
+	if err != nil {
+		t.Fatalf("customSources() returned an error: %v", err)
+	}
+	if list, ok := sources[0].(*joke.MarkdownList); !ok || list.Name() != "blagues" || list.Language() != "fr" {
+		t.Errorf("customSources()[0] = %+v, want a French markdown list", sources[0])
+	}
+	viper.Set("sources", []map[string]any{{"type": "markdown", "url": "https://example.com/README.md"}})
+	if _, err := customSources(); err == nil {
+		t.Errorf("customSources() accepted a markdown source without a name")
+	}
+
+	t.Setenv("OPENAI_API_KEY", "secret")
+	viper.Set("sources", []map[string]any{{"type": "llm", "model": "gpt-4o-mini", "key": "${OPENAI_API_KEY}", "temperature": 0.5}})
+	sources, err = customSources()
+	if err != nil {
+		t.Fatalf("customSources() returned an error: %v", err)
+	}
+	if llm, ok := sources[0].(*joke.LLMSource); !ok || llm.Name() != "llm" || llm.URL != joke.OpenAIURL || llm.Key != "secret" || llm.Temperature != 0.5 {
+		t.Errorf("customSources()[0] = %+v, want an llm source using OpenAI with the key from the environment", sources[0])
+	}
+	viper.Set("sources", []map[string]any{{"type": "llm"}})
+	if _, err := customSources(); err == nil {
+		t.Errorf("customSources() accepted an llm source without a model")
+	}
+
+	t.Setenv("OLLAMA_HOST", "gpu-box:11434")
+	viper.Set("sources", []map[string]any{{"type": "ollama", "lang": "de"}})
+	sources, err = customSources()
+	if err != nil {
+		t.Fatalf("customSources() returned an error: %v", err)
+	}
+	if ollama, ok := sources[0].(*joke.LLMSource); !ok || ollama.Name() != "ollama" || ollama.URL != "http://gpu-box:11434/v1" || ollama.Model != joke.DefaultOllamaModel || ollama.Key != "" {
+		t.Errorf("customSources()[0] = %+v, want an ollama source using OLLAMA_HOST", sources[0])
+	}
+
+	viper.Set("sources", []map[string]any{{"type": "ftp", "path": "x"}})
+	if _, err := customSources(); err == nil {
+		t.Errorf("customSources() accepted an unknown type")
+	}
+	viper.Set("sources", []map[string]any{{"type": "file"}})
+	if _, err := customSources(); err == nil {
+		t.Errorf("customSources() accepted a file source without a path")
+	}
+}
+
+func TestBuildChainErrors(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	if _, err := buildChain(nil, "xx"); !errors.Is(err, joke.ErrUnsupportedLanguage) {
+		t.Errorf("buildChain() returned %v, want ErrUnsupportedLanguage", err)
+	}
+
+	viper.Set("fallback_chain", "nope")
+	if _, err := buildChain(nil, "en"); !errors.Is(err, joke.ErrUnknownSource) {
+		t.Errorf("buildChain() returned %v, want ErrUnknownSource", err)
+	}
+}
+
+func TestSourceTimeouts(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("source_flachwitze_timeout", "3s")
+
+	timeouts := sourceTimeouts([]joke.Source{joke.NewICanHazDadJoke(), joke.NewFlachwitze()})
+	if len(timeouts) != 1 || timeouts["flachwitze"] != 3*time.Second {
+		t.Errorf("sourceTimeouts() = %v, want flachwitze: 3s", timeouts)
+	}
+}
+
+func TestNewEngineMix(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("lang_de_weight", 2)
+
+	engine, err := newEngine(nil, "EN, de,en")
+	if err != nil {
+		t.Fatalf("newEngine() returned an error: %v", err)
+	}
+	if len(engine.Mix) != 2 || engine.Language != "en,de" {
+		t.Fatalf("newEngine() = %+v, want a mix of en and de", engine)
+	}
+	if engine.Mix[0].Weight != 1 || engine.Mix[1].Weight != 2 {
+		t.Errorf("newEngine() weighs en %v and de %v, want 1 and 2", engine.Mix[0].Weight, engine.Mix[1].Weight)
+	}
+
+	engine, err = newEngine(nil, "all")
+	if err != nil {
+		t.Fatalf("newEngine() returned an error: %v", err)
+	}
+	if want := languages(joke.DefaultRegistry()); len(engine.Mix) != len(want) {
+		t.Errorf("newEngine(\"all\") mixes %s, want %v", engine.Language, want)
+	}
+
+	engine, err = newEngine(nil, "de,de")
+	if err != nil {
+		t.Fatalf("newEngine() returned an error: %v", err)
+	}
+	if len(engine.Mix) != 0 || engine.Language != "de" {
+		t.Errorf("newEngine(\"de,de\") = %+v, want a German engine", engine)
+	}
+
+	viper.Set("lang_de_weight", -1)
+	if _, err := newEngine(nil, "en,de"); err == nil {
+		t.Errorf("newEngine() accepted a negative weight")
+	}
+}
+
+func TestNewCachedEngine(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("max_length", 120)
+
+	engine, err := newCachedEngine(nil, "en,de")
+	if err != nil {
+		t.Fatalf("newCachedEngine() returned an error: %v", err)
+	}
+	if len(engine.Mix) != 2 {
+		t.Fatalf("newCachedEngine() = %+v, want a mix of en and de", engine)
+	}
+	for _, m := range engine.Mix {
+		if len(m.Engine.Sources) != 0 || m.Engine.Filter.MaxLength != 120 {
+			t.Errorf("newCachedEngine() for %s = %+v, want no sources and the content filter", m.Engine.Language, m.Engine)
+		}
+	}
+}
+
+// BenchmarkTellCached measures "godad tell --cached-max-age" as run by a
+// shell prompt, from reading the settings to printing the joke
+func BenchmarkTellCached(b *testing.B) {
+	b.Setenv("HOME", b.TempDir())
+	b.Setenv("XDG_CONFIG_HOME", "")
+	b.Setenv("XDG_DATA_HOME", "")
+	run := func(args ...string) {
+		viper.Reset()
+		cmd := newRootCmd()
+		cmd.SetArgs(args)
+		cmd.SetOut(io.Discard)
+		if err := cmd.Execute(); err != nil {
+			b.Fatalf("godad %s returned an error: %v", strings.Join(args, " "), err)
+		}
+	}
+	defer viper.Reset()
+	run("add", "A joke for the prompt", "--quiet")
+
+	b.ResetTimer()
+	for range b.N {
+		run("tell", "--cached-max-age", "1h", "--offline", "--quiet")
+	}
+}
+
+func TestSourceHeaders(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	t.Setenv("JOKES_API_KEY", "secret")
+	t.Setenv("GODAD_SOURCE_JOKEAPI_EN_HEADERS", `{"X-Api-Key": "${JOKES_API_KEY}"}`)
+	viper.SetEnvPrefix(envPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
+	viper.AutomaticEnv()
+	viper.Set("source_icanhazdadjoke_headers", map[string]string{"Accept-Language": "en"})
+
+	sources := []joke.Source{
+		joke.NewICanHazDadJoke(),
+		joke.NewJokeAPI("en"),
+		joke.NewGeekJokes(),
+	}
+	headers := sourceHeaders(sources)
+	if got := headers["jokeapi-en"]["X-Api-Key"]; got != "secret" {
+		t.Errorf("jokeapi-en headers = %v, want the expanded API key", headers["jokeapi-en"])
+	}
+	if got := headers["icanhazdadjoke"]["Accept-Language"]; got != "en" {
+		t.Errorf("icanhazdadjoke headers = %v, want Accept-Language", headers["icanhazdadjoke"])
+	}
+	if len(headers) != 2 {
+		t.Errorf("sourceHeaders() = %v, want headers of two sources", headers)
+	}
+}
+
+func TestTellOfflineLanguage(t *testing.T) {
+	defer viper.Reset()
+	dbdir := t.TempDir()
+	if _, err := runGodad(dbdir, "", "add", "--lang", "en", "An English joke"); err != nil {
+		t.Fatalf("add returned an error: %v", err)
+	}
+
+	// The stored jokes are all English, so the German ones are embedded
+	for range 3 {
+		out, err := runGodad(dbdir, "", "tell", "--lang", "de", "--offline")
+		if err != nil {
+			t.Fatalf("tell returned an error: %v", err)
+		}
+		if out == "" || strings.Contains(out, "An English joke") {
+			t.Fatalf("tell --lang de --offline printed %q, want an embedded German joke", out)
+		}
+	}
+}
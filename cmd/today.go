@@ -0,0 +1,80 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"text/template"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func newTodayCmd() *cobra.Command {
+	todayCmd := &cobra.Command{
+		Use:   "today",
+		Short: "Tell the joke of the day",
+		Long: `Tell the joke of the day. The joke is picked from the date and a salt, so
+everyone on a team with the same sources and salt gets the same joke on
+the same day, and running it again later that day tells the same joke
+without using up fresh ones.
+
+The joke is picked from the first source with a fixed list of jokes, like
+a file source, or numbering its jokes, like icanhazdadjoke. Offline, it is
+picked from the stored jokes, which only agree across a team sharing a
+database. Set today_salt in the config file, or use --salt, for a joke of
+your own.`,
+		Example: `  godad today
+  godad today --salt platform-team
+  godad today --offline --output json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			output, _ := cmd.Flags().GetString("output")
+			if output != "text" && output != "json" {
+				return fmt.Errorf("unknown output format %q, use text or json", output)
+			}
+			var tmpl *template.Template
+			if format := viper.GetString("format"); format != "" && output == "text" {
+				var err error
+				if tmpl, err = parseFormat(format); err != nil {
+					return err
+				}
+			}
+			salt := flagOrSetting(cmd, "salt", "today_salt")
+
+			st, err := newStyle(viper.GetString("theme"), viper.GetBool("banner"))
+			if err != nil {
+				return err
+			}
+
+			store, err := openStore()
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			unlock, err := lockStore(cmd.Context())
+			if err != nil {
+				return err
+			}
+			defer unlock()
+
+			engine, err := newEngine(store, viper.GetString("lang"))
+			if err != nil {
+				return err
+			}
+			j, err := engine.Today(cmd.Context(), time.Now(), salt)
+			if err != nil {
+				return err
+			}
+			return printJoke(cmd, j, output, tmpl, st)
+		},
+	}
+
+	addEngineFlags(todayCmd)
+	todayCmd.Flags().String("salt", "", "Salt mixed into the pick, instead of today_salt, e.g. the name of the team")
+	addPrintFlags(todayCmd)
+	return todayCmd
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/viper"
+)
+
+func TestToday(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	dbdir := t.TempDir()
+
+	if _, err := runGodad(dbdir, "Joke one\n\nJoke two\n\nJoke three", "add"); err != nil {
+		t.Fatalf("add returned an error: %v", err)
+	}
+	out, err := runGodad(dbdir, "", "today", "--lang", "en", "--offline", "--output", "json")
+	if err != nil {
+		t.Fatalf("today returned an error: %v", err)
+	}
+	var first joke.Joke
+	if err := json.Unmarshal([]byte(out), &first); err != nil {
+		t.Fatalf("today printed %q, want a joke as JSON: %v", out, err)
+	}
+	out, err = runGodad(dbdir, "", "today", "--lang", "en", "--offline")
+	if err != nil {
+		t.Fatalf("today returned an error: %v", err)
+	}
+	if !strings.Contains(out, first.Text) {
+		t.Errorf("today printed %q again, want %q again", out, first.Text)
+	}
+
+	out, err = runGodad(dbdir, "", "show", strconv.FormatInt(first.ID, 10), "--output", "json")
+	if err != nil {
+		t.Fatalf("show returned an error: %v", err)
+	}
+	var shown joke.Joke
+	if err := json.Unmarshal([]byte(out), &shown); err != nil || shown.TimesTold != 1 {
+		t.Errorf("show printed %q, want the joke of the day told once", out)
+	}
+}
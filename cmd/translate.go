@@ -0,0 +1,85 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/viper"
+)
+
+// newTranslator returns the translator picked in the settings, or nil if
+// jokes are not translated
+func newTranslator() (joke.Translator, error) {
+	url, key := viper.GetString("translator_url"), viper.GetString("translator_key")
+	switch name := viper.GetString("translator"); name {
+	case "":
+		return nil, nil
+	case "deepl":
+		if key == "" {
+			return nil, errors.New("the deepl translator needs a translator_key")
+		}
+		t := joke.NewDeepL(key)
+		if url != "" {
+			t.URL = url
+		}
+		return t, nil
+	case "google":
+		if key == "" {
+			return nil, errors.New("the google translator needs a translator_key")
+		}
+		t := joke.NewGoogleTranslate(key)
+		if url != "" {
+			t.URL = url
+		}
+		return t, nil
+	case "libretranslate":
+		return joke.NewLibreTranslate(url, key), nil
+	default:
+		return nil, fmt.Errorf("unknown translator %q, use deepl, google or libretranslate", name)
+	}
+}
+
+// translatedLanguages returns the languages in translate_to, or none if
+// jokes are not translated
+func translatedLanguages() []string {
+	if viper.GetString("translator") == "" {
+		return nil
+	}
+	from := strings.ToLower(viper.GetString("translate_from"))
+	var langs []string
+	for _, lang := range configList("translate_to") {
+		if lang = strings.ToLower(lang); lang == autoLanguage {
+			lang = detectLanguage()
+		}
+		if lang != "" && lang != from && !slices.Contains(langs, lang) {
+			langs = append(langs, lang)
+		}
+	}
+	return langs
+}
+
+// addTranslatedSources registers a translated source for every source of
+// the translate_from language and every language in translate_to. They
+// come after the sources of the language itself.
+func addTranslatedSources(registry *joke.Registry) error {
+	translator, err := newTranslator()
+	if err != nil || translator == nil {
+		return err
+	}
+
+	sources := registry.ForLanguage(viper.GetString("translate_from"))
+	for _, lang := range translatedLanguages() {
+		for _, src := range sources {
+			if err := registry.Register(joke.NewTranslatedSource(src, translator, lang)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/viper"
+)
+
+func TestTranslatedSources(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	t.Setenv("LC_ALL", "it_IT.UTF-8")
+
+	viper.Set("translator", "libretranslate")
+	viper.Set("translator_url", "http://localhost:5000")
+	viper.Set("translate_from", "en")
+	viper.Set("translate_to", "nl,auto,en")
+	if got := translatedLanguages(); len(got) != 2 || got[0] != "nl" || got[1] != "it" {
+		t.Errorf("translatedLanguages() = %v, want [nl it]", got)
+	}
+
+	chain, err := buildChain(nil, "nl")
+	if err != nil {
+		t.Fatalf("buildChain() returned an error: %v", err)
+	}
+	translated, ok := chain[0].(*joke.TranslatedSource)
+	if !ok || translated.Name() != "icanhazdadjoke-nl" || translated.Language() != "nl" {
+		t.Fatalf("buildChain() starts with %+v, want icanhazdadjoke translated into Dutch", chain[0])
+	}
+	if libre, ok := translated.Translator.(*joke.LibreTranslate); !ok || libre.URL != "http://localhost:5000" {
+		t.Errorf("the translator is %+v, want the configured LibreTranslate server", translated.Translator)
+	}
+
+	viper.Set("translator", "deepl")
+	if _, err := sourceRegistry(); err == nil {
+		t.Errorf("sourceRegistry() accepted deepl without a key")
+	}
+	viper.Set("translator", "babelfish")
+	if _, err := sourceRegistry(); err == nil {
+		t.Errorf("sourceRegistry() accepted an unknown translator")
+	}
+}
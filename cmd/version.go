@@ -0,0 +1,160 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/cobra"
+)
+
+// buildVersion, buildCommit and buildDate describe the release a binary
+// was built from, see SetBuildInfo. Builds that don't set them fall back
+// to what the Go toolchain recorded.
+var buildVersion, buildCommit, buildDate string
+
+// SetBuildInfo records the version, commit and date of the release, as set
+// by the linker when building it
+func SetBuildInfo(version, commit, date string) {
+	buildVersion, buildCommit, buildDate = version, commit, date
+}
+
+// versionInfo describes how godad was built
+type versionInfo struct {
+	Version   string   `json:"version"`
+	Commit    string   `json:"commit,omitempty"`
+	Date      string   `json:"date,omitempty"`
+	Modified  bool     `json:"modified,omitempty"`
+	GoVersion string   `json:"go_version"`
+	Platform  string   `json:"platform"`
+	Tags      []string `json:"tags"`
+	CGO       bool     `json:"cgo"`
+	SQLite    string   `json:"sqlite"`
+}
+
+// currentVersion returns how the running binary was built, preferring the
+// release information over what the Go toolchain recorded
+func currentVersion() versionInfo {
+	v := versionInfo{
+		Version:   "dev",
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		Tags:      []string{},
+		SQLite:    joke.SQLiteLibrary,
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		// Binaries installed with "go install ...@version" know their
+		// version, those built from a checkout are "(devel)"
+		if info.Main.Version != "" && info.Main.Version != "(devel)" {
+			v.Version = info.Main.Version
+		}
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				v.Commit = s.Value
+			case "vcs.time":
+				v.Date = s.Value
+			case "vcs.modified":
+				v.Modified = s.Value == "true"
+			case "-tags":
+				v.Tags = strings.Split(s.Value, ",")
+			case "CGO_ENABLED":
+				v.CGO = s.Value == "1"
+			}
+		}
+	}
+	if buildVersion != "" {
+		v.Version = buildVersion
+	}
+	if buildCommit != "" {
+		v.Commit, v.Modified = buildCommit, false
+	}
+	if buildDate != "" {
+		v.Date = buildDate
+	}
+	return v
+}
+
+// String returns the version, with the commit it was built from if known
+// and not part of the version already, as in pseudo-versions
+func (v versionInfo) String() string {
+	if v.Commit == "" || strings.Contains(v.Version, shortCommit(v.Commit)) {
+		return v.Version
+	}
+	return fmt.Sprintf("%s (%s)", v.Version, shortCommit(v.Commit))
+}
+
+// shortCommit abbreviates a commit hash like git does
+func shortCommit(commit string) string {
+	if len(commit) > 12 {
+		return commit[:12]
+	}
+	return commit
+}
+
+func newVersionCmd() *cobra.Command {
+	versionCmd := &cobra.Command{
+		Use:   "version",
+		Short: "Show the version of godad and how it was built",
+		Long: `Show the version of godad, the commit and date it was built from, the Go
+version it was built with, and its build tags, including which SQLite it
+uses. Include the output when reporting a bug.`,
+		Example: `  godad version
+  godad version --output json`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			output, _ := cmd.Flags().GetString("output")
+			if output != "text" && output != "json" {
+				return fmt.Errorf("unknown output format %q, use text or json", output)
+			}
+			v := currentVersion()
+			if output == "json" {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(v)
+			}
+			return writeVersion(cmd.OutOrStdout(), v)
+		},
+	}
+
+	versionCmd.Flags().StringP("output", "o", "text", "Output format (text, json)")
+	return versionCmd
+}
+
+// writeVersion writes v as a table
+func writeVersion(out io.Writer, v versionInfo) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Version:\t%s\n", v.Version)
+	if v.Commit != "" {
+		commit := v.Commit
+		if v.Modified {
+			commit += " (modified)"
+		}
+		fmt.Fprintf(w, "Commit:\t%s\n", commit)
+	}
+	if v.Date != "" {
+		fmt.Fprintf(w, "Built:\t%s\n", v.Date)
+	}
+	fmt.Fprintf(w, "Go version:\t%s\n", v.GoVersion)
+	fmt.Fprintf(w, "Platform:\t%s\n", v.Platform)
+	tags := strings.Join(v.Tags, ", ")
+	if tags == "" {
+		tags = "none"
+	}
+	fmt.Fprintf(w, "Build tags:\t%s\n", tags)
+	cgo := "disabled"
+	if v.CGO {
+		cgo = "enabled"
+	}
+	fmt.Fprintf(w, "cgo:\t%s\n", cgo)
+	fmt.Fprintf(w, "SQLite:\t%s\n", v.SQLite)
+	return w.Flush()
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/spf13/viper"
+)
+
+func TestVersion(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	defer SetBuildInfo("", "", "")
+	dbdir := t.TempDir()
+	SetBuildInfo("v1.2.3", "0123456789abcdef0123456789abcdef01234567", "2024-05-01T09:00:00Z")
+
+	out, err := runGodad(dbdir, "", "version")
+	if err != nil {
+		t.Fatalf("version returned an error: %v", err)
+	}
+	for _, want := range []string{"v1.2.3", "0123456789abcdef", "2024-05-01T09:00:00Z", joke.SQLiteLibrary} {
+		if !strings.Contains(out, want) {
+			t.Errorf("version = %q, want it to contain %q", out, want)
+		}
+	}
+
+	out, err = runGodad(dbdir, "", "version", "--output", "json")
+	if err != nil {
+		t.Fatalf("version --output json returned an error: %v", err)
+	}
+	var v versionInfo
+	if err := json.Unmarshal([]byte(out), &v); err != nil {
+		t.Fatalf("version --output json = %q, not JSON: %v", out, err)
+	}
+	if v.Version != "v1.2.3" || v.GoVersion == "" || v.SQLite != joke.SQLiteLibrary {
+		t.Errorf("version --output json = %+v, want the build information", v)
+	}
+
+	if _, err := runGodad(dbdir, "", "version", "--output", "yaml"); err == nil {
+		t.Error("version --output yaml returned no error")
+	}
+
+	if got, want := currentVersion().String(), "v1.2.3 (0123456789ab)"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+// Command source-plugin is an example source plugin for godad. Build it
+// into godad's plugins directory to add its jokes:
+//
+//	go build -o ~/.config/godad/plugins/godad-source-example ./examples/source-plugin
+package main
+
+import (
+	"context"
+	"math/rand/v2"
+	"strconv"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/lhaig/godad/pkg/plugin"
+)
+
+// jokes are the jokes the plugin tells
+var jokes = []string{
+	"I used to be a plugin, but then I got compiled.",
+	"Why did the gopher cross the road? To get to the other goroutine.",
+	"I'd tell you a UDP joke, but you might not get it.",
+}
+
+// exampleSource tells one of the jokes at random
+type exampleSource struct{}
+
+func (exampleSource) Name() string     { return "example" }
+func (exampleSource) Language() string { return "en" }
+
+func (exampleSource) Fetch(context.Context) (joke.Joke, error) {
+	// #nosec G404 -- picking a joke does not need a secure random number
+	i := rand.IntN(len(jokes))
+	return joke.Joke{Text: jokes[i], UpstreamID: strconv.Itoa(i)}, nil
+}
+
+func main() {
+	plugin.Serve(exampleSource{})
+}
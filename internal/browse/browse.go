@@ -0,0 +1,420 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+// Package browse is a terminal UI for looking through the stored jokes,
+// searching and filtering them by tag, rating and starring them, and
+// picking one to tell.
+package browse
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/lhaig/godad/pkg/joke"
+)
+
+// StarTag is the tag starred jokes get
+const StarTag = "starred"
+
+// help lists the keys, shown at the bottom of the screen
+const help = "↑/↓ move · / search · t tag · 1-5 rate · s star · enter tell · q quit"
+
+var (
+	selectedStyle = lipgloss.NewStyle().Bold(true).Reverse(true)
+	dimStyle      = lipgloss.NewStyle().Faint(true)
+	headerStyle   = lipgloss.NewStyle().Bold(true)
+	errorStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+)
+
+// mode is what keys are typed into
+type mode int
+
+const (
+	browsing mode = iota
+	searching
+	filteringTag
+)
+
+// Model is the state of the browser. Create it with New and run it with
+// bubbletea; once it quits, Told returns the joke picked to tell, if any.
+type Model struct {
+	ctx   context.Context
+	store joke.Store
+	// jokes are all the jokes being browsed, and shown the indexes of
+	// those matching the search and tag filter
+	jokes []joke.Joke
+	shown []int
+	// cursor is the position of the selected joke in shown, and top the
+	// first one on screen
+	cursor, top   int
+	width, height int
+	mode          mode
+	search        textinput.Model
+	tag           textinput.Model
+	// status is the outcome of the last action, and failed whether it
+	// was an error
+	status string
+	failed bool
+	told   *joke.Joke
+}
+
+// New returns a browser of jokes, which are changed in store
+func New(ctx context.Context, store joke.Store, jokes []joke.Joke) Model {
+	search := textinput.New()
+	search.Prompt = "/"
+	search.Placeholder = "search"
+	tag := textinput.New()
+	tag.Prompt = "tag: "
+	m := Model{
+		ctx:    ctx,
+		store:  store,
+		jokes:  jokes,
+		width:  80,
+		height: 24,
+		search: search,
+		tag:    tag,
+	}
+	m.filter()
+	return m
+}
+
+// SetTag shows only the jokes tagged with tag, as if it was typed after
+// pressing t
+func (m *Model) SetTag(tag string) {
+	m.tag.SetValue(tag)
+	m.filter()
+}
+
+// Told returns the joke picked to tell, marked as told in the store
+func (m Model) Told() (joke.Joke, bool) {
+	if m.told == nil {
+		return joke.Joke{}, false
+	}
+	return *m.told, true
+}
+
+// Init implements tea.Model
+func (m Model) Init() tea.Cmd {
+	return nil
+}
+
+// Update implements tea.Model
+func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		// Terminals that don't know their size report zero
+		if msg.Width > 0 && msg.Height > 0 {
+			m.width, m.height = msg.Width, msg.Height
+		}
+		m.scroll()
+		return m, nil
+	case tea.KeyMsg:
+		if msg.Type == tea.KeyCtrlC {
+			return m, tea.Quit
+		}
+		if m.mode != browsing {
+			return m.updateInput(msg)
+		}
+		return m.updateBrowsing(msg)
+	}
+	return m, nil
+}
+
+// updateInput types msg into the search or tag filter, filtering the
+// jokes as they change
+func (m Model) updateInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	input := &m.search
+	if m.mode == filteringTag {
+		input = &m.tag
+	}
+	switch msg.Type {
+	case tea.KeyEsc:
+		input.SetValue("")
+		fallthrough
+	case tea.KeyEnter:
+		input.Blur()
+		m.mode = browsing
+		m.filter()
+		return m, nil
+	}
+	var cmd tea.Cmd
+	*input, cmd = input.Update(msg)
+	m.filter()
+	return m, cmd
+}
+
+// updateBrowsing acts on the keys pressed while browsing
+func (m Model) updateBrowsing(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.status, m.failed = "", false
+	switch key := msg.String(); key {
+	case "q", "esc":
+		return m, tea.Quit
+	case "up", "k":
+		m.move(-1)
+	case "down", "j":
+		m.move(1)
+	case "pgup":
+		m.move(-m.rows())
+	case "pgdown":
+		m.move(m.rows())
+	case "home", "g":
+		m.move(-len(m.shown))
+	case "end", "G":
+		m.move(len(m.shown))
+	case "/":
+		m.mode = searching
+		cmd := m.search.Focus()
+		return m, cmd
+	case "t":
+		m.mode = filteringTag
+		cmd := m.tag.Focus()
+		return m, cmd
+	case "1", "2", "3", "4", "5":
+		m.rate(int(key[0] - '0'))
+	case "s":
+		m.star()
+	case "enter":
+		if m.tell() {
+			return m, tea.Quit
+		}
+	}
+	return m, nil
+}
+
+// selected returns the selected joke, or nil if no joke is shown
+func (m *Model) selected() *joke.Joke {
+	if len(m.shown) == 0 {
+		return nil
+	}
+	return &m.jokes[m.shown[m.cursor]]
+}
+
+// report sets the status line to the outcome of an action
+func (m *Model) report(err error, format string, args ...any) {
+	if err != nil {
+		m.status, m.failed = err.Error(), true
+		return
+	}
+	m.status = fmt.Sprintf(format, args...)
+}
+
+// rate rates the selected joke
+func (m *Model) rate(rating int) {
+	j := m.selected()
+	if j == nil {
+		return
+	}
+	err := m.store.Rate(m.ctx, j.ID, rating)
+	if err == nil {
+		j.Rating = rating
+	}
+	m.report(err, "Rated joke %d with %d/%d", j.ID, rating, joke.MaxRating)
+}
+
+// star stars the selected joke, or unstars it if it was starred
+func (m *Model) star() {
+	j := m.selected()
+	if j == nil {
+		return
+	}
+	if slices.Contains(j.Tags, StarTag) {
+		err := m.store.RemoveTags(m.ctx, j.ID, StarTag)
+		if err == nil {
+			j.Tags = slices.DeleteFunc(j.Tags, func(t string) bool { return t == StarTag })
+		}
+		m.report(err, "Unstarred joke %d", j.ID)
+		return
+	}
+	err := m.store.AddTags(m.ctx, j.ID, StarTag)
+	if err == nil {
+		j.Tags = append(j.Tags, StarTag)
+		slices.Sort(j.Tags)
+	}
+	m.report(err, "Starred joke %d", j.ID)
+}
+
+// tell marks the selected joke as told and reports whether it did
+func (m *Model) tell() bool {
+	j := m.selected()
+	if j == nil {
+		return false
+	}
+	told := *j
+	if err := m.store.MarkTold(m.ctx, &told); err != nil {
+		m.report(err, "")
+		return false
+	}
+	m.told = &told
+	return true
+}
+
+// filter shows the jokes containing every word searched for and tagged
+// with the tag filtered by, keeping the selected joke selected if it is
+// still shown
+func (m *Model) filter() {
+	var id int64
+	if j := m.selected(); j != nil {
+		id = j.ID
+	}
+	words := strings.Fields(strings.ToLower(m.search.Value()))
+	tag := joke.NormalizeTag(m.tag.Value())
+
+	m.shown = nil
+	m.cursor = 0
+	for i, j := range m.jokes {
+		if tag != "" && !slices.Contains(j.Tags, tag) {
+			continue
+		}
+		text := strings.ToLower(j.Text)
+		if slices.ContainsFunc(words, func(w string) bool { return !strings.Contains(text, w) }) {
+			continue
+		}
+		if j.ID == id {
+			m.cursor = len(m.shown)
+		}
+		m.shown = append(m.shown, i)
+	}
+	m.scroll()
+}
+
+// move moves the selection by n jokes
+func (m *Model) move(n int) {
+	m.cursor = max(0, min(m.cursor+n, len(m.shown)-1))
+	m.scroll()
+}
+
+// scroll keeps the selected joke on screen
+func (m *Model) scroll() {
+	rows := m.rows()
+	if m.cursor < m.top {
+		m.top = m.cursor
+	}
+	if m.cursor >= m.top+rows {
+		m.top = m.cursor - rows + 1
+	}
+	m.top = max(0, min(m.top, len(m.shown)-rows))
+}
+
+// detailHeight is how many lines the selected joke gets below the list
+const detailHeight = 6
+
+// rows returns how many jokes fit on screen, leaving room for the header,
+// the selected joke, the status and the help
+func (m Model) rows() int {
+	return max(1, m.height-detailHeight-5)
+}
+
+// View implements tea.Model
+func (m Model) View() string {
+	var b strings.Builder
+	b.WriteString(headerStyle.Render(m.header()))
+	b.WriteString("\n\n")
+
+	for row := m.top; row < m.top+m.rows(); row++ {
+		if row < len(m.shown) {
+			line := m.line(m.jokes[m.shown[row]])
+			if row == m.cursor {
+				line = selectedStyle.Render(line)
+			}
+			b.WriteString(line)
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\n")
+	b.WriteString(m.detail())
+	b.WriteString("\n")
+
+	switch {
+	case m.mode == searching:
+		b.WriteString(m.search.View())
+	case m.mode == filteringTag:
+		b.WriteString(m.tag.View())
+	case m.failed:
+		b.WriteString(errorStyle.Render(m.status))
+	default:
+		b.WriteString(m.status)
+	}
+	b.WriteString("\n")
+	b.WriteString(dimStyle.Render(truncate(help, m.width)))
+	return b.String()
+}
+
+// header sums up what is shown
+func (m Model) header() string {
+	header := fmt.Sprintf("%d of %d jokes", len(m.shown), len(m.jokes))
+	if search := m.search.Value(); search != "" {
+		header += fmt.Sprintf(" matching %q", search)
+	}
+	if tag := m.tag.Value(); tag != "" {
+		header += fmt.Sprintf(" tagged %q", joke.NormalizeTag(tag))
+	}
+	return truncate(header, m.width)
+}
+
+// line returns the line of j in the list
+func (m Model) line(j joke.Joke) string {
+	star := " "
+	if slices.Contains(j.Tags, StarTag) {
+		star = "*"
+	}
+	text := strings.Join(strings.Fields(j.Text), " ")
+	return truncate(fmt.Sprintf("%6d %s %s  %s", j.ID, star, stars(j.Rating), text), m.width)
+}
+
+// detail returns the selected joke in full with its bookkeeping data,
+// cut to detailHeight lines
+func (m Model) detail() string {
+	j := m.selected()
+	if j == nil {
+		return dimStyle.Render("No jokes match") + strings.Repeat("\n", detailHeight-1)
+	}
+	told := "never told"
+	if j.ToldAt != nil {
+		times := fmt.Sprintf("%d times", j.TimesTold)
+		if j.TimesTold == 1 {
+			times = "once"
+		}
+		told = fmt.Sprintf("told %s, last on %s", times, j.ToldAt.Local().Format("2006-01-02"))
+	}
+	info := fmt.Sprintf("#%d from %s in %s, %s", j.ID, j.Source, j.Language, told)
+	if len(j.Tags) > 0 {
+		info += ", tagged " + strings.Join(j.Tags, ", ")
+	}
+
+	text := lipgloss.NewStyle().Width(max(1, m.width)).Render(j.Text)
+	lines := strings.Split(text, "\n")
+	lines = lines[:min(len(lines), detailHeight-1)]
+	for len(lines) < detailHeight-1 {
+		lines = append(lines, "")
+	}
+	return strings.Join(lines, "\n") + "\n" + dimStyle.Render(truncate(info, m.width))
+}
+
+// stars draws a rating
+func stars(rating int) string {
+	if rating == 0 {
+		return strings.Repeat("·", joke.MaxRating)
+	}
+	return strings.Repeat("★", rating) + strings.Repeat("☆", joke.MaxRating-rating)
+}
+
+// truncate cuts s to width columns, ending it with an ellipsis if it was
+// cut
+func truncate(s string, width int) string {
+	if width <= 0 || lipgloss.Width(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && lipgloss.Width(string(runes))+1 > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
+
+var _ tea.Model = Model{}
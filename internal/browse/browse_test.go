@@ -0,0 +1,130 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package browse
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/lhaig/godad/pkg/joke"
+)
+
+// newTestModel returns a browser of a few jokes saved in a new database
+func newTestModel(t *testing.T) (Model, *joke.SQLiteStore) {
+	t.Helper()
+	ctx := context.Background()
+	store, err := joke.OpenSQLite(filepath.Join(t.TempDir(), "jokes.db"))
+	if err != nil {
+		t.Fatalf("Failed to open the database: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	for _, j := range []joke.Joke{
+		{Text: "Why did the scarecrow win an award? He was outstanding in his field.", Source: "user", Language: "en"},
+		{Text: "I'm reading a book about anti-gravity. It's impossible to put down.", Source: "user", Language: "en", Tags: []string{"books"}},
+		{Text: "What do you call a fake noodle? An impasta.", Source: "user", Language: "en"},
+	} {
+		if err := store.Save(ctx, &j); err != nil {
+			t.Fatalf("Save() returned an error: %v", err)
+		}
+	}
+	jokes, err := store.Export(ctx, joke.ExportFilter{})
+	if err != nil {
+		t.Fatalf("Export() returned an error: %v", err)
+	}
+	return New(ctx, store, jokes), store
+}
+
+// press sends keys to m, typing runes one by one
+func press(m Model, keys ...string) Model {
+	for _, k := range keys {
+		var msg tea.KeyMsg
+		switch k {
+		case "enter":
+			msg = tea.KeyMsg{Type: tea.KeyEnter}
+		case "esc":
+			msg = tea.KeyMsg{Type: tea.KeyEsc}
+		case "down":
+			msg = tea.KeyMsg{Type: tea.KeyDown}
+		default:
+			for _, r := range k {
+				updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+				m = updated.(Model)
+			}
+			continue
+		}
+		updated, _ := m.Update(msg)
+		m = updated.(Model)
+	}
+	return m
+}
+
+func TestBrowseFilter(t *testing.T) {
+	m, _ := newTestModel(t)
+	if len(m.shown) != 3 {
+		t.Fatalf("New() shows %d jokes, want 3", len(m.shown))
+	}
+
+	m = press(m, "/", "IMPOSS")
+	if len(m.shown) != 1 || !strings.Contains(m.selected().Text, "anti-gravity") {
+		t.Errorf("searching shows %v, want the anti-gravity joke", m.shown)
+	}
+	if !strings.Contains(m.View(), `1 of 3 jokes matching "IMPOSS"`) {
+		t.Errorf("View() while searching = %q, want the search in the header", m.View())
+	}
+	m = press(m, "esc")
+	if len(m.shown) != 3 || m.mode != browsing {
+		t.Errorf("Esc while searching shows %v, want the search cleared", m.shown)
+	}
+
+	m = press(m, "t", "Books", "enter")
+	if len(m.shown) != 1 || m.selected().ID != 2 {
+		t.Errorf("filtering by tag shows %v, want the tagged joke", m.shown)
+	}
+	m.SetTag("")
+	if len(m.shown) != 3 || m.selected().ID != 2 {
+		t.Errorf("SetTag(\"\") shows %v with joke %d selected, want every joke with the tagged one still selected", m.shown, m.selected().ID)
+	}
+}
+
+func TestBrowseActions(t *testing.T) {
+	ctx := context.Background()
+	m, store := newTestModel(t)
+
+	m = press(m, "down", "4", "s")
+	got, err := store.Get(ctx, 2)
+	if err != nil {
+		t.Fatalf("Get() returned an error: %v", err)
+	}
+	if got.Rating != 4 || !slices.Contains(got.Tags, StarTag) {
+		t.Errorf("rating and starring stored %+v, want it rated 4 and starred", got)
+	}
+	if !strings.Contains(m.View(), "★★★★☆") {
+		t.Errorf("View() = %q, want the rating shown", m.View())
+	}
+	m = press(m, "s")
+	if got, _ := store.Get(ctx, 2); slices.Contains(got.Tags, StarTag) {
+		t.Errorf("starring a starred joke stored %+v, want it unstarred", got)
+	}
+
+	if _, ok := m.Told(); ok {
+		t.Error("Told() before telling a joke = true, want false")
+	}
+	updated, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(Model)
+	if cmd == nil {
+		t.Error("telling a joke didn't quit")
+	}
+	told, ok := m.Told()
+	if !ok || told.ID != 2 {
+		t.Errorf("Told() = %+v, %v, want the selected joke", told, ok)
+	}
+	if got, _ := store.Get(ctx, 2); got.TimesTold != 1 {
+		t.Errorf("telling a joke stored %+v, want it told once", got)
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+// Package card draws jokes onto images, for posting them to channels that
+// only take images.
+package card
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	// Templates may be JPEG or PNG images
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	// DefaultWidth and DefaultHeight are the size of link previews on most
+	// social networks
+	DefaultWidth  = 1200
+	DefaultHeight = 630
+	// DefaultSize is the largest font size used, in pixels
+	DefaultSize = 64
+	// minSize is the smallest font size jokes are shrunk to
+	minSize = 12
+)
+
+// Options configure how a joke is drawn. Zero fields get defaults.
+type Options struct {
+	// Width and Height are the size of the image, unless it is drawn onto
+	// Template
+	Width, Height int
+	// Template is an image the joke is drawn onto, instead of a plain
+	// Background
+	Template   image.Image
+	Background color.Color
+	Foreground color.Color
+	// Font is the font of the joke, Go Regular by default
+	Font *opentype.Font
+	// Size is the largest font size, in pixels. Long jokes get smaller
+	// ones until they fit.
+	Size float64
+	// Margin is the space left around the joke, in pixels. It defaults to
+	// a twentieth of the width.
+	Margin int
+}
+
+// Render draws j centered onto an image, with its punchline below the
+// setup. Jokes too long to fit even in the smallest font are cut short.
+func Render(j joke.Joke, opts Options) (*image.RGBA, error) {
+	var bounds image.Rectangle
+	if opts.Template != nil {
+		bounds = image.Rect(0, 0, opts.Template.Bounds().Dx(), opts.Template.Bounds().Dy())
+	} else {
+		bounds = image.Rect(0, 0, orDefault(opts.Width, DefaultWidth), orDefault(opts.Height, DefaultHeight))
+	}
+	if bounds.Dx() < 1 || bounds.Dy() < 1 {
+		return nil, fmt.Errorf("invalid image size %dx%d", bounds.Dx(), bounds.Dy())
+	}
+	img := image.NewRGBA(bounds)
+	if opts.Template != nil {
+		draw.Draw(img, bounds, opts.Template, opts.Template.Bounds().Min, draw.Src)
+	} else {
+		draw.Draw(img, bounds, image.NewUniform(colorOr(opts.Background, color.White)), image.Point{}, draw.Src)
+	}
+
+	f := opts.Font
+	if f == nil {
+		var err error
+		if f, err = opentype.Parse(goregular.TTF); err != nil {
+			return nil, fmt.Errorf("error loading font: %w", err)
+		}
+	}
+	margin := opts.Margin
+	if margin <= 0 {
+		margin = bounds.Dx() / 20
+	}
+	area := bounds.Inset(margin)
+	if area.Empty() {
+		return nil, errors.New("margin leaves no room for the joke")
+	}
+
+	setup, punchline := joke.SplitJoke(j.Text)
+	paragraphs := []string{setup}
+	if punchline != "" {
+		paragraphs = append(paragraphs, punchline)
+	}
+
+	// Shrink the font until the joke fits
+	var (
+		face  font.Face
+		lines []string
+	)
+	for size := orDefault(opts.Size, DefaultSize); ; size *= 0.9 {
+		size = max(size, minSize)
+		var err error
+		face, err = opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+		if err != nil {
+			return nil, fmt.Errorf("error loading font: %w", err)
+		}
+		lines = wrap(face, paragraphs, area.Dx())
+		if lineHeight(face)*len(lines) <= area.Dy() || size == minSize {
+			break
+		}
+		face.Close()
+	}
+	defer face.Close()
+	height := lineHeight(face)
+	if fit := max(area.Dy()/height, 1); len(lines) > fit {
+		// Even the smallest font is too large, so cut the joke short
+		lines = lines[:fit]
+		lines[fit-1] += " …"
+	}
+
+	d := &font.Drawer{Dst: img, Src: image.NewUniform(colorOr(opts.Foreground, color.Black)), Face: face}
+	y := area.Min.Y + (area.Dy()-height*len(lines))/2 + face.Metrics().Ascent.Ceil()
+	for _, line := range lines {
+		width := d.MeasureString(line).Ceil()
+		d.Dot = fixed.P(area.Min.X+(area.Dx()-width)/2, y)
+		d.DrawString(line)
+		y += height
+	}
+	return img, nil
+}
+
+// wrap breaks paragraphs into lines no wider than width, with an empty
+// line between paragraphs. Words wider than width get a line of their own.
+func wrap(face font.Face, paragraphs []string, width int) []string {
+	var lines []string
+	for i, p := range paragraphs {
+		if i > 0 {
+			lines = append(lines, "")
+		}
+		line := ""
+		for _, word := range strings.Fields(p) {
+			next := word
+			if line != "" {
+				next = line + " " + word
+			}
+			if line != "" && font.MeasureString(face, next).Ceil() > width {
+				lines = append(lines, line)
+				next = word
+			}
+			line = next
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// lineHeight returns the distance between lines of face, in pixels
+func lineHeight(face font.Face) int {
+	return face.Metrics().Height.Ceil() * 5 / 4
+}
+
+// LoadFont reads a TrueType or OpenType font file
+func LoadFont(path string) (*opentype.Font, error) {
+	b, err := os.ReadFile(path) // #nosec G304 -- the font is chosen by the user
+	if err != nil {
+		return nil, fmt.Errorf("error reading font: %w", err)
+	}
+	f, err := opentype.Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("error reading font %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// LoadImage reads a PNG or JPEG image to draw jokes onto
+func LoadImage(path string) (image.Image, error) {
+	file, err := os.Open(path) // #nosec G304 -- the template is chosen by the user
+	if err != nil {
+		return nil, fmt.Errorf("error reading template: %w", err)
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading template %s: %w", path, err)
+	}
+	return img, nil
+}
+
+// ParseColor parses a color like #fff, #1e1e2e or #1e1e2ecc
+func ParseColor(s string) (color.Color, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 8 || !strings.HasPrefix(s, "#") || err != nil {
+		return nil, fmt.Errorf("invalid color %q, use one like #1e1e2e", s)
+	}
+	// Alpha premultiplied, as color.RGBA wants
+	a := uint32(v & 0xff)
+	premultiply := func(c uint64) uint8 { return uint8(uint32(c&0xff) * a / 0xff) }
+	return color.RGBA{R: premultiply(v >> 24), G: premultiply(v >> 16), B: premultiply(v >> 8), A: uint8(a)}, nil
+}
+
+// orDefault returns v, or def if v isn't positive
+func orDefault[T int | float64](v, def T) T {
+	if v > 0 {
+		return v
+	}
+	return def
+}
+
+// colorOr returns c, or def if c is nil
+func colorOr(c, def color.Color) color.Color {
+	if c == nil {
+		return def
+	}
+	return c
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package card
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+)
+
+// inked returns the rows of img with a pixel in another color than bg
+func inked(img *image.RGBA, bg color.Color) []int {
+	r0, g0, b0, _ := bg.RGBA()
+	var rows []int
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			if r, g, b, _ := img.At(x, y).RGBA(); r != r0 || g != g0 || b != b0 {
+				rows = append(rows, y)
+				break
+			}
+		}
+	}
+	return rows
+}
+
+func TestRender(t *testing.T) {
+	j := joke.Joke{Text: "Why did the scarecrow win an award? Because he was outstanding in his field."}
+	bg := color.RGBA{R: 0x1e, G: 0x1e, B: 0x2e, A: 0xff}
+	img, err := Render(j, Options{Width: 600, Height: 300, Background: bg, Foreground: color.White})
+	if err != nil {
+		t.Fatalf("Render() returned an error: %v", err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 600, 300) {
+		t.Errorf("Render() drew an image of %v, want 600x300", img.Bounds())
+	}
+	if img.At(0, 0) != bg {
+		t.Errorf("Render() drew a corner in %v, want the background %v", img.At(0, 0), bg)
+	}
+	rows := inked(img, bg)
+	if len(rows) == 0 {
+		t.Fatal("Render() drew no text")
+	}
+	if rows[0] < 15 || rows[len(rows)-1] > 285 {
+		t.Errorf("Render() drew text from row %d to %d, want it within the margin", rows[0], rows[len(rows)-1])
+	}
+
+	// Long jokes are shrunk to fit
+	long := joke.Joke{Text: strings.Repeat("This joke goes on and on. ", 40)}
+	img, err = Render(long, Options{Width: 400, Height: 200, Background: bg})
+	if err != nil {
+		t.Fatalf("Render() of a long joke returned an error: %v", err)
+	}
+	if rows := inked(img, bg); len(rows) == 0 || rows[0] < 20 || rows[len(rows)-1] > 180 {
+		t.Errorf("Render() of a long joke drew text in rows %v, want it within the margin", rows)
+	}
+
+	// Templates set the size
+	tmpl := image.NewRGBA(image.Rect(10, 10, 330, 250))
+	if img, err := Render(j, Options{Template: tmpl, Width: 1000}); err != nil || img.Bounds() != image.Rect(0, 0, 320, 240) {
+		t.Errorf("Render() onto a template = %v, %v, want the size of the template", img.Bounds(), err)
+	}
+	if _, err := Render(j, Options{Width: 100, Height: 100, Margin: 50}); err == nil {
+		t.Error("Render() with no room left by the margin returned no error")
+	}
+}
+
+func TestWrap(t *testing.T) {
+	f, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: 10, DPI: 72})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer face.Close()
+
+	lines := wrap(face, []string{"one two three four", "five"}, 40)
+	want := []string{"one two", "three", "four", "", "five"}
+	if strings.Join(lines, "|") != strings.Join(want, "|") {
+		t.Errorf("wrap() = %q, want %q", lines, want)
+	}
+	if lines := wrap(face, []string{"incomprehensibilities"}, 10); len(lines) != 1 {
+		t.Errorf("wrap() of a long word = %q, want it on a line of its own", lines)
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want color.Color
+	}{
+		{in: "#fff", want: color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}},
+		{in: "#1e1e2e", want: color.RGBA{R: 0x1e, G: 0x1e, B: 0x2e, A: 0xff}},
+		{in: "#ff000080", want: color.RGBA{R: 0x80, A: 0x80}},
+	} {
+		if got, err := ParseColor(tc.in); err != nil || got != tc.want {
+			t.Errorf("ParseColor(%q) = %v, %v, want %v", tc.in, got, err, tc.want)
+		}
+	}
+	for _, in := range []string{"fff", "#ffff", "#gggggg", "red", ""} {
+		if _, err := ParseColor(in); err == nil {
+			t.Errorf("ParseColor(%q) returned no error", in)
+		}
+	}
+}
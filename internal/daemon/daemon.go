@@ -0,0 +1,149 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+// Package daemon tells jokes on a schedule and delivers them to sinks, such
+// as a file, a desktop notification or a webhook.
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultSchedule delivers a joke every weekday morning
+const DefaultSchedule = "0 9 * * MON-FRI"
+
+// DefaultSinkTimeout is how long a sink may take to deliver a joke
+const DefaultSinkTimeout = 30 * time.Second
+
+// Schedule returns the next delivery time after a given time
+type Schedule interface {
+	Next(time.Time) time.Time
+}
+
+// ParseSchedule parses a standard five field cron expression like
+// "0 9 * * MON-FRI", or a descriptor like "@hourly" or "@every 30m"
+func ParseSchedule(spec string) (Schedule, error) {
+	sched, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing schedule %q: %w", spec, err)
+	}
+	return sched, nil
+}
+
+// TellFunc tells the joke to deliver
+type TellFunc func(ctx context.Context) (joke.Joke, error)
+
+// Daemon delivers a joke to every sink whenever the schedule fires
+type Daemon struct {
+	Schedule Schedule
+	Tell     TellFunc
+	Sinks    []Sink
+	// SinkTimeout is how long each sink may take to deliver a joke, so a
+	// webhook that never answers doesn't hold up the deliveries after it,
+	// DefaultSinkTimeout if zero
+	SinkTimeout time.Duration
+
+	// mu guards the fields above, which Update may change while the daemon
+	// runs
+	mu sync.Mutex
+	// updated wakes Run up to reschedule after an update
+	updated chan struct{}
+}
+
+// Update replaces the schedule, the teller, the sinks and their timeout
+// of a running daemon, e.g. after the settings changed. The next delivery
+// is rescheduled at once.
+func (d *Daemon) Update(schedule Schedule, tell TellFunc, sinks []Sink, sinkTimeout time.Duration) {
+	d.mu.Lock()
+	d.Schedule, d.Tell, d.Sinks, d.SinkTimeout = schedule, tell, sinks, sinkTimeout
+	updated := d.updates()
+	d.mu.Unlock()
+	select {
+	case updated <- struct{}{}:
+	default:
+		// Run is already due to reschedule
+	}
+}
+
+// updates returns the channel Update wakes Run up through. d.mu must be
+// held.
+func (d *Daemon) updates() chan struct{} {
+	if d.updated == nil {
+		d.updated = make(chan struct{}, 1)
+	}
+	return d.updated
+}
+
+// Run delivers jokes until ctx is canceled. Failed deliveries are logged
+// and do not stop the daemon.
+func (d *Daemon) Run(ctx context.Context) error {
+	for {
+		d.mu.Lock()
+		schedule, sinks, updated := d.Schedule, len(d.Sinks), d.updates()
+		d.mu.Unlock()
+		if sinks == 0 {
+			return errors.New("no sinks to deliver jokes to")
+		}
+		next := schedule.Next(time.Now())
+		if next.IsZero() {
+			return errors.New("schedule never fires")
+		}
+		log.Debug().Time("next", next).Msg("Waiting for the next delivery")
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-updated:
+			timer.Stop()
+			continue
+		case <-timer.C:
+		}
+
+		if err := d.Deliver(ctx); err != nil {
+			log.Error().Err(err).Msg("Failed to deliver a joke")
+		}
+	}
+}
+
+// Deliver tells a joke and sends it to every sink. Every sink is tried,
+// even when an earlier one fails or times out.
+func (d *Daemon) Deliver(ctx context.Context) error {
+	d.mu.Lock()
+	tell, sinks, timeout := d.Tell, d.Sinks, d.SinkTimeout
+	d.mu.Unlock()
+	if timeout <= 0 {
+		timeout = DefaultSinkTimeout
+	}
+
+	j, err := tell(ctx)
+	if err != nil {
+		return fmt.Errorf("error telling joke: %w", err)
+	}
+
+	var errs []error
+	for _, sink := range sinks {
+		if err := deliver(ctx, sink, j, timeout); err != nil {
+			errs = append(errs, fmt.Errorf("error delivering to %s: %w", sink.Name(), err))
+			continue
+		}
+		log.Info().Str("sink", sink.Name()).Int64("id", j.ID).Msg("Delivered joke")
+	}
+	return errors.Join(errs...)
+}
+
+// deliver sends j to sink, giving up after timeout
+func deliver(ctx context.Context, sink Sink, j joke.Joke, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return sink.Deliver(ctx, j)
+}
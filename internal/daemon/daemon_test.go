@@ -0,0 +1,204 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lhaig/godad/pkg/joke"
+)
+
+// everySchedule fires at a fixed interval
+type everySchedule time.Duration
+
+func (s everySchedule) Next(t time.Time) time.Time { return t.Add(time.Duration(s)) }
+
+// failingSink fails every delivery
+type failingSink struct{}
+
+func (failingSink) Name() string                             { return "failing" }
+func (failingSink) Deliver(context.Context, joke.Joke) error { return errors.New("out of order") }
+
+func TestDaemonRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jokes.txt")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	told := 0
+	d := &Daemon{
+		Schedule: everySchedule(5 * time.Millisecond),
+		Tell: func(context.Context) (joke.Joke, error) {
+			told++
+			if told == 3 {
+				cancel()
+			}
+			return joke.Joke{Text: "I'm on a seafood diet. I see food and I eat it."}, nil
+		},
+		// A failing sink does not keep the others from getting the joke
+		Sinks: []Sink{failingSink{}, &FileSink{Path: path}},
+	}
+	if err := d.Run(ctx); err != nil {
+		t.Fatalf("Run() returned an error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 3 {
+		t.Errorf("File has %d jokes, want 3:\n%s", lines, data)
+	}
+}
+
+// hangingSink never answers, like a webhook that accepts the connection
+// and sends nothing back
+type hangingSink struct{}
+
+func (hangingSink) Name() string { return "hanging" }
+
+func (hangingSink) Deliver(ctx context.Context, _ joke.Joke) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestDaemonSinkTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jokes.txt")
+	d := &Daemon{
+		Tell: func(context.Context) (joke.Joke, error) {
+			return joke.Joke{Text: "Why don't eggs tell jokes? They'd crack each other up."}, nil
+		},
+		Sinks:       []Sink{hangingSink{}, &FileSink{Path: path}},
+		SinkTimeout: 10 * time.Millisecond,
+	}
+
+	done := make(chan error)
+	go func() { done <- d.Deliver(context.Background()) }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Deliver() returned %v, want the hanging sink timed out", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Deliver() waited for the hanging sink")
+	}
+	if data, err := os.ReadFile(path); err != nil || !strings.Contains(string(data), "eggs") {
+		t.Errorf("File = %q, %v, want the joke after the hanging sink", data, err)
+	}
+}
+
+func TestDaemonUpdate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	d := &Daemon{
+		Schedule: everySchedule(time.Hour),
+		Tell: func(context.Context) (joke.Joke, error) {
+			t.Error("Tell() of the daemon before the update was called")
+			return joke.Joke{}, errors.New("replaced")
+		},
+		Sinks: []Sink{failingSink{}},
+	}
+	done := make(chan error)
+	go func() { done <- d.Run(ctx) }()
+
+	// The new schedule applies at once, not after the hour
+	path := filepath.Join(t.TempDir(), "jokes.txt")
+	d.Update(everySchedule(5*time.Millisecond), func(context.Context) (joke.Joke, error) {
+		cancel()
+		return joke.Joke{Text: "I'm reading a book about anti-gravity. It's impossible to put down."}, nil
+	}, []Sink{&FileSink{Path: path}}, 0)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run() returned an error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() didn't deliver with the updated schedule")
+	}
+	if data, err := os.ReadFile(path); err != nil || !strings.Contains(string(data), "anti-gravity") {
+		t.Errorf("File = %q, %v, want the joke of the updated daemon", data, err)
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	sched, err := ParseSchedule(DefaultSchedule)
+	if err != nil {
+		t.Fatalf("ParseSchedule() returned an error: %v", err)
+	}
+	// Saturday 10:00 is followed by Monday 9:00
+	saturday := time.Date(2024, 5, 4, 10, 0, 0, 0, time.Local)
+	if got, want := sched.Next(saturday), time.Date(2024, 5, 6, 9, 0, 0, 0, time.Local); !got.Equal(want) {
+		t.Errorf("Next(%v) = %v, want %v", saturday, got, want)
+	}
+
+	if _, err := ParseSchedule("every morning"); err == nil {
+		t.Error("ParseSchedule() accepted an invalid schedule")
+	}
+}
+
+func TestParseSink(t *testing.T) {
+	testCases := []struct {
+		spec string
+		name string
+	}{
+		{spec: "stdout", name: "stdout"},
+		{spec: "notify", name: "notify"},
+		{spec: "file:/tmp/jokes.txt", name: "file:/tmp/jokes.txt"},
+		{spec: "webhook:https://example.com/hook", name: "webhook"},
+		{spec: "file:"},
+		{spec: "pigeon"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.spec, func(t *testing.T) {
+			sink, err := ParseSink(tc.spec)
+			if tc.name == "" {
+				if err == nil {
+					t.Errorf("ParseSink(%q) accepted an invalid sink", tc.spec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSink(%q) returned an error: %v", tc.spec, err)
+			}
+			if sink.Name() != tc.name {
+				t.Errorf("ParseSink(%q) returned sink %s, want %s", tc.spec, sink.Name(), tc.name)
+			}
+		})
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var got map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("Webhook received invalid JSON: %v", err)
+		}
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	j := joke.Joke{ID: 7, Text: "Why don't eggs tell jokes? They'd crack up.", Source: "embedded"}
+	if err := NewWebhookSink(srv.URL).Deliver(context.Background(), j); err != nil {
+		t.Fatalf("Deliver() returned an error: %v", err)
+	}
+	if got["text"] != j.Text || got["joke"] != j.Text || got["source"] != j.Source {
+		t.Errorf("Webhook received %v", got)
+	}
+
+	if err := NewWebhookSink(srv.URL+"/broken").Deliver(context.Background(), j); err == nil {
+		t.Error("Deliver() ignored a server error")
+	}
+}
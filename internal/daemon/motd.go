@@ -0,0 +1,89 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lhaig/godad/pkg/joke"
+)
+
+// scriptDelimiter ends the here-document in MOTD scripts
+const scriptDelimiter = "GODAD_JOKE"
+
+// MotdSink replaces the contents of a file with the latest joke, so it can
+// be shown in the message of the day or a shell greeting without waiting
+// for the network at login. The file is replaced atomically, so readers
+// never see a partly written joke.
+type MotdSink struct {
+	Path string
+	// Script writes an executable shell script printing the joke instead
+	// of plain text, as needed by /etc/update-motd.d
+	Script bool
+}
+
+// NewMotdSink returns a sink writing to path. Files in an update-motd.d
+// directory are written as scripts.
+func NewMotdSink(path string) *MotdSink {
+	return &MotdSink{
+		Path:   path,
+		Script: filepath.Base(filepath.Dir(path)) == "update-motd.d",
+	}
+}
+
+// Name implements Sink
+func (s *MotdSink) Name() string { return "motd:" + s.Path }
+
+// Deliver implements Sink
+func (s *MotdSink) Deliver(_ context.Context, j joke.Joke) error {
+	data, perm := j.Text+"\n", os.FileMode(0o644)
+	if s.Script {
+		data, perm = motdScript(j.Text), 0o755
+	}
+	return writeFileAtomic(s.Path, []byte(data), perm)
+}
+
+// motdScript returns a shell script printing text
+func motdScript(text string) string {
+	// A line matching the delimiter would end the here-document early
+	var lines []string
+	for _, l := range strings.Split(text, "\n") {
+		if l != scriptDelimiter {
+			lines = append(lines, l)
+		}
+	}
+	return fmt.Sprintf("#!/bin/sh\n# Written by godad, changes will be overwritten\ncat <<'%s'\n%s\n%s\n",
+		scriptDelimiter, strings.Join(lines, "\n"), scriptDelimiter)
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it over path once it is complete
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package daemon
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/lhaig/godad/pkg/joke"
+)
+
+func TestMotdSink(t *testing.T) {
+	dir := t.TempDir()
+	j := joke.Joke{Text: "It's a 'quote' with $HOME and `backticks`\n" + scriptDelimiter}
+
+	plain := NewMotdSink(filepath.Join(dir, "motd"))
+	if plain.Script {
+		t.Fatal("NewMotdSink() writes a script outside of update-motd.d")
+	}
+	for i := 0; i < 2; i++ {
+		if err := plain.Deliver(context.Background(), j); err != nil {
+			t.Fatalf("Deliver() returned an error: %v", err)
+		}
+	}
+	data, err := os.ReadFile(plain.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != j.Text+"\n" {
+		t.Errorf("File contains %q, want only the latest joke", data)
+	}
+
+	if err := os.Mkdir(filepath.Join(dir, "update-motd.d"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	script := NewMotdSink(filepath.Join(dir, "update-motd.d", "99-dadjoke"))
+	if !script.Script {
+		t.Fatal("NewMotdSink() writes plain text in update-motd.d")
+	}
+	if err := script.Deliver(context.Background(), j); err != nil {
+		t.Fatalf("Deliver() returned an error: %v", err)
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("No shell to run the script with")
+	}
+	out, err := exec.Command(script.Path).Output()
+	if err != nil {
+		t.Fatalf("Running the script failed: %v", err)
+	}
+	if want := "It's a 'quote' with $HOME and `backticks`\n"; string(out) != want {
+		t.Errorf("Script printed %q, want %q", out, want)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("Temporary files were left behind: %v", entries)
+	}
+}
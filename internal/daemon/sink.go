@@ -0,0 +1,138 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/lhaig/godad/internal/notify"
+	"github.com/lhaig/godad/pkg/joke"
+)
+
+// Sink is somewhere jokes are delivered to
+type Sink interface {
+	// Name describes the sink in logs
+	Name() string
+	// Deliver sends a joke to the sink
+	Deliver(ctx context.Context, j joke.Joke) error
+}
+
+// ParseSink returns the sink described by spec, one of "stdout",
+// "file:<path>", "motd:<path>", "webhook:<url>" or "notify"
+func ParseSink(spec string) (Sink, error) {
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch {
+	case spec == "stdout":
+		return &WriterSink{Out: os.Stdout}, nil
+	case spec == "notify":
+		return &NotifySink{}, nil
+	case kind == "file" && arg != "":
+		return &FileSink{Path: arg}, nil
+	case kind == "motd" && arg != "":
+		return NewMotdSink(arg), nil
+	case kind == "webhook" && arg != "":
+		return NewWebhookSink(arg), nil
+	default:
+		return nil, fmt.Errorf("unknown sink %q, use stdout, file:<path>, motd:<path>, webhook:<url> or notify", spec)
+	}
+}
+
+// WriterSink writes each joke on a line of its own
+type WriterSink struct {
+	Out io.Writer
+}
+
+// Name implements Sink
+func (s *WriterSink) Name() string { return "stdout" }
+
+// Deliver implements Sink
+func (s *WriterSink) Deliver(_ context.Context, j joke.Joke) error {
+	_, err := fmt.Fprintln(s.Out, j.Text)
+	return err
+}
+
+// FileSink appends each joke to a file. The file is opened for every
+// delivery, so it can be rotated or removed in between.
+type FileSink struct {
+	Path string
+}
+
+// Name implements Sink
+func (s *FileSink) Name() string { return "file:" + s.Path }
+
+// Deliver implements Sink
+func (s *FileSink) Deliver(_ context.Context, j joke.Joke) error {
+	f, err := os.OpenFile(s.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, j.Text); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WebhookSink posts each joke as JSON to a URL
+type WebhookSink struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewWebhookSink returns a sink posting jokes to url
+func NewWebhookSink(url string) *WebhookSink {
+	return &WebhookSink{URL: url, Client: joke.DefaultHTTPClient}
+}
+
+// webhookPayload is the joke with its text repeated in a text field, which
+// chat services like Slack and Mattermost show as the message
+type webhookPayload struct {
+	joke.Joke
+	Message string `json:"text"`
+}
+
+// Name implements Sink
+func (s *WebhookSink) Name() string { return "webhook" }
+
+// Deliver implements Sink
+func (s *WebhookSink) Deliver(ctx context.Context, j joke.Joke) error {
+	body, err := json.Marshal(webhookPayload{Joke: j, Message: j.Text})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", joke.UserAgent)
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %s", resp.Status)
+	}
+	return nil
+}
+
+// NotifySink raises a desktop notification for each joke
+type NotifySink struct{}
+
+// Name implements Sink
+func (s *NotifySink) Name() string { return "notify" }
+
+// Deliver implements Sink
+func (s *NotifySink) Deliver(ctx context.Context, j joke.Joke) error {
+	return notify.Send(ctx, notify.DefaultTitle, j.Text)
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+// Package notify raises native desktop notifications with the tools that
+// come with the operating system: notify-send on Linux and BSD, osascript
+// on macOS and PowerShell on Windows.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// DefaultTitle is the title of joke notifications
+const DefaultTitle = "Dad joke"
+
+// ErrUnsupported is returned on systems without a known notification tool
+var ErrUnsupported = errors.New("desktop notifications are not supported on this system")
+
+// macScript shows a notification with the title and message passed as
+// arguments, so they need no escaping
+var macScript = []string{
+	"-e", "on run argv",
+	"-e", "display notification (item 2 of argv) with title (item 1 of argv)",
+	"-e", "end run",
+}
+
+// windowsScript shows a toast notification with the title and message read
+// from the environment, so they need no escaping
+const windowsScript = `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] | Out-Null
+$template = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $template.GetElementsByTagName('text')
+$text.Item(0).AppendChild($template.CreateTextNode($env:GODAD_NOTIFY_TITLE)) | Out-Null
+$text.Item(1).AppendChild($template.CreateTextNode($env:GODAD_NOTIFY_MESSAGE)) | Out-Null
+$toast = [Windows.UI.Notifications.ToastNotification]::new($template)
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('godad').Show($toast)`
+
+// Send raises a desktop notification
+func Send(ctx context.Context, title, message string) error {
+	cmd, err := command(ctx, runtime.GOOS, title, message)
+	if err != nil {
+		return err
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("error running %s: %w: %s", cmd.Args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// command returns the command raising a notification on goos
+func command(ctx context.Context, goos, title, message string) (*exec.Cmd, error) {
+	switch goos {
+	case "darwin":
+		args := append(append([]string{}, macScript...), title, message)
+		return exec.CommandContext(ctx, "osascript", args...), nil
+	case "windows":
+		cmd := exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", windowsScript)
+		cmd.Env = append(cmd.Environ(), "GODAD_NOTIFY_TITLE="+title, "GODAD_NOTIFY_MESSAGE="+message)
+		return cmd, nil
+	case "linux", "freebsd", "openbsd", "netbsd", "dragonfly":
+		return exec.CommandContext(ctx, "notify-send", "--app-name=godad", title, message), nil
+	default:
+		return nil, ErrUnsupported
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package notify
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestCommand(t *testing.T) {
+	const title, message = "Dad joke", `He said "it's outstanding" & left`
+
+	testCases := []struct {
+		goos string
+		name string
+	}{
+		{goos: "linux", name: "notify-send"},
+		{goos: "darwin", name: "osascript"},
+		{goos: "windows", name: "powershell"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.goos, func(t *testing.T) {
+			cmd, err := command(context.Background(), tc.goos, title, message)
+			if err != nil {
+				t.Fatalf("command() returned an error: %v", err)
+			}
+			if cmd.Args[0] != tc.name {
+				t.Errorf("command() runs %s, want %s", cmd.Args[0], tc.name)
+			}
+			// The message is passed on unchanged instead of being quoted
+			// into a script
+			if !slices.Contains(cmd.Args, message) && !slices.Contains(cmd.Env, "GODAD_NOTIFY_MESSAGE="+message) {
+				t.Errorf("command() does not pass the message as is: %q", cmd.Args)
+			}
+		})
+	}
+
+	if _, err := command(context.Background(), "plan9", title, message); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("command() on plan9 returned %v, want ErrUnsupported", err)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/rs/zerolog/log"
+)
+
+// errNoKey is returned to clients without a valid API key
+var errNoKey = errors.New("a valid API key is required, as a bearer token or in the X-API-Key header")
+
+// keyContext is the context key of the API key of a request
+type keyContext struct{}
+
+// RequireKeys makes clients of the API authenticate with a key from keys.
+// The joke pages and the specification stay public.
+func (s *Server) RequireKeys(keys joke.KeyStore) {
+	s.keys = keys
+}
+
+// authenticated wraps a handler of the API, turning away clients without
+// a valid key when keys are required. The handler finds the key in the
+// context of the request.
+func (s *Server) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.keys == nil {
+			next(w, r)
+			return
+		}
+
+		token := requestKey(r)
+		if token == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errNoKey)
+			return
+		}
+		key, err := s.keys.KeyByHash(r.Context(), joke.HashAPIKey(token))
+		if errors.Is(err, joke.ErrKeyNotFound) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			writeError(w, http.StatusUnauthorized, errNoKey)
+			return
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to look up API key")
+			writeError(w, http.StatusInternalServerError, errors.New("error checking API key"))
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), keyContext{}, key)))
+	}
+}
+
+// requestKey returns the API key of a request, given as a bearer token or
+// in the X-API-Key header
+func requestKey(r *http.Request) string {
+	if scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return r.Header.Get("X-API-Key")
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lhaig/godad/pkg/joke"
+)
+
+func TestRequireKeys(t *testing.T) {
+	s, store := newTestHandler(t)
+	s.RequireKeys(store)
+	s.LimitRate(&MemoryLimiter{}, 2)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	ctx := context.Background()
+	key, hash, err := joke.NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddKey(ctx, &joke.APIKey{Name: "office-tv", Hash: hash}); err != nil {
+		t.Fatal(err)
+	}
+	revoked, revokedHash, _ := joke.NewAPIKey()
+	if err := store.AddKey(ctx, &joke.APIKey{Name: "old", Hash: revokedHash}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.RevokeKey(ctx, "old"); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path string, header http.Header) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		req.Header = header
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s returned an error: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	for _, tc := range []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{name: "no key", want: http.StatusUnauthorized},
+		{name: "unknown key", header: http.Header{"X-Api-Key": {"godad_unknown"}}, want: http.StatusUnauthorized},
+		{name: "revoked key", header: http.Header{"Authorization": {"Bearer " + revoked}}, want: http.StatusUnauthorized},
+		{name: "bearer token", header: http.Header{"Authorization": {"Bearer " + key}}, want: http.StatusOK},
+		{name: "header", header: http.Header{"X-Api-Key": {key}}, want: http.StatusOK},
+	} {
+		if resp := get("/joke", tc.header); resp.StatusCode != tc.want {
+			t.Errorf("GET /joke with %s returned status %d, want %d", tc.name, resp.StatusCode, tc.want)
+		}
+	}
+
+	// Both requests used up the rate limit of the key
+	resp := get("/history", http.Header{"X-Api-Key": {key}})
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "30" {
+		t.Errorf("GET /history over the rate limit returned status %d, Retry-After %q, want %d and 30",
+			resp.StatusCode, resp.Header.Get("Retry-After"), http.StatusTooManyRequests)
+	}
+
+	// The joke pages and the specification are public
+	if resp := get("/openapi.json", nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /openapi.json without a key returned status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if resp := get(fmt.Sprintf("/j/%d", 1), nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /j/1 without a key returned status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
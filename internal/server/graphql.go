@@ -0,0 +1,283 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/lhaig/godad/pkg/joke"
+)
+
+const (
+	// defaultPageSize is how many jokes a GraphQL list returns unless
+	// asked for fewer or more, up to maxPageSize
+	defaultPageSize = 20
+	maxPageSize     = 100
+	// favoriteRating is the lowest rating of a favorite joke unless the
+	// query asks for another one
+	favoriteRating = joke.MaxRating - 1
+)
+
+// graphQLRequest is a GraphQL query, sent as JSON or in the parameters of
+// a GET request
+type graphQLRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// handleGraphQL answers GraphQL queries about the stored jokes, their
+// tags and statistics
+func (s *Server) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req graphQLRequest
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				writeError(w, http.StatusBadRequest, errors.New("variables must be a JSON object"))
+				return
+			}
+		}
+	} else if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("error decoding query: %w", err))
+		return
+	}
+	if req.Query == "" {
+		writeError(w, http.StatusBadRequest, errors.New("query is required"))
+		return
+	}
+
+	// Like most GraphQL servers, answer errors in the query with 200 OK
+	// and the errors in the result
+	writeJSON(w, http.StatusOK, graphql.Do(graphql.Params{
+		Schema:         s.schema,
+		RequestString:  req.Query,
+		OperationName:  req.OperationName,
+		VariableValues: req.Variables,
+		Context:        r.Context(),
+	}))
+}
+
+// newSchema returns the GraphQL schema of the server, resolving queries
+// with its store
+func (s *Server) newSchema() (graphql.Schema, error) {
+	jokeType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Joke",
+		Description: "A stored joke",
+		Fields: graphql.Fields{
+			"id":         jokeField(graphql.NewNonNull(graphql.ID), "Local ID of the joke", func(j joke.Joke) any { return strconv.FormatInt(j.ID, 10) }),
+			"text":       jokeField(graphql.NewNonNull(graphql.String), "The joke itself", func(j joke.Joke) any { return j.Text }),
+			"upstreamId": jokeField(graphql.String, "ID the source uses for the joke, if any", func(j joke.Joke) any { return nilIfZero(j.UpstreamID) }),
+			"source":     jokeField(graphql.NewNonNull(graphql.String), "Source the joke came from", func(j joke.Joke) any { return j.Source }),
+			"language":   jokeField(graphql.NewNonNull(graphql.String), "ISO 639-1 code of the language of the joke", func(j joke.Joke) any { return j.Language }),
+			"fetchedAt":  jokeField(graphql.NewNonNull(graphql.DateTime), "When the joke was stored", func(j joke.Joke) any { return j.CreatedAt }),
+			"toldAt":     jokeField(graphql.DateTime, "When the joke was last told, if ever", func(j joke.Joke) any { return j.ToldAt }),
+			"timesTold":  jokeField(graphql.NewNonNull(graphql.Int), "How often the joke was told", func(j joke.Joke) any { return j.TimesTold }),
+			"rating":     jokeField(graphql.Int, fmt.Sprintf("Rating from %d to %d, if rated", joke.MinRating, joke.MaxRating), func(j joke.Joke) any { return nilIfZero(j.Rating) }),
+			"tags": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String))),
+				Description: "Tags of the joke",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					j := p.Source.(joke.Joke)
+					// Lists of jokes come without their tags
+					if j.Tags == nil {
+						stored, err := s.store.Get(p.Context, j.ID)
+						if err != nil {
+							return nil, err
+						}
+						j.Tags = stored.Tags
+					}
+					if j.Tags == nil {
+						return []string{}, nil
+					}
+					return j.Tags, nil
+				},
+			},
+		},
+	})
+
+	tagType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Tag",
+		Description: "A tag in use",
+		Fields: graphql.Fields{
+			"name":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"jokes": &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Description: "How many jokes have the tag"},
+		},
+	})
+	dayCountType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "DayCount",
+		Description: "The number of jokes told on a day, or in the week starting on it",
+		Fields: graphql.Fields{
+			"date":  &graphql.Field{Type: graphql.NewNonNull(graphql.String), Description: "The day, like 2024-05-27"},
+			"count": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+	nameCountType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "NameCount",
+		Description: "The number of jokes told from a source or in a language",
+		Fields: graphql.Fields{
+			"name":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"count": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+	// The fields of the statistics resolve to the fields of joke.Stats
+	// of the same name
+	statsType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Stats",
+		Description: "The jokes told, summed up",
+		Fields: graphql.Fields{
+			"told":          &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Description: "How many jokes were told"},
+			"jokes":         &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Description: "How many different jokes were told"},
+			"days":          &graphql.Field{Type: graphql.NewList(dayCountType), Description: "Jokes told on each of the last days, oldest first"},
+			"weeks":         &graphql.Field{Type: graphql.NewList(dayCountType), Description: "Jokes told in each of the last weeks, oldest first"},
+			"streak":        &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Description: "Days in a row up to today with a joke told"},
+			"bestStreak":    &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Description: "Most days in a row with a joke told"},
+			"sources":       &graphql.Field{Type: graphql.NewList(nameCountType), Description: "Jokes told from each source, most first"},
+			"languages":     &graphql.Field{Type: graphql.NewList(nameCountType), Description: "Jokes told in each language, most first"},
+			"averageLength": &graphql.Field{Type: graphql.NewNonNull(graphql.Float), Description: "Average length of the jokes told, in characters"},
+		},
+	})
+
+	pageArgs := graphql.FieldConfigArgument{
+		"lang":   &graphql.ArgumentConfig{Type: graphql.String, Description: "Only jokes in this language"},
+		"source": &graphql.ArgumentConfig{Type: graphql.String, Description: "Only jokes from this source"},
+		"tag":    &graphql.ArgumentConfig{Type: graphql.String, Description: "Only jokes with this tag"},
+		"since":  &graphql.ArgumentConfig{Type: graphql.DateTime, Description: "Only jokes told at or after this time"},
+		"limit":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultPageSize, Description: fmt.Sprintf("Most jokes to return, up to %d", maxPageSize)},
+		"offset": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0, Description: "Jokes to skip, for paging"},
+	}
+	favoriteArgs := graphql.FieldConfigArgument{
+		"minRating": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: favoriteRating, Description: "Lowest rating of the jokes"},
+	}
+	for name, arg := range pageArgs {
+		favoriteArgs[name] = arg
+	}
+	jokeList := graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(jokeType)))
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"joke": &graphql.Field{
+				Type:        jokeType,
+				Description: "The stored joke with an ID",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					id, err := strconv.ParseInt(p.Args["id"].(string), 10, 64)
+					if err != nil {
+						return nil, fmt.Errorf("invalid joke ID %q", p.Args["id"])
+					}
+					j, err := s.store.Get(p.Context, id)
+					if errors.Is(err, joke.ErrNotFound) {
+						return nil, nil
+					}
+					return j, err
+				},
+			},
+			"jokes": &graphql.Field{
+				Type:        jokeList,
+				Description: "The jokes told, most recent first",
+				Args:        pageArgs,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return s.history(p, 0)
+				},
+			},
+			"favorites": &graphql.Field{
+				Type:        jokeList,
+				Description: "The best rated jokes told, most recent first",
+				Args:        favoriteArgs,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					minRating, _ := p.Args["minRating"].(int)
+					return s.history(p, max(minRating, joke.MinRating))
+				},
+			},
+			"tags": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(tagType))),
+				Description: "The tags in use, sorted by name",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					tags, err := s.store.Tags(p.Context)
+					if tags == nil {
+						tags = []joke.TagCount{}
+					}
+					return tags, err
+				},
+			},
+			"stats": &graphql.Field{
+				Type:        graphql.NewNonNull(statsType),
+				Description: "The jokes told, summed up like by \"godad stats\"",
+				Args: graphql.FieldConfigArgument{
+					"days":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 14, Description: "Number of days to count the jokes of"},
+					"weeks": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 8, Description: "Number of weeks to count the jokes of"},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					days, _ := p.Args["days"].(int)
+					weeks, _ := p.Args["weeks"].(int)
+					if days < 0 || days > 366 || weeks < 0 || weeks > 520 {
+						return nil, errors.New("days must be between 0 and 366, and weeks between 0 and 520")
+					}
+					stats, ok := s.store.(joke.StatsStore)
+					if !ok {
+						return nil, errors.New("the store can't keep statistics")
+					}
+					tellings, err := stats.Tellings(p.Context)
+					if err != nil {
+						return nil, err
+					}
+					return joke.NewStats(tellings, time.Now(), days, weeks), nil
+				},
+			},
+		},
+	})
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query})
+}
+
+// history resolves a page of the jokes told, rated at least minRating
+func (s *Server) history(p graphql.ResolveParams, minRating int) ([]joke.Joke, error) {
+	f := joke.HistoryFilter{MinRating: minRating}
+	f.Language, _ = p.Args["lang"].(string)
+	f.Source, _ = p.Args["source"].(string)
+	f.Tag, _ = p.Args["tag"].(string)
+	if since, ok := p.Args["since"].(time.Time); ok {
+		f.Since = since
+	}
+	f.Limit, _ = p.Args["limit"].(int)
+	f.Offset, _ = p.Args["offset"].(int)
+	if f.Limit <= 0 || f.Limit > maxPageSize {
+		return nil, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+	}
+	if f.Offset < 0 {
+		return nil, errors.New("offset can't be negative")
+	}
+
+	jokes, err := s.store.History(p.Context, f)
+	if jokes == nil {
+		jokes = []joke.Joke{}
+	}
+	return jokes, err
+}
+
+// jokeField returns a field of the Joke type resolved by value
+func jokeField(t graphql.Output, description string, value func(joke.Joke) any) *graphql.Field {
+	return &graphql.Field{Type: t, Description: description, Resolve: func(p graphql.ResolveParams) (any, error) {
+		return value(p.Source.(joke.Joke)), nil
+	}}
+}
+
+// nilIfZero returns nil for the zero value of v, so optional fields are
+// null instead of empty
+func nilIfZero[T comparable](v T) any {
+	var zero T
+	if v == zero {
+		return nil
+	}
+	return v
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/lhaig/godad/pkg/joke"
+)
+
+// graphQLResult is the result of a GraphQL query
+type graphQLResult struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// postGraphQL posts query to the server and decodes the data of the
+// result into v
+func postGraphQL(t *testing.T, srv *httptest.Server, query string, variables map[string]any, v any) graphQLResult {
+	t.Helper()
+	body, _ := json.Marshal(graphQLRequest{Query: query, Variables: variables})
+	resp, err := http.Post(srv.URL+"/graphql", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST /graphql returned an error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /graphql returned status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	var result graphQLResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("Error decoding the result of %s: %v", query, err)
+	}
+	if v != nil && len(result.Errors) == 0 {
+		if err := json.Unmarshal(result.Data, v); err != nil {
+			t.Fatalf("Error decoding the data of %s: %v", query, err)
+		}
+	}
+	return result
+}
+
+func TestGraphQL(t *testing.T) {
+	s, store := newTestHandler(t)
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	ctx := context.Background()
+
+	// Tell three jokes, rate two of them and tag one
+	var told []joke.Joke
+	getJSON(t, srv.URL+"/jokes?lang=en&count=3", http.StatusOK, &told)
+	for i, rating := range []int{5, 2} {
+		if err := store.Rate(ctx, told[i].ID, rating); err != nil {
+			t.Fatalf("Failed to rate a joke: %v", err)
+		}
+	}
+	if err := store.AddTags(ctx, told[0].ID, "puns"); err != nil {
+		t.Fatalf("Failed to tag a joke: %v", err)
+	}
+
+	type gqlJoke struct {
+		ID     string   `json:"id"`
+		Text   string   `json:"text"`
+		Rating *int     `json:"rating"`
+		Tags   []string `json:"tags"`
+	}
+	var data struct {
+		Jokes     []gqlJoke       `json:"jokes"`
+		Page      []gqlJoke       `json:"page"`
+		Favorites []gqlJoke       `json:"favorites"`
+		Tags      []joke.TagCount `json:"tags"`
+		Joke      *gqlJoke        `json:"joke"`
+		Missing   *gqlJoke        `json:"missing"`
+		Stats     struct {
+			Told  int `json:"told"`
+			Jokes int `json:"jokes"`
+			Days  []struct {
+				Count int `json:"count"`
+			} `json:"days"`
+		} `json:"stats"`
+	}
+	result := postGraphQL(t, srv, `query($id: ID!) {
+		jokes(lang: "en") { id text }
+		page: jokes(limit: 1, offset: 1) { text }
+		favorites { id rating tags }
+		tags { name jokes }
+		joke(id: $id) { text rating tags }
+		missing: joke(id: "999") { text }
+		stats(days: 3) { told jokes days { count } }
+	}`, map[string]any{"id": strconv.FormatInt(told[1].ID, 10)}, &data)
+	if len(result.Errors) > 0 {
+		t.Fatalf("The query failed: %+v", result.Errors)
+	}
+
+	if len(data.Jokes) != 3 || data.Jokes[0].Text != told[2].Text || data.Jokes[0].ID != strconv.FormatInt(told[2].ID, 10) {
+		t.Errorf("jokes returned %+v, want the told jokes, most recent first", data.Jokes)
+	}
+	if len(data.Page) != 1 || data.Page[0].Text != data.Jokes[1].Text {
+		t.Errorf("The second page of jokes is %+v, want the second joke", data.Page)
+	}
+	if len(data.Favorites) != 1 || data.Favorites[0].ID != strconv.FormatInt(told[0].ID, 10) ||
+		*data.Favorites[0].Rating != 5 || !reflect.DeepEqual(data.Favorites[0].Tags, []string{"puns"}) {
+		t.Errorf("favorites returned %+v, want the joke rated 5", data.Favorites)
+	}
+	if want := []joke.TagCount{{Name: "puns", Jokes: 1}}; !reflect.DeepEqual(data.Tags, want) {
+		t.Errorf("tags returned %+v, want %+v", data.Tags, want)
+	}
+	if data.Joke == nil || data.Joke.Text != told[1].Text || *data.Joke.Rating != 2 || len(data.Joke.Tags) != 0 || data.Missing != nil {
+		t.Errorf("joke returned %+v and %+v for a missing joke, want the joke rated 2 and null", data.Joke, data.Missing)
+	}
+	if data.Stats.Told != 3 || data.Stats.Jokes != 3 || len(data.Stats.Days) != 3 || data.Stats.Days[2].Count != 3 {
+		t.Errorf("stats returned %+v, want three jokes told today", data.Stats)
+	}
+
+	if result := postGraphQL(t, srv, `{ jokes(limit: 1000) { id } }`, nil, nil); len(result.Errors) == 0 {
+		t.Error("Asking for too many jokes returned no error")
+	}
+	if result := postGraphQL(t, srv, `{ jokes { punchline } }`, nil, nil); len(result.Errors) == 0 {
+		t.Error("Asking for an unknown field returned no error")
+	}
+
+	// Queries can be sent with GET as well
+	var got graphQLResult
+	getJSON(t, srv.URL+"/graphql?query="+url.QueryEscape(`{ tags { name } }`), http.StatusOK, &got)
+	if len(got.Errors) > 0 || string(got.Data) != `{"tags":[{"name":"puns"}]}` {
+		t.Errorf("GET /graphql returned %s, %+v, want the tags", got.Data, got.Errors)
+	}
+	getJSON(t, srv.URL+"/graphql", http.StatusBadRequest, nil)
+}
@@ -0,0 +1,277 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package server
+
+//go:generate protoc -I ../../pkg/api/proto --go_out=../../pkg/api/proto --go_opt=paths=source_relative --go-grpc_out=../../pkg/api/proto --go-grpc_opt=paths=source_relative jokes.proto
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lhaig/godad/pkg/api/proto"
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// GRPC returns a gRPC server serving the Jokes service of
+// pkg/api/proto/jokes.proto. It shares the store, the engines, the API
+// keys and the rate limits of s, so configure s first.
+func (s *Server) GRPC() *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(s.unaryInterceptor),
+		grpc.ChainStreamInterceptor(s.streamInterceptor),
+	)
+	proto.RegisterJokesServer(srv, &jokesService{s: s})
+	// Let tools like grpcurl list the service
+	reflection.Register(srv)
+	return srv
+}
+
+// unaryInterceptor logs, authenticates and rate limits calls
+func (s *Server) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	ctx, err := s.admit(ctx, info.FullMethod)
+	var resp any
+	if err == nil {
+		resp, err = handler(ctx, req)
+	}
+	logCall(info.FullMethod, start, err)
+	return resp, err
+}
+
+// streamInterceptor logs, authenticates and rate limits streams, which
+// count as a single call
+func (s *Server) streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	ctx, err := s.admit(ss.Context(), info.FullMethod)
+	if err == nil {
+		err = handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	}
+	logCall(info.FullMethod, start, err)
+	return err
+}
+
+// admit turns away clients without a valid API key when keys are
+// required, and clients over their rate limit. The reflection service
+// stays public like the OpenAPI specification. The returned context holds
+// the API key of the client.
+func (s *Server) admit(ctx context.Context, method string) (context.Context, error) {
+	if strings.HasPrefix(method, "/grpc.reflection.") {
+		return ctx, nil
+	}
+
+	if s.keys != nil {
+		token := metadataKey(ctx)
+		if token == "" {
+			return ctx, status.Error(codes.Unauthenticated, errNoKey.Error())
+		}
+		key, err := s.keys.KeyByHash(ctx, joke.HashAPIKey(token))
+		if errors.Is(err, joke.ErrKeyNotFound) {
+			return ctx, status.Error(codes.Unauthenticated, errNoKey.Error())
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to look up API key")
+			return ctx, status.Error(codes.Internal, "error checking API key")
+		}
+		ctx = context.WithValue(ctx, keyContext{}, key)
+	}
+
+	addr := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		addr = p.Addr.String()
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			addr = host
+		}
+	}
+	client, perMinute := s.clientOf(ctx, addr)
+	if wait := s.take(ctx, client, perMinute); wait > 0 {
+		_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(int(math.Ceil(wait.Seconds())))))
+		return ctx, status.Error(codes.ResourceExhausted, errRateLimited.Error())
+	}
+	return ctx, nil
+}
+
+// metadataKey returns the API key of a call, given as a bearer token in
+// the authorization metadata or in x-api-key
+func metadataKey(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		if scheme, token, ok := strings.Cut(v, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	if keys := md.Get("x-api-key"); len(keys) > 0 {
+		return keys[0]
+	}
+	return ""
+}
+
+// logCall logs a call like ServeHTTP logs a request
+func logCall(method string, start time.Time, err error) {
+	log.Info().
+		Str("method", method).
+		Str("code", status.Code(err).String()).
+		Dur("duration", time.Since(start)).
+		Msg("Handled call")
+}
+
+// contextStream is a stream with the context of an interceptor
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context implements grpc.ServerStream
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// jokesService implements the Jokes service
+type jokesService struct {
+	proto.UnimplementedJokesServer
+	s *Server
+}
+
+// TellJoke implements proto.JokesServer
+func (js *jokesService) TellJoke(ctx context.Context, req *proto.TellJokeRequest) (*proto.Joke, error) {
+	engine, err := js.s.engines(req.Lang)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	j, err := engine.Tell(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	js.s.jokesServed(j)
+	return toProto(j), nil
+}
+
+// SearchJokes implements proto.JokesServer
+func (js *jokesService) SearchJokes(ctx context.Context, req *proto.SearchJokesRequest) (*proto.SearchJokesResponse, error) {
+	searcher, ok := js.s.store.(joke.Searcher)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "the store can't search jokes")
+	}
+	limit := int(req.Limit)
+	if limit <= 0 {
+		limit = joke.DefaultSearchLimit
+	}
+	results, err := searcher.Search(ctx, req.Query, limit)
+	if errors.Is(err, joke.ErrEmptyQuery) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if errors.Is(err, errors.ErrUnsupported) {
+		return nil, status.Error(codes.Unimplemented, "the store can't search jokes")
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	resp := &proto.SearchJokesResponse{Results: make([]*proto.SearchResult, len(results))}
+	for i, r := range results {
+		resp.Results[i] = &proto.SearchResult{Joke: toProto(r.Joke), Snippet: r.Snippet, Score: r.Score}
+	}
+	return resp, nil
+}
+
+// StreamJokes implements proto.JokesServer
+func (js *jokesService) StreamJokes(req *proto.StreamJokesRequest, stream proto.Jokes_StreamJokesServer) error {
+	engine, err := js.s.engines(req.Lang)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	interval := js.s.streamInterval
+	if req.Interval != nil {
+		d := req.Interval.AsDuration()
+		if d < js.s.streamInterval {
+			return status.Errorf(codes.InvalidArgument, "interval must be at least %s", js.s.streamInterval)
+		}
+		interval = d
+	}
+
+	ctx := stream.Context()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		j, err := engine.Tell(ctx)
+		if ctx.Err() != nil {
+			return status.FromContextError(ctx.Err()).Err()
+		}
+		// Like the event stream, carry on after failing to tell a joke
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to tell a joke to a stream")
+		} else {
+			js.s.jokesServed(j)
+			if err := stream.Send(toProto(j)); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-js.s.streamsDone:
+			return nil
+		}
+	}
+}
+
+// AddJoke implements proto.JokesServer
+func (js *jokesService) AddJoke(ctx context.Context, req *proto.AddJokeRequest) (*proto.Joke, error) {
+	j := joke.Joke{
+		Text:     strings.TrimSpace(req.Text),
+		Source:   joke.UserSourceName,
+		Language: strings.ToLower(strings.TrimSpace(req.Language)),
+		Tags:     req.Tags,
+	}
+	if j.Text == "" || j.Language == "" {
+		return nil, status.Error(codes.InvalidArgument, "a joke needs a text and a language")
+	}
+
+	stored, err := js.s.store.Find(ctx, j)
+	if err == nil {
+		return toProto(stored), nil
+	}
+	if !errors.Is(err, joke.ErrNotFound) {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if err := js.s.store.Save(ctx, &j); err != nil {
+		return nil, status.Errorf(codes.Internal, "error adding joke: %v", err)
+	}
+	return toProto(j), nil
+}
+
+// toProto converts a joke to its message
+func toProto(j joke.Joke) *proto.Joke {
+	msg := &proto.Joke{
+		Id:         j.ID,
+		Text:       j.Text,
+		UpstreamId: j.UpstreamID,
+		Source:     j.Source,
+		Language:   j.Language,
+		FetchedAt:  timestamppb.New(j.CreatedAt),
+		TimesTold:  int32(j.TimesTold),
+		Rating:     int32(j.Rating),
+		Tags:       j.Tags,
+	}
+	if j.ToldAt != nil {
+		msg.ToldAt = timestamppb.New(*j.ToldAt)
+	}
+	return msg
+}
+
+var _ proto.JokesServer = (*jokesService)(nil)
@@ -0,0 +1,149 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lhaig/godad/pkg/api/proto"
+	"github.com/lhaig/godad/pkg/joke"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// newGRPCClient serves the gRPC API of s in memory and returns a client
+// of it
+func newGRPCClient(t *testing.T, s *Server) proto.JokesClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := s.GRPC()
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to connect to the gRPC server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return proto.NewJokesClient(conn)
+}
+
+func TestGRPC(t *testing.T) {
+	s, _ := newTestHandler(t)
+	client := newGRPCClient(t, s)
+	ctx := context.Background()
+
+	j, err := client.TellJoke(ctx, &proto.TellJokeRequest{Lang: "de"})
+	if err != nil || j.Text != "de joke 1" || j.Id == 0 || j.ToldAt == nil {
+		t.Fatalf("TellJoke returned %v, %v, want the first German joke", j, err)
+	}
+	if _, err := client.TellJoke(ctx, &proto.TellJokeRequest{Lang: "xx"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("TellJoke in an unknown language returned %v, want %s", err, codes.InvalidArgument)
+	}
+
+	added, err := client.AddJoke(ctx, &proto.AddJokeRequest{Text: "I'm reading a book about anti-gravity. It's impossible to put down.", Language: "en", Tags: []string{"science"}})
+	if err != nil || added.Id == 0 || added.Source != joke.UserSourceName {
+		t.Fatalf("AddJoke returned %v, %v, want the stored joke", added, err)
+	}
+	again, err := client.AddJoke(ctx, &proto.AddJokeRequest{Text: added.Text, Language: "en"})
+	if err != nil || again.Id != added.Id {
+		t.Errorf("Adding the joke again returned %v, %v, want joke %d", again, err, added.Id)
+	}
+	if _, err := client.AddJoke(ctx, &proto.AddJokeRequest{Text: " ", Language: "en"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("AddJoke without a text returned %v, want %s", err, codes.InvalidArgument)
+	}
+
+	found, err := client.SearchJokes(ctx, &proto.SearchJokesRequest{Query: "joke"})
+	if err != nil || len(found.Results) != 1 || found.Results[0].Joke.Id != j.Id {
+		t.Errorf("SearchJokes returned %v, %v, want the told joke", found, err)
+	}
+	if _, err := client.SearchJokes(ctx, &proto.SearchJokesRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("SearchJokes without a query returned %v, want %s", err, codes.InvalidArgument)
+	}
+}
+
+func TestGRPCStream(t *testing.T) {
+	s, _ := newTestHandler(t)
+	s.StreamEvery(10 * time.Millisecond)
+	client := newGRPCClient(t, s)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err := recvFirst(ctx, client, &proto.StreamJokesRequest{Interval: durationpb.New(time.Millisecond)}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("StreamJokes with a short interval returned %v, want %s", err, codes.InvalidArgument)
+	}
+
+	stream, err := client.StreamJokes(ctx, &proto.StreamJokesRequest{Lang: "de"})
+	if err != nil {
+		t.Fatalf("StreamJokes returned %v", err)
+	}
+	for _, want := range []string{"de joke 1", "de joke 2", "de joke 3"} {
+		j, err := stream.Recv()
+		if err != nil || j.Text != want {
+			t.Fatalf("The stream sent %v, %v, want %q", j, err, want)
+		}
+	}
+
+	s.StopStreams()
+	for {
+		if _, err := stream.Recv(); err != nil {
+			break
+		}
+	}
+}
+
+// recvFirst starts a stream and returns its first joke
+func recvFirst(ctx context.Context, client proto.JokesClient, req *proto.StreamJokesRequest) (*proto.Joke, error) {
+	stream, err := client.StreamJokes(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return stream.Recv()
+}
+
+func TestGRPCKeys(t *testing.T) {
+	s, store := newTestHandler(t)
+	s.RequireKeys(store)
+	s.LimitRate(&MemoryLimiter{}, 2)
+	client := newGRPCClient(t, s)
+	ctx := context.Background()
+
+	token, hash, err := joke.NewAPIKey()
+	if err != nil {
+		t.Fatalf("Failed to create an API key: %v", err)
+	}
+	if err := store.AddKey(ctx, &joke.APIKey{Name: "mesh", Hash: hash}); err != nil {
+		t.Fatalf("Failed to add the API key: %v", err)
+	}
+
+	if _, err := client.TellJoke(ctx, &proto.TellJokeRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("TellJoke without a key returned %v, want %s", err, codes.Unauthenticated)
+	}
+	wrong := metadata.AppendToOutgoingContext(ctx, "x-api-key", "godad_wrong")
+	if _, err := client.TellJoke(wrong, &proto.TellJokeRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("TellJoke with a wrong key returned %v, want %s", err, codes.Unauthenticated)
+	}
+
+	authed := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	for range 2 {
+		if _, err := client.TellJoke(authed, &proto.TellJokeRequest{}); err != nil {
+			t.Fatalf("TellJoke with a key returned %v", err)
+		}
+	}
+	var header metadata.MD
+	_, err = client.TellJoke(authed, &proto.TellJokeRequest{}, grpc.Header(&header))
+	if status.Code(err) != codes.ResourceExhausted || len(header.Get("retry-after")) == 0 {
+		t.Errorf("TellJoke over the rate limit returned %v with header %v, want %s and a retry time", err, header, codes.ResourceExhausted)
+	}
+}
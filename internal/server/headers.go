@@ -0,0 +1,97 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// corsMaxAge is how long browsers may cache the answer to a preflight
+// request, in seconds
+const corsMaxAge = 600
+
+// pageCSP is the Content-Security-Policy of the joke pages, which only
+// have inline styles
+const pageCSP = "default-src 'none'; style-src 'unsafe-inline'"
+
+// AllowOrigins lets web pages from the given origins, like
+// https://dashboard.example.com, call the API from the browser. "*"
+// allows every origin, and a "*." in place of a host name allows its
+// subdomains, like https://*.example.com.
+func (s *Server) AllowOrigins(origins []string) {
+	s.origins = origins
+}
+
+// AllowFraming lets web pages from the given origins show the joke pages
+// in a frame, e.g. on an office TV. "*" allows every origin. Without any,
+// the pages can't be framed.
+func (s *Server) AllowFraming(origins []string) {
+	s.frameAncestors = origins
+}
+
+// setHeaders sets the security and CORS headers of a response. It reports
+// whether it answered a CORS preflight request, which needs no more
+// handling.
+func (s *Server) setHeaders(w http.ResponseWriter, r *http.Request) bool {
+	h := w.Header()
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Referrer-Policy", "no-referrer")
+	h.Set("Cross-Origin-Opener-Policy", "same-origin")
+	// Handlers of pages loosen this as they need
+	h.Set("Content-Security-Policy", s.csp("default-src 'none'"))
+	if len(s.frameAncestors) == 0 {
+		h.Set("X-Frame-Options", "DENY")
+	}
+
+	origin := r.Header.Get("Origin")
+	preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+	if origin != "" && len(s.origins) > 0 {
+		h.Add("Vary", "Origin")
+	}
+	if origin != "" && s.originAllowed(origin) {
+		if len(s.origins) == 1 && s.origins[0] == "*" {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		h.Set("Access-Control-Expose-Headers", "Retry-After")
+		if preflight {
+			h.Set("Access-Control-Allow-Methods", "GET, POST")
+			h.Set("Access-Control-Allow-Headers", "Authorization, X-API-Key, Content-Type")
+			h.Set("Access-Control-Max-Age", strconv.Itoa(corsMaxAge))
+		}
+	}
+	if preflight {
+		w.WriteHeader(http.StatusNoContent)
+	}
+	return preflight
+}
+
+// csp returns a Content-Security-Policy made of policy and the origins
+// allowed to frame the response
+func (s *Server) csp(policy string) string {
+	ancestors := "'none'"
+	if len(s.frameAncestors) > 0 {
+		ancestors = strings.Join(s.frameAncestors, " ")
+	}
+	return policy + "; frame-ancestors " + ancestors
+}
+
+// originAllowed reports whether web pages from origin may call the API
+func (s *Server) originAllowed(origin string) bool {
+	for _, allowed := range s.origins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		scheme, domain, ok := strings.Cut(allowed, "://*.")
+		if ok && len(origin) > len(scheme)+3+len(domain)+1 &&
+			strings.EqualFold(origin[:len(scheme)+3], scheme+"://") &&
+			strings.HasSuffix(strings.ToLower(origin), "."+strings.ToLower(domain)) {
+			return true
+		}
+	}
+	return false
+}
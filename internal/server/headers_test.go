@@ -0,0 +1,83 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	s, _ := newTestHandler(t)
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/joke", nil))
+	h := rec.Header()
+	if h.Get("X-Content-Type-Options") != "nosniff" || h.Get("X-Frame-Options") != "DENY" ||
+		h.Get("Content-Security-Policy") != "default-src 'none'; frame-ancestors 'none'" {
+		t.Errorf("GET /joke returned headers %v, want the security headers", h)
+	}
+	if h.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("GET /joke without allowed origins returned Access-Control-Allow-Origin %q", h.Get("Access-Control-Allow-Origin"))
+	}
+
+	s.AllowFraming([]string{"https://tv.example.com"})
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/j/1", nil))
+	csp := rec.Header().Get("Content-Security-Policy")
+	if rec.Header().Get("X-Frame-Options") != "" || !strings.HasSuffix(csp, "frame-ancestors https://tv.example.com") || !strings.Contains(csp, "style-src 'unsafe-inline'") {
+		t.Errorf("GET /j/1 with framing allowed returned X-Frame-Options %q and CSP %q, want the page framed by the TV",
+			rec.Header().Get("X-Frame-Options"), csp)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	s, _ := newTestHandler(t)
+	s.AllowOrigins([]string{"https://dashboard.example.com", "https://*.example.org"})
+
+	request := func(method, origin string) http.Header {
+		req := httptest.NewRequest(method, "/joke", nil)
+		req.Header.Set("Origin", origin)
+		if method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if method == http.MethodOptions && rec.Code != http.StatusNoContent {
+			t.Errorf("Preflight request from %s returned status %d, want %d", origin, rec.Code, http.StatusNoContent)
+		}
+		return rec.Header()
+	}
+
+	for _, tc := range []struct {
+		origin string
+		want   bool
+	}{
+		{origin: "https://dashboard.example.com", want: true},
+		{origin: "https://tv.office.example.org", want: true},
+		{origin: "https://example.org", want: false},
+		{origin: "http://tv.example.org", want: false},
+		{origin: "https://evil.example", want: false},
+	} {
+		h := request(http.MethodGet, tc.origin)
+		if got := h.Get("Access-Control-Allow-Origin") == tc.origin; got != tc.want {
+			t.Errorf("GET from %s returned Access-Control-Allow-Origin %q, want allowed %v", tc.origin, h.Get("Access-Control-Allow-Origin"), tc.want)
+		}
+		if h.Get("Vary") != "Origin" {
+			t.Errorf("GET from %s returned Vary %q, want Origin", tc.origin, h.Get("Vary"))
+		}
+	}
+
+	h := request(http.MethodOptions, "https://dashboard.example.com")
+	if h.Get("Access-Control-Allow-Origin") != "https://dashboard.example.com" || !strings.Contains(h.Get("Access-Control-Allow-Headers"), "Authorization") {
+		t.Errorf("Preflight request returned headers %v, want the API key headers allowed", h)
+	}
+
+	s.AllowOrigins([]string{"*"})
+	if h := request(http.MethodGet, "https://anywhere.example"); h.Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("GET with every origin allowed returned Access-Control-Allow-Origin %q, want *", h.Get("Access-Control-Allow-Origin"))
+	}
+}
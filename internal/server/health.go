@@ -0,0 +1,146 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/lhaig/godad/pkg/joke"
+)
+
+// readyTimeout bounds the checks of a readiness probe, which gives up on
+// its own after a second or so
+const readyTimeout = 2 * time.Second
+
+// health is the answer to a liveness probe
+type health struct {
+	Status string `json:"status"`
+}
+
+// readiness is the answer to a readiness probe
+type readiness struct {
+	Status   string `json:"status"`
+	Database check  `json:"database"`
+	// Untold counts the jokes left to tell in the configured language
+	Untold  int            `json:"untold"`
+	Sources []sourceStatus `json:"sources"`
+}
+
+// check is the outcome of a check of a readiness probe
+type check struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// sourceStatus is whether jokes can be fetched from a source
+type sourceStatus struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	// Failures counts the fetches that failed since the last success
+	Failures  int    `json:"failures,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// handleHealth answers liveness probes, which only check that the
+// process still serves requests
+func (s *Server) handleHealth(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, health{Status: "ok"})
+}
+
+// handleReady answers readiness probes. The server is ready when the
+// database answers and a joke can be told, because a source is healthy
+// or untold jokes are left in the database.
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	h := readiness{Status: "ready", Database: check{OK: true}}
+	engine, err := s.engines("")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	engines := mixed(engine)
+	h.Untold, err = countUntold(ctx, s.store, engines)
+	if err != nil {
+		h.Database = check{Error: err.Error()}
+	}
+	h.Sources = sourceStatuses(ctx, s.store, engines)
+
+	healthy := false
+	for _, src := range h.Sources {
+		healthy = healthy || src.Healthy
+	}
+	status := http.StatusOK
+	if !h.Database.OK || (!healthy && h.Untold == 0) {
+		h.Status = "not ready"
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, h)
+}
+
+// mixed returns the engines of the languages mixed by engine, or engine
+// itself if it tells jokes in a single language
+func mixed(engine *joke.Engine) []*joke.Engine {
+	if len(engine.Mix) == 0 {
+		return []*joke.Engine{engine}
+	}
+	engines := make([]*joke.Engine, 0, len(engine.Mix))
+	for _, m := range engine.Mix {
+		engines = append(engines, m.Engine)
+	}
+	return engines
+}
+
+// countUntold returns how many jokes are untold in the languages of the
+// engines. It is what checks that the database answers.
+func countUntold(ctx context.Context, store joke.Store, engines []*joke.Engine) (int, error) {
+	stock, ok := store.(joke.StockStore)
+	if !ok {
+		return 0, errors.New("the store can't count untold jokes")
+	}
+	total := 0
+	for _, e := range engines {
+		n, err := stock.CountUntold(ctx, e.Language)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// sourceStatuses returns whether each source of the engines can be
+// fetched from. A source is healthy unless the breaker of its engine skips
+// it. Offline engines don't fetch from their sources at all.
+func sourceStatuses(ctx context.Context, store joke.Store, engines []*joke.Engine) []sourceStatus {
+	tracker, tracked := store.(joke.HealthStore)
+	statuses := []sourceStatus{}
+	seen := map[string]bool{}
+	for _, e := range engines {
+		if e.Offline {
+			continue
+		}
+		for _, src := range e.Sources {
+			if seen[src.Name()] {
+				continue
+			}
+			seen[src.Name()] = true
+			status := sourceStatus{Name: src.Name(), Healthy: true}
+			if tracked {
+				h, err := tracker.SourceHealth(ctx, src.Name())
+				if err == nil {
+					status.Failures = h.Failures
+					status.LastError = h.LastError
+					status.Healthy = h.OpenUntil(e.Breaker, time.Now()).IsZero()
+				}
+			}
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}
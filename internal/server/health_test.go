@@ -0,0 +1,68 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lhaig/godad/pkg/joke"
+)
+
+func TestHealth(t *testing.T) {
+	srv := newTestServer(t)
+
+	var h health
+	getJSON(t, srv.URL+"/healthz", http.StatusOK, &h)
+	if h.Status != "ok" {
+		t.Errorf("GET /healthz returned status %q, want ok", h.Status)
+	}
+}
+
+func TestReady(t *testing.T) {
+	s, store := newTestHandler(t)
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	ctx := context.Background()
+
+	var r readiness
+	getJSON(t, srv.URL+"/readyz", http.StatusOK, &r)
+	if r.Status != "ready" || !r.Database.OK || r.Untold != 0 || len(r.Sources) == 0 || !r.Sources[0].Healthy {
+		t.Fatalf("GET /readyz on a new server returned %+v, want it ready with healthy sources", r)
+	}
+
+	// Sources the breaker skips can't tell a joke
+	for _, src := range r.Sources {
+		for range joke.DefaultBreaker.Threshold {
+			if err := store.RecordFetch(ctx, src.Name, 0, errors.New("down")); err != nil {
+				t.Fatalf("Failed to record a fetch: %v", err)
+			}
+		}
+	}
+	r = readiness{}
+	getJSON(t, srv.URL+"/readyz", http.StatusServiceUnavailable, &r)
+	if r.Status != "not ready" || r.Sources[0].Healthy || r.Sources[0].Failures != joke.DefaultBreaker.Threshold || r.Sources[0].LastError != "down" {
+		t.Errorf("GET /readyz with failing sources returned %+v, want it not ready", r)
+	}
+
+	// Untold jokes can
+	if err := store.Save(ctx, &joke.Joke{Text: "Untold", Source: r.Sources[0].Name, Language: "en"}); err != nil {
+		t.Fatalf("Failed to save a joke: %v", err)
+	}
+	r = readiness{}
+	getJSON(t, srv.URL+"/readyz", http.StatusOK, &r)
+	if r.Status != "ready" || r.Untold != 1 {
+		t.Errorf("GET /readyz with an untold joke returned %+v, want it ready", r)
+	}
+
+	store.Close()
+	r = readiness{}
+	getJSON(t, srv.URL+"/readyz", http.StatusServiceUnavailable, &r)
+	if r.Database.OK || r.Database.Error == "" {
+		t.Errorf("GET /readyz with the database closed returned %+v, want a database error", r)
+	}
+}
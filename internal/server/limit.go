@@ -0,0 +1,262 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package server
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// errRateLimited is returned to clients that made too many requests
+var errRateLimited = errors.New("too many requests, try again later")
+
+// Limiter keeps a token bucket per client, allowing a number of requests
+// per minute in bursts of up to that many
+type Limiter interface {
+	// Take takes a token from the bucket of client, which holds perMinute
+	// tokens, and returns how long to wait for one if it is empty
+	Take(ctx context.Context, client string, perMinute int) (time.Duration, error)
+}
+
+// MemoryLimiter is a Limiter keeping the buckets in memory, for a single
+// server. The zero value is ready to use.
+type MemoryLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	// pruned is when full buckets were last dropped
+	pruned time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Take implements Limiter
+func (l *MemoryLimiter) Take(_ context.Context, client string, perMinute int) (time.Duration, error) {
+	return l.take(client, perMinute, time.Now()), nil
+}
+
+// take takes a token from the bucket of client at the given time
+func (l *MemoryLimiter) take(client string, perMinute int, now time.Time) time.Duration {
+	if perMinute <= 0 {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.buckets == nil {
+		l.buckets = make(map[string]*bucket)
+	}
+	l.prune(now)
+
+	perToken := time.Minute / time.Duration(perMinute)
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: float64(perMinute), updated: now}
+		l.buckets[client] = b
+	}
+	b.tokens = min(b.tokens+float64(now.Sub(b.updated))/float64(perToken), float64(perMinute))
+	b.updated = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) * float64(perToken))
+	}
+	b.tokens--
+	return 0
+}
+
+// prune drops the buckets of clients that have not made a request for a
+// minute once a minute, as their buckets are full again anyway
+func (l *MemoryLimiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < time.Minute {
+		return
+	}
+	for client, b := range l.buckets {
+		if now.Sub(b.updated) >= time.Minute {
+			delete(l.buckets, client)
+		}
+	}
+	l.pruned = now
+}
+
+const (
+	// redisLimitPrefix starts the keys of the buckets RedisLimiter keeps
+	redisLimitPrefix = "godad:limit:"
+	// redisRetry is how long RedisLimiter leaves Redis alone after it
+	// failed
+	redisRetry = 30 * time.Second
+)
+
+// takeScript takes a token from the bucket at KEYS[1], holding ARGV[1]
+// tokens, one added every ARGV[2] milliseconds, at the time ARGV[3] in
+// Unix milliseconds. It returns the milliseconds to wait for a token if
+// the bucket is empty. Buckets expire once they are full again.
+var takeScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local per_token = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local b = redis.call("HMGET", KEYS[1], "tokens", "updated")
+local tokens = tonumber(b[1]) or capacity
+local updated = tonumber(b[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - updated) / per_token)
+local wait = 0
+if tokens < 1 then
+	wait = math.ceil((1 - tokens) * per_token)
+else
+	tokens = tokens - 1
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "updated", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(capacity * per_token))
+return wait
+`)
+
+// RedisLimiter is a Limiter keeping the buckets in Redis, so several
+// servers share them. When Redis fails, the buckets are kept in memory
+// for a while.
+type RedisLimiter struct {
+	client redis.UniversalClient
+	local  MemoryLimiter
+	// downUntil is when to try Redis again after it failed, in Unix
+	// nanoseconds
+	downUntil atomic.Int64
+}
+
+// NewRedisLimiter returns a limiter keeping the buckets in the Redis
+// server of client
+func NewRedisLimiter(client redis.UniversalClient) *RedisLimiter {
+	return &RedisLimiter{client: client}
+}
+
+// Take implements Limiter
+func (l *RedisLimiter) Take(ctx context.Context, client string, perMinute int) (time.Duration, error) {
+	if perMinute <= 0 {
+		return 0, nil
+	}
+	now := time.Now()
+	if now.UnixNano() < l.downUntil.Load() {
+		return l.local.take(client, perMinute, now), nil
+	}
+	perToken := float64(time.Minute.Milliseconds()) / float64(perMinute)
+	wait, err := takeScript.Run(ctx, l.client, []string{redisLimitPrefix + client}, perMinute, perToken, now.UnixMilli()).Int64()
+	if err != nil {
+		if l.downUntil.Swap(now.Add(redisRetry).UnixNano()) < now.UnixNano() {
+			log.Warn().Err(err).Dur("retry", redisRetry).Msg("Redis failed, keeping rate limits in memory")
+		}
+		return l.local.take(client, perMinute, now), nil
+	}
+	return time.Duration(wait) * time.Millisecond, nil
+}
+
+// LimitRate makes each client wait after perMinute requests a minute,
+// counting the requests with limiter. Clients are told apart by their API
+// key, or by their address when they don't need one. Keys with a rate
+// limit of their own are held to it instead; 0 means no limit.
+func (s *Server) LimitRate(limiter Limiter, perMinute int) {
+	s.limiter = limiter
+	s.rateLimit = perMinute
+}
+
+// TrustProxies makes the server take the address of clients from the
+// X-Forwarded-For header of requests from the given reverse proxies, so
+// clients behind a proxy aren't all counted as one
+func (s *Server) TrustProxies(proxies []netip.Prefix) {
+	s.proxies = proxies
+}
+
+// limited wraps a handler, turning away clients over their rate limit
+// with 429 Too Many Requests
+func (s *Server) limited(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client, perMinute := s.client(r)
+		if wait := s.take(r.Context(), client, perMinute); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeError(w, http.StatusTooManyRequests, errRateLimited)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// client returns who made a request, by API key or else by address, and
+// how many requests per minute they may make
+func (s *Server) client(r *http.Request) (client string, perMinute int) {
+	return s.clientOf(r.Context(), s.clientAddr(r))
+}
+
+// clientOf returns who made a request from addr, by the API key in ctx if
+// there is one, and how many requests per minute they may make
+func (s *Server) clientOf(ctx context.Context, addr string) (client string, perMinute int) {
+	client, perMinute = "ip:"+addr, s.rateLimit
+	if key, ok := ctx.Value(keyContext{}).(joke.APIKey); ok {
+		client = "key:" + key.Name
+		if key.RateLimit > 0 {
+			perMinute = key.RateLimit
+		}
+	}
+	return client, perMinute
+}
+
+// take counts a request of client and returns how long it has to wait
+// before making it, or zero if it may make it now
+func (s *Server) take(ctx context.Context, client string, perMinute int) time.Duration {
+	wait, err := s.limiter.Take(ctx, client, perMinute)
+	if err != nil {
+		// Better to let a few requests too many through than none
+		log.Error().Err(err).Msg("Failed to check rate limit")
+	}
+	if wait > 0 {
+		log.Debug().Str("client", client).Dur("wait", wait).Msg("Client is over its rate limit")
+	}
+	return wait
+}
+
+// clientAddr returns the IP address of the client of a request. Behind
+// trusted proxies it is the last address in X-Forwarded-For that isn't a
+// trusted proxy itself.
+func (s *Server) clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !s.trusted(addr) {
+		return host
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+		if !s.trusted(addr) {
+			break
+		}
+	}
+	return addr.String()
+}
+
+// trusted reports whether addr is a trusted proxy
+func (s *Server) trusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, p := range s.proxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestMemoryLimiter(t *testing.T) {
+	var l MemoryLimiter
+	now := time.Now()
+	for i := range 3 {
+		if wait := l.take("office-tv", 3, now); wait != 0 {
+			t.Fatalf("take() #%d within the limit returned wait %v, want 0", i+1, wait)
+		}
+	}
+	if wait := l.take("office-tv", 3, now); wait != 20*time.Second {
+		t.Errorf("take() over the limit returned wait %v, want 20s", wait)
+	}
+	if wait := l.take("chat-bot", 3, now); wait != 0 {
+		t.Errorf("take() of another client returned wait %v, want 0", wait)
+	}
+	if wait := l.take("office-tv", 3, now.Add(20*time.Second)); wait != 0 {
+		t.Errorf("take() after a token was added returned wait %v, want 0", wait)
+	}
+	if wait := l.take("office-tv", 0, now); wait != 0 {
+		t.Errorf("take() without a limit returned wait %v, want 0", wait)
+	}
+
+	l.take("office-tv", 3, now.Add(2*time.Minute))
+	if _, ok := l.buckets["chat-bot"]; ok || len(l.buckets) != 1 {
+		t.Errorf("take() a while later kept buckets %v, want the idle ones dropped", l.buckets)
+	}
+}
+
+func TestRedisLimiter(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	// Servers sharing Redis share the buckets
+	first, second := NewRedisLimiter(client), NewRedisLimiter(client)
+	for i, l := range []*RedisLimiter{first, second} {
+		if wait, err := l.Take(ctx, "office-tv", 2); wait != 0 || err != nil {
+			t.Fatalf("Take() #%d within the limit = %v, %v, want 0", i+1, wait, err)
+		}
+	}
+	wait, err := first.Take(ctx, "office-tv", 2)
+	if err != nil || wait <= 29*time.Second || wait > 30*time.Second {
+		t.Errorf("Take() over the limit = %v, %v, want a wait of about 30s", wait, err)
+	}
+	if ttl := server.TTL(redisLimitPrefix + "office-tv"); ttl <= 0 || ttl > time.Minute {
+		t.Errorf("The bucket expires in %v, want once it is full again", ttl)
+	}
+
+	// Without Redis the buckets are kept in memory
+	server.Close()
+	for i := range 2 {
+		if wait, err := first.Take(ctx, "office-tv", 2); wait != 0 || err != nil {
+			t.Fatalf("Take() #%d without Redis = %v, %v, want 0", i+1, wait, err)
+		}
+	}
+	if wait, _ := first.Take(ctx, "office-tv", 2); wait == 0 {
+		t.Error("Take() over the limit without Redis returned no wait")
+	}
+}
+
+func TestLimitRate(t *testing.T) {
+	s, _ := newTestHandler(t)
+	s.LimitRate(&MemoryLimiter{}, 1)
+	s.TrustProxies([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")})
+
+	get := func(remoteAddr, forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, "/openapi.json", nil)
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := get("192.0.2.1:1234", ""); code != http.StatusOK {
+		t.Fatalf("First request returned status %d, want %d", code, http.StatusOK)
+	}
+	if code := get("192.0.2.1:5678", ""); code != http.StatusTooManyRequests {
+		t.Errorf("Second request of the client returned status %d, want %d", code, http.StatusTooManyRequests)
+	}
+	// Only trusted proxies tell the address of the client
+	if code := get("192.0.2.1:1234", "198.51.100.7"); code != http.StatusTooManyRequests {
+		t.Errorf("Request with a forged X-Forwarded-For returned status %d, want %d", code, http.StatusTooManyRequests)
+	}
+	if code := get("10.0.0.2:1234", "198.51.100.7, 10.0.0.3"); code != http.StatusOK {
+		t.Errorf("Request of another client behind the proxies returned status %d, want %d", code, http.StatusOK)
+	}
+	if code := get("10.0.0.2:1234", "192.0.2.1, 198.51.100.7"); code != http.StatusTooManyRequests {
+		t.Errorf("Second request of a client behind the proxy returned status %d, want %d", code, http.StatusTooManyRequests)
+	}
+}
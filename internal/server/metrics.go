@@ -0,0 +1,112 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics collects the Prometheus metrics of a server. It is a
+// joke.Observer, to be told how the store and the sources perform.
+type Metrics struct {
+	registry      *prometheus.Registry
+	served        *prometheus.CounterVec
+	fetchDuration *prometheus.HistogramVec
+	fetchFailures *prometheus.CounterVec
+	queryDuration *prometheus.HistogramVec
+	cacheLookups  *prometheus.CounterVec
+}
+
+// NewMetrics returns empty metrics, along with those of the Go runtime and
+// the process
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		served: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "godad_jokes_served_total",
+			Help: "Jokes told to clients, by source and language.",
+		}, []string{"source", "language"}),
+		fetchDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "godad_source_fetch_duration_seconds",
+			Help:    "Time taken by fetches from upstream sources, including retries.",
+			Buckets: prometheus.ExponentialBuckets(0.05, 2, 10),
+		}, []string{"source"}),
+		fetchFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "godad_source_fetch_failures_total",
+			Help: "Fetches from upstream sources that failed.",
+		}, []string{"source"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "godad_store_query_duration_seconds",
+			Help:    "Time taken by calls of the joke database, by method.",
+			Buckets: prometheus.ExponentialBuckets(0.0005, 2, 12),
+		}, []string{"method"}),
+		cacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "godad_cache_lookups_total",
+			Help: "Lookups in the Redis cache, by whether they were a hit or a miss.",
+		}, []string{"result"}),
+	}
+	m.registry.MustRegister(
+		m.served, m.fetchDuration, m.fetchFailures, m.queryDuration, m.cacheLookups,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// ObserveQuery implements joke.Observer. Calls that find nothing count as
+// well as successful ones.
+func (m *Metrics) ObserveQuery(method string, duration time.Duration, _ error) {
+	m.queryDuration.WithLabelValues(method).Observe(duration.Seconds())
+}
+
+// ObserveFetch implements joke.Observer
+func (m *Metrics) ObserveFetch(source string, latency time.Duration, err error) {
+	m.fetchDuration.WithLabelValues(source).Observe(latency.Seconds())
+	// Every source shows up, with no failures until there are some
+	failures := m.fetchFailures.WithLabelValues(source)
+	if err != nil {
+		failures.Inc()
+	}
+}
+
+// ObserveCache implements joke.Observer
+func (m *Metrics) ObserveCache(hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.cacheLookups.WithLabelValues(result).Inc()
+}
+
+// jokesServed counts jokes told to a client
+func (m *Metrics) jokesServed(jokes ...joke.Joke) {
+	for _, j := range jokes {
+		m.served.WithLabelValues(j.Source, j.Language).Inc()
+	}
+}
+
+// ExportMetrics makes the server count the jokes it serves in m and serve
+// the metrics at /metrics
+func (s *Server) ExportMetrics(m *Metrics) {
+	s.metrics = m
+	s.metricsHandler = promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// handleMetrics serves the metrics in the Prometheus format, if the
+// server exports them
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if s.metricsHandler == nil {
+		http.NotFound(w, r)
+		return
+	}
+	s.metricsHandler.ServeHTTP(w, r)
+}
+
+var _ joke.Observer = (*Metrics)(nil)
@@ -0,0 +1,61 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	s, _ := newTestHandler(t)
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET /metrics without exported metrics returned status %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	m := NewMetrics()
+	s.ExportMetrics(m)
+	for _, target := range []string{"/joke", "/jokes?lang=de&count=2"} {
+		rec = httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s returned status %d, want %d", target, rec.Code, http.StatusOK)
+		}
+	}
+	m.ObserveFetch("icanhazdadjoke", 200*time.Millisecond, nil)
+	m.ObserveFetch("jokeapi", time.Second, errors.New("timeout"))
+	m.ObserveQuery("NextUntold", time.Millisecond, nil)
+	m.ObserveCache(true)
+	m.ObserveCache(false)
+	m.ObserveCache(false)
+
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /metrics returned status %d, want %d", rec.Code, http.StatusOK)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`godad_jokes_served_total{language="en",source="counting-en"} 1`,
+		`godad_jokes_served_total{language="de",source="counting-de"} 2`,
+		`godad_source_fetch_duration_seconds_count{source="icanhazdadjoke"} 1`,
+		`godad_source_fetch_failures_total{source="icanhazdadjoke"} 0`,
+		`godad_source_fetch_failures_total{source="jokeapi"} 1`,
+		`godad_store_query_duration_seconds_count{method="NextUntold"} 1`,
+		`godad_cache_lookups_total{result="hit"} 1`,
+		`godad_cache_lookups_total{result="miss"} 2`,
+		"go_goroutines",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("GET /metrics returned no %s", want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package server
+
+import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+)
+
+// OpenAPI is the OpenAPI 3 specification of the REST API, for generating
+// clients. It is served at /openapi.json.
+//
+//go:embed openapi.json
+var OpenAPI []byte
+
+// swaggerUI is where the documentation loads Swagger UI from. The release
+// is pinned, and docsCSP only allows its files, so a new release never
+// runs on the server's origin unreviewed.
+const swaggerUI = "https://unpkg.com/swagger-ui-dist@5.17.14/"
+
+// docsScript starts Swagger UI. docsCSP allows it by its hash instead of
+// allowing every inline script.
+const docsScript = `SwaggerUIBundle({ url: "openapi.json", dom_id: "#swagger-ui" });`
+
+// docsPage shows the specification with Swagger UI
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>godad API</title>
+<link rel="stylesheet" href="` + swaggerUI + `swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="` + swaggerUI + `swagger-ui-bundle.js"></script>
+<script>` + docsScript + `</script>
+</body>
+</html>
+`
+
+// docsCSP is the Content-Security-Policy of the API documentation, which
+// only runs the pinned Swagger UI and docsScript
+var docsCSP = "default-src 'none'; script-src " + swaggerUI + "swagger-ui-bundle.js " + scriptHash(docsScript) +
+	"; style-src " + swaggerUI + "swagger-ui.css; img-src data: " + swaggerUI + "; connect-src 'self'"
+
+// scriptHash returns the CSP source allowing the inline script
+func scriptHash(script string) string {
+	sum := sha256.Sum256([]byte(script))
+	return "'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'"
+}
+
+// handleOpenAPI serves the OpenAPI specification
+func (s *Server) handleOpenAPI(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(OpenAPI); err != nil {
+		log.Error().Err(err).Msg("Failed to write response")
+	}
+}
+
+// handleDocs shows the OpenAPI specification with Swagger UI
+func (s *Server) handleDocs(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", s.csp(docsCSP))
+	if _, err := w.Write([]byte(docsPage)); err != nil {
+		log.Error().Err(err).Msg("Failed to write response")
+	}
+}
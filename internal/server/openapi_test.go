@@ -0,0 +1,71 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPI(t *testing.T) {
+	srv := newTestServer(t)
+
+	var spec struct {
+		OpenAPI string                    `json:"openapi"`
+		Paths   map[string]map[string]any `json:"paths"`
+	}
+	getJSON(t, srv.URL+"/openapi.json", http.StatusOK, &spec)
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		t.Errorf("GET /openapi.json returned version %q, want OpenAPI 3", spec.OpenAPI)
+	}
+
+	resp, err := http.Get(srv.URL + "/docs")
+	if err != nil {
+		t.Fatalf("GET /docs returned an error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /docs returned status %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	// Only the pinned Swagger UI and the page's own script may run
+	csp := resp.Header.Get("Content-Security-Policy")
+	if strings.Contains(csp, "unsafe-inline") || !strings.Contains(csp, "script-src "+swaggerUI+"swagger-ui-bundle.js 'sha256-") {
+		t.Errorf("GET /docs has the policy %q, want only the pinned scripts allowed", csp)
+	}
+}
+
+// TestOpenAPIInSync checks that the specification documents every route of
+// the API and nothing else
+func TestOpenAPIInSync(t *testing.T) {
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(OpenAPI, &spec); err != nil {
+		t.Fatalf("Error parsing the specification: %v", err)
+	}
+	var documented []string
+	for path, ops := range spec.Paths {
+		for method := range ops {
+			documented = append(documented, strings.ToUpper(method)+" "+path)
+		}
+	}
+
+	// The specification, its viewer and the metrics are not part of the
+	// API
+	var routes []string
+	for _, pattern := range New(nil, nil).patterns {
+		if pattern != "GET /openapi.json" && pattern != "GET /docs" && pattern != "GET /metrics" {
+			routes = append(routes, pattern)
+		}
+	}
+
+	sort.Strings(documented)
+	sort.Strings(routes)
+	if strings.Join(documented, "\n") != strings.Join(routes, "\n") {
+		t.Errorf("The specification documents\n%s\nbut the routes are\n%s", strings.Join(documented, "\n"), strings.Join(routes, "\n"))
+	}
+}
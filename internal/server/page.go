@@ -0,0 +1,64 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package server
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/rs/zerolog/log"
+)
+
+// jokePage shows a joke, with Open Graph tags so chat apps show the joke
+// in the preview of a link to it
+var jokePage = template.Must(template.New("joke").Parse(`<!DOCTYPE html>
+<html lang="{{.Language}}">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Dad joke #{{.ID}}</title>
+<meta property="og:type" content="article">
+<meta property="og:title" content="Dad joke #{{.ID}}">
+<meta property="og:description" content="{{.Text}}">
+<style>
+body { font-family: sans-serif; max-width: 40em; margin: 4em auto; padding: 0 1em; line-height: 1.5; }
+blockquote { font-size: 1.5em; margin: 0 0 1em; }
+p { color: #666; }
+</style>
+</head>
+<body>
+<blockquote>{{.Text}}</blockquote>
+<p>Joke #{{.ID}}{{with .Source}} from {{.}}{{end}}, told by godad</p>
+</body>
+</html>
+`))
+
+// handleJokePage shows the stored joke with the local ID in the path, as
+// linked to by "godad share"
+func (s *Server) handleJokePage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	j, err := s.store.Get(r.Context(), id)
+	if errors.Is(err, joke.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		log.Error().Err(err).Int64("id", id).Msg("Failed to get joke")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", s.csp(pageCSP))
+	if err := jokePage.Execute(w, j); err != nil {
+		log.Error().Err(err).Msg("Failed to write response")
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+// Package server exposes the joke engine over a small REST API so a team
+// can share one godad instance instead of everyone hitting the upstream APIs.
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/rs/zerolog/log"
+)
+
+// MaxCount is the largest number of jokes a single request may ask for
+const MaxCount = 10
+
+// EngineFunc returns the engine that tells jokes in a language. The
+// language is empty when a request does not ask for one.
+type EngineFunc func(lang string) (*joke.Engine, error)
+
+// Server serves jokes over HTTP
+type Server struct {
+	store   joke.Store
+	engines EngineFunc
+	mux     *http.ServeMux
+	// patterns are the patterns of the routes, to check them against the
+	// OpenAPI specification
+	patterns []string
+
+	// keys holds the API keys clients must authenticate with, if any
+	keys      joke.KeyStore
+	limiter   Limiter
+	rateLimit int
+	proxies   []netip.Prefix
+	// origins may call the API from the browser, and frameAncestors
+	// frame the pages
+	origins        []string
+	frameAncestors []string
+	// metrics count the jokes served, if they are exported
+	metrics        *Metrics
+	metricsHandler http.Handler
+	// streams tell a joke every streamInterval until streamsDone is
+	// closed
+	streamInterval time.Duration
+	streamsDone    chan struct{}
+	stopStreams    sync.Once
+	// schema answers GraphQL queries
+	schema graphql.Schema
+}
+
+// New returns a server listing history from store and telling jokes with
+// the engines returned by engines
+func New(store joke.Store, engines EngineFunc) *Server {
+	s := &Server{
+		store:          store,
+		engines:        engines,
+		mux:            http.NewServeMux(),
+		limiter:        &MemoryLimiter{},
+		streamInterval: DefaultStreamInterval,
+		streamsDone:    make(chan struct{}),
+	}
+	schema, err := s.newSchema()
+	if err != nil {
+		// The schema is fixed, so this is a bug
+		panic(fmt.Sprintf("invalid GraphQL schema: %v", err))
+	}
+	s.schema = schema
+	s.routes()
+	return s
+}
+
+func (s *Server) routes() {
+	s.handle("GET /joke", s.authenticated(s.limited(s.handleJoke)))
+	s.handle("GET /jokes", s.authenticated(s.limited(s.handleJokes)))
+	s.handle("GET /history", s.authenticated(s.limited(s.handleHistory)))
+	s.handle("GET /stream", s.authenticated(s.limited(s.handleStream)))
+	s.handle("GET /ws", s.authenticated(s.limited(s.handleWebSocket)))
+	s.handle("GET /graphql", s.authenticated(s.limited(s.handleGraphQL)))
+	s.handle("POST /graphql", s.authenticated(s.limited(s.handleGraphQL)))
+	s.handle("GET /j/{id}", s.limited(s.handleJokePage))
+	s.handle("GET /openapi.json", s.limited(s.handleOpenAPI))
+	s.handle("GET /docs", s.limited(s.handleDocs))
+	s.handle("GET /metrics", s.handleMetrics)
+	// Probes are neither authenticated nor limited
+	s.handle("GET /healthz", s.handleHealth)
+	s.handle("GET /readyz", s.handleReady)
+}
+
+// handle routes requests matching pattern to handler
+func (s *Server) handle(pattern string, handler http.HandlerFunc) {
+	s.mux.HandleFunc(pattern, handler)
+	s.patterns = append(s.patterns, pattern)
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	if !s.setHeaders(rec, r) {
+		s.mux.ServeHTTP(rec, r)
+	}
+	// Probes come every few seconds and would drown the other requests
+	event := log.Info()
+	if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+		event = log.Debug()
+	}
+	event.
+		Str("method", r.Method).
+		Str("path", r.URL.Path).
+		Int("status", rec.status).
+		Dur("duration", time.Since(start)).
+		Msg("Handled request")
+}
+
+// handleJoke tells a single joke
+func (s *Server) handleJoke(w http.ResponseWriter, r *http.Request) {
+	engine, err := s.engine(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	j, err := engine.Tell(r.Context())
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	s.jokesServed(j)
+	writeJSON(w, http.StatusOK, j)
+}
+
+// handleJokes tells up to MaxCount jokes, as requested by the count parameter
+func (s *Server) handleJokes(w http.ResponseWriter, r *http.Request) {
+	count, err := intParam(r, "count", 1)
+	if err != nil || count < 1 || count > MaxCount {
+		writeError(w, http.StatusBadRequest, errors.New("count must be a number between 1 and "+strconv.Itoa(MaxCount)))
+		return
+	}
+
+	engine, err := s.engine(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	jokes, err := engine.TellMany(r.Context(), count)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	s.jokesServed(jokes...)
+	writeJSON(w, http.StatusOK, jokes)
+}
+
+// handleHistory lists previously told jokes, filtered and paged by the
+// lang, source, since (RFC 3339), limit and offset parameters
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := joke.HistoryFilter{
+		Language: q.Get("lang"),
+		Source:   q.Get("source"),
+	}
+
+	var err error
+	if filter.Limit, err = intParam(r, "limit", 0); err != nil || filter.Limit < 0 {
+		writeError(w, http.StatusBadRequest, errors.New("limit must be a positive number"))
+		return
+	}
+	if filter.Offset, err = intParam(r, "offset", 0); err != nil || filter.Offset < 0 {
+		writeError(w, http.StatusBadRequest, errors.New("offset must be a positive number"))
+		return
+	}
+	if since := q.Get("since"); since != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("since must be an RFC 3339 timestamp"))
+			return
+		}
+	}
+
+	jokes, err := s.store.History(r.Context(), filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if jokes == nil {
+		jokes = []joke.Joke{}
+	}
+	writeJSON(w, http.StatusOK, jokes)
+}
+
+// jokesServed counts jokes told to a client, if the server exports
+// metrics
+func (s *Server) jokesServed(jokes ...joke.Joke) {
+	if s.metrics != nil {
+		s.metrics.jokesServed(jokes...)
+	}
+}
+
+// engine returns an engine for the language requested by the lang parameter
+func (s *Server) engine(r *http.Request) (*joke.Engine, error) {
+	return s.engines(r.URL.Query().Get("lang"))
+}
+
+// intParam parses an integer query parameter, returning def when it is absent
+func intParam(r *http.Request, name string, def int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	return strconv.Atoi(v)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error().Err(err).Msg("Failed to write response")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// statusRecorder remembers the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Hijack lets WebSocket connections take over the connection of a
+// request
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	r.status = http.StatusSwitchingProtocols
+	return http.NewResponseController(r.ResponseWriter).Hijack()
+}
+
+// Unwrap returns the wrapped ResponseWriter, so streams can flush it
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/lhaig/godad/pkg/joke"
+)
+
+// countingSource returns a new joke on every fetch
+type countingSource struct {
+	lang string
+	n    atomic.Int64
+}
+
+func (s *countingSource) Name() string     { return "counting-" + s.lang }
+func (s *countingSource) Language() string { return s.lang }
+
+func (s *countingSource) Fetch(_ context.Context) (joke.Joke, error) {
+	return joke.Joke{Text: fmt.Sprintf("%s joke %d", s.lang, s.n.Add(1))}, nil
+}
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	s, _ := newTestHandler(t)
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newTestHandler returns a server telling jokes from counting sources and
+// its store, to set up further before serving
+func newTestHandler(t *testing.T) (*Server, *joke.SQLiteStore) {
+	t.Helper()
+	store, err := joke.OpenSQLite(filepath.Join(t.TempDir(), "jokes.db"))
+	if err != nil {
+		t.Fatalf("Failed to open the database: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	registry := joke.NewRegistry(&countingSource{lang: "en"}, &countingSource{lang: "de"})
+	return New(store, func(lang string) (*joke.Engine, error) {
+		sources, err := registry.Select(lang, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		return joke.NewEngine(store, sources...), nil
+	}), store
+}
+
+func getJSON(t *testing.T, url string, wantStatus int, v any) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s returned an error: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != wantStatus {
+		t.Fatalf("GET %s returned status %d, want %d", url, resp.StatusCode, wantStatus)
+	}
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("Error decoding response of %s: %v", url, err)
+		}
+	}
+}
+
+func TestJoke(t *testing.T) {
+	srv := newTestServer(t)
+
+	var j joke.Joke
+	getJSON(t, srv.URL+"/joke", http.StatusOK, &j)
+	if j.Text != "en joke 1" || j.ID == 0 {
+		t.Errorf("GET /joke returned %+v, want a stored English joke", j)
+	}
+
+	getJSON(t, srv.URL+"/joke?lang=de", http.StatusOK, &j)
+	if j.Text != "de joke 1" {
+		t.Errorf("GET /joke?lang=de returned %q, want a German joke", j.Text)
+	}
+
+	getJSON(t, srv.URL+"/joke?lang=xx", http.StatusBadRequest, nil)
+}
+
+func TestJokesAndHistory(t *testing.T) {
+	srv := newTestServer(t)
+
+	var jokes []joke.Joke
+	getJSON(t, srv.URL+"/jokes?lang=de&count=3", http.StatusOK, &jokes)
+	if len(jokes) != 3 {
+		t.Fatalf("GET /jokes returned %d jokes, want 3", len(jokes))
+	}
+
+	getJSON(t, srv.URL+"/jokes?count=0", http.StatusBadRequest, nil)
+	getJSON(t, srv.URL+"/jokes?count=100", http.StatusBadRequest, nil)
+
+	var history []joke.Joke
+	getJSON(t, srv.URL+"/history", http.StatusOK, &history)
+	if len(history) != 3 {
+		t.Errorf("GET /history returned %d jokes, want 3", len(history))
+	}
+
+	getJSON(t, srv.URL+"/history?limit=2&offset=2", http.StatusOK, &history)
+	if len(history) != 1 {
+		t.Errorf("GET /history?limit=2&offset=2 returned %d jokes, want 1", len(history))
+	}
+
+	getJSON(t, srv.URL+"/history?lang=en", http.StatusOK, &history)
+	if len(history) != 0 {
+		t.Errorf("GET /history?lang=en returned %d jokes, want 0", len(history))
+	}
+
+	getJSON(t, srv.URL+"/history?since=yesterday", http.StatusBadRequest, nil)
+}
+
+func TestJokePage(t *testing.T) {
+	srv := newTestServer(t)
+
+	var j joke.Joke
+	getJSON(t, srv.URL+"/joke", http.StatusOK, &j)
+	resp, err := http.Get(fmt.Sprintf("%s/j/%d", srv.URL, j.ID))
+	if err != nil {
+		t.Fatalf("GET /j/%d returned an error: %v", j.ID, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `<meta property="og:description" content="en joke 1">`) {
+		t.Errorf("GET /j/%d returned %d %q, want a page with the joke", j.ID, resp.StatusCode, body)
+	}
+
+	getJSON(t, srv.URL+"/j/42", http.StatusNotFound, nil)
+	getJSON(t, srv.URL+"/j/latest", http.StatusNotFound, nil)
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultStreamInterval is how often /stream tells a joke unless the
+	// server is told otherwise
+	DefaultStreamInterval = time.Minute
+	// streamHeartbeat is how often a stream sends a comment between jokes,
+	// so proxies don't close the connection for being idle
+	streamHeartbeat = 30 * time.Second
+)
+
+// StreamEvery makes /stream tell a joke every interval. Clients may ask
+// for a longer interval, but not for a shorter one.
+func (s *Server) StreamEvery(interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultStreamInterval
+	}
+	s.streamInterval = interval
+}
+
+// StopStreams ends the open streams and WebSocket connections, which
+// would otherwise keep a shutdown waiting
+func (s *Server) StopStreams() {
+	s.stopStreams.Do(func() { close(s.streamsDone) })
+}
+
+// handleStream tells a joke right away and another one every interval as
+// Server-Sent Events, until the client goes away
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	engine, err := s.engine(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	interval := s.streamInterval
+	if v := r.URL.Query().Get("interval"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < s.streamInterval {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("interval must be a duration of at least %s", s.streamInterval))
+			return
+		}
+		interval = d
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Keep nginx from buffering the events
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	jokes := time.NewTicker(interval)
+	defer jokes.Stop()
+	heartbeat := time.NewTicker(min(interval, streamHeartbeat))
+	defer heartbeat.Stop()
+	for {
+		j, err := engine.Tell(r.Context())
+		if r.Context().Err() != nil {
+			return
+		}
+		if err != nil {
+			err = writeEvent(w, "error", 0, map[string]string{"error": err.Error()})
+		} else {
+			s.jokesServed(j)
+			err = writeEvent(w, "joke", j.ID, j)
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			log.Debug().Err(err).Msg("Failed to write to stream")
+			return
+		}
+
+	wait:
+		for {
+			select {
+			case <-jokes.C:
+				break wait
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+					return
+				}
+				if err := rc.Flush(); err != nil {
+					return
+				}
+			case <-r.Context().Done():
+				return
+			case <-s.streamsDone:
+				return
+			}
+		}
+	}
+}
+
+// writeEvent writes v as the JSON data of a Server-Sent Event. An ID other
+// than zero is sent along.
+func writeEvent(w http.ResponseWriter, event string, id int64, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if id != 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
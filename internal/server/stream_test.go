@@ -0,0 +1,94 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lhaig/godad/pkg/joke"
+)
+
+func TestStream(t *testing.T) {
+	s, _ := newTestHandler(t)
+	s.StreamEvery(10 * time.Millisecond)
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+
+	resp, err := http.Get(srv.URL + "/stream?lang=de")
+	if err != nil {
+		t.Fatalf("GET /stream returned an error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("GET /stream returned status %d and Content-Type %q, want an event stream", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	// Read the first three events
+	var got []joke.Joke
+	var event, id string
+	scanner := bufio.NewScanner(resp.Body)
+	for len(got) < 3 && scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if event != "joke" {
+				t.Fatalf("GET /stream sent a %q event with %s, want jokes", event, line)
+			}
+			var j joke.Joke
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &j); err != nil {
+				t.Fatalf("GET /stream sent invalid data %q: %v", line, err)
+			}
+			if id == "" || id != strconv.FormatInt(j.ID, 10) {
+				t.Errorf("GET /stream sent joke %d with ID %q", j.ID, id)
+			}
+			got = append(got, j)
+			event, id = "", ""
+		}
+	}
+	if len(got) < 3 {
+		t.Fatalf("GET /stream ended after %d jokes: %v", len(got), scanner.Err())
+	}
+	for i, j := range got {
+		if want := "de joke " + strconv.Itoa(i+1); j.Text != want || j.Language != "de" {
+			t.Errorf("Joke %d of the stream is %+v, want %q in German", i, j, want)
+		}
+	}
+
+	// Stopping the streams ends them
+	s.StopStreams()
+	done := make(chan struct{})
+	go func() {
+		for scanner.Scan() {
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("The stream went on after the streams were stopped")
+	}
+}
+
+func TestStreamInterval(t *testing.T) {
+	srv := newTestServer(t)
+
+	for _, interval := range []string{"soon", "1s"} {
+		var body map[string]string
+		getJSON(t, srv.URL+"/stream?interval="+interval, http.StatusBadRequest, &body)
+		if !strings.Contains(body["error"], "at least 1m0s") {
+			t.Errorf("GET /stream?interval=%s returned error %q, want the shortest interval", interval, body["error"])
+		}
+	}
+}
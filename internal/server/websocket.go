@@ -0,0 +1,165 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// wsReadLimit is the size of the largest message a client may send
+	wsReadLimit = 4096
+	// wsPingInterval is how often the server pings clients, which are
+	// given up on when they don't answer within wsPongTimeout
+	wsPingInterval = 30 * time.Second
+	wsPongTimeout  = wsPingInterval + 10*time.Second
+	// wsWriteTimeout bounds writing a single message
+	wsWriteTimeout = 10 * time.Second
+)
+
+// wsRequest is a message from a WebSocket client
+type wsRequest struct {
+	// Action is what the client asks for, "tell" for a joke
+	Action string `json:"action"`
+	Lang   string `json:"lang,omitempty"`
+	// ID is sent back with the answer, so clients can match them up
+	ID string `json:"id,omitempty"`
+}
+
+// wsResponse is a message to a WebSocket client, either a joke or an
+// error
+type wsResponse struct {
+	Type  string     `json:"type"`
+	ID    string     `json:"id,omitempty"`
+	Joke  *joke.Joke `json:"joke,omitempty"`
+	Error string     `json:"error,omitempty"`
+	// RetryAfter is how many seconds a client over its rate limit has to
+	// wait
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+// handleWebSocket upgrades a request to a WebSocket connection telling a
+// joke whenever the client asks for one. Each joke counts against the
+// rate limit of the client.
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{CheckOrigin: s.websocketOrigin}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader answered the request already
+		log.Debug().Err(err).Msg("Failed to upgrade to a WebSocket connection")
+		return
+	}
+	defer conn.Close()
+
+	// Jokes are told until the connection closes, which the request
+	// doesn't notice once it is upgraded
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go s.keepAlive(ctx, conn)
+
+	conn.SetReadLimit(wsReadLimit)
+	_ = conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+
+	client, perMinute := s.client(r)
+	for {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Debug().Err(err).Msg("WebSocket connection failed")
+			}
+			return
+		}
+
+		var req wsRequest
+		var resp wsResponse
+		if err := json.Unmarshal(msg, &req); err != nil {
+			resp = wsResponse{Type: "error", Error: fmt.Sprintf("invalid message: %v", err)}
+		} else {
+			resp = s.answer(ctx, req, client, perMinute)
+		}
+		_ = conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		if err := conn.WriteJSON(resp); err != nil {
+			log.Debug().Err(err).Msg("Failed to write to WebSocket connection")
+			return
+		}
+	}
+}
+
+// answer answers a request of a WebSocket client
+func (s *Server) answer(ctx context.Context, req wsRequest, client string, perMinute int) wsResponse {
+	fail := func(err error) wsResponse {
+		return wsResponse{Type: "error", ID: req.ID, Error: err.Error()}
+	}
+	if req.Action != "tell" {
+		return fail(fmt.Errorf("unknown action %q, want tell", req.Action))
+	}
+	if wait := s.take(ctx, client, perMinute); wait > 0 {
+		resp := fail(errRateLimited)
+		resp.RetryAfter = int(math.Ceil(wait.Seconds()))
+		return resp
+	}
+
+	engine, err := s.engines(req.Lang)
+	if err != nil {
+		return fail(err)
+	}
+	j, err := engine.Tell(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	s.jokesServed(j)
+	return wsResponse{Type: "joke", ID: req.ID, Joke: &j}
+}
+
+// keepAlive pings the client of a WebSocket connection until ctx is done,
+// and closes the connection when the streams are stopped
+func (s *Server) keepAlive(ctx context.Context, conn *websocket.Conn) {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil && !errors.Is(err, websocket.ErrCloseSent) {
+				log.Debug().Err(err).Msg("Failed to ping WebSocket client")
+			}
+		case <-s.streamsDone:
+			msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+			_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsWriteTimeout))
+			conn.Close()
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// websocketOrigin reports whether the web page a WebSocket connection
+// comes from may open it. Besides the origins allowed to call the API,
+// those are pages of the server itself and clients that aren't browsers.
+func (s *Server) websocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	return s.originAllowed(origin)
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialWebSocket opens a WebSocket connection to /ws of srv
+func dialWebSocket(t *testing.T, srv *httptest.Server, header http.Header) *websocket.Conn {
+	t.Helper()
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", header)
+	if err != nil {
+		t.Fatalf("Failed to open a WebSocket connection: %v", err)
+	}
+	resp.Body.Close()
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// ask sends req over conn and returns the answer
+func ask(t *testing.T, conn *websocket.Conn, req any) wsResponse {
+	t.Helper()
+	if err := conn.WriteJSON(req); err != nil {
+		t.Fatalf("Failed to send %v: %v", req, err)
+	}
+	var resp wsResponse
+	if err := conn.ReadJSON(&resp); err != nil {
+		t.Fatalf("Failed to read the answer to %v: %v", req, err)
+	}
+	return resp
+}
+
+func TestWebSocket(t *testing.T) {
+	srv := newTestServer(t)
+	conn := dialWebSocket(t, srv, nil)
+
+	resp := ask(t, conn, wsRequest{Action: "tell", Lang: "de", ID: "1"})
+	if resp.Type != "joke" || resp.ID != "1" || resp.Joke == nil || resp.Joke.Text != "de joke 1" {
+		t.Errorf("Asking for a German joke returned %+v, want the first German joke", resp)
+	}
+	resp = ask(t, conn, wsRequest{Action: "tell"})
+	if resp.Type != "joke" || resp.Joke == nil || resp.Joke.Text != "en joke 1" {
+		t.Errorf("Asking for a joke returned %+v, want the first English joke", resp)
+	}
+
+	for _, req := range []any{
+		wsRequest{Action: "dance", ID: "2"},
+		wsRequest{Action: "tell", Lang: "xx", ID: "2"},
+		"tell",
+	} {
+		if resp := ask(t, conn, req); resp.Type != "error" || resp.Error == "" || resp.Joke != nil {
+			t.Errorf("Sending %v returned %+v, want an error", req, resp)
+		}
+	}
+}
+
+func TestWebSocketLimit(t *testing.T) {
+	s, _ := newTestHandler(t)
+	s.LimitRate(&MemoryLimiter{}, 2)
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+
+	// Opening the connection counts as a request as well
+	conn := dialWebSocket(t, srv, nil)
+	if resp := ask(t, conn, wsRequest{Action: "tell"}); resp.Type != "joke" {
+		t.Fatalf("Asking for a joke returned %+v, want a joke", resp)
+	}
+	resp := ask(t, conn, wsRequest{Action: "tell"})
+	if resp.Type != "error" || resp.RetryAfter <= 0 {
+		t.Errorf("Asking for a joke over the limit returned %+v, want an error with a retry time", resp)
+	}
+}
+
+func TestWebSocketOrigin(t *testing.T) {
+	s, _ := newTestHandler(t)
+	s.AllowOrigins([]string{"https://dashboard.example.com"})
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+
+	for _, origin := range []string{"https://dashboard.example.com", srv.URL} {
+		dialWebSocket(t, srv, http.Header{"Origin": {origin}})
+	}
+
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws", http.Header{"Origin": {"https://evil.example"}})
+	if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Opening a connection from another origin returned %v, want it forbidden", err)
+	}
+	if resp != nil {
+		resp.Body.Close()
+	}
+}
+
+func TestWebSocketStop(t *testing.T) {
+	s, _ := newTestHandler(t)
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	conn := dialWebSocket(t, srv, nil)
+
+	s.StopStreams()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("Reading after the streams were stopped returned %v, want the connection closed", err)
+	}
+}
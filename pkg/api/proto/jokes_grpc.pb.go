@@ -0,0 +1,263 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: jokes.proto
+
+package proto
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Jokes_TellJoke_FullMethodName    = "/godad.api.v1.Jokes/TellJoke"
+	Jokes_SearchJokes_FullMethodName = "/godad.api.v1.Jokes/SearchJokes"
+	Jokes_StreamJokes_FullMethodName = "/godad.api.v1.Jokes/StreamJokes"
+	Jokes_AddJoke_FullMethodName     = "/godad.api.v1.Jokes/AddJoke"
+)
+
+// JokesClient is the client API for Jokes service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type JokesClient interface {
+	// TellJoke tells a fresh joke
+	TellJoke(ctx context.Context, in *TellJokeRequest, opts ...grpc.CallOption) (*Joke, error)
+	// SearchJokes searches the jokes told before
+	SearchJokes(ctx context.Context, in *SearchJokesRequest, opts ...grpc.CallOption) (*SearchJokesResponse, error)
+	// StreamJokes tells a joke right away and another one every interval,
+	// until the call is canceled
+	StreamJokes(ctx context.Context, in *StreamJokesRequest, opts ...grpc.CallOption) (Jokes_StreamJokesClient, error)
+	// AddJoke stores a joke of your own. A joke that is stored already is
+	// returned as it is.
+	AddJoke(ctx context.Context, in *AddJokeRequest, opts ...grpc.CallOption) (*Joke, error)
+}
+
+type jokesClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewJokesClient(cc grpc.ClientConnInterface) JokesClient {
+	return &jokesClient{cc}
+}
+
+func (c *jokesClient) TellJoke(ctx context.Context, in *TellJokeRequest, opts ...grpc.CallOption) (*Joke, error) {
+	out := new(Joke)
+	err := c.cc.Invoke(ctx, Jokes_TellJoke_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *jokesClient) SearchJokes(ctx context.Context, in *SearchJokesRequest, opts ...grpc.CallOption) (*SearchJokesResponse, error) {
+	out := new(SearchJokesResponse)
+	err := c.cc.Invoke(ctx, Jokes_SearchJokes_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *jokesClient) StreamJokes(ctx context.Context, in *StreamJokesRequest, opts ...grpc.CallOption) (Jokes_StreamJokesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Jokes_ServiceDesc.Streams[0], Jokes_StreamJokes_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &jokesStreamJokesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Jokes_StreamJokesClient interface {
+	Recv() (*Joke, error)
+	grpc.ClientStream
+}
+
+type jokesStreamJokesClient struct {
+	grpc.ClientStream
+}
+
+func (x *jokesStreamJokesClient) Recv() (*Joke, error) {
+	m := new(Joke)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *jokesClient) AddJoke(ctx context.Context, in *AddJokeRequest, opts ...grpc.CallOption) (*Joke, error) {
+	out := new(Joke)
+	err := c.cc.Invoke(ctx, Jokes_AddJoke_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// JokesServer is the server API for Jokes service.
+// All implementations must embed UnimplementedJokesServer
+// for forward compatibility
+type JokesServer interface {
+	// TellJoke tells a fresh joke
+	TellJoke(context.Context, *TellJokeRequest) (*Joke, error)
+	// SearchJokes searches the jokes told before
+	SearchJokes(context.Context, *SearchJokesRequest) (*SearchJokesResponse, error)
+	// StreamJokes tells a joke right away and another one every interval,
+	// until the call is canceled
+	StreamJokes(*StreamJokesRequest, Jokes_StreamJokesServer) error
+	// AddJoke stores a joke of your own. A joke that is stored already is
+	// returned as it is.
+	AddJoke(context.Context, *AddJokeRequest) (*Joke, error)
+	mustEmbedUnimplementedJokesServer()
+}
+
+// UnimplementedJokesServer must be embedded to have forward compatible implementations.
+type UnimplementedJokesServer struct {
+}
+
+func (UnimplementedJokesServer) TellJoke(context.Context, *TellJokeRequest) (*Joke, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TellJoke not implemented")
+}
+func (UnimplementedJokesServer) SearchJokes(context.Context, *SearchJokesRequest) (*SearchJokesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SearchJokes not implemented")
+}
+func (UnimplementedJokesServer) StreamJokes(*StreamJokesRequest, Jokes_StreamJokesServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamJokes not implemented")
+}
+func (UnimplementedJokesServer) AddJoke(context.Context, *AddJokeRequest) (*Joke, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddJoke not implemented")
+}
+func (UnimplementedJokesServer) mustEmbedUnimplementedJokesServer() {}
+
+// UnsafeJokesServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to JokesServer will
+// result in compilation errors.
+type UnsafeJokesServer interface {
+	mustEmbedUnimplementedJokesServer()
+}
+
+func RegisterJokesServer(s grpc.ServiceRegistrar, srv JokesServer) {
+	s.RegisterService(&Jokes_ServiceDesc, srv)
+}
+
+func _Jokes_TellJoke_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TellJokeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(JokesServer).TellJoke(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Jokes_TellJoke_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(JokesServer).TellJoke(ctx, req.(*TellJokeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Jokes_SearchJokes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchJokesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(JokesServer).SearchJokes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Jokes_SearchJokes_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(JokesServer).SearchJokes(ctx, req.(*SearchJokesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Jokes_StreamJokes_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamJokesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(JokesServer).StreamJokes(m, &jokesStreamJokesServer{stream})
+}
+
+type Jokes_StreamJokesServer interface {
+	Send(*Joke) error
+	grpc.ServerStream
+}
+
+type jokesStreamJokesServer struct {
+	grpc.ServerStream
+}
+
+func (x *jokesStreamJokesServer) Send(m *Joke) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Jokes_AddJoke_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddJokeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(JokesServer).AddJoke(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Jokes_AddJoke_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(JokesServer).AddJoke(ctx, req.(*AddJokeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Jokes_ServiceDesc is the grpc.ServiceDesc for Jokes service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Jokes_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "godad.api.v1.Jokes",
+	HandlerType: (*JokesServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "TellJoke",
+			Handler:    _Jokes_TellJoke_Handler,
+		},
+		{
+			MethodName: "SearchJokes",
+			Handler:    _Jokes_SearchJokes_Handler,
+		},
+		{
+			MethodName: "AddJoke",
+			Handler:    _Jokes_AddJoke_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamJokes",
+			Handler:       _Jokes_StreamJokes_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "jokes.proto",
+}
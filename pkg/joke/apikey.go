@@ -0,0 +1,169 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrKeyNotFound is returned when an API key asked for does not exist or
+// has been revoked
+var ErrKeyNotFound = errors.New("API key not found")
+
+// ErrKeyExists is returned when adding an API key with the name of
+// another one
+var ErrKeyExists = errors.New("API key exists already")
+
+// apiKeyPrefix starts every API key, so leaked keys are easy to spot
+const apiKeyPrefix = "godad_"
+
+// APIKey is a key clients of the REST server authenticate with. Only the
+// hash of the key is stored, so a leaked database doesn't leak the keys.
+type APIKey struct {
+	// Name tells the holder of the key apart
+	Name string `json:"name"`
+	// Hash is the hash of the key, as returned by HashAPIKey
+	Hash string `json:"hash"`
+	// RateLimit is the number of requests per minute the key may make, or
+	// 0 for the server's default
+	RateLimit int       `json:"rate_limit,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	// RevokedAt is when the key was revoked, or nil while it is valid
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// KeyStore is a Store that keeps the API keys of the REST server. Revoked
+// keys are kept, so their names aren't handed out again.
+type KeyStore interface {
+	Store
+	// AddKey stores a key and sets its CreatedAt field, or returns
+	// ErrKeyExists if there is a key with its name
+	AddKey(ctx context.Context, k *APIKey) error
+	// RevokeKey revokes the key with the given name, or returns
+	// ErrKeyNotFound if there is no valid key with the name
+	RevokeKey(ctx context.Context, name string) error
+	// KeyByHash returns the valid key with the given hash, or
+	// ErrKeyNotFound
+	KeyByHash(ctx context.Context, hash string) (APIKey, error)
+	// Keys returns every key, revoked or not, sorted by name
+	Keys(ctx context.Context) ([]APIKey, error)
+}
+
+// NewAPIKey returns a new random API key and its hash
+func NewAPIKey() (key, hash string, err error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("error generating API key: %w", err)
+	}
+	key = apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return key, HashAPIKey(key), nil
+}
+
+// HashAPIKey returns the hash of an API key. Keys are random enough for a
+// plain SHA-256 hash, without a salt or key stretching.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// AddKey implements KeyStore
+func (s *SQLiteStore) AddKey(ctx context.Context, k *APIKey) error {
+	createdAt := time.Now().UTC()
+	_, err := s.db.ExecContext(ctx, "INSERT INTO api_keys (name, hash, rate_limit, created_at) VALUES (?, ?, ?, ?)",
+		k.Name, k.Hash, k.RateLimit, createdAt)
+	if isUniqueViolation(err) {
+		return ErrKeyExists
+	}
+	if err != nil {
+		return fmt.Errorf("error adding API key: %w", err)
+	}
+	k.CreatedAt = createdAt
+	return nil
+}
+
+// RevokeKey implements KeyStore
+func (s *SQLiteStore) RevokeKey(ctx context.Context, name string) error {
+	return revokeKey(ctx, s.db, "UPDATE api_keys SET revoked_at = ? WHERE name = ? AND revoked_at IS NULL", name)
+}
+
+// KeyByHash implements KeyStore
+func (s *SQLiteStore) KeyByHash(ctx context.Context, hash string) (APIKey, error) {
+	return scanKey(s.db.QueryRowContext(ctx, "SELECT "+keyColumns+" FROM api_keys WHERE hash = ? AND revoked_at IS NULL", hash))
+}
+
+// Keys implements KeyStore
+func (s *SQLiteStore) Keys(ctx context.Context) ([]APIKey, error) {
+	return queryKeys(ctx, s.db, "SELECT "+keyColumns+" FROM api_keys ORDER BY name")
+}
+
+// keyColumns are the columns scanKey reads
+const keyColumns = "name, hash, rate_limit, created_at, revoked_at"
+
+// scanKey reads a row selected with keyColumns
+func scanKey(row scanner) (APIKey, error) {
+	var (
+		k         APIKey
+		revokedAt sql.NullTime
+	)
+	err := row.Scan(&k.Name, &k.Hash, &k.RateLimit, &k.CreatedAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return APIKey{}, ErrKeyNotFound
+	}
+	if err != nil {
+		return APIKey{}, fmt.Errorf("error getting API key: %w", err)
+	}
+	if revokedAt.Valid {
+		k.RevokedAt = &revokedAt.Time
+	}
+	return k, nil
+}
+
+// queryKeys returns the keys query selects with keyColumns
+func queryKeys(ctx context.Context, db queryer, query string) ([]APIKey, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error listing API keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []APIKey
+	for rows.Next() {
+		k, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// revokeKey revokes the key name with query, which takes the time and the
+// name as parameters
+func revokeKey(ctx context.Context, db queryer, query, name string) error {
+	res, err := db.ExecContext(ctx, query, time.Now().UTC(), name)
+	if err != nil {
+		return fmt.Errorf("error revoking API key: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error revoking API key: %w", err)
+	}
+	if n == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+var _ KeyStore = (*SQLiteStore)(nil)
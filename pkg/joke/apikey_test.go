@@ -0,0 +1,79 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNewAPIKey(t *testing.T) {
+	key, hash, err := NewAPIKey()
+	if err != nil {
+		t.Fatalf("NewAPIKey() returned an error: %v", err)
+	}
+	if !strings.HasPrefix(key, apiKeyPrefix) || len(key) < 32 {
+		t.Errorf("NewAPIKey() returned key %q, want a long key starting with %q", key, apiKeyPrefix)
+	}
+	if hash != HashAPIKey(key) || hash == key {
+		t.Errorf("NewAPIKey() returned hash %q, want the hash of the key", hash)
+	}
+	if other, _, _ := NewAPIKey(); other == key {
+		t.Error("NewAPIKey() returned the same key twice")
+	}
+}
+
+func TestSQLiteKeys(t *testing.T) {
+	testKeyStore(t, newTestStore(t))
+}
+
+// testKeyStore checks adding, looking up and revoking API keys
+func testKeyStore(t *testing.T, store KeyStore) {
+	t.Helper()
+	ctx := context.Background()
+
+	office := APIKey{Name: "office-tv", Hash: HashAPIKey("godad_tv"), RateLimit: 10}
+	if err := store.AddKey(ctx, &office); err != nil {
+		t.Fatalf("AddKey() returned an error: %v", err)
+	}
+	if office.CreatedAt.IsZero() {
+		t.Error("AddKey() didn't set CreatedAt")
+	}
+	bot := APIKey{Name: "chat-bot", Hash: HashAPIKey("godad_bot")}
+	if err := store.AddKey(ctx, &bot); err != nil {
+		t.Fatalf("AddKey() returned an error: %v", err)
+	}
+	again := APIKey{Name: "office-tv", Hash: HashAPIKey("godad_other")}
+	if err := store.AddKey(ctx, &again); !errors.Is(err, ErrKeyExists) {
+		t.Errorf("AddKey() of a taken name returned %v, want ErrKeyExists", err)
+	}
+
+	k, err := store.KeyByHash(ctx, office.Hash)
+	if err != nil || k.Name != "office-tv" || k.RateLimit != 10 {
+		t.Errorf("KeyByHash() = %+v, %v, want the office-tv key", k, err)
+	}
+	if _, err := store.KeyByHash(ctx, HashAPIKey("godad_unknown")); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("KeyByHash() of an unknown key returned %v, want ErrKeyNotFound", err)
+	}
+
+	if err := store.RevokeKey(ctx, "office-tv"); err != nil {
+		t.Fatalf("RevokeKey() returned an error: %v", err)
+	}
+	if _, err := store.KeyByHash(ctx, office.Hash); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("KeyByHash() of a revoked key returned %v, want ErrKeyNotFound", err)
+	}
+	if err := store.RevokeKey(ctx, "office-tv"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("RevokeKey() of a revoked key returned %v, want ErrKeyNotFound", err)
+	}
+
+	keys, err := store.Keys(ctx)
+	if err != nil {
+		t.Fatalf("Keys() returned an error: %v", err)
+	}
+	if len(keys) != 2 || keys[0].Name != "chat-bot" || keys[0].RevokedAt != nil || keys[1].RevokedAt == nil {
+		t.Errorf("Keys() = %+v, want the valid chat-bot key and the revoked office-tv key", keys)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"fmt"
+)
+
+// backupPages is how many pages Backup copies per step, so writers are
+// only held up briefly while a large database is copied
+const backupPages = 1024
+
+// sqliteBackup is a backup in progress with the online backup API of the
+// driver
+type sqliteBackup interface {
+	// Step copies up to pages pages and reports whether the copy is done
+	Step(pages int) (bool, error)
+	Finish() error
+	Close() error
+}
+
+// Backup copies the database to a new SQLite database at path with the
+// online backup API, so the copy is consistent even while jokes are being
+// told. An existing database at path is overwritten. The copy of an
+// encrypted database is encrypted with the same key.
+func (s *SQLiteStore) Backup(ctx context.Context, path string) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("error opening database: %w", err)
+	}
+	defer conn.Close()
+
+	return withBackup(ctx, conn, path, s.key, func(backup sqliteBackup) error {
+		for {
+			if err := ctx.Err(); err != nil {
+				_ = backup.Close()
+				return err
+			}
+			done, err := backup.Step(backupPages)
+			if err != nil {
+				_ = backup.Close()
+				return fmt.Errorf("error backing up database: %w", err)
+			}
+			if done {
+				break
+			}
+		}
+		if err := backup.Finish(); err != nil {
+			return fmt.Errorf("error finishing backup: %w", err)
+		}
+		return nil
+	})
+}
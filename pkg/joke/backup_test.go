@@ -0,0 +1,37 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLiteBackup(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	j := Joke{Text: "A joke worth keeping", Source: "user", Language: "en", Tags: []string{"keepers"}}
+	if err := store.Save(ctx, &j); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "backup.db")
+	if err := store.Backup(ctx, path); err != nil {
+		t.Fatalf("Backup() returned an error: %v", err)
+	}
+
+	backup, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatalf("Failed to open the backup: %v", err)
+	}
+	defer backup.Close()
+	got, err := backup.Get(ctx, j.ID)
+	if err != nil {
+		t.Fatalf("Get() from the backup returned an error: %v", err)
+	}
+	if got.Text != j.Text || len(got.Tags) != 1 {
+		t.Errorf("backed up joke = %+v, want %+v", got, j)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// TellCached tells a joke without any network calls, for shell prompts and
+// other places that must never wait. The last told joke is told again
+// while it was told less than maxAge ago; after that the next prefetched
+// joke is told. When none are left, the last told joke or a built-in one
+// is told again.
+//
+// low reports that no prefetched jokes are left, so the caller should
+// prefetch more, typically in the background.
+func (e *Engine) TellCached(ctx context.Context, maxAge time.Duration) (j Joke, low bool, err error) {
+	if len(e.Mix) > 0 {
+		return e.mixed()[0].TellCached(ctx, maxAge)
+	}
+	history, err := e.Store.History(ctx, HistoryFilter{Language: e.Language, Limit: 1})
+	if err != nil {
+		return Joke{}, false, err
+	}
+
+	// Don't repeat a joke told before the filter was set
+	if len(history) > 0 && !e.Filter.Allows(history[0]) {
+		history = nil
+	}
+
+	if len(history) == 0 || time.Since(*history[0].ToldAt) >= maxAge {
+		j, err = e.nextUntold(ctx)
+		switch {
+		case err == nil:
+		case !errors.Is(err, ErrNoJokes):
+			return Joke{}, false, err
+		case len(history) > 0:
+			j = history[0]
+		default:
+			if j, err = NewEmbeddedSource(e.Language).Fetch(ctx); err != nil {
+				return Joke{}, false, err
+			}
+		}
+	} else {
+		j = history[0]
+	}
+
+	_, err = e.stored().NextUntold(ctx, e.Language)
+	if err != nil && !errors.Is(err, ErrNoJokes) {
+		return Joke{}, false, err
+	}
+	return j, errors.Is(err, ErrNoJokes), nil
+}
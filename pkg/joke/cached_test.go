@@ -0,0 +1,84 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEngineTellCached(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	src := &sequenceSource{}
+	engine := NewEngine(store, src)
+
+	j, low, err := engine.TellCached(ctx, time.Hour)
+	if err != nil {
+		t.Fatalf("TellCached() returned an error: %v", err)
+	}
+	if j.Source != EmbeddedSourceName || !low {
+		t.Errorf("TellCached() on an empty store = %q from %s (low %v), want a built-in joke", j.Text, j.Source, low)
+	}
+
+	for _, text := range []string{"first", "second"} {
+		if err := store.Save(ctx, &Joke{Text: text, Language: "en"}); err != nil {
+			t.Fatalf("Save() returned an error: %v", err)
+		}
+	}
+
+	steps := []struct {
+		maxAge  time.Duration
+		want    string
+		wantLow bool
+	}{
+		// The next prefetched joke is told
+		{maxAge: time.Hour, want: "first", wantLow: false},
+		// and told again while it is fresh
+		{maxAge: time.Hour, want: "first", wantLow: false},
+		// Once it is too old, the next one is told
+		{maxAge: 0, want: "second", wantLow: true},
+		// Without prefetched jokes, the last one is repeated
+		{maxAge: 0, want: "second", wantLow: true},
+	}
+	for i, step := range steps {
+		j, low, err := engine.TellCached(ctx, step.maxAge)
+		if err != nil {
+			t.Fatalf("Step %d: TellCached() returned an error: %v", i, err)
+		}
+		if j.Text != step.want || low != step.wantLow {
+			t.Errorf("Step %d: TellCached() = %q (low %v), want %q (low %v)", i, j.Text, low, step.want, step.wantLow)
+		}
+	}
+	if src.n != 0 {
+		t.Errorf("TellCached() fetched %d jokes from the source, want none", src.n)
+	}
+}
+
+// BenchmarkTellCached measures the shell prompt path, which must stay well
+// below what a prompt can wait for
+func BenchmarkTellCached(b *testing.B) {
+	store, err := OpenSQLite(filepath.Join(b.TempDir(), "jokes.db"))
+	if err != nil {
+		b.Fatalf("Failed to open the database: %v", err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+	for i := range 100 {
+		if err := store.Save(ctx, &Joke{Text: fmt.Sprintf("Prefetched joke %d", i), Language: "en"}); err != nil {
+			b.Fatalf("Save() returned an error: %v", err)
+		}
+	}
+	engine := NewEngine(store)
+
+	b.ResetTimer()
+	for range b.N {
+		if _, _, err := engine.TellCached(ctx, time.Hour); err != nil {
+			b.Fatalf("TellCached() returned an error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ClaimStore is a Store that can mark a joke as told only if nobody told
+// it since it was read, so godad processes sharing the store never tell
+// the same joke at the same time
+type ClaimStore interface {
+	Store
+	// Claim marks j as told like MarkTold if it has been told j.TimesTold
+	// times so far, and reports whether it did
+	Claim(ctx context.Context, j *Joke) (bool, error)
+}
+
+// claim marks j as told and reports whether it is this engine's to tell.
+// Stores that can't claim jokes always let the engine tell them.
+func (e *Engine) claim(ctx context.Context, j *Joke) (bool, error) {
+	if claimer, ok := e.Store.(ClaimStore); ok {
+		return claimer.Claim(ctx, j)
+	}
+	return true, e.Store.MarkTold(ctx, j)
+}
+
+// claimNext claims and returns the stored joke next returns, asking next
+// again while other processes tell the jokes first
+func (e *Engine) claimNext(ctx context.Context, next func() (Joke, error)) (Joke, error) {
+	for {
+		j, err := next()
+		if err == nil && !e.Filter.Allows(j) {
+			err = ErrNoJokes
+		}
+		if err != nil {
+			return Joke{}, err
+		}
+		claimed, err := e.claim(ctx, &j)
+		if err != nil {
+			return Joke{}, err
+		}
+		if claimed {
+			return j, nil
+		}
+		log.Debug().Int64("id", j.ID).Msg("Joke was told by another process, picking another one")
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestEngineSharedStore(t *testing.T) {
+	for name, open := range map[string]func(path string) (Store, error){
+		"SQLite": func(path string) (Store, error) { return OpenSQLite(path) },
+		"JSON":   func(path string) (Store, error) { return OpenJSONStore(path) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "jokes")
+			ctx := context.Background()
+
+			// Two godad processes tell the prefetched jokes at once
+			var engines [2]*Engine
+			for i := range engines {
+				store, err := open(path)
+				if err != nil {
+					t.Fatalf("Failed to open the store: %v", err)
+				}
+				defer store.Close()
+				engines[i] = NewEngine(store)
+				engines[i].Offline = true
+			}
+			const prefetched = 20
+			for i := range prefetched {
+				if err := engines[0].Store.Save(ctx, &Joke{Text: fmt.Sprintf("Prefetched joke %d", i), Language: "en"}); err != nil {
+					t.Fatalf("Save() returned an error: %v", err)
+				}
+			}
+
+			var (
+				mu   sync.Mutex
+				told = map[int64]int{}
+				wg   sync.WaitGroup
+			)
+			for _, engine := range engines {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for {
+						j, err := engine.Tell(ctx)
+						if err != nil {
+							return
+						}
+						mu.Lock()
+						told[j.ID]++
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+
+			if len(told) != prefetched {
+				t.Errorf("Told %d of %d prefetched jokes", len(told), prefetched)
+			}
+			for id, n := range told {
+				if n > 1 {
+					t.Errorf("Joke %d was told %d times, want once", id, n)
+				}
+			}
+		})
+	}
+}
+
+func TestLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "godad.lock")
+	unlock, err := LockFile(context.Background(), path)
+	if err != nil {
+		t.Fatalf("LockFile() returned an error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*lockPoll)
+	defer cancel()
+	if _, err := LockFile(ctx, path); err == nil {
+		t.Fatal("LockFile() of a locked file succeeded, want it to wait")
+	}
+
+	if err := unlock(); err != nil {
+		t.Fatalf("unlock() returned an error: %v", err)
+	}
+	unlock, err = LockFile(context.Background(), path)
+	if err != nil {
+		t.Fatalf("LockFile() of an unlocked file returned an error: %v", err)
+	}
+	unlock()
+}
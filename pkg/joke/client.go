@@ -0,0 +1,168 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// HTTPOptions configures the client NewHTTPClient returns. Zero fields
+// keep the defaults of net/http.
+type HTTPOptions struct {
+	// Timeout bounds whole requests. Fetches are bounded by their context
+	// anyway, see Engine.Timeout, so it is usually left zero.
+	Timeout time.Duration
+	// DialTimeout bounds connecting to a server
+	DialTimeout time.Duration
+	// TLSHandshakeTimeout bounds the TLS handshake with a server
+	TLSHandshakeTimeout time.Duration
+	// IdleConnTimeout is how long unused connections are kept open for
+	// the next request
+	IdleConnTimeout time.Duration
+	// MaxIdleConnsPerHost is how many unused connections to each server
+	// are kept open, DefaultMaxIdleConnsPerHost if zero
+	MaxIdleConnsPerHost int
+	// Proxy is the proxy to send requests through instead of the one in
+	// the HTTP_PROXY and HTTPS_PROXY environment variables. Hosts listed
+	// in NO_PROXY are still connected to directly.
+	Proxy *url.URL
+	// TLS configures TLS connections, see NewTLSConfig
+	TLS *tls.Config
+}
+
+// TLSOptions configures the TLS connections of a client, for networks
+// where a proxy intercepts them with a certificate of its own
+type TLSOptions struct {
+	// CAFile is a PEM file of certificate authorities to trust besides
+	// those of the system
+	CAFile string
+	// CertFile and KeyFile are the PEM files of a certificate to identify
+	// the client with, and its private key
+	CertFile string
+	KeyFile  string
+	// InsecureSkipVerify trusts every certificate, which leaves the
+	// connections open to anyone in between. Only use it for testing.
+	InsecureSkipVerify bool
+}
+
+// NewTLSConfig returns a TLS configuration following opts, or nil if opts
+// keeps the defaults
+func NewTLSConfig(opts TLSOptions) (*tls.Config, error) {
+	if opts == (TLSOptions{}) {
+		return nil, nil
+	}
+	// #nosec G402 -- skipping verification has to be asked for explicitly
+	config := &tls.Config{InsecureSkipVerify: opts.InsecureSkipVerify}
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in CA file %s", opts.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		if opts.CertFile == "" || opts.KeyFile == "" {
+			return nil, errors.New("a client certificate needs both a certificate and a key file")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// DefaultMaxIdleConnsPerHost keeps a connection open for each of the
+// default workers, so fetching several jokes at once doesn't reconnect
+const DefaultMaxIdleConnsPerHost = DefaultWorkers
+
+// DefaultHTTPClient is the client sources, translators and the other
+// services godad talks to are created with. Sharing it keeps connections
+// alive across fetches and workers, over HTTP/2 where servers speak it.
+// It has no timeout of its own, requests are bounded by their context,
+// see Engine.Timeout. Replace it before creating them to change how
+// godad connects.
+var DefaultHTTPClient = NewHTTPClient(HTTPOptions{})
+
+// NewHTTPClient returns a client configured by opts, on a transport of
+// its own. Proxies are taken from the HTTP_PROXY, HTTPS_PROXY and
+// NO_PROXY environment variables.
+func NewHTTPClient(opts HTTPOptions) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ForceAttemptHTTP2 = true
+	transport.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	if opts.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+	}
+	if opts.DialTimeout > 0 {
+		transport.DialContext = (&net.Dialer{Timeout: opts.DialTimeout, KeepAlive: 30 * time.Second}).DialContext
+	}
+	if opts.TLSHandshakeTimeout > 0 {
+		transport.TLSHandshakeTimeout = opts.TLSHandshakeTimeout
+	}
+	if opts.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = opts.IdleConnTimeout
+	}
+	if opts.Proxy != nil {
+		proxy := (&httpproxy.Config{
+			HTTPProxy:  opts.Proxy.String(),
+			HTTPSProxy: opts.Proxy.String(),
+			NoProxy:    httpproxy.FromEnvironment().NoProxy,
+		}).ProxyFunc()
+		transport.Proxy = func(r *http.Request) (*url.URL, error) {
+			return proxy(r.URL)
+		}
+	}
+	if opts.TLS != nil {
+		transport.TLSClientConfig = opts.TLS
+	}
+	return &http.Client{Transport: headerTransport{transport}, Timeout: opts.Timeout}
+}
+
+// headersKey is the context key of the headers added by WithHeaders
+type headersKey struct{}
+
+// WithHeaders returns a copy of ctx whose requests carry headers, set over
+// those of the request, when sent by a client from NewHTTPClient. The
+// engine sends the Headers of each source this way.
+func WithHeaders(ctx context.Context, headers map[string]string) context.Context {
+	return context.WithValue(ctx, headersKey{}, headers)
+}
+
+// headerTransport adds the headers of WithHeaders to requests
+type headerTransport struct {
+	http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	headers, _ := req.Context().Value(headersKey{}).(map[string]string)
+	if len(headers) > 0 {
+		// Requests must not be changed by round trippers
+		req = req.Clone(req.Context())
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+	}
+	return t.RoundTripper.RoundTrip(req)
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHTTPClientReusesConnections(t *testing.T) {
+	var conns atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			t.Errorf("Request used %s, want HTTP/2", r.Proto)
+		}
+		w.Write([]byte(`{"joke": "A joke"}`))
+	}))
+	server.EnableHTTP2 = true
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	src := NewHTTPSource("test", "en", server.URL)
+	// Trust the certificate of the test server
+	src.Client = NewHTTPClient(HTTPOptions{TLS: server.Client().Transport.(*http.Transport).TLSClientConfig.Clone()})
+	for range 3 {
+		if _, err := src.Fetch(context.Background()); err != nil {
+			t.Fatalf("Fetch() returned an error: %v", err)
+		}
+	}
+	if n := conns.Load(); n != 1 {
+		t.Errorf("Fetches opened %d connections, want 1", n)
+	}
+}
+
+func TestHTTPClientProxy(t *testing.T) {
+	var proxied atomic.Bool
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Store(r.Host == "jokes.example.com")
+		w.Write([]byte(`{"joke": "A proxied joke"}`))
+	}))
+	defer proxy.Close()
+	proxyURL, _ := url.Parse(proxy.URL)
+
+	src := NewHTTPSource("test", "en", "http://jokes.example.com/random")
+	src.Client = NewHTTPClient(HTTPOptions{Proxy: proxyURL})
+	if j, err := src.Fetch(context.Background()); err != nil || j.Text != "A proxied joke" {
+		t.Fatalf("Fetch() through a proxy = %+v, %v, want the proxied joke", j, err)
+	}
+	if !proxied.Load() {
+		t.Error("The request didn't go through the proxy")
+	}
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte(`{"joke": "A secure joke"}`))
+	}))
+	defer server.Close()
+	src := NewHTTPSource("test", "en", server.URL)
+
+	// The certificate of the server isn't trusted by default
+	src.Client = NewHTTPClient(HTTPOptions{})
+	if _, err := src.Fetch(context.Background()); err == nil {
+		t.Error("Fetch() from a server with an unknown certificate succeeded")
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range []TLSOptions{{CAFile: caFile}, {InsecureSkipVerify: true}} {
+		config, err := NewTLSConfig(opts)
+		if err != nil {
+			t.Fatalf("NewTLSConfig(%+v) returned an error: %v", opts, err)
+		}
+		src.Client = NewHTTPClient(HTTPOptions{TLS: config})
+		if _, err := src.Fetch(context.Background()); err != nil {
+			t.Errorf("Fetch() with %+v returned an error: %v", opts, err)
+		}
+	}
+
+	if config, err := NewTLSConfig(TLSOptions{}); config != nil || err != nil {
+		t.Errorf("NewTLSConfig() without options = %v, %v, want nil", config, err)
+	}
+	if _, err := NewTLSConfig(TLSOptions{CertFile: caFile}); err == nil {
+		t.Error("NewTLSConfig() of a certificate without a key returned no error")
+	}
+	if _, err := NewTLSConfig(TLSOptions{CAFile: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+		t.Error("NewTLSConfig() of a missing CA file returned no error")
+	}
+}
+
+func TestEngineHeaders(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+		w.Write([]byte(`{"joke": "A joke with a key"}`))
+	}))
+	defer server.Close()
+
+	src := NewHTTPSource("keyed", "en", server.URL)
+	src.Client = NewHTTPClient(HTTPOptions{})
+	src.Headers = map[string]string{"X-Api-Key": "from the source"}
+	engine := NewEngine(newTestStore(t), src)
+	engine.Headers = map[string]map[string]string{
+		"keyed": {"X-Api-Key": "secret", "User-Agent": "joke-bot/1.0"},
+		"other": {"X-Other": "unused"},
+	}
+	if _, err := engine.Fresh(context.Background()); err != nil {
+		t.Fatalf("Fresh() returned an error: %v", err)
+	}
+	if got.Get("X-Api-Key") != "secret" || got.Get("User-Agent") != "joke-bot/1.0" || got.Get("X-Other") != "" {
+		t.Errorf("Request headers = %v, want the headers of the source", got)
+	}
+}
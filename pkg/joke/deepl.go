@@ -0,0 +1,65 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// DeepL endpoints, for the free and the paid API plans
+const (
+	DeepLFreeURL = "https://api-free.deepl.com/v2/translate"
+	DeepLProURL  = "https://api.deepl.com/v2/translate"
+)
+
+// DeepL translates with the DeepL API
+type DeepL struct {
+	URL    string
+	Key    string
+	Client *http.Client
+}
+
+// NewDeepL returns a translator using the DeepL API with key. Keys of the
+// free plan, which end in ":fx", use the free endpoint.
+func NewDeepL(key string) *DeepL {
+	url := DeepLProURL
+	if strings.HasSuffix(key, ":fx") {
+		url = DeepLFreeURL
+	}
+	return &DeepL{
+		URL:    url,
+		Key:    key,
+		Client: DefaultHTTPClient,
+	}
+}
+
+// Name implements Translator
+func (t *DeepL) Name() string {
+	return "deepl"
+}
+
+// Translate implements Translator
+func (t *DeepL) Translate(ctx context.Context, text, from, to string) (string, error) {
+	in := map[string]any{
+		"text":        []string{text},
+		"source_lang": strings.ToUpper(from),
+		"target_lang": strings.ToUpper(to),
+	}
+	var out struct {
+		Translations []struct {
+			Text string `json:"text"`
+		} `json:"translations"`
+	}
+	headers := map[string]string{"Authorization": "DeepL-Auth-Key " + t.Key}
+	if err := postJSON(ctx, t.Client, t.URL, headers, in, &out); err != nil {
+		return "", err
+	}
+	if len(out.Translations) == 0 {
+		return "", errors.New("no translation in response")
+	}
+	return out.Translations[0].Text, nil
+}
@@ -0,0 +1,203 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog/log"
+)
+
+// jokeFileExts are the extensions of the files a DirSource reads from a
+// directory
+var jokeFileExts = []string{".txt", ".json", ".yaml", ".yml", ".md", ".markdown"}
+
+// DirSource tells the jokes in a directory of joke files, in the formats
+// FileSource reads. The files are parsed once and the directory is watched,
+// so new and changed files are picked up without a restart.
+type DirSource struct {
+	// Pattern is a directory, whose .txt, .json, .yaml, .yml, .md and
+	// .markdown files are read, or a glob like "jokes/*.txt"
+	Pattern string
+	name    string
+	lang    string
+
+	mu       sync.Mutex
+	jokes    []Joke
+	stale    bool
+	watching bool
+	watcher  *fsnotify.Watcher
+}
+
+// NewDirSource returns a source called name for the jokes in lang in the
+// files matching pattern
+func NewDirSource(name, pattern, lang string) *DirSource {
+	return &DirSource{Pattern: pattern, name: name, lang: normalizeLanguage(lang), stale: true}
+}
+
+// Name implements Source
+func (s *DirSource) Name() string {
+	return s.name
+}
+
+// Language implements Source
+func (s *DirSource) Language() string {
+	return s.lang
+}
+
+// List implements ListSource. The files are read again only after they
+// changed, or every time if the directory can't be watched.
+func (s *DirSource) List(_ context.Context) ([]Joke, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.watching {
+		s.watch()
+	}
+	if !s.stale && s.watcher != nil {
+		return s.jokes, nil
+	}
+
+	files, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+	var jokes []Joke
+	for _, file := range files {
+		fileJokes, err := readJokeFile(file)
+		if err != nil {
+			// Skip broken files, they may be half written
+			log.Warn().Err(err).Str("file", file).Msg("Skipping joke file")
+			continue
+		}
+		for _, j := range fileJokes {
+			j.Source = s.name
+			if j.Language == "" {
+				j.Language = s.lang
+			}
+			jokes = append(jokes, j)
+		}
+	}
+	s.jokes, s.stale = jokes, false
+	return jokes, nil
+}
+
+// Fetch implements Source
+func (s *DirSource) Fetch(ctx context.Context) (Joke, error) {
+	jokes, err := s.List(ctx)
+	if err != nil {
+		return Joke{}, err
+	}
+	if len(jokes) == 0 {
+		return Joke{}, fmt.Errorf("no jokes in %s", s.Pattern)
+	}
+	// #nosec G404 -- picking a joke does not need a secure random number
+	return jokes[rand.IntN(len(jokes))], nil
+}
+
+// Close stops watching the directory
+func (s *DirSource) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.watcher == nil {
+		return nil
+	}
+	err := s.watcher.Close()
+	s.watcher = nil
+	return err
+}
+
+// dir returns the directory holding the files and the pattern of their
+// names
+func (s *DirSource) dir() (dir, pattern string) {
+	if info, err := os.Stat(s.Pattern); err == nil && info.IsDir() {
+		return s.Pattern, ""
+	}
+	return filepath.Dir(s.Pattern), filepath.Base(s.Pattern)
+}
+
+// match reports whether the file at path holds jokes for the source
+func (s *DirSource) match(path string) bool {
+	_, pattern := s.dir()
+	if pattern == "" {
+		return slices.Contains(jokeFileExts, strings.ToLower(filepath.Ext(path)))
+	}
+	ok, _ := filepath.Match(pattern, filepath.Base(path))
+	return ok
+}
+
+// files returns the joke files in sorted order
+func (s *DirSource) files() ([]string, error) {
+	dir, _ := s.dir()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading joke directory: %w", err)
+	}
+	var files []string
+	for _, entry := range entries {
+		if path := filepath.Join(dir, entry.Name()); !entry.IsDir() && s.match(path) {
+			files = append(files, path)
+		}
+	}
+	return files, nil
+}
+
+// watch starts watching the directory, marking the jokes stale whenever a
+// joke file is created, written, removed or renamed. It must be called
+// with mu held.
+func (s *DirSource) watch() {
+	s.watching = true
+
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		dir, _ := s.dir()
+		if err = watcher.Add(dir); err != nil {
+			watcher.Close()
+		}
+	}
+	if err != nil {
+		log.Debug().Err(err).Str("source", s.name).Msg("Not watching joke directory, reading it every time")
+		return
+	}
+	s.watcher = watcher
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if s.match(event.Name) {
+					log.Debug().Str("file", event.Name).Str("op", event.Op.String()).Msg("Joke file changed")
+					s.mu.Lock()
+					s.stale = true
+					s.mu.Unlock()
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				if errors.Is(err, fsnotify.ErrEventOverflow) {
+					s.mu.Lock()
+					s.stale = true
+					s.mu.Unlock()
+				}
+				log.Debug().Err(err).Str("source", s.name).Msg("Error watching joke directory")
+			}
+		}
+	}()
+}
+
+var _ ListSource = (*DirSource)(nil)
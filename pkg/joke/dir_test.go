@@ -0,0 +1,76 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeJokeFile writes content to the file name in dir
+func writeJokeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+		t.Fatalf("Error writing %s: %v", name, err)
+	}
+}
+
+// waitForJokes lists the jokes of src until there are want of them
+func waitForJokes(t *testing.T, src *DirSource, want int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		jokes, err := src.List(context.Background())
+		if err != nil {
+			t.Fatalf("List() returned an error: %v", err)
+		}
+		if len(jokes) == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("List() returned %d jokes, want %d", len(jokes), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDirSourceReload(t *testing.T) {
+	dir := t.TempDir()
+	writeJokeFile(t, dir, "family.txt", "One\nTwo\n")
+	writeJokeFile(t, dir, "README.md", "Not a joke\n")
+	src := NewDirSource("family", dir, "en")
+	t.Cleanup(func() { src.Close() })
+
+	waitForJokes(t, src, 2)
+
+	// New and changed files are picked up, others are ignored
+	writeJokeFile(t, dir, "more.yaml", "- Three\n- joke: Vier\n  lang: de\n")
+	waitForJokes(t, src, 4)
+	writeJokeFile(t, dir, "family.txt", "One\n")
+	waitForJokes(t, src, 3)
+	writeJokeFile(t, dir, "notes.md", "Still not a joke\n")
+	if err := os.Remove(filepath.Join(dir, "more.yaml")); err != nil {
+		t.Fatalf("Error removing more.yaml: %v", err)
+	}
+	waitForJokes(t, src, 1)
+}
+
+func TestDirSourceGlob(t *testing.T) {
+	dir := t.TempDir()
+	writeJokeFile(t, dir, "a.txt", "One\n")
+	writeJokeFile(t, dir, "b.json", `["Two"]`)
+	src := NewDirSource("txt", filepath.Join(dir, "*.txt"), "en")
+	t.Cleanup(func() { src.Close() })
+
+	j, err := src.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch() returned an error: %v", err)
+	}
+	if j.Text != "One" || j.Source != "txt" {
+		t.Errorf("Fetch() = %+v, want the joke from a.txt", j)
+	}
+}
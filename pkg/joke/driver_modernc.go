@@ -0,0 +1,86 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build !cgo || purego
+
+package joke
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqliteDriver is the database/sql driver databases are opened with. Builds
+// without cgo, or with the purego tag, use the pure Go port of SQLite.
+const sqliteDriver = "sqlite"
+
+// SQLiteLibrary names the SQLite this build uses, for "godad version"
+const SQLiteLibrary = "modernc.org/sqlite (pure Go)"
+
+// EncryptionSupported reports whether this build can open encrypted
+// databases, which needs the sqlcipher build tag
+const EncryptionSupported = false
+
+// sqliteDSN returns the data source name that opens the database at path
+// with the settings OpenEncryptedSQLite needs. Only unencrypted databases
+// can be opened.
+func sqliteDSN(path, key string) (string, error) {
+	if key != "" {
+		return "", ErrEncryptionUnsupported
+	}
+	// Times are written like go-sqlite3 does, so databases work the same
+	// with either driver
+	return path + "?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_txlock=immediate&_time_format=sqlite", nil
+}
+
+// isUniqueViolation checks the code of the driver's errors
+func isUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+// backuper is implemented by the connections of the driver
+type backuper interface {
+	NewBackup(dstURI string) (*sqlite.Backup, error)
+}
+
+// moderncBackup adapts the backups of the driver to sqliteBackup
+type moderncBackup struct {
+	*sqlite.Backup
+}
+
+// Step implements sqliteBackup. The driver reports whether there is more
+// to copy rather than whether the copy is done.
+func (b moderncBackup) Step(pages int) (bool, error) {
+	more, err := b.Backup.Step(int32(pages))
+	return !more && err == nil, err
+}
+
+// Close implements sqliteBackup. The driver has no way to abandon a
+// backup other than finishing it.
+func (b moderncBackup) Close() error {
+	return b.Backup.Finish()
+}
+
+// withBackup uses the backups of the driver, which can't encrypt the copy
+func withBackup(_ context.Context, src *sql.Conn, path, key string, copy func(sqliteBackup) error) error {
+	if key != "" {
+		return ErrEncryptionUnsupported
+	}
+	return src.Raw(func(srcDriver any) error {
+		conn, ok := srcDriver.(backuper)
+		if !ok {
+			return errors.New("backups need the sqlite driver")
+		}
+		backup, err := conn.NewBackup(path)
+		if err != nil {
+			return fmt.Errorf("error starting backup: %w", err)
+		}
+		return copy(moderncBackup{backup})
+	})
+}
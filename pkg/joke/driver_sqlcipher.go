@@ -0,0 +1,77 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build cgo && sqlcipher && !purego
+
+package joke
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+
+	sqlite3 "github.com/mutecomm/go-sqlcipher/v4"
+)
+
+// sqliteDriver is the database/sql driver databases are opened with
+const sqliteDriver = "sqlite3"
+
+// SQLiteLibrary names the SQLite this build uses, for "godad version"
+const SQLiteLibrary = "go-sqlcipher (cgo)"
+
+// EncryptionSupported reports whether this build can open encrypted
+// databases, which needs the sqlcipher build tag
+const EncryptionSupported = true
+
+// sqliteDSN returns the data source name that opens the database at path
+// with the settings OpenEncryptedSQLite needs, encrypted with key unless
+// it is empty
+func sqliteDSN(path, key string) (string, error) {
+	dsn := path + "?_foreign_keys=on&_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate"
+	if key != "" {
+		dsn += "&_pragma_key=" + url.QueryEscape(key)
+	}
+	return dsn, nil
+}
+
+// isUniqueViolation checks the extended code of the driver's errors
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+}
+
+// withBackup opens the database at path and copies into it with the
+// backup API of the driver's connections
+func withBackup(ctx context.Context, src *sql.Conn, path, key string, copy func(sqliteBackup) error) error {
+	dsn, err := sqliteDSN(path, key)
+	if err != nil {
+		return err
+	}
+	dest, err := sql.Open(sqliteDriver, dsn)
+	if err != nil {
+		return fmt.Errorf("error opening backup database: %w", err)
+	}
+	defer dest.Close()
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("error opening backup database: %w", err)
+	}
+	defer destConn.Close()
+
+	return destConn.Raw(func(destDriver any) error {
+		return src.Raw(func(srcDriver any) error {
+			destSQLite, ok := destDriver.(*sqlite3.SQLiteConn)
+			srcSQLite, ok2 := srcDriver.(*sqlite3.SQLiteConn)
+			if !ok || !ok2 {
+				return errors.New("backups need the sqlcipher driver")
+			}
+			backup, err := destSQLite.Backup("main", srcSQLite, "main")
+			if err != nil {
+				return fmt.Errorf("error starting backup: %w", err)
+			}
+			return copy(backup)
+		})
+	})
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"fmt"
+)
+
+// EditStore is a Store whose jokes can be changed and deleted
+type EditStore interface {
+	Store
+	// Update changes the text of the stored joke with the given ID. It
+	// returns ErrNotFound if there is no such joke and ErrDuplicate if
+	// another stored joke has the new text.
+	Update(ctx context.Context, id int64, text string) error
+	// Delete removes the stored joke with the given ID along with its
+	// tags, or returns ErrNotFound
+	Delete(ctx context.Context, id int64) error
+}
+
+// Update implements EditStore. The embeddings of the old text are
+// dropped, so the joke is embedded again by EmbedStored.
+func (s *SQLiteStore) Update(ctx context.Context, id int64, text string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error updating joke: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	res, err := tx.ExecContext(ctx, "UPDATE jokes SET joke = ?, hash = ? WHERE id = ?", text, textHash(text), id)
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return fmt.Errorf("error updating joke: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: %d", ErrNotFound, id)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM embeddings WHERE joke_id = ?", id); err != nil {
+		return fmt.Errorf("error updating joke: %w", err)
+	}
+	return tx.Commit()
+}
+
+// Delete implements EditStore
+func (s *SQLiteStore) Delete(ctx context.Context, id int64) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM jokes WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("error deleting joke: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: %d", ErrNotFound, id)
+	}
+	return nil
+}
+
+var _ EditStore = (*SQLiteStore)(nil)
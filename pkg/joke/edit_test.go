@@ -0,0 +1,57 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSQLiteUpdateDelete(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	first := Joke{Text: "A jkoe with a typo", Source: "user", Language: "en", Tags: []string{"typos"}}
+	second := Joke{Text: "Another joke", Source: "user", Language: "en"}
+	for _, j := range []*Joke{&first, &second} {
+		if err := store.Save(ctx, j); err != nil {
+			t.Fatalf("Save() returned an error: %v", err)
+		}
+	}
+	if err := store.SaveEmbedding(ctx, first.ID, "test", []float32{1, 0}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Update(ctx, first.ID, "A joke without a typo"); err != nil {
+		t.Fatalf("Update() returned an error: %v", err)
+	}
+	if found, err := store.Find(ctx, Joke{Text: "a joke without a typo!"}); err != nil || found.ID != first.ID {
+		t.Errorf("Find() with the new text = %+v, %v, want the updated joke", found, err)
+	}
+	if _, err := store.Find(ctx, Joke{Text: "A jkoe with a typo"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Find() with the old text returned %v, want ErrNotFound", err)
+	}
+	if vectors, _ := store.Embeddings(ctx, "test", "en"); len(vectors) != 0 {
+		t.Errorf("Embeddings() = %v after Update(), want the stale embedding dropped", vectors)
+	}
+	if err := store.Update(ctx, first.ID, "Another joke."); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Update() to the text of another joke returned %v, want ErrDuplicate", err)
+	}
+	if err := store.Update(ctx, 99, "Nope"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Update() of a missing joke returned %v, want ErrNotFound", err)
+	}
+
+	if err := store.Delete(ctx, first.ID); err != nil {
+		t.Fatalf("Delete() returned an error: %v", err)
+	}
+	if _, err := store.Get(ctx, first.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of the deleted joke returned %v, want ErrNotFound", err)
+	}
+	if tags, _ := store.Tags(ctx); len(tags) != 0 {
+		t.Errorf("Tags() = %v after Delete(), want the tags of the joke gone", tags)
+	}
+	if err := store.Delete(ctx, first.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete() of a missing joke returned %v, want ErrNotFound", err)
+	}
+}
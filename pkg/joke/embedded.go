@@ -0,0 +1,103 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strings"
+)
+
+// EmbeddedSourceName is the name of the source telling the built-in jokes
+const EmbeddedSourceName = "embedded"
+
+// corpus holds a small set of jokes per language, one joke per line, so
+// there is always a joke to tell even without a network or a database
+//
+//go:embed corpus/*.txt
+var corpus embed.FS
+
+// EmbeddedSource tells jokes compiled into the binary. It is the last
+// resort of the fallback chain, for a first run without network access.
+type EmbeddedSource struct {
+	lang  string
+	jokes []string
+}
+
+// NewEmbeddedSource returns a source telling the built-in jokes in lang,
+// or the English ones when there are none in lang
+func NewEmbeddedSource(lang string) *EmbeddedSource {
+	lang = normalizeLanguage(lang)
+	jokes := embeddedJokes(lang)
+	if len(jokes) == 0 {
+		lang = DefaultLanguage
+		jokes = embeddedJokes(lang)
+	}
+	return &EmbeddedSource{lang: lang, jokes: jokes}
+}
+
+// embeddedJokes returns the built-in jokes in lang
+func embeddedJokes(lang string) []string {
+	data, err := corpus.ReadFile("corpus/" + lang + ".txt")
+	if err != nil {
+		return nil
+	}
+
+	var jokes []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			jokes = append(jokes, line)
+		}
+	}
+	return jokes
+}
+
+// EmbeddedLanguages returns the sorted languages there are built-in jokes
+// in. They can be told in even when no online source serves them.
+func EmbeddedLanguages() []string {
+	entries, err := corpus.ReadDir("corpus")
+	if err != nil {
+		return nil
+	}
+	var langs []string
+	for _, e := range entries {
+		langs = append(langs, strings.TrimSuffix(e.Name(), ".txt"))
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Name implements Source
+func (s *EmbeddedSource) Name() string {
+	return EmbeddedSourceName
+}
+
+// Language implements Source
+func (s *EmbeddedSource) Language() string {
+	return s.lang
+}
+
+// Fetch implements Source
+func (s *EmbeddedSource) Fetch(_ context.Context) (Joke, error) {
+	if len(s.jokes) == 0 {
+		return Joke{}, fmt.Errorf("no embedded jokes for language %q", s.lang)
+	}
+	return Joke{
+		// #nosec G404 -- picking a joke does not need a secure random number
+		Text:     s.jokes[rand.IntN(len(s.jokes))],
+		Source:   s.Name(),
+		Language: s.lang,
+	}, nil
+}
+
+// Repeats implements Repeater
+func (s *EmbeddedSource) Repeats() bool {
+	return true
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEmbeddedSource(t *testing.T) {
+	for _, lang := range EmbeddedLanguages() {
+		src := NewEmbeddedSource(lang)
+		if src.Language() != lang {
+			t.Errorf("NewEmbeddedSource(%q) serves %q", lang, src.Language())
+		}
+		j, err := src.Fetch(context.Background())
+		if err != nil {
+			t.Fatalf("Fetch() returned an error: %v", err)
+		}
+		if j.Text == "" || j.Language != lang {
+			t.Errorf("Fetch() returned %+v, want a joke in %s", j, lang)
+		}
+	}
+
+	if langs := EmbeddedLanguages(); len(langs) < 5 || langs[0] != "de" {
+		t.Errorf("EmbeddedLanguages() = %v, want de, en, es, fr and nl", langs)
+	}
+
+	// Languages without a corpus fall back to English
+	if src := NewEmbeddedSource("xx"); src.Language() != "en" {
+		t.Errorf("NewEmbeddedSource(\"xx\") serves %q, want en", src.Language())
+	}
+}
+
+func TestEngineTellFirstRunOffline(t *testing.T) {
+	store := newTestStore(t)
+	engine := NewEngine(store, &staticSource{name: "api", lang: "en", text: "unused"}, NewStoreSource(store, ""), NewEmbeddedSource("en"))
+	engine.Offline = true
+
+	// No network and an empty database still tell a joke
+	j, err := engine.Tell(context.Background())
+	if err != nil {
+		t.Fatalf("Tell() returned an error: %v", err)
+	}
+	if j.Source != EmbeddedSourceName {
+		t.Errorf("Tell() returned a joke from %q, want the embedded corpus", j.Source)
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+)
+
+// DefaultSimilarity is the cosine similarity from which the engine takes a
+// joke for a paraphrase of a stored one
+const DefaultSimilarity = 0.9
+
+// Embedder turns texts into embeddings, vectors that are close for texts
+// with a similar meaning
+type Embedder interface {
+	// Model identifies the model, as embeddings of different models can't
+	// be compared
+	Model() string
+	// Embed returns the embedding of every text, in order
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// EmbeddingStore is a Store that keeps the embeddings of stored jokes, so
+// the engine can recognize paraphrases of them, see Engine.Embedder
+type EmbeddingStore interface {
+	Store
+	// SaveEmbedding stores the embedding made with model of the joke id
+	SaveEmbedding(ctx context.Context, id int64, model string, vector []float32) error
+	// Embeddings returns the embeddings made with model of the stored
+	// jokes in lang, by joke ID
+	Embeddings(ctx context.Context, model, lang string) (map[int64][]float32, error)
+	// Unembedded returns up to limit stored jokes without an embedding
+	// made with model
+	Unembedded(ctx context.Context, model string, limit int) ([]Joke, error)
+}
+
+// OpenAIEmbedder makes embeddings with an OpenAI compatible embeddings
+// API, like that of OpenAI or a local Ollama server
+type OpenAIEmbedder struct {
+	// URL is the base URL of the API, without /embeddings
+	URL    string
+	Key    string
+	Client *http.Client
+	model  string
+}
+
+// NewOpenAIEmbedder returns an embedder using model at the API at url
+func NewOpenAIEmbedder(url, model string) *OpenAIEmbedder {
+	return &OpenAIEmbedder{
+		URL:    strings.TrimSuffix(url, "/"),
+		Client: DefaultHTTPClient,
+		model:  model,
+	}
+}
+
+// Model implements Embedder
+func (e *OpenAIEmbedder) Model() string {
+	return e.model
+}
+
+// Embed implements Embedder
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	in := map[string]any{"model": e.model, "input": texts}
+	var out struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	var headers map[string]string
+	if e.Key != "" {
+		headers = map[string]string{"Authorization": "Bearer " + e.Key}
+	}
+	if err := postJSON(ctx, e.Client, e.URL+"/embeddings", headers, in, &out); err != nil {
+		return nil, err
+	}
+	if len(out.Data) != len(texts) {
+		return nil, fmt.Errorf("got %d embeddings for %d texts", len(out.Data), len(texts))
+	}
+	vectors := make([][]float32, len(texts))
+	for _, d := range out.Data {
+		if d.Index < 0 || d.Index >= len(texts) || len(d.Embedding) == 0 {
+			return nil, errors.New("invalid embedding in response")
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return vectors, nil
+}
+
+// cosine returns the cosine similarity of a and b, 1 for vectors pointing
+// the same way
+func cosine(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+// paraphrase returns the embedding of j and the ID of the stored joke j
+// paraphrases, or 0 if there is none. It returns a nil embedding when the
+// engine doesn't compare embeddings.
+func (e *Engine) paraphrase(ctx context.Context, j Joke) ([]float32, int64, error) {
+	store, ok := e.Store.(EmbeddingStore)
+	if e.Embedder == nil || !ok {
+		return nil, 0, nil
+	}
+	vectors, err := e.Embedder.Embed(ctx, []string{j.Text})
+	if err != nil {
+		return nil, 0, fmt.Errorf("error embedding joke: %w", err)
+	}
+	stored, err := store.Embeddings(ctx, e.Embedder.Model(), j.Language)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	threshold := e.Similarity
+	if threshold <= 0 {
+		threshold = DefaultSimilarity
+	}
+	for id, vector := range stored {
+		if cosine(vectors[0], vector) >= threshold {
+			return vectors[0], id, nil
+		}
+	}
+	return vectors[0], 0, nil
+}
+
+// EmbedStored makes the missing embeddings of the stored jokes with
+// embedder, batch jokes per request, so new jokes are compared to every
+// stored joke. It returns how many embeddings were made.
+func EmbedStored(ctx context.Context, store EmbeddingStore, embedder Embedder, batch int) (int, error) {
+	batch = max(batch, 1)
+	made := 0
+	for {
+		jokes, err := store.Unembedded(ctx, embedder.Model(), batch)
+		if err != nil || len(jokes) == 0 {
+			return made, err
+		}
+		texts := make([]string, len(jokes))
+		for i, j := range jokes {
+			texts[i] = j.Text
+		}
+		vectors, err := embedder.Embed(ctx, texts)
+		if err != nil {
+			return made, fmt.Errorf("error embedding jokes: %w", err)
+		}
+		for i, j := range jokes {
+			if err := store.SaveEmbedding(ctx, j.ID, embedder.Model(), vectors[i]); err != nil {
+				return made, err
+			}
+			made++
+		}
+	}
+}
+
+// encodeVector encodes a vector as little endian float32 values
+func encodeVector(v []float32) []byte {
+	b := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(f))
+	}
+	return b
+}
+
+// decodeVector decodes a vector encoded with encodeVector
+func decodeVector(b []byte) []float32 {
+	v := make([]float32, len(b)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	return v
+}
+
+// SaveEmbedding implements EmbeddingStore
+func (s *SQLiteStore) SaveEmbedding(ctx context.Context, id int64, model string, vector []float32) error {
+	if _, err := s.db.ExecContext(ctx, `INSERT INTO embeddings (joke_id, model, vector) VALUES (?, ?, ?)
+		ON CONFLICT (joke_id, model) DO UPDATE SET vector = excluded.vector`,
+		id, model, encodeVector(vector)); err != nil {
+		return fmt.Errorf("error saving embedding: %w", err)
+	}
+	return nil
+}
+
+// Embeddings implements EmbeddingStore
+func (s *SQLiteStore) Embeddings(ctx context.Context, model, lang string) (map[int64][]float32, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT e.joke_id, e.vector FROM embeddings e JOIN jokes j ON j.id = e.joke_id
+		WHERE e.model = ? AND j.language = ?`, model, lang)
+	if err != nil {
+		return nil, fmt.Errorf("error getting embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	vectors := map[int64][]float32{}
+	for rows.Next() {
+		var (
+			id   int64
+			blob []byte
+		)
+		if err := rows.Scan(&id, &blob); err != nil {
+			return nil, fmt.Errorf("error reading embedding: %w", err)
+		}
+		vectors[id] = decodeVector(blob)
+	}
+	return vectors, rows.Err()
+}
+
+// Unembedded implements EmbeddingStore
+func (s *SQLiteStore) Unembedded(ctx context.Context, model string, limit int) ([]Joke, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+jokeColumns+` FROM jokes
+		WHERE NOT EXISTS (SELECT 1 FROM embeddings e WHERE e.joke_id = jokes.id AND e.model = ?) ORDER BY id LIMIT ?`, model, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error getting jokes without embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	var jokes []Joke
+	for rows.Next() {
+		j, err := scanJoke(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error reading joke: %w", err)
+		}
+		jokes = append(jokes, j)
+	}
+	return jokes, rows.Err()
+}
+
+var _ EmbeddingStore = (*SQLiteStore)(nil)
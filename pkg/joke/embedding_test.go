@@ -0,0 +1,132 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// wordsEmbedder embeds texts as counts of their words, hashed into a few
+// buckets, so texts sharing most of their words are similar
+type wordsEmbedder struct {
+	calls int
+}
+
+func (e *wordsEmbedder) Model() string { return "words" }
+
+func (e *wordsEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	e.calls++
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = make([]float32, 64)
+		for _, word := range strings.Fields(NormalizeText(text)) {
+			h := fnv.New32a()
+			_, _ = h.Write([]byte(word))
+			vectors[i][h.Sum32()%64]++
+		}
+	}
+	return vectors, nil
+}
+
+// listedSource returns its jokes in order, one per fetch
+type listedSource struct {
+	jokes []string
+}
+
+func (s *listedSource) Name() string     { return "listed" }
+func (s *listedSource) Language() string { return "en" }
+
+func (s *listedSource) Fetch(_ context.Context) (Joke, error) {
+	if len(s.jokes) == 0 {
+		return Joke{}, errors.New("no more jokes")
+	}
+	j := Joke{Text: s.jokes[0]}
+	s.jokes = s.jokes[1:]
+	return j, nil
+}
+
+func TestEngineSkipsParaphrases(t *testing.T) {
+	store := newTestStore(t)
+	engine := NewEngine(store, &listedSource{jokes: []string{
+		"Why did the chicken cross the road? To get to the other side.",
+		"Why did the chicken cross the street? To get to the other side!",
+		"I'm reading a book about anti-gravity. It's impossible to put down.",
+	}})
+	engine.Embedder = &wordsEmbedder{}
+	engine.Similarity = 0.8
+
+	for _, want := range []string{"road", "anti-gravity"} {
+		j, err := engine.Tell(context.Background())
+		if err != nil {
+			t.Fatalf("Tell() returned an error: %v", err)
+		}
+		if !strings.Contains(j.Text, want) {
+			t.Errorf("Tell() = %q, want the joke about %s", j.Text, want)
+		}
+	}
+
+	embeddings, err := store.Embeddings(context.Background(), "words", "en")
+	if err != nil {
+		t.Fatalf("Embeddings() returned an error: %v", err)
+	}
+	if len(embeddings) != 2 {
+		t.Errorf("Embeddings() returned %d embeddings, want one per told joke", len(embeddings))
+	}
+}
+
+func TestEmbedStored(t *testing.T) {
+	store := newTestStore(t)
+	for _, text := range []string{"First joke.", "Second joke.", "Third joke."} {
+		if err := store.Save(context.Background(), &Joke{Text: text, Language: "en"}); err != nil {
+			t.Fatalf("Save() returned an error: %v", err)
+		}
+	}
+
+	embedder := &wordsEmbedder{}
+	n, err := EmbedStored(context.Background(), store, embedder, 2)
+	if err != nil {
+		t.Fatalf("EmbedStored() returned an error: %v", err)
+	}
+	if n != 3 || embedder.calls != 2 {
+		t.Errorf("EmbedStored() made %d embeddings in %d requests, want 3 in 2", n, embedder.calls)
+	}
+	if jokes, _ := store.Unembedded(context.Background(), "words", 10); len(jokes) != 0 {
+		t.Errorf("Unembedded() = %v after EmbedStored(), want none", jokes)
+	}
+	if jokes, _ := store.Unembedded(context.Background(), "other", 10); len(jokes) != 3 {
+		t.Errorf("Unembedded() for another model returned %d jokes, want 3", len(jokes))
+	}
+}
+
+func TestOpenAIEmbedder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data": [{"index": 1, "embedding": [0, 1]}, {"index": 0, "embedding": [1, 0]}]}`))
+	}))
+	defer server.Close()
+
+	vectors, err := NewOpenAIEmbedder(server.URL+"/v1", "tiny").Embed(context.Background(), []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("Embed() returned an error: %v", err)
+	}
+	if len(vectors) != 2 || vectors[0][0] != 1 || vectors[1][1] != 1 {
+		t.Errorf("Embed() = %v, want the embeddings in the order of the texts", vectors)
+	}
+	if got := cosine(vectors[0], vectors[1]); got != 0 {
+		t.Errorf("cosine() of orthogonal vectors = %v, want 0", got)
+	}
+	if got := cosine(decodeVector(encodeVector(vectors[0])), vectors[0]); got != 1 {
+		t.Errorf("cosine() of a decoded vector and itself = %v, want 1", got)
+	}
+}
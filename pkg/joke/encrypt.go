@@ -0,0 +1,43 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Rekey copies the database to a new database at path encrypted with key,
+// or unencrypted if key is empty, to encrypt an existing database or
+// decrypt an encrypted one. It needs SQLCipher, see EncryptionSupported.
+func (s *SQLiteStore) Rekey(ctx context.Context, path, key string) error {
+	if !EncryptionSupported {
+		return ErrEncryptionUnsupported
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%s exists already", path)
+	}
+
+	// Attached databases belong to a connection
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("error opening database: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS rekeyed KEY ?", path, key); err != nil {
+		return fmt.Errorf("error creating %s: %w", path, err)
+	}
+	_, err = conn.ExecContext(ctx, "SELECT sqlcipher_export('rekeyed')")
+	if _, detachErr := conn.ExecContext(ctx, "DETACH DATABASE rekeyed"); err == nil {
+		err = detachErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("error copying database: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptedSQLite(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "jokes.db")
+	if !EncryptionSupported {
+		if _, err := OpenEncryptedSQLite(path, "secret"); !errors.Is(err, ErrEncryptionUnsupported) {
+			t.Errorf("OpenEncryptedSQLite() without SQLCipher returned %v, want ErrEncryptionUnsupported", err)
+		}
+		store := newTestStore(t)
+		if err := store.Rekey(ctx, path, "secret"); !errors.Is(err, ErrEncryptionUnsupported) {
+			t.Errorf("Rekey() without SQLCipher returned %v, want ErrEncryptionUnsupported", err)
+		}
+		return
+	}
+
+	plain, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := Joke{Text: "A confidential joke", Source: "user", Language: "en"}
+	if err := plain.Save(ctx, &j); err != nil {
+		t.Fatal(err)
+	}
+	encrypted := filepath.Join(dir, "encrypted.db")
+	if err := plain.Rekey(ctx, encrypted, "secret"); err != nil {
+		t.Fatalf("Rekey() returned an error: %v", err)
+	}
+	plain.Close()
+
+	if data, _ := os.ReadFile(encrypted); bytes.Contains(data, []byte("confidential")) || bytes.HasPrefix(data, []byte("SQLite format")) {
+		t.Error("Rekey() wrote the database unencrypted")
+	}
+	if store, err := OpenEncryptedSQLite(encrypted, "wrong"); err == nil {
+		store.Close()
+		t.Error("OpenEncryptedSQLite() with the wrong key returned no error")
+	}
+
+	store, err := OpenEncryptedSQLite(encrypted, "secret")
+	if err != nil {
+		t.Fatalf("OpenEncryptedSQLite() returned an error: %v", err)
+	}
+	defer store.Close()
+	if got, err := store.Get(ctx, j.ID); err != nil || got.Text != j.Text {
+		t.Errorf("Get() from the encrypted database = %+v, %v, want %q", got, err, j.Text)
+	}
+
+	backup := filepath.Join(dir, "backup.db")
+	if err := store.Backup(ctx, backup); err != nil {
+		t.Fatalf("Backup() of the encrypted database returned an error: %v", err)
+	}
+	if data, _ := os.ReadFile(backup); bytes.HasPrefix(data, []byte("SQLite format")) {
+		t.Error("Backup() of the encrypted database is unencrypted")
+	}
+}
@@ -0,0 +1,909 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultMaxDuplicates is how many already stored jokes the engine
+	// accepts from a source before giving up on it
+	DefaultMaxDuplicates = 5
+	// DefaultTimeout is how long the engine waits for a single fetch
+	DefaultTimeout = 10 * time.Second
+	// DefaultWorkers is how many jokes TellMany and Prefetch fetch at the
+	// same time
+	DefaultWorkers = 4
+)
+
+// ErrOffline is returned when a joke would have to be fetched in offline mode
+var ErrOffline = errors.New("offline mode, not fetching jokes")
+
+// Engine fetches fresh jokes from its sources and records them in a Store.
+// Sources form a fallback chain: they are tried in order until one of
+// them produces a joke. Sources that implement Repeater, like the local
+// database, can end the chain with a joke that has been told before.
+//
+// There are two kinds of retries: a source that returns a joke which is
+// already stored is asked again straight away, up to MaxDuplicates times,
+// while a fetch that fails with a network or server error is retried with
+// backoff according to Retry.
+type Engine struct {
+	Sources       []Source
+	Store         Store
+	MaxDuplicates int
+	Retry         RetryPolicy
+	// Timeout limits how long a single fetch from a source may take. Zero
+	// means no limit other than the deadline of the context.
+	Timeout time.Duration
+	// SourceTimeouts overrides Timeout for individual sources, by name
+	SourceTimeouts map[string]time.Duration
+	// Headers adds HTTP headers to the requests of sources, by name, like
+	// API keys. They are sent by clients from NewHTTPClient, like
+	// DefaultHTTPClient, see WithHeaders.
+	Headers map[string]map[string]string
+	// Language selects the prefetched jokes the engine tells. It defaults
+	// to the language of the first source.
+	Language string
+	// Offline disables fetching, so only stored jokes are told
+	Offline bool
+	// Tag restricts Tell to stored jokes with this tag
+	Tag string
+	// Workers limits how many jokes TellMany and Prefetch fetch at the
+	// same time
+	Workers int
+	// RepeatAfter makes jokes told longer ago than this fresh again: a
+	// source may tell them once more, and they are repeated, least
+	// recently told first, before random stored jokes. Zero means jokes
+	// are only repeated when no fresh ones can be fetched.
+	RepeatAfter time.Duration
+	// Weights makes the fetching sources take turns in a random order
+	// instead of the order of Sources: a source with twice the weight is
+	// tried first twice as often. Sources without a weight count as 1 and
+	// repeating sources keep their place at the end of the chain.
+	Weights map[string]float64
+	// Breaker skips sources that keep failing, if the store is a
+	// HealthStore. Repeating sources are never skipped.
+	Breaker Breaker
+	// RateLimits limits how often sources are fetched from, by name, if
+	// the store is a LimitStore. A fetch waits for the rate limit up to
+	// Retry.MaxBackoff and fails with ErrRateLimited if it would have to
+	// wait longer.
+	RateLimits map[string]RateLimit
+	// Embedder makes the engine reject new jokes that paraphrase a stored
+	// joke in the same language, if the store is an EmbeddingStore. A joke
+	// paraphrases another when the cosine similarity of their embeddings
+	// is at least Similarity, DefaultSimilarity if zero.
+	Embedder   Embedder
+	Similarity float64
+	// Filter keeps the jokes it rejects from being told: fetched ones are
+	// neither told nor stored, and stored ones are skipped if the store is
+	// a FilterStore
+	Filter Filter
+	// Mix makes the engine tell jokes in several languages, see NewMix.
+	// Each joke is told by one of these engines, picked at random in
+	// proportion to their weights, instead of from Sources.
+	Mix []MixedEngine
+
+	// mu keeps concurrent calls from claiming the same prefetched joke or
+	// storing the same fetched joke twice
+	mu sync.Mutex
+}
+
+// NewEngine returns an Engine using the given store and chain of sources
+func NewEngine(store Store, sources ...Source) *Engine {
+	e := &Engine{
+		Sources:       sources,
+		Store:         store,
+		MaxDuplicates: DefaultMaxDuplicates,
+		Retry:         DefaultRetryPolicy,
+		Timeout:       DefaultTimeout,
+		Language:      DefaultLanguage,
+		Workers:       DefaultWorkers,
+		Breaker:       DefaultBreaker,
+		RateLimits:    maps.Clone(DefaultRateLimits),
+	}
+	if len(sources) > 0 && sources[0].Language() != "" {
+		e.Language = sources[0].Language()
+	}
+	return e
+}
+
+// Fresh fetches a joke that hasn't been used before and stores it as told
+func (e *Engine) Fresh(ctx context.Context) (Joke, error) {
+	if len(e.Mix) > 0 {
+		return e.mixed()[0].Fresh(ctx)
+	}
+	return e.fetch(ctx, true)
+}
+
+// fetch tries each fetching source in turn for a joke that is not in the
+// store yet and saves it, as told or for later
+func (e *Engine) fetch(ctx context.Context, told bool) (Joke, error) {
+	if e.Offline {
+		return Joke{}, ErrOffline
+	}
+
+	var errs []error
+	for _, src := range e.sources() {
+		if repeats(src) {
+			continue
+		}
+		j, err := e.fetchFrom(ctx, src, told)
+		if err == nil {
+			return j, nil
+		}
+		// Don't try the remaining sources once the caller gave up
+		if ctx.Err() != nil {
+			return Joke{}, ctx.Err()
+		}
+		log.Warn().Err(err).Str("source", src.Name()).Msg("Source did not provide a fresh joke")
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return Joke{}, errors.New("no joke sources configured")
+	}
+	return Joke{}, errors.Join(errs...)
+}
+
+// fetchFrom fetches up to MaxDuplicates jokes from src until one is new
+func (e *Engine) fetchFrom(ctx context.Context, src Source, told bool) (Joke, error) {
+	if lister, ok := src.(ListSource); ok {
+		return e.pickFrom(ctx, lister, told)
+	}
+	for i := 0; i < e.MaxDuplicates; i++ {
+		j, err := e.fetchOnce(ctx, src)
+		if err != nil {
+			return Joke{}, fmt.Errorf("error fetching joke from %s: %w", src.Name(), err)
+		}
+
+		if j.Source == "" {
+			j.Source = src.Name()
+		}
+		if j.Language == "" {
+			j.Language = src.Language()
+		}
+
+		saved, err := e.saveNew(ctx, &j, told)
+		if err != nil {
+			return Joke{}, err
+		}
+		if saved {
+			return j, nil
+		}
+
+		// If joke exists, log and try again
+		log.Info().Msg("Joke already exists or is filtered out, fetching another one")
+	}
+
+	// If we've reached this point, we couldn't find a new joke after MaxDuplicates
+	return Joke{}, fmt.Errorf("could not find a new joke from %s after %d attempts", src.Name(), e.MaxDuplicates)
+}
+
+// pickFrom stores and returns a random joke from the list of src that is
+// new, or may be told again
+func (e *Engine) pickFrom(ctx context.Context, src ListSource, told bool) (Joke, error) {
+	var jokes []Joke
+	err := e.attempt(ctx, src, func(ctx context.Context) error {
+		var err error
+		jokes, err = src.List(ctx)
+		return err
+	})
+	if err != nil {
+		return Joke{}, fmt.Errorf("error fetching jokes from %s: %w", src.Name(), err)
+	}
+
+	// #nosec G404 -- picking a joke does not need a secure random number
+	for _, i := range rand.Perm(len(jokes)) {
+		j := jokes[i]
+		if j.Source == "" {
+			j.Source = src.Name()
+		}
+		if j.Language == "" {
+			j.Language = src.Language()
+		}
+		saved, err := e.saveNew(ctx, &j, told)
+		if err != nil {
+			return Joke{}, err
+		}
+		if saved {
+			return j, nil
+		}
+	}
+	return Joke{}, fmt.Errorf("every joke from %s has been told", src.Name())
+}
+
+// saveNew stores j, as told or for later, unless it is in the store already
+// or the filter rejects it. It reports whether j was stored.
+func (e *Engine) saveNew(ctx context.Context, j *Joke, told bool) (bool, error) {
+	if !e.Filter.Allows(*j) {
+		log.Debug().Str("source", j.Source).Msg("Skipping a joke the filter rejects")
+		return false, nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// Check if joke exists in the store
+	stored, err := e.Store.Find(ctx, *j)
+	if err == nil {
+		// Jokes told long enough ago may be told again
+		if !told || !e.repeatable(stored) {
+			return false, nil
+		}
+		// Another process may be telling it again at the same time
+		if claimed, err := e.claim(ctx, &stored); err != nil || !claimed {
+			return false, err
+		}
+		*j = stored
+		return true, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return false, fmt.Errorf("error checking joke existence: %w", err)
+	}
+	vector, id, err := e.paraphrase(ctx, *j)
+	if err != nil {
+		// Exact duplicates are still recognized
+		log.Warn().Err(err).Msg("Could not check the joke for paraphrases")
+	}
+	if id != 0 {
+		log.Debug().Int64("id", id).Str("source", j.Source).Msg("Skipping a paraphrase of a stored joke")
+		return false, nil
+	}
+
+	// Joke doesn't exist, store it
+	if told {
+		now := time.Now()
+		j.ToldAt = &now
+	}
+	err = e.Store.Save(ctx, j)
+	if errors.Is(err, ErrDuplicate) {
+		// Another process stored it in the meantime
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error inserting joke: %w", err)
+	}
+	if vector != nil && j.ID != 0 {
+		if err := e.Store.(EmbeddingStore).SaveEmbedding(ctx, j.ID, e.Embedder.Model(), vector); err != nil {
+			log.Warn().Err(err).Msg("Could not store the embedding of the joke")
+		}
+	}
+	return true, nil
+}
+
+// repeatable reports whether a stored joke may be told again according to
+// RepeatAfter
+func (e *Engine) repeatable(j Joke) bool {
+	return e.RepeatAfter > 0 && j.ToldAt != nil && time.Since(*j.ToldAt) >= e.RepeatAfter
+}
+
+// fetchOnce fetches a single joke from src, retrying failures according
+// to the retry policy
+func (e *Engine) fetchOnce(ctx context.Context, src Source) (Joke, error) {
+	var j Joke
+	err := e.attempt(ctx, src, func(ctx context.Context) error {
+		var err error
+		j, err = src.Fetch(ctx)
+		return err
+	})
+	return j, err
+}
+
+// sources returns the chain of sources to try for one joke, with the
+// fetching sources shuffled according to Weights
+func (e *Engine) sources() []Source {
+	if len(e.Weights) == 0 {
+		return e.Sources
+	}
+
+	var (
+		fetching []Source
+		slots    []int
+	)
+	for i, src := range e.Sources {
+		if !repeats(src) {
+			fetching = append(fetching, src)
+			slots = append(slots, i)
+		}
+	}
+	order := slices.Clone(e.Sources)
+	for _, slot := range slots {
+		total := 0.0
+		for _, src := range fetching {
+			total += e.weight(src)
+		}
+		// Pick a source with a probability proportional to its weight
+		pick := 0
+		// #nosec G404 -- picking a source does not need a secure random number
+		r := rand.Float64() * total
+		for i, src := range fetching {
+			if r -= e.weight(src); r < 0 {
+				pick = i
+				break
+			}
+		}
+		order[slot] = fetching[pick]
+		fetching = slices.Delete(fetching, pick, pick+1)
+	}
+	return order
+}
+
+// weight returns the weight of src, 1 unless set in Weights
+func (e *Engine) weight(src Source) float64 {
+	if w, ok := e.Weights[src.Name()]; ok {
+		return max(w, 0)
+	}
+	return 1
+}
+
+// attempt calls fn with the retry policy. Each attempt is limited by the
+// source's timeout. The outcome is recorded in a HealthStore, and sources
+// whose circuit is open are not tried at all.
+func (e *Engine) attempt(ctx context.Context, src Source, fn func(ctx context.Context) error) error {
+	timeout := e.Timeout
+	if d, ok := e.SourceTimeouts[src.Name()]; ok {
+		timeout = d
+	}
+
+	health, tracked := e.Store.(HealthStore)
+	tracked = tracked && !repeats(src)
+	if tracked && e.Breaker.Threshold > 0 {
+		h, err := health.SourceHealth(ctx, src.Name())
+		if err != nil {
+			log.Debug().Err(err).Str("source", src.Name()).Msg("Could not check source health")
+		} else if until := h.OpenUntil(e.Breaker, time.Now()); !until.IsZero() {
+			return fmt.Errorf("%w after %d failures, skipping until %s: %s", ErrCircuitOpen, h.Failures, until.Local().Format(time.TimeOnly), h.LastError)
+		}
+	}
+
+	limits, limited := e.Store.(LimitStore)
+	limited = limited && !repeats(src)
+
+	if headers := e.Headers[src.Name()]; len(headers) > 0 {
+		ctx = WithHeaders(ctx, headers)
+	}
+
+	start := time.Now()
+	err := e.Retry.Do(ctx, func(ctx context.Context) error {
+		if limited {
+			if err := e.throttle(ctx, limits, src); err != nil {
+				return err
+			}
+		}
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		err := fn(ctx)
+		if err != nil && IsRetryable(err) {
+			log.Debug().Err(err).Str("source", src.Name()).Msg("Fetch failed, retrying")
+		}
+		return err
+	})
+
+	var statusErr *StatusError
+	if limited && errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		if err := limits.BlockSource(ctx, src.Name(), time.Now().Add(statusErr.RetryAfter)); err != nil {
+			log.Debug().Err(err).Str("source", src.Name()).Msg("Could not record rate limit")
+		}
+	}
+
+	// A source that has no such joke is working fine, and fetches the
+	// caller gave up on or that were not even sent say nothing about the
+	// source
+	if tracked && ctx.Err() == nil && !errors.Is(err, ErrRateLimited) {
+		fetchErr := err
+		if errors.Is(err, ErrNotFound) {
+			fetchErr = nil
+		}
+		if recErr := health.RecordFetch(ctx, src.Name(), time.Since(start), fetchErr); recErr != nil {
+			log.Debug().Err(recErr).Str("source", src.Name()).Msg("Could not record source health")
+		}
+	}
+	return err
+}
+
+// throttle waits until src may be fetched from according to its rate limit
+// and any wait the upstream asked for
+func (e *Engine) throttle(ctx context.Context, limits LimitStore, src Source) error {
+	for {
+		wait, err := limits.TakeToken(ctx, src.Name(), e.RateLimits[src.Name()])
+		if err != nil {
+			// Better to fetch than to fail over the bookkeeping
+			log.Debug().Err(err).Str("source", src.Name()).Msg("Could not check rate limit")
+			return nil
+		}
+		if wait <= 0 {
+			return nil
+		}
+		if wait > e.Retry.MaxBackoff {
+			return fmt.Errorf("%w: %s may be fetched from again in %s", ErrRateLimited, src.Name(), wait.Round(time.Second))
+		}
+
+		log.Debug().Str("source", src.Name()).Dur("wait", wait).Msg("Waiting for rate limit")
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Tell returns a joke. Prefetched jokes are told first, then the sources
+// are tried in order: fetching sources must provide a joke that has not
+// been told before, while repeating sources may tell an old one. In
+// offline mode only repeating sources are used. When Tag is set, a random
+// stored joke with that tag is told instead.
+func (e *Engine) Tell(ctx context.Context) (Joke, error) {
+	if e.Tag != "" {
+		j, err := e.stored().RandomTagged(ctx, e.Tag)
+		if err == nil && !e.Filter.Allows(j) {
+			err = ErrNoJokes
+		}
+		if errors.Is(err, ErrNoJokes) {
+			return Joke{}, fmt.Errorf("no jokes tagged %q: %w", e.Tag, err)
+		}
+		if err != nil {
+			return Joke{}, err
+		}
+		return j, e.Store.MarkTold(ctx, &j)
+	}
+	if len(e.Mix) > 0 {
+		return e.mixed()[0].Tell(ctx)
+	}
+
+	j, err := e.nextUntold(ctx)
+	if err == nil {
+		return j, nil
+	}
+	if !errors.Is(err, ErrNoJokes) {
+		return Joke{}, err
+	}
+
+	var errs []error
+	for _, src := range e.sources() {
+		switch {
+		case repeats(src):
+			j, err = e.repeatFrom(ctx, src)
+		case e.Offline:
+			continue
+		default:
+			j, err = e.fetchFrom(ctx, src, true)
+		}
+		if err == nil {
+			return j, nil
+		}
+		// Don't try the remaining sources once the caller gave up
+		if ctx.Err() != nil {
+			return Joke{}, ctx.Err()
+		}
+		log.Warn().Err(err).Str("source", src.Name()).Msg("Source could not tell a joke")
+		errs = append(errs, fmt.Errorf("%s: %w", src.Name(), err))
+	}
+
+	if len(errs) == 0 {
+		if e.Offline {
+			return Joke{}, ErrOffline
+		}
+		return Joke{}, errors.New("no joke sources configured")
+	}
+	return Joke{}, fmt.Errorf("no source could tell a joke: %w", errors.Join(errs...))
+}
+
+// repeatFrom tells a joke from a repeating source. Jokes that may be told
+// again according to RepeatAfter take precedence, least recently told
+// first.
+func (e *Engine) repeatFrom(ctx context.Context, src Source) (Joke, error) {
+	if e.RepeatAfter > 0 {
+		e.mu.Lock()
+		j, err := e.claimNext(ctx, func() (Joke, error) {
+			return e.stored().LeastRecentlyTold(ctx, e.Language, time.Now().Add(-e.RepeatAfter))
+		})
+		e.mu.Unlock()
+		if !errors.Is(err, ErrNoJokes) {
+			return j, err
+		}
+	}
+
+	// Repeating sources pick at random, so ask again for a joke the
+	// filter allows
+	for i := 0; i < max(e.MaxDuplicates, 1); i++ {
+		j, err := e.fetchOnce(ctx, src)
+		if err != nil {
+			return Joke{}, err
+		}
+		if !e.Filter.Allows(j) {
+			continue
+		}
+		// Count repeats of stored jokes
+		if j.ID != 0 {
+			err = e.Store.MarkTold(ctx, &j)
+		}
+		return j, err
+	}
+	return Joke{}, fmt.Errorf("%w: every joke from %s was rejected", ErrFiltered, src.Name())
+}
+
+// nextUntold tells the next prefetched joke
+func (e *Engine) nextUntold(ctx context.Context) (Joke, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.claimNext(ctx, func() (Joke, error) {
+		return e.stored().NextUntold(ctx, e.Language)
+	})
+}
+
+// TellMany tells up to count jokes like Tell, fetching up to Workers of them
+// at the same time. The jokes are returned in the order they were told.
+// Jokes that could not be told are left out and their errors are joined.
+func (e *Engine) TellMany(ctx context.Context, count int) ([]Joke, error) {
+	workers := min(max(e.Workers, 1), count)
+	jobs := make(chan struct{}, count)
+	for i := 0; i < count; i++ {
+		jobs <- struct{}{}
+	}
+	close(jobs)
+
+	var (
+		mu    sync.Mutex
+		jokes []Joke
+		errs  []error
+		wg    sync.WaitGroup
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				j, err := e.Tell(ctx)
+				mu.Lock()
+				if err != nil {
+					errs = append(errs, err)
+				} else {
+					jokes = append(jokes, j)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return jokes, errors.Join(errs...)
+}
+
+// TellAbout returns a joke about term that has not been told before. It
+// asks every source that can search for matching jokes and picks a random
+// one that is not in the store yet.
+func (e *Engine) TellAbout(ctx context.Context, term string) (Joke, error) {
+	if len(e.Mix) > 0 {
+		return e.tellMixed(ctx, func(engine *Engine) (Joke, error) { return engine.TellAbout(ctx, term) })
+	}
+	if e.Offline {
+		return Joke{}, ErrOffline
+	}
+
+	var errs []error
+	searched := false
+	for _, src := range e.Sources {
+		searcher, ok := src.(SearchSource)
+		if !ok || repeats(src) {
+			continue
+		}
+		searched = true
+
+		j, err := e.searchFrom(ctx, searcher, term)
+		if err == nil {
+			return j, nil
+		}
+		if ctx.Err() != nil {
+			return Joke{}, ctx.Err()
+		}
+		if !errors.Is(err, ErrNoJokes) {
+			log.Warn().Err(err).Str("source", src.Name()).Msg("Source could not search for jokes")
+			errs = append(errs, fmt.Errorf("%s: %w", src.Name(), err))
+		}
+	}
+
+	if !searched {
+		return Joke{}, errors.New("none of the configured sources can search for jokes")
+	}
+	if len(errs) > 0 {
+		return Joke{}, fmt.Errorf("error searching for jokes about %q: %w", term, errors.Join(errs...))
+	}
+	return Joke{}, fmt.Errorf("no new jokes about %q: %w", term, ErrNoJokes)
+}
+
+// searchFrom picks a random joke about term from src that is not in the
+// store yet, or may be told again after RepeatAfter, and stores it as told
+// like Tell does, new jokes tagged with term. It returns ErrNoJokes if
+// there is none.
+func (e *Engine) searchFrom(ctx context.Context, src SearchSource, term string) (Joke, error) {
+	var matches []Joke
+	err := e.attempt(ctx, src, func(ctx context.Context) error {
+		var err error
+		matches, err = src.Search(ctx, term)
+		return err
+	})
+	if err != nil {
+		return Joke{}, err
+	}
+
+	rand.Shuffle(len(matches), func(i, j int) { matches[i], matches[j] = matches[j], matches[i] })
+	for _, j := range matches {
+		if j.Source == "" {
+			j.Source = src.Name()
+		}
+		if j.Language == "" {
+			j.Language = src.Language()
+		}
+		j.Tags = append(j.Tags, NormalizeTag(term))
+		saved, err := e.saveNew(ctx, &j, true)
+		if err != nil {
+			return Joke{}, err
+		}
+		if saved {
+			return j, nil
+		}
+	}
+	return Joke{}, ErrNoJokes
+}
+
+// TellByID returns the joke with the given upstream ID from the first
+// source that can fetch jokes by ID and knows it. The joke is stored as
+// told, or if it has been stored before, the stored joke is marked as
+// told again and returned.
+func (e *Engine) TellByID(ctx context.Context, id string) (Joke, error) {
+	if len(e.Mix) > 0 {
+		return e.tellMixed(ctx, func(engine *Engine) (Joke, error) { return engine.TellByID(ctx, id) })
+	}
+	if e.Offline {
+		return Joke{}, ErrOffline
+	}
+
+	var errs []error
+	for _, src := range e.Sources {
+		fetcher, ok := src.(IDSource)
+		if !ok || repeats(src) {
+			continue
+		}
+
+		var j Joke
+		err := e.attempt(ctx, src, func(ctx context.Context) error {
+			var err error
+			j, err = fetcher.FetchID(ctx, id)
+			return err
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return Joke{}, ctx.Err()
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", src.Name(), err))
+			continue
+		}
+
+		if j.Source == "" {
+			j.Source = src.Name()
+		}
+		if j.Language == "" {
+			j.Language = src.Language()
+		}
+		if !e.Filter.Allows(j) {
+			return Joke{}, fmt.Errorf("%w: %s", ErrFiltered, id)
+		}
+		stored, err := e.Store.Find(ctx, j)
+		if errors.Is(err, ErrNotFound) {
+			now := time.Now()
+			j.ToldAt = &now
+			err = e.Store.Save(ctx, &j)
+			if err == nil {
+				return j, nil
+			}
+			if !errors.Is(err, ErrDuplicate) {
+				return Joke{}, fmt.Errorf("error inserting joke: %w", err)
+			}
+			// Another process stored it in the meantime
+			stored, err = e.Store.Find(ctx, j)
+		}
+		if err != nil {
+			return Joke{}, fmt.Errorf("error checking joke existence: %w", err)
+		}
+		// The joke was asked for by ID, so it is told again even if it was
+		// told recently
+		log.Debug().Str("id", id).Int64("stored", stored.ID).Msg("Joke already stored")
+		if err := e.Store.MarkTold(ctx, &stored); err != nil {
+			return Joke{}, fmt.Errorf("error marking joke as told: %w", err)
+		}
+		return stored, nil
+	}
+
+	if len(errs) == 0 {
+		return Joke{}, errors.New("none of the configured sources can fetch jokes by ID")
+	}
+	return Joke{}, fmt.Errorf("error fetching joke %s: %w", id, errors.Join(errs...))
+}
+
+// Prefetch fetches up to count new jokes and stores them untold, so they
+// can be told later without a network call. It returns how many jokes
+// were stored, which is less than count when the sources run dry. Up to
+// Workers fetches run at the same time, each within the rate limits of
+// its source. When the first source can fetch several jokes per request,
+// it is asked for a full batch at a time. progress, if not nil, is called
+// with the number of jokes stored so far whenever it grows.
+func (e *Engine) Prefetch(ctx context.Context, count int, progress func(stored int)) (int, error) {
+	if len(e.Mix) > 0 {
+		return e.prefetchMixed(ctx, count, progress)
+	}
+
+	batch := 1
+	if e.batches() {
+		batch = MaxBatchSize
+	}
+	var (
+		mu      sync.Mutex
+		missing = count
+		stored  int
+		failed  error
+		wg      sync.WaitGroup
+	)
+	// take hands a worker up to a batch of the missing jokes to fetch
+	take := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		if failed != nil {
+			return 0
+		}
+		n := min(missing, batch)
+		missing -= n
+		return n
+	}
+	// record counts the jokes a worker stored and reports whether to go on
+	record := func(n int, err error) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		stored += n
+		if n > 0 && progress != nil {
+			progress(stored)
+		}
+		if err != nil && failed == nil {
+			failed = err
+		}
+		return failed == nil
+	}
+	for range min(max(e.Workers, 1), count) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for want := take(); want > 0; want = take() {
+				for want > 0 {
+					n, err := e.prefetchOnce(ctx, want)
+					want -= n
+					if !record(n, err) {
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return stored, failed
+}
+
+// batches reports whether the first fetching source can fetch several
+// jokes per request. With Weights it is only the most likely first one.
+func (e *Engine) batches() bool {
+	if e.Offline {
+		return false
+	}
+	for _, src := range e.Sources {
+		if !repeats(src) {
+			_, ok := src.(BatchSource)
+			return ok
+		}
+	}
+	return false
+}
+
+// prefetchOnce stores up to count new jokes, fetching a batch from the
+// first source if it supports that, or a single joke otherwise
+func (e *Engine) prefetchOnce(ctx context.Context, count int) (int, error) {
+	for _, src := range e.sources() {
+		if e.Offline || repeats(src) {
+			continue
+		}
+		batcher, ok := src.(BatchSource)
+		if !ok {
+			break
+		}
+		n, err := e.fetchBatchFrom(ctx, batcher, count)
+		if err == nil || n > 0 {
+			return n, err
+		}
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		log.Warn().Err(err).Str("source", src.Name()).Msg("Source did not provide a batch of fresh jokes")
+		break
+	}
+
+	if _, err := e.fetch(ctx, false); err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+// fetchBatchFrom fetches up to MaxDuplicates batches of jokes from src
+// until one holds new jokes, and stores them untold
+func (e *Engine) fetchBatchFrom(ctx context.Context, src BatchSource, count int) (int, error) {
+	for i := 0; i < e.MaxDuplicates; i++ {
+		var jokes []Joke
+		err := e.attempt(ctx, src, func(ctx context.Context) error {
+			var err error
+			jokes, err = src.FetchBatch(ctx, min(count, MaxBatchSize))
+			return err
+		})
+		if err != nil {
+			return 0, fmt.Errorf("error fetching jokes from %s: %w", src.Name(), err)
+		}
+
+		for i := range jokes {
+			if jokes[i].Source == "" {
+				jokes[i].Source = src.Name()
+			}
+			if jokes[i].Language == "" {
+				jokes[i].Language = src.Language()
+			}
+		}
+		stored, err := e.saveBatch(ctx, jokes)
+		if err != nil {
+			return stored, err
+		}
+		if stored > 0 {
+			return stored, nil
+		}
+		log.Info().Msg("Jokes already exist, fetching another batch")
+	}
+	return 0, fmt.Errorf("could not find a new joke from %s after %d attempts", src.Name(), e.MaxDuplicates)
+}
+
+// saveBatch stores the new jokes of a batch untold and returns how many
+// were stored. Stores that can import jokes store them in one go, unless
+// the embedder has to check each of them for paraphrases first.
+func (e *Engine) saveBatch(ctx context.Context, jokes []Joke) (int, error) {
+	importer, ok := e.Store.(ImportStore)
+	if !ok || e.Embedder != nil {
+		stored := 0
+		for _, j := range jokes {
+			saved, err := e.saveNew(ctx, &j, false)
+			if err != nil {
+				return stored, err
+			}
+			if saved {
+				stored++
+			}
+		}
+		return stored, nil
+	}
+
+	allowed := slices.DeleteFunc(jokes, func(j Joke) bool { return !e.Filter.Allows(j) })
+	res, err := importer.Import(ctx, allowed, len(allowed), false, nil)
+	if err != nil {
+		return res.Imported, fmt.Errorf("error inserting jokes: %w", err)
+	}
+	return res.Imported, nil
+}
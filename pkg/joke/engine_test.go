@@ -0,0 +1,487 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestStore opens a SQLite store in a temporary directory
+func newTestStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+	store, err := OpenSQLite(filepath.Join(t.TempDir(), "jokes.db"))
+	if err != nil {
+		t.Fatalf("Failed to open the database: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// racingStore acts as if another process stored the first joke the engine
+// looks for right after it found that the joke wasn't stored yet
+type racingStore struct {
+	*SQLiteStore
+	raced bool
+}
+
+// Find implements Store
+func (s *racingStore) Find(ctx context.Context, j Joke) (Joke, error) {
+	if s.raced {
+		return s.SQLiteStore.Find(ctx, j)
+	}
+	return Joke{}, s.race(ctx, j)
+}
+
+// Exists implements Store
+func (s *racingStore) Exists(ctx context.Context, j Joke) (bool, error) {
+	if s.raced {
+		return s.SQLiteStore.Exists(ctx, j)
+	}
+	if err := s.race(ctx, j); !errors.Is(err, ErrNotFound) {
+		return false, err
+	}
+	return false, nil
+}
+
+// race stores j as the other process and returns ErrNotFound
+func (s *racingStore) race(ctx context.Context, j Joke) error {
+	s.raced = true
+	j.ID, j.ToldAt = 0, nil
+	if err := s.SQLiteStore.Save(ctx, &j); err != nil {
+		return err
+	}
+	return ErrNotFound
+}
+
+// newTestSource returns an icanhazdadjoke source pointing at server
+func newTestSource(server *httptest.Server) *ICanHazDadJoke {
+	src := NewICanHazDadJoke()
+	src.URL = server.URL
+	return src
+}
+
+func TestEngineFresh(t *testing.T) {
+	store := newTestStore(t)
+
+	// Create a mock server
+	jokeResponses := []string{
+		`{"id": "1", "joke": "This is the first joke", "status": 200}`,
+		`{"id": "2", "joke": "This is the second joke", "status": 200}`,
+		`{"id": "3", "joke": "This is the third joke", "status": 200}`,
+		`{"id": "4", "joke": "This is the fourth joke", "status": 200}`,
+		`{"id": "5", "joke": "This is the fifth joke", "status": 200}`,
+	}
+	currentJoke := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Check if the request has the correct headers
+		if r.Header.Get("User-Agent") != "https://github.com/lhaig/godad" {
+			t.Errorf("Expected User-Agent header to be 'https://github.com/lhaig/godad', got %s", r.Header.Get("User-Agent"))
+		}
+		if r.Header.Get("Accept") != "application/json" {
+			t.Errorf("Expected Accept header to be 'application/json', got %s", r.Header.Get("Accept"))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte(jokeResponses[currentJoke]))
+		if err != nil {
+			t.Errorf("Error writing response: %v", err)
+		}
+		currentJoke = (currentJoke + 1) % len(jokeResponses)
+	}))
+	defer server.Close()
+
+	engine := NewEngine(store, newTestSource(server))
+
+	// Test getting fresh jokes
+	expectedJokes := []string{
+		"This is the first joke",
+		"This is the second joke",
+		"This is the third joke",
+	}
+
+	for i, expected := range expectedJokes {
+		j, err := engine.Fresh(context.Background())
+		if err != nil {
+			t.Errorf("Fresh() returned an error: %v", err)
+		}
+		if j.Text != expected {
+			t.Errorf("Fresh() returned %s, want %s (iteration %d)", j.Text, expected, i)
+		}
+	}
+
+	// Check store contents
+	jokes, err := store.History(context.Background(), HistoryFilter{})
+	if err != nil {
+		t.Fatalf("Error reading history: %v", err)
+	}
+
+	if len(jokes) != len(expectedJokes) {
+		t.Errorf("Expected %d jokes in store, got %d", len(expectedJokes), len(jokes))
+	}
+
+	// History is most recent first
+	for i, j := range jokes {
+		want := expectedJokes[len(expectedJokes)-1-i]
+		if j.Text != want {
+			t.Errorf("Joke %d in store is %s, want %s", i, j.Text, want)
+		}
+		if j.Source != "icanhazdadjoke" || j.Language != "en" || j.UpstreamID == "" {
+			t.Errorf("Joke %d in store has metadata %q/%q/%q, want icanhazdadjoke/en and an upstream ID", i, j.Source, j.Language, j.UpstreamID)
+		}
+	}
+}
+
+func TestEngineTellFallsBackToStore(t *testing.T) {
+	store := newTestStore(t)
+	if err := store.Save(context.Background(), &Joke{Text: "A stored joke", ToldAt: ptr(time.Now())}); err != nil {
+		t.Fatalf("Save() returned an error: %v", err)
+	}
+
+	// Create a mock server that returns an error
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	engine := NewEngine(store, newTestSource(server), NewStoreSource(store, ""))
+	engine.Retry.Backoff = time.Millisecond
+
+	j, err := engine.Tell(context.Background())
+	if err != nil {
+		t.Fatalf("Tell() returned an error: %v", err)
+	}
+	if j.Text != "A stored joke" {
+		t.Errorf("Tell() returned %s, want the stored joke", j.Text)
+	}
+	if j.TimesTold != 2 {
+		t.Errorf("Repeated joke has been told %d times, want 2", j.TimesTold)
+	}
+}
+
+func TestEngineFreshTriesNextSource(t *testing.T) {
+	store := newTestStore(t)
+	engine := NewEngine(store,
+		&staticSource{name: "broken", lang: "en", err: errors.New("boom")},
+		&staticSource{name: "working", lang: "en", text: "A working joke"},
+	)
+
+	j, err := engine.Fresh(context.Background())
+	if err != nil {
+		t.Fatalf("Fresh() returned an error: %v", err)
+	}
+	if j.Text != "A working joke" {
+		t.Errorf("Fresh() returned %s, want the joke from the working source", j.Text)
+	}
+
+	// The only joke of the working source has been told now
+	if _, err := engine.Fresh(context.Background()); err == nil {
+		t.Errorf("Fresh() did not return an error once every source was exhausted")
+	}
+}
+
+// sequenceSource returns a numbered joke on every fetch
+type sequenceSource struct {
+	n int
+}
+
+func (s *sequenceSource) Name() string     { return "sequence" }
+func (s *sequenceSource) Language() string { return "en" }
+
+func (s *sequenceSource) Fetch(_ context.Context) (Joke, error) {
+	s.n++
+	return Joke{Text: fmt.Sprintf("Joke number %d", s.n)}, nil
+}
+
+func TestEnginePrefetchAndOffline(t *testing.T) {
+	store := newTestStore(t)
+	src := &sequenceSource{}
+	engine := NewEngine(store, src, NewStoreSource(store, ""))
+	// One at a time, so the jokes are stored in the order they are fetched
+	engine.Workers = 1
+
+	n, err := engine.Prefetch(context.Background(), 3, nil)
+	if err != nil || n != 3 {
+		t.Fatalf("Prefetch() = %d, %v, want 3 jokes", n, err)
+	}
+
+	// Prefetched jokes are not part of the history until they are told
+	if history, _ := store.History(context.Background(), HistoryFilter{}); len(history) != 0 {
+		t.Errorf("History() has %d jokes after prefetching, want 0", len(history))
+	}
+
+	engine.Offline = true
+	for i := 1; i <= 3; i++ {
+		j, err := engine.Tell(context.Background())
+		if err != nil {
+			t.Fatalf("Tell() returned an error: %v", err)
+		}
+		if want := fmt.Sprintf("Joke number %d", i); j.Text != want || j.ToldAt == nil {
+			t.Errorf("Tell() returned %q (told at %v), want %q marked as told", j.Text, j.ToldAt, want)
+		}
+	}
+	if src.n != 3 {
+		t.Errorf("Source was fetched %d times, want 3", src.n)
+	}
+
+	// Once the prefetched jokes are used up, offline mode repeats old jokes
+	if _, err := engine.Tell(context.Background()); err != nil {
+		t.Errorf("Tell() returned an error after the prefetched jokes ran out: %v", err)
+	}
+	if src.n != 3 {
+		t.Errorf("Source was fetched in offline mode")
+	}
+	if history, _ := store.History(context.Background(), HistoryFilter{}); len(history) != 3 {
+		t.Errorf("History() has %d jokes, want 3", len(history))
+	}
+}
+
+// concurrentSource returns a numbered joke on every fetch and may be used
+// from several goroutines
+type concurrentSource struct {
+	n atomic.Int64
+}
+
+func (s *concurrentSource) Name() string     { return "concurrent" }
+func (s *concurrentSource) Language() string { return "en" }
+
+func (s *concurrentSource) Fetch(_ context.Context) (Joke, error) {
+	// Every other fetch repeats the previous joke
+	return Joke{Text: fmt.Sprintf("Joke number %d", s.n.Add(1)/2)}, nil
+}
+
+func TestEngineTellMany(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		if err := store.Save(ctx, &Joke{Text: fmt.Sprintf("Prefetched joke %d", i), Language: "en"}); err != nil {
+			t.Fatalf("Save() returned an error: %v", err)
+		}
+	}
+
+	engine := NewEngine(store, &concurrentSource{})
+	engine.Workers = 3
+	jokes, err := engine.TellMany(ctx, 12)
+	if err != nil {
+		t.Fatalf("TellMany() returned an error: %v", err)
+	}
+	if len(jokes) != 12 {
+		t.Fatalf("TellMany() returned %d jokes, want 12", len(jokes))
+	}
+
+	// Every joke is told only once, prefetched ones included
+	seen := map[int64]bool{}
+	for _, j := range jokes {
+		if seen[j.ID] {
+			t.Errorf("Joke %d %q was told twice", j.ID, j.Text)
+		}
+		seen[j.ID] = true
+	}
+	if history, _ := store.History(ctx, HistoryFilter{}); len(history) != 12 {
+		t.Errorf("History() has %d jokes, want 12", len(history))
+	}
+}
+
+// countingSource returns a numbered joke on every fetch after a while,
+// counting how many fetches run at the same time
+type countingSource struct {
+	n, running, most atomic.Int64
+}
+
+func (s *countingSource) Name() string     { return "counting" }
+func (s *countingSource) Language() string { return "en" }
+
+func (s *countingSource) Fetch(_ context.Context) (Joke, error) {
+	running := s.running.Add(1)
+	defer s.running.Add(-1)
+	for most := s.most.Load(); running > most && !s.most.CompareAndSwap(most, running); most = s.most.Load() {
+	}
+	time.Sleep(10 * time.Millisecond)
+	return Joke{Text: fmt.Sprintf("Joke number %d", s.n.Add(1))}, nil
+}
+
+func TestEnginePrefetchWorkers(t *testing.T) {
+	store := newTestStore(t)
+	src := &countingSource{}
+	engine := NewEngine(store, src)
+	engine.Workers = 3
+
+	var progress []int
+	n, err := engine.Prefetch(context.Background(), 10, func(stored int) { progress = append(progress, stored) })
+	if err != nil || n != 10 {
+		t.Fatalf("Prefetch() = %d, %v, want 10 jokes", n, err)
+	}
+	if most := src.most.Load(); most != 3 {
+		t.Errorf("Prefetch() fetched up to %d jokes at the same time, want 3", most)
+	}
+	if len(progress) != 10 || progress[9] != 10 {
+		t.Errorf("Prefetch() reported progress %v, want every joke counted up to 10", progress)
+	}
+}
+
+func TestEngineRepeatAfter(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	day := 24 * time.Hour
+	for _, j := range []struct {
+		text string
+		ago  time.Duration
+	}{
+		{text: "Oldest", ago: 200 * day},
+		{text: "Old", ago: 100 * day},
+		{text: "Recent", ago: day},
+	} {
+		toldAt := time.Now().Add(-j.ago)
+		if err := store.Save(ctx, &Joke{Text: j.text, Language: "en", ToldAt: &toldAt}); err != nil {
+			t.Fatalf("Save() returned an error: %v", err)
+		}
+	}
+
+	engine := NewEngine(store, &staticSource{name: "static", lang: "en", text: "Old"}, NewStoreSource(store, ""))
+	engine.Retry = RetryPolicy{Attempts: 1}
+	engine.MaxDuplicates = 1
+	engine.RepeatAfter = 90 * day
+
+	steps := []struct {
+		want      string
+		timesTold int
+	}{
+		// The source may tell a joke again once it is old enough
+		{want: "Old", timesTold: 2},
+		// but not straight after, so the least recently told joke is
+		// repeated instead
+		{want: "Oldest", timesTold: 2},
+	}
+	for i, step := range steps {
+		j, err := engine.Tell(ctx)
+		if err != nil {
+			t.Fatalf("Step %d: Tell() returned an error: %v", i, err)
+		}
+		if j.Text != step.want || j.TimesTold != step.timesTold {
+			t.Errorf("Step %d: Tell() = %q told %d times, want %q told %d times", i, j.Text, j.TimesTold, step.want, step.timesTold)
+		}
+	}
+}
+
+// slowSource blocks until its context is done
+type slowSource struct{}
+
+func (slowSource) Name() string     { return "slow" }
+func (slowSource) Language() string { return "en" }
+
+func (slowSource) Fetch(ctx context.Context) (Joke, error) {
+	<-ctx.Done()
+	return Joke{}, ctx.Err()
+}
+
+func TestEngineTimeout(t *testing.T) {
+	store := newTestStore(t)
+	engine := NewEngine(store, slowSource{}, &staticSource{name: "fast", lang: "en", text: "A quick joke"})
+	engine.Timeout = 10 * time.Millisecond
+	engine.Retry = RetryPolicy{Attempts: 1}
+
+	// The slow source times out and the next source is tried
+	j, err := engine.Fresh(context.Background())
+	if err != nil {
+		t.Fatalf("Fresh() returned an error: %v", err)
+	}
+	if j.Text != "A quick joke" {
+		t.Errorf("Fresh() returned %q, want the joke from the fast source", j.Text)
+	}
+}
+
+func TestEngineTellCanceled(t *testing.T) {
+	store := newTestStore(t)
+	if err := store.Save(context.Background(), &Joke{Text: "A stored joke"}); err != nil {
+		t.Fatalf("Save() returned an error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// A canceled call must not fall back to the store
+	if _, err := NewEngine(store, slowSource{}, NewStoreSource(store, "")).Tell(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Tell() returned %v, want context.Canceled", err)
+	}
+}
+
+func TestEngineTellChain(t *testing.T) {
+	store := newTestStore(t)
+	broken := &staticSource{name: "broken", lang: "en", err: errors.New("boom")}
+
+	// Without a repeating source at the end an empty chain result is an error
+	engine := NewEngine(store, broken)
+	engine.Retry = RetryPolicy{Attempts: 1}
+	if _, err := engine.Tell(context.Background()); err == nil {
+		t.Fatalf("Tell() did not return an error when every source failed")
+	}
+
+	// Sources are tried in order, across languages
+	engine.Sources = []Source{broken, &staticSource{name: "german", lang: "de", text: "Ein Witz"}, NewStoreSource(store, "")}
+	j, err := engine.Tell(context.Background())
+	if err != nil {
+		t.Fatalf("Tell() returned an error: %v", err)
+	}
+	if j.Text != "Ein Witz" || j.Language != "de" {
+		t.Errorf("Tell() returned %+v, want the German joke", j)
+	}
+
+	// Once the German joke has been told, the store repeats it
+	j, err = engine.Tell(context.Background())
+	if err != nil {
+		t.Fatalf("Tell() returned an error: %v", err)
+	}
+	if j.Text != "Ein Witz" {
+		t.Errorf("Tell() returned %q, want the stored joke", j.Text)
+	}
+}
+
+func TestEngineSourceTimeouts(t *testing.T) {
+	engine := NewEngine(newTestStore(t), slowSource{})
+	engine.Timeout = time.Hour
+	engine.SourceTimeouts = map[string]time.Duration{"slow": 10 * time.Millisecond}
+	engine.Retry = RetryPolicy{Attempts: 1}
+
+	if _, err := engine.Fresh(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Fresh() returned %v, want the per-source timeout to expire", err)
+	}
+}
+
+func TestEngineWeights(t *testing.T) {
+	store := NewStoreSource(newTestStore(t), "")
+	engine := NewEngine(nil, &staticSource{name: "a"}, &staticSource{name: "b"}, &staticSource{name: "c"}, store)
+
+	// A source without weight is only tried once the others have been
+	engine.Weights = map[string]float64{"a": 0}
+	first := map[string]int{}
+	for range 300 {
+		sources := engine.sources()
+		if names := sourceNames(sources); names[2] != "a" || names[3] != StoreSourceName {
+			t.Fatalf("sources() = %v, want a and then the store last", names)
+		}
+		first[sources[0].Name()]++
+	}
+	if first["b"] == 0 || first["c"] == 0 {
+		t.Errorf("sources() put %v first, want b and c to take turns", first)
+	}
+
+	// Heavier sources come first more often
+	engine.Weights = map[string]float64{"a": 0, "b": 9}
+	first = map[string]int{}
+	for range 300 {
+		first[engine.sources()[0].Name()]++
+	}
+	if first["b"] <= first["c"] {
+		t.Errorf("sources() put %v first, want b more often than c", first)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ExecSource gets jokes from a program of the user's. The program prints a
+// JSON object like {"joke": "...", "id": "...", "lang": "en"} to stdout;
+// only the joke is required. It is started with GODAD_LANG set to the
+// language of the source.
+type ExecSource struct {
+	Command string
+	Args    []string
+	name    string
+	lang    string
+}
+
+// NewExecSource returns a source called name for the jokes in lang that
+// command prints
+func NewExecSource(name, lang, command string, args ...string) *ExecSource {
+	return &ExecSource{Command: command, Args: args, name: name, lang: normalizeLanguage(lang)}
+}
+
+// Name implements Source
+func (s *ExecSource) Name() string {
+	return s.name
+}
+
+// Language implements Source
+func (s *ExecSource) Language() string {
+	return s.lang
+}
+
+// execOutput is what the program prints
+type execOutput struct {
+	Joke string          `json:"joke"`
+	ID   json.RawMessage `json:"id"`
+	Lang string          `json:"lang"`
+}
+
+// Fetch implements Source. The program is stopped when ctx is done.
+func (s *ExecSource) Fetch(ctx context.Context) (Joke, error) {
+	// #nosec G204 -- running the configured command is the point
+	cmd := exec.CommandContext(ctx, s.Command, s.Args...)
+	cmd.Env = append(os.Environ(), "GODAD_LANG="+s.lang)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return Joke{}, ctx.Err()
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return Joke{}, fmt.Errorf("error running %s: %w: %s", s.Command, err, msg)
+		}
+		return Joke{}, fmt.Errorf("error running %s: %w", s.Command, err)
+	}
+
+	var out execOutput
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return Joke{}, fmt.Errorf("error parsing output of %s: %w", s.Command, err)
+	}
+	if out.Joke = strings.TrimSpace(out.Joke); out.Joke == "" {
+		return Joke{}, errors.New("no joke in output of " + s.Command)
+	}
+
+	j := Joke{Text: out.Joke, Source: s.name, Language: s.lang}
+	if out.Lang != "" {
+		j.Language = normalizeLanguage(out.Lang)
+	}
+	// IDs may be strings or numbers
+	var id string
+	if err := json.Unmarshal(out.ID, &id); err == nil {
+		j.UpstreamID = id
+	} else if len(out.ID) > 0 && string(out.ID) != "null" {
+		j.UpstreamID = string(out.ID)
+	}
+	return j, nil
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+//go:build unix
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestExecSource(t *testing.T) {
+	src := NewExecSource("script", "en", "sh", "-c", `printf '{"joke": "A %s joke", "id": 42, "lang": "DE"}' "$GODAD_LANG"`)
+
+	j, err := src.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch() returned an error: %v", err)
+	}
+	want := Joke{Text: "A en joke", UpstreamID: "42", Source: "script", Language: "de"}
+	if j.Text != want.Text || j.UpstreamID != want.UpstreamID || j.Source != want.Source || j.Language != want.Language {
+		t.Errorf("Fetch() = %+v, want %+v", j, want)
+	}
+}
+
+func TestExecSourceErrors(t *testing.T) {
+	testCases := []struct {
+		name   string
+		script string
+	}{
+		{name: "ExitCode", script: "echo broken >&2; exit 3"},
+		{name: "InvalidJSON", script: "echo not json"},
+		{name: "NoJoke", script: `echo '{"id": "1"}'`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := NewExecSource("script", "en", "sh", "-c", tc.script).Fetch(context.Background()); err == nil {
+				t.Errorf("Fetch() did not return an error")
+			}
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := NewExecSource("slow", "en", "sleep", "10").Fetch(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Fetch() returned %v, want the context deadline", err)
+	}
+}
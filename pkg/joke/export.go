@@ -0,0 +1,266 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExportFormats lists the formats WriteJokes writes
+var ExportFormats = []string{"json", "csv", "markdown", "fortune", "anki"}
+
+// DefaultAnkiDeck is the deck WriteJokes puts Anki cards in
+const DefaultAnkiDeck = "godad"
+
+// ExportFilter narrows down the jokes returned by ExportStore.Export. Zero
+// values don't filter.
+type ExportFilter struct {
+	// Language only returns jokes in this language
+	Language string
+	// Source only returns jokes from this source
+	Source string
+	// Tag only returns jokes with this tag
+	Tag string
+	// Since only returns jokes stored at or after this time
+	Since time.Time
+	// Until only returns jokes stored before this time
+	Until time.Time
+}
+
+// ExportStore is a Store that can list all the jokes it holds
+type ExportStore interface {
+	Store
+	// Export returns the stored jokes matching f with their tags, told or
+	// not, in the order they were stored
+	Export(ctx context.Context, f ExportFilter) ([]Joke, error)
+}
+
+// Export implements ExportStore
+func (s *SQLiteStore) Export(ctx context.Context, f ExportFilter) ([]Joke, error) {
+	query := "SELECT " + jokeColumns + " FROM jokes WHERE 1 = 1"
+	var args []any
+	if f.Language != "" {
+		query += " AND language = ?"
+		args = append(args, f.Language)
+	}
+	if f.Source != "" {
+		query += " AND source = ?"
+		args = append(args, f.Source)
+	}
+	if f.Tag != "" {
+		query += " AND id IN (SELECT joke_id FROM joke_tags JOIN tags ON tags.id = tag_id WHERE name = ?)"
+		args = append(args, NormalizeTag(f.Tag))
+	}
+	if !f.Since.IsZero() {
+		query += " AND created_at >= ?"
+		args = append(args, f.Since.UTC())
+	}
+	if !f.Until.IsZero() {
+		query += " AND created_at < ?"
+		args = append(args, f.Until.UTC())
+	}
+	query += " ORDER BY id"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error exporting jokes: %w", err)
+	}
+	var jokes []Joke
+	for rows.Next() {
+		j, err := scanJoke(rows)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error exporting jokes: %w", err)
+		}
+		jokes = append(jokes, j)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error exporting jokes: %w", err)
+	}
+
+	for i := range jokes {
+		if jokes[i].Tags, err = s.jokeTags(ctx, jokes[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return jokes, nil
+}
+
+// WriteJokes writes jokes in one of the ExportFormats:
+//
+//   - json: a list of joke objects, which ReadJokes reads back
+//   - csv: a header and a row per joke, which ReadJokes reads back
+//   - markdown: a list of jokes, e.g. for a wiki page
+//   - fortune: jokes separated by lines holding just %, to be indexed by
+//     WriteStrfile or strfile(1) for fortune(6)
+//   - anki: flashcards in the DefaultAnkiDeck, see WriteAnki
+func WriteJokes(w io.Writer, jokes []Joke, format string) error {
+	switch format {
+	case "json":
+		if jokes == nil {
+			jokes = []Joke{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(jokes)
+	case "csv":
+		return writeCSVJokes(w, jokes)
+	case "markdown":
+		return writeMarkdownJokes(w, jokes)
+	case "fortune":
+		bw := bufio.NewWriter(w)
+		for _, j := range jokes {
+			fmt.Fprintf(bw, "%s\n%%\n", fortuneText(j.Text))
+		}
+		return bw.Flush()
+	case "anki":
+		return WriteAnki(w, jokes, DefaultAnkiDeck)
+	default:
+		return fmt.Errorf("unknown format %q, use %s", format, strings.Join(ExportFormats, ", "))
+	}
+}
+
+// writeCSVJokes writes jokes as CSV with the columns ReadJokes knows
+func writeCSVJokes(w io.Writer, jokes []Joke) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"id", "joke", "lang", "source", "upstream_id", "rating", "tags", "fetched_at"})
+	for _, j := range jokes {
+		rating := ""
+		if j.Rating != 0 {
+			rating = strconv.Itoa(j.Rating)
+		}
+		_ = cw.Write([]string{
+			strconv.FormatInt(j.ID, 10), j.Text, j.Language, j.Source, j.UpstreamID,
+			rating, strings.Join(j.Tags, ","), j.CreatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// markdownEscaper escapes the characters that would format a joke
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`, "#", `\#`,
+)
+
+// writeMarkdownJokes writes jokes as a Markdown list, with the punchline
+// of two-part jokes on a line of its own
+func writeMarkdownJokes(w io.Writer, jokes []Joke) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprint(bw, "# Jokes\n\n")
+	for _, j := range jokes {
+		lines := strings.Split(strings.TrimSpace(j.Text), "\n")
+		for i, line := range lines {
+			line = markdownEscaper.Replace(strings.TrimSpace(line))
+			if i == 0 {
+				fmt.Fprintf(bw, "- %s", line)
+			} else {
+				fmt.Fprintf(bw, "  %s", line)
+			}
+			if i < len(lines)-1 {
+				// Two trailing spaces break the line within the item
+				fmt.Fprint(bw, "  ")
+			}
+			fmt.Fprintln(bw)
+		}
+		if len(j.Tags) > 0 {
+			fmt.Fprintf(bw, "\n  *%s*\n", markdownEscaper.Replace(strings.Join(j.Tags, ", ")))
+		}
+		fmt.Fprintln(bw)
+	}
+	return bw.Flush()
+}
+
+// ankiEscaper escapes a joke for a field of an Anki card, which holds HTML
+// and ends at a tab
+var ankiEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\t", " ", "\n", "<br>")
+
+// WriteAnki writes jokes as flashcards for Anki to import into deck, with
+// the setup on the front and the punchline on the back. Jokes are split by
+// SplitJoke, and those without a punchline are left out. The cards are
+// tagged with the tags and the language of their joke.
+func WriteAnki(w io.Writer, jokes []Joke, deck string) error {
+	bw := bufio.NewWriter(w)
+	// Headers telling Anki how to read the file, see
+	// https://docs.ankiweb.net/importing/text-files.html
+	fmt.Fprintf(bw, "#separator:tab\n#html:true\n#notetype:Basic\n#deck:%s\n#tags column:3\n", deck)
+	for _, j := range jokes {
+		setup, punchline := SplitJoke(strings.TrimSpace(j.Text))
+		if punchline == "" {
+			continue
+		}
+		var tags []string
+		for _, tag := range append(slices.Clone(j.Tags), j.Language) {
+			// Anki separates tags by spaces
+			if tag = strings.Join(strings.Fields(tag), "_"); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+		fmt.Fprintf(bw, "%s\t%s\t%s\n", ankiEscaper.Replace(setup), ankiEscaper.Replace(punchline), strings.Join(tags, " "))
+	}
+	return bw.Flush()
+}
+
+// fortuneText returns the text of a joke safe to put in a fortune file,
+// where a line holding just % would end it early
+func fortuneText(text string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "%" {
+			lines[i] = " %"
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// strfileVersion is the version of the strfile(1) index format
+const strfileVersion = 2
+
+// WriteStrfile writes the strfile(1) index of the fortune file that
+// WriteJokes writes for jokes, which fortune(6) needs next to it as the
+// file name with .dat appended
+func WriteStrfile(w io.Writer, jokes []Joke) error {
+	offsets := make([]uint32, 0, len(jokes)+1)
+	var (
+		offset            uint32
+		longest, shortest uint32
+	)
+	for i, j := range jokes {
+		offsets = append(offsets, offset)
+		// The text and its newline, without the delimiter line
+		length := uint32(len(fortuneText(j.Text)) + 1)
+		longest = max(longest, length)
+		if i == 0 || length < shortest {
+			shortest = length
+		}
+		offset += length + uint32(len("%\n"))
+	}
+	offsets = append(offsets, offset)
+
+	header := []uint32{strfileVersion, uint32(len(jokes)), longest, shortest, 0}
+	if err := binary.Write(w, binary.BigEndian, header); err != nil {
+		return fmt.Errorf("error writing strfile index: %w", err)
+	}
+	// The delimiter character, padded to a word
+	if _, err := w.Write([]byte{'%', 0, 0, 0}); err != nil {
+		return fmt.Errorf("error writing strfile index: %w", err)
+	}
+	if err := binary.Write(w, binary.BigEndian, offsets); err != nil {
+		return fmt.Errorf("error writing strfile index: %w", err)
+	}
+	return nil
+}
+
+var _ ExportStore = (*SQLiteStore)(nil)
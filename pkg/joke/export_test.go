@@ -0,0 +1,145 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSQLiteExport(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	for _, j := range []Joke{
+		{Text: "First joke", Source: "icanhazdadjoke", UpstreamID: "a", Language: "en", Tags: []string{"puns"}},
+		{Text: "Erster Witz", Source: "flachwitze", Language: "de", Tags: []string{"puns"}},
+		{Text: "Second joke", Source: "user", Language: "en"},
+	} {
+		if err := store.Save(ctx, &j); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		filter ExportFilter
+		want   []string
+	}{
+		{ExportFilter{}, []string{"First joke", "Erster Witz", "Second joke"}},
+		{ExportFilter{Language: "en"}, []string{"First joke", "Second joke"}},
+		{ExportFilter{Tag: "Puns", Source: "flachwitze"}, []string{"Erster Witz"}},
+		{ExportFilter{Since: time.Now().Add(-time.Hour)}, []string{"First joke", "Erster Witz", "Second joke"}},
+		{ExportFilter{Until: time.Now().Add(-time.Hour)}, nil},
+	}
+	for _, tt := range tests {
+		jokes, err := store.Export(ctx, tt.filter)
+		if err != nil {
+			t.Fatalf("Export(%+v) returned an error: %v", tt.filter, err)
+		}
+		var texts []string
+		for _, j := range jokes {
+			texts = append(texts, j.Text)
+		}
+		if !reflect.DeepEqual(texts, tt.want) {
+			t.Errorf("Export(%+v) = %q, want %q", tt.filter, texts, tt.want)
+		}
+	}
+
+	jokes, _ := store.Export(ctx, ExportFilter{Tag: "puns"})
+	if !reflect.DeepEqual(jokes[0].Tags, []string{"puns"}) {
+		t.Errorf("Export() returned tags %q, want [puns]", jokes[0].Tags)
+	}
+}
+
+func TestWriteJokes(t *testing.T) {
+	jokes := []Joke{
+		{ID: 7, Text: "What's the setup?\nThe punchline.", UpstreamID: "u1", Source: "flachwitze", Language: "de", Rating: 5, Tags: []string{"puns", "tiere"}},
+		{ID: 8, Text: "A *bold* joke\n%", Source: "user", Language: "en"},
+	}
+
+	for _, format := range []string{"json", "csv"} {
+		var buf bytes.Buffer
+		if err := WriteJokes(&buf, jokes, format); err != nil {
+			t.Fatalf("WriteJokes() to %s returned an error: %v", format, err)
+		}
+		read, err := ReadJokes(&buf, format)
+		if err != nil {
+			t.Fatalf("ReadJokes() of %s written by WriteJokes() returned an error: %v", format, err)
+		}
+		for i := range read {
+			want := jokes[i]
+			want.ID = 0
+			if !reflect.DeepEqual(read[i], want) {
+				t.Errorf("%s round trip = %+v, want %+v", format, read[i], want)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteJokes(&buf, jokes, "markdown"); err != nil {
+		t.Fatalf("WriteJokes() to markdown returned an error: %v", err)
+	}
+	if want := "# Jokes\n\n- What's the setup?  \n  The punchline.\n\n  *puns, tiere*\n\n- A \\*bold\\* joke  \n  %\n\n"; buf.String() != want {
+		t.Errorf("WriteJokes() to markdown = %q, want %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := WriteJokes(&buf, jokes, "fortune"); err != nil {
+		t.Fatalf("WriteJokes() to fortune returned an error: %v", err)
+	}
+	fortunes := buf.String()
+	if want := "What's the setup?\nThe punchline.\n%\nA *bold* joke\n %\n%\n"; fortunes != want {
+		t.Errorf("WriteJokes() to fortune = %q, want %q", fortunes, want)
+	}
+
+	if err := WriteJokes(&buf, jokes, "yaml"); err == nil {
+		t.Error("WriteJokes() in an unknown format returned no error")
+	}
+
+	buf.Reset()
+	if err := WriteStrfile(&buf, jokes); err != nil {
+		t.Fatalf("WriteStrfile() returned an error: %v", err)
+	}
+	var index struct {
+		Version, Count, Longest, Shortest, Flags uint32
+		Delim                                    [4]byte
+		Offsets                                  [3]uint32
+	}
+	if err := binary.Read(&buf, binary.BigEndian, &index); err != nil {
+		t.Fatalf("error reading the strfile index: %v", err)
+	}
+	if index.Version != 2 || index.Count != 2 || index.Longest != 33 || index.Shortest != 17 || index.Delim[0] != '%' {
+		t.Errorf("strfile header = %+v, want version 2 with 2 jokes of 17 to 33 bytes", index)
+	}
+	for i, offset := range index.Offsets[:2] {
+		if !strings.HasPrefix(fortunes[offset:], strings.SplitN(jokes[i].Text, "\n", 2)[0]) {
+			t.Errorf("strfile offset %d = %d, which is not the start of joke %d", i, offset, i)
+		}
+	}
+	if int(index.Offsets[2]) != len(fortunes) {
+		t.Errorf("strfile end offset = %d, want %d", index.Offsets[2], len(fortunes))
+	}
+}
+
+func TestWriteAnki(t *testing.T) {
+	jokes := []Joke{
+		{Text: "Was ist grün und klopft an die Tür?\nEin Klopfsalat.", Language: "de", Tags: []string{"essen"}},
+		{Text: "Why is 6 < 7? Because 7 8\t9.", Language: "en"},
+		{Text: "A one-liner without a punchline.", Language: "en"},
+	}
+	var buf bytes.Buffer
+	if err := WriteAnki(&buf, jokes, "Flachwitze"); err != nil {
+		t.Fatalf("WriteAnki() returned an error: %v", err)
+	}
+	want := "#separator:tab\n#html:true\n#notetype:Basic\n#deck:Flachwitze\n#tags column:3\n" +
+		"Was ist grün und klopft an die Tür?\tEin Klopfsalat.\tessen de\n" +
+		"Why is 6 &lt; 7?\tBecause 7 8 9.\ten\n"
+	if buf.String() != want {
+		t.Errorf("WriteAnki() = %q, want %q", buf.String(), want)
+	}
+}
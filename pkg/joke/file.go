@@ -0,0 +1,155 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileSource tells the jokes in a local file. Text files hold one joke per
+// line, JSON and YAML files a list of jokes and markdown files a bulleted
+// or numbered list. The file is read on every fetch, so edits take effect
+// straight away.
+type FileSource struct {
+	Path string
+	name string
+	lang string
+}
+
+// NewFileSource returns a source called name for the jokes in lang in the
+// file at path
+func NewFileSource(name, path, lang string) *FileSource {
+	return &FileSource{Path: path, name: name, lang: normalizeLanguage(lang)}
+}
+
+// Name implements Source
+func (s *FileSource) Name() string {
+	return s.name
+}
+
+// Language implements Source
+func (s *FileSource) Language() string {
+	return s.lang
+}
+
+// List implements ListSource
+func (s *FileSource) List(_ context.Context) ([]Joke, error) {
+	jokes, err := readJokeFile(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	for i := range jokes {
+		jokes[i].Source = s.name
+		if jokes[i].Language == "" {
+			jokes[i].Language = s.lang
+		}
+	}
+	return jokes, nil
+}
+
+// Fetch implements Source
+func (s *FileSource) Fetch(ctx context.Context) (Joke, error) {
+	jokes, err := s.List(ctx)
+	if err != nil {
+		return Joke{}, err
+	}
+	if len(jokes) == 0 {
+		return Joke{}, fmt.Errorf("no jokes in %s", s.Path)
+	}
+	// #nosec G404 -- picking a joke does not need a secure random number
+	return jokes[rand.IntN(len(jokes))], nil
+}
+
+// readJokeFile returns the jokes in a file, using its extension to tell
+// the format: .json and .yaml or .yml files hold a list of jokes, .md and
+// .markdown files a markdown list, any other file one joke per line
+func readJokeFile(path string) ([]Joke, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading joke file: %w", err)
+	}
+
+	var items []any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &items)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &items)
+	case ".md", ".markdown":
+		var jokes []Joke
+		for _, text := range extractJokesFromMarkdown(data) {
+			jokes = append(jokes, Joke{Text: text})
+		}
+		return jokes, nil
+	default:
+		return jokeLines(data), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+
+	jokes := make([]Joke, 0, len(items))
+	for i, item := range items {
+		j, err := jokeFromItem(item)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s: joke %d: %w", path, i+1, err)
+		}
+		jokes = append(jokes, j)
+	}
+	return jokes, nil
+}
+
+// jokeLines returns every line of data as a joke, skipping empty lines and
+// comments starting with #
+func jokeLines(data []byte) []Joke {
+	var jokes []Joke
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			jokes = append(jokes, Joke{Text: line})
+		}
+	}
+	return jokes
+}
+
+// jokeFromItem converts an item of a JSON or YAML list to a joke. Items
+// are either the text of a joke, or an object with the joke, or its setup
+// and punchline, and optionally an id and lang.
+func jokeFromItem(item any) (Joke, error) {
+	switch v := item.(type) {
+	case string:
+		if v = strings.TrimSpace(v); v != "" {
+			return Joke{Text: v}, nil
+		}
+	case map[string]any:
+		field := func(key string) string {
+			if s, ok := v[key]; ok && s != nil {
+				return strings.TrimSpace(fmt.Sprint(s))
+			}
+			return ""
+		}
+		j := Joke{Text: field("joke"), UpstreamID: field("id"), Language: field("lang")}
+		if setup, punchline := field("setup"), field("punchline"); j.Text == "" && setup != "" && punchline != "" {
+			j.Text = twoPart(setup, punchline)
+		}
+		if j.Text != "" {
+			return j, nil
+		}
+	}
+	return Joke{}, errors.New("neither a text nor an object with a joke")
+}
+
+var _ ListSource = (*FileSource)(nil)
@@ -0,0 +1,108 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestReadJokeFile(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "jokes.txt",
+			content: "# Family jokes\nFirst joke\n\n  Second joke  \n",
+			want:    []string{"First joke", "Second joke"},
+		},
+		{
+			name:    "jokes.json",
+			content: `["First joke", {"joke": "Second joke", "id": 2}, {"setup": "Knock knock?", "punchline": "Who's there."}]`,
+			want:    []string{"First joke", "Second joke", "Knock knock?\nWho's there."},
+		},
+		{
+			name:    "jokes.yaml",
+			content: "- First joke\n- joke: Second joke\n  lang: de\n",
+			want:    []string{"First joke", "Second joke"},
+		},
+		{
+			name:    "jokes.md",
+			content: "# Family jokes\n\n* First joke\n1. Second\n   joke\n",
+			want:    []string{"First joke", "Second joke"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tc.name)
+			if err := os.WriteFile(path, []byte(tc.content), 0o600); err != nil {
+				t.Fatalf("Error writing %s: %v", path, err)
+			}
+			jokes, err := readJokeFile(path)
+			if err != nil {
+				t.Fatalf("readJokeFile() returned an error: %v", err)
+			}
+			var got []string
+			for _, j := range jokes {
+				got = append(got, j.Text)
+			}
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("readJokeFile() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestReadJokeFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"object.json": `{"joke": "Not a list"}`,
+		"number.yaml": "- 42\n",
+		"empty.json":  `[{"id": 1}]`,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("Error writing %s: %v", path, err)
+		}
+		if _, err := readJokeFile(path); err == nil {
+			t.Errorf("readJokeFile(%s) did not return an error", name)
+		}
+	}
+	if _, err := readJokeFile(filepath.Join(dir, "missing.txt")); err == nil {
+		t.Errorf("readJokeFile() did not return an error for a missing file")
+	}
+}
+
+func TestEngineTellsEveryJokeOfAList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jokes.txt")
+	if err := os.WriteFile(path, []byte("One\nTwo\nThree\n"), 0o600); err != nil {
+		t.Fatalf("Error writing %s: %v", path, err)
+	}
+	engine := NewEngine(newTestStore(t), NewFileSource("family", path, "en"))
+
+	var told []string
+	for range 3 {
+		j, err := engine.Tell(context.Background())
+		if err != nil {
+			t.Fatalf("Tell() returned an error: %v", err)
+		}
+		if j.Source != "family" || j.Language != "en" {
+			t.Errorf("Tell() returned %+v, want an English joke from family", j)
+		}
+		told = append(told, j.Text)
+	}
+	slices.Sort(told)
+	if !slices.Equal(told, []string{"One", "Three", "Two"}) {
+		t.Errorf("Tell() told %q, want every joke once", told)
+	}
+	if _, err := engine.Tell(context.Background()); err == nil {
+		t.Errorf("Tell() did not return an error once every joke was told")
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrFiltered is returned when the joke asked for is rejected by the
+// engine's Filter
+var ErrFiltered = errors.New("joke is filtered out")
+
+// KidSafeBlocklist lists words that don't belong in jokes told to
+// children or on shared screens. A trailing * matches any word starting
+// with the rest.
+var KidSafeBlocklist = []string{
+	"arsch*", "ass", "asses", "asshole*", "bastard*", "bitch*", "blowjob*", "boob*", "crap*", "damn*",
+	"drunk*", "fick*", "fuck*", "hooker*", "horny", "naked", "nude*", "penis*", "piss*", "porn*",
+	"scheiß*", "scheiss*", "sex", "sexy", "shit*", "slut*", "titt*", "vagina*", "whore*",
+}
+
+// Filter decides which jokes may be told. The zero Filter allows every
+// joke.
+type Filter struct {
+	// Blocklist rejects jokes containing any of these words or phrases,
+	// ignoring case and punctuation. A trailing * matches any word
+	// starting with the rest, like "damn*" for "damned".
+	Blocklist []string
+	// MinLength and MaxLength reject jokes shorter or longer than this
+	// many characters, unless zero
+	MinLength int
+	MaxLength int
+}
+
+// IsZero reports whether f allows every joke
+func (f Filter) IsZero() bool {
+	return len(f.Blocklist) == 0 && f.MinLength <= 0 && f.MaxLength <= 0
+}
+
+// Allows reports whether j passes the filter
+func (f Filter) Allows(j Joke) bool {
+	if f.MinLength > 0 || f.MaxLength > 0 {
+		n := utf8.RuneCountInString(j.Text)
+		if n < f.MinLength || (f.MaxLength > 0 && n > f.MaxLength) {
+			return false
+		}
+	}
+	if len(f.Blocklist) == 0 {
+		return true
+	}
+	text := " " + words(j.Text) + " "
+	for _, entry := range f.Blocklist {
+		prefix := strings.HasSuffix(entry, "*")
+		entry = words(strings.TrimSuffix(entry, "*"))
+		if entry == "" {
+			continue
+		}
+		if !prefix {
+			entry += " "
+		}
+		if strings.Contains(text, " "+entry) {
+			return false
+		}
+	}
+	return true
+}
+
+// words returns the words of s in lower case, separated by single spaces
+func words(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// FilterStore is a Store that can leave out the jokes a Filter rejects
+// when picking stored jokes. Engines with a Filter over other stores tell
+// no stored joke rather than one the filter rejects.
+type FilterStore interface {
+	Store
+	// Filtered returns the store, with NextUntold, LeastRecentlyTold,
+	// Random and RandomTagged only picking jokes f allows
+	Filtered(f Filter) Store
+}
+
+// stored returns the store to pick stored jokes from, leaving out those
+// the Filter rejects if the store can
+func (e *Engine) stored() Store {
+	if fs, ok := e.Store.(FilterStore); ok && !e.Filter.IsZero() {
+		return fs.Filtered(e.Filter)
+	}
+	return e.Store
+}
+
+// filteredSQLiteStore is a SQLiteStore picking only jokes the filter
+// allows. Candidates are checked one by one, which is fast enough for the
+// size of a joke collection.
+type filteredSQLiteStore struct {
+	*SQLiteStore
+	filter Filter
+}
+
+// Filtered implements FilterStore
+func (s *SQLiteStore) Filtered(f Filter) Store {
+	return filteredSQLiteStore{SQLiteStore: s, filter: f}
+}
+
+// NextUntold implements Store
+func (s filteredSQLiteStore) NextUntold(ctx context.Context, lang string) (Joke, error) {
+	jokes, err := s.matching(ctx, "told_at IS NULL AND language = ?", "id", lang)
+	if err != nil {
+		return Joke{}, fmt.Errorf("error getting untold joke from database: %w", err)
+	}
+	if len(jokes) == 0 {
+		return Joke{}, ErrNoJokes
+	}
+	return jokes[0], nil
+}
+
+// LeastRecentlyTold implements Store
+func (s filteredSQLiteStore) LeastRecentlyTold(ctx context.Context, lang string, before time.Time) (Joke, error) {
+	jokes, err := s.matching(ctx, "language = ? AND told_at IS NOT NULL AND told_at < ?", "told_at, id", lang, before.UTC())
+	if err != nil {
+		return Joke{}, fmt.Errorf("error getting least recently told joke from database: %w", err)
+	}
+	if len(jokes) == 0 {
+		return Joke{}, ErrNoJokes
+	}
+	return jokes[0], nil
+}
+
+// Random implements Store
+func (s filteredSQLiteStore) Random(ctx context.Context) (Joke, error) {
+	return s.random(ctx, "1 = 1")
+}
+
+// RandomIn implements Store
+func (s filteredSQLiteStore) RandomIn(ctx context.Context, lang string) (Joke, error) {
+	return s.random(ctx, "language = ?", lang)
+}
+
+// RandomTagged implements Store
+func (s filteredSQLiteStore) RandomTagged(ctx context.Context, tag string) (Joke, error) {
+	return s.random(ctx, "id IN (SELECT joke_id FROM joke_tags JOIN tags ON tags.id = tag_id WHERE name = ?)", NormalizeTag(tag))
+}
+
+// random picks a random joke the filter allows among those matching
+// where, weighted by rating like SQLiteStore.Random
+func (s filteredSQLiteStore) random(ctx context.Context, where string, args ...any) (Joke, error) {
+	jokes, err := s.matching(ctx, where, "id", args...)
+	if err != nil {
+		return Joke{}, fmt.Errorf("error getting random joke from database: %w", err)
+	}
+	return pickWeighted(jokes)
+}
+
+// pickWeighted picks a random joke of jokes weighted by rating, or
+// returns ErrNoJokes if there are none
+func pickWeighted(jokes []Joke) (Joke, error) {
+	total := 0
+	for _, j := range jokes {
+		total += ratingWeight(j)
+	}
+	// #nosec G404 -- picking a joke does not need a secure random number
+	r := rand.Float64() * float64(total)
+	for _, j := range jokes {
+		if r -= float64(ratingWeight(j)); r < 0 {
+			return j, nil
+		}
+	}
+	return Joke{}, ErrNoJokes
+}
+
+// ratingWeight returns the weight of j when picking a random joke
+func ratingWeight(j Joke) int {
+	if j.Rating == 0 {
+		return unratedWeight
+	}
+	return j.Rating
+}
+
+// matching returns the jokes matching where that the filter allows,
+// sorted by order. Lengths are checked by the query, so only jokes of the
+// right length are read.
+func (s filteredSQLiteStore) matching(ctx context.Context, where, order string, args ...any) ([]Joke, error) {
+	query := "SELECT " + jokeColumns + " FROM jokes WHERE (" + where + ")"
+	if s.filter.MinLength > 0 {
+		query += " AND length(joke) >= ?"
+		args = append(args, s.filter.MinLength)
+	}
+	if s.filter.MaxLength > 0 {
+		query += " AND length(joke) <= ?"
+		args = append(args, s.filter.MaxLength)
+	}
+	rows, err := s.db.QueryContext(ctx, query+" ORDER BY "+order, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jokes []Joke
+	for rows.Next() {
+		j, err := scanJoke(rows)
+		if err != nil {
+			return nil, err
+		}
+		if s.filter.Allows(j) {
+			jokes = append(jokes, j)
+		}
+	}
+	return jokes, rows.Err()
+}
+
+var _ FilterStore = (*SQLiteStore)(nil)
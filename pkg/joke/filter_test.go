@@ -0,0 +1,111 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFilterAllows(t *testing.T) {
+	f := Filter{Blocklist: []string{"damn*", "hell", "Bad Word"}}
+	testCases := []struct {
+		text string
+		want bool
+	}{
+		{"Hello there!", true},
+		{"Go to hell.", false},
+		{"HELL, no", false},
+		{"Damned if I know", false},
+		{"Condemned building", true},
+		{"That's a bad   word!", false},
+		{"A bad wordsmith", true},
+	}
+	for _, tc := range testCases {
+		if got := f.Allows(Joke{Text: tc.text}); got != tc.want {
+			t.Errorf("Allows(%q) = %v, want %v", tc.text, got, tc.want)
+		}
+	}
+	lengths := Filter{MinLength: 5, MaxLength: 8}
+	for text, want := range map[string]bool{"Pun": false, "Pünktli": true, "Too long!": false} {
+		if got := lengths.Allows(Joke{Text: text}); got != want {
+			t.Errorf("Allows(%q) with lengths = %v, want %v", text, got, want)
+		}
+	}
+	if !(Filter{}).Allows(Joke{Text: "Damn"}) {
+		t.Error("the zero Filter rejected a joke")
+	}
+}
+
+// cycleSource returns its texts in turn
+type cycleSource struct {
+	texts []string
+	n     int
+}
+
+func (s *cycleSource) Name() string     { return "cycle" }
+func (s *cycleSource) Language() string { return "en" }
+
+func (s *cycleSource) Fetch(_ context.Context) (Joke, error) {
+	text := s.texts[s.n%len(s.texts)]
+	s.n++
+	return Joke{Text: text}, nil
+}
+
+func TestEngineFilter(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	for _, text := range []string{"A damn prefetched joke", "A clean prefetched joke"} {
+		if err := store.Save(ctx, &Joke{Text: text, Source: "test", Language: "en"}); err != nil {
+			t.Fatalf("Save() returned an error: %v", err)
+		}
+	}
+
+	src := &cycleSource{texts: []string{"Shit happens", "A clean fetched joke"}}
+	engine := NewEngine(store, src, NewStoreSource(store, ""))
+	engine.Filter = Filter{Blocklist: KidSafeBlocklist}
+
+	for _, want := range []string{"A clean prefetched joke", "A clean fetched joke"} {
+		j, err := engine.Tell(ctx)
+		if err != nil {
+			t.Fatalf("Tell() returned an error: %v", err)
+		}
+		if j.Text != want {
+			t.Errorf("Tell() = %q, want %q", j.Text, want)
+		}
+	}
+	if exists, _ := store.Exists(ctx, Joke{Text: "Shit happens"}); exists {
+		t.Error("the rejected joke was stored")
+	}
+
+	// Only the rejected prefetched joke is left to repeat
+	engine.Offline = true
+	j, err := engine.Tell(ctx)
+	if err != nil {
+		t.Fatalf("Tell() offline returned an error: %v", err)
+	}
+	if !engine.Filter.Allows(j) {
+		t.Errorf("Tell() offline = %q, want a joke the filter allows", j.Text)
+	}
+
+	engine.Offline = false
+	engine.Sources = []Source{&cycleSource{texts: []string{"Damn it"}}}
+	engine.MaxDuplicates = 2
+	if _, err := engine.Fresh(ctx); err == nil {
+		t.Error("Fresh() returned a joke from a source with only rejected jokes")
+	}
+	if _, err := engine.stored().NextUntold(ctx, "en"); !errors.Is(err, ErrNoJokes) {
+		t.Errorf("NextUntold() returned %v, want ErrNoJokes as only the rejected joke is left", err)
+	}
+
+	// Lengths are checked by the database
+	if err := store.Save(ctx, &Joke{Text: "Short", Source: "test", Language: "en"}); err != nil {
+		t.Fatalf("Save() returned an error: %v", err)
+	}
+	j, err = store.Filtered(Filter{MaxLength: 10}).NextUntold(ctx, "en")
+	if err != nil || j.Text != "Short" {
+		t.Errorf("NextUntold() with MaxLength = %q, %v, want the short joke", j.Text, err)
+	}
+}
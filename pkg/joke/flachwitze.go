@@ -0,0 +1,15 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+// FlachwitzeURL is the markdown list of German jokes used by the Flachwitze source
+const FlachwitzeURL = "https://raw.githubusercontent.com/derphilipp/Flachwitze/main/README.md"
+
+// Flachwitze fetches German jokes from the Flachwitze collection on GitHub
+type Flachwitze = MarkdownList
+
+// NewFlachwitze returns a source using the public Flachwitze collection
+func NewFlachwitze() *Flachwitze {
+	return NewMarkdownList("flachwitze", "de", FlachwitzeURL)
+}
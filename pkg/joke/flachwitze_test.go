@@ -0,0 +1,150 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+const testFlachwitze = `# Flachwitze
+
+Eine Sammlung von Flachwitzen.
+
+- Was ist orange und geht über die Berge? Eine Wanderine.
+- Was sitzt auf dem Baum und schreit "Aha"? Ein Uhu mit Sprachfehler.
+
+-
+`
+
+func TestExtractJokesFromMarkdown(t *testing.T) {
+	jokes := extractJokesFromMarkdown([]byte(testFlachwitze))
+	want := []string{
+		"Was ist orange und geht über die Berge? Eine Wanderine.",
+		`Was sitzt auf dem Baum und schreit "Aha"? Ein Uhu mit Sprachfehler.`,
+	}
+	if len(jokes) != len(want) {
+		t.Fatalf("extractJokesFromMarkdown() returned %d jokes, want %d", len(jokes), len(want))
+	}
+	for i := range want {
+		if jokes[i] != want[i] {
+			t.Errorf("joke %d is %q, want %q", i, jokes[i], want[i])
+		}
+	}
+}
+
+func TestExtractJokesFromMarkdownSnapshot(t *testing.T) {
+	// An excerpt in the layout of the Flachwitze README, with the markdown
+	// constructs list based sources use
+	md, err := os.ReadFile(filepath.Join("testdata", "flachwitze.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jokes := extractJokesFromMarkdown(md)
+	want := []string{
+		"Was ist orange und geht über die Berge? Eine Wanderine.",
+		`Was sitzt auf dem Baum und schreit "Aha"? Ein Uhu mit Sprachfehler.`,
+		"Treffen sich zwei Jäger. Beide tot.",
+		"Was macht ein Pirat am Computer? Er drückt die Enter-Taste.",
+		"Sagt der Lehrer:\n\"Nenne mir ein Tier mit vier Buchstaben!\"\nFritzchen: \"Ente!\"",
+		"Wie nennt man einen Bumerang, der nicht zurückkommt? Stock.",
+		"Was ist rot und schlecht für die Zähne? Ein Ziegelstein.",
+		"Was ist grün und klopft an die Tür? Ein Klopfsalat.",
+	}
+	if !slices.Equal(jokes, want) {
+		t.Errorf("extractJokesFromMarkdown() = %q, want %q", jokes, want)
+	}
+}
+
+func TestFlachwitzeFetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, err := w.Write([]byte(testFlachwitze))
+		if err != nil {
+			t.Errorf("Error writing response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	src := NewFlachwitze()
+	src.URL = server.URL
+
+	j, err := src.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch() returned an error: %v", err)
+	}
+	if j.Text == "" {
+		t.Errorf("Fetch() returned an empty joke")
+	}
+}
+
+func TestFlachwitzeConditionalRequests(t *testing.T) {
+	var full, notModified int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full++
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte(testFlachwitze))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	src := NewFlachwitze()
+	src.URL = server.URL
+	src.CacheDir = dir
+	for range 2 {
+		if _, err := src.Fetch(context.Background()); err != nil {
+			t.Fatalf("Fetch() returned an error: %v", err)
+		}
+	}
+	if full != 1 || notModified != 1 {
+		t.Errorf("The server sent the list %d times and 304 %d times, want once each", full, notModified)
+	}
+
+	// The next run starts from the cached list
+	src = NewFlachwitze()
+	src.URL = server.URL
+	src.CacheDir = dir
+	j, err := src.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch() returned an error: %v", err)
+	}
+	if full != 1 || j.Text == "" {
+		t.Errorf("Fetch() = %+v after %d downloads, want a joke from the cached list", j, full)
+	}
+}
+
+func TestEngineTellsEveryFlachwitz(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(testFlachwitze))
+	}))
+	defer server.Close()
+
+	src := NewFlachwitze()
+	src.URL = server.URL
+	engine := NewEngine(newTestStore(t), src)
+
+	told := map[string]bool{}
+	for range 2 {
+		j, err := engine.Fresh(context.Background())
+		if err != nil {
+			t.Fatalf("Fresh() returned an error: %v", err)
+		}
+		if told[j.Text] || j.Source != "flachwitze" || j.Language != "de" {
+			t.Errorf("Fresh() = %+v, want another German joke from flachwitze", j)
+		}
+		told[j.Text] = true
+	}
+	if _, err := engine.Fresh(context.Background()); err == nil {
+		t.Errorf("Fresh() returned no error once every joke was told")
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// GeekJokesURL is the default endpoint of the Geek Jokes API
+const GeekJokesURL = "https://geek-jokes.sameerkumar.website/api?format=json"
+
+// GeekJokes fetches English jokes about programmers and computers from the
+// Geek Jokes API
+type GeekJokes struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewGeekJokes returns a source using the public Geek Jokes API
+func NewGeekJokes() *GeekJokes {
+	return &GeekJokes{
+		URL:    GeekJokesURL,
+		Client: DefaultHTTPClient,
+	}
+}
+
+// Name implements Source
+func (s *GeekJokes) Name() string {
+	return "geek-jokes"
+}
+
+// Language implements Source
+func (s *GeekJokes) Language() string {
+	return "en"
+}
+
+// Fetch implements Source
+func (s *GeekJokes) Fetch(ctx context.Context) (Joke, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return Joke{}, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return Joke{}, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp); err != nil {
+		return Joke{}, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Joke{}, fmt.Errorf("error reading response body: %w", err)
+	}
+	var r struct {
+		Joke string `json:"joke"`
+	}
+	if err := json.Unmarshal(body, &r); err != nil {
+		return Joke{}, fmt.Errorf("error parsing JSON: %w", err)
+	}
+	if r.Joke = strings.TrimSpace(r.Joke); r.Joke == "" {
+		return Joke{}, errors.New("no joke in response")
+	}
+
+	return Joke{
+		Text:     r.Joke,
+		Source:   s.Name(),
+		Language: s.Language(),
+	}, nil
+}
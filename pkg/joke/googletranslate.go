@@ -0,0 +1,62 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"html"
+	"net/http"
+	"net/url"
+)
+
+// GoogleTranslateURL is the endpoint of the Google Cloud Translation API
+const GoogleTranslateURL = "https://translation.googleapis.com/language/translate/v2"
+
+// GoogleTranslate translates with the Google Cloud Translation API
+type GoogleTranslate struct {
+	URL    string
+	Key    string
+	Client *http.Client
+}
+
+// NewGoogleTranslate returns a translator using the Google Cloud
+// Translation API with the API key key
+func NewGoogleTranslate(key string) *GoogleTranslate {
+	return &GoogleTranslate{
+		URL:    GoogleTranslateURL,
+		Key:    key,
+		Client: DefaultHTTPClient,
+	}
+}
+
+// Name implements Translator
+func (t *GoogleTranslate) Name() string {
+	return "google"
+}
+
+// Translate implements Translator
+func (t *GoogleTranslate) Translate(ctx context.Context, text, from, to string) (string, error) {
+	in := map[string]string{
+		"q":      text,
+		"source": from,
+		"target": to,
+		"format": "text",
+	}
+	var out struct {
+		Data struct {
+			Translations []struct {
+				TranslatedText string `json:"translatedText"`
+			} `json:"translations"`
+		} `json:"data"`
+	}
+	if err := postJSON(ctx, t.Client, t.URL+"?key="+url.QueryEscape(t.Key), nil, in, &out); err != nil {
+		return "", err
+	}
+	if len(out.Data.Translations) == 0 {
+		return "", errors.New("no translation in response")
+	}
+	// Quotes come back as entities even for plain text
+	return html.UnescapeString(out.Data.Translations[0].TranslatedText), nil
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ICanHazDadJokeGraphQLURL is the default GraphQL endpoint of the
+// icanhazdadjoke.com API
+const ICanHazDadJokeGraphQLURL = "https://icanhazdadjoke.com/graphql"
+
+// MaxBatchSize limits how many jokes are asked for in a single request
+const MaxBatchSize = 20
+
+// ICanHazDadJokeGraphQL fetches random jokes from icanhazdadjoke.com
+// through its GraphQL endpoint, which returns several jokes per request.
+// Searches and lookups by ID use the REST API. It has the same name as
+// the REST source, so jokes are recognized whichever API they came from.
+type ICanHazDadJokeGraphQL struct {
+	*ICanHazDadJoke
+	GraphQLURL string
+}
+
+// NewICanHazDadJokeGraphQL returns a source using the public
+// icanhazdadjoke.com GraphQL API
+func NewICanHazDadJokeGraphQL() *ICanHazDadJokeGraphQL {
+	return &ICanHazDadJokeGraphQL{
+		ICanHazDadJoke: NewICanHazDadJoke(),
+		GraphQLURL:     ICanHazDadJokeGraphQLURL,
+	}
+}
+
+// Fetch implements Source
+func (s *ICanHazDadJokeGraphQL) Fetch(ctx context.Context) (Joke, error) {
+	jokes, err := s.FetchBatch(ctx, 1)
+	if err != nil {
+		return Joke{}, err
+	}
+	return jokes[0], nil
+}
+
+// graphQLResponse is the response to a query for jokes, one field per
+// alias in the query
+type graphQLResponse struct {
+	Data   map[string]ResponseObject `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// FetchBatch implements BatchSource. The API picks every joke at random,
+// so a batch may hold the same joke more than once.
+func (s *ICanHazDadJokeGraphQL) FetchBatch(ctx context.Context, n int) ([]Joke, error) {
+	n = min(max(n, 1), MaxBatchSize)
+
+	// Ask for the joke field once per joke, aliased j0, j1, ...
+	var query strings.Builder
+	query.WriteString("query {")
+	for i := range n {
+		fmt.Fprintf(&query, " j%d: joke { id joke }", i)
+	}
+	query.WriteString(" }")
+
+	body, err := json.Marshal(map[string]string{"query": query.String()})
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.GraphQLURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var resp graphQLResponse
+	if err := s.send(req, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Errors) > 0 {
+		errs := make([]error, 0, len(resp.Errors))
+		for _, e := range resp.Errors {
+			errs = append(errs, errors.New(e.Message))
+		}
+		return nil, fmt.Errorf("error in GraphQL response: %w", errors.Join(errs...))
+	}
+
+	jokes := make([]Joke, 0, n)
+	for i := range n {
+		if r, ok := resp.Data[fmt.Sprintf("j%d", i)]; ok && r.Joke != "" {
+			jokes = append(jokes, s.joke(r))
+		}
+	}
+	if len(jokes) == 0 {
+		return nil, errors.New("GraphQL response holds no jokes")
+	}
+	return jokes, nil
+}
+
+var _ BatchSource = (*ICanHazDadJokeGraphQL)(nil)
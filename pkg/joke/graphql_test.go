@@ -0,0 +1,105 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newGraphQLServer returns a server answering every joke in a query with a
+// new joke, counting the requests
+func newGraphQLServer(t *testing.T, requests *atomic.Int64) *httptest.Server {
+	t.Helper()
+	var next atomic.Int64
+	aliases := regexp.MustCompile(`(j\d+): joke`)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Method != http.MethodPost || r.URL.Path != "/graphql" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+		}
+		var body struct {
+			Query string `json:"query"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Error decoding the request: %v", err)
+		}
+		data := map[string]ResponseObject{}
+		for _, m := range aliases.FindAllStringSubmatch(body.Query, -1) {
+			n := next.Add(1)
+			data[m[1]] = ResponseObject{ID: fmt.Sprint(n), Joke: fmt.Sprintf("GraphQL joke %d", n)}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newTestGraphQLSource returns a GraphQL source pointing at server
+func newTestGraphQLSource(server *httptest.Server) *ICanHazDadJokeGraphQL {
+	src := NewICanHazDadJokeGraphQL()
+	src.URL = server.URL
+	src.GraphQLURL = server.URL + "/graphql"
+	return src
+}
+
+func TestICanHazDadJokeGraphQLFetchBatch(t *testing.T) {
+	var requests atomic.Int64
+	src := newTestGraphQLSource(newGraphQLServer(t, &requests))
+
+	jokes, err := src.FetchBatch(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("FetchBatch() returned an error: %v", err)
+	}
+	if len(jokes) != 3 {
+		t.Fatalf("FetchBatch() returned %d jokes, want 3", len(jokes))
+	}
+	for _, j := range jokes {
+		if j.Source != "icanhazdadjoke" || j.Language != "en" || j.UpstreamID == "" {
+			t.Errorf("FetchBatch() returned %+v, want an English icanhazdadjoke joke with an ID", j)
+		}
+	}
+	if requests.Load() != 1 {
+		t.Errorf("FetchBatch() sent %d requests, want 1", requests.Load())
+	}
+}
+
+func TestICanHazDadJokeGraphQLErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data": null, "errors": [{"message": "Cannot query field \"jokes\""}]}`))
+	}))
+	defer server.Close()
+
+	_, err := newTestGraphQLSource(server).Fetch(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "Cannot query field") {
+		t.Errorf("Fetch() returned %v, want the GraphQL error", err)
+	}
+}
+
+func TestEnginePrefetchBatches(t *testing.T) {
+	var requests atomic.Int64
+	src := newTestGraphQLSource(newGraphQLServer(t, &requests))
+	store := newTestStore(t)
+	engine := NewEngine(store, src)
+
+	stored, err := engine.Prefetch(context.Background(), MaxBatchSize+5, nil)
+	if err != nil {
+		t.Fatalf("Prefetch() returned an error: %v", err)
+	}
+	if stored != MaxBatchSize+5 {
+		t.Errorf("Prefetch() stored %d jokes, want %d", stored, MaxBatchSize+5)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("Prefetch() sent %d requests, want 2", requests.Load())
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"strings"
+	"unicode"
+)
+
+// NormalizeText returns the text of a joke reduced to what makes it the
+// same joke: lower case words separated by single spaces, without
+// punctuation. "Why did the chicken...?" and "why did the  chicken"
+// normalize to the same text.
+func NormalizeText(text string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}), " ")
+}
+
+// textHash returns the hash of the normalized text that the store uses to
+// recognize duplicates
+func textHash(text string) string {
+	sum := sha256.Sum256([]byte(NormalizeText(text)))
+	return hex.EncodeToString(sum[:])
+}
+
+// backfillHashes sets the hash of every stored joke. Jokes that turn out
+// to be duplicates of an earlier one are merged into it: their counts,
+// last told time, rating and tags are kept, and the duplicate is deleted.
+func backfillHashes(tx *sql.Tx) error {
+	type row struct {
+		id   int64
+		text string
+	}
+	rows, err := tx.Query("SELECT id, joke FROM jokes ORDER BY id")
+	if err != nil {
+		return err
+	}
+	var jokes []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.id, &r.text); err != nil {
+			rows.Close()
+			return err
+		}
+		jokes = append(jokes, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	first := map[string]int64{}
+	for _, j := range jokes {
+		hash := textHash(j.text)
+		keep, ok := first[hash]
+		if !ok {
+			first[hash] = j.id
+			if _, err := tx.Exec("UPDATE jokes SET hash = ? WHERE id = ?", hash, j.id); err != nil {
+				return err
+			}
+			continue
+		}
+
+		for _, stmt := range []string{
+			`UPDATE jokes SET
+				times_told = times_told + (SELECT times_told FROM jokes WHERE id = :dup),
+				told_at = (SELECT MAX(told_at) FROM jokes WHERE id IN (:keep, :dup)),
+				rating = COALESCE(rating, (SELECT rating FROM jokes WHERE id = :dup))
+			WHERE id = :keep`,
+			"INSERT OR IGNORE INTO joke_tags (joke_id, tag_id) SELECT :keep, tag_id FROM joke_tags WHERE joke_id = :dup",
+			"DELETE FROM jokes WHERE id = :dup",
+		} {
+			if _, err := tx.Exec(stmt, sql.Named("keep", keep), sql.Named("dup", j.id)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestNormalizeText(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Why did the chicken...?", "why did the chicken"},
+		{"  why did the  chicken ...  ", "why did the chicken"},
+		{"I'm 2 tired.", "i m 2 tired"},
+		{"Was ist grün und klopft?", "was ist grün und klopft"},
+		{"...", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeText(tt.text); got != tt.want {
+			t.Errorf("NormalizeText(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSaveRejectsNormalizedDuplicate(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	j := Joke{Text: "Why did the chicken cross the road?", Source: "test"}
+	if err := store.Save(ctx, &j); err != nil {
+		t.Fatalf("Save() returned an error: %v", err)
+	}
+
+	dup := Joke{Text: "why did the  chicken cross the road ...  ", Source: "other"}
+	exists, err := store.Exists(ctx, dup)
+	if err != nil {
+		t.Fatalf("Exists() returned an error: %v", err)
+	}
+	if !exists {
+		t.Errorf("Exists() = false for a joke differing only in case, spacing and punctuation")
+	}
+	if err := store.Save(ctx, &dup); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Save() of a duplicate returned %v, want ErrDuplicate", err)
+	}
+}
+
+func TestMigrateMergesDuplicates(t *testing.T) {
+	skipWithoutDropColumn(t)
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	if err := store.MigrateTo(6); err != nil {
+		t.Fatalf("MigrateTo(6) returned an error: %v", err)
+	}
+	insert := func(text string, timesTold int, toldAt any, rating any) int64 {
+		t.Helper()
+		res, err := store.DB().Exec("INSERT INTO jokes (joke, source, times_told, told_at, rating) VALUES (?, 'test', ?, ?, ?)",
+			text, timesTold, toldAt, rating)
+		if err != nil {
+			t.Fatalf("Error inserting a joke: %v", err)
+		}
+		id, _ := res.LastInsertId()
+		return id
+	}
+	keep := insert("Why did the chicken cross the road?", 1, "2024-01-01 09:00:00", nil)
+	dup := insert("why did the chicken cross the road", 2, "2024-03-01 09:00:00", 4)
+	other := insert("A different joke", 0, nil, nil)
+	if err := store.AddTags(ctx, dup, "animals"); err != nil {
+		t.Fatalf("AddTags() returned an error: %v", err)
+	}
+
+	if err := store.Migrate(); err != nil {
+		t.Fatalf("Migrate() returned an error: %v", err)
+	}
+
+	j, err := store.Get(ctx, keep)
+	if err != nil {
+		t.Fatalf("Get(%d) returned an error: %v", keep, err)
+	}
+	if j.TimesTold != 3 {
+		t.Errorf("TimesTold = %d, want 3", j.TimesTold)
+	}
+	if j.Rating != 4 {
+		t.Errorf("Rating = %d, want 4", j.Rating)
+	}
+	if j.ToldAt == nil || j.ToldAt.Month() != 3 {
+		t.Errorf("ToldAt = %v, want the later time", j.ToldAt)
+	}
+	if len(j.Tags) != 1 || j.Tags[0] != "animals" {
+		t.Errorf("Tags = %v, want [animals]", j.Tags)
+	}
+	if _, err := store.Get(ctx, dup); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(%d) of the merged duplicate returned %v, want ErrNotFound", dup, err)
+	}
+	if _, err := store.Get(ctx, other); err != nil {
+		t.Errorf("Get(%d) returned an error: %v", other, err)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrCircuitOpen is returned instead of fetching from a source that failed
+// too often in a row, until its cool-down is over
+var ErrCircuitOpen = errors.New("circuit open")
+
+// Breaker decides when to stop trying a failing source. Once a source
+// failed Threshold times in a row it is skipped for Cooldown, after which
+// a single fetch decides whether it is tried again or skipped for another
+// Cooldown.
+type Breaker struct {
+	// Threshold is the number of consecutive failures that open the
+	// circuit. Zero disables the breaker.
+	Threshold int
+	Cooldown  time.Duration
+}
+
+// DefaultBreaker skips a source for 5 minutes after 5 failed fetches in a row
+var DefaultBreaker = Breaker{Threshold: 5, Cooldown: 5 * time.Minute}
+
+// SourceHealth is how fetching from a source went lately
+type SourceHealth struct {
+	Source string `json:"source"`
+	// Failures counts the fetches that failed since the last success
+	Failures    int        `json:"failures"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastFailure *time.Time `json:"last_failure,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	// Latency is how long the last fetch took, including retries
+	Latency time.Duration `json:"latency"`
+}
+
+// OpenUntil returns when the circuit of the source closes again, or the
+// zero time if b does not skip the source at now
+func (h SourceHealth) OpenUntil(b Breaker, now time.Time) time.Time {
+	if b.Threshold <= 0 || h.Failures < b.Threshold || h.LastFailure == nil {
+		return time.Time{}
+	}
+	if until := h.LastFailure.Add(b.Cooldown); now.Before(until) {
+		return until
+	}
+	return time.Time{}
+}
+
+// HealthStore is a Store that keeps track of how fetching from each source
+// went. The engine uses it to skip failing sources, see Breaker.
+type HealthStore interface {
+	Store
+	// SourceHealth returns the health of a source, which is zero for
+	// sources that were never fetched from
+	SourceHealth(ctx context.Context, source string) (SourceHealth, error)
+	// SourceHealths returns the health of every source fetched from,
+	// sorted by name
+	SourceHealths(ctx context.Context) ([]SourceHealth, error)
+	// RecordFetch records a fetch from source that took latency and
+	// failed with err, or succeeded if err is nil
+	RecordFetch(ctx context.Context, source string, latency time.Duration, err error) error
+}
+
+// healthColumns lists the columns read into a SourceHealth, in
+// scanHealth order
+const healthColumns = "source, failures, last_error, last_failure, last_success, latency_ms"
+
+// scanHealth reads a row selected with healthColumns
+func scanHealth(row scanner) (SourceHealth, error) {
+	var (
+		h                        SourceHealth
+		lastFailure, lastSuccess sql.NullTime
+		latency                  int64
+	)
+	err := row.Scan(&h.Source, &h.Failures, &h.LastError, &lastFailure, &lastSuccess, &latency)
+	if lastFailure.Valid {
+		h.LastFailure = &lastFailure.Time
+	}
+	if lastSuccess.Valid {
+		h.LastSuccess = &lastSuccess.Time
+	}
+	h.Latency = time.Duration(latency) * time.Millisecond
+	return h, err
+}
+
+// SourceHealth implements HealthStore
+func (s *SQLiteStore) SourceHealth(ctx context.Context, source string) (SourceHealth, error) {
+	h, err := scanHealth(s.db.QueryRowContext(ctx, "SELECT "+healthColumns+" FROM source_health WHERE source = ?", source))
+	if errors.Is(err, sql.ErrNoRows) {
+		return SourceHealth{Source: source}, nil
+	}
+	if err != nil {
+		return SourceHealth{}, fmt.Errorf("error getting source health: %w", err)
+	}
+	return h, nil
+}
+
+// SourceHealths implements HealthStore
+func (s *SQLiteStore) SourceHealths(ctx context.Context) ([]SourceHealth, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+healthColumns+" FROM source_health ORDER BY source")
+	if err != nil {
+		return nil, fmt.Errorf("error getting source health: %w", err)
+	}
+	defer rows.Close()
+
+	var healths []SourceHealth
+	for rows.Next() {
+		h, err := scanHealth(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error reading source health: %w", err)
+		}
+		healths = append(healths, h)
+	}
+	return healths, rows.Err()
+}
+
+// RecordFetch implements HealthStore
+func (s *SQLiteStore) RecordFetch(ctx context.Context, source string, latency time.Duration, fetchErr error) error {
+	now := time.Now().UTC()
+	var err error
+	if fetchErr == nil {
+		_, err = s.db.ExecContext(ctx, `INSERT INTO source_health (source, failures, last_success, latency_ms) VALUES (?, 0, ?, ?)
+			ON CONFLICT (source) DO UPDATE SET failures = 0, last_success = excluded.last_success, latency_ms = excluded.latency_ms`,
+			source, now, latency.Milliseconds())
+	} else {
+		_, err = s.db.ExecContext(ctx, `INSERT INTO source_health (source, failures, last_error, last_failure, latency_ms) VALUES (?, 1, ?, ?, ?)
+			ON CONFLICT (source) DO UPDATE SET failures = failures + 1, last_error = excluded.last_error,
+				last_failure = excluded.last_failure, latency_ms = excluded.latency_ms`,
+			source, fetchErr.Error(), now, latency.Milliseconds())
+	}
+	if err != nil {
+		return fmt.Errorf("error recording source health: %w", err)
+	}
+	return nil
+}
+
+var _ HealthStore = (*SQLiteStore)(nil)
@@ -0,0 +1,96 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// failingSource fails every fetch and counts them
+type failingSource struct {
+	fetches int
+}
+
+func (s *failingSource) Name() string     { return "failing" }
+func (s *failingSource) Language() string { return "en" }
+
+func (s *failingSource) Fetch(_ context.Context) (Joke, error) {
+	s.fetches++
+	return Joke{}, errors.New("upstream down")
+}
+
+func TestRecordFetch(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	h, err := store.SourceHealth(ctx, "new")
+	if err != nil || h.Failures != 0 || h.LastSuccess != nil {
+		t.Errorf("SourceHealth() of an unknown source = %+v, %v, want zero health", h, err)
+	}
+
+	for range 3 {
+		if err := store.RecordFetch(ctx, "flaky", 2*time.Second, errors.New("timeout")); err != nil {
+			t.Fatalf("RecordFetch() returned an error: %v", err)
+		}
+	}
+	h, err = store.SourceHealth(ctx, "flaky")
+	if err != nil {
+		t.Fatalf("SourceHealth() returned an error: %v", err)
+	}
+	if h.Failures != 3 || h.LastError != "timeout" || h.LastFailure == nil || h.Latency != 2*time.Second {
+		t.Errorf("SourceHealth() = %+v, want 3 failures", h)
+	}
+	if until := h.OpenUntil(Breaker{Threshold: 3, Cooldown: time.Minute}, time.Now()); until.IsZero() {
+		t.Errorf("OpenUntil() is zero after 3 failures, want the end of the cool-down")
+	}
+	if until := h.OpenUntil(Breaker{Threshold: 3, Cooldown: time.Minute}, time.Now().Add(2*time.Minute)); !until.IsZero() {
+		t.Errorf("OpenUntil() = %v after the cool-down, want zero", until)
+	}
+
+	if err := store.RecordFetch(ctx, "flaky", 100*time.Millisecond, nil); err != nil {
+		t.Fatalf("RecordFetch() returned an error: %v", err)
+	}
+	healths, err := store.SourceHealths(ctx)
+	if err != nil {
+		t.Fatalf("SourceHealths() returned an error: %v", err)
+	}
+	if len(healths) != 1 || healths[0].Failures != 0 || healths[0].LastSuccess == nil || healths[0].LastError != "timeout" {
+		t.Errorf("SourceHealths() = %+v, want flaky recovered", healths)
+	}
+}
+
+func TestEngineBreaker(t *testing.T) {
+	store := newTestStore(t)
+	failing := &failingSource{}
+	engine := NewEngine(store, failing, &sequenceSource{})
+	engine.Retry.Attempts = 1
+	engine.Breaker = Breaker{Threshold: 2, Cooldown: time.Hour}
+
+	for range 4 {
+		if _, err := engine.Fresh(context.Background()); err != nil {
+			t.Fatalf("Fresh() returned an error: %v", err)
+		}
+	}
+	if failing.fetches != 2 {
+		t.Errorf("The failing source was fetched from %d times, want 2 before its circuit opened", failing.fetches)
+	}
+
+	// A new engine, like that of the next invocation, skips it too
+	engine = NewEngine(store, failing)
+	engine.Breaker = Breaker{Threshold: 2, Cooldown: time.Hour}
+	if _, err := engine.Fresh(context.Background()); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Fresh() returned %v, want ErrCircuitOpen", err)
+	}
+
+	// Once the cool-down is over the source is tried again
+	engine.Breaker.Cooldown = 0
+	engine.Retry.Attempts = 1
+	_, _ = engine.Fresh(context.Background())
+	if failing.fetches != 3 {
+		t.Errorf("The failing source was fetched from %d times, want 3 after the cool-down", failing.fetches)
+	}
+}
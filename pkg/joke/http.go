@@ -0,0 +1,132 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// HTTPSource fetches jokes from any JSON API that returns a random joke.
+// Fields of the response are picked with dot separated paths like
+// "data.joke" or "jokes.0.text".
+type HTTPSource struct {
+	URL    string
+	Client *http.Client
+	// Headers are sent with every request
+	Headers map[string]string
+	// JokeField holds the text of the joke. When it is empty, the joke is
+	// made of SetupField and PunchlineField.
+	JokeField      string
+	SetupField     string
+	PunchlineField string
+	// IDField holds the identifier of the joke, if the API has one
+	IDField string
+	name    string
+	lang    string
+}
+
+// NewHTTPSource returns a source called name for the jokes in lang from
+// the JSON API at url, reading the joke from the "joke" field
+func NewHTTPSource(name, lang, url string) *HTTPSource {
+	return &HTTPSource{
+		URL:       url,
+		Client:    DefaultHTTPClient,
+		JokeField: "joke",
+		name:      name,
+		lang:      normalizeLanguage(lang),
+	}
+}
+
+// Name implements Source
+func (s *HTTPSource) Name() string {
+	return s.name
+}
+
+// Language implements Source
+func (s *HTTPSource) Language() string {
+	return s.lang
+}
+
+// Fetch implements Source
+func (s *HTTPSource) Fetch(ctx context.Context) (Joke, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return Joke{}, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set("Accept", "application/json")
+	for k, v := range s.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return Joke{}, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp); err != nil {
+		return Joke{}, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Joke{}, fmt.Errorf("error reading response body: %w", err)
+	}
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return Joke{}, fmt.Errorf("error parsing JSON: %w", err)
+	}
+
+	j := Joke{
+		UpstreamID: jsonField(v, s.IDField),
+		Source:     s.name,
+		Language:   s.lang,
+	}
+	if s.JokeField != "" {
+		j.Text = jsonField(v, s.JokeField)
+	} else if setup, punchline := jsonField(v, s.SetupField), jsonField(v, s.PunchlineField); setup != "" && punchline != "" {
+		j.Text = twoPart(setup, punchline)
+	}
+	if j.Text == "" {
+		return Joke{}, errors.New("no joke in response")
+	}
+	return j, nil
+}
+
+// jsonField returns the value at path in v as text, or "" if there is none
+func jsonField(v any, path string) string {
+	if path == "" {
+		return ""
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]any:
+			v = node[key]
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return ""
+			}
+			v = node[i]
+		default:
+			return ""
+		}
+	}
+	switch v := v.(type) {
+	case nil, map[string]any, []any:
+		return ""
+	case string:
+		return strings.TrimSpace(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data": {"jokes": [{"id": 7, "q": "Why did the scarecrow win an award?", "a": "He was outstanding in his field."}], "text": " Plain joke. "}}`))
+	}))
+	defer server.Close()
+
+	src := NewHTTPSource("farm", "en", server.URL)
+	if _, err := src.Fetch(context.Background()); err == nil {
+		t.Errorf("Fetch() without the header returned no error")
+	}
+	src.Headers = map[string]string{"X-Api-Key": "secret"}
+
+	src.JokeField = "data.text"
+	j, err := src.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch() returned an error: %v", err)
+	}
+	if j.Text != "Plain joke." || j.Source != "farm" || j.Language != "en" {
+		t.Errorf("Fetch() = %+v, want the trimmed joke from farm", j)
+	}
+
+	src.JokeField, src.SetupField, src.PunchlineField, src.IDField = "", "data.jokes.0.q", "data.jokes.0.a", "data.jokes.0.id"
+	j, err = src.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch() returned an error: %v", err)
+	}
+	if j.Text != "Why did the scarecrow win an award?\nHe was outstanding in his field." || j.UpstreamID != "7" {
+		t.Errorf("Fetch() = %+v, want the two part joke with its id", j)
+	}
+
+	src.JokeField = "data.jokes.1.q"
+	if _, err := src.Fetch(context.Background()); err == nil {
+		t.Errorf("Fetch() of a missing field returned no error")
+	}
+}
+
+func TestWitzAPI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`[{"text": "Was ist grün und klopft an die Tür? Ein Klopfsalat.", "category": "flachwitze", "language": "de"}]`))
+	}))
+	defer server.Close()
+
+	src := NewWitzAPI()
+	src.URL = server.URL
+	j, err := src.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch() returned an error: %v", err)
+	}
+	if j.Text != "Was ist grün und klopft an die Tür? Ein Klopfsalat." || j.Source != "witzapi" || j.Language != "de" {
+		t.Errorf("Fetch() = %+v, want the German joke from witzapi", j)
+	}
+}
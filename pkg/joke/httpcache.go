@@ -0,0 +1,129 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// httpCache keeps a downloaded document along with its ETag and
+// Last-Modified validators, so it is only downloaded again once it changed
+type httpCache struct {
+	// path is the file the document is kept in between runs. Without one
+	// it is only kept in memory.
+	path string
+
+	mu    sync.Mutex
+	entry *cacheEntry
+}
+
+// cacheEntry is a cached document
+type cacheEntry struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Body         []byte `json:"body"`
+}
+
+// get returns the document at url, sending a conditional request if it is
+// cached. changed reports whether the document differs from the one
+// returned last time.
+func (c *httpCache) get(ctx context.Context, client *http.Client, url string) (body []byte, changed bool, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("User-Agent", UserAgent)
+
+	loaded := c.entry != nil
+	if !loaded {
+		c.entry = c.load()
+	}
+	if c.entry != nil && c.entry.URL == url {
+		if c.entry.ETag != "" {
+			req.Header.Set("If-None-Match", c.entry.ETag)
+		}
+		if c.entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", c.entry.LastModified)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, false, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && c.entry != nil && c.entry.URL == url {
+		// A document first loaded from the file is new to the caller
+		return c.entry.Body, !loaded, nil
+	}
+	if err := checkStatus(resp); err != nil {
+		return nil, false, err
+	}
+	if body, err = io.ReadAll(resp.Body); err != nil {
+		return nil, false, fmt.Errorf("error reading response body: %w", err)
+	}
+
+	c.entry = &cacheEntry{
+		URL:          url,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Body:         body,
+	}
+	if err := c.save(); err != nil {
+		log.Debug().Err(err).Str("file", c.path).Msg("Could not cache download")
+	}
+	return body, true, nil
+}
+
+// load reads the cached document from the file, if there is one
+func (c *httpCache) load() *cacheEntry {
+	if c.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return nil
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		log.Debug().Err(err).Str("file", c.path).Msg("Ignoring broken cache file")
+		return nil
+	}
+	return &entry
+}
+
+// save writes the cached document to the file, if there is one
+func (c *httpCache) save() error {
+	if c.path == "" || c.entry.ETag == "" && c.entry.LastModified == "" {
+		return nil
+	}
+	data, err := json.Marshal(c.entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return err
+	}
+	// Write to a temporary file first, so other processes never read half
+	// a cache file
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
@@ -0,0 +1,255 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// ICanHazDadJokeURL is the default endpoint of the icanhazdadjoke.com API
+const ICanHazDadJokeURL = "https://icanhazdadjoke.com/"
+
+// DefaultUserAgent identifies godad to upstream APIs
+const DefaultUserAgent = "https://github.com/lhaig/godad"
+
+// UserAgent is sent with every request to identify godad to upstream APIs.
+// Change it before fetching to identify as something else.
+var UserAgent = DefaultUserAgent
+
+const (
+	// MaxSearchPages limits how many pages of search results are read
+	MaxSearchPages = 10
+	// searchPageSize is the number of results per page, the API's maximum
+	searchPageSize = 30
+)
+
+// ResponseObject represents the structure of the API response
+type ResponseObject struct {
+	ID     string `json:"id"`
+	Joke   string `json:"joke"`
+	Status int    `json:"status"`
+}
+
+// ICanHazDadJoke fetches jokes from the icanhazdadjoke.com API
+type ICanHazDadJoke struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewICanHazDadJoke returns a source using the public icanhazdadjoke.com API
+func NewICanHazDadJoke() *ICanHazDadJoke {
+	return &ICanHazDadJoke{
+		URL:    ICanHazDadJokeURL,
+		Client: DefaultHTTPClient,
+	}
+}
+
+// Name implements Source
+func (s *ICanHazDadJoke) Name() string {
+	return "icanhazdadjoke"
+}
+
+// Language implements Source
+func (s *ICanHazDadJoke) Language() string {
+	return "en"
+}
+
+// Fetch implements Source
+func (s *ICanHazDadJoke) Fetch(ctx context.Context) (Joke, error) {
+	var responseObject ResponseObject
+	if err := s.get(ctx, s.URL, &responseObject); err != nil {
+		return Joke{}, err
+	}
+	return s.joke(responseObject), nil
+}
+
+// FetchID implements IDSource
+func (s *ICanHazDadJoke) FetchID(ctx context.Context, id string) (Joke, error) {
+	endpoint, err := url.JoinPath(s.URL, "j", id)
+	if err != nil {
+		return Joke{}, fmt.Errorf("error creating request: %w", err)
+	}
+
+	var responseObject ResponseObject
+	err = s.get(ctx, endpoint, &responseObject)
+	var statusErr *StatusError
+	// The API reports unknown IDs in the body, but check the status as well
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound ||
+		err == nil && responseObject.Status == http.StatusNotFound {
+		return Joke{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return Joke{}, err
+	}
+	return s.joke(responseObject), nil
+}
+
+// searchResponse is a page of results from the search endpoint
+type searchResponse struct {
+	Results    []ResponseObject `json:"results"`
+	TotalPages int              `json:"total_pages"`
+	TotalJokes int              `json:"total_jokes"`
+}
+
+// searchPage returns the page of search results for term with limit
+// results per page
+func (s *ICanHazDadJoke) searchPage(ctx context.Context, term string, page, limit int) (searchResponse, error) {
+	endpoint, err := url.JoinPath(s.URL, "search")
+	if err != nil {
+		return searchResponse{}, fmt.Errorf("error creating request: %w", err)
+	}
+	query := url.Values{}
+	query.Set("term", term)
+	query.Set("page", strconv.Itoa(page))
+	query.Set("limit", strconv.Itoa(limit))
+
+	var resp searchResponse
+	err = s.get(ctx, endpoint+"?"+query.Encode(), &resp)
+	return resp, err
+}
+
+// Search implements SearchSource. It reads up to MaxSearchPages pages of
+// results.
+func (s *ICanHazDadJoke) Search(ctx context.Context, term string) ([]Joke, error) {
+	var jokes []Joke
+	for page := 1; page <= MaxSearchPages; page++ {
+		resp, err := s.searchPage(ctx, term, page, searchPageSize)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range resp.Results {
+			jokes = append(jokes, s.joke(r))
+		}
+		if page >= resp.TotalPages {
+			break
+		}
+	}
+	return jokes, nil
+}
+
+// Count implements IndexSource
+func (s *ICanHazDadJoke) Count(ctx context.Context) (int, error) {
+	resp, err := s.searchPage(ctx, "", 1, 1)
+	return resp.TotalJokes, err
+}
+
+// FetchIndex implements IndexSource. The jokes are numbered in the order
+// the search endpoint lists them in.
+func (s *ICanHazDadJoke) FetchIndex(ctx context.Context, i int) (Joke, error) {
+	resp, err := s.searchPage(ctx, "", i+1, 1)
+	if err != nil {
+		return Joke{}, err
+	}
+	if len(resp.Results) == 0 {
+		return Joke{}, fmt.Errorf("%w: joke %d", ErrNotFound, i)
+	}
+	return s.joke(resp.Results[0]), nil
+}
+
+// joke converts an API response to a Joke
+func (s *ICanHazDadJoke) joke(r ResponseObject) Joke {
+	return Joke{
+		Text:       r.Joke,
+		UpstreamID: r.ID,
+		Source:     s.Name(),
+		Language:   s.Language(),
+	}
+}
+
+// get requests rawURL and decodes the JSON response into v
+func (s *ICanHazDadJoke) get(ctx context.Context, rawURL string, v any) error {
+	// Create a new request
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	return s.send(req, v)
+}
+
+// send sends req and decodes the JSON response into v
+func (s *ICanHazDadJoke) send(req *http.Request, v any) error {
+	// Set headers
+	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set("Accept", "application/json")
+
+	// Send the request
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp); err != nil {
+		return err
+	}
+
+	// Read the response body
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response body: %w", err)
+	}
+
+	// Parse the JSON response
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("error parsing JSON: %w", err)
+	}
+	return nil
+}
+
+// maxImageSize is the largest image of a joke that is downloaded
+const maxImageSize = 10 << 20
+
+// Image returns the PNG image icanhazdadjoke.com draws of the joke with
+// the given ID
+func (s *ICanHazDadJoke) Image(ctx context.Context, id string) ([]byte, error) {
+	endpoint, err := url.JoinPath(s.URL, "j", id+".png")
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set("Accept", "image/png")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxImageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading image: %w", err)
+	}
+	if len(body) > maxImageSize {
+		return nil, fmt.Errorf("image of joke %s is larger than %d bytes", id, maxImageSize)
+	}
+	if !bytes.HasPrefix(body, []byte("\x89PNG\r\n\x1a\n")) {
+		return nil, fmt.Errorf("icanhazdadjoke.com sent no PNG image for joke %s", id)
+	}
+	return body, nil
+}
+
+var (
+	_ SearchSource = (*ICanHazDadJoke)(nil)
+	_ IDSource     = (*ICanHazDadJoke)(nil)
+	_ IndexSource  = (*ICanHazDadJoke)(nil)
+)
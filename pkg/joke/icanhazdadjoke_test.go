@@ -0,0 +1,188 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestICanHazDadJokeAPIError(t *testing.T) {
+	// Create a mock server that returns an error
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	// Call the Fetch function
+	_, err := newTestSource(server).Fetch(context.Background())
+
+	// Check if there was an error
+	if err == nil {
+		t.Errorf("Fetch() did not return an error for API failure")
+	}
+}
+
+func TestICanHazDadJokeInvalidJSON(t *testing.T) {
+	// Create a mock server that returns invalid JSON
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write([]byte(`{"id": "R7UfaahVfFd", "joke": "This is an invalid JSON`))
+		if err != nil {
+			t.Errorf("Error writing response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	// Call the Fetch function
+	_, err := newTestSource(server).Fetch(context.Background())
+
+	// Check if there was an error
+	if err == nil {
+		t.Errorf("Fetch() did not return an error for invalid JSON")
+	}
+}
+
+func TestICanHazDadJokeSearch(t *testing.T) {
+	pages := []string{
+		`{"results": [{"id": "a", "joke": "Pizza joke one"}, {"id": "b", "joke": "Pizza joke two"}], "total_pages": 2}`,
+		`{"results": [{"id": "c", "joke": "Pizza joke three"}], "total_pages": 2}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/search" || r.URL.Query().Get("term") != "pizza" {
+			t.Errorf("Unexpected request %s", r.URL)
+		}
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(pages[page-1]))
+	}))
+	defer server.Close()
+	src := newTestSource(server)
+	store := newTestStore(t)
+
+	jokes, err := src.Search(context.Background(), "pizza")
+	if err != nil {
+		t.Fatalf("Search() returned an error: %v", err)
+	}
+	if len(jokes) != 3 || jokes[2].UpstreamID != "c" {
+		t.Fatalf("Search() returned %+v, want the jokes from both pages", jokes)
+	}
+
+	// Only one of the matches has not been told yet
+	for _, j := range jokes[:2] {
+		if err := store.Save(context.Background(), &j); err != nil {
+			t.Fatalf("Save() returned an error: %v", err)
+		}
+	}
+	engine := NewEngine(store, src, NewStoreSource(store, ""))
+	j, err := engine.TellAbout(context.Background(), "pizza")
+	if err != nil {
+		t.Fatalf("TellAbout() returned an error: %v", err)
+	}
+	if j.Text != "Pizza joke three" || j.ToldAt == nil {
+		t.Errorf("TellAbout() returned %+v, want the untold joke", j)
+	}
+	if stored, _ := store.Get(context.Background(), j.ID); !slices.Equal(stored.Tags, []string{"pizza"}) {
+		t.Errorf("Joke told about pizza has tags %v, want it tagged with the term", stored.Tags)
+	}
+
+	if _, err := engine.TellAbout(context.Background(), "pizza"); !errors.Is(err, ErrNoJokes) {
+		t.Errorf("TellAbout() returned %v once all jokes were told, want ErrNoJokes", err)
+	}
+
+	// A match another process stores at the same time is left to it
+	racing := &racingStore{SQLiteStore: newTestStore(t)}
+	j, err = NewEngine(racing, src).TellAbout(context.Background(), "pizza")
+	if err != nil || j.ID == 0 || j.ToldAt == nil {
+		t.Errorf("TellAbout() while another process stores a match = %+v, %v, want another match told", j, err)
+	}
+}
+
+func TestICanHazDadJokeFetchID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/j/R7UfaahVfFd" {
+			// The API answers unknown IDs with a 404 status in the body
+			_, _ = w.Write([]byte(`{"message": "Joke with id \"x\" not found", "status": 404}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"id": "R7UfaahVfFd", "joke": "A joke by ID", "status": 200}`))
+	}))
+	defer server.Close()
+	store := newTestStore(t)
+	engine := NewEngine(store, newTestSource(server))
+
+	j, err := engine.TellByID(context.Background(), "R7UfaahVfFd")
+	if err != nil {
+		t.Fatalf("TellByID() returned an error: %v", err)
+	}
+	if j.Text != "A joke by ID" || j.UpstreamID != "R7UfaahVfFd" || j.ID == 0 {
+		t.Errorf("TellByID() returned %+v, want the stored joke", j)
+	}
+
+	stored, err := store.Get(context.Background(), j.ID)
+	if err != nil {
+		t.Fatalf("Get() returned an error: %v", err)
+	}
+	if stored.UpstreamID != "R7UfaahVfFd" || stored.ToldAt == nil {
+		t.Errorf("Get() returned %+v, want the told joke with its upstream ID", stored)
+	}
+
+	// Asking for a stored joke tells the stored one again
+	again, err := engine.TellByID(context.Background(), "R7UfaahVfFd")
+	if err != nil || again.ID != j.ID || again.TimesTold != 2 || again.ToldAt == nil {
+		t.Errorf("TellByID() of a stored joke = %+v, %v, want joke %d told twice", again, err, j.ID)
+	}
+	if stored, _ := store.Get(context.Background(), j.ID); stored.TimesTold != 2 {
+		t.Errorf("Get() after telling the joke again = %+v, want it told twice", stored)
+	}
+
+	// A joke another process stores at the same time is told as stored
+	racing := &racingStore{SQLiteStore: newTestStore(t)}
+	raced, err := NewEngine(racing, newTestSource(server)).TellByID(context.Background(), "R7UfaahVfFd")
+	if err != nil || raced.ID == 0 || raced.TimesTold != 1 || raced.ToldAt == nil {
+		t.Errorf("TellByID() while another process stores the joke = %+v, %v, want the stored joke told", raced, err)
+	}
+
+	if _, err := engine.TellByID(context.Background(), "x"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("TellByID() returned %v for an unknown ID, want ErrNotFound", err)
+	}
+	if _, err := store.Get(context.Background(), 999); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() returned %v for an unknown ID, want ErrNotFound", err)
+	}
+}
+
+func TestICanHazDadJokeImage(t *testing.T) {
+	png := "\x89PNG\r\n\x1a\nimage data"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/j/R7UfaahVfFd.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write([]byte(png))
+		case "/j/html.png":
+			_, _ = w.Write([]byte("<html>Oops</html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	src := newTestSource(server)
+	ctx := context.Background()
+
+	if img, err := src.Image(ctx, "R7UfaahVfFd"); err != nil || string(img) != png {
+		t.Errorf("Image() = %q, %v, want the PNG image", img, err)
+	}
+	if _, err := src.Image(ctx, "html"); err == nil {
+		t.Error("Image() of something else than a PNG image returned no error")
+	}
+	if _, err := src.Image(ctx, "x"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Image() of an unknown ID returned %v, want ErrNotFound", err)
+	}
+}
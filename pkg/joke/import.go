@@ -0,0 +1,316 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// DefaultImportBatch is how many jokes Import stores per transaction
+const DefaultImportBatch = 500
+
+// ImportFormats lists the formats ReadJokes understands
+var ImportFormats = []string{"json", "csv", "txt", "fortune"}
+
+// ReadJokes reads a joke collection in one of the ImportFormats:
+//
+//   - json: a list of jokes as texts or objects, like joke files and the
+//     output of WriteJokes, which may also name the upstream_id,
+//     language, source, rating and tags
+//   - csv: a header naming the columns, of which joke or text, or setup and
+//     punchline, are required and lang, tags, source, upstream_id and
+//     rating optional
+//   - txt: one joke per line, skipping comments starting with #
+//   - fortune: jokes separated by lines holding just %, as read by fortune(6)
+func ReadJokes(r io.Reader, format string) ([]Joke, error) {
+	switch format {
+	case "json":
+		return readJSONJokes(r)
+	case "csv":
+		return readCSVJokes(r)
+	case "txt":
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("error reading jokes: %w", err)
+		}
+		return jokeLines(data), nil
+	case "fortune":
+		return readFortunes(r)
+	default:
+		return nil, fmt.Errorf("unknown format %q, use %s", format, strings.Join(ImportFormats, ", "))
+	}
+}
+
+// readJSONJokes reads a JSON list of jokes
+func readJSONJokes(r io.Reader) ([]Joke, error) {
+	var items []any
+	if err := json.NewDecoder(r).Decode(&items); err != nil {
+		return nil, fmt.Errorf("error parsing JSON: %w", err)
+	}
+	jokes := make([]Joke, 0, len(items))
+	for i, item := range items {
+		j, err := jokeFromItem(item)
+		if err != nil {
+			return nil, fmt.Errorf("joke %d: %w", i+1, err)
+		}
+		// Objects may carry more of the joke than joke files do
+		if m, ok := item.(map[string]any); ok {
+			// Exports have the local ID in id, which means nothing here
+			if _, ok := m["fetched_at"]; ok {
+				j.UpstreamID = ""
+			}
+			if _, ok := m["upstream_id"]; ok {
+				j.UpstreamID = stringField(m, "upstream_id")
+			}
+			if lang := stringField(m, "language"); lang != "" {
+				j.Language = lang
+			}
+			j.Source = stringField(m, "source")
+			if rating, ok := m["rating"].(float64); ok {
+				j.Rating = int(rating)
+			}
+			if tags, ok := m["tags"].([]any); ok {
+				for _, tag := range tags {
+					j.Tags = append(j.Tags, fmt.Sprint(tag))
+				}
+			}
+		}
+		jokes = append(jokes, j)
+	}
+	return jokes, nil
+}
+
+// stringField returns the value of key in m as a trimmed string, or ""
+func stringField(m map[string]any, key string) string {
+	if v, ok := m[key]; ok && v != nil {
+		return strings.TrimSpace(fmt.Sprint(v))
+	}
+	return ""
+}
+
+// readCSVJokes reads jokes from CSV with a header
+func readCSVJokes(r io.Reader) ([]Joke, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	field := func(record []string, names ...string) string {
+		for _, name := range names {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+		}
+		return ""
+	}
+	_, hasJoke := columns["joke"]
+	_, hasText := columns["text"]
+	_, hasSetup := columns["setup"]
+	if !hasJoke && !hasText && !hasSetup {
+		return nil, errors.New("CSV header names no joke, text or setup column")
+	}
+
+	var jokes []Joke
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return jokes, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error parsing CSV: %w", err)
+		}
+		j := Joke{
+			Text:       field(record, "joke", "text"),
+			Language:   field(record, "lang", "language"),
+			Source:     field(record, "source"),
+			UpstreamID: field(record, "upstream_id"),
+		}
+		if setup, punchline := field(record, "setup"), field(record, "punchline"); j.Text == "" && setup != "" && punchline != "" {
+			j.Text = twoPart(setup, punchline)
+		}
+		if j.Text == "" {
+			return nil, fmt.Errorf("line %d: no joke", line)
+		}
+		if rating := field(record, "rating"); rating != "" {
+			if j.Rating, err = strconv.Atoi(rating); err != nil {
+				return nil, fmt.Errorf("line %d: invalid rating %q", line, rating)
+			}
+		}
+		for _, tag := range strings.Split(field(record, "tags"), ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				j.Tags = append(j.Tags, tag)
+			}
+		}
+		jokes = append(jokes, j)
+	}
+}
+
+// readFortunes reads jokes in the format of fortune(6)
+func readFortunes(r io.Reader) ([]Joke, error) {
+	var (
+		jokes []Joke
+		lines []string
+	)
+	flush := func() {
+		if text := strings.TrimSpace(strings.Join(lines, "\n")); text != "" {
+			jokes = append(jokes, Joke{Text: text})
+		}
+		lines = nil
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "%" {
+			flush()
+			continue
+		}
+		lines = append(lines, line)
+	}
+	flush()
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading fortunes: %w", err)
+	}
+	return jokes, nil
+}
+
+// ImportResult counts the outcome of an import
+type ImportResult struct {
+	// Imported is how many jokes were stored, or would have been in a dry
+	// run
+	Imported int
+	// Duplicates is how many jokes were stored already or came up twice
+	Duplicates int
+}
+
+// ImportStore is a Store that can store many jokes at once
+type ImportStore interface {
+	Store
+	// Import stores the jokes that aren't stored yet, untold, batch jokes
+	// at a time. progress, if not nil, is called after every batch with
+	// the number of jokes processed so far. A dry run only counts what
+	// would be stored.
+	Import(ctx context.Context, jokes []Joke, batch int, dryRun bool, progress func(done int)) (ImportResult, error)
+}
+
+// Import implements ImportStore, with a transaction per batch
+func (s *SQLiteStore) Import(ctx context.Context, jokes []Joke, batch int, dryRun bool, progress func(done int)) (ImportResult, error) {
+	save := s.saveBatch
+	if dryRun {
+		save = s.countNew
+	}
+	return importJokes(jokes, batch, progress, func(fresh []Joke) (int, error) {
+		return save(ctx, fresh)
+	})
+}
+
+// importJokes hands the jokes to save batch jokes at a time, leaving out
+// those that came up earlier in jokes, and counts the jokes save reports
+// as stored
+func importJokes(jokes []Joke, batch int, progress func(done int), save func(fresh []Joke) (int, error)) (ImportResult, error) {
+	var res ImportResult
+	batch = max(batch, 1)
+	seen := make(map[string]bool, len(jokes))
+	for start := 0; start < len(jokes); start += batch {
+		end := min(start+batch, len(jokes))
+		var fresh []Joke
+		for _, j := range jokes[start:end] {
+			hash := textHash(j.Text)
+			if seen[hash] {
+				res.Duplicates++
+				continue
+			}
+			seen[hash] = true
+			fresh = append(fresh, j)
+		}
+
+		n, err := save(fresh)
+		if err != nil {
+			return res, err
+		}
+		res.Imported += n
+		res.Duplicates += len(fresh) - n
+		if progress != nil {
+			progress(end)
+		}
+	}
+	return res, nil
+}
+
+// countNew returns how many of jokes are not stored yet
+func (s *SQLiteStore) countNew(ctx context.Context, jokes []Joke) (int, error) {
+	n := 0
+	for _, j := range jokes {
+		exists, err := s.Exists(ctx, j)
+		if err != nil {
+			return n, fmt.Errorf("error checking joke existence: %w", err)
+		}
+		if !exists {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// saveBatch stores the jokes that aren't stored yet in a single
+// transaction and returns how many were stored
+func (s *SQLiteStore) saveBatch(ctx context.Context, jokes []Joke) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error importing jokes: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stored := 0
+	for _, j := range jokes {
+		var rating any
+		if j.Rating >= MinRating && j.Rating <= MaxRating {
+			rating = j.Rating
+		}
+		res, err := tx.ExecContext(ctx, `INSERT INTO jokes (joke, hash, upstream_id, source, language, rating)
+			SELECT ?, ?, ?, ?, ?, ? WHERE NOT EXISTS (SELECT 1 FROM jokes WHERE upstream_id != '' AND upstream_id = ? AND source = ?)
+			ON CONFLICT (hash) DO NOTHING`,
+			j.Text, textHash(j.Text), j.UpstreamID, j.Source, j.Language, rating, j.UpstreamID, j.Source)
+		if err != nil {
+			return 0, fmt.Errorf("error importing joke: %w", err)
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			continue
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return 0, fmt.Errorf("error importing joke: %w", err)
+		}
+		for _, tag := range j.Tags {
+			if tag = NormalizeTag(tag); tag == "" {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO tags (name) VALUES (?)", tag); err != nil {
+				return 0, fmt.Errorf("error tagging joke: %w", err)
+			}
+			if _, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO joke_tags (joke_id, tag_id) SELECT ?, id FROM tags WHERE name = ?", id, tag); err != nil {
+				return 0, fmt.Errorf("error tagging joke: %w", err)
+			}
+		}
+		stored++
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error importing jokes: %w", err)
+	}
+	return stored, nil
+}
+
+var _ ImportStore = (*SQLiteStore)(nil)
@@ -0,0 +1,112 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadJokes(t *testing.T) {
+	tests := []struct {
+		format string
+		input  string
+		want   []Joke
+	}{
+		{
+			format: "json",
+			input:  `["First joke", {"setup": "Setup?", "punchline": "Punchline.", "lang": "en"}, {"joke": "Third joke", "upstream_id": "u3", "language": "de", "source": "witze", "rating": 4, "tags": ["tiere"]}]`,
+			want: []Joke{
+				{Text: "First joke"},
+				{Text: "Setup?\nPunchline.", Language: "en"},
+				{Text: "Third joke", UpstreamID: "u3", Language: "de", Source: "witze", Rating: 4, Tags: []string{"tiere"}},
+			},
+		},
+		{
+			format: "csv",
+			input:  "Setup,Punchline,Lang,Tags\nSetup?,Punchline.,en,\"puns, animals\"\n",
+			want:   []Joke{{Text: "Setup?\nPunchline.", Language: "en", Tags: []string{"puns", "animals"}}},
+		},
+		{
+			format: "txt",
+			input:  "# comment\nFirst joke\n\nSecond joke\n",
+			want:   []Joke{{Text: "First joke"}, {Text: "Second joke"}},
+		},
+		{
+			format: "fortune",
+			input:  "First joke\n%\nWhat's the setup?\n  -- The punchline.\n%\n%\n",
+			want:   []Joke{{Text: "First joke"}, {Text: "What's the setup?\n  -- The punchline."}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			jokes, err := ReadJokes(strings.NewReader(tt.input), tt.format)
+			if err != nil {
+				t.Fatalf("ReadJokes() returned an error: %v", err)
+			}
+			if !reflect.DeepEqual(jokes, tt.want) {
+				t.Errorf("ReadJokes() = %+v, want %+v", jokes, tt.want)
+			}
+		})
+	}
+
+	if _, err := ReadJokes(strings.NewReader("id,lang\n1,en\n"), "csv"); err == nil {
+		t.Error("ReadJokes() of CSV without a joke column returned no error")
+	}
+	if _, err := ReadJokes(strings.NewReader(""), "yaml"); err == nil {
+		t.Error("ReadJokes() in an unknown format returned no error")
+	}
+}
+
+func TestSQLiteImport(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	stored := Joke{Text: "Stored joke", Source: "icanhazdadjoke", UpstreamID: "abc", Language: "en"}
+	if err := store.Save(ctx, &stored); err != nil {
+		t.Fatal(err)
+	}
+
+	jokes := []Joke{
+		{Text: "First joke", Source: "import", Language: "en", Tags: []string{"Imported"}},
+		{Text: "stored joke!", Source: "import", Language: "en"},
+		{Text: "Second joke", Source: "import", Language: "en"},
+		{Text: "First joke.", Source: "import", Language: "en"},
+		{Text: "Reworded joke", Source: "icanhazdadjoke", UpstreamID: "abc", Language: "en"},
+	}
+	var done []int
+	res, err := store.Import(ctx, jokes, 2, true, func(n int) { done = append(done, n) })
+	if err != nil {
+		t.Fatalf("Import() dry run returned an error: %v", err)
+	}
+	if want := (ImportResult{Imported: 2, Duplicates: 3}); res != want {
+		t.Errorf("Import() dry run = %+v, want %+v", res, want)
+	}
+	if want := []int{2, 4, 5}; !reflect.DeepEqual(done, want) {
+		t.Errorf("Import() reported progress %v, want %v", done, want)
+	}
+	if _, err := store.Find(ctx, Joke{Text: "First joke"}); err == nil {
+		t.Error("Import() dry run stored a joke")
+	}
+
+	res, err = store.Import(ctx, jokes, 2, false, nil)
+	if err != nil {
+		t.Fatalf("Import() returned an error: %v", err)
+	}
+	if want := (ImportResult{Imported: 2, Duplicates: 3}); res != want {
+		t.Errorf("Import() = %+v, want %+v", res, want)
+	}
+	first, err := store.Find(ctx, Joke{Text: "First joke"})
+	if err != nil {
+		t.Fatalf("Find() of an imported joke returned an error: %v", err)
+	}
+	if first, _ = store.Get(ctx, first.ID); first.Source != "import" || !reflect.DeepEqual(first.Tags, []string{"imported"}) {
+		t.Errorf("imported joke is %+v, want it from import with its tag", first)
+	}
+
+	if res, _ := store.Import(ctx, jokes, 10, false, nil); res.Imported != 0 {
+		t.Errorf("Import() again imported %d jokes, want 0", res.Imported)
+	}
+}
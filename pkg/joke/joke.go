@@ -0,0 +1,201 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+// Package joke contains the godad joke engine: fetching jokes from a
+// Source, de-duplicating them against a Store and remembering what has
+// already been told. It can be embedded in other Go programs without
+// shelling out to the godad binary.
+package joke
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ErrNoJokes is returned by a Store when it does not hold any jokes
+var ErrNoJokes = errors.New("no jokes in store")
+
+// ErrNotFound is returned when a joke asked for does not exist
+var ErrNotFound = errors.New("joke not found")
+
+// ErrDuplicate is returned when saving a joke that is stored already
+var ErrDuplicate = errors.New("joke is stored already")
+
+// MinRating and MaxRating are the bounds of a joke's rating
+const (
+	MinRating = 1
+	MaxRating = 5
+)
+
+// ErrInvalidRating is returned when rating a joke outside of MinRating and
+// MaxRating
+var ErrInvalidRating = fmt.Errorf("rating must be between %d and %d", MinRating, MaxRating)
+
+// Joke is a single joke along with its bookkeeping data
+type Joke struct {
+	// ID is the local identifier assigned by the Store
+	ID int64 `json:"id"`
+	// Text is the joke itself. Jokes that come as a setup and a punchline
+	// have them on lines of their own.
+	Text string `json:"joke"`
+	// UpstreamID is the identifier the source uses for the joke, if any
+	UpstreamID string `json:"upstream_id,omitempty"`
+	// Source is the name of the source the joke came from
+	Source string `json:"source"`
+	// Language is the ISO 639-1 code of the joke's language
+	Language string `json:"language"`
+	// CreatedAt is when the joke was fetched and first stored
+	CreatedAt time.Time `json:"fetched_at"`
+	// ToldAt is when the joke was last told, or nil for prefetched jokes
+	// that have not been told yet
+	ToldAt *time.Time `json:"told_at,omitempty"`
+	// TimesTold counts how often the joke has been told
+	TimesTold int `json:"times_told"`
+	// Rating is the user's rating from MinRating to MaxRating, or 0 if
+	// the joke has not been rated
+	Rating int `json:"rating,omitempty"`
+	// Tags are the user-defined or automatic tags of the joke. They are
+	// only filled in by Store.Get.
+	Tags []string `json:"tags,omitempty"`
+}
+
+// twoPart returns the text of a joke with a separate setup and punchline
+func twoPart(setup, punchline string) string {
+	return strings.TrimSpace(setup) + "\n" + strings.TrimSpace(punchline)
+}
+
+// SplitJoke splits a joke into its setup and its punchline. Jokes from
+// sources that keep them apart have the punchline on its own line; other
+// jokes are split after the first question mark. Jokes without a question
+// mark followed by more text are all setup.
+func SplitJoke(text string) (setup, punchline string) {
+	if setup, punchline, ok := strings.Cut(text, "\n"); ok {
+		return strings.TrimSpace(setup), strings.TrimSpace(punchline)
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] != '?' {
+			continue
+		}
+		// Keep closing quotes with the question
+		end := i + 1
+		for end < len(text) && strings.ContainsRune(`"')`, rune(text[end])) {
+			end++
+		}
+		if end == len(text) || !unicode.IsSpace(rune(text[end])) {
+			continue
+		}
+		if rest := strings.TrimSpace(text[end:]); rest != "" {
+			return text[:end], rest
+		}
+	}
+	return text, ""
+}
+
+// HistoryFilter narrows down the jokes returned by Store.History. Zero
+// values don't filter.
+type HistoryFilter struct {
+	// Language only returns jokes in this language
+	Language string
+	// Source only returns jokes from this source
+	Source string
+	// Tag only returns jokes with this tag
+	Tag string
+	// Since only returns jokes told at or after this time
+	Since time.Time
+	// MinRating only returns jokes rated at least this high, like the
+	// favorites
+	MinRating int
+	// Limit caps the number of jokes returned
+	Limit int
+	// Offset skips this many jokes, for paging through the history
+	Offset int
+}
+
+// Source is something that can produce jokes, usually a remote API. Its
+// methods must be safe for concurrent use, as Prefetch and TellMany fetch
+// from several goroutines at once.
+type Source interface {
+	// Name returns a short, unique identifier for the source
+	Name() string
+	// Language returns the ISO 639-1 code of the jokes the source provides
+	Language() string
+	// Fetch returns a single joke from the source
+	Fetch(ctx context.Context) (Joke, error)
+}
+
+// SearchSource is implemented by sources that can find jokes about a topic
+type SearchSource interface {
+	Source
+	// Search returns the jokes matching term
+	Search(ctx context.Context, term string) ([]Joke, error)
+}
+
+// IDSource is implemented by sources that can fetch a joke by its
+// upstream ID
+type IDSource interface {
+	Source
+	// FetchID returns the joke with the given upstream ID, or ErrNotFound
+	FetchID(ctx context.Context, id string) (Joke, error)
+}
+
+// ListSource is implemented by sources holding a fixed collection of
+// jokes. The engine picks a random joke from the list that has not been
+// told yet, instead of calling Fetch until it gets one.
+type ListSource interface {
+	Source
+	// List returns every joke of the source
+	List(ctx context.Context) ([]Joke, error)
+}
+
+// BatchSource is implemented by sources that can fetch several jokes with
+// a single request
+type BatchSource interface {
+	Source
+	// FetchBatch returns up to n jokes
+	FetchBatch(ctx context.Context, n int) ([]Joke, error)
+}
+
+// Store persists jokes that have been told or prefetched
+type Store interface {
+	// Exists reports whether the joke has been stored before
+	Exists(ctx context.Context, j Joke) (bool, error)
+	// Save stores a joke and its tags and sets its ID and CreatedAt
+	// fields. Jokes without a ToldAt time are kept for later.
+	Save(ctx context.Context, j *Joke) error
+	// NextUntold returns the oldest stored joke in lang that has not been
+	// told yet, or ErrNoJokes if there are none
+	NextUntold(ctx context.Context, lang string) (Joke, error)
+	// MarkTold records that the joke has been told again now
+	MarkTold(ctx context.Context, j *Joke) error
+	// Find returns the stored joke that j duplicates, or ErrNotFound
+	Find(ctx context.Context, j Joke) (Joke, error)
+	// LeastRecentlyTold returns the joke in lang that was told longest
+	// ago, if that was before the given time, or ErrNoJokes
+	LeastRecentlyTold(ctx context.Context, lang string, before time.Time) (Joke, error)
+	// Get returns the stored joke with the given ID including its tags,
+	// or ErrNotFound
+	Get(ctx context.Context, id int64) (Joke, error)
+	// Rate sets the rating of the stored joke with the given ID
+	Rate(ctx context.Context, id int64, rating int) error
+	// Random returns a random stored joke, or ErrNoJokes if there are
+	// none. Higher rated jokes are more likely to be picked.
+	Random(ctx context.Context) (Joke, error)
+	// RandomIn is like Random, but only picks jokes in lang
+	RandomIn(ctx context.Context, lang string) (Joke, error)
+	// RandomTagged is like Random, but only picks jokes with the tag
+	RandomTagged(ctx context.Context, tag string) (Joke, error)
+	// AddTags tags the stored joke with the given ID
+	AddTags(ctx context.Context, id int64, tags ...string) error
+	// RemoveTags removes tags from the stored joke with the given ID
+	RemoveTags(ctx context.Context, id int64, tags ...string) error
+	// Tags returns every tag in use, sorted by name
+	Tags(ctx context.Context) ([]TagCount, error)
+	// History returns the told jokes matching the filter, most recent first
+	History(ctx context.Context, f HistoryFilter) ([]Joke, error)
+	// Close releases any resources held by the store
+	Close() error
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import "testing"
+
+func TestSplitJoke(t *testing.T) {
+	testCases := []struct {
+		text, setup, punchline string
+	}{
+		{
+			text:      "Why did the scarecrow win an award? He was outstanding in his field.",
+			setup:     "Why did the scarecrow win an award?",
+			punchline: "He was outstanding in his field.",
+		},
+		{
+			text:      `He asked "Are you a pun?" I said "Only on weekdays."`,
+			setup:     `He asked "Are you a pun?"`,
+			punchline: `I said "Only on weekdays."`,
+		},
+		{
+			text:  "I'm reading a book about anti-gravity. It's impossible to put down.",
+			setup: "I'm reading a book about anti-gravity. It's impossible to put down.",
+		},
+		{
+			text:      "What do you call a fake noodle? It's an impasta.\nOr a fake pasta.",
+			setup:     "What do you call a fake noodle? It's an impasta.",
+			punchline: "Or a fake pasta.",
+		},
+		{
+			text:  "Did you hear about the kidnapping at school?",
+			setup: "Did you hear about the kidnapping at school?",
+		},
+	}
+	for _, tc := range testCases {
+		setup, punchline := SplitJoke(tc.text)
+		if setup != tc.setup || punchline != tc.punchline {
+			t.Errorf("SplitJoke(%q) = %q, %q, want %q, %q", tc.text, setup, punchline, tc.setup, tc.punchline)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// JokeAPIURL is the default endpoint of sv443's JokeAPI
+const JokeAPIURL = "https://v2.jokeapi.dev/"
+
+// jokeAPIMaxAmount is the most jokes JokeAPI returns per request
+const jokeAPIMaxAmount = 10
+
+// JokeAPILanguages lists the languages JokeAPI has jokes in
+var JokeAPILanguages = []string{"cs", "de", "en", "es", "fr", "pt"}
+
+// JokeAPIFlags lists the flags JokeAPI marks jokes with. Jokes with a
+// blacklisted flag are never fetched.
+var JokeAPIFlags = []string{"nsfw", "religious", "political", "racist", "sexist", "explicit"}
+
+// JokeAPI fetches jokes in one language from sv443's JokeAPI
+type JokeAPI struct {
+	URL    string
+	Client *http.Client
+	// Blacklist lists the flags, from JokeAPIFlags, of jokes that should
+	// never be fetched
+	Blacklist []string
+	// SafeMode only fetches jokes JokeAPI deems safe for everyone, which
+	// also leaves out its dark humor
+	SafeMode bool
+	lang     string
+}
+
+// NewJokeAPI returns a source for jokes in lang from the public JokeAPI.
+// Jokes with any of the JokeAPIFlags are blacklisted.
+func NewJokeAPI(lang string) *JokeAPI {
+	return &JokeAPI{
+		URL:       JokeAPIURL,
+		Client:    DefaultHTTPClient,
+		Blacklist: slices.Clone(JokeAPIFlags),
+		lang:      normalizeLanguage(lang),
+	}
+}
+
+// Name implements Source. Every language is a source of its own, as JokeAPI
+// numbers the jokes of each language separately.
+func (s *JokeAPI) Name() string {
+	return "jokeapi-" + s.lang
+}
+
+// Language implements Source
+func (s *JokeAPI) Language() string {
+	return s.lang
+}
+
+// jokeAPIJoke is a joke as returned by JokeAPI. Two part jokes have a setup
+// and a delivery instead of the joke.
+type jokeAPIJoke struct {
+	ID       int    `json:"id"`
+	Type     string `json:"type"`
+	Joke     string `json:"joke"`
+	Setup    string `json:"setup"`
+	Delivery string `json:"delivery"`
+}
+
+// jokeAPIResponse is a response from JokeAPI holding a single joke, a list
+// of jokes when more than one was asked for, or an error
+type jokeAPIResponse struct {
+	jokeAPIJoke
+	Jokes          []jokeAPIJoke `json:"jokes"`
+	Error          bool          `json:"error"`
+	Code           int           `json:"code"`
+	Message        string        `json:"message"`
+	AdditionalInfo string        `json:"additionalInfo"`
+}
+
+// jokeAPINoMatch is the error code for requests no joke matches
+const jokeAPINoMatch = 106
+
+// Fetch implements Source
+func (s *JokeAPI) Fetch(ctx context.Context) (Joke, error) {
+	jokes, err := s.FetchBatch(ctx, 1)
+	if err != nil {
+		return Joke{}, err
+	}
+	return jokes[0], nil
+}
+
+// FetchBatch implements BatchSource. JokeAPI returns up to 10 jokes per
+// request.
+func (s *JokeAPI) FetchBatch(ctx context.Context, n int) ([]Joke, error) {
+	query := url.Values{}
+	if n = min(max(n, 1), jokeAPIMaxAmount); n > 1 {
+		query.Set("amount", strconv.Itoa(n))
+	}
+	return s.get(ctx, query)
+}
+
+// FetchID implements IDSource
+func (s *JokeAPI) FetchID(ctx context.Context, id string) (Joke, error) {
+	if _, err := strconv.Atoi(id); err != nil {
+		return Joke{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	query := url.Values{}
+	query.Set("idRange", id)
+	jokes, err := s.get(ctx, query)
+	if err != nil {
+		return Joke{}, err
+	}
+	return jokes[0], nil
+}
+
+// Search implements SearchSource. It returns up to 10 jokes containing term.
+func (s *JokeAPI) Search(ctx context.Context, term string) ([]Joke, error) {
+	query := url.Values{}
+	query.Set("contains", term)
+	query.Set("amount", strconv.Itoa(jokeAPIMaxAmount))
+	jokes, err := s.get(ctx, query)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	return jokes, err
+}
+
+// get requests jokes of any category matching query and converts them.
+// ErrNotFound is returned when no joke matches.
+func (s *JokeAPI) get(ctx context.Context, query url.Values) ([]Joke, error) {
+	endpoint, err := url.JoinPath(s.URL, "joke", "Any")
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	query.Set("lang", s.lang)
+	if len(s.Blacklist) > 0 {
+		query.Set("blacklistFlags", strings.Join(s.Blacklist, ","))
+	}
+	if s.SafeMode {
+		query.Set("safe-mode", "")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+
+	var r jokeAPIResponse
+	if jsonErr := json.Unmarshal(body, &r); jsonErr == nil && r.Error {
+		if r.Code == jokeAPINoMatch {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, r.AdditionalInfo)
+		}
+		if err := checkStatus(resp); err != nil {
+			return nil, fmt.Errorf("%w: %s", err, r.Message)
+		}
+		return nil, fmt.Errorf("JokeAPI error: %s", r.Message)
+	}
+	if err := checkStatus(resp); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(body, &r); err != nil {
+		return nil, fmt.Errorf("error parsing JSON: %w", err)
+	}
+
+	if len(r.Jokes) == 0 {
+		r.Jokes = []jokeAPIJoke{r.jokeAPIJoke}
+	}
+	jokes := make([]Joke, 0, len(r.Jokes))
+	for _, j := range r.Jokes {
+		if j.Type == "twopart" {
+			j.Joke = twoPart(j.Setup, j.Delivery)
+		}
+		if j.Joke = strings.TrimSpace(j.Joke); j.Joke == "" {
+			continue
+		}
+		jokes = append(jokes, Joke{
+			Text:       j.Joke,
+			UpstreamID: strconv.Itoa(j.ID),
+			Source:     s.Name(),
+			Language:   s.lang,
+		})
+	}
+	if len(jokes) == 0 {
+		return nil, errors.New("JokeAPI returned no jokes")
+	}
+	return jokes, nil
+}
+
+var (
+	_ BatchSource  = (*JokeAPI)(nil)
+	_ IDSource     = (*JokeAPI)(nil)
+	_ SearchSource = (*JokeAPI)(nil)
+)
@@ -0,0 +1,119 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// newTestJokeAPI returns a JokeAPI source for lang pointing at server
+func newTestJokeAPI(server *httptest.Server, lang string) *JokeAPI {
+	src := NewJokeAPI(lang)
+	src.URL = server.URL
+	return src
+}
+
+func TestJokeAPIFetch(t *testing.T) {
+	safeMode := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		safeMode = query.Has("safe-mode")
+		if r.URL.Path != "/joke/Any" || query.Get("lang") != "de" {
+			t.Errorf("Unexpected request %s", r.URL)
+		}
+		if got := query.Get("blacklistFlags"); got != "nsfw,religious,political,racist,sexist,explicit" {
+			t.Errorf("blacklistFlags = %q, want every flag", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"error": false, "type": "twopart", "setup": "Was ist grün und klopft?", "delivery": "Ein Klopfsalat.", "id": 7, "lang": "de"}`))
+	}))
+	defer server.Close()
+
+	src := newTestJokeAPI(server, "DE")
+	j, err := src.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch() returned an error: %v", err)
+	}
+	want := Joke{Text: "Was ist grün und klopft?\nEin Klopfsalat.", UpstreamID: "7", Source: "jokeapi-de", Language: "de"}
+	if !reflect.DeepEqual(j, want) {
+		t.Errorf("Fetch() = %+v, want %+v", j, want)
+	}
+	if safeMode {
+		t.Error("safe-mode sent without SafeMode")
+	}
+
+	src.SafeMode = true
+	if _, err := src.Fetch(context.Background()); err != nil {
+		t.Fatalf("Fetch() in safe mode returned an error: %v", err)
+	}
+	if !safeMode {
+		t.Error("safe-mode not sent with SafeMode")
+	}
+}
+
+func TestJokeAPIFetchBatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("amount"); got != "10" {
+			t.Errorf("amount = %q, want the maximum of 10", got)
+		}
+		if r.URL.Query().Has("blacklistFlags") {
+			t.Errorf("blacklistFlags sent with an empty blacklist")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"error": false, "amount": 2, "jokes": [
+			{"type": "single", "joke": "A single joke.", "id": 1},
+			{"type": "twopart", "setup": "Setup?", "delivery": "Delivery.", "id": 2}
+		]}`))
+	}))
+	defer server.Close()
+	src := newTestJokeAPI(server, "en")
+	src.Blacklist = nil
+
+	jokes, err := src.FetchBatch(context.Background(), 25)
+	if err != nil {
+		t.Fatalf("FetchBatch() returned an error: %v", err)
+	}
+	if len(jokes) != 2 || jokes[0].Text != "A single joke." || jokes[1].Text != "Setup?\nDelivery." {
+		t.Errorf("FetchBatch() = %+v, want both jokes", jokes)
+	}
+}
+
+func TestJokeAPIErrors(t *testing.T) {
+	testCases := []struct {
+		name     string
+		status   int
+		body     string
+		notFound bool
+	}{
+		{name: "NoMatch", status: http.StatusBadRequest, body: `{"error": true, "code": 106, "message": "No matching joke found", "additionalInfo": "No jokes were found that match your provided filter(s)."}`, notFound: true},
+		{name: "RateLimited", status: http.StatusTooManyRequests, body: `{"error": true, "code": 101, "message": "Too many requests"}`},
+		{name: "ServerError", status: http.StatusInternalServerError, body: `Internal Server Error`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+
+			_, err := newTestJokeAPI(server, "en").FetchID(context.Background(), "99999")
+			if err == nil {
+				t.Fatalf("FetchID() did not return an error")
+			}
+			if errors.Is(err, ErrNotFound) != tc.notFound {
+				t.Errorf("FetchID() returned %v, want ErrNotFound: %v", err, tc.notFound)
+			}
+			if !tc.notFound && !IsRetryable(err) {
+				t.Errorf("FetchID() returned %v, want a retryable error", err)
+			}
+		})
+	}
+}
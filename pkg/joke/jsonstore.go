@@ -0,0 +1,854 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jsonStoreVersion is the version of the file format JSONStore writes
+const jsonStoreVersion = 1
+
+// errNotClaimed stops a claim of a joke that was told in the meantime
+var errNotClaimed = errors.New("joke was told in the meantime")
+
+// JSONStore is a Store keeping jokes in a single JSON file, for where a
+// SQLite database is unwelcome. The jokes are held in memory and the file
+// is rewritten on every change, which suits collections of a few thousand
+// jokes. Changes by other processes are picked up before each operation,
+// and processes take turns changing the store by locking a file next to
+// it.
+type JSONStore struct {
+	path string
+
+	mu   sync.Mutex
+	data jsonStoreData
+	// hashes maps the text hashes of the jokes to their index in data
+	hashes map[string]int
+	// modTime and size tell whether the file changed since it was read
+	modTime time.Time
+	size    int64
+}
+
+// jsonStoreData is the content of the file of a JSONStore
+type jsonStoreData struct {
+	Version     int          `json:"version"`
+	NextID      int64        `json:"next_id"`
+	Jokes       []Joke       `json:"jokes"`
+	Submissions []Submission `json:"submissions,omitempty"`
+	QuizAnswers []QuizAnswer `json:"quiz_answers,omitempty"`
+	Tellings    []Telling    `json:"tellings,omitempty"`
+	APIKeys     []APIKey     `json:"api_keys,omitempty"`
+}
+
+// OpenJSONStore opens the JSON store at path. The file is created with
+// the first joke stored.
+func OpenJSONStore(path string) (*JSONStore, error) {
+	s := &JSONStore{path: path}
+	s.setData(jsonStoreData{Version: jsonStoreVersion, NextID: 1})
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads the file if it changed since it was last read or written
+func (s *JSONStore) load() error {
+	info, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error opening %s: %w", s.path, err)
+	}
+	if info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return nil
+	}
+
+	b, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", s.path, err)
+	}
+	var data jsonStoreData
+	if err := json.Unmarshal(b, &data); err != nil {
+		return fmt.Errorf("error reading %s: %w", s.path, err)
+	}
+	if data.Version > jsonStoreVersion {
+		return fmt.Errorf("%s was written by a newer version of godad (format %d, this version reads up to %d)", s.path, data.Version, jsonStoreVersion)
+	}
+	if len(data.Tellings) == 0 {
+		// Written before tellings were kept, so the jokes told so far
+		// count once, when they were last told
+		for _, j := range data.Jokes {
+			if j.ToldAt != nil {
+				data.Tellings = append(data.Tellings, newTelling(j, *j.ToldAt))
+			}
+		}
+		slices.SortStableFunc(data.Tellings, func(a, b Telling) int { return a.ToldAt.Compare(b.ToldAt) })
+	}
+	s.setData(data)
+	s.modTime, s.size = info.ModTime(), info.Size()
+	return nil
+}
+
+// setData replaces the jokes held in memory and indexes them
+func (s *JSONStore) setData(data jsonStoreData) {
+	s.data = data
+	s.hashes = make(map[string]int, len(data.Jokes))
+	for i, j := range data.Jokes {
+		s.hashes[textHash(j.Text)] = i
+	}
+}
+
+// read calls f with the current jokes
+func (s *JSONStore) read(f func(d *jsonStoreData) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	return f(&s.data)
+}
+
+// update calls f with a copy of the current jokes to change, and writes
+// the copy to the file unless f fails. f must replace the jokes it
+// changes, not change them in place, as their fields are shared with the
+// jokes held so far.
+func (s *JSONStore) update(f func(d *jsonStoreData) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	unlock, err := LockFile(context.Background(), s.path+".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+
+	data := s.data
+	data.Jokes = slices.Clone(data.Jokes)
+	data.Submissions = slices.Clone(data.Submissions)
+	if err := f(&data); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error writing %s: %w", s.path, err)
+	}
+	// Write to a temporary file first, so a crash can't leave half a file
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("error writing %s: %w", s.path, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing %s: %w", s.path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing %s: %w", s.path, err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("error writing %s: %w", s.path, err)
+	}
+
+	s.setData(data)
+	if info, err := os.Stat(s.path); err == nil {
+		s.modTime, s.size = info.ModTime(), info.Size()
+	}
+	return nil
+}
+
+// index returns the index of the joke with the given ID in d.Jokes, which
+// are sorted by ID, or -1
+func (d *jsonStoreData) index(id int64) int {
+	i, ok := slices.BinarySearchFunc(d.Jokes, id, func(j Joke, id int64) int {
+		return int(j.ID - id)
+	})
+	if !ok {
+		return -1
+	}
+	return i
+}
+
+// find returns the index of the first joke that j duplicates, or -1. Jokes
+// added by the update in progress are only matched on their upstream ID.
+func (s *JSONStore) find(d *jsonStoreData, j Joke) int {
+	found := -1
+	if i, ok := s.hashes[textHash(j.Text)]; ok {
+		found = i
+	}
+	if j.UpstreamID == "" {
+		return found
+	}
+	// A joke with the same upstream ID may be older than the one with the
+	// same text
+	end := len(d.Jokes)
+	if found >= 0 {
+		end = found
+	}
+	if i := slices.IndexFunc(d.Jokes[:end], func(stored Joke) bool {
+		return stored.UpstreamID == j.UpstreamID && stored.Source == j.Source
+	}); i >= 0 {
+		return i
+	}
+	return found
+}
+
+// add stores j as a new joke and sets its ID and CreatedAt fields
+func (s *JSONStore) add(d *jsonStoreData, j *Joke) {
+	j.ID = max(d.NextID, 1)
+	d.NextID = j.ID + 1
+	j.CreatedAt = time.Now().UTC()
+	stored := *j
+	stored.Tags = normalizeTags(j.Tags)
+	d.Jokes = append(d.Jokes, stored)
+}
+
+// normalizeTags returns tags normalized, sorted and without duplicates or
+// empty tags
+func normalizeTags(tags []string) []string {
+	var normalized []string
+	for _, tag := range tags {
+		if tag = NormalizeTag(tag); tag != "" {
+			normalized = append(normalized, tag)
+		}
+	}
+	slices.Sort(normalized)
+	return slices.Compact(normalized)
+}
+
+// untagged returns a copy of j without its tags, as the Store methods
+// other than Get return jokes
+func untagged(j Joke) Joke {
+	j.Tags = nil
+	if j.ToldAt != nil {
+		toldAt := *j.ToldAt
+		j.ToldAt = &toldAt
+	}
+	return j
+}
+
+// Exists implements Store. Jokes with an upstream ID match on that ID,
+// all jokes match on their text.
+func (s *JSONStore) Exists(ctx context.Context, j Joke) (bool, error) {
+	var exists bool
+	err := s.read(func(d *jsonStoreData) error {
+		exists = s.find(d, j) >= 0
+		return nil
+	})
+	return exists, err
+}
+
+// Find implements Store
+func (s *JSONStore) Find(ctx context.Context, j Joke) (Joke, error) {
+	var found Joke
+	err := s.read(func(d *jsonStoreData) error {
+		i := s.find(d, j)
+		if i < 0 {
+			return ErrNotFound
+		}
+		found = untagged(d.Jokes[i])
+		return nil
+	})
+	return found, err
+}
+
+// Save implements Store
+func (s *JSONStore) Save(ctx context.Context, j *Joke) error {
+	return s.update(func(d *jsonStoreData) error {
+		if _, ok := s.hashes[textHash(j.Text)]; ok {
+			return ErrDuplicate
+		}
+		if j.ToldAt != nil && j.TimesTold == 0 {
+			j.TimesTold = 1
+		}
+		if j.ToldAt != nil {
+			toldAt := j.ToldAt.UTC()
+			j.ToldAt = &toldAt
+		}
+		s.add(d, j)
+		if j.ToldAt != nil {
+			d.Tellings = append(d.Tellings, newTelling(*j, *j.ToldAt))
+		}
+		return nil
+	})
+}
+
+// NextUntold implements Store
+func (s *JSONStore) NextUntold(ctx context.Context, lang string) (Joke, error) {
+	return s.nextUntold(lang, nil)
+}
+
+// nextUntold returns the oldest untold joke in lang that allowed allows,
+// or any if allowed is nil
+func (s *JSONStore) nextUntold(lang string, allowed func(Joke) bool) (Joke, error) {
+	var next Joke
+	err := s.read(func(d *jsonStoreData) error {
+		for _, j := range d.Jokes {
+			if j.ToldAt == nil && j.Language == lang && (allowed == nil || allowed(j)) {
+				next = untagged(j)
+				return nil
+			}
+		}
+		return ErrNoJokes
+	})
+	return next, err
+}
+
+// MarkTold implements Store
+func (s *JSONStore) MarkTold(ctx context.Context, j *Joke) error {
+	now := time.Now().UTC()
+	err := s.update(func(d *jsonStoreData) error {
+		if i := d.index(j.ID); i >= 0 {
+			d.Jokes[i].ToldAt = &now
+			d.Jokes[i].TimesTold++
+			d.Tellings = append(d.Tellings, newTelling(d.Jokes[i], now))
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error marking joke as told: %w", err)
+	}
+	j.ToldAt = &now
+	j.TimesTold++
+	return nil
+}
+
+// CountUntold implements StockStore
+func (s *JSONStore) CountUntold(ctx context.Context, lang string) (int, error) {
+	count := 0
+	err := s.read(func(d *jsonStoreData) error {
+		for _, j := range d.Jokes {
+			if j.ToldAt == nil && j.Language == lang {
+				count++
+			}
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Claim implements ClaimStore
+func (s *JSONStore) Claim(ctx context.Context, j *Joke) (bool, error) {
+	now := time.Now().UTC()
+	err := s.update(func(d *jsonStoreData) error {
+		i := d.index(j.ID)
+		if i < 0 || d.Jokes[i].TimesTold != j.TimesTold {
+			return errNotClaimed
+		}
+		d.Jokes[i].ToldAt = &now
+		d.Jokes[i].TimesTold++
+		d.Tellings = append(d.Tellings, newTelling(d.Jokes[i], now))
+		return nil
+	})
+	if errors.Is(err, errNotClaimed) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error marking joke as told: %w", err)
+	}
+	j.ToldAt = &now
+	j.TimesTold++
+	return true, nil
+}
+
+// LeastRecentlyTold implements Store
+func (s *JSONStore) LeastRecentlyTold(ctx context.Context, lang string, before time.Time) (Joke, error) {
+	return s.leastRecentlyTold(lang, before, nil)
+}
+
+// leastRecentlyTold is LeastRecentlyTold among the jokes allowed allows,
+// or all if allowed is nil
+func (s *JSONStore) leastRecentlyTold(lang string, before time.Time, allowed func(Joke) bool) (Joke, error) {
+	var least Joke
+	err := s.read(func(d *jsonStoreData) error {
+		found := false
+		for _, j := range d.Jokes {
+			if j.ToldAt == nil || j.Language != lang || !j.ToldAt.Before(before) || (allowed != nil && !allowed(j)) {
+				continue
+			}
+			if !found || j.ToldAt.Before(*least.ToldAt) {
+				least, found = j, true
+			}
+		}
+		if !found {
+			return ErrNoJokes
+		}
+		least = untagged(least)
+		return nil
+	})
+	return least, err
+}
+
+// Get implements Store
+func (s *JSONStore) Get(ctx context.Context, id int64) (Joke, error) {
+	var j Joke
+	err := s.read(func(d *jsonStoreData) error {
+		i := d.index(id)
+		if i < 0 {
+			return fmt.Errorf("%w: %d", ErrNotFound, id)
+		}
+		j = untagged(d.Jokes[i])
+		j.Tags = slices.Clone(d.Jokes[i].Tags)
+		return nil
+	})
+	return j, err
+}
+
+// Rate implements Store
+func (s *JSONStore) Rate(ctx context.Context, id int64, rating int) error {
+	if rating < MinRating || rating > MaxRating {
+		return ErrInvalidRating
+	}
+	return s.update(func(d *jsonStoreData) error {
+		i := d.index(id)
+		if i < 0 {
+			return fmt.Errorf("%w: %d", ErrNotFound, id)
+		}
+		d.Jokes[i].Rating = rating
+		return nil
+	})
+}
+
+// Random implements Store. Jokes are weighted by their rating like
+// SQLiteStore.Random.
+func (s *JSONStore) Random(ctx context.Context) (Joke, error) {
+	return s.random(func(Joke) bool { return true })
+}
+
+// RandomIn implements Store
+func (s *JSONStore) RandomIn(ctx context.Context, lang string) (Joke, error) {
+	return s.random(func(j Joke) bool { return j.Language == lang })
+}
+
+// RandomTagged implements Store
+func (s *JSONStore) RandomTagged(ctx context.Context, tag string) (Joke, error) {
+	tag = NormalizeTag(tag)
+	return s.random(func(j Joke) bool { return slices.Contains(j.Tags, tag) })
+}
+
+// random picks a weighted random joke among those match matches
+func (s *JSONStore) random(match func(Joke) bool) (Joke, error) {
+	var picked Joke
+	err := s.read(func(d *jsonStoreData) error {
+		var candidates []Joke
+		for _, j := range d.Jokes {
+			if match(j) {
+				candidates = append(candidates, j)
+			}
+		}
+		j, err := pickWeighted(candidates)
+		picked = untagged(j)
+		return err
+	})
+	return picked, err
+}
+
+// AddTags implements Store
+func (s *JSONStore) AddTags(ctx context.Context, id int64, tags ...string) error {
+	for _, tag := range tags {
+		if NormalizeTag(tag) == "" {
+			return ErrEmptyTag
+		}
+	}
+	return s.update(func(d *jsonStoreData) error {
+		i := d.index(id)
+		if i < 0 {
+			return fmt.Errorf("%w: %d", ErrNotFound, id)
+		}
+		d.Jokes[i].Tags = normalizeTags(append(slices.Clone(d.Jokes[i].Tags), tags...))
+		return nil
+	})
+}
+
+// RemoveTags implements Store
+func (s *JSONStore) RemoveTags(ctx context.Context, id int64, tags ...string) error {
+	return s.update(func(d *jsonStoreData) error {
+		if i := d.index(id); i >= 0 {
+			d.Jokes[i].Tags = slices.DeleteFunc(slices.Clone(d.Jokes[i].Tags), func(tag string) bool {
+				return slices.ContainsFunc(tags, func(removed string) bool { return NormalizeTag(removed) == tag })
+			})
+		}
+		return nil
+	})
+}
+
+// Tags implements Store
+func (s *JSONStore) Tags(ctx context.Context) ([]TagCount, error) {
+	var tags []TagCount
+	err := s.read(func(d *jsonStoreData) error {
+		counts := make(map[string]int)
+		for _, j := range d.Jokes {
+			for _, tag := range j.Tags {
+				counts[tag]++
+			}
+		}
+		for name, n := range counts {
+			tags = append(tags, TagCount{Name: name, Jokes: n})
+		}
+		slices.SortFunc(tags, func(a, b TagCount) int { return strings.Compare(a.Name, b.Name) })
+		return nil
+	})
+	return tags, err
+}
+
+// History implements Store
+func (s *JSONStore) History(ctx context.Context, f HistoryFilter) ([]Joke, error) {
+	var jokes []Joke
+	err := s.read(func(d *jsonStoreData) error {
+		tag := NormalizeTag(f.Tag)
+		for _, j := range d.Jokes {
+			if j.ToldAt == nil ||
+				(f.Language != "" && j.Language != f.Language) ||
+				(f.Source != "" && j.Source != f.Source) ||
+				(f.Tag != "" && !slices.Contains(j.Tags, tag)) ||
+				(!f.Since.IsZero() && j.ToldAt.Before(f.Since)) ||
+				j.Rating < f.MinRating {
+				continue
+			}
+			jokes = append(jokes, untagged(j))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error querying history: %w", err)
+	}
+
+	slices.SortFunc(jokes, func(a, b Joke) int {
+		if c := b.ToldAt.Compare(*a.ToldAt); c != 0 {
+			return c
+		}
+		return int(b.ID - a.ID)
+	})
+	jokes = jokes[min(f.Offset, len(jokes)):]
+	if f.Limit > 0 && f.Limit < len(jokes) {
+		jokes = jokes[:f.Limit]
+	}
+	return jokes, nil
+}
+
+// Update implements EditStore
+func (s *JSONStore) Update(ctx context.Context, id int64, text string) error {
+	return s.update(func(d *jsonStoreData) error {
+		i := d.index(id)
+		if i < 0 {
+			return fmt.Errorf("%w: %d", ErrNotFound, id)
+		}
+		if other, ok := s.hashes[textHash(text)]; ok && other != i {
+			return ErrDuplicate
+		}
+		d.Jokes[i].Text = text
+		return nil
+	})
+}
+
+// Delete implements EditStore
+func (s *JSONStore) Delete(ctx context.Context, id int64) error {
+	return s.update(func(d *jsonStoreData) error {
+		i := d.index(id)
+		if i < 0 {
+			return fmt.Errorf("%w: %d", ErrNotFound, id)
+		}
+		d.Jokes = slices.Delete(d.Jokes, i, i+1)
+		d.Submissions = slices.DeleteFunc(d.Submissions, func(sub Submission) bool { return sub.JokeID == id })
+		return nil
+	})
+}
+
+// Search implements Searcher. Jokes match when they contain every word of
+// the query, ignoring case, and are not ranked.
+func (s *JSONStore) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil, ErrEmptyQuery
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+
+	var results []SearchResult
+	err := s.read(func(d *jsonStoreData) error {
+		for i := len(d.Jokes) - 1; i >= 0 && len(results) < limit; i-- {
+			j := d.Jokes[i]
+			text := strings.ToLower(j.Text)
+			if j.ToldAt == nil || !allContained(text, terms) {
+				continue
+			}
+			results = append(results, SearchResult{Joke: untagged(j), Snippet: highlight(j.Text, terms)})
+		}
+		return nil
+	})
+	return results, err
+}
+
+// allContained reports whether text contains every term, ignoring case
+func allContained(text string, terms []string) bool {
+	for _, t := range terms {
+		if !strings.Contains(text, strings.ToLower(t)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Export implements ExportStore
+func (s *JSONStore) Export(ctx context.Context, f ExportFilter) ([]Joke, error) {
+	var jokes []Joke
+	err := s.read(func(d *jsonStoreData) error {
+		tag := NormalizeTag(f.Tag)
+		for _, j := range d.Jokes {
+			if (f.Language != "" && j.Language != f.Language) ||
+				(f.Source != "" && j.Source != f.Source) ||
+				(f.Tag != "" && !slices.Contains(j.Tags, tag)) ||
+				(!f.Since.IsZero() && j.CreatedAt.Before(f.Since)) ||
+				(!f.Until.IsZero() && !j.CreatedAt.Before(f.Until)) {
+				continue
+			}
+			exported := untagged(j)
+			exported.Tags = slices.Clone(j.Tags)
+			jokes = append(jokes, exported)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error exporting jokes: %w", err)
+	}
+	return jokes, nil
+}
+
+// Import implements ImportStore, writing the file once per batch
+func (s *JSONStore) Import(ctx context.Context, jokes []Joke, batch int, dryRun bool, progress func(done int)) (ImportResult, error) {
+	return importJokes(jokes, batch, progress, func(fresh []Joke) (int, error) {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		stored := 0
+		save := s.update
+		if dryRun {
+			save = s.read
+		}
+		err := save(func(d *jsonStoreData) error {
+			stored = 0
+			for _, j := range fresh {
+				if s.find(d, j) >= 0 {
+					continue
+				}
+				stored++
+				if dryRun {
+					continue
+				}
+				imported := Joke{Text: j.Text, UpstreamID: j.UpstreamID, Source: j.Source, Language: j.Language, Tags: j.Tags}
+				if j.Rating >= MinRating && j.Rating <= MaxRating {
+					imported.Rating = j.Rating
+				}
+				s.add(d, &imported)
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, fmt.Errorf("error importing jokes: %w", err)
+		}
+		return stored, nil
+	})
+}
+
+// RecordSubmission implements SubmissionStore
+func (s *JSONStore) RecordSubmission(ctx context.Context, sub Submission) error {
+	sub.SubmittedAt = sub.SubmittedAt.UTC()
+	err := s.update(func(d *jsonStoreData) error {
+		d.Submissions = slices.DeleteFunc(d.Submissions, func(other Submission) bool {
+			return other.JokeID == sub.JokeID && other.Target == sub.Target
+		})
+		d.Submissions = append(d.Submissions, sub)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error recording submission: %w", err)
+	}
+	return nil
+}
+
+// Submissions implements SubmissionStore
+func (s *JSONStore) Submissions(ctx context.Context) ([]Submission, error) {
+	var subs []Submission
+	err := s.read(func(d *jsonStoreData) error {
+		subs = slices.Clone(d.Submissions)
+		return nil
+	})
+	slices.SortStableFunc(subs, func(a, b Submission) int { return b.SubmittedAt.Compare(a.SubmittedAt) })
+	return subs, err
+}
+
+// RecordAnswer implements QuizStore
+func (s *JSONStore) RecordAnswer(ctx context.Context, a QuizAnswer) error {
+	a.AnsweredAt = a.AnsweredAt.UTC()
+	err := s.update(func(d *jsonStoreData) error {
+		d.QuizAnswers = append(d.QuizAnswers, a)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error recording answer: %w", err)
+	}
+	return nil
+}
+
+// QuizScore implements QuizStore
+func (s *JSONStore) QuizScore(ctx context.Context) (QuizScore, error) {
+	var answers []QuizAnswer
+	err := s.read(func(d *jsonStoreData) error {
+		answers = slices.Clone(d.QuizAnswers)
+		return nil
+	})
+	slices.SortStableFunc(answers, func(a, b QuizAnswer) int { return a.AnsweredAt.Compare(b.AnsweredAt) })
+	correct := make([]bool, len(answers))
+	for i, a := range answers {
+		correct[i] = a.Correct
+	}
+	return scoreAnswers(correct), err
+}
+
+// Tellings implements StatsStore
+func (s *JSONStore) Tellings(ctx context.Context) ([]Telling, error) {
+	var tellings []Telling
+	err := s.read(func(d *jsonStoreData) error {
+		tellings = slices.Clone(d.Tellings)
+		return nil
+	})
+	return tellings, err
+}
+
+// AddKey implements KeyStore
+func (s *JSONStore) AddKey(ctx context.Context, k *APIKey) error {
+	key := *k
+	key.CreatedAt = time.Now().UTC()
+	err := s.update(func(d *jsonStoreData) error {
+		for _, other := range d.APIKeys {
+			if other.Name == key.Name || other.Hash == key.Hash {
+				return ErrKeyExists
+			}
+		}
+		d.APIKeys = append(slices.Clone(d.APIKeys), key)
+		return nil
+	})
+	if errors.Is(err, ErrKeyExists) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("error adding API key: %w", err)
+	}
+	k.CreatedAt = key.CreatedAt
+	return nil
+}
+
+// RevokeKey implements KeyStore
+func (s *JSONStore) RevokeKey(ctx context.Context, name string) error {
+	now := time.Now().UTC()
+	err := s.update(func(d *jsonStoreData) error {
+		i := slices.IndexFunc(d.APIKeys, func(k APIKey) bool { return k.Name == name && k.RevokedAt == nil })
+		if i < 0 {
+			return ErrKeyNotFound
+		}
+		d.APIKeys = slices.Clone(d.APIKeys)
+		d.APIKeys[i].RevokedAt = &now
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return fmt.Errorf("error revoking API key: %w", err)
+	}
+	return err
+}
+
+// KeyByHash implements KeyStore
+func (s *JSONStore) KeyByHash(ctx context.Context, hash string) (APIKey, error) {
+	var key APIKey
+	err := s.read(func(d *jsonStoreData) error {
+		i := slices.IndexFunc(d.APIKeys, func(k APIKey) bool { return k.Hash == hash && k.RevokedAt == nil })
+		if i < 0 {
+			return ErrKeyNotFound
+		}
+		key = d.APIKeys[i]
+		return nil
+	})
+	return key, err
+}
+
+// Keys implements KeyStore
+func (s *JSONStore) Keys(ctx context.Context) ([]APIKey, error) {
+	var keys []APIKey
+	err := s.read(func(d *jsonStoreData) error {
+		keys = slices.Clone(d.APIKeys)
+		return nil
+	})
+	slices.SortFunc(keys, func(a, b APIKey) int { return strings.Compare(a.Name, b.Name) })
+	return keys, err
+}
+
+// Close implements Store. Every change is written right away, so there is
+// nothing left to do.
+func (s *JSONStore) Close() error {
+	return nil
+}
+
+// filteredJSONStore is a JSONStore picking only jokes the filter allows
+type filteredJSONStore struct {
+	*JSONStore
+	filter Filter
+}
+
+// Filtered implements FilterStore
+func (s *JSONStore) Filtered(f Filter) Store {
+	return filteredJSONStore{JSONStore: s, filter: f}
+}
+
+// NextUntold implements Store
+func (s filteredJSONStore) NextUntold(ctx context.Context, lang string) (Joke, error) {
+	return s.nextUntold(lang, s.filter.Allows)
+}
+
+// LeastRecentlyTold implements Store
+func (s filteredJSONStore) LeastRecentlyTold(ctx context.Context, lang string, before time.Time) (Joke, error) {
+	return s.leastRecentlyTold(lang, before, s.filter.Allows)
+}
+
+// Random implements Store
+func (s filteredJSONStore) Random(ctx context.Context) (Joke, error) {
+	return s.random(s.filter.Allows)
+}
+
+// RandomIn implements Store
+func (s filteredJSONStore) RandomIn(ctx context.Context, lang string) (Joke, error) {
+	return s.random(func(j Joke) bool { return j.Language == lang && s.filter.Allows(j) })
+}
+
+// RandomTagged implements Store
+func (s filteredJSONStore) RandomTagged(ctx context.Context, tag string) (Joke, error) {
+	tag = NormalizeTag(tag)
+	return s.random(func(j Joke) bool { return slices.Contains(j.Tags, tag) && s.filter.Allows(j) })
+}
+
+var (
+	_ EditStore       = (*JSONStore)(nil)
+	_ Searcher        = (*JSONStore)(nil)
+	_ ExportStore     = (*JSONStore)(nil)
+	_ ImportStore     = (*JSONStore)(nil)
+	_ SubmissionStore = (*JSONStore)(nil)
+	_ FilterStore     = (*JSONStore)(nil)
+	_ ClaimStore      = (*JSONStore)(nil)
+	_ StockStore      = (*JSONStore)(nil)
+	_ QuizStore       = (*JSONStore)(nil)
+	_ StatsStore      = (*JSONStore)(nil)
+	_ KeyStore        = (*JSONStore)(nil)
+)
@@ -0,0 +1,247 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestJSONStore opens a JSON store in a temporary directory
+func newTestJSONStore(t *testing.T) *JSONStore {
+	t.Helper()
+	store, err := OpenJSONStore(filepath.Join(t.TempDir(), "jokes.json"))
+	if err != nil {
+		t.Fatalf("Failed to open the store: %v", err)
+	}
+	return store
+}
+
+// testedStore is a store that can do everything JSONStore and SQLStore
+// can
+type testedStore interface {
+	EditStore
+	Searcher
+	ImportStore
+	ExportStore
+	ClaimStore
+	StockStore
+	QuizStore
+	StatsStore
+	KeyStore
+}
+
+func TestJSONStore(t *testing.T) {
+	store := newTestJSONStore(t)
+	told, untold := testStore(t, store)
+
+	// A store opened again reads what was written
+	ctx := context.Background()
+	reopened, err := OpenJSONStore(store.path)
+	if err != nil {
+		t.Fatalf("OpenJSONStore() returned an error: %v", err)
+	}
+	got, err := reopened.Get(ctx, untold.ID)
+	if err != nil {
+		t.Fatalf("Get() returned an error: %v", err)
+	}
+	if got.Text != untold.Text || got.TimesTold != 1 || !reflect.DeepEqual(got.Tags, []string{"animals"}) {
+		t.Errorf("Get() after reopening = %+v, want the told and tagged joke", got)
+	}
+	if err := reopened.Rate(ctx, untold.ID, 2); err != nil {
+		t.Fatalf("Rate() returned an error: %v", err)
+	}
+	// The first store notices the change
+	if got, _ := store.Get(ctx, untold.ID); got.Rating != 2 {
+		t.Errorf("Get() of a joke rated by another store = %+v, want it rated 2", got)
+	}
+	if _, err := store.Get(ctx, told.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of a deleted joke returned %v, want ErrNotFound", err)
+	}
+}
+
+func TestJSONStoreImportExport(t *testing.T) {
+	testImportExport(t, newTestJSONStore(t))
+}
+
+// testStore checks the Store, EditStore and Searcher methods of store,
+// which must be empty. It returns the joke it told and deleted, and the
+// joke it told and tagged animals.
+func testStore(t *testing.T, store testedStore) (told, untold Joke) {
+	t.Helper()
+	ctx := context.Background()
+
+	if _, err := store.Random(ctx); !errors.Is(err, ErrNoJokes) {
+		t.Errorf("Random() of an empty store returned %v, want ErrNoJokes", err)
+	}
+
+	told = Joke{Text: "A told joke", UpstreamID: "abc", Source: "icanhazdadjoke", Language: "en", ToldAt: ptr(time.Now().Add(-time.Hour)), Tags: []string{"Puns"}}
+	untold = Joke{Text: "An untold joke", Source: "icanhazdadjoke", Language: "en"}
+	for _, j := range []*Joke{&told, &untold} {
+		if err := store.Save(ctx, j); err != nil {
+			t.Fatalf("Save() returned an error: %v", err)
+		}
+	}
+	if told.ID != 1 || untold.ID != 2 || told.TimesTold != 1 || told.CreatedAt.IsZero() {
+		t.Errorf("Save() set %+v and %+v, want IDs 1 and 2, a creation time and the told joke told once", told, untold)
+	}
+	if err := store.Save(ctx, &Joke{Text: "a told joke!"}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Save() of a duplicate returned %v, want ErrDuplicate", err)
+	}
+
+	for _, tc := range []struct {
+		joke Joke
+		want bool
+	}{
+		{joke: Joke{Text: "A TOLD joke"}, want: true},
+		{joke: Joke{Text: "A reworded joke", UpstreamID: "abc", Source: "icanhazdadjoke"}, want: true},
+		{joke: Joke{Text: "Another joke", UpstreamID: "abc", Source: "other"}, want: false},
+	} {
+		if got, _ := store.Exists(ctx, tc.joke); got != tc.want {
+			t.Errorf("Exists(%+v) = %v, want %v", tc.joke, got, tc.want)
+		}
+	}
+
+	if n, err := store.CountUntold(ctx, "en"); err != nil || n != 1 {
+		t.Errorf("CountUntold() = %d, %v, want 1", n, err)
+	}
+	next, err := store.NextUntold(ctx, "en")
+	if err != nil || next.ID != untold.ID {
+		t.Fatalf("NextUntold() = %+v, %v, want the untold joke", next, err)
+	}
+	if err := store.MarkTold(ctx, &next); err != nil {
+		t.Fatalf("MarkTold() returned an error: %v", err)
+	}
+	// Another process read the joke before it was told
+	if claimed, err := store.Claim(ctx, &Joke{ID: untold.ID}); err != nil || claimed {
+		t.Errorf("Claim() of a joke told in the meantime = %v, %v, want false", claimed, err)
+	}
+	if _, err := store.NextUntold(ctx, "en"); !errors.Is(err, ErrNoJokes) {
+		t.Errorf("NextUntold() after telling every joke returned %v, want ErrNoJokes", err)
+	}
+	least, err := store.LeastRecentlyTold(ctx, "en", time.Now())
+	if err != nil || least.ID != told.ID {
+		t.Errorf("LeastRecentlyTold() = %+v, %v, want the joke told an hour ago", least, err)
+	}
+
+	if err := store.Rate(ctx, told.ID, 5); err != nil {
+		t.Fatalf("Rate() returned an error: %v", err)
+	}
+	if err := store.AddTags(ctx, untold.ID, "Animals", "puns"); err != nil {
+		t.Fatalf("AddTags() returned an error: %v", err)
+	}
+	tags, err := store.Tags(ctx)
+	if want := []TagCount{{Name: "animals", Jokes: 1}, {Name: "puns", Jokes: 2}}; err != nil || !reflect.DeepEqual(tags, want) {
+		t.Errorf("Tags() = %v, %v, want %v", tags, err, want)
+	}
+	if err := store.RemoveTags(ctx, untold.ID, "Puns"); err != nil {
+		t.Fatalf("RemoveTags() returned an error: %v", err)
+	}
+	if tagged, err := store.RandomTagged(ctx, "puns"); err != nil || tagged.ID != told.ID {
+		t.Errorf("RandomTagged() = %+v, %v, want the told joke", tagged, err)
+	}
+	if j, err := store.RandomIn(ctx, "en"); err != nil || j.Language != "en" {
+		t.Errorf("RandomIn() = %+v, %v, want an English joke", j, err)
+	}
+	if _, err := store.RandomIn(ctx, "de"); !errors.Is(err, ErrNoJokes) {
+		t.Errorf("RandomIn() of a language without jokes returned %v, want ErrNoJokes", err)
+	}
+
+	history, err := store.History(ctx, HistoryFilter{Tag: "animals"})
+	if err != nil || len(history) != 1 || history[0].ID != untold.ID {
+		t.Errorf("History() of a tag = %+v, %v, want the joke told last", history, err)
+	}
+	if favorites, err := store.History(ctx, HistoryFilter{MinRating: 4}); err != nil || len(favorites) != 1 || favorites[0].ID != told.ID {
+		t.Errorf("History() of favorites = %+v, %v, want the rated joke", favorites, err)
+	}
+	if results, err := store.Search(ctx, "told JOKE", 0); err != nil || len(results) != 2 || results[0].ID != untold.ID {
+		t.Errorf("Search() = %+v, %v, want both jokes, newest first", results, err)
+	}
+
+	got, err := store.Get(ctx, told.ID)
+	if err != nil {
+		t.Fatalf("Get() returned an error: %v", err)
+	}
+	if got.Text != told.Text || got.Rating != 5 || got.TimesTold != 1 || !reflect.DeepEqual(got.Tags, []string{"puns"}) {
+		t.Errorf("Get() = %+v, want the rated and tagged joke", got)
+	}
+
+	if err := store.Update(ctx, told.ID, untold.Text); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Update() to the text of another joke returned %v, want ErrDuplicate", err)
+	}
+	if err := store.Update(ctx, 42, "A new joke"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Update() of a missing joke returned %v, want ErrNotFound", err)
+	}
+	for i, correct := range []bool{true, true, false, true} {
+		answer := QuizAnswer{JokeID: told.ID, Correct: correct, AnsweredAt: time.Now().Add(time.Duration(i) * time.Second)}
+		if err := store.RecordAnswer(ctx, answer); err != nil {
+			t.Fatalf("RecordAnswer() returned an error: %v", err)
+		}
+	}
+	wantScore := QuizScore{Answered: 4, Correct: 3, Streak: 1, BestStreak: 2}
+	if score, err := store.QuizScore(ctx); err != nil || score != wantScore {
+		t.Errorf("QuizScore() = %+v, %v, want %+v", score, err, wantScore)
+	}
+
+	if err := store.Delete(ctx, told.ID); err != nil {
+		t.Fatalf("Delete() returned an error: %v", err)
+	}
+	if _, err := store.Get(ctx, told.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() of a deleted joke returned %v, want ErrNotFound", err)
+	}
+	if score, _ := store.QuizScore(ctx); score != wantScore {
+		t.Errorf("QuizScore() after deleting the joke = %+v, want %+v", score, wantScore)
+	}
+	tellings, err := store.Tellings(ctx)
+	if err != nil {
+		t.Fatalf("Tellings() returned an error: %v", err)
+	}
+	if len(tellings) != 2 || tellings[0].JokeID != told.ID || tellings[0].Source != "icanhazdadjoke" || tellings[0].Length != len(told.Text) || tellings[1].JokeID != untold.ID {
+		t.Errorf("Tellings() after deleting a joke = %+v, want the told joke and the joke marked told", tellings)
+	}
+	testKeyStore(t, store)
+	return told, untold
+}
+
+// testImportExport checks the Import and Export methods of store, which
+// must be empty
+func testImportExport(t *testing.T, store testedStore) {
+	t.Helper()
+	ctx := context.Background()
+
+	jokes := []Joke{
+		{Text: "First joke", Source: "import", Language: "en", Tags: []string{"Imported"}},
+		{Text: "Second joke", Source: "import", Language: "de", Rating: 4},
+		{Text: "First joke.", Source: "import", Language: "en"},
+	}
+	res, err := store.Import(ctx, jokes, 2, true, nil)
+	if want := (ImportResult{Imported: 2, Duplicates: 1}); err != nil || res != want {
+		t.Errorf("Import() dry run = %+v, %v, want %+v", res, err, want)
+	}
+	if all, _ := store.Export(ctx, ExportFilter{}); len(all) != 0 {
+		t.Errorf("Import() dry run stored %d jokes", len(all))
+	}
+
+	if _, err := store.Import(ctx, jokes, 2, false, nil); err != nil {
+		t.Fatalf("Import() returned an error: %v", err)
+	}
+	if res, _ := store.Import(ctx, jokes, 2, false, nil); res.Imported != 0 {
+		t.Errorf("Import() again imported %d jokes, want 0", res.Imported)
+	}
+
+	exported, err := store.Export(ctx, ExportFilter{Tag: "imported"})
+	if err != nil {
+		t.Fatalf("Export() returned an error: %v", err)
+	}
+	if len(exported) != 1 || exported[0].Text != "First joke" || !reflect.DeepEqual(exported[0].Tags, []string{"imported"}) {
+		t.Errorf("Export() of a tag = %+v, want the first joke with its tag", exported)
+	}
+	if exported, _ := store.Export(ctx, ExportFilter{Language: "de"}); len(exported) != 1 || exported[0].Rating != 4 {
+		t.Errorf("Export() of a language = %+v, want the rated second joke", exported)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// LibreTranslateURL is the public LibreTranslate instance, which needs an
+// API key. Self-hosted instances usually don't.
+const LibreTranslateURL = "https://libretranslate.com"
+
+// LibreTranslate translates with a LibreTranslate server
+type LibreTranslate struct {
+	// URL is the base URL of the server, without /translate
+	URL string
+	// Key is the API key, if the server needs one
+	Key    string
+	Client *http.Client
+}
+
+// NewLibreTranslate returns a translator using the LibreTranslate server
+// at url, or the public instance if url is empty
+func NewLibreTranslate(url, key string) *LibreTranslate {
+	if url == "" {
+		url = LibreTranslateURL
+	}
+	return &LibreTranslate{
+		URL:    strings.TrimSuffix(url, "/"),
+		Key:    key,
+		Client: DefaultHTTPClient,
+	}
+}
+
+// Name implements Translator
+func (t *LibreTranslate) Name() string {
+	return "libretranslate"
+}
+
+// Translate implements Translator
+func (t *LibreTranslate) Translate(ctx context.Context, text, from, to string) (string, error) {
+	in := map[string]string{
+		"q":      text,
+		"source": from,
+		"target": to,
+		"format": "text",
+	}
+	if t.Key != "" {
+		in["api_key"] = t.Key
+	}
+	var out struct {
+		TranslatedText string `json:"translatedText"`
+	}
+	if err := postJSON(ctx, t.Client, t.URL+"/translate", nil, in, &out); err != nil {
+		return "", err
+	}
+	return out.TranslatedText, nil
+}
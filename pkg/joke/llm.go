@@ -0,0 +1,144 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// OpenAIURL is the base URL of the OpenAI API
+const OpenAIURL = "https://api.openai.com/v1"
+
+// AITag marks jokes made up by a language model
+const AITag = "ai-generated"
+
+// DefaultTemperature is the sampling temperature of LLMSource, high enough
+// for a different joke every time
+const DefaultTemperature = 1.0
+
+// languageNames are the English names of the languages prompts ask for
+var languageNames = map[string]string{
+	"cs": "Czech",
+	"de": "German",
+	"en": "English",
+	"es": "Spanish",
+	"fr": "French",
+	"it": "Italian",
+	"nl": "Dutch",
+	"pt": "Portuguese",
+}
+
+// LLMSource makes up jokes with a language model behind an OpenAI
+// compatible chat completions API. Its jokes are tagged with AITag.
+type LLMSource struct {
+	// URL is the base URL of the API, without /chat/completions
+	URL    string
+	Key    string
+	Model  string
+	Client *http.Client
+	// Prompt asks the model for a joke. It defaults to DefaultPrompt.
+	Prompt      string
+	Temperature float64
+	name        string
+	lang        string
+}
+
+// NewLLMSource returns a source called name making up jokes in lang with
+// model at the API at url
+func NewLLMSource(name, lang, url, model string) *LLMSource {
+	return &LLMSource{
+		URL:         strings.TrimSuffix(url, "/"),
+		Model:       model,
+		Client:      DefaultHTTPClient,
+		Temperature: DefaultTemperature,
+		name:        name,
+		lang:        normalizeLanguage(lang),
+	}
+}
+
+// DefaultPrompt returns the prompt asking for an original dad joke in lang
+func DefaultPrompt(lang string) string {
+	name, ok := languageNames[lang]
+	if !ok {
+		name = "the language with the ISO 639-1 code " + lang
+	}
+	return "You are a dad who loves puns. Tell one short, original, family friendly dad joke in " + name +
+		". Reply with the joke only, without quotes or any other text. Put the punchline of a question and answer joke on a line of its own."
+}
+
+// Name implements Source
+func (s *LLMSource) Name() string {
+	return s.name
+}
+
+// Language implements Source
+func (s *LLMSource) Language() string {
+	return s.lang
+}
+
+// Fetch implements Source
+func (s *LLMSource) Fetch(ctx context.Context) (Joke, error) {
+	prompt := s.Prompt
+	if prompt == "" {
+		prompt = DefaultPrompt(s.lang)
+	}
+	in := map[string]any{
+		"model": s.Model,
+		"messages": []map[string]string{
+			{"role": "user", "content": prompt},
+		},
+		"temperature": s.Temperature,
+	}
+	var out struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	var headers map[string]string
+	if s.Key != "" {
+		headers = map[string]string{"Authorization": "Bearer " + s.Key}
+	}
+	if err := postJSON(ctx, s.Client, s.URL+"/chat/completions", headers, in, &out); err != nil {
+		return Joke{}, err
+	}
+	if len(out.Choices) == 0 {
+		return Joke{}, errors.New("no completion in response")
+	}
+
+	text := cleanCompletion(out.Choices[0].Message.Content)
+	if text == "" {
+		return Joke{}, fmt.Errorf("%s returned an empty joke", s.Model)
+	}
+	return Joke{
+		Text:     text,
+		Source:   s.Name(),
+		Language: s.Language(),
+		Tags:     []string{AITag},
+	}, nil
+}
+
+// cleanCompletion returns the joke in a completion, without the quotes
+// and blank lines models like to add
+func cleanCompletion(content string) string {
+	var lines []string
+	for _, line := range strings.Split(content, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	text := strings.Join(lines, "\n")
+	for _, q := range [][2]string{{`"`, `"`}, {"“", "”"}, {"„", "“"}, {"«", "»"}} {
+		if len(text) > len(q[0])+len(q[1]) && strings.HasPrefix(text, q[0]) && strings.HasSuffix(text, q[1]) {
+			text = strings.TrimSpace(text[len(q[0]) : len(text)-len(q[1])])
+			break
+		}
+	}
+	return text
+}
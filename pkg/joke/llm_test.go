@@ -0,0 +1,82 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLLMSource(t *testing.T) {
+	var request struct {
+		Model       string  `json:"model"`
+		Temperature float64 `json:"temperature"`
+		Messages    []struct {
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "\"Warum können Geister so schlecht lügen?\n\nWeil man durch sie hindurchsieht.\"\n"}}]}`))
+	}))
+	defer server.Close()
+
+	src := NewLLMSource("dadbot", "de", server.URL+"/v1/", "tiny")
+	src.Key = "secret"
+	src.Temperature = 0.7
+
+	store := newTestStore(t)
+	j, err := NewEngine(store, src).Tell(context.Background())
+	if err != nil {
+		t.Fatalf("Tell() returned an error: %v", err)
+	}
+	if j.Text != "Warum können Geister so schlecht lügen?\nWeil man durch sie hindurchsieht." || j.Source != "dadbot" || j.Language != "de" {
+		t.Errorf("Tell() = %+v, want the cleaned up joke from dadbot", j)
+	}
+	if request.Model != "tiny" || request.Temperature != 0.7 || len(request.Messages) != 1 || !strings.Contains(request.Messages[0].Content, "German") {
+		t.Errorf("the request was %+v, want the model, temperature and a prompt asking for German", request)
+	}
+
+	stored, err := store.Get(context.Background(), j.ID)
+	if err != nil {
+		t.Fatalf("Get() returned an error: %v", err)
+	}
+	if !slices.Contains(stored.Tags, AITag) {
+		t.Errorf("the stored joke has tags %v, want %s", stored.Tags, AITag)
+	}
+}
+
+func TestCleanCompletion(t *testing.T) {
+	for content, want := range map[string]string{
+		"  Just a joke. ":            "Just a joke.",
+		"“Quoted joke.”":             "Quoted joke.",
+		"Setup?\n\n  Punchline!\n":   "Setup?\nPunchline!",
+		`"`:                          `"`,
+		`He said "hi" to "the wall"`: `He said "hi" to "the wall"`,
+	} {
+		if got := cleanCompletion(content); got != want {
+			t.Errorf("cleanCompletion(%q) = %q, want %q", content, got, want)
+		}
+	}
+}
+
+func TestNewOllama(t *testing.T) {
+	src := NewOllama("ollama", "en", "", "")
+	if src.URL != OllamaURL || src.Model != DefaultOllamaModel || src.Key != "" {
+		t.Errorf("NewOllama() = %+v, want the local server and the default model", src)
+	}
+	if src = NewOllama("ollama", "en", "http://gpu-box:11434/v1/", "mistral"); src.URL != "http://gpu-box:11434/v1" || src.Model != "mistral" {
+		t.Errorf("NewOllama() = %+v, want the given server and model", src)
+	}
+}
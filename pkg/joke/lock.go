@@ -0,0 +1,44 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// lockPoll is how often LockFile tries again to take a lock held by
+// another process
+const lockPoll = 20 * time.Millisecond
+
+// LockFile waits until this process holds the lock on the file at path,
+// creating the file if needed, and returns a function releasing it. The
+// lock is advisory: it only keeps out other processes taking it as well.
+// It is released when the process exits, so a crash never leaves it
+// behind.
+func LockFile(ctx context.Context, path string) (unlock func() error, err error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening lock file: %w", err)
+	}
+	for {
+		locked, err := tryLock(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("error locking %s: %w", path, err)
+		}
+		if locked {
+			// Closing the file releases the lock
+			return f.Close, nil
+		}
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, fmt.Errorf("error locking %s: %w", path, ctx.Err())
+		case <-time.After(lockPoll):
+		}
+	}
+}
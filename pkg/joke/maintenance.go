@@ -0,0 +1,203 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// DBStats describes the contents and layout of the database
+type DBStats struct {
+	// Tables lists the tables with their row counts, by name
+	Tables []TableStats `json:"tables"`
+	// Indexes lists the indexes, by table and name
+	Indexes []IndexStats `json:"indexes"`
+	// PageSize is the size of a database page in bytes
+	PageSize int64 `json:"page_size"`
+	// Pages is the number of pages in the database file
+	Pages int64 `json:"pages"`
+	// FreePages is the number of unused pages, which Vacuum gives back
+	FreePages int64 `json:"free_pages"`
+}
+
+// Size returns the size of the database file in bytes
+func (s DBStats) Size() int64 {
+	return s.PageSize * s.Pages
+}
+
+// TableStats describes a table of the database
+type TableStats struct {
+	Name string `json:"name"`
+	Rows int64  `json:"rows"`
+}
+
+// IndexStats describes an index of the database
+type IndexStats struct {
+	Name  string `json:"name"`
+	Table string `json:"table"`
+	// Analyzed is set when the query planner has statistics about the
+	// index, which Vacuum gathers
+	Analyzed bool `json:"analyzed"`
+	// RowsPerKey is the average number of rows an entry of the index
+	// matches, from the statistics. Close to 1 is most selective.
+	RowsPerKey int64 `json:"rows_per_key,omitempty"`
+}
+
+// Vacuum rebuilds the database to give back unused space and gathers the
+// statistics the query planner uses to pick indexes
+func (s *SQLiteStore) Vacuum(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, "VACUUM"); err != nil {
+		return fmt.Errorf("error vacuuming database: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, "ANALYZE"); err != nil {
+		return fmt.Errorf("error analyzing database: %w", err)
+	}
+	return nil
+}
+
+// Check checks the integrity of the database and its foreign keys, and
+// returns the problems found, or none if the database is healthy
+func (s *SQLiteStore) Check(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, "PRAGMA integrity_check")
+	if err != nil {
+		return nil, fmt.Errorf("error checking database: %w", err)
+	}
+	var problems []string
+	for rows.Next() {
+		var problem string
+		if err := rows.Scan(&problem); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error checking database: %w", err)
+		}
+		if problem != "ok" {
+			problems = append(problems, problem)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error checking database: %w", err)
+	}
+
+	rows, err = s.db.QueryContext(ctx, "PRAGMA foreign_key_check")
+	if err != nil {
+		return nil, fmt.Errorf("error checking foreign keys: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			table, parent string
+			rowID         sql.NullInt64
+			fk            int
+		)
+		if err := rows.Scan(&table, &rowID, &parent, &fk); err != nil {
+			return nil, fmt.Errorf("error checking foreign keys: %w", err)
+		}
+		problems = append(problems, fmt.Sprintf("row %d of %s refers to a missing row of %s", rowID.Int64, table, parent))
+	}
+	return problems, rows.Err()
+}
+
+// Stats returns the row counts, size and indexes of the database
+func (s *SQLiteStore) Stats(ctx context.Context) (DBStats, error) {
+	var stats DBStats
+	for pragma, dest := range map[string]*int64{
+		"page_size":      &stats.PageSize,
+		"page_count":     &stats.Pages,
+		"freelist_count": &stats.FreePages,
+	} {
+		if err := s.db.QueryRowContext(ctx, "PRAGMA "+pragma).Scan(dest); err != nil {
+			return DBStats{}, fmt.Errorf("error getting %s: %w", pragma, err)
+		}
+	}
+
+	tables, err := s.tables(ctx)
+	if err != nil {
+		return DBStats{}, err
+	}
+	for _, table := range tables {
+		t := TableStats{Name: table}
+		if err := s.db.QueryRowContext(ctx, `SELECT count(*) FROM "`+table+`"`).Scan(&t.Rows); err != nil {
+			return DBStats{}, fmt.Errorf("error counting rows of %s: %w", table, err)
+		}
+		stats.Tables = append(stats.Tables, t)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT name, tbl_name FROM sqlite_master
+		WHERE type = 'index' ORDER BY tbl_name, name`)
+	if err != nil {
+		return DBStats{}, fmt.Errorf("error listing indexes: %w", err)
+	}
+	for rows.Next() {
+		var idx IndexStats
+		if err := rows.Scan(&idx.Name, &idx.Table); err != nil {
+			rows.Close()
+			return DBStats{}, fmt.Errorf("error listing indexes: %w", err)
+		}
+		stats.Indexes = append(stats.Indexes, idx)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return DBStats{}, fmt.Errorf("error listing indexes: %w", err)
+	}
+
+	for i, idx := range stats.Indexes {
+		// sqlite_stat1 only exists once the database was analyzed. Its
+		// stat column holds the rows of the table, then the average rows
+		// per key of each indexed column.
+		var stat string
+		err := s.db.QueryRowContext(ctx, "SELECT stat FROM sqlite_stat1 WHERE idx = ?", idx.Name).Scan(&stat)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) || strings.Contains(err.Error(), "no such table") {
+				continue
+			}
+			return DBStats{}, fmt.Errorf("error getting index statistics: %w", err)
+		}
+		stats.Indexes[i].Analyzed = true
+		fields := strings.Fields(stat)
+		if len(fields) > 1 {
+			_, _ = fmt.Sscan(fields[len(fields)-1], &stats.Indexes[i].RowsPerKey)
+		}
+	}
+	return stats, nil
+}
+
+// tables returns the names of the tables, leaving out SQLite's own and the
+// shadow tables holding the data of virtual tables like the search index
+func (s *SQLiteStore) tables(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT name, sql FROM sqlite_master
+		WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("error listing tables: %w", err)
+	}
+	defer rows.Close()
+
+	var names, virtual []string
+	for rows.Next() {
+		var name, create string
+		if err := rows.Scan(&name, &create); err != nil {
+			return nil, fmt.Errorf("error listing tables: %w", err)
+		}
+		if strings.HasPrefix(strings.ToUpper(create), "CREATE VIRTUAL TABLE") {
+			virtual = append(virtual, name)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing tables: %w", err)
+	}
+
+	return slices.DeleteFunc(names, func(name string) bool {
+		for _, v := range virtual {
+			if strings.HasPrefix(name, v+"_") {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
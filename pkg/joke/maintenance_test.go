@@ -0,0 +1,55 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSQLiteMaintenance(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	for _, text := range []string{"First joke", "Second joke", "Third joke"} {
+		j := Joke{Text: text, Source: "user", Language: "en"}
+		if err := store.Save(ctx, &j); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Delete(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if problems, err := store.Check(ctx); err != nil || len(problems) != 0 {
+		t.Errorf("Check() = %q, %v, want no problems", problems, err)
+	}
+
+	if err := store.Vacuum(ctx); err != nil {
+		t.Fatalf("Vacuum() returned an error: %v", err)
+	}
+	stats, err := store.Stats(ctx)
+	if err != nil {
+		t.Fatalf("Stats() returned an error: %v", err)
+	}
+	if stats.Size() == 0 || stats.FreePages != 0 {
+		t.Errorf("Stats() after Vacuum() = %d bytes with %d free pages, want a size and none free", stats.Size(), stats.FreePages)
+	}
+	found := false
+	for _, table := range stats.Tables {
+		if table.Name == "jokes" {
+			found = true
+			if table.Rows != 2 {
+				t.Errorf("Stats() counted %d jokes, want 2", table.Rows)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Stats() listed the tables %+v, want the jokes among them", stats.Tables)
+	}
+	for _, idx := range stats.Indexes {
+		if idx.Name == "idx_jokes_hash" && (!idx.Analyzed || idx.RowsPerKey != 1) {
+			t.Errorf("Stats() after Vacuum() = %+v for the hash index, want it analyzed with a row per key", idx)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// extractJokesFromMarkdown returns the text of every item of the bulleted
+// and numbered lists in md. Items holding a list of their own are taken as
+// headings of that list and skipped, as are items that are nothing but a
+// link, like those of a table of contents. Headings, code blocks and any
+// other text outside of lists are ignored.
+func extractJokesFromMarkdown(md []byte) []string {
+	doc := goldmark.DefaultParser().Parse(text.NewReader(md))
+
+	var jokes []string
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering || n.Kind() != ast.KindListItem || hasList(n) {
+			return ast.WalkContinue, nil
+		}
+		if j := itemText(n, md); j != "" {
+			jokes = append(jokes, j)
+		}
+		return ast.WalkSkipChildren, nil
+	})
+	return jokes
+}
+
+// hasList reports whether the list item n holds a list
+func hasList(n ast.Node) bool {
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		if c.Kind() == ast.KindList {
+			return true
+		}
+	}
+	return false
+}
+
+// itemText returns the text of the paragraphs of a list item. Lines broken
+// with a hard line break and separate paragraphs stay on lines of their
+// own, while soft line breaks are joined with a space, as they are when
+// the markdown is rendered.
+func itemText(item ast.Node, source []byte) string {
+	var lines []string
+	for c := item.FirstChild(); c != nil; c = c.NextSibling() {
+		if c.Kind() != ast.KindParagraph && c.Kind() != ast.KindTextBlock {
+			continue
+		}
+		if c.ChildCount() == 1 && c.FirstChild().Kind() == ast.KindLink {
+			continue
+		}
+		var b strings.Builder
+		inlineText(&b, c, source)
+		for _, line := range strings.Split(b.String(), "\n") {
+			if line = strings.Join(strings.Fields(line), " "); line != "" {
+				lines = append(lines, line)
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// inlineText writes the text of the inline children of n to b, dropping
+// markup like emphasis and links but keeping their text
+func inlineText(b *strings.Builder, n ast.Node, source []byte) {
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		switch c := c.(type) {
+		case *ast.Text:
+			b.Write(c.Segment.Value(source))
+			switch {
+			case c.HardLineBreak():
+				b.WriteByte('\n')
+			case c.SoftLineBreak():
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			b.Write(c.Value)
+		case *ast.AutoLink:
+			b.Write(c.URL(source))
+		case *ast.RawHTML:
+		default:
+			inlineText(b, c, source)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"path/filepath"
+	"sync"
+)
+
+// MarkdownList tells the jokes of a bulleted or numbered markdown list on
+// the web, like the curated collections on GitHub. The list is only
+// downloaded again once it changed.
+type MarkdownList struct {
+	URL    string
+	Client *http.Client
+	// CacheDir keeps the list between runs. Without it the list is only
+	// kept in memory.
+	CacheDir string
+
+	name  string
+	lang  string
+	mu    sync.Mutex
+	cache *httpCache
+	jokes []string
+}
+
+// NewMarkdownList returns a source called name for the jokes in lang of
+// the markdown list at url
+func NewMarkdownList(name, lang, url string) *MarkdownList {
+	return &MarkdownList{
+		URL:    url,
+		Client: DefaultHTTPClient,
+		name:   name,
+		lang:   normalizeLanguage(lang),
+	}
+}
+
+// Name implements Source
+func (s *MarkdownList) Name() string {
+	return s.name
+}
+
+// Language implements Source
+func (s *MarkdownList) Language() string {
+	return s.lang
+}
+
+// Fetch implements Source
+func (s *MarkdownList) Fetch(ctx context.Context) (Joke, error) {
+	jokes, err := s.list(ctx)
+	if err != nil {
+		return Joke{}, err
+	}
+
+	// #nosec G404 -- picking a joke does not need a secure random number
+	return Joke{
+		Text:     jokes[rand.IntN(len(jokes))],
+		Source:   s.Name(),
+		Language: s.Language(),
+	}, nil
+}
+
+// List implements ListSource, so every joke of the list is told once
+// before any is repeated
+func (s *MarkdownList) List(ctx context.Context) ([]Joke, error) {
+	texts, err := s.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	jokes := make([]Joke, len(texts))
+	for i, text := range texts {
+		jokes[i] = Joke{Text: text, Source: s.Name(), Language: s.Language()}
+	}
+	return jokes, nil
+}
+
+// list returns the jokes of the list, parsing it only when it changed
+func (s *MarkdownList) list(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	if s.cache == nil {
+		s.cache = &httpCache{}
+		if s.CacheDir != "" {
+			s.cache.path = filepath.Join(s.CacheDir, s.Name()+".json")
+		}
+	}
+	cache := s.cache
+	s.mu.Unlock()
+
+	body, changed, err := cache.get(ctx, s.Client, s.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if changed || s.jokes == nil {
+		s.jokes = extractJokesFromMarkdown(body)
+	}
+	if len(s.jokes) == 0 {
+		return nil, errors.New("no jokes found in markdown")
+	}
+	return s.jokes, nil
+}
+
+var _ ListSource = (*MarkdownList)(nil)
@@ -0,0 +1,337 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Migration is a single, versioned change to the database schema. Up
+// applies the change and Down reverts it; both run inside a transaction.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(tx *sql.Tx) error
+	Down        func(tx *sql.Tx) error
+}
+
+// migrations lists every schema change in the order it must be applied.
+// Append new migrations to the end and never change released ones.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "create jokes table",
+		// Databases created before migrations existed already have the
+		// table, so it is only created when missing
+		Up: execAll(`CREATE TABLE IF NOT EXISTS jokes (
+			id INTEGER PRIMARY KEY,
+			joke TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`),
+		Down: execAll("DROP TABLE jokes"),
+	},
+	{
+		Version:     2,
+		Description: "add joke metadata",
+		Up: func(tx *sql.Tx) error {
+			for _, col := range []string{"upstream_id", "source", "language"} {
+				if err := addColumn(tx, "jokes", col, "TEXT NOT NULL DEFAULT ''"); err != nil {
+					return err
+				}
+			}
+			return execAll("CREATE INDEX IF NOT EXISTS idx_jokes_upstream ON jokes (source, upstream_id)")(tx)
+		},
+		Down: execAll(
+			"DROP INDEX IF EXISTS idx_jokes_upstream",
+			"ALTER TABLE jokes DROP COLUMN language",
+			"ALTER TABLE jokes DROP COLUMN source",
+			"ALTER TABLE jokes DROP COLUMN upstream_id",
+		),
+	},
+	{
+		Version:     3,
+		Description: "track when jokes are told",
+		Up: execAll(
+			"ALTER TABLE jokes ADD COLUMN told_at DATETIME",
+			// Every joke stored so far has been told
+			"UPDATE jokes SET told_at = created_at",
+			"CREATE INDEX idx_jokes_untold ON jokes (language, told_at)",
+		),
+		Down: execAll(
+			"DROP INDEX IF EXISTS idx_jokes_untold",
+			// Prefetched jokes were never told and would look told after a downgrade
+			"DELETE FROM jokes WHERE told_at IS NULL",
+			"ALTER TABLE jokes DROP COLUMN told_at",
+		),
+	},
+	{
+		Version:     4,
+		Description: "rate jokes",
+		Up:          execAll("ALTER TABLE jokes ADD COLUMN rating INTEGER"),
+		Down:        execAll("ALTER TABLE jokes DROP COLUMN rating"),
+	},
+	{
+		Version:     5,
+		Description: "tag jokes",
+		Up: execAll(
+			"CREATE TABLE tags (id INTEGER PRIMARY KEY, name TEXT NOT NULL UNIQUE)",
+			`CREATE TABLE joke_tags (
+				joke_id INTEGER NOT NULL REFERENCES jokes (id) ON DELETE CASCADE,
+				tag_id INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+				PRIMARY KEY (joke_id, tag_id)
+			)`,
+			"CREATE INDEX idx_joke_tags_tag ON joke_tags (tag_id)",
+		),
+		Down: execAll(
+			"DROP TABLE joke_tags",
+			"DROP TABLE tags",
+		),
+	},
+	{
+		Version:     6,
+		Description: "count how often jokes are told",
+		Up: execAll(
+			"ALTER TABLE jokes ADD COLUMN times_told INTEGER NOT NULL DEFAULT 0",
+			"UPDATE jokes SET times_told = 1 WHERE told_at IS NOT NULL",
+		),
+		Down: execAll("ALTER TABLE jokes DROP COLUMN times_told"),
+	},
+	{
+		Version:     7,
+		Description: "recognize duplicates by their normalized text",
+		Up: func(tx *sql.Tx) error {
+			if _, err := tx.Exec("ALTER TABLE jokes ADD COLUMN hash TEXT"); err != nil {
+				return err
+			}
+			if err := backfillHashes(tx); err != nil {
+				return err
+			}
+			return execAll("CREATE UNIQUE INDEX idx_jokes_hash ON jokes (hash)")(tx)
+		},
+		// Merged duplicates stay merged
+		Down: execAll(
+			"DROP INDEX IF EXISTS idx_jokes_hash",
+			"ALTER TABLE jokes DROP COLUMN hash",
+		),
+	},
+	{
+		Version:     8,
+		Description: "track the health of sources",
+		Up: execAll(`CREATE TABLE source_health (
+			source TEXT PRIMARY KEY,
+			failures INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			last_failure DATETIME,
+			last_success DATETIME,
+			latency_ms INTEGER NOT NULL DEFAULT 0
+		)`),
+		Down: execAll("DROP TABLE source_health"),
+	},
+	{
+		Version:     9,
+		Description: "rate limit sources",
+		Up: execAll(`CREATE TABLE rate_limits (
+			source TEXT PRIMARY KEY,
+			tokens REAL NOT NULL,
+			updated_at DATETIME NOT NULL,
+			blocked_until DATETIME
+		)`),
+		Down: execAll("DROP TABLE rate_limits"),
+	},
+	{
+		Version:     10,
+		Description: "cache translations",
+		Up: execAll(`CREATE TABLE translations (
+			hash TEXT NOT NULL,
+			language TEXT NOT NULL,
+			original TEXT NOT NULL,
+			original_language TEXT NOT NULL,
+			joke TEXT NOT NULL,
+			translator TEXT NOT NULL,
+			created_at DATETIME NOT NULL,
+			PRIMARY KEY (hash, language)
+		)`),
+		Down: execAll("DROP TABLE translations"),
+	},
+	{
+		Version:     11,
+		Description: "keep embeddings of jokes",
+		Up: execAll(`CREATE TABLE embeddings (
+			joke_id INTEGER NOT NULL REFERENCES jokes (id) ON DELETE CASCADE,
+			model TEXT NOT NULL,
+			vector BLOB NOT NULL,
+			PRIMARY KEY (joke_id, model)
+		)`),
+		Down: execAll("DROP TABLE embeddings"),
+	},
+	{
+		Version:     12,
+		Description: "track jokes submitted upstream",
+		Up: execAll(`CREATE TABLE submissions (
+			joke_id INTEGER NOT NULL REFERENCES jokes (id) ON DELETE CASCADE,
+			target TEXT NOT NULL,
+			submitted_at DATETIME NOT NULL,
+			error TEXT NOT NULL DEFAULT '',
+			PRIMARY KEY (joke_id, target)
+		)`),
+		Down: execAll("DROP TABLE submissions"),
+	},
+	{
+		Version:     13,
+		Description: "keep the quiz score",
+		// Answers outlive their jokes, so deleting jokes doesn't lower the
+		// score
+		Up: execAll(`CREATE TABLE quiz_answers (
+			id INTEGER PRIMARY KEY,
+			joke_id INTEGER NOT NULL,
+			guess TEXT NOT NULL,
+			correct BOOLEAN NOT NULL,
+			answered_at DATETIME NOT NULL
+		)`),
+		Down: execAll("DROP TABLE quiz_answers"),
+	},
+	{
+		Version:     14,
+		Description: "keep every time a joke is told",
+		// Jokes told so far count once, when they were last told
+		Up: execAll(`CREATE TABLE tellings (
+			id INTEGER PRIMARY KEY,
+			joke_id INTEGER NOT NULL,
+			source TEXT NOT NULL,
+			language TEXT NOT NULL,
+			length INTEGER NOT NULL,
+			told_at DATETIME NOT NULL
+		)`,
+			`INSERT INTO tellings (joke_id, source, language, length, told_at)
+			SELECT id, source, language, length(joke), told_at FROM jokes WHERE told_at IS NOT NULL ORDER BY told_at`),
+		Down: execAll("DROP TABLE tellings"),
+	},
+	{
+		Version:     15,
+		Description: "keep API keys of the server",
+		Up: execAll(`CREATE TABLE api_keys (
+			id INTEGER PRIMARY KEY,
+			name TEXT NOT NULL UNIQUE,
+			hash TEXT NOT NULL UNIQUE,
+			rate_limit INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME NOT NULL,
+			revoked_at DATETIME
+		)`),
+		Down: execAll("DROP TABLE api_keys"),
+	},
+}
+
+// LatestSchemaVersion returns the schema version this package expects
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// execAll returns a migration step running the statements in order
+func execAll(stmts ...string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, stmt := range stmts {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// addColumn adds a column to table unless it already exists
+func addColumn(tx *sql.Tx, table, column, def string) error {
+	var count int
+	err := tx.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err = tx.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + def)
+	return err
+}
+
+// SchemaVersion returns the version of the last applied migration, or 0
+// for an empty database
+func (s *SQLiteStore) SchemaVersion() (int, error) {
+	if _, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		return 0, fmt.Errorf("error creating schema_version table: %w", err)
+	}
+
+	var version int
+	if err := s.db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version); err != nil {
+		return 0, fmt.Errorf("error reading schema version: %w", err)
+	}
+	return version, nil
+}
+
+// Migrate brings the schema up to the latest version
+func (s *SQLiteStore) Migrate() error {
+	return s.MigrateTo(LatestSchemaVersion())
+}
+
+// MigrateTo applies or reverts migrations until the schema is at version
+func (s *SQLiteStore) MigrateTo(version int) error {
+	if version < 0 || version > LatestSchemaVersion() {
+		return fmt.Errorf("unknown schema version %d (latest is %d)", version, LatestSchemaVersion())
+	}
+
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if current > LatestSchemaVersion() {
+		return fmt.Errorf("database schema version %d is newer than this version of godad supports (%d)", current, LatestSchemaVersion())
+	}
+
+	// Upgrade
+	for _, m := range migrations {
+		if m.Version <= current || m.Version > version {
+			continue
+		}
+		if err := s.applyMigration(m, m.Up, "INSERT INTO schema_version (version) VALUES (?)"); err != nil {
+			return err
+		}
+		log.Debug().Int("version", m.Version).Str("migration", m.Description).Msg("Applied migration")
+	}
+
+	// Downgrade, newest first
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.Version > current || m.Version <= version {
+			continue
+		}
+		if err := s.applyMigration(m, m.Down, "DELETE FROM schema_version WHERE version = ?"); err != nil {
+			return err
+		}
+		log.Debug().Int("version", m.Version).Str("migration", m.Description).Msg("Reverted migration")
+	}
+
+	return nil
+}
+
+// applyMigration runs step and records the result in a single transaction
+func (s *SQLiteStore) applyMigration(m Migration, step func(tx *sql.Tx) error, record string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting migration %d: %w", m.Version, err)
+	}
+	// Rolling back after a commit is a no-op
+	defer func() { _ = tx.Rollback() }()
+
+	if err := step(tx); err != nil {
+		return fmt.Errorf("error in migration %d (%s): %w", m.Version, m.Description, err)
+	}
+	if _, err := tx.Exec(record, m.Version); err != nil {
+		return fmt.Errorf("error recording migration %d: %w", m.Version, err)
+	}
+	return tx.Commit()
+}
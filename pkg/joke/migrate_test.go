@@ -0,0 +1,67 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMigrateDownAndUp(t *testing.T) {
+	skipWithoutDropColumn(t)
+	store := newTestStore(t)
+
+	version, err := store.SchemaVersion()
+	if err != nil {
+		t.Fatalf("SchemaVersion() returned an error: %v", err)
+	}
+	if version != LatestSchemaVersion() {
+		t.Fatalf("SchemaVersion() = %d, want %d", version, LatestSchemaVersion())
+	}
+
+	if err := store.MigrateTo(0); err != nil {
+		t.Fatalf("MigrateTo(0) returned an error: %v", err)
+	}
+	if version, _ := store.SchemaVersion(); version != 0 {
+		t.Errorf("SchemaVersion() after MigrateTo(0) = %d, want 0", version)
+	}
+	var tables int
+	if err := store.DB().QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'jokes'").Scan(&tables); err != nil {
+		t.Fatalf("Error querying tables: %v", err)
+	}
+	if tables != 0 {
+		t.Errorf("jokes table still exists after MigrateTo(0)")
+	}
+
+	if err := store.Migrate(); err != nil {
+		t.Fatalf("Migrate() returned an error: %v", err)
+	}
+	j := Joke{Text: "A joke", Source: "test"}
+	if err := store.Save(context.Background(), &j); err != nil {
+		t.Errorf("Save() after migrating up returned an error: %v", err)
+	}
+}
+
+func TestMigrateRejectsNewerSchema(t *testing.T) {
+	store := newTestStore(t)
+
+	if _, err := store.DB().Exec("INSERT INTO schema_version (version) VALUES (?)", LatestSchemaVersion()+1); err != nil {
+		t.Fatalf("Error recording a future version: %v", err)
+	}
+	if err := store.Migrate(); err == nil {
+		t.Errorf("Migrate() accepted a schema newer than it supports")
+	}
+	if err := store.MigrateTo(LatestSchemaVersion() + 1); err == nil {
+		t.Errorf("MigrateTo() accepted an unknown version")
+	}
+}
+
+// skipWithoutDropColumn skips tests of downgrades with SQLCipher, whose
+// SQLite is too old to drop columns
+func skipWithoutDropColumn(t *testing.T) {
+	t.Helper()
+	if EncryptionSupported {
+		t.Skip("SQLCipher's SQLite can't drop columns")
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strings"
+)
+
+// MixedEngine is the engine of one language in a mix, see Engine.Mix
+type MixedEngine struct {
+	Engine *Engine
+	// Weight is the share of the jokes the engine tells, relative to the
+	// other engines of the mix
+	Weight float64
+}
+
+// NewMix returns an engine telling jokes in several languages, each by
+// one of engines. Its Language lists their languages, comma separated.
+func NewMix(store Store, engines ...MixedEngine) *Engine {
+	langs := make([]string, 0, len(engines))
+	for _, m := range engines {
+		langs = append(langs, m.Engine.Language)
+	}
+	e := NewEngine(store)
+	e.Language = strings.Join(langs, ",")
+	e.Mix = engines
+	return e
+}
+
+// mixed returns the engines of the mix in a random order, where an engine
+// with twice the weight comes first twice as often
+func (e *Engine) mixed() []*Engine {
+	remaining := slices.Clone(e.Mix)
+	order := make([]*Engine, 0, len(remaining))
+	for len(remaining) > 0 {
+		total := 0.0
+		for _, m := range remaining {
+			total += max(m.Weight, 0)
+		}
+		pick := 0
+		// #nosec G404 -- picking a language does not need a secure random number
+		r := rand.Float64() * total
+		for i, m := range remaining {
+			if r -= max(m.Weight, 0); r < 0 {
+				pick = i
+				break
+			}
+		}
+		order = append(order, remaining[pick].Engine)
+		remaining = slices.Delete(remaining, pick, pick+1)
+	}
+	return order
+}
+
+// shares splits count among the engines of the mix in proportion to their
+// weights, handing out what rounding leaves over at random
+func (e *Engine) shares(count int) map[*Engine]int {
+	total := 0.0
+	for _, m := range e.Mix {
+		total += max(m.Weight, 0)
+	}
+	shares := make(map[*Engine]int, len(e.Mix))
+	left := count
+	if total > 0 {
+		for _, m := range e.Mix {
+			n := int(math.Floor(float64(count) * max(m.Weight, 0) / total))
+			shares[m.Engine] = n
+			left -= n
+		}
+	}
+	for left > 0 {
+		for _, engine := range e.mixed() {
+			if left == 0 {
+				break
+			}
+			shares[engine]++
+			left--
+		}
+	}
+	return shares
+}
+
+// tellMixed tells a joke with fn from the engines of the mix, trying them
+// in random order until one of them can
+func (e *Engine) tellMixed(ctx context.Context, fn func(*Engine) (Joke, error)) (Joke, error) {
+	var errs []error
+	for _, engine := range e.mixed() {
+		j, err := fn(engine)
+		if err == nil {
+			return j, nil
+		}
+		if ctx.Err() != nil {
+			return Joke{}, ctx.Err()
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", engine.Language, err))
+	}
+	return Joke{}, errors.Join(errs...)
+}
+
+// prefetchMixed prefetches count jokes with the engines of the mix, each
+// its share by weight
+func (e *Engine) prefetchMixed(ctx context.Context, count int, progress func(stored int)) (int, error) {
+	stored := 0
+	var errs []error
+	for engine, n := range e.shares(count) {
+		if n == 0 {
+			continue
+		}
+		var engineProgress func(int)
+		if progress != nil {
+			engineProgress = func(got int) { progress(stored + got) }
+		}
+		got, err := engine.Prefetch(ctx, n, engineProgress)
+		stored += got
+		if err != nil {
+			if ctx.Err() != nil {
+				return stored, ctx.Err()
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", engine.Language, err))
+		}
+	}
+	return stored, errors.Join(errs...)
+}
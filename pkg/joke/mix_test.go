@@ -0,0 +1,71 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+// languageSource returns a numbered joke in its language on every fetch
+type languageSource struct {
+	lang string
+	n    atomic.Int64
+}
+
+func (s *languageSource) Name() string     { return "numbers-" + s.lang }
+func (s *languageSource) Language() string { return s.lang }
+
+func (s *languageSource) Fetch(_ context.Context) (Joke, error) {
+	return Joke{Text: fmt.Sprintf("%s joke number %d", s.lang, s.n.Add(1))}, nil
+}
+
+func TestMixTell(t *testing.T) {
+	store := newTestStore(t)
+	en, de := &languageSource{lang: "en"}, &languageSource{lang: "de"}
+	engine := NewMix(store,
+		MixedEngine{Engine: NewEngine(store, en), Weight: 3},
+		MixedEngine{Engine: NewEngine(store, de), Weight: 0},
+	)
+	if engine.Language != "en,de" {
+		t.Errorf("Language = %q, want en,de", engine.Language)
+	}
+
+	for i := 0; i < 5; i++ {
+		j, err := engine.Tell(context.Background())
+		if err != nil {
+			t.Fatalf("Tell() returned an error: %v", err)
+		}
+		if j.Language != "en" {
+			t.Errorf("Tell() returned %+v, want no jokes from a language weighted 0", j)
+		}
+	}
+
+	engine.Mix[1].Weight = 1
+	if _, err := engine.TellMany(context.Background(), 40); err != nil {
+		t.Fatalf("TellMany() returned an error: %v", err)
+	}
+	if en.n.Load() <= de.n.Load() || de.n.Load() == 0 {
+		t.Errorf("told %d English and %d German jokes, want about three times as many English ones", en.n.Load(), de.n.Load())
+	}
+}
+
+func TestMixPrefetch(t *testing.T) {
+	store := newTestStore(t)
+	en, de := &languageSource{lang: "en"}, &languageSource{lang: "de"}
+	engine := NewMix(store,
+		MixedEngine{Engine: NewEngine(store, en), Weight: 3},
+		MixedEngine{Engine: NewEngine(store, de), Weight: 1},
+	)
+
+	n, err := engine.Prefetch(context.Background(), 8, nil)
+	if err != nil {
+		t.Fatalf("Prefetch() returned an error: %v", err)
+	}
+	if n != 8 || en.n.Load() != 6 || de.n.Load() != 2 {
+		t.Errorf("Prefetch() stored %d jokes, %d English and %d German, want 6 and 2", n, en.n.Load(), de.n.Load())
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"time"
+)
+
+// Observer is told how a store and the sources of an engine perform, e.g.
+// to export metrics of a server
+type Observer interface {
+	// ObserveQuery is told about every call of a Store method, by the
+	// name of the method
+	ObserveQuery(method string, duration time.Duration, err error)
+	// ObserveFetch is told about every fetch from a source
+	ObserveFetch(source string, latency time.Duration, err error)
+	// ObserveCache is told whether a lookup in a cache found what it was
+	// looking for
+	ObserveCache(hit bool)
+}
+
+// ObservedStore is a Store telling an Observer how long its calls take
+// and how the fetches recorded with it went
+type ObservedStore struct {
+	wrappedStore
+	observer Observer
+}
+
+// NewObservedStore returns store, telling o about every call
+func NewObservedStore(store Store, o Observer) *ObservedStore {
+	return &ObservedStore{wrappedStore: wrappedStore{store}, observer: o}
+}
+
+// observe tells the observer about a call of method that started at start
+func (s *ObservedStore) observe(method string, start time.Time, err error) {
+	s.observer.ObserveQuery(method, time.Since(start), err)
+}
+
+// Exists implements Store
+func (s *ObservedStore) Exists(ctx context.Context, j Joke) (bool, error) {
+	start := time.Now()
+	ok, err := s.Store.Exists(ctx, j)
+	s.observe("Exists", start, err)
+	return ok, err
+}
+
+// Save implements Store
+func (s *ObservedStore) Save(ctx context.Context, j *Joke) error {
+	start := time.Now()
+	err := s.Store.Save(ctx, j)
+	s.observe("Save", start, err)
+	return err
+}
+
+// NextUntold implements Store
+func (s *ObservedStore) NextUntold(ctx context.Context, lang string) (Joke, error) {
+	start := time.Now()
+	j, err := s.Store.NextUntold(ctx, lang)
+	s.observe("NextUntold", start, err)
+	return j, err
+}
+
+// MarkTold implements Store
+func (s *ObservedStore) MarkTold(ctx context.Context, j *Joke) error {
+	start := time.Now()
+	err := s.Store.MarkTold(ctx, j)
+	s.observe("MarkTold", start, err)
+	return err
+}
+
+// Find implements Store
+func (s *ObservedStore) Find(ctx context.Context, j Joke) (Joke, error) {
+	start := time.Now()
+	found, err := s.Store.Find(ctx, j)
+	s.observe("Find", start, err)
+	return found, err
+}
+
+// LeastRecentlyTold implements Store
+func (s *ObservedStore) LeastRecentlyTold(ctx context.Context, lang string, before time.Time) (Joke, error) {
+	start := time.Now()
+	j, err := s.Store.LeastRecentlyTold(ctx, lang, before)
+	s.observe("LeastRecentlyTold", start, err)
+	return j, err
+}
+
+// Get implements Store
+func (s *ObservedStore) Get(ctx context.Context, id int64) (Joke, error) {
+	start := time.Now()
+	j, err := s.Store.Get(ctx, id)
+	s.observe("Get", start, err)
+	return j, err
+}
+
+// Rate implements Store
+func (s *ObservedStore) Rate(ctx context.Context, id int64, rating int) error {
+	start := time.Now()
+	err := s.Store.Rate(ctx, id, rating)
+	s.observe("Rate", start, err)
+	return err
+}
+
+// Random implements Store
+func (s *ObservedStore) Random(ctx context.Context) (Joke, error) {
+	start := time.Now()
+	j, err := s.Store.Random(ctx)
+	s.observe("Random", start, err)
+	return j, err
+}
+
+// RandomIn implements Store
+func (s *ObservedStore) RandomIn(ctx context.Context, lang string) (Joke, error) {
+	start := time.Now()
+	j, err := s.Store.RandomIn(ctx, lang)
+	s.observe("RandomIn", start, err)
+	return j, err
+}
+
+// RandomTagged implements Store
+func (s *ObservedStore) RandomTagged(ctx context.Context, tag string) (Joke, error) {
+	start := time.Now()
+	j, err := s.Store.RandomTagged(ctx, tag)
+	s.observe("RandomTagged", start, err)
+	return j, err
+}
+
+// AddTags implements Store
+func (s *ObservedStore) AddTags(ctx context.Context, id int64, tags ...string) error {
+	start := time.Now()
+	err := s.Store.AddTags(ctx, id, tags...)
+	s.observe("AddTags", start, err)
+	return err
+}
+
+// RemoveTags implements Store
+func (s *ObservedStore) RemoveTags(ctx context.Context, id int64, tags ...string) error {
+	start := time.Now()
+	err := s.Store.RemoveTags(ctx, id, tags...)
+	s.observe("RemoveTags", start, err)
+	return err
+}
+
+// Tags implements Store
+func (s *ObservedStore) Tags(ctx context.Context) ([]TagCount, error) {
+	start := time.Now()
+	tags, err := s.Store.Tags(ctx)
+	s.observe("Tags", start, err)
+	return tags, err
+}
+
+// History implements Store
+func (s *ObservedStore) History(ctx context.Context, f HistoryFilter) ([]Joke, error) {
+	start := time.Now()
+	jokes, err := s.Store.History(ctx, f)
+	s.observe("History", start, err)
+	return jokes, err
+}
+
+// Claim implements ClaimStore
+func (s *ObservedStore) Claim(ctx context.Context, j *Joke) (bool, error) {
+	claimer, ok := s.Store.(ClaimStore)
+	if !ok {
+		return true, s.MarkTold(ctx, j)
+	}
+	start := time.Now()
+	claimed, err := claimer.Claim(ctx, j)
+	s.observe("Claim", start, err)
+	return claimed, err
+}
+
+// CountUntold implements StockStore
+func (s *ObservedStore) CountUntold(ctx context.Context, lang string) (int, error) {
+	start := time.Now()
+	n, err := s.wrappedStore.CountUntold(ctx, lang)
+	s.observe("CountUntold", start, err)
+	return n, err
+}
+
+// Search implements Searcher
+func (s *ObservedStore) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	start := time.Now()
+	results, err := s.wrappedStore.Search(ctx, query, limit)
+	s.observe("Search", start, err)
+	return results, err
+}
+
+// Tellings implements StatsStore
+func (s *ObservedStore) Tellings(ctx context.Context) ([]Telling, error) {
+	start := time.Now()
+	tellings, err := s.wrappedStore.Tellings(ctx)
+	s.observe("Tellings", start, err)
+	return tellings, err
+}
+
+// Filtered implements FilterStore. The filtered store is observed as well.
+func (s *ObservedStore) Filtered(f Filter) Store {
+	if filtered, ok := s.Store.(FilterStore); ok {
+		return NewObservedStore(filtered.Filtered(f), s.observer)
+	}
+	return s
+}
+
+// RecordFetch implements HealthStore
+func (s *ObservedStore) RecordFetch(ctx context.Context, source string, latency time.Duration, err error) error {
+	s.observer.ObserveFetch(source, latency, err)
+	return s.wrappedStore.RecordFetch(ctx, source, latency, err)
+}
+
+var (
+	_ HealthStore      = (*ObservedStore)(nil)
+	_ LimitStore       = (*ObservedStore)(nil)
+	_ TranslationStore = (*ObservedStore)(nil)
+	_ EmbeddingStore   = (*ObservedStore)(nil)
+	_ FilterStore      = (*ObservedStore)(nil)
+	_ ClaimStore       = (*ObservedStore)(nil)
+	_ StockStore       = (*ObservedStore)(nil)
+	_ Searcher         = (*ObservedStore)(nil)
+	_ StatsStore       = (*ObservedStore)(nil)
+)
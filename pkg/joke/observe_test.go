@@ -0,0 +1,105 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingObserver remembers what it was told
+type recordingObserver struct {
+	mu       sync.Mutex
+	queries  []string
+	fetches  []string
+	failures int
+	hits     []bool
+}
+
+func (o *recordingObserver) ObserveQuery(method string, _ time.Duration, _ error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.queries = append(o.queries, method)
+}
+
+func (o *recordingObserver) ObserveFetch(source string, _ time.Duration, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.fetches = append(o.fetches, source)
+	if err != nil {
+		o.failures++
+	}
+}
+
+func (o *recordingObserver) ObserveCache(hit bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.hits = append(o.hits, hit)
+}
+
+func TestObservedStore(t *testing.T) {
+	ctx := context.Background()
+	base := newTestStore(t)
+	var o recordingObserver
+	store := NewObservedStore(base, &o)
+
+	j := Joke{Text: "An observed joke", Source: "user", Language: "en"}
+	if err := store.Save(ctx, &j); err != nil {
+		t.Fatalf("Save() returned an error: %v", err)
+	}
+	if _, err := store.Get(ctx, j.ID); err != nil {
+		t.Fatalf("Get() returned an error: %v", err)
+	}
+	if claimed, err := store.Claim(ctx, &j); !claimed || err != nil {
+		t.Fatalf("Claim() = %v, %v, want the joke claimed", claimed, err)
+	}
+	if want := []string{"Save", "Get", "Claim"}; !slices.Equal(o.queries, want) {
+		t.Errorf("The observer was told about %v, want %v", o.queries, want)
+	}
+
+	// Fetches are observed and recorded in the store
+	if err := store.RecordFetch(ctx, "icanhazdadjoke", time.Second, nil); err != nil {
+		t.Fatalf("RecordFetch() returned an error: %v", err)
+	}
+	if err := store.RecordFetch(ctx, "icanhazdadjoke", time.Second, errors.New("timeout")); err != nil {
+		t.Fatalf("RecordFetch() returned an error: %v", err)
+	}
+	if len(o.fetches) != 2 || o.failures != 1 {
+		t.Errorf("The observer was told about fetches %v with %d failures, want 2 with 1", o.fetches, o.failures)
+	}
+	if health, err := base.SourceHealth(ctx, "icanhazdadjoke"); err != nil || health.Failures != 1 || health.LastSuccess == nil {
+		t.Errorf("SourceHealth() = %+v, %v, want the fetches recorded", health, err)
+	}
+
+	// Filtered stores are observed as well
+	o.queries = nil
+	if _, err := store.Filtered(Filter{MaxLength: 5}).NextUntold(ctx, "en"); !errors.Is(err, ErrNoJokes) {
+		t.Errorf("NextUntold() of the filtered store returned %v, want ErrNoJokes", err)
+	}
+	if !slices.Equal(o.queries, []string{"NextUntold"}) {
+		t.Errorf("The observer was told about %v, want the filtered NextUntold", o.queries)
+	}
+}
+
+func TestRedisCacheObserver(t *testing.T) {
+	ctx := context.Background()
+	cache, _, _ := newTestRedisCache(t)
+	var o recordingObserver
+	cache.Observer = &o
+
+	j := Joke{Text: "A cached joke", Source: "user", Language: "en"}
+	if err := cache.Save(ctx, &j); err != nil {
+		t.Fatalf("Save() returned an error: %v", err)
+	}
+	_, _ = cache.Get(ctx, j.ID)
+	_, _ = cache.Get(ctx, j.ID)
+	_, _ = cache.Exists(ctx, j)
+	if want := []bool{false, true, true}; !slices.Equal(o.hits, want) {
+		t.Errorf("The observer was told about cache hits %v, want %v", o.hits, want)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// OfficialJokeAPIURL is the default endpoint of the Official Joke API
+const OfficialJokeAPIURL = "https://official-joke-api.appspot.com/"
+
+// officialJokeAPIBatchSize is how many jokes the batch endpoint returns
+const officialJokeAPIBatchSize = 10
+
+// OfficialJokeAPI fetches English jokes with a setup and a punchline from
+// the Official Joke API
+type OfficialJokeAPI struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewOfficialJokeAPI returns a source using the public Official Joke API
+func NewOfficialJokeAPI() *OfficialJokeAPI {
+	return &OfficialJokeAPI{
+		URL:    OfficialJokeAPIURL,
+		Client: DefaultHTTPClient,
+	}
+}
+
+// Name implements Source
+func (s *OfficialJokeAPI) Name() string {
+	return "official-joke-api"
+}
+
+// Language implements Source
+func (s *OfficialJokeAPI) Language() string {
+	return "en"
+}
+
+// officialJoke is a joke as returned by the Official Joke API
+type officialJoke struct {
+	ID        int    `json:"id"`
+	Setup     string `json:"setup"`
+	Punchline string `json:"punchline"`
+}
+
+// Fetch implements Source
+func (s *OfficialJokeAPI) Fetch(ctx context.Context) (Joke, error) {
+	var r officialJoke
+	if err := s.get(ctx, "random_joke", &r); err != nil {
+		return Joke{}, err
+	}
+	return s.joke(r)
+}
+
+// FetchBatch implements BatchSource. The API returns 10 jokes per request.
+func (s *OfficialJokeAPI) FetchBatch(ctx context.Context, n int) ([]Joke, error) {
+	var resp []officialJoke
+	if err := s.get(ctx, "random_ten", &resp); err != nil {
+		return nil, err
+	}
+
+	jokes := make([]Joke, 0, officialJokeAPIBatchSize)
+	for _, r := range resp {
+		if j, err := s.joke(r); err == nil {
+			jokes = append(jokes, j)
+		}
+	}
+	if len(jokes) == 0 {
+		return nil, errors.New("no jokes in response")
+	}
+	return jokes[:min(max(n, 1), len(jokes))], nil
+}
+
+// FetchID implements IDSource
+func (s *OfficialJokeAPI) FetchID(ctx context.Context, id string) (Joke, error) {
+	if _, err := strconv.Atoi(id); err != nil {
+		return Joke{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	var r officialJoke
+	err := s.get(ctx, "jokes/"+id, &r)
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return Joke{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return Joke{}, err
+	}
+	return s.joke(r)
+}
+
+// joke converts an API response to a Joke
+func (s *OfficialJokeAPI) joke(r officialJoke) (Joke, error) {
+	if r.Setup == "" || r.Punchline == "" {
+		return Joke{}, errors.New("joke without setup or punchline")
+	}
+	return Joke{
+		Text:       twoPart(r.Setup, r.Punchline),
+		UpstreamID: strconv.Itoa(r.ID),
+		Source:     s.Name(),
+		Language:   s.Language(),
+	}, nil
+}
+
+// get requests path and decodes the JSON response into v
+func (s *OfficialJokeAPI) get(ctx context.Context, path string, v any) error {
+	endpoint, err := url.JoinPath(s.URL, path)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp); err != nil {
+		return err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response body: %w", err)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("error parsing JSON: %w", err)
+	}
+	return nil
+}
+
+var (
+	_ BatchSource = (*OfficialJokeAPI)(nil)
+	_ IDSource    = (*OfficialJokeAPI)(nil)
+)
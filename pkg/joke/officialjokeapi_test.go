@@ -0,0 +1,74 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOfficialJokeAPI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/random_joke", "/jokes/1":
+			_, _ = w.Write([]byte(`{"type": "general", "setup": "What do you call a belt made of watches?", "punchline": "A waist of time.", "id": 1}`))
+		case "/random_ten":
+			_, _ = w.Write([]byte(`[
+				{"type": "general", "setup": "Setup one?", "punchline": "Punchline one.", "id": 2},
+				{"type": "general", "setup": "", "punchline": "Broken.", "id": 3},
+				{"type": "dad", "setup": "Setup two?", "punchline": "Punchline two.", "id": 4}
+			]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	src := NewOfficialJokeAPI()
+	src.URL = server.URL
+
+	j, err := src.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch() returned an error: %v", err)
+	}
+	if j.Text != "What do you call a belt made of watches?\nA waist of time." || j.UpstreamID != "1" {
+		t.Errorf("Fetch() = %+v, want the setup and punchline on two lines", j)
+	}
+
+	jokes, err := src.FetchBatch(context.Background(), 5)
+	if err != nil {
+		t.Fatalf("FetchBatch() returned an error: %v", err)
+	}
+	if len(jokes) != 2 || jokes[1].UpstreamID != "4" {
+		t.Errorf("FetchBatch() = %+v, want the two complete jokes", jokes)
+	}
+
+	if _, err := src.FetchID(context.Background(), "1"); err != nil {
+		t.Errorf("FetchID(1) returned an error: %v", err)
+	}
+	if _, err := src.FetchID(context.Background(), "404"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("FetchID(404) returned %v, want ErrNotFound", err)
+	}
+}
+
+func TestGeekJokes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"joke": "There are 10 kinds of people. "}`))
+	}))
+	defer server.Close()
+	src := NewGeekJokes()
+	src.URL = server.URL
+
+	j, err := src.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch() returned an error: %v", err)
+	}
+	if j.Text != "There are 10 kinds of people." || j.Source != "geek-jokes" {
+		t.Errorf("Fetch() = %+v, want the trimmed joke from geek-jokes", j)
+	}
+}
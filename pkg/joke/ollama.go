@@ -0,0 +1,23 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+// OllamaURL is the OpenAI compatible API of a local Ollama server
+const OllamaURL = "http://localhost:11434/v1"
+
+// DefaultOllamaModel is the model Ollama sources use unless told otherwise
+const DefaultOllamaModel = "llama3.2"
+
+// NewOllama returns a source called name making up jokes in lang with
+// model on the Ollama server at url, or the local one if url is empty. No
+// API key or internet access is needed.
+func NewOllama(name, lang, url, model string) *LLMSource {
+	if url == "" {
+		url = OllamaURL
+	}
+	if model == "" {
+		model = DefaultOllamaModel
+	}
+	return NewLLMSource(name, lang, url, model)
+}
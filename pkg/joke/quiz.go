@@ -0,0 +1,129 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// QuizAnswer records a guess at the punchline of a joke
+type QuizAnswer struct {
+	JokeID     int64     `json:"joke_id"`
+	Guess      string    `json:"guess"`
+	Correct    bool      `json:"correct"`
+	AnsweredAt time.Time `json:"answered_at"`
+}
+
+// QuizScore sums up the guesses at punchlines so far
+type QuizScore struct {
+	Answered int `json:"answered"`
+	Correct  int `json:"correct"`
+	// Streak counts the correct guesses since the last wrong one, and
+	// BestStreak the most correct guesses in a row ever
+	Streak     int `json:"streak"`
+	BestStreak int `json:"best_streak"`
+}
+
+// QuizStore is a Store that keeps the score of guessing punchlines. The
+// answers are kept when their jokes are deleted.
+type QuizStore interface {
+	Store
+	// RecordAnswer stores a guess
+	RecordAnswer(ctx context.Context, a QuizAnswer) error
+	// QuizScore returns the score of every guess so far
+	QuizScore(ctx context.Context) (QuizScore, error)
+}
+
+// minGuessWord is the length of the shortest words that count when
+// comparing guesses, so "a", "the" and "his" don't make a guess right
+const minGuessWord = 4
+
+// GuessMatches reports whether guess gets the punchline right. Case,
+// punctuation and word order don't matter, and a guess counts when it has
+// at least half of the words of the punchline that aren't short filler
+// words.
+func GuessMatches(guess, punchline string) bool {
+	guess, punchline = NormalizeText(guess), NormalizeText(punchline)
+	if guess == "" {
+		return false
+	}
+	if guess == punchline {
+		return true
+	}
+	guessed := strings.Fields(guess)
+	punchWords := strings.Fields(punchline)
+	slices.Sort(punchWords)
+	var words, found int
+	for _, w := range slices.Compact(punchWords) {
+		if utf8.RuneCountInString(w) < minGuessWord {
+			continue
+		}
+		words++
+		if slices.Contains(guessed, w) {
+			found++
+		}
+	}
+	return words > 0 && found*2 >= words
+}
+
+// scoreAnswers returns the score of guesses that were correct or not, in
+// the order they were made
+func scoreAnswers(correct []bool) QuizScore {
+	var score QuizScore
+	for _, c := range correct {
+		score.Answered++
+		if !c {
+			score.Streak = 0
+			continue
+		}
+		score.Correct++
+		score.Streak++
+		score.BestStreak = max(score.BestStreak, score.Streak)
+	}
+	return score
+}
+
+// RecordAnswer implements QuizStore
+func (s *SQLiteStore) RecordAnswer(ctx context.Context, a QuizAnswer) error {
+	if _, err := s.db.ExecContext(ctx, "INSERT INTO quiz_answers (joke_id, guess, correct, answered_at) VALUES (?, ?, ?, ?)",
+		a.JokeID, a.Guess, a.Correct, a.AnsweredAt.UTC()); err != nil {
+		return fmt.Errorf("error recording answer: %w", err)
+	}
+	return nil
+}
+
+// QuizScore implements QuizStore
+func (s *SQLiteStore) QuizScore(ctx context.Context) (QuizScore, error) {
+	return queryQuizScore(ctx, s.db, "SELECT correct FROM quiz_answers ORDER BY answered_at, id")
+}
+
+// queryQuizScore returns the score of the answers query returns, oldest
+// first
+func queryQuizScore(ctx context.Context, db queryer, query string) (QuizScore, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return QuizScore{}, fmt.Errorf("error getting quiz score: %w", err)
+	}
+	defer rows.Close()
+
+	var correct []bool
+	for rows.Next() {
+		var c bool
+		if err := rows.Scan(&c); err != nil {
+			return QuizScore{}, fmt.Errorf("error reading answer: %w", err)
+		}
+		correct = append(correct, c)
+	}
+	if err := rows.Err(); err != nil {
+		return QuizScore{}, fmt.Errorf("error getting quiz score: %w", err)
+	}
+	return scoreAnswers(correct), nil
+}
+
+var _ QuizStore = (*SQLiteStore)(nil)
@@ -0,0 +1,52 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGuessMatches(t *testing.T) {
+	punchline := "Because he was outstanding in his field!"
+	for _, tc := range []struct {
+		guess string
+		want  bool
+	}{
+		{guess: "because he was outstanding in his field", want: true},
+		{guess: "He was OUTSTANDING in his field", want: true},
+		{guess: "outstanding field", want: true},
+		{guess: "he was in his", want: false},
+		{guess: "a field", want: false},
+		{guess: "", want: false},
+	} {
+		if got := GuessMatches(tc.guess, punchline); got != tc.want {
+			t.Errorf("GuessMatches(%q) = %v, want %v", tc.guess, got, tc.want)
+		}
+	}
+	if !GuessMatches("to be", "To be!") || GuessMatches("or not", "To be!") {
+		t.Error("GuessMatches() of a punchline of short words doesn't compare the whole text")
+	}
+}
+
+func TestSQLiteQuizScore(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	if score, err := store.QuizScore(ctx); err != nil || score != (QuizScore{}) {
+		t.Errorf("QuizScore() without answers = %+v, %v, want zero", score, err)
+	}
+	now := time.Now()
+	for i, correct := range []bool{true, false, true, true, true, false, true} {
+		answer := QuizAnswer{JokeID: 1, Guess: "a guess", Correct: correct, AnsweredAt: now.Add(time.Duration(i) * time.Second)}
+		if err := store.RecordAnswer(ctx, answer); err != nil {
+			t.Fatalf("RecordAnswer() returned an error: %v", err)
+		}
+	}
+	want := QuizScore{Answered: 7, Correct: 5, Streak: 1, BestStreak: 3}
+	if score, err := store.QuizScore(ctx); err != nil || score != want {
+		t.Errorf("QuizScore() = %+v, %v, want %+v", score, err, want)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrRateLimited is returned instead of fetching from a source whose rate
+// limit would make the fetch wait too long
+var ErrRateLimited = errors.New("rate limited")
+
+// RateLimit allows Requests requests to a source per Per, in bursts of up
+// to Requests
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// DefaultRateLimits are the rate limits of the built-in sources, kept well
+// within what the public APIs allow
+var DefaultRateLimits = map[string]RateLimit{
+	"icanhazdadjoke":    {Requests: 60, Per: time.Minute},
+	"official-joke-api": {Requests: 60, Per: time.Minute},
+	"geek-jokes":        {Requests: 60, Per: time.Minute},
+	"witzapi":           {Requests: 60, Per: time.Minute},
+}
+
+// LimitStore is a Store that keeps the rate limits of sources, so they are
+// shared by every process using the store
+type LimitStore interface {
+	Store
+	// TakeToken takes a token from the bucket of source, which holds up
+	// to limit.Requests tokens and refills at limit. It returns how long
+	// to wait until a token is available, in which case none was taken,
+	// or until the source is no longer blocked.
+	TakeToken(ctx context.Context, source string, limit RateLimit) (time.Duration, error)
+	// BlockSource makes TakeToken wait until the given time, e.g. because
+	// the upstream asked to wait
+	BlockSource(ctx context.Context, source string, until time.Time) error
+}
+
+// TakeToken implements LimitStore
+func (s *SQLiteStore) TakeToken(ctx context.Context, source string, limit RateLimit) (time.Duration, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error taking rate limit token: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	now := time.Now().UTC()
+	// Writing first locks the database, so concurrent processes can't take
+	// the same token
+	if _, err := tx.ExecContext(ctx, "INSERT INTO rate_limits (source, tokens, updated_at) VALUES (?, ?, ?) ON CONFLICT (source) DO NOTHING",
+		source, limit.Requests, now); err != nil {
+		return 0, fmt.Errorf("error taking rate limit token: %w", err)
+	}
+	var (
+		tokens       float64
+		updatedAt    time.Time
+		blockedUntil sql.NullTime
+	)
+	if err := tx.QueryRowContext(ctx, "SELECT tokens, updated_at, blocked_until FROM rate_limits WHERE source = ?", source).
+		Scan(&tokens, &updatedAt, &blockedUntil); err != nil {
+		return 0, fmt.Errorf("error taking rate limit token: %w", err)
+	}
+	if blockedUntil.Valid && now.Before(blockedUntil.Time) {
+		return blockedUntil.Time.Sub(now), nil
+	}
+
+	wait := time.Duration(0)
+	if limit.Requests > 0 && limit.Per > 0 {
+		perToken := limit.Per / time.Duration(limit.Requests)
+		tokens = min(tokens+float64(now.Sub(updatedAt))/float64(perToken), float64(limit.Requests))
+		if tokens < 1 {
+			wait = time.Duration((1 - tokens) * float64(perToken))
+		} else {
+			tokens--
+		}
+	}
+	if wait > 0 {
+		return wait, nil
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE rate_limits SET tokens = ?, updated_at = ?, blocked_until = NULL WHERE source = ?", tokens, now, source); err != nil {
+		return 0, fmt.Errorf("error taking rate limit token: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error taking rate limit token: %w", err)
+	}
+	return 0, nil
+}
+
+// BlockSource implements LimitStore
+func (s *SQLiteStore) BlockSource(ctx context.Context, source string, until time.Time) error {
+	if _, err := s.db.ExecContext(ctx, `INSERT INTO rate_limits (source, tokens, updated_at, blocked_until) VALUES (?, 0, ?, ?)
+		ON CONFLICT (source) DO UPDATE SET tokens = 0, updated_at = excluded.updated_at, blocked_until = excluded.blocked_until`,
+		source, time.Now().UTC(), until.UTC()); err != nil {
+		return fmt.Errorf("error blocking source: %w", err)
+	}
+	return nil
+}
+
+var _ LimitStore = (*SQLiteStore)(nil)
@@ -0,0 +1,71 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTakeToken(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	limit := RateLimit{Requests: 2, Per: time.Hour}
+
+	for i := range 2 {
+		if wait, err := store.TakeToken(ctx, "api", limit); err != nil || wait != 0 {
+			t.Fatalf("TakeToken() #%d = %v, %v, want a token", i+1, wait, err)
+		}
+	}
+	wait, err := store.TakeToken(ctx, "api", limit)
+	if err != nil || wait <= 29*time.Minute || wait > 30*time.Minute {
+		t.Errorf("TakeToken() with an empty bucket = %v, %v, want about 30m", wait, err)
+	}
+
+	// Sources without a limit are only held up when blocked
+	if wait, err := store.TakeToken(ctx, "other", RateLimit{}); err != nil || wait != 0 {
+		t.Errorf("TakeToken() without a limit = %v, %v, want no wait", wait, err)
+	}
+	if err := store.BlockSource(ctx, "other", time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("BlockSource() returned an error: %v", err)
+	}
+	if wait, err := store.TakeToken(ctx, "other", RateLimit{}); err != nil || wait <= 0 || wait > time.Minute {
+		t.Errorf("TakeToken() of a blocked source = %v, %v, want up to 1m", wait, err)
+	}
+}
+
+func TestEngineRateLimits(t *testing.T) {
+	store := newTestStore(t)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	engine := NewEngine(store, newTestSource(server))
+	if _, err := engine.Fresh(context.Background()); err == nil {
+		t.Fatalf("Fresh() returned no error")
+	}
+	if requests != 1 {
+		t.Errorf("The server got %d requests, want 1 as it asked to wait longer than the backoff", requests)
+	}
+
+	// The next invocation doesn't even ask
+	engine = NewEngine(store, newTestSource(server))
+	if _, err := engine.Fresh(context.Background()); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Fresh() returned %v, want ErrRateLimited", err)
+	}
+	if requests != 1 {
+		t.Errorf("The server got %d requests, want no more while the source is blocked", requests)
+	}
+	if h, _ := store.SourceHealth(context.Background(), "icanhazdadjoke"); h.Failures != 1 {
+		t.Errorf("The source has %d failures, want 1 as skipped fetches don't count", h.Failures)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"time"
+)
+
+// readOnlyStore reads from a Store but never writes to it
+type readOnlyStore struct {
+	wrappedStore
+}
+
+// NewReadOnlyStore returns a Store that checks jokes against store but
+// never changes it, so jokes can be told without being remembered, e.g.
+// for demos and tests. Prefetched jokes are left alone for later, so an
+// engine with a read-only store always fetches fresh jokes. The health and
+// rate limits of sources and translations are still kept if store keeps
+// them.
+func NewReadOnlyStore(store Store) Store {
+	return readOnlyStore{wrappedStore{store}}
+}
+
+// Save implements Store. The joke is not stored and keeps a zero ID.
+func (readOnlyStore) Save(_ context.Context, j *Joke) error {
+	j.CreatedAt = time.Now()
+	return nil
+}
+
+// NextUntold implements Store. It never returns a joke, since telling it
+// would not use it up.
+func (readOnlyStore) NextUntold(context.Context, string) (Joke, error) {
+	return Joke{}, ErrNoJokes
+}
+
+// MarkTold implements Store. Only j is updated.
+func (readOnlyStore) MarkTold(_ context.Context, j *Joke) error {
+	now := time.Now()
+	j.ToldAt = &now
+	j.TimesTold++
+	return nil
+}
+
+// Rate implements Store and does nothing
+func (readOnlyStore) Rate(context.Context, int64, int) error { return nil }
+
+// AddTags implements Store and does nothing
+func (readOnlyStore) AddTags(context.Context, int64, ...string) error { return nil }
+
+// RemoveTags implements Store and does nothing
+func (readOnlyStore) RemoveTags(context.Context, int64, ...string) error { return nil }
+
+// SaveEmbedding implements EmbeddingStore and does nothing, as no jokes
+// are stored to embed
+func (readOnlyStore) SaveEmbedding(context.Context, int64, string, []float32) error { return nil }
+
+// Filtered implements FilterStore
+func (s readOnlyStore) Filtered(f Filter) Store {
+	if filtered, ok := s.Store.(FilterStore); ok {
+		return readOnlyStore{wrappedStore{filtered.Filtered(f)}}
+	}
+	return s
+}
+
+var (
+	_ HealthStore      = readOnlyStore{}
+	_ LimitStore       = readOnlyStore{}
+	_ TranslationStore = readOnlyStore{}
+	_ EmbeddingStore   = readOnlyStore{}
+	_ FilterStore      = readOnlyStore{}
+)
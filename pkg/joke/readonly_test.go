@@ -0,0 +1,36 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"testing"
+)
+
+func TestReadOnlyStore(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	if err := store.Save(ctx, &Joke{Text: "A prefetched joke", Language: "en"}); err != nil {
+		t.Fatalf("Save() returned an error: %v", err)
+	}
+
+	src := &sequenceSource{}
+	engine := NewEngine(NewReadOnlyStore(store), src)
+	for i := 0; i < 2; i++ {
+		j, err := engine.Tell(ctx)
+		if err != nil {
+			t.Fatalf("Tell() returned an error: %v", err)
+		}
+		if j.Source != "sequence" || j.ID != 0 || j.ToldAt == nil {
+			t.Errorf("Tell() = %+v, want an unsaved joke from the source", j)
+		}
+	}
+
+	if history, _ := store.History(ctx, HistoryFilter{}); len(history) != 0 {
+		t.Errorf("History() has %d jokes, want none", len(history))
+	}
+	if j, err := store.NextUntold(ctx, "en"); err != nil || j.Text != "A prefetched joke" {
+		t.Errorf("NextUntold() = %q, %v, want the prefetched joke left alone", j.Text, err)
+	}
+}
@@ -0,0 +1,282 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultRedisTTL is how long RedisCache keeps what it cached
+	DefaultRedisTTL = time.Minute
+	// redisPrefix starts the keys RedisCache uses
+	redisPrefix = "godad:"
+	// redisRetry is how long RedisCache leaves Redis alone after it failed
+	redisRetry = 30 * time.Second
+)
+
+// RedisCache is a Store caching the lookups a busy server makes in Redis,
+// so the store behind it isn't hit by every request: whether jokes are
+// known, the jokes asked for by ID and recent history. Changes go to the
+// store and clear what they affect from the cache, which several servers
+// can share. Changes made to the store by others show up once the cache
+// expires.
+//
+// When Redis fails, the cache is skipped for a while and the store is
+// used alone.
+type RedisCache struct {
+	wrappedStore
+	// Observer, if set, is told whether lookups found what they were
+	// looking for in the cache
+	Observer Observer
+
+	client redis.UniversalClient
+	ttl    time.Duration
+	// downUntil is when to try Redis again after it failed, in Unix
+	// nanoseconds
+	downUntil atomic.Int64
+}
+
+// NewRedisCache returns a cache of store in the Redis server of client.
+// What it caches expires after ttl, or DefaultRedisTTL if zero.
+func NewRedisCache(store Store, client redis.UniversalClient, ttl time.Duration) *RedisCache {
+	if ttl <= 0 {
+		ttl = DefaultRedisTTL
+	}
+	return &RedisCache{wrappedStore: wrappedStore{store}, client: client, ttl: ttl}
+}
+
+// up reports whether to use Redis
+func (c *RedisCache) up() bool {
+	return time.Now().UnixNano() >= c.downUntil.Load()
+}
+
+// failed records that Redis failed with err, unless it just had nothing
+// cached, and reports whether it did
+func (c *RedisCache) failed(err error) bool {
+	if err == nil || errors.Is(err, redis.Nil) {
+		return false
+	}
+	if c.downUntil.Swap(time.Now().Add(redisRetry).UnixNano()) < time.Now().UnixNano() {
+		log.Warn().Err(err).Dur("retry", redisRetry).Msg("Redis failed, using the store alone")
+	}
+	return true
+}
+
+// knownKeys returns the keys recording that jokes like j are known
+func knownKeys(j Joke) []string {
+	keys := []string{redisPrefix + "known:" + textHash(j.Text)}
+	if j.UpstreamID != "" {
+		keys = append(keys, redisPrefix+"known:"+j.Source+":"+j.UpstreamID)
+	}
+	return keys
+}
+
+// remember records that j is known
+func (c *RedisCache) remember(ctx context.Context, j Joke) {
+	if !c.up() {
+		return
+	}
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range knownKeys(j) {
+			pipe.Set(ctx, key, 1, c.ttl)
+		}
+		return nil
+	})
+	c.failed(err)
+}
+
+// changed clears what a change of the joke with the given ID affects from
+// the cache
+func (c *RedisCache) changed(ctx context.Context, id int64) {
+	if !c.up() {
+		return
+	}
+	_, err := c.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, redisPrefix+"joke:"+strconv.FormatInt(id, 10))
+		// Cached history is found by generation, so moving on to the next
+		// one drops all of it
+		pipe.Incr(ctx, redisPrefix+"history")
+		return nil
+	})
+	c.failed(err)
+}
+
+// cached reads the value at key into v and reports whether it was there
+func (c *RedisCache) cached(ctx context.Context, key string, v any) bool {
+	if !c.up() {
+		return false
+	}
+	b, err := c.client.Get(ctx, key).Bytes()
+	if c.failed(err) {
+		return false
+	}
+	hit := err == nil && json.Unmarshal(b, v) == nil
+	c.observe(hit)
+	return hit
+}
+
+// observe tells the observer whether a lookup hit the cache
+func (c *RedisCache) observe(hit bool) {
+	if c.Observer != nil {
+		c.Observer.ObserveCache(hit)
+	}
+}
+
+// cache keeps v at key
+func (c *RedisCache) cache(ctx context.Context, key string, v any) {
+	if !c.up() {
+		return
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	c.failed(c.client.Set(ctx, key, b, c.ttl).Err())
+}
+
+// Exists implements Store. Jokes known to the store are remembered, but
+// new ones are always looked up.
+func (c *RedisCache) Exists(ctx context.Context, j Joke) (bool, error) {
+	if c.up() {
+		n, err := c.client.Exists(ctx, knownKeys(j)...).Result()
+		if !c.failed(err) {
+			c.observe(n > 0)
+			if n > 0 {
+				return true, nil
+			}
+		}
+	}
+	exists, err := c.Store.Exists(ctx, j)
+	if err == nil && exists {
+		c.remember(ctx, j)
+	}
+	return exists, err
+}
+
+// Save implements Store
+func (c *RedisCache) Save(ctx context.Context, j *Joke) error {
+	if err := c.Store.Save(ctx, j); err != nil {
+		return err
+	}
+	c.remember(ctx, *j)
+	c.changed(ctx, j.ID)
+	return nil
+}
+
+// MarkTold implements Store
+func (c *RedisCache) MarkTold(ctx context.Context, j *Joke) error {
+	if err := c.Store.MarkTold(ctx, j); err != nil {
+		return err
+	}
+	c.changed(ctx, j.ID)
+	return nil
+}
+
+// Claim implements ClaimStore
+func (c *RedisCache) Claim(ctx context.Context, j *Joke) (bool, error) {
+	claimer, ok := c.Store.(ClaimStore)
+	if !ok {
+		return true, c.MarkTold(ctx, j)
+	}
+	claimed, err := claimer.Claim(ctx, j)
+	if err != nil || !claimed {
+		return false, err
+	}
+	c.changed(ctx, j.ID)
+	return true, nil
+}
+
+// Get implements Store
+func (c *RedisCache) Get(ctx context.Context, id int64) (Joke, error) {
+	key := redisPrefix + "joke:" + strconv.FormatInt(id, 10)
+	var j Joke
+	if c.cached(ctx, key, &j) {
+		return j, nil
+	}
+	j, err := c.Store.Get(ctx, id)
+	if err != nil {
+		return Joke{}, err
+	}
+	c.cache(ctx, key, j)
+	return j, nil
+}
+
+// Rate implements Store
+func (c *RedisCache) Rate(ctx context.Context, id int64, rating int) error {
+	if err := c.Store.Rate(ctx, id, rating); err != nil {
+		return err
+	}
+	c.changed(ctx, id)
+	return nil
+}
+
+// AddTags implements Store
+func (c *RedisCache) AddTags(ctx context.Context, id int64, tags ...string) error {
+	if err := c.Store.AddTags(ctx, id, tags...); err != nil {
+		return err
+	}
+	c.changed(ctx, id)
+	return nil
+}
+
+// RemoveTags implements Store
+func (c *RedisCache) RemoveTags(ctx context.Context, id int64, tags ...string) error {
+	if err := c.Store.RemoveTags(ctx, id, tags...); err != nil {
+		return err
+	}
+	c.changed(ctx, id)
+	return nil
+}
+
+// History implements Store
+func (c *RedisCache) History(ctx context.Context, f HistoryFilter) ([]Joke, error) {
+	var key string
+	if c.up() {
+		generation, err := c.client.Get(ctx, redisPrefix+"history").Result()
+		if !c.failed(err) {
+			filter, _ := json.Marshal(f)
+			key = redisPrefix + "history:" + generation + ":" + textHash(string(filter))
+		}
+	}
+	var jokes []Joke
+	if key != "" && c.cached(ctx, key, &jokes) {
+		return jokes, nil
+	}
+	jokes, err := c.Store.History(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	if key != "" {
+		c.cache(ctx, key, jokes)
+	}
+	return jokes, nil
+}
+
+// Filtered implements FilterStore. Picking jokes isn't cached, so the
+// filtered store is used as it is.
+func (c *RedisCache) Filtered(f Filter) Store {
+	if filtered, ok := c.Store.(FilterStore); ok {
+		return filtered.Filtered(f)
+	}
+	return c
+}
+
+var (
+	_ HealthStore      = (*RedisCache)(nil)
+	_ LimitStore       = (*RedisCache)(nil)
+	_ TranslationStore = (*RedisCache)(nil)
+	_ EmbeddingStore   = (*RedisCache)(nil)
+	_ FilterStore      = (*RedisCache)(nil)
+	_ ClaimStore       = (*RedisCache)(nil)
+	_ StockStore       = (*RedisCache)(nil)
+)
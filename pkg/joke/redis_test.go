@@ -0,0 +1,92 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestRedisCache returns a cache of a JSON store in a Redis server run
+// by the test
+func newTestRedisCache(t *testing.T) (*RedisCache, *JSONStore, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	store := newTestJSONStore(t)
+	return NewRedisCache(store, client, time.Minute), store, server
+}
+
+func TestRedisCache(t *testing.T) {
+	ctx := context.Background()
+	cache, store, server := newTestRedisCache(t)
+
+	j := Joke{Text: "A cached joke", UpstreamID: "abc", Source: "icanhazdadjoke", Language: "en"}
+	if err := cache.Save(ctx, &j); err != nil {
+		t.Fatalf("Save() returned an error: %v", err)
+	}
+	if !server.Exists(redisPrefix + "known:" + textHash(j.Text)) {
+		t.Error("Save() didn't cache that the joke is known")
+	}
+	if got, err := cache.Get(ctx, j.ID); err != nil || got.Text != j.Text {
+		t.Fatalf("Get() = %+v, %v, want the saved joke", got, err)
+	}
+
+	// Changes made behind the cache's back show up once it expires
+	if err := store.Update(ctx, j.ID, "A changed joke"); err != nil {
+		t.Fatalf("Update() returned an error: %v", err)
+	}
+	if got, _ := cache.Get(ctx, j.ID); got.Text != j.Text {
+		t.Errorf("Get() = %+v, want the cached joke", got)
+	}
+	if exists, _ := cache.Exists(ctx, Joke{Text: "a cached joke"}); !exists {
+		t.Error("Exists() of the cached joke = false, want true")
+	}
+	server.FastForward(time.Minute)
+	if got, _ := cache.Get(ctx, j.ID); got.Text != "A changed joke" {
+		t.Errorf("Get() after the cache expired = %+v, want the changed joke", got)
+	}
+
+	// Changes made through the cache show up at once
+	if history, _ := cache.History(ctx, HistoryFilter{}); len(history) != 0 {
+		t.Errorf("History() = %+v, want nothing told", history)
+	}
+	if err := cache.MarkTold(ctx, &j); err != nil {
+		t.Fatalf("MarkTold() returned an error: %v", err)
+	}
+	if err := cache.Rate(ctx, j.ID, 4); err != nil {
+		t.Fatalf("Rate() returned an error: %v", err)
+	}
+	if got, _ := cache.Get(ctx, j.ID); got.Rating != 4 {
+		t.Errorf("Get() of a rated joke = %+v, want it rated 4", got)
+	}
+	if history, _ := cache.History(ctx, HistoryFilter{}); len(history) != 1 {
+		t.Errorf("History() = %+v, want the told joke", history)
+	}
+}
+
+func TestRedisCacheDown(t *testing.T) {
+	ctx := context.Background()
+	cache, _, server := newTestRedisCache(t)
+	server.Close()
+
+	j := Joke{Text: "An uncached joke", Language: "en"}
+	if err := cache.Save(ctx, &j); err != nil {
+		t.Fatalf("Save() without Redis returned an error: %v", err)
+	}
+	if cache.up() {
+		t.Error("up() after Redis failed = true, want false")
+	}
+	if exists, err := cache.Exists(ctx, j); err != nil || !exists {
+		t.Errorf("Exists() without Redis = %v, %v, want true", exists, err)
+	}
+	if got, err := cache.Get(ctx, j.ID); err != nil || got.Text != j.Text {
+		t.Errorf("Get() without Redis = %+v, %v, want the saved joke", got, err)
+	}
+}
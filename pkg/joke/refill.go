@@ -0,0 +1,100 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultRefillMin is how many untold jokes per language Refill keeps
+	// in the store
+	DefaultRefillMin = 50
+	// DefaultRefillInterval is how often Refill checks the untold jokes
+	DefaultRefillInterval = time.Minute
+)
+
+// StockStore is a Store that can count the jokes not told yet, so the
+// engine can keep enough of them prefetched, see Engine.Refill
+type StockStore interface {
+	Store
+	// CountUntold returns how many jokes in lang have not been told yet
+	CountUntold(ctx context.Context, lang string) (int, error)
+}
+
+// TopUp prefetches jokes until at least minimum of them are untold in the
+// language of the engine, or in each language of a mix. It returns how
+// many jokes were stored.
+func (e *Engine) TopUp(ctx context.Context, minimum int) (int, error) {
+	if len(e.Mix) > 0 {
+		stored := 0
+		var errs []error
+		for _, m := range e.Mix {
+			n, err := m.Engine.TopUp(ctx, minimum)
+			stored += n
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", m.Engine.Language, err))
+			}
+		}
+		return stored, errors.Join(errs...)
+	}
+
+	stock, ok := e.Store.(StockStore)
+	if !ok {
+		return 0, errors.New("the store can't count untold jokes")
+	}
+	untold, err := stock.CountUntold(ctx, e.Language)
+	if err != nil {
+		return 0, fmt.Errorf("error counting untold jokes: %w", err)
+	}
+	if untold >= minimum {
+		return 0, nil
+	}
+	return e.Prefetch(ctx, minimum-untold, nil)
+}
+
+// Refill tops up the untold jokes to minimum every interval until ctx is
+// done, so telling them never has to wait for the network. Fetches keep
+// to the rate limits of the sources; what they can't fetch in time is
+// left for the next round.
+func (e *Engine) Refill(ctx context.Context, minimum int, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultRefillInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := e.TopUp(ctx, minimum)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Warn().Err(err).Str("lang", e.Language).Msg("Could not refill the untold jokes")
+		} else if n > 0 {
+			log.Info().Int("count", n).Str("lang", e.Language).Msg("Refilled the untold jokes")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CountUntold implements StockStore
+func (s *SQLiteStore) CountUntold(ctx context.Context, lang string) (int, error) {
+	var count int
+	if err := s.queryRow(ctx, "SELECT COUNT(*) FROM jokes WHERE told_at IS NULL AND language = ?", lang).Scan(&count); err != nil {
+		return 0, fmt.Errorf("error counting untold jokes in database: %w", err)
+	}
+	return count, nil
+}
+
+var _ StockStore = (*SQLiteStore)(nil)
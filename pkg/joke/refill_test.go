@@ -0,0 +1,59 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEngineTopUp(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	if err := store.Save(ctx, &Joke{Text: "A prefetched joke", Language: "en"}); err != nil {
+		t.Fatalf("Save() returned an error: %v", err)
+	}
+	src := &countingSource{}
+	engine := NewEngine(store, src)
+
+	if n, err := engine.TopUp(ctx, 5); err != nil || n != 4 {
+		t.Fatalf("TopUp() = %d, %v, want 4 jokes stored", n, err)
+	}
+	if n, err := engine.TopUp(ctx, 5); err != nil || n != 0 {
+		t.Errorf("TopUp() with enough untold jokes = %d, %v, want none stored", n, err)
+	}
+	if _, err := engine.Tell(ctx); err != nil {
+		t.Fatalf("Tell() returned an error: %v", err)
+	}
+	if n, err := engine.TopUp(ctx, 5); err != nil || n != 1 {
+		t.Errorf("TopUp() after telling a joke = %d, %v, want 1 joke stored", n, err)
+	}
+	if fetched := src.n.Load(); fetched != 5 {
+		t.Errorf("Source was fetched %d times, want 5", fetched)
+	}
+}
+
+func TestEngineRefill(t *testing.T) {
+	store := newTestStore(t)
+	engine := NewEngine(store, &countingSource{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		engine.Refill(ctx, 3, time.Millisecond)
+	}()
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		if n, _ := store.CountUntold(context.Background(), "en"); n >= 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Refill() didn't store 3 untold jokes")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+}
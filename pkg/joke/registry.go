@@ -0,0 +1,209 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultLanguage is used when no language is requested
+const DefaultLanguage = "en"
+
+var (
+	// ErrUnsupportedLanguage is returned when no source serves a language
+	ErrUnsupportedLanguage = errors.New("unsupported language")
+	// ErrUnknownSource is returned when a source name is not registered
+	ErrUnknownSource = errors.New("unknown source")
+)
+
+// Registry keeps track of the available joke sources. New sources can be
+// added with Register without touching the engine.
+type Registry struct {
+	mu      sync.RWMutex
+	sources []Source
+}
+
+// NewRegistry returns a registry holding the given sources
+func NewRegistry(sources ...Source) *Registry {
+	r := &Registry{}
+	for _, src := range sources {
+		// Duplicates are dropped, the first registration wins
+		_ = r.Register(src)
+	}
+	return r
+}
+
+// builtinSources returns the built-in sources of each language, in the
+// order they are tried. Every language has more than one source where
+// possible, so a joke can be told while one of them is down.
+func builtinSources() map[string][]Source {
+	sources := map[string][]Source{
+		"en": {NewICanHazDadJoke(), NewOfficialJokeAPI(), NewJokeAPI("en"), NewGeekJokes()},
+		"de": {NewFlachwitze(), NewWitzAPI(), NewJokeAPI("de")},
+	}
+	// JokeAPI backs up the languages above and is the only source of the
+	// others it has jokes in
+	for _, lang := range JokeAPILanguages {
+		if _, ok := sources[lang]; !ok {
+			sources[lang] = []Source{NewJokeAPI(lang)}
+		}
+	}
+	return sources
+}
+
+// DefaultRegistry returns a registry holding the built-in sources, those
+// of the default language first
+func DefaultRegistry() *Registry {
+	sources := builtinSources()
+	var langs []string
+	for lang := range sources {
+		if lang != DefaultLanguage {
+			langs = append(langs, lang)
+		}
+	}
+	sort.Strings(langs)
+	langs = append([]string{DefaultLanguage}, langs...)
+
+	r := NewRegistry()
+	for _, lang := range langs {
+		for _, src := range sources[lang] {
+			_ = r.Register(src)
+		}
+	}
+	return r
+}
+
+// Register adds a source to the registry. Source names must be unique.
+func (r *Registry) Register(src Source) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range r.sources {
+		if s.Name() == src.Name() {
+			return fmt.Errorf("source %q is already registered", src.Name())
+		}
+	}
+	r.sources = append(r.sources, src)
+	return nil
+}
+
+// Replace swaps the source registered under the name of src for src, or
+// registers src if there is none
+func (r *Registry) Replace(src Source) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, s := range r.sources {
+		if s.Name() == src.Name() {
+			r.sources[i] = src
+			return
+		}
+	}
+	r.sources = append(r.sources, src)
+}
+
+// Get returns the source registered under name
+func (r *Registry) Get(name string) (Source, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, s := range r.sources {
+		if s.Name() == name {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// Sources returns every registered source in registration order
+func (r *Registry) Sources() []Source {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return slices.Clone(r.sources)
+}
+
+// ForLanguage returns the sources serving lang in registration order
+func (r *Registry) ForLanguage(lang string) []Source {
+	lang = normalizeLanguage(lang)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var sources []Source
+	for _, s := range r.sources {
+		if s.Language() == lang {
+			sources = append(sources, s)
+		}
+	}
+	return sources
+}
+
+// Languages returns the sorted language codes served by at least one source
+func (r *Registry) Languages() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var langs []string
+	for _, s := range r.sources {
+		if !slices.Contains(langs, s.Language()) {
+			langs = append(langs, s.Language())
+		}
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Select returns the sources to use for lang. Sources named in order come
+// first, in that order, followed by the remaining sources for the language.
+// Sources named in disabled are left out.
+func (r *Registry) Select(lang string, order, disabled []string) ([]Source, error) {
+	lang = normalizeLanguage(lang)
+
+	candidates := r.ForLanguage(lang)
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("%w %q (supported: %s)", ErrUnsupportedLanguage, lang, strings.Join(r.Languages(), ", "))
+	}
+
+	selected := make([]Source, 0, len(candidates))
+	for _, name := range order {
+		src, ok := r.Get(name)
+		if !ok {
+			return nil, fmt.Errorf("%w %q", ErrUnknownSource, name)
+		}
+		if src.Language() != lang {
+			return nil, fmt.Errorf("source %q does not serve language %q", name, lang)
+		}
+		if !slices.Contains(selected, src) {
+			selected = append(selected, src)
+		}
+	}
+	for _, src := range candidates {
+		if !slices.Contains(selected, src) {
+			selected = append(selected, src)
+		}
+	}
+
+	selected = slices.DeleteFunc(selected, func(src Source) bool {
+		return slices.Contains(disabled, src.Name())
+	})
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("all sources for language %q are disabled", lang)
+	}
+	return selected, nil
+}
+
+// normalizeLanguage lowercases a language code and applies the default
+func normalizeLanguage(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if lang == "" {
+		return DefaultLanguage
+	}
+	return lang
+}
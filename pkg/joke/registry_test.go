@@ -0,0 +1,142 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// staticSource is a Source returning the same joke every time
+type staticSource struct {
+	name string
+	lang string
+	text string
+	err  error
+}
+
+func (s *staticSource) Name() string     { return s.name }
+func (s *staticSource) Language() string { return s.lang }
+
+func (s *staticSource) Fetch(_ context.Context) (Joke, error) {
+	if s.err != nil {
+		return Joke{}, s.err
+	}
+	return Joke{Text: s.text}, nil
+}
+
+func sourceNames(sources []Source) []string {
+	names := make([]string, 0, len(sources))
+	for _, s := range sources {
+		names = append(names, s.Name())
+	}
+	return names
+}
+
+func TestRegistrySelect(t *testing.T) {
+	r := NewRegistry(
+		&staticSource{name: "a", lang: "en"},
+		&staticSource{name: "b", lang: "en"},
+		&staticSource{name: "c", lang: "en"},
+		&staticSource{name: "d", lang: "de"},
+	)
+
+	testCases := []struct {
+		name     string
+		lang     string
+		order    []string
+		disabled []string
+		want     []string
+	}{
+		{name: "DefaultLanguage", want: []string{"a", "b", "c"}},
+		{name: "German", lang: "DE", want: []string{"d"}},
+		{name: "Order", lang: "en", order: []string{"c", "a"}, want: []string{"c", "a", "b"}},
+		{name: "Disabled", lang: "en", disabled: []string{"b"}, want: []string{"a", "c"}},
+		{name: "OrderAndDisabled", lang: "en", order: []string{"b"}, disabled: []string{"a"}, want: []string{"b", "c"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sources, err := r.Select(tc.lang, tc.order, tc.disabled)
+			if err != nil {
+				t.Fatalf("Select() returned an error: %v", err)
+			}
+			got := sourceNames(sources)
+			if len(got) != len(tc.want) {
+				t.Fatalf("Select() = %v, want %v", got, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Fatalf("Select() = %v, want %v", got, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestRegistrySelectErrors(t *testing.T) {
+	r := NewRegistry(
+		&staticSource{name: "a", lang: "en"},
+		&staticSource{name: "d", lang: "de"},
+	)
+
+	if _, err := r.Select("xx", nil, nil); !errors.Is(err, ErrUnsupportedLanguage) {
+		t.Errorf("Select(\"xx\") returned %v, want ErrUnsupportedLanguage", err)
+	}
+	if _, err := r.Select("en", []string{"nope"}, nil); !errors.Is(err, ErrUnknownSource) {
+		t.Errorf("Select() with an unknown source returned %v, want ErrUnknownSource", err)
+	}
+	if _, err := r.Select("en", []string{"d"}, nil); err == nil {
+		t.Errorf("Select() with a source of another language did not return an error")
+	}
+	if _, err := r.Select("en", nil, []string{"a"}); err == nil {
+		t.Errorf("Select() with every source disabled did not return an error")
+	}
+}
+
+func TestRegistryRegisterDuplicate(t *testing.T) {
+	r := NewRegistry(&staticSource{name: "a", lang: "en"})
+	if err := r.Register(&staticSource{name: "a", lang: "de"}); err == nil {
+		t.Errorf("Register() accepted a duplicate source name")
+	}
+}
+
+func TestRegistryReplace(t *testing.T) {
+	a := &staticSource{name: "a", lang: "en"}
+	r := NewRegistry(a, &staticSource{name: "b", lang: "en"})
+
+	replacement := &staticSource{name: "a", lang: "en", text: "new"}
+	r.Replace(replacement)
+	if got := sourceNames(r.Sources()); len(got) != 2 || got[0] != "a" {
+		t.Fatalf("Sources() after Replace() = %v, want [a b]", got)
+	}
+	if src, _ := r.Get("a"); src != replacement {
+		t.Errorf("Get(\"a\") returned the replaced source")
+	}
+
+	r.Replace(&staticSource{name: "c", lang: "en"})
+	if got := sourceNames(r.Sources()); len(got) != 3 || got[2] != "c" {
+		t.Errorf("Sources() after Replace() of a new name = %v, want [a b c]", got)
+	}
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	r := DefaultRegistry()
+	for lang, want := range map[string]string{"en": "icanhazdadjoke", "de": "flachwitze"} {
+		sources := r.ForLanguage(lang)
+		if len(sources) == 0 || sources[0].Name() != want {
+			t.Errorf("ForLanguage(%q) = %v, want %s first", lang, sourceNames(sources), want)
+		}
+	}
+	// Languages with a source of their own are backed up by another
+	for _, lang := range []string{"en", "de"} {
+		if sources := r.ForLanguage(lang); len(sources) < 2 {
+			t.Errorf("ForLanguage(%q) = %v, want more than one source", lang, sourceNames(sources))
+		}
+	}
+	if got := r.Sources()[0].Language(); got != DefaultLanguage {
+		t.Errorf("Sources() starts with a %s source, want the default language first", got)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// StatusError is returned by HTTP sources when the upstream answers with
+// an unexpected status code
+type StatusError struct {
+	StatusCode int
+	Status     string
+	// RetryAfter is how long the upstream asked to wait before the next
+	// request, if it did
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("unexpected status: %s, retry after %s", e.Status, e.RetryAfter)
+	}
+	return fmt.Sprintf("unexpected status: %s", e.Status)
+}
+
+// checkStatus returns a StatusError unless resp has a 2xx status
+func checkStatus(resp *http.Response) error {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &StatusError{StatusCode: resp.StatusCode, Status: resp.Status, RetryAfter: retryAfter(resp.Header, time.Now())}
+	}
+	return nil
+}
+
+// retryAfter returns the wait asked for by the Retry-After header, given
+// in seconds or as a date, or else by a RateLimit-Reset or
+// X-RateLimit-Reset header, given in seconds or as a Unix time
+func retryAfter(h http.Header, now time.Time) time.Duration {
+	if v := h.Get("Retry-After"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil {
+			return max(time.Duration(secs)*time.Second, 0)
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			return max(t.Sub(now), 0)
+		}
+	}
+	for _, key := range []string{"RateLimit-Reset", "X-RateLimit-Reset"} {
+		secs, err := strconv.ParseInt(h.Get(key), 10, 64)
+		if err != nil || secs <= 0 {
+			continue
+		}
+		// Resets more than a year away are Unix times
+		if secs > 365*24*60*60 {
+			return max(time.Unix(secs, 0).Sub(now), 0)
+		}
+		return time.Duration(secs) * time.Second
+	}
+	return 0
+}
+
+// IsRetryable reports whether a failed fetch is worth retrying: network
+// errors, timeouts of a single attempt, rate limiting and server errors are,
+// anything else (bad requests, unparsable responses) is not
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == http.StatusTooManyRequests
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// RetryPolicy controls how fetches that fail with a retryable error are
+// retried. The wait between attempts grows exponentially from Backoff up
+// to MaxBackoff, and is randomized by up to Jitter (a fraction of the wait)
+// so that many clients don't retry in lockstep.
+type RetryPolicy struct {
+	// Attempts is the total number of attempts, including the first one
+	Attempts   int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	Multiplier float64
+	Jitter     float64
+}
+
+// DefaultRetryPolicy is used by new engines
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:   3,
+	Backoff:    250 * time.Millisecond,
+	MaxBackoff: 5 * time.Second,
+	Multiplier: 2,
+	Jitter:     0.2,
+}
+
+// Delay returns how long to wait after the given failed attempt, counting
+// from 1, before trying again
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	if p.Backoff <= 0 {
+		return 0
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	d := float64(p.Backoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		// #nosec G404 -- jitter does not need a secure random number
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// Do calls fn until it succeeds, fails with an error that is not
+// retryable, runs out of attempts or ctx is done. When the upstream asks
+// to wait, that wait is used instead of the backoff, and if it is longer
+// than MaxBackoff fn is not retried at all.
+func (p RetryPolicy) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	attempts := max(p.Attempts, 1)
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt >= attempts || !IsRetryable(err) || ctx.Err() != nil {
+			return err
+		}
+
+		delay := p.Delay(attempt)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+			if p.MaxBackoff > 0 && statusErr.RetryAfter > p.MaxBackoff {
+				return err
+			}
+			delay = statusErr.RetryAfter
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
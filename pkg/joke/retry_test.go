@@ -0,0 +1,146 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2}
+
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second}
+	for i, w := range want {
+		if got := p.Delay(i + 1); got != w {
+			t.Errorf("Delay(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.Delay(1); got < 50*time.Millisecond || got > 150*time.Millisecond {
+			t.Fatalf("Delay(1) with jitter = %v, want between 50ms and 150ms", got)
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	testCases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "ServerError", err: &StatusError{StatusCode: 503}, want: true},
+		{name: "TooManyRequests", err: &StatusError{StatusCode: 429}, want: true},
+		{name: "NotFound", err: &StatusError{StatusCode: 404}, want: false},
+		{name: "Wrapped", err: fmt.Errorf("fetching: %w", &StatusError{StatusCode: 502}), want: true},
+		{name: "Timeout", err: context.DeadlineExceeded, want: true},
+		{name: "Canceled", err: context.Canceled, want: false},
+		{name: "Other", err: errors.New("error parsing JSON"), want: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := IsRetryable(tc.err); got != tc.want {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEngineRetriesServerErrors(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte(`{"id": "1", "joke": "Third time lucky", "status": 200}`))
+	}))
+	defer server.Close()
+
+	engine := NewEngine(newTestStore(t), newTestSource(server))
+	engine.Retry.Backoff = time.Millisecond
+
+	j, err := engine.Fresh(context.Background())
+	if err != nil {
+		t.Fatalf("Fresh() returned an error: %v", err)
+	}
+	if j.Text != "Third time lucky" || requests != 3 {
+		t.Errorf("Fresh() returned %q after %d requests, want the joke after 3", j.Text, requests)
+	}
+}
+
+func TestEngineDoesNotRetryClientErrors(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	engine := NewEngine(newTestStore(t), newTestSource(server))
+	engine.Retry.Backoff = time.Millisecond
+
+	if _, err := engine.Fresh(context.Background()); err == nil {
+		t.Fatalf("Fresh() did not return an error")
+	}
+	if requests != 1 {
+		t.Errorf("Fresh() sent %d requests, want 1", requests)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{name: "None", header: http.Header{}, want: 0},
+		{name: "Seconds", header: http.Header{"Retry-After": {"120"}}, want: 2 * time.Minute},
+		{name: "Date", header: http.Header{"Retry-After": {"Wed, 01 May 2024 09:00:30 GMT"}}, want: 30 * time.Second},
+		{name: "Past", header: http.Header{"Retry-After": {"Wed, 01 May 2024 08:00:00 GMT"}}, want: 0},
+		{name: "Reset", header: http.Header{"X-Ratelimit-Reset": {"15"}}, want: 15 * time.Second},
+		{name: "UnixReset", header: http.Header{"Ratelimit-Reset": {fmt.Sprint(now.Add(time.Minute).Unix())}}, want: time.Minute},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := retryAfter(tc.header, now); got != tc.want {
+				t.Errorf("retryAfter(%v) = %v, want %v", tc.header, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyHonoursRetryAfter(t *testing.T) {
+	p := RetryPolicy{Attempts: 3, Backoff: time.Hour, MaxBackoff: time.Second}
+
+	calls := 0
+	start := time.Now()
+	err := p.Do(context.Background(), func(context.Context) error {
+		if calls++; calls == 1 {
+			return &StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Millisecond}
+		}
+		return nil
+	})
+	if err != nil || calls != 2 || time.Since(start) > time.Minute {
+		t.Errorf("Do() = %v after %d calls, want a quick retry as asked for", err, calls)
+	}
+
+	calls = 0
+	err = p.Do(context.Background(), func(context.Context) error {
+		calls++
+		return &StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Hour}
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("Do() = %v after %d calls, want no retry when asked to wait longer than MaxBackoff", err, calls)
+	}
+}
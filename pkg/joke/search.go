@@ -0,0 +1,196 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const (
+	// HighlightStart and HighlightEnd surround matched terms in snippets
+	HighlightStart = "**"
+	HighlightEnd   = "**"
+	// DefaultSearchLimit is how many results Search returns by default
+	DefaultSearchLimit = 10
+)
+
+// ErrEmptyQuery is returned when searching without any search terms
+var ErrEmptyQuery = errors.New("empty search query")
+
+// SearchResult is a told joke matching a search
+type SearchResult struct {
+	Joke
+	// Snippet is the matching part of the joke with the matched terms
+	// highlighted
+	Snippet string `json:"snippet"`
+	// Score is the relevance of the match, higher is better. It is zero
+	// when the store cannot rank results.
+	Score float64 `json:"score"`
+}
+
+// Searcher is implemented by stores that can search the jokes they hold
+type Searcher interface {
+	// Search returns up to limit told jokes containing all words of
+	// query, best matches first
+	Search(ctx context.Context, query string, limit int) ([]SearchResult, error)
+}
+
+// searchTerms splits a query into words. Punctuation is dropped, so
+// users can't accidentally write FTS5 query syntax.
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// ftsQuery turns search terms into an FTS5 query matching every term as a
+// prefix
+func ftsQuery(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, t := range terms {
+		quoted[i] = `"` + t + `"*`
+	}
+	return strings.Join(quoted, " ")
+}
+
+// highlight marks every occurrence of the terms in text, ignoring case
+func highlight(text string, terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, t := range terms {
+		quoted[i] = regexp.QuoteMeta(t)
+	}
+	re := regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))
+	return re.ReplaceAllStringFunc(text, func(m string) string {
+		return HighlightStart + m + HighlightEnd
+	})
+}
+
+// The full-text index is derived from the jokes table, so it is not part
+// of the versioned schema. It is only available when the SQLite driver is
+// built with FTS5 (the sqlite_fts5 build tag); without it Search falls back
+// to plain substring matching.
+var searchIndexTriggers = []string{
+	`CREATE TRIGGER IF NOT EXISTS jokes_fts_insert AFTER INSERT ON jokes BEGIN
+		INSERT INTO jokes_fts (rowid, joke) VALUES (new.id, new.joke);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS jokes_fts_delete AFTER DELETE ON jokes BEGIN
+		INSERT INTO jokes_fts (jokes_fts, rowid, joke) VALUES ('delete', old.id, old.joke);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS jokes_fts_update AFTER UPDATE OF joke ON jokes BEGIN
+		INSERT INTO jokes_fts (jokes_fts, rowid, joke) VALUES ('delete', old.id, old.joke);
+		INSERT INTO jokes_fts (rowid, joke) VALUES (new.id, new.joke);
+	END`,
+}
+
+// ensureSearchIndex creates and fills the full-text index when the driver
+// supports FTS5. When it doesn't, the triggers keeping the index in sync
+// are dropped, since inserting jokes would fail otherwise; the index is
+// rebuilt the next time a build with FTS5 opens the database.
+func (s *SQLiteStore) ensureSearchIndex(ctx context.Context) error {
+	if !s.hasFTS5(ctx) {
+		s.fts = false
+		for _, name := range []string{"jokes_fts_insert", "jokes_fts_delete", "jokes_fts_update"} {
+			if _, err := s.db.ExecContext(ctx, "DROP TRIGGER IF EXISTS "+name); err != nil {
+				return fmt.Errorf("error dropping search index trigger: %w", err)
+			}
+		}
+		return nil
+	}
+
+	var triggers int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'jokes_fts_%'").Scan(&triggers)
+	if err != nil {
+		return fmt.Errorf("error checking search index: %w", err)
+	}
+	s.fts = true
+	if triggers == len(searchIndexTriggers) {
+		return nil
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error creating search index: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmts := append([]string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS jokes_fts USING fts5 (
+			joke, content = 'jokes', content_rowid = 'id', tokenize = 'unicode61 remove_diacritics 2'
+		)`,
+	}, searchIndexTriggers...)
+	stmts = append(stmts, "INSERT INTO jokes_fts (jokes_fts) VALUES ('rebuild')")
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("error creating search index: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// hasFTS5 reports whether the SQLite driver was built with FTS5
+func (s *SQLiteStore) hasFTS5(ctx context.Context) bool {
+	var enabled bool
+	err := s.db.QueryRowContext(ctx, "SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled)
+	return err == nil && enabled
+}
+
+// Search implements Searcher. Results are ranked with BM25 when the
+// full-text index is available.
+func (s *SQLiteStore) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil, ErrEmptyQuery
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+
+	var (
+		stmt string
+		args []any
+	)
+	if s.fts {
+		// bm25 is lower for better matches
+		stmt = "SELECT " + qualifiedJokeColumns("j") + `, snippet(jokes_fts, 0, ?, ?, '…', 16), -bm25(jokes_fts)
+			FROM jokes_fts JOIN jokes j ON j.id = jokes_fts.rowid
+			WHERE jokes_fts MATCH ? AND j.told_at IS NOT NULL
+			ORDER BY bm25(jokes_fts), j.id DESC LIMIT ?`
+		args = []any{HighlightStart, HighlightEnd, ftsQuery(terms), limit}
+	} else {
+		stmt = "SELECT " + jokeColumns + ", joke, 0.0 FROM jokes WHERE told_at IS NOT NULL"
+		for _, t := range terms {
+			stmt += " AND joke LIKE ?"
+			args = append(args, "%"+t+"%")
+		}
+		stmt += " ORDER BY id DESC LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error searching jokes: %w", err)
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var r SearchResult
+		err := scanJokeWith(rows, &r.Joke, &r.Snippet, &r.Score)
+		if err != nil {
+			return nil, fmt.Errorf("error reading search results: %w", err)
+		}
+		if !s.fts {
+			r.Snippet = highlight(r.Snippet, terms)
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+var _ Searcher = (*SQLiteStore)(nil)
@@ -0,0 +1,70 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSQLiteStoreSearch(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	for _, j := range []Joke{
+		{Text: "Why did the scarecrow win an award? He was outstanding in his field.", ToldAt: &now},
+		{Text: "I'm reading a book about anti-gravity. It's impossible to put down.", ToldAt: &now},
+		{Text: "Did you hear about the scarecrow's cousin? Also outstanding.", ToldAt: &now},
+		// Prefetched jokes are not searched, they would be spoilers
+		{Text: "A scarecrow walks into a bar."},
+	} {
+		if err := store.Save(ctx, &j); err != nil {
+			t.Fatalf("Save() returned an error: %v", err)
+		}
+	}
+
+	testCases := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{name: "SingleTerm", query: "scarecrow", want: 2},
+		{name: "AllTerms", query: "scarecrow award", want: 1},
+		{name: "CaseInsensitive", query: "GRAVITY", want: 1},
+		{name: "Syntax", query: `"book" (`, want: 1},
+		{name: "NoMatch", query: "penguin", want: 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			results, err := store.Search(ctx, tc.query, 0)
+			if err != nil {
+				t.Fatalf("Search() returned an error: %v", err)
+			}
+			if len(results) != tc.want {
+				t.Fatalf("Search() returned %d results, want %d", len(results), tc.want)
+			}
+			for _, r := range results {
+				if !strings.Contains(r.Snippet, HighlightStart) {
+					t.Errorf("Snippet %q has no highlighted terms", r.Snippet)
+				}
+			}
+		})
+	}
+
+	if _, err := store.Search(ctx, "  ", 0); !errors.Is(err, ErrEmptyQuery) {
+		t.Errorf("Search() with an empty query returned %v, want ErrEmptyQuery", err)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	got := highlight("Outstanding in his field", []string{"field", "OUT"})
+	want := "**Out**standing in his **field**"
+	if got != want {
+		t.Errorf("highlight() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ErrNoShareURL is returned for jokes that have no page to link to
+var ErrNoShareURL = errors.New("joke has no page to link to")
+
+// maxShortURL is the longest response of a link shortener that is read
+const maxShortURL = 2048
+
+// ShareURL returns the canonical page of j: its page on icanhazdadjoke.com
+// for jokes from there, or else its page on the godad server at server,
+// if given, like https://jokes.example.com/j/42. The server must use the
+// same store, so the local ID of j is the same there.
+func ShareURL(j Joke, server string) (string, error) {
+	if j.Source == "icanhazdadjoke" && j.UpstreamID != "" {
+		return ICanHazDadJokeURL + "j/" + url.PathEscape(j.UpstreamID), nil
+	}
+	if server == "" || j.ID == 0 {
+		return "", ErrNoShareURL
+	}
+	return strings.TrimSuffix(server, "/") + "/j/" + strconv.FormatInt(j.ID, 10), nil
+}
+
+// Shorten returns a short link to long from the link shortener at
+// shortener, a URL with {url} in place of the escaped long link, like
+// https://is.gd/create.php?format=simple&url={url}. The shortener must
+// answer with the short link as plain text.
+func Shorten(ctx context.Context, client *http.Client, shortener, long string) (string, error) {
+	if !strings.Contains(shortener, "{url}") {
+		return "", fmt.Errorf("link shortener %q has no {url} to put the link in", shortener)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.ReplaceAll(shortener, "{url}", url.QueryEscape(long)), nil)
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set("Accept", "text/plain")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error shortening link: %w", err)
+	}
+	defer resp.Body.Close()
+	if err := checkStatus(resp); err != nil {
+		return "", fmt.Errorf("error shortening link: %w", err)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxShortURL))
+	if err != nil {
+		return "", fmt.Errorf("error reading short link: %w", err)
+	}
+	short := strings.TrimSpace(string(body))
+	if u, err := url.Parse(short); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("link shortener returned %q instead of a link", short)
+	}
+	return short, nil
+}
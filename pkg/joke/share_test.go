@@ -0,0 +1,59 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestShareURL(t *testing.T) {
+	for _, tc := range []struct {
+		joke   Joke
+		server string
+		want   string
+	}{
+		{joke: Joke{ID: 1, Source: "icanhazdadjoke", UpstreamID: "R7UfaahVfFd"}, server: "https://jokes.example.com", want: "https://icanhazdadjoke.com/j/R7UfaahVfFd"},
+		{joke: Joke{ID: 42, Source: "user"}, server: "https://jokes.example.com/", want: "https://jokes.example.com/j/42"},
+		{joke: Joke{ID: 42, Source: "jokeapi", UpstreamID: "7"}, server: "http://localhost:8080", want: "http://localhost:8080/j/42"},
+	} {
+		if got, err := ShareURL(tc.joke, tc.server); err != nil || got != tc.want {
+			t.Errorf("ShareURL(%+v, %q) = %q, %v, want %q", tc.joke, tc.server, got, err, tc.want)
+		}
+	}
+	if _, err := ShareURL(Joke{ID: 42, Source: "user"}, ""); !errors.Is(err, ErrNoShareURL) {
+		t.Errorf("ShareURL() without a server returned %v, want ErrNoShareURL", err)
+	}
+}
+
+func TestShorten(t *testing.T) {
+	ctx := context.Background()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch long := r.URL.Query().Get("url"); long {
+		case "https://icanhazdadjoke.com/j/R7UfaahVfFd":
+			fmt.Fprintln(w, "https://short.example/abc")
+		case "https://jokes.example.com/j/42":
+			fmt.Fprint(w, "Error: rate limit exceeded")
+		default:
+			t.Errorf("Unexpected link %q to shorten", long)
+		}
+	}))
+	defer server.Close()
+	shortener := server.URL + "/create?url={url}"
+
+	short, err := Shorten(ctx, server.Client(), shortener, "https://icanhazdadjoke.com/j/R7UfaahVfFd")
+	if err != nil || short != "https://short.example/abc" {
+		t.Errorf("Shorten() = %q, %v, want the short link", short, err)
+	}
+	if _, err := Shorten(ctx, server.Client(), shortener, "https://jokes.example.com/j/42"); err == nil {
+		t.Error("Shorten() of a shortener answering with an error message returned no error")
+	}
+	if _, err := Shorten(ctx, server.Client(), server.URL, "https://jokes.example.com/j/42"); err == nil {
+		t.Error("Shorten() with a shortener without {url} returned no error")
+	}
+}
@@ -0,0 +1,416 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jokeColumns lists the columns read into a Joke, in scanJoke order
+const jokeColumns = "id, joke, created_at, upstream_id, source, language, told_at, rating, times_told"
+
+// unratedWeight is the weight of jokes without a rating when picking a
+// random joke, the middle of the rating scale
+const unratedWeight = (MinRating + MaxRating) / 2
+
+// Each SQLite driver has a driver_*.go file, picked by build tags, with
+// sqliteDSN, isUniqueViolation, which reports whether an error is a
+// violated unique constraint, and withBackup, which starts copying the
+// database of a connection to a new database at a path encrypted with a
+// key, and runs a function with the backup.
+
+// ErrEncryptionUnsupported is returned when opening an encrypted database
+// with a build of godad that can't decrypt it
+var ErrEncryptionUnsupported = errors.New("encrypted databases need godad built with the sqlcipher tag")
+
+// SQLiteStore is a Store backed by a SQLite database
+type SQLiteStore struct {
+	db *sql.DB
+	// fts is set when the full-text search index is available
+	fts bool
+	// key encrypts the database, if set
+	key string
+	// stmts holds the statements prepared by prepare, by query
+	stmts sync.Map
+}
+
+// OpenSQLite opens the SQLite database at path and migrates the schema to
+// the latest version
+func OpenSQLite(path string) (*SQLiteStore, error) {
+	return OpenEncryptedSQLite(path, "")
+}
+
+// OpenEncryptedSQLite opens the SQLite database at path encrypted with
+// key, or creates it, and migrates the schema to the latest version. An
+// empty key opens an unencrypted database like OpenSQLite. Encryption
+// needs the sqlcipher build tag, see EncryptionSupported.
+func OpenEncryptedSQLite(path, key string) (*SQLiteStore, error) {
+	// Every driver turns on foreign keys, which remove the tags of deleted
+	// jokes, and a write-ahead log, so readers don't block the writer.
+	// Writers wait for each other instead of failing with "database is
+	// locked", and transactions take the write lock when they begin
+	// rather than when they first write, which could fail without waiting.
+	dsn, err := sqliteDSN(path, key)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open(sqliteDriver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error opening database: %w", err)
+	}
+
+	s := &SQLiteStore{db: db, key: key}
+	if err := s.Migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := s.ensureSearchIndex(context.Background()); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// scanner is implemented by *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// qualifiedJokeColumns returns jokeColumns prefixed with a table alias,
+// for queries joining other tables
+func qualifiedJokeColumns(alias string) string {
+	cols := strings.Split(jokeColumns, ", ")
+	for i, c := range cols {
+		cols[i] = alias + "." + c
+	}
+	return strings.Join(cols, ", ")
+}
+
+// scanJoke reads a row selected with jokeColumns
+func scanJoke(row scanner) (Joke, error) {
+	var j Joke
+	err := scanJokeWith(row, &j)
+	return j, err
+}
+
+// scanJokeWith reads a row selected with jokeColumns followed by extra
+// columns, which are scanned into extra
+func scanJokeWith(row scanner, j *Joke, extra ...any) error {
+	var (
+		toldAt sql.NullTime
+		rating sql.NullInt64
+	)
+	dest := append([]any{&j.ID, &j.Text, &j.CreatedAt, &j.UpstreamID, &j.Source, &j.Language, &toldAt, &rating, &j.TimesTold}, extra...)
+	err := row.Scan(dest...)
+	if toldAt.Valid {
+		j.ToldAt = &toldAt.Time
+	}
+	j.Rating = int(rating.Int64)
+	return err
+}
+
+// prepare returns query prepared once for the life of the store, so the
+// statements run for every joke aren't parsed by SQLite every time
+func (s *SQLiteStore) prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	if stmt, ok := s.stmts.Load(query); ok {
+		return stmt.(*sql.Stmt), nil
+	}
+	stmt, err := s.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if prepared, loaded := s.stmts.LoadOrStore(query, stmt); loaded {
+		stmt.Close()
+		return prepared.(*sql.Stmt), nil
+	}
+	return stmt, nil
+}
+
+// queryRow runs a prepared query returning at most one row
+func (s *SQLiteStore) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	stmt, err := s.prepare(ctx, query)
+	if err != nil {
+		// Running the query unprepared reports the error through the row
+		return s.db.QueryRowContext(ctx, query, args...)
+	}
+	return stmt.QueryRowContext(ctx, args...)
+}
+
+// exec runs a prepared statement
+func (s *SQLiteStore) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	stmt, err := s.prepare(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.ExecContext(ctx, args...)
+}
+
+// DB returns the underlying database handle
+func (s *SQLiteStore) DB() *sql.DB {
+	return s.db
+}
+
+// Exists implements Store. Jokes with an upstream ID match on that ID,
+// all jokes match on their text.
+func (s *SQLiteStore) Exists(ctx context.Context, j Joke) (bool, error) {
+	var count int
+	err := s.queryRow(ctx, `SELECT COUNT(*) FROM jokes
+		WHERE hash = ? OR (upstream_id != '' AND upstream_id = ? AND source = ?)`,
+		textHash(j.Text), j.UpstreamID, j.Source).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Find implements Store
+func (s *SQLiteStore) Find(ctx context.Context, j Joke) (Joke, error) {
+	found, err := scanJoke(s.queryRow(ctx, "SELECT "+jokeColumns+` FROM jokes
+		WHERE hash = ? OR (upstream_id != '' AND upstream_id = ? AND source = ?) ORDER BY id LIMIT 1`,
+		textHash(j.Text), j.UpstreamID, j.Source))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Joke{}, ErrNotFound
+	}
+	if err != nil {
+		return Joke{}, fmt.Errorf("error finding joke in database: %w", err)
+	}
+	return found, nil
+}
+
+// LeastRecentlyTold implements Store
+func (s *SQLiteStore) LeastRecentlyTold(ctx context.Context, lang string, before time.Time) (Joke, error) {
+	j, err := scanJoke(s.queryRow(ctx, "SELECT "+jokeColumns+` FROM jokes
+		WHERE language = ? AND told_at IS NOT NULL AND told_at < ? ORDER BY told_at, id LIMIT 1`,
+		lang, before.UTC()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Joke{}, ErrNoJokes
+	}
+	if err != nil {
+		return Joke{}, fmt.Errorf("error getting least recently told joke from database: %w", err)
+	}
+	return j, nil
+}
+
+// Save implements Store
+func (s *SQLiteStore) Save(ctx context.Context, j *Joke) error {
+	var toldAt, rating any
+	if j.ToldAt != nil {
+		toldAt = j.ToldAt.UTC()
+		if j.TimesTold == 0 {
+			j.TimesTold = 1
+		}
+	}
+	if j.Rating != 0 {
+		rating = j.Rating
+	}
+	res, err := s.exec(ctx, "INSERT INTO jokes (joke, hash, upstream_id, source, language, told_at, rating, times_told) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		j.Text, textHash(j.Text), j.UpstreamID, j.Source, j.Language, toldAt, rating, j.TimesTold)
+	if isUniqueViolation(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	j.ID = id
+	if err := s.queryRow(ctx, "SELECT created_at FROM jokes WHERE id = ?", id).Scan(&j.CreatedAt); err != nil {
+		return err
+	}
+	if j.ToldAt != nil {
+		if err := s.recordTelling(ctx, id, *j.ToldAt); err != nil {
+			return err
+		}
+	}
+	if len(j.Tags) > 0 {
+		return s.AddTags(ctx, id, j.Tags...)
+	}
+	return nil
+}
+
+// NextUntold implements Store
+func (s *SQLiteStore) NextUntold(ctx context.Context, lang string) (Joke, error) {
+	j, err := scanJoke(s.queryRow(ctx, "SELECT "+jokeColumns+" FROM jokes WHERE told_at IS NULL AND language = ? ORDER BY id LIMIT 1", lang))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Joke{}, ErrNoJokes
+	}
+	if err != nil {
+		return Joke{}, fmt.Errorf("error getting untold joke from database: %w", err)
+	}
+	return j, nil
+}
+
+// MarkTold implements Store
+func (s *SQLiteStore) MarkTold(ctx context.Context, j *Joke) error {
+	now := time.Now().UTC()
+	if _, err := s.exec(ctx, "UPDATE jokes SET told_at = ?, times_told = times_told + 1 WHERE id = ?", now, j.ID); err != nil {
+		return fmt.Errorf("error marking joke as told: %w", err)
+	}
+	if err := s.recordTelling(ctx, j.ID, now); err != nil {
+		return err
+	}
+	j.ToldAt = &now
+	j.TimesTold++
+	return nil
+}
+
+// Claim implements ClaimStore
+func (s *SQLiteStore) Claim(ctx context.Context, j *Joke) (bool, error) {
+	now := time.Now().UTC()
+	res, err := s.exec(ctx, "UPDATE jokes SET told_at = ?, times_told = times_told + 1 WHERE id = ? AND times_told = ?", now, j.ID, j.TimesTold)
+	if err != nil {
+		return false, fmt.Errorf("error marking joke as told: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	if err := s.recordTelling(ctx, j.ID, now); err != nil {
+		return false, err
+	}
+	j.ToldAt = &now
+	j.TimesTold++
+	return true, nil
+}
+
+// Get implements Store
+func (s *SQLiteStore) Get(ctx context.Context, id int64) (Joke, error) {
+	j, err := scanJoke(s.queryRow(ctx, "SELECT "+jokeColumns+" FROM jokes WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Joke{}, fmt.Errorf("%w: %d", ErrNotFound, id)
+	}
+	if err != nil {
+		return Joke{}, fmt.Errorf("error getting joke from database: %w", err)
+	}
+	if j.Tags, err = s.jokeTags(ctx, id); err != nil {
+		return Joke{}, err
+	}
+	return j, nil
+}
+
+// Rate implements Store
+func (s *SQLiteStore) Rate(ctx context.Context, id int64, rating int) error {
+	if rating < MinRating || rating > MaxRating {
+		return ErrInvalidRating
+	}
+	res, err := s.db.ExecContext(ctx, "UPDATE jokes SET rating = ? WHERE id = ?", rating, id)
+	if err != nil {
+		return fmt.Errorf("error rating joke: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: %d", ErrNotFound, id)
+	}
+	return nil
+}
+
+// Random implements Store. Each joke is weighted by its rating, so a joke
+// rated 5 is five times as likely to be picked as one rated 1; unrated
+// jokes count as rated in the middle.
+func (s *SQLiteStore) Random(ctx context.Context) (Joke, error) {
+	return s.random(ctx, "")
+}
+
+// RandomIn implements Store
+func (s *SQLiteStore) RandomIn(ctx context.Context, lang string) (Joke, error) {
+	return s.random(ctx, "WHERE language = ?", lang)
+}
+
+// RandomTagged implements Store
+func (s *SQLiteStore) RandomTagged(ctx context.Context, tag string) (Joke, error) {
+	return s.random(ctx, "WHERE id IN (SELECT joke_id FROM joke_tags JOIN tags ON tags.id = tag_id WHERE name = ?)", NormalizeTag(tag))
+}
+
+// random picks a weighted random joke among those matching where
+func (s *SQLiteStore) random(ctx context.Context, where string, args ...any) (Joke, error) {
+	// Pick the first joke whose running total of weights passes a random
+	// point between zero and the sum of all weights
+	args = append([]any{unratedWeight, unratedWeight}, args...)
+	args = append(args, rand.Float64())
+	j, err := scanJoke(s.db.QueryRowContext(ctx, `WITH weighted AS (
+			SELECT `+jokeColumns+`,
+				SUM(COALESCE(rating, ?)) OVER (ORDER BY id) AS running,
+				SUM(COALESCE(rating, ?)) OVER () AS total
+			FROM jokes `+where+`
+		)
+		SELECT `+jokeColumns+` FROM weighted WHERE running > ? * total ORDER BY id LIMIT 1`,
+		args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Joke{}, ErrNoJokes
+	}
+	if err != nil {
+		return Joke{}, fmt.Errorf("error getting random joke from database: %w", err)
+	}
+	return j, nil
+}
+
+// History implements Store
+func (s *SQLiteStore) History(ctx context.Context, f HistoryFilter) ([]Joke, error) {
+	query := "SELECT " + jokeColumns + " FROM jokes WHERE told_at IS NOT NULL"
+	var args []any
+	if f.Language != "" {
+		query += " AND language = ?"
+		args = append(args, f.Language)
+	}
+	if f.Source != "" {
+		query += " AND source = ?"
+		args = append(args, f.Source)
+	}
+	if f.Tag != "" {
+		query += " AND id IN (SELECT joke_id FROM joke_tags JOIN tags ON tags.id = tag_id WHERE name = ?)"
+		args = append(args, NormalizeTag(f.Tag))
+	}
+	if !f.Since.IsZero() {
+		query += " AND told_at >= ?"
+		args = append(args, f.Since.UTC())
+	}
+	if f.MinRating > 0 {
+		query += " AND rating >= ?"
+		args = append(args, f.MinRating)
+	}
+	query += " ORDER BY told_at DESC, id DESC"
+	if f.Limit > 0 || f.Offset > 0 {
+		limit := f.Limit
+		if limit <= 0 {
+			limit = -1
+		}
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, f.Offset)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying history: %w", err)
+	}
+	defer rows.Close()
+
+	var jokes []Joke
+	for rows.Next() {
+		j, err := scanJoke(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error reading history: %w", err)
+		}
+		jokes = append(jokes, j)
+	}
+	return jokes, rows.Err()
+}
+
+// Close implements Store
+func (s *SQLiteStore) Close() error {
+	s.stmts.Range(func(_, stmt any) bool {
+		stmt.(*sql.Stmt).Close()
+		return true
+	})
+	return s.db.Close()
+}
+
+var _ ClaimStore = (*SQLiteStore)(nil)
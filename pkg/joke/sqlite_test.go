@@ -0,0 +1,264 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSQLiteStoreUpgradesOldSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jokes.db")
+
+	// Create a database the way the first release did
+	old, err := sql.Open(sqliteDriver, path)
+	if err != nil {
+		t.Fatalf("Failed to open the database: %v", err)
+	}
+	_, err = old.Exec(`CREATE TABLE jokes (
+		id INTEGER PRIMARY KEY,
+		joke TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		t.Fatalf("Failed to create the table: %v", err)
+	}
+	if _, err := old.Exec("INSERT INTO jokes (joke) VALUES ('An old joke')"); err != nil {
+		t.Fatalf("Failed to insert a joke: %v", err)
+	}
+	old.Close()
+
+	store, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatalf("OpenSQLite() returned an error: %v", err)
+	}
+	defer store.Close()
+
+	j, err := store.Random(context.Background())
+	if err != nil {
+		t.Fatalf("Random() returned an error: %v", err)
+	}
+	if j.Text != "An old joke" || j.Source != "" {
+		t.Errorf("Random() returned %+v, want the old joke without metadata", j)
+	}
+}
+
+func TestSQLiteStoreExists(t *testing.T) {
+	store := newTestStore(t)
+
+	saved := Joke{Text: "A joke", UpstreamID: "abc", Source: "icanhazdadjoke", Language: "en"}
+	if err := store.Save(context.Background(), &saved); err != nil {
+		t.Fatalf("Save() returned an error: %v", err)
+	}
+
+	testCases := []struct {
+		name string
+		joke Joke
+		want bool
+	}{
+		{name: "SameText", joke: Joke{Text: "A joke"}, want: true},
+		{name: "SameUpstreamID", joke: Joke{Text: "A reworded joke", UpstreamID: "abc", Source: "icanhazdadjoke"}, want: true},
+		{name: "SameIDOtherSource", joke: Joke{Text: "Another joke", UpstreamID: "abc", Source: "other"}, want: false},
+		{name: "New", joke: Joke{Text: "Another joke"}, want: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := store.Exists(context.Background(), tc.joke)
+			if err != nil {
+				t.Fatalf("Exists() returned an error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("Exists() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSQLiteStoreHistoryFilter(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	saved := []Joke{
+		{Text: "Old English joke", Source: "icanhazdadjoke", Language: "en", ToldAt: ptr(now.Add(-48 * time.Hour))},
+		{Text: "English joke", Source: "icanhazdadjoke", Language: "en", ToldAt: ptr(now.Add(-2 * time.Hour))},
+		{Text: "Deutscher Witz", Source: "flachwitze", Language: "de", ToldAt: ptr(now.Add(-time.Hour))},
+		{Text: "Prefetched joke", Source: "icanhazdadjoke", Language: "en"},
+	}
+	for i := range saved {
+		if err := store.Save(ctx, &saved[i]); err != nil {
+			t.Fatalf("Save() returned an error: %v", err)
+		}
+	}
+	for i, rating := range map[int]int{0: 5, 2: 3} {
+		if err := store.Rate(ctx, saved[i].ID, rating); err != nil {
+			t.Fatalf("Rate() returned an error: %v", err)
+		}
+	}
+
+	testCases := []struct {
+		name   string
+		filter HistoryFilter
+		want   []string
+	}{
+		{name: "All", want: []string{"Deutscher Witz", "English joke", "Old English joke"}},
+		{name: "Language", filter: HistoryFilter{Language: "en"}, want: []string{"English joke", "Old English joke"}},
+		{name: "Source", filter: HistoryFilter{Source: "flachwitze"}, want: []string{"Deutscher Witz"}},
+		{name: "Since", filter: HistoryFilter{Since: now.Add(-24 * time.Hour)}, want: []string{"Deutscher Witz", "English joke"}},
+		{name: "Limit", filter: HistoryFilter{Limit: 1}, want: []string{"Deutscher Witz"}},
+		{name: "Offset", filter: HistoryFilter{Offset: 1}, want: []string{"English joke", "Old English joke"}},
+		{name: "Page", filter: HistoryFilter{Limit: 1, Offset: 1}, want: []string{"English joke"}},
+		{name: "MinRating", filter: HistoryFilter{MinRating: 3}, want: []string{"Deutscher Witz", "Old English joke"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			jokes, err := store.History(ctx, tc.filter)
+			if err != nil {
+				t.Fatalf("History() returned an error: %v", err)
+			}
+			if len(jokes) != len(tc.want) {
+				t.Fatalf("History() returned %d jokes, want %d", len(jokes), len(tc.want))
+			}
+			for i, j := range jokes {
+				if j.Text != tc.want[i] {
+					t.Errorf("joke %d is %q, want %q", i, j.Text, tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestSQLiteStoreRate(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	good := Joke{Text: "A good joke"}
+	bad := Joke{Text: "A bad joke"}
+	for _, j := range []*Joke{&good, &bad} {
+		if err := store.Save(ctx, j); err != nil {
+			t.Fatalf("Save() returned an error: %v", err)
+		}
+	}
+	if err := store.Rate(ctx, good.ID, MaxRating); err != nil {
+		t.Fatalf("Rate() returned an error: %v", err)
+	}
+	if err := store.Rate(ctx, bad.ID, MinRating); err != nil {
+		t.Fatalf("Rate() returned an error: %v", err)
+	}
+
+	if err := store.Rate(ctx, good.ID, MaxRating+1); !errors.Is(err, ErrInvalidRating) {
+		t.Errorf("Rate() with %d returned %v, want ErrInvalidRating", MaxRating+1, err)
+	}
+	if err := store.Rate(ctx, 999, MaxRating); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Rate() of an unknown joke returned %v, want ErrNotFound", err)
+	}
+	if j, _ := store.Get(ctx, good.ID); j.Rating != MaxRating {
+		t.Errorf("Get() returned rating %d, want %d", j.Rating, MaxRating)
+	}
+
+	// The good joke should be picked about five times as often
+	counts := map[int64]int{}
+	for i := 0; i < 1200; i++ {
+		j, err := store.Random(ctx)
+		if err != nil {
+			t.Fatalf("Random() returned an error: %v", err)
+		}
+		counts[j.ID]++
+	}
+	if counts[good.ID] < 3*counts[bad.ID] {
+		t.Errorf("Random() picked the good joke %d times and the bad one %d times, want a bias towards the good one", counts[good.ID], counts[bad.ID])
+	}
+}
+
+func TestSQLiteStoreConcurrentWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jokes.db")
+	ctx := context.Background()
+
+	// Two godad processes, each with its own connections, save at once
+	var stores [2]*SQLiteStore
+	for i := range stores {
+		store, err := OpenSQLite(path)
+		if err != nil {
+			t.Fatalf("OpenSQLite() returned an error: %v", err)
+		}
+		defer store.Close()
+		stores[i] = store
+	}
+	var mode string
+	if err := stores[0].db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil || mode != "wal" {
+		t.Errorf("journal_mode = %q, %v, want wal", mode, err)
+	}
+
+	errs := make(chan error, 2*50)
+	for i, store := range stores {
+		go func() {
+			for n := range 50 {
+				j := Joke{Text: fmt.Sprintf("Joke %d of store %d", n, i), Language: "en"}
+				if err := store.Save(ctx, &j); err != nil {
+					errs <- err
+					continue
+				}
+				_, err := store.Exists(ctx, j)
+				errs <- err
+			}
+		}()
+	}
+	for range 2 * 50 {
+		if err := <-errs; err != nil {
+			t.Errorf("Concurrent Save() or Exists() returned an error: %v", err)
+		}
+	}
+}
+
+func TestSQLiteStoreExistsUsesIndexes(t *testing.T) {
+	store := newTestStore(t)
+	rows, err := store.db.Query(`EXPLAIN QUERY PLAN SELECT COUNT(*) FROM jokes
+		WHERE hash = ? OR (upstream_id != '' AND upstream_id = ? AND source = ?)`, "", "", "")
+	if err != nil {
+		t.Fatalf("Failed to explain the query: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			id, parent, notUsed int
+			detail              string
+		)
+		if err := rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+			t.Fatalf("Failed to read the query plan: %v", err)
+		}
+		if strings.HasPrefix(detail, "SCAN") {
+			t.Errorf("Exists() scans the jokes table: %s", detail)
+		}
+	}
+}
+
+// BenchmarkOpenSQLite measures opening an existing database, which every
+// godad command does first
+func BenchmarkOpenSQLite(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "jokes.db")
+	store, err := OpenSQLite(path)
+	if err != nil {
+		b.Fatalf("Failed to open the database: %v", err)
+	}
+	store.Close()
+
+	b.ResetTimer()
+	for range b.N {
+		store, err := OpenSQLite(path)
+		if err != nil {
+			b.Fatalf("OpenSQLite() returned an error: %v", err)
+		}
+		store.Close()
+	}
+}
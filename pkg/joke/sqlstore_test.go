@@ -0,0 +1,97 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sqliteDialect lets SQLStore work on a SQLite database, so it can be
+// tested without a database server
+var sqliteDialect = dialect{
+	id:          "INTEGER PRIMARY KEY",
+	timestamp:   "DATETIME",
+	length:      "LENGTH",
+	placeholder: func(int) string { return "?" },
+	insertIgnore: func(insert string) string {
+		return "INSERT OR IGNORE" + strings.TrimPrefix(insert, "INSERT")
+	},
+	isUniqueViolation: isUniqueViolation,
+}
+
+// newTestSQLStore opens a SQLStore. It uses the PostgreSQL or MySQL
+// database in GODAD_TEST_POSTGRES or GODAD_TEST_MYSQL if set, dropping
+// the tables when done, and a SQLite database otherwise.
+func newTestSQLStore(t *testing.T) *SQLStore {
+	t.Helper()
+	var (
+		store *SQLStore
+		err   error
+	)
+	if dsn := os.Getenv("GODAD_TEST_POSTGRES"); dsn != "" {
+		store, err = OpenPostgres(dsn)
+	} else if dsn := os.Getenv("GODAD_TEST_MYSQL"); dsn != "" {
+		store, err = OpenMySQL(dsn)
+	} else {
+		dsn, dsnErr := sqliteDSN(filepath.Join(t.TempDir(), "jokes.db"), "")
+		if dsnErr != nil {
+			t.Fatal(dsnErr)
+		}
+		db, openErr := sql.Open(sqliteDriver, dsn)
+		if openErr != nil {
+			t.Fatal(openErr)
+		}
+		store, err = openSQLStore(db, sqliteDialect)
+	}
+	if err != nil {
+		t.Fatalf("Failed to open the database: %v", err)
+	}
+	t.Cleanup(func() {
+		tx, err := store.db.Begin()
+		if err == nil {
+			migrations := sqlMigrations(store.d)
+			for i := len(migrations) - 1; i >= 0; i-- {
+				_ = migrations[i].Down(tx)
+			}
+			_, _ = tx.Exec("DROP TABLE schema_version")
+			_ = tx.Commit()
+		}
+		store.Close()
+	})
+	return store
+}
+
+func TestSQLStore(t *testing.T) {
+	testStore(t, newTestSQLStore(t))
+}
+
+func TestSQLStoreImportExport(t *testing.T) {
+	testImportExport(t, newTestSQLStore(t))
+}
+
+func TestSQLStoreMigrate(t *testing.T) {
+	store := newTestSQLStore(t)
+	version, err := store.SchemaVersion()
+	if err != nil {
+		t.Fatalf("SchemaVersion() returned an error: %v", err)
+	}
+	if want := len(sqlMigrations(store.d)); version != want {
+		t.Errorf("SchemaVersion() = %d, want %d", version, want)
+	}
+	if err := store.Migrate(); err != nil {
+		t.Errorf("Migrate() of a migrated database returned an error: %v", err)
+	}
+}
+
+func TestRebind(t *testing.T) {
+	store := &SQLStore{d: postgres}
+	got := store.rebind("SELECT id FROM jokes WHERE language = ? AND told_at < ? LIMIT ?")
+	if want := "SELECT id FROM jokes WHERE language = $1 AND told_at < $2 LIMIT $3"; got != want {
+		t.Errorf("rebind() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"time"
+	"unicode/utf8"
+)
+
+// Telling records that a joke was told. Tellings outlive their jokes, so
+// deleting jokes doesn't rewrite the statistics.
+type Telling struct {
+	JokeID   int64  `json:"joke_id"`
+	Source   string `json:"source"`
+	Language string `json:"language"`
+	// Length is the length of the joke in characters
+	Length int       `json:"length"`
+	ToldAt time.Time `json:"told_at"`
+}
+
+// StatsStore is a Store that keeps every time a joke was told, not just
+// the last one. Jokes told before the store kept them count once, when
+// they were last told.
+type StatsStore interface {
+	Store
+	// Tellings returns every telling, oldest first
+	Tellings(ctx context.Context) ([]Telling, error)
+}
+
+// DayCount is the number of jokes told in a day, or in the week starting
+// on Date
+type DayCount struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+}
+
+// NameCount is the number of jokes told from a source or in a language
+type NameCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Stats sums up the jokes told
+type Stats struct {
+	Told int `json:"told"`
+	// Jokes counts the different jokes told
+	Jokes int `json:"jokes"`
+	// Days and Weeks count the jokes told on the last days and in the last
+	// weeks, starting on Monday, oldest first
+	Days  []DayCount `json:"days"`
+	Weeks []DayCount `json:"weeks"`
+	// Streak counts the days in a row up to today with a joke told, or up
+	// to yesterday while none was told today yet, and BestStreak the most
+	// days in a row ever
+	Streak     int `json:"streak"`
+	BestStreak int `json:"best_streak"`
+	// Sources and Languages are sorted by how many jokes were told, most
+	// first
+	Sources       []NameCount `json:"sources"`
+	Languages     []NameCount `json:"languages"`
+	AverageLength float64     `json:"average_length"`
+}
+
+// NewStats sums up tellings as of now, counting the jokes told on each of
+// the last days and in each of the last weeks. Dates are in the time zone
+// of now.
+func NewStats(tellings []Telling, now time.Time, days, weeks int) Stats {
+	var stats Stats
+	loc := now.Location()
+	today := startOfDay(now)
+	monday := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+
+	jokes := map[int64]bool{}
+	perDay := map[string]int{}
+	perWeek := map[string]int{}
+	sources := map[string]int{}
+	languages := map[string]int{}
+	length := 0
+	for _, t := range tellings {
+		day := startOfDay(t.ToldAt.In(loc))
+		stats.Told++
+		jokes[t.JokeID] = true
+		perDay[day.Format(time.DateOnly)]++
+		week := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		perWeek[week.Format(time.DateOnly)]++
+		sources[t.Source]++
+		languages[t.Language]++
+		length += t.Length
+	}
+	stats.Jokes = len(jokes)
+	if stats.Told > 0 {
+		stats.AverageLength = float64(length) / float64(stats.Told)
+	}
+
+	for i := days - 1; i >= 0; i-- {
+		date := today.AddDate(0, 0, -i).Format(time.DateOnly)
+		stats.Days = append(stats.Days, DayCount{Date: date, Count: perDay[date]})
+	}
+	for i := weeks - 1; i >= 0; i-- {
+		date := monday.AddDate(0, 0, -7*i).Format(time.DateOnly)
+		stats.Weeks = append(stats.Weeks, DayCount{Date: date, Count: perWeek[date]})
+	}
+
+	day := today
+	if perDay[day.Format(time.DateOnly)] == 0 {
+		day = day.AddDate(0, 0, -1)
+	}
+	for perDay[day.Format(time.DateOnly)] > 0 {
+		stats.Streak++
+		day = day.AddDate(0, 0, -1)
+	}
+	stats.BestStreak = bestStreak(perDay, loc)
+
+	stats.Sources = sortedCounts(sources)
+	stats.Languages = sortedCounts(languages)
+	return stats
+}
+
+// startOfDay returns the midnight starting the day t falls on
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// bestStreak returns the most dates in a row in perDay
+func bestStreak(perDay map[string]int, loc *time.Location) int {
+	dates := make([]string, 0, len(perDay))
+	for date := range perDay {
+		dates = append(dates, date)
+	}
+	slices.Sort(dates)
+
+	best, streak := 0, 0
+	var last time.Time
+	for _, date := range dates {
+		day, err := time.ParseInLocation(time.DateOnly, date, loc)
+		if err != nil {
+			continue
+		}
+		if streak > 0 && last.AddDate(0, 0, 1).Equal(day) {
+			streak++
+		} else {
+			streak = 1
+		}
+		best = max(best, streak)
+		last = day
+	}
+	return best
+}
+
+// sortedCounts returns counts sorted by count, most first, then by name
+func sortedCounts(counts map[string]int) []NameCount {
+	sorted := make([]NameCount, 0, len(counts))
+	for name, count := range counts {
+		sorted = append(sorted, NameCount{Name: name, Count: count})
+	}
+	slices.SortFunc(sorted, func(a, b NameCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Name, b.Name))
+	})
+	return sorted
+}
+
+// newTelling returns the telling of j at toldAt
+func newTelling(j Joke, toldAt time.Time) Telling {
+	return Telling{JokeID: j.ID, Source: j.Source, Language: j.Language, Length: utf8.RuneCountInString(j.Text), ToldAt: toldAt.UTC()}
+}
+
+// recordTelling records that the stored joke with the given ID was told
+// at toldAt
+func (s *SQLiteStore) recordTelling(ctx context.Context, id int64, toldAt time.Time) error {
+	if _, err := s.exec(ctx, `INSERT INTO tellings (joke_id, source, language, length, told_at)
+		SELECT id, source, language, length(joke), ? FROM jokes WHERE id = ?`, toldAt.UTC(), id); err != nil {
+		return fmt.Errorf("error recording telling: %w", err)
+	}
+	return nil
+}
+
+// Tellings implements StatsStore
+func (s *SQLiteStore) Tellings(ctx context.Context) ([]Telling, error) {
+	return queryTellings(ctx, s.db, "SELECT joke_id, source, language, length, told_at FROM tellings ORDER BY told_at, id")
+}
+
+// queryTellings returns the tellings query returns
+func queryTellings(ctx context.Context, db queryer, query string) ([]Telling, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("error getting tellings: %w", err)
+	}
+	defer rows.Close()
+
+	var tellings []Telling
+	for rows.Next() {
+		var t Telling
+		if err := rows.Scan(&t.JokeID, &t.Source, &t.Language, &t.Length, &t.ToldAt); err != nil {
+			return nil, fmt.Errorf("error reading telling: %w", err)
+		}
+		tellings = append(tellings, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error getting tellings: %w", err)
+	}
+	return tellings, nil
+}
+
+var _ StatsStore = (*SQLiteStore)(nil)
@@ -0,0 +1,89 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewStats(t *testing.T) {
+	// A Wednesday
+	now := time.Date(2024, 5, 8, 9, 0, 0, 0, time.UTC)
+	day := func(days int) time.Time { return now.AddDate(0, 0, days) }
+	tellings := []Telling{
+		{JokeID: 1, Source: "icanhazdadjoke", Language: "en", Length: 40, ToldAt: day(-10)},
+		{JokeID: 2, Source: "icanhazdadjoke", Language: "en", Length: 60, ToldAt: day(-9)},
+		{JokeID: 3, Source: "flachwitze", Language: "de", Length: 20, ToldAt: day(-8)},
+		{JokeID: 1, Source: "icanhazdadjoke", Language: "en", Length: 40, ToldAt: day(-2)},
+		{JokeID: 4, Source: "user", Language: "en", Length: 30, ToldAt: day(-1)},
+		{JokeID: 5, Source: "user", Language: "en", Length: 10, ToldAt: day(-1)},
+	}
+
+	stats := NewStats(tellings, now, 3, 2)
+	want := Stats{
+		Told:          6,
+		Jokes:         5,
+		Days:          []DayCount{{Date: "2024-05-06", Count: 1}, {Date: "2024-05-07", Count: 2}, {Date: "2024-05-08", Count: 0}},
+		Weeks:         []DayCount{{Date: "2024-04-29", Count: 2}, {Date: "2024-05-06", Count: 3}},
+		Streak:        2,
+		BestStreak:    3,
+		Sources:       []NameCount{{Name: "icanhazdadjoke", Count: 3}, {Name: "user", Count: 2}, {Name: "flachwitze", Count: 1}},
+		Languages:     []NameCount{{Name: "en", Count: 5}, {Name: "de", Count: 1}},
+		AverageLength: 200.0 / 6,
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("NewStats() = %+v, want %+v", stats, want)
+	}
+
+	// The streak ends once a day passes without a joke
+	if stats := NewStats(tellings, day(2), 0, 0); stats.Streak != 0 || stats.BestStreak != 3 {
+		t.Errorf("NewStats() two days later has streaks %d and %d, want 0 and 3", stats.Streak, stats.BestStreak)
+	}
+	if stats := NewStats(nil, now, 1, 0); stats.Told != 0 || stats.AverageLength != 0 || len(stats.Days) != 1 {
+		t.Errorf("NewStats() without tellings = %+v, want zeros for one day", stats)
+	}
+}
+
+func TestSQLiteTellings(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+
+	// Jokes told before tellings were kept count once
+	if err := store.MigrateTo(13); err != nil {
+		t.Fatalf("MigrateTo() returned an error: %v", err)
+	}
+	old := Joke{Text: "An old joke", Source: "icanhazdadjoke", Language: "en", ToldAt: ptr(time.Now().Add(-time.Hour)), TimesTold: 3}
+	if _, err := store.DB().Exec("INSERT INTO jokes (joke, hash, source, language, told_at, times_told) VALUES (?, ?, ?, ?, ?, ?)",
+		old.Text, textHash(old.Text), old.Source, old.Language, old.ToldAt.UTC(), old.TimesTold); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Migrate(); err != nil {
+		t.Fatalf("Migrate() returned an error: %v", err)
+	}
+
+	j := Joke{Text: "Ein neuer Witz über Käse", Source: "user", Language: "de", ToldAt: ptr(time.Now())}
+	if err := store.Save(ctx, &j); err != nil {
+		t.Fatalf("Save() returned an error: %v", err)
+	}
+	if err := store.MarkTold(ctx, &j); err != nil {
+		t.Fatalf("MarkTold() returned an error: %v", err)
+	}
+	if ok, err := store.Claim(ctx, &Joke{ID: j.ID}); ok || err != nil {
+		t.Errorf("Claim() of a joke told since = %v, %v, want false", ok, err)
+	}
+
+	tellings, err := store.Tellings(ctx)
+	if err != nil {
+		t.Fatalf("Tellings() returned an error: %v", err)
+	}
+	if len(tellings) != 3 || tellings[0].Source != "icanhazdadjoke" || tellings[1].JokeID != j.ID || tellings[2].JokeID != j.ID {
+		t.Fatalf("Tellings() = %+v, want the old joke once and the new joke twice", tellings)
+	}
+	if tellings[1].Language != "de" || tellings[1].Length != 24 {
+		t.Errorf("Tellings() recorded %+v, want the language and the length in characters", tellings[1])
+	}
+}
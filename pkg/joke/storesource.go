@@ -0,0 +1,64 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import "context"
+
+// StoreSourceName is the name of the source that repeats stored jokes
+const StoreSourceName = "db"
+
+// UserSourceName is the source of the jokes users added themselves
+const UserSourceName = "user"
+
+// Repeater is implemented by sources whose jokes may have been told
+// before, like the local database. The engine tells their jokes as they
+// are, without checking for duplicates, and still uses them offline.
+type Repeater interface {
+	Source
+	// Repeats reports whether the source may return told jokes
+	Repeats() bool
+}
+
+// repeats reports whether src may return jokes that have been told before
+func repeats(src Source) bool {
+	r, ok := src.(Repeater)
+	return ok && r.Repeats()
+}
+
+// StoreSource tells random jokes from a Store again. It usually ends the
+// fallback chain so that there is a joke even when every API is down.
+type StoreSource struct {
+	store Store
+	lang  string
+}
+
+// NewStoreSource returns a source repeating jokes in lang from store, or
+// jokes in any language if lang is empty
+func NewStoreSource(store Store, lang string) *StoreSource {
+	return &StoreSource{store: store, lang: lang}
+}
+
+// Name implements Source
+func (s *StoreSource) Name() string {
+	return StoreSourceName
+}
+
+// Language implements Source
+func (s *StoreSource) Language() string {
+	return s.lang
+}
+
+// Fetch implements Source. Without stored jokes in its language it
+// returns ErrNoJokes, so the chain falls through to the next source.
+func (s *StoreSource) Fetch(ctx context.Context) (Joke, error) {
+	if s.lang == "" {
+		return s.store.Random(ctx)
+	}
+	return s.store.RandomIn(ctx, s.lang)
+}
+
+// Repeats implements Repeater
+func (s *StoreSource) Repeats() bool {
+	return true
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Submitter sends jokes to an upstream collection, so everyone gets to
+// hear them
+type Submitter interface {
+	// Name identifies where jokes are submitted to, like "icanhazdadjoke"
+	Name() string
+	// Submit sends j upstream. A nil error only means the joke was sent:
+	// submission forms answer with a page for people either way, so
+	// whether it was accepted isn't known until it is published.
+	Submit(ctx context.Context, j Joke) error
+}
+
+// Submission records that a joke was submitted upstream
+type Submission struct {
+	JokeID int64 `json:"joke_id"`
+	// Target is the name of the Submitter the joke was submitted to
+	Target      string    `json:"target"`
+	SubmittedAt time.Time `json:"submitted_at"`
+	// Error is why sending the joke failed, or "" if it was sent, which
+	// doesn't mean it was accepted
+	Error string `json:"error,omitempty"`
+}
+
+// SubmissionStore is a Store that remembers which jokes were submitted
+// upstream, so they are only submitted once
+type SubmissionStore interface {
+	Store
+	// RecordSubmission stores s, replacing an earlier submission of the
+	// same joke to the same target
+	RecordSubmission(ctx context.Context, s Submission) error
+	// Submissions returns every submission, most recent first
+	Submissions(ctx context.Context) ([]Submission, error)
+}
+
+// Submit implements Submitter. The joke is posted to the submission form
+// of icanhazdadjoke.com, where it is reviewed before it is published.
+// Only English jokes are accepted. The site doesn't confirm submissions,
+// so a form it rejected looks the same as one it took.
+func (s *ICanHazDadJoke) Submit(ctx context.Context, j Joke) error {
+	if j.Language != "" && j.Language != s.Language() {
+		return fmt.Errorf("%s only takes jokes in %s, not %s", s.Name(), s.Language(), j.Language)
+	}
+	endpoint, err := url.JoinPath(s.URL, "submit")
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	form := url.Values{}
+	form.Set("joke", j.Text)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+	// The form answers with a page for people, nothing that says whether
+	// the joke was taken
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return checkStatus(resp)
+}
+
+// RecordSubmission implements SubmissionStore
+func (s *SQLiteStore) RecordSubmission(ctx context.Context, sub Submission) error {
+	if _, err := s.db.ExecContext(ctx, `INSERT INTO submissions (joke_id, target, submitted_at, error) VALUES (?, ?, ?, ?)
+		ON CONFLICT (joke_id, target) DO UPDATE SET submitted_at = excluded.submitted_at, error = excluded.error`,
+		sub.JokeID, sub.Target, sub.SubmittedAt.UTC(), sub.Error); err != nil {
+		return fmt.Errorf("error recording submission: %w", err)
+	}
+	return nil
+}
+
+// Submissions implements SubmissionStore
+func (s *SQLiteStore) Submissions(ctx context.Context) ([]Submission, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT joke_id, target, submitted_at, error FROM submissions ORDER BY submitted_at DESC, joke_id DESC")
+	if err != nil {
+		return nil, fmt.Errorf("error getting submissions: %w", err)
+	}
+	defer rows.Close()
+
+	var subs []Submission
+	for rows.Next() {
+		var sub Submission
+		if err := rows.Scan(&sub.JokeID, &sub.Target, &sub.SubmittedAt, &sub.Error); err != nil {
+			return nil, fmt.Errorf("error reading submission: %w", err)
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+var (
+	_ Submitter       = (*ICanHazDadJoke)(nil)
+	_ SubmissionStore = (*SQLiteStore)(nil)
+)
@@ -0,0 +1,59 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestICanHazDadJokeSubmit(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/submit" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+		}
+		got = r.PostFormValue("joke")
+		_, _ = w.Write([]byte("<html>Thanks!</html>"))
+	}))
+	defer server.Close()
+
+	src := newTestSource(server)
+	if err := src.Submit(context.Background(), Joke{Text: "My joke", Language: "en"}); err != nil {
+		t.Fatalf("Submit() returned an error: %v", err)
+	}
+	if got != "My joke" {
+		t.Errorf("Submit() posted %q, want the joke", got)
+	}
+	if err := src.Submit(context.Background(), Joke{Text: "Mein Witz", Language: "de"}); err == nil {
+		t.Error("Submit() accepted a German joke")
+	}
+}
+
+func TestSQLiteSubmissions(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	j := Joke{Text: "My joke", Source: UserSourceName, Language: "en"}
+	if err := store.Save(ctx, &j); err != nil {
+		t.Fatal(err)
+	}
+
+	failed := Submission{JokeID: j.ID, Target: "icanhazdadjoke", SubmittedAt: time.Now().Add(-time.Hour), Error: "boom"}
+	if err := store.RecordSubmission(ctx, failed); err != nil {
+		t.Fatalf("RecordSubmission() returned an error: %v", err)
+	}
+	if err := store.RecordSubmission(ctx, Submission{JokeID: j.ID, Target: "icanhazdadjoke", SubmittedAt: time.Now()}); err != nil {
+		t.Fatalf("RecordSubmission() returned an error: %v", err)
+	}
+	subs, err := store.Submissions(ctx)
+	if err != nil {
+		t.Fatalf("Submissions() returned an error: %v", err)
+	}
+	if len(subs) != 1 || subs[0].JokeID != j.ID || subs[0].Error != "" {
+		t.Errorf("Submissions() = %+v, want the successful retry only", subs)
+	}
+}
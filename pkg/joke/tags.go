@@ -0,0 +1,113 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrEmptyTag is returned when tagging a joke with an empty tag
+var ErrEmptyTag = errors.New("empty tag")
+
+// TagCount is a tag along with the number of jokes tagged with it
+type TagCount struct {
+	Name  string `json:"name"`
+	Jokes int    `json:"jokes"`
+}
+
+// NormalizeTag returns tag in the form it is stored in: lower case, with
+// single spaces between words
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.Join(strings.Fields(tag), " "))
+}
+
+// AddTags implements Store
+func (s *SQLiteStore) AddTags(ctx context.Context, id int64, tags ...string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error tagging joke: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var exists bool
+	if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM jokes WHERE id = ?)", id).Scan(&exists); err != nil {
+		return fmt.Errorf("error tagging joke: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("%w: %d", ErrNotFound, id)
+	}
+
+	for _, tag := range tags {
+		tag = NormalizeTag(tag)
+		if tag == "" {
+			return ErrEmptyTag
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO tags (name) VALUES (?)", tag); err != nil {
+			return fmt.Errorf("error tagging joke: %w", err)
+		}
+		_, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO joke_tags (joke_id, tag_id)
+			SELECT ?, id FROM tags WHERE name = ?`, id, tag)
+		if err != nil {
+			return fmt.Errorf("error tagging joke: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// RemoveTags implements Store
+func (s *SQLiteStore) RemoveTags(ctx context.Context, id int64, tags ...string) error {
+	for _, tag := range tags {
+		_, err := s.db.ExecContext(ctx, `DELETE FROM joke_tags
+			WHERE joke_id = ? AND tag_id = (SELECT id FROM tags WHERE name = ?)`, id, NormalizeTag(tag))
+		if err != nil {
+			return fmt.Errorf("error removing tag: %w", err)
+		}
+	}
+	return nil
+}
+
+// Tags implements Store
+func (s *SQLiteStore) Tags(ctx context.Context) ([]TagCount, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT name, COUNT(*) FROM tags
+		JOIN joke_tags ON joke_tags.tag_id = tags.id
+		GROUP BY name ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("error listing tags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []TagCount
+	for rows.Next() {
+		var t TagCount
+		if err := rows.Scan(&t.Name, &t.Jokes); err != nil {
+			return nil, fmt.Errorf("error listing tags: %w", err)
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// jokeTags returns the tags of a single joke, sorted by name
+func (s *SQLiteStore) jokeTags(ctx context.Context, id int64) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT name FROM tags
+		JOIN joke_tags ON joke_tags.tag_id = tags.id
+		WHERE joke_id = ? ORDER BY name`, id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting tags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, fmt.Errorf("error getting tags: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSQLiteStoreTags(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	pun := Joke{Text: "A pun", ToldAt: &now, Tags: []string{"Puns"}}
+	other := Joke{Text: "Another joke", ToldAt: &now}
+	for _, j := range []*Joke{&pun, &other} {
+		if err := store.Save(ctx, j); err != nil {
+			t.Fatalf("Save() returned an error: %v", err)
+		}
+	}
+
+	if err := store.AddTags(ctx, other.ID, "  Animals ", "puns"); err != nil {
+		t.Fatalf("AddTags() returned an error: %v", err)
+	}
+	if err := store.AddTags(ctx, other.ID, "puns"); err != nil {
+		t.Errorf("AddTags() with an existing tag returned an error: %v", err)
+	}
+	if err := store.AddTags(ctx, 999, "puns"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("AddTags() for an unknown joke returned %v, want ErrNotFound", err)
+	}
+	if err := store.AddTags(ctx, other.ID, " "); !errors.Is(err, ErrEmptyTag) {
+		t.Errorf("AddTags() with an empty tag returned %v, want ErrEmptyTag", err)
+	}
+
+	j, err := store.Get(ctx, other.ID)
+	if err != nil {
+		t.Fatalf("Get() returned an error: %v", err)
+	}
+	if !slices.Equal(j.Tags, []string{"animals", "puns"}) {
+		t.Errorf("Get() returned tags %v, want [animals puns]", j.Tags)
+	}
+
+	tags, err := store.Tags(ctx)
+	if err != nil {
+		t.Fatalf("Tags() returned an error: %v", err)
+	}
+	want := []TagCount{{Name: "animals", Jokes: 1}, {Name: "puns", Jokes: 2}}
+	if !slices.Equal(tags, want) {
+		t.Errorf("Tags() = %v, want %v", tags, want)
+	}
+
+	if err := store.RemoveTags(ctx, other.ID, "PUNS"); err != nil {
+		t.Fatalf("RemoveTags() returned an error: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		j, err := store.RandomTagged(ctx, "puns")
+		if err != nil {
+			t.Fatalf("RandomTagged() returned an error: %v", err)
+		}
+		if j.ID != pun.ID {
+			t.Fatalf("RandomTagged() returned %q, want the only joke tagged puns", j.Text)
+		}
+	}
+	if _, err := store.RandomTagged(ctx, "knock knock"); !errors.Is(err, ErrNoJokes) {
+		t.Errorf("RandomTagged() with an unused tag returned %v, want ErrNoJokes", err)
+	}
+
+	history, err := store.History(ctx, HistoryFilter{Tag: "animals"})
+	if err != nil {
+		t.Fatalf("History() returned an error: %v", err)
+	}
+	if len(history) != 1 || history[0].ID != other.ID {
+		t.Errorf("History() with a tag returned %v, want the joke tagged animals", history)
+	}
+
+	// Tags of deleted jokes are removed with them
+	if _, err := store.DB().Exec("DELETE FROM jokes WHERE id = ?", pun.ID); err != nil {
+		t.Fatalf("Error deleting joke: %v", err)
+	}
+	if tags, _ := store.Tags(ctx); len(tags) != 1 || tags[0].Name != "animals" {
+		t.Errorf("Tags() after deleting a joke = %v, want only animals", tags)
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultTodaySalt is mixed into the pick of the joke of the day unless
+// another salt is given. Teams wanting a joke of their own pick another.
+const DefaultTodaySalt = "godad"
+
+// IndexSource is implemented by sources whose jokes can be fetched by
+// their position in a stable order, so everyone picks the same joke for
+// the same position
+type IndexSource interface {
+	Source
+	// Count returns how many jokes the source has
+	Count(ctx context.Context) (int, error)
+	// FetchIndex returns the joke at position i, from 0 to Count() - 1
+	FetchIndex(ctx context.Context, i int) (Joke, error)
+}
+
+// daySeed returns the number the joke of day is picked with. It only
+// depends on the date of day and on salt.
+func daySeed(day time.Time, salt string) uint64 {
+	sum := sha256.Sum256([]byte(day.Format(time.DateOnly) + "\x00" + salt))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// sameDay reports whether t falls on the date of day, in its time zone
+func sameDay(t, day time.Time) bool {
+	y1, m1, d1 := t.In(day.Location()).Date()
+	y2, m2, d2 := day.Date()
+	return y1 == y2 && m1 == m2 && d1 == d2
+}
+
+// Today tells the joke of the day the date of day falls on. Everyone with
+// the same sources and salt gets the same joke on the same date: it is
+// picked from the first source holding a fixed list of jokes or numbering
+// its jokes, or, offline or when no source can, from the stored jokes.
+// The joke is marked as told once a day, so asking again on the same day
+// tells the same joke without using up fresh ones.
+func (e *Engine) Today(ctx context.Context, day time.Time, salt string) (Joke, error) {
+	seed := daySeed(day, salt)
+	if len(e.Mix) > 0 {
+		return e.mixedToday(seed).today(ctx, day, seed)
+	}
+	return e.today(ctx, day, seed)
+}
+
+// mixedToday returns the engine of the mix picked by seed, where an engine
+// with twice the weight is picked twice as often
+func (e *Engine) mixedToday(seed uint64) *Engine {
+	total := 0.0
+	for _, m := range e.Mix {
+		total += max(m.Weight, 0)
+	}
+	r := float64(seed%1_000_000) / 1_000_000 * total
+	for _, m := range e.Mix {
+		if r -= max(m.Weight, 0); r < 0 {
+			return m.Engine
+		}
+	}
+	return e.Mix[len(e.Mix)-1].Engine
+}
+
+// today tells the joke of the day picked by seed
+func (e *Engine) today(ctx context.Context, day time.Time, seed uint64) (Joke, error) {
+	if !e.Offline {
+		for _, src := range e.Sources {
+			j, ok, err := e.pickToday(ctx, src, seed)
+			if err != nil {
+				if ctx.Err() != nil {
+					return Joke{}, ctx.Err()
+				}
+				log.Warn().Err(err).Str("source", src.Name()).Msg("Source did not provide the joke of the day")
+				continue
+			}
+			if ok {
+				return e.tellToday(ctx, j, day)
+			}
+		}
+	}
+
+	exporter, ok := e.Store.(ExportStore)
+	if !ok {
+		return Joke{}, errors.New("no source or store to pick the joke of the day from")
+	}
+	stored, err := exporter.Export(ctx, ExportFilter{Language: e.Language})
+	if err != nil {
+		return Joke{}, err
+	}
+	j, ok := pickTodayFrom(stored, e.Filter, seed)
+	if !ok {
+		return Joke{}, ErrNoJokes
+	}
+	return e.tellToday(ctx, j, day)
+}
+
+// pickToday picks the joke of the day picked by seed from src, and
+// reports whether src can pick one
+func (e *Engine) pickToday(ctx context.Context, src Source, seed uint64) (Joke, bool, error) {
+	var j Joke
+	switch src := src.(type) {
+	case ListSource:
+		var jokes []Joke
+		err := e.attempt(ctx, src, func(ctx context.Context) error {
+			var err error
+			jokes, err = src.List(ctx)
+			return err
+		})
+		if err != nil {
+			return Joke{}, false, fmt.Errorf("error fetching jokes from %s: %w", src.Name(), err)
+		}
+		var ok bool
+		if j, ok = pickTodayFrom(jokes, e.Filter, seed); !ok {
+			return Joke{}, false, fmt.Errorf("no joke from %s passes the filter", src.Name())
+		}
+	case IndexSource:
+		var err error
+		if j, err = e.fetchToday(ctx, src, seed); err != nil {
+			return Joke{}, false, err
+		}
+	default:
+		return Joke{}, false, nil
+	}
+	if j.Source == "" {
+		j.Source = src.Name()
+	}
+	if j.Language == "" {
+		j.Language = src.Language()
+	}
+	return j, true, nil
+}
+
+// fetchToday fetches the joke at the position seed picks from src, or the
+// next one the filter allows
+func (e *Engine) fetchToday(ctx context.Context, src IndexSource, seed uint64) (Joke, error) {
+	var n int
+	err := e.attempt(ctx, src, func(ctx context.Context) error {
+		var err error
+		n, err = src.Count(ctx)
+		return err
+	})
+	if err != nil {
+		return Joke{}, fmt.Errorf("error counting the jokes of %s: %w", src.Name(), err)
+	}
+	if n <= 0 {
+		return Joke{}, fmt.Errorf("%s has no jokes", src.Name())
+	}
+	for i := range min(e.MaxDuplicates, n) {
+		var j Joke
+		err := e.attempt(ctx, src, func(ctx context.Context) error {
+			var err error
+			j, err = src.FetchIndex(ctx, int((seed+uint64(i))%uint64(n)))
+			return err
+		})
+		if err != nil {
+			return Joke{}, fmt.Errorf("error fetching joke from %s: %w", src.Name(), err)
+		}
+		if e.Filter.Allows(j) {
+			return j, nil
+		}
+	}
+	return Joke{}, fmt.Errorf("no joke from %s passes the filter", src.Name())
+}
+
+// pickTodayFrom picks the joke seed points to among the jokes f allows.
+// The jokes are ordered by their text first, so the pick doesn't depend
+// on the order they come in.
+func pickTodayFrom(jokes []Joke, f Filter, seed uint64) (Joke, bool) {
+	type candidate struct {
+		hash string
+		joke Joke
+	}
+	var candidates []candidate
+	for _, j := range jokes {
+		if f.Allows(j) {
+			candidates = append(candidates, candidate{textHash(j.Text), j})
+		}
+	}
+	if len(candidates) == 0 {
+		return Joke{}, false
+	}
+	slices.SortFunc(candidates, func(a, b candidate) int { return cmp.Compare(a.hash, b.hash) })
+	return candidates[seed%uint64(len(candidates))].joke, true
+}
+
+// tellToday stores j as told, unless it was told on the date of day
+// already, and returns it as stored
+func (e *Engine) tellToday(ctx context.Context, j Joke, day time.Time) (Joke, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	stored, err := e.Store.Find(ctx, j)
+	if errors.Is(err, ErrNotFound) {
+		now := time.Now()
+		j.ToldAt = &now
+		err = e.Store.Save(ctx, &j)
+		if !errors.Is(err, ErrDuplicate) {
+			return j, err
+		}
+		// Another process stored it in the meantime
+		stored, err = e.Store.Find(ctx, j)
+	}
+	if err != nil {
+		return Joke{}, fmt.Errorf("error checking joke existence: %w", err)
+	}
+	if stored.ToldAt != nil && sameDay(*stored.ToldAt, day) {
+		return stored, nil
+	}
+	// Telling it at the same time as another process tells it once
+	if _, err := e.claim(ctx, &stored); err != nil {
+		return Joke{}, err
+	}
+	return stored, nil
+}
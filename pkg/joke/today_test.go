@@ -0,0 +1,95 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestEngineTodayFromIndex(t *testing.T) {
+	ctx := context.Background()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if r.URL.Path != "/search" || r.URL.Query().Get("limit") != "1" || page < 1 || page > 20 {
+			t.Errorf("Unexpected request %s", r.URL)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"results": [{"id": "%d", "joke": "Joke number %d"}], "total_jokes": 20, "total_pages": 20}`, page, page)
+	}))
+	defer server.Close()
+
+	// Jokes are marked told now, so the joke of today is picked
+	day := time.Now()
+	store := newTestStore(t)
+	engine := NewEngine(store, newTestSource(server))
+	first, err := engine.Today(ctx, day, DefaultTodaySalt)
+	if err != nil {
+		t.Fatalf("Today() returned an error: %v", err)
+	}
+	if first.ID == 0 || first.TimesTold != 1 {
+		t.Errorf("Today() = %+v, want a stored joke told once", first)
+	}
+	again, err := engine.Today(ctx, day, DefaultTodaySalt)
+	if err != nil || again.ID != first.ID || again.TimesTold != 1 {
+		t.Errorf("Today() later that day = %+v, %v, want %+v again, not told again", again, err, first)
+	}
+
+	// Someone else gets the same joke
+	other, err := NewEngine(newTestStore(t), newTestSource(server)).Today(ctx, day, DefaultTodaySalt)
+	if err != nil || other.Text != first.Text {
+		t.Errorf("Today() with another store = %+v, %v, want %q", other, err, first.Text)
+	}
+
+	// Offline, the stored jokes are picked from
+	engine.Offline = true
+	if offline, err := engine.Today(ctx, day.AddDate(0, 0, 1), DefaultTodaySalt); err != nil || offline.ID != first.ID || offline.TimesTold != 2 {
+		t.Errorf("Today() offline the next day = %+v, %v, want the only stored joke told again", offline, err)
+	}
+}
+
+func TestEngineTodayFromList(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "jokes.txt")
+	var content string
+	for i := range 30 {
+		content += fmt.Sprintf("Team joke %d\n", i)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	src := NewFileSource("team", path, "en")
+
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	picks := map[string]bool{}
+	for i := range 5 {
+		j, err := NewEngine(newTestStore(t), src).Today(ctx, day, DefaultTodaySalt)
+		if err != nil {
+			t.Fatalf("Today() returned an error: %v", err)
+		}
+		picks[j.Text] = true
+		if i > 0 && len(picks) != 1 {
+			t.Fatalf("Today() picked %v on the same day, want a single joke", picks)
+		}
+	}
+
+	// Other days and salts pick other jokes, mostly
+	for i := range 10 {
+		j, err := NewEngine(newTestStore(t), src).Today(ctx, day.AddDate(0, 0, i+1), "our team")
+		if err != nil {
+			t.Fatalf("Today() returned an error: %v", err)
+		}
+		picks[j.Text] = true
+	}
+	if len(picks) < 3 {
+		t.Errorf("Today() picked %v on 11 days, want more variety", picks)
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Translator translates text from one language into another. Languages
+// are ISO 639-1 codes like "en".
+type Translator interface {
+	// Name identifies the translator, e.g. "deepl"
+	Name() string
+	Translate(ctx context.Context, text, from, to string) (string, error)
+}
+
+// Translation is a joke translated into another language
+type Translation struct {
+	// Original is the text of the joke in From
+	Original string
+	From     string
+	// Text is the translation of Original in Language
+	Text     string
+	Language string
+	// Translator is the name of the Translator that made the translation
+	Translator string
+}
+
+// TranslationStore is a Store that keeps translations along with their
+// original, so the same joke is only translated once
+type TranslationStore interface {
+	Store
+	// Translation returns the translation of original into lang, or
+	// ErrNotFound if it was never translated
+	Translation(ctx context.Context, original, lang string) (Translation, error)
+	// SaveTranslation stores t, replacing an earlier translation of the
+	// same original into the same language
+	SaveTranslation(ctx context.Context, t Translation) error
+}
+
+// TranslatedSource tells the jokes of another source translated into its
+// language, so a language without sources of its own can borrow jokes
+type TranslatedSource struct {
+	Source     Source
+	Translator Translator
+	// Cache keeps the translations, if set, so jokes that were translated
+	// before are not sent to the translator again
+	Cache TranslationStore
+	lang  string
+}
+
+// NewTranslatedSource returns a source telling the jokes of src in lang,
+// translated with translator. It is named after src and lang, like
+// "icanhazdadjoke-de".
+func NewTranslatedSource(src Source, translator Translator, lang string) *TranslatedSource {
+	return &TranslatedSource{Source: src, Translator: translator, lang: normalizeLanguage(lang)}
+}
+
+// Name implements Source
+func (s *TranslatedSource) Name() string {
+	return s.Source.Name() + "-" + s.lang
+}
+
+// Language implements Source
+func (s *TranslatedSource) Language() string {
+	return s.lang
+}
+
+// Fetch implements Source
+func (s *TranslatedSource) Fetch(ctx context.Context) (Joke, error) {
+	j, err := s.Source.Fetch(ctx)
+	if err != nil {
+		return Joke{}, err
+	}
+	from := j.Language
+	if from == "" {
+		from = s.Source.Language()
+	}
+
+	text, err := s.translate(ctx, j.Text, from)
+	if err != nil {
+		return Joke{}, err
+	}
+	j.Text = text
+	j.Source = s.Name()
+	j.Language = s.lang
+	return j, nil
+}
+
+// translate returns text translated from from into the language of the
+// source, from the cache if it was translated before
+func (s *TranslatedSource) translate(ctx context.Context, text, from string) (string, error) {
+	if s.Cache != nil {
+		t, err := s.Cache.Translation(ctx, text, s.lang)
+		if err == nil {
+			return t.Text, nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			log.Warn().Err(err).Msg("Could not read the translation cache")
+		}
+	}
+
+	translated, err := s.Translator.Translate(ctx, text, from, s.lang)
+	if err != nil {
+		return "", fmt.Errorf("error translating joke with %s: %w", s.Translator.Name(), err)
+	}
+	if translated = strings.TrimSpace(translated); translated == "" {
+		return "", fmt.Errorf("%s returned an empty translation", s.Translator.Name())
+	}
+
+	if s.Cache != nil {
+		if err := s.Cache.SaveTranslation(ctx, Translation{
+			Original:   text,
+			From:       from,
+			Text:       translated,
+			Language:   s.lang,
+			Translator: s.Translator.Name(),
+		}); err != nil {
+			log.Warn().Err(err).Msg("Could not cache the translation")
+		}
+	}
+	return translated, nil
+}
+
+// postJSON sends in as JSON to url with the given headers and decodes the
+// JSON response into out
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("error encoding request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := checkStatus(resp); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response body: %w", err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("error parsing JSON: %w", err)
+	}
+	return nil
+}
+
+// Translation implements TranslationStore
+func (s *SQLiteStore) Translation(ctx context.Context, original, lang string) (Translation, error) {
+	t := Translation{Language: lang}
+	err := s.db.QueryRowContext(ctx, "SELECT original, original_language, joke, translator FROM translations WHERE hash = ? AND language = ?",
+		textHash(original), lang).Scan(&t.Original, &t.From, &t.Text, &t.Translator)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Translation{}, ErrNotFound
+	}
+	if err != nil {
+		return Translation{}, fmt.Errorf("error getting translation: %w", err)
+	}
+	return t, nil
+}
+
+// SaveTranslation implements TranslationStore
+func (s *SQLiteStore) SaveTranslation(ctx context.Context, t Translation) error {
+	if _, err := s.db.ExecContext(ctx, `INSERT INTO translations (hash, language, original, original_language, joke, translator, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (hash, language) DO UPDATE SET original = excluded.original, original_language = excluded.original_language,
+			joke = excluded.joke, translator = excluded.translator, created_at = excluded.created_at`,
+		textHash(t.Original), t.Language, t.Original, t.From, t.Text, t.Translator, time.Now().UTC()); err != nil {
+		return fmt.Errorf("error saving translation: %w", err)
+	}
+	return nil
+}
+
+var _ TranslationStore = (*SQLiteStore)(nil)
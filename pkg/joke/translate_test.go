@@ -0,0 +1,111 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// upperTranslator "translates" text by shouting it
+type upperTranslator struct {
+	calls int
+}
+
+func (t *upperTranslator) Name() string { return "upper" }
+
+func (t *upperTranslator) Translate(_ context.Context, text, _, _ string) (string, error) {
+	t.calls++
+	return strings.ToUpper(text), nil
+}
+
+func TestTranslatedSource(t *testing.T) {
+	store := newTestStore(t)
+	tr := &upperTranslator{}
+	src := NewTranslatedSource(&staticSource{name: "dad", lang: "en", text: "Hi hungry, I'm dad."}, tr, "DE")
+	src.Cache = store
+	if src.Name() != "dad-de" || src.Language() != "de" {
+		t.Errorf("NewTranslatedSource() is %s in %s, want dad-de in de", src.Name(), src.Language())
+	}
+
+	for i := 0; i < 2; i++ {
+		j, err := src.Fetch(context.Background())
+		if err != nil {
+			t.Fatalf("Fetch() returned an error: %v", err)
+		}
+		if j.Text != "HI HUNGRY, I'M DAD." || j.Source != "dad-de" || j.Language != "de" {
+			t.Errorf("Fetch() = %+v, want the translation from dad-de", j)
+		}
+	}
+	if tr.calls != 1 {
+		t.Errorf("Translate() was called %d times, want the second fetch from the cache", tr.calls)
+	}
+
+	cached, err := store.Translation(context.Background(), "Hi hungry, I'm dad.", "de")
+	if err != nil {
+		t.Fatalf("Translation() returned an error: %v", err)
+	}
+	if cached.Original != "Hi hungry, I'm dad." || cached.From != "en" || cached.Translator != "upper" {
+		t.Errorf("Translation() = %+v, want the original in English by upper", cached)
+	}
+}
+
+func TestTranslators(t *testing.T) {
+	var got map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = map[string]any{"path": r.URL.Path, "key": r.URL.Query().Get("key"), "auth": r.Header.Get("Authorization")}
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		got["body"] = body
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/deepl":
+			_, _ = w.Write([]byte(`{"translations": [{"detected_source_language": "EN", "text": "Hallo"}]}`))
+		case "/google":
+			_, _ = w.Write([]byte(`{"data": {"translations": [{"translatedText": "Hallo &quot;Papa&quot;"}]}}`))
+		default:
+			_, _ = w.Write([]byte(`{"translatedText": "Hallo"}`))
+		}
+	}))
+	defer server.Close()
+
+	deepl := NewDeepL("secret:fx")
+	if deepl.URL != DeepLFreeURL {
+		t.Errorf("NewDeepL() with a free key uses %s, want the free endpoint", deepl.URL)
+	}
+	deepl.URL = server.URL + "/deepl"
+	google := NewGoogleTranslate("secret")
+	google.URL = server.URL + "/google"
+	libre := NewLibreTranslate(server.URL+"/", "secret")
+
+	testCases := []struct {
+		translator Translator
+		want       string
+		check      func() bool
+	}{
+		{deepl, "Hallo", func() bool {
+			return got["auth"] == "DeepL-Auth-Key secret:fx" && got["body"].(map[string]any)["target_lang"] == "DE"
+		}},
+		{google, `Hallo "Papa"`, func() bool { return got["key"] == "secret" && got["body"].(map[string]any)["target"] == "de" }},
+		{libre, "Hallo", func() bool { return got["path"] == "/translate" && got["body"].(map[string]any)["api_key"] == "secret" }},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.translator.Name(), func(t *testing.T) {
+			text, err := tc.translator.Translate(context.Background(), "Hello", "en", "de")
+			if err != nil {
+				t.Fatalf("Translate() returned an error: %v", err)
+			}
+			if text != tc.want {
+				t.Errorf("Translate() = %q, want %q", text, tc.want)
+			}
+			if !tc.check() {
+				t.Errorf("Translate() sent %v", got)
+			}
+		})
+	}
+}
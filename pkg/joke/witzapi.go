@@ -0,0 +1,15 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+// WitzAPIURL is the default endpoint of WitzAPI, which returns a list
+// holding one random German joke
+const WitzAPIURL = "https://witzapi.de/api/joke/"
+
+// NewWitzAPI returns a source using the public WitzAPI
+func NewWitzAPI() *HTTPSource {
+	src := NewHTTPSource("witzapi", "de", WitzAPIURL)
+	src.JokeField = "0.text"
+	return src
+}
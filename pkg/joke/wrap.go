@@ -0,0 +1,134 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package joke
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// wrappedStore is embedded by stores wrapping another Store. It passes on
+// the calls of the optional store interfaces the engine uses, so wrapping
+// a store doesn't turn off source health, rate limits, translations,
+// embeddings and refills, nor searches and statistics. Stores that don't
+// implement them act as if empty, except that untold jokes can't be
+// counted, searched or summed up.
+type wrappedStore struct {
+	Store
+}
+
+// SourceHealth implements HealthStore
+func (s wrappedStore) SourceHealth(ctx context.Context, source string) (SourceHealth, error) {
+	if health, ok := s.Store.(HealthStore); ok {
+		return health.SourceHealth(ctx, source)
+	}
+	return SourceHealth{Source: source}, nil
+}
+
+// SourceHealths implements HealthStore
+func (s wrappedStore) SourceHealths(ctx context.Context) ([]SourceHealth, error) {
+	if health, ok := s.Store.(HealthStore); ok {
+		return health.SourceHealths(ctx)
+	}
+	return nil, nil
+}
+
+// RecordFetch implements HealthStore
+func (s wrappedStore) RecordFetch(ctx context.Context, source string, latency time.Duration, err error) error {
+	if health, ok := s.Store.(HealthStore); ok {
+		return health.RecordFetch(ctx, source, latency, err)
+	}
+	return nil
+}
+
+// TakeToken implements LimitStore
+func (s wrappedStore) TakeToken(ctx context.Context, source string, limit RateLimit) (time.Duration, error) {
+	if limits, ok := s.Store.(LimitStore); ok {
+		return limits.TakeToken(ctx, source, limit)
+	}
+	return 0, nil
+}
+
+// BlockSource implements LimitStore
+func (s wrappedStore) BlockSource(ctx context.Context, source string, until time.Time) error {
+	if limits, ok := s.Store.(LimitStore); ok {
+		return limits.BlockSource(ctx, source, until)
+	}
+	return nil
+}
+
+// Translation implements TranslationStore
+func (s wrappedStore) Translation(ctx context.Context, original, lang string) (Translation, error) {
+	if translations, ok := s.Store.(TranslationStore); ok {
+		return translations.Translation(ctx, original, lang)
+	}
+	return Translation{}, ErrNotFound
+}
+
+// SaveTranslation implements TranslationStore
+func (s wrappedStore) SaveTranslation(ctx context.Context, t Translation) error {
+	if translations, ok := s.Store.(TranslationStore); ok {
+		return translations.SaveTranslation(ctx, t)
+	}
+	return nil
+}
+
+// SaveEmbedding implements EmbeddingStore
+func (s wrappedStore) SaveEmbedding(ctx context.Context, id int64, model string, vector []float32) error {
+	if embeddings, ok := s.Store.(EmbeddingStore); ok {
+		return embeddings.SaveEmbedding(ctx, id, model, vector)
+	}
+	return nil
+}
+
+// Embeddings implements EmbeddingStore
+func (s wrappedStore) Embeddings(ctx context.Context, model, lang string) (map[int64][]float32, error) {
+	if embeddings, ok := s.Store.(EmbeddingStore); ok {
+		return embeddings.Embeddings(ctx, model, lang)
+	}
+	return nil, nil
+}
+
+// Unembedded implements EmbeddingStore
+func (s wrappedStore) Unembedded(ctx context.Context, model string, limit int) ([]Joke, error) {
+	if embeddings, ok := s.Store.(EmbeddingStore); ok {
+		return embeddings.Unembedded(ctx, model, limit)
+	}
+	return nil, nil
+}
+
+// CountUntold implements StockStore
+func (s wrappedStore) CountUntold(ctx context.Context, lang string) (int, error) {
+	if stock, ok := s.Store.(StockStore); ok {
+		return stock.CountUntold(ctx, lang)
+	}
+	return 0, errors.ErrUnsupported
+}
+
+// Search implements Searcher
+func (s wrappedStore) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	if searcher, ok := s.Store.(Searcher); ok {
+		return searcher.Search(ctx, query, limit)
+	}
+	return nil, errors.ErrUnsupported
+}
+
+// Tellings implements StatsStore
+func (s wrappedStore) Tellings(ctx context.Context) ([]Telling, error) {
+	if stats, ok := s.Store.(StatsStore); ok {
+		return stats.Tellings(ctx)
+	}
+	return nil, errors.ErrUnsupported
+}
+
+var (
+	_ HealthStore      = wrappedStore{}
+	_ LimitStore       = wrappedStore{}
+	_ TranslationStore = wrappedStore{}
+	_ EmbeddingStore   = wrappedStore{}
+	_ StockStore       = wrappedStore{}
+	_ Searcher         = wrappedStore{}
+	_ StatsStore       = wrappedStore{}
+)
@@ -0,0 +1,222 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+// Package plugin extends godad with joke sources shipped as separate
+// programs. A source plugin serves the Source service of proto/source.proto
+// over gRPC, using HashiCorp's go-plugin. Plugins written in Go only need
+// to call Serve:
+//
+//	func main() {
+//		plugin.Serve(mySource{})
+//	}
+//
+// godad starts every plugin in its plugins directory whose file name starts
+// with Prefix.
+package plugin
+
+//go:generate protoc -I proto --go_out=proto --go_opt=paths=source_relative --go-grpc_out=proto --go-grpc_opt=paths=source_relative source.proto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/hashicorp/go-hclog"
+	goplugin "github.com/hashicorp/go-plugin"
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/lhaig/godad/pkg/plugin/proto"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+)
+
+// Prefix is the start of the file names of source plugins
+const Prefix = "godad-source-"
+
+// Handshake makes sure godad and a plugin speak the same protocol. It is
+// not a security measure.
+var Handshake = goplugin.HandshakeConfig{
+	ProtocolVersion:  1,
+	MagicCookieKey:   "GODAD_PLUGIN",
+	MagicCookieValue: "source",
+}
+
+// pluginName is the name the source is dispensed under
+const pluginName = "source"
+
+// sourcePlugin serves a joke.Source in plugins and connects to it in godad
+type sourcePlugin struct {
+	goplugin.NetRPCUnsupportedPlugin
+	src joke.Source
+}
+
+// GRPCServer implements goplugin.GRPCPlugin
+func (p *sourcePlugin) GRPCServer(_ *goplugin.GRPCBroker, s *grpc.Server) error {
+	proto.RegisterSourceServer(s, &server{src: p.src})
+	return nil
+}
+
+// GRPCClient implements goplugin.GRPCPlugin
+func (p *sourcePlugin) GRPCClient(_ context.Context, _ *goplugin.GRPCBroker, c *grpc.ClientConn) (any, error) {
+	return proto.NewSourceClient(c), nil
+}
+
+// server serves a joke.Source over gRPC
+type server struct {
+	proto.UnimplementedSourceServer
+	src joke.Source
+}
+
+// Info implements proto.SourceServer
+func (s *server) Info(context.Context, *proto.InfoRequest) (*proto.InfoResponse, error) {
+	return &proto.InfoResponse{Name: s.src.Name(), Language: s.src.Language()}, nil
+}
+
+// Fetch implements proto.SourceServer
+func (s *server) Fetch(ctx context.Context, _ *proto.FetchRequest) (*proto.FetchResponse, error) {
+	j, err := s.src.Fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.FetchResponse{Joke: j.Text, Id: j.UpstreamID, Language: j.Language}, nil
+}
+
+// Serve serves src to godad. Plugins call it from main, and it returns
+// once godad stops the plugin.
+func Serve(src joke.Source) {
+	goplugin.Serve(&goplugin.ServeConfig{
+		HandshakeConfig: Handshake,
+		Plugins:         goplugin.PluginSet{pluginName: &sourcePlugin{src: src}},
+		GRPCServer:      goplugin.DefaultGRPCServer,
+	})
+}
+
+// Source is a joke source served by a plugin
+type Source struct {
+	client *goplugin.Client
+	rpc    proto.SourceClient
+	name   string
+	lang   string
+}
+
+// newSource returns the source served through rpc, asking it for its name
+// and language
+func newSource(ctx context.Context, rpc proto.SourceClient) (*Source, error) {
+	info, err := rpc.Info(ctx, &proto.InfoRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("error asking plugin for its name: %w", err)
+	}
+	if info.Name == "" {
+		return nil, errors.New("plugin did not tell its name")
+	}
+	lang := info.Language
+	if lang == "" {
+		lang = joke.DefaultLanguage
+	}
+	return &Source{rpc: rpc, name: info.Name, lang: lang}, nil
+}
+
+// Load starts the plugin at path and returns the source it serves. Stop
+// the plugin with Close, or with CleanupClients when godad exits.
+func Load(path string) (*Source, error) {
+	client := goplugin.NewClient(&goplugin.ClientConfig{
+		HandshakeConfig: Handshake,
+		Plugins:         goplugin.PluginSet{pluginName: &sourcePlugin{}},
+		// #nosec G204 -- running plugins from the plugins directory is the point
+		Cmd:              exec.Command(path),
+		AllowedProtocols: []goplugin.Protocol{goplugin.ProtocolGRPC},
+		Managed:          true,
+		Logger: hclog.New(&hclog.LoggerOptions{
+			Name:   filepath.Base(path),
+			Output: log.Logger,
+			Level:  hclog.Warn,
+		}),
+	})
+
+	src, err := dispense(client)
+	if err != nil {
+		client.Kill()
+		return nil, fmt.Errorf("error loading plugin %s: %w", path, err)
+	}
+	return src, nil
+}
+
+// dispense connects to the plugin started by client
+func dispense(client *goplugin.Client) (*Source, error) {
+	conn, err := client.Client()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := conn.Dispense(pluginName)
+	if err != nil {
+		return nil, err
+	}
+	rpc, ok := raw.(proto.SourceClient)
+	if !ok {
+		return nil, fmt.Errorf("plugin served a %T, not a source", raw)
+	}
+	src, err := newSource(context.Background(), rpc)
+	if err != nil {
+		return nil, err
+	}
+	src.client = client
+	return src, nil
+}
+
+// Name implements joke.Source
+func (s *Source) Name() string {
+	return s.name
+}
+
+// Language implements joke.Source
+func (s *Source) Language() string {
+	return s.lang
+}
+
+// Fetch implements joke.Source
+func (s *Source) Fetch(ctx context.Context) (joke.Joke, error) {
+	resp, err := s.rpc.Fetch(ctx, &proto.FetchRequest{})
+	if err != nil {
+		return joke.Joke{}, err
+	}
+	if resp.Joke == "" {
+		return joke.Joke{}, errors.New("plugin returned an empty joke")
+	}
+	j := joke.Joke{Text: resp.Joke, UpstreamID: resp.Id, Source: s.name, Language: s.lang}
+	if resp.Language != "" {
+		j.Language = resp.Language
+	}
+	return j, nil
+}
+
+// Close stops the plugin
+func (s *Source) Close() {
+	if s.client != nil {
+		s.client.Kill()
+	}
+}
+
+// Discover returns the paths of the plugins in dir. A missing directory
+// holds no plugins.
+func Discover(dir string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, Prefix+"*"))
+	if err != nil {
+		return nil, err
+	}
+	var plugins []string
+	for _, path := range matches {
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		plugins = append(plugins, path)
+	}
+	return plugins, nil
+}
+
+// CleanupClients stops every plugin started with Load
+func CleanupClients() {
+	goplugin.CleanupClients()
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2024 Lance Haig
+// SPDX-License-Identifier: MPL-2.0
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	goplugin "github.com/hashicorp/go-plugin"
+	"github.com/lhaig/godad/pkg/joke"
+	"github.com/lhaig/godad/pkg/plugin/proto"
+)
+
+// testSource tells the same joke every time, or fails with err
+type testSource struct {
+	err error
+}
+
+func (testSource) Name() string     { return "test" }
+func (testSource) Language() string { return "de" }
+
+func (s testSource) Fetch(context.Context) (joke.Joke, error) {
+	return joke.Joke{Text: "Ein Witz", UpstreamID: "1"}, s.err
+}
+
+// connect serves src over an in-process gRPC connection and returns the
+// source godad sees
+func connect(t *testing.T, src joke.Source) *Source {
+	t.Helper()
+	client, _ := goplugin.TestPluginGRPCConn(t, false, map[string]goplugin.Plugin{pluginName: &sourcePlugin{src: src}})
+	t.Cleanup(func() { client.Close() })
+
+	raw, err := client.Dispense(pluginName)
+	if err != nil {
+		t.Fatalf("Dispense() returned an error: %v", err)
+	}
+	s, err := newSource(context.Background(), raw.(proto.SourceClient))
+	if err != nil {
+		t.Fatalf("newSource() returned an error: %v", err)
+	}
+	return s
+}
+
+func TestSource(t *testing.T) {
+	src := connect(t, testSource{})
+	if src.Name() != "test" || src.Language() != "de" {
+		t.Errorf("Name(), Language() = %s, %s, want test, de", src.Name(), src.Language())
+	}
+
+	j, err := src.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch() returned an error: %v", err)
+	}
+	if j.Text != "Ein Witz" || j.UpstreamID != "1" || j.Source != "test" || j.Language != "de" {
+		t.Errorf("Fetch() = %+v, want the joke from the plugin", j)
+	}
+
+	failing := connect(t, testSource{err: errors.New("no jokes today")})
+	if _, err := failing.Fetch(context.Background()); err == nil {
+		t.Errorf("Fetch() did not return the error of the plugin")
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{Prefix + "one", Prefix + "two", "other"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o700); err != nil {
+			t.Fatalf("Error writing %s: %v", name, err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, Prefix+"dir"), 0o700); err != nil {
+		t.Fatalf("Error creating a directory: %v", err)
+	}
+
+	plugins, err := Discover(dir)
+	if err != nil {
+		t.Fatalf("Discover() returned an error: %v", err)
+	}
+	want := []string{filepath.Join(dir, Prefix+"one"), filepath.Join(dir, Prefix+"two")}
+	if !slices.Equal(plugins, want) {
+		t.Errorf("Discover() = %v, want %v", plugins, want)
+	}
+
+	if plugins, err := Discover(filepath.Join(dir, "missing")); err != nil || len(plugins) != 0 {
+		t.Errorf("Discover() of a missing directory = %v, %v, want no plugins", plugins, err)
+	}
+}